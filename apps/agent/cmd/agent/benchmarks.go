@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bloxos/agent/internal/collector"
+	"github.com/bloxos/agent/internal/executor"
+	"github.com/bloxos/agent/internal/ws"
+)
+
+// Hashrate watchdog: a warmed-up miner below this share of its expected
+// hashrate for lowHashratePolls polls in a row is reported
+const (
+	lowHashrateShare  = 0.8
+	lowHashratePolls  = 3
+	lowHashrateWarmup = 10 * time.Minute
+)
+
+var (
+	benchMu     sync.Mutex
+	benchGPUs   []collector.GPUStats // From the latest stats poll
+	lowPolls    int
+	lowReported bool
+)
+
+// rememberGPUs keeps the latest GPU list to match miner stats to models
+func rememberGPUs(gpus []collector.GPUStats) {
+	benchMu.Lock()
+	defer benchMu.Unlock()
+	benchGPUs = gpus
+}
+
+func lastGPUs() []collector.GPUStats {
+	benchMu.Lock()
+	defer benchMu.Unlock()
+	return benchGPUs
+}
+
+// recordBenchmarks learns expected hashrates per GPU model from a miner poll
+func recordBenchmarks(stats *collector.MinerStats) {
+	gpus := lastGPUs()
+	var readings []executor.BenchmarkReading
+	for _, minerGPU := range stats.GPUStats {
+		gpu := collector.MinerGPU(gpus, minerGPU)
+		if gpu == nil {
+			continue
+		}
+		power := minerGPU.Power
+		if power == 0 && gpu.PowerDraw != nil {
+			power = *gpu.PowerDraw
+		}
+		readings = append(readings, executor.BenchmarkReading{GPUModel: gpu.Name, Hashrate: minerGPU.Hashrate, Power: power})
+	}
+	exec.RecordBenchmarks(stats.Algorithm, stats.Name, stats.Version, time.Duration(stats.Uptime)*time.Second, readings)
+}
+
+// expectedHashrate sums the benchmarks of the GPUs a miner reports. ok is
+// false unless each of them has one.
+func expectedHashrate(stats *collector.MinerStats) (float64, bool) {
+	if stats == nil || stats.Algorithm == "" || len(stats.GPUStats) == 0 {
+		return 0, false
+	}
+	gpus := lastGPUs()
+	total := 0.0
+	for _, minerGPU := range stats.GPUStats {
+		gpu := collector.MinerGPU(gpus, minerGPU)
+		if gpu == nil {
+			return 0, false
+		}
+		benchmark, ok := exec.ExpectedHashrate(gpu.Name, stats.Algorithm, stats.Name, stats.Version)
+		if !ok {
+			return 0, false
+		}
+		total += benchmark.Hashrate
+	}
+	return total, true
+}
+
+// checkHashrate reports a miner that stays well below the hashrate its GPUs
+// reach per the benchmarks, and when it recovers
+func checkHashrate(client *ws.Client, stats *collector.MinerStats, expected float64) {
+	if time.Duration(stats.Uptime)*time.Second < lowHashrateWarmup {
+		return
+	}
+
+	low := stats.Hashrate < expected*lowHashrateShare
+	var event *ws.Event
+	benchMu.Lock()
+	switch {
+	case low:
+		lowPolls++
+		if lowPolls >= lowHashratePolls && !lowReported {
+			lowReported = true
+			event = &ws.Event{
+				Type:     "hashrate_low",
+				Severity: "warning",
+				Message: fmt.Sprintf("%s at %.0f%% of the expected %s hashrate (%.2f of %.2f MH/s)",
+					stats.Name, stats.Hashrate/expected*100, stats.Algorithm, stats.Hashrate/1e6, expected/1e6),
+			}
+		}
+	case lowReported:
+		lowPolls, lowReported = 0, false
+		event = &ws.Event{
+			Type:     "hashrate_low",
+			Severity: "info",
+			Message:  fmt.Sprintf("%s back at %.0f%% of the expected hashrate", stats.Name, stats.Hashrate/expected*100),
+		}
+	default:
+		lowPolls = 0
+	}
+	benchMu.Unlock()
+
+	if event == nil {
+		return
+	}
+	event.Data = map[string]interface{}{"hashrate": stats.Hashrate, "expected": expected, "algorithm": stats.Algorithm}
+	log.Println(event.Message)
+	if err := client.SendEvent(event); err != nil {
+		log.Printf("Failed to send hashrate event: %v", err)
+	}
+}
+
+// resetHashrateWatch forgets low readings once the miner is gone
+func resetHashrateWatch() {
+	benchMu.Lock()
+	defer benchMu.Unlock()
+	lowPolls, lowReported = 0, false
+}
+
+// hashrateLow reports whether the miner is in a reported low hashrate
+// episode
+func hashrateLow() bool {
+	benchMu.Lock()
+	defer benchMu.Unlock()
+	return lowReported
+}
+
+// handleSyncBenchmarks stores the server's expected hashrates and returns
+// the ones learned on this rig
+func handleSyncBenchmarks(payload interface{}) (bool, interface{}, error) {
+	var req struct {
+		Benchmarks []executor.Benchmark `json:"benchmarks"`
+		Replace    bool                 `json:"replace"` // Drop previously synced entries first
+	}
+	if payload != nil {
+		if err := decodePayload(payload, &req); err != nil {
+			return false, nil, err
+		}
+	}
+
+	learned, err := exec.SyncBenchmarks(req.Benchmarks, req.Replace)
+	if err != nil {
+		return false, nil, err
+	}
+
+	log.Printf("Synced %d benchmark(s), %d learned on this rig", len(req.Benchmarks), len(learned))
+	return true, map[string]interface{}{"learned": learned}, nil
+}
+
+// hashrateProjection is what the rig would make on an algorithm, for
+// profit switching
+type hashrateProjection struct {
+	Algorithm string            `json:"algorithm"`
+	Hashrate  float64           `json:"hashrate"` // H/s
+	Power     int               `json:"power"`    // W, where benchmarks have it
+	Miners    map[string]string `json:"miners"`   // Best miner by GPU vendor
+	Covered   int               `json:"covered"`  // GPUs with a benchmark
+	GPUs      int               `json:"gpus"`
+}
+
+// handleProjectHashrate projects the rig's hashrate on each requested
+// algorithm (default: every known one) from the benchmarks, picking the
+// best benchmarked miner per GPU vendor
+func handleProjectHashrate(payload interface{}) (bool, interface{}, error) {
+	var req struct {
+		Algorithms []string `json:"algorithms"`
+	}
+	if payload != nil {
+		if err := decodePayload(payload, &req); err != nil {
+			return false, nil, err
+		}
+	}
+	if len(req.Algorithms) == 0 {
+		req.Algorithms = executor.Algorithms()
+	}
+
+	gpus := lastGPUs()
+	if len(gpus) == 0 {
+		return false, nil, fmt.Errorf("no GPU stats collected yet")
+	}
+	byVendor := map[string][]collector.GPUStats{}
+	for _, gpu := range gpus {
+		vendor := strings.ToLower(gpu.Vendor)
+		byVendor[vendor] = append(byVendor[vendor], gpu)
+	}
+
+	var projections []hashrateProjection
+	for _, algorithm := range req.Algorithms {
+		projection := hashrateProjection{Algorithm: strings.ToLower(algorithm), Miners: map[string]string{}, GPUs: len(gpus)}
+		for vendor, group := range byVendor {
+			candidates := map[string]bool{}
+			for _, gpu := range group {
+				for _, miner := range exec.BenchmarkMiners(gpu.Name, algorithm) {
+					candidates[miner] = true
+				}
+			}
+
+			var best struct {
+				miner    string
+				hashrate float64
+				power    int
+				covered  int
+			}
+			for miner := range candidates {
+				hashrate, power, covered := 0.0, 0, 0
+				for _, gpu := range group {
+					if b, ok := exec.ExpectedHashrate(gpu.Name, algorithm, miner, ""); ok {
+						hashrate += b.Hashrate
+						power += b.Power
+						covered++
+					}
+				}
+				if hashrate > best.hashrate || hashrate == best.hashrate && miner < best.miner {
+					best.miner, best.hashrate, best.power, best.covered = miner, hashrate, power, covered
+				}
+			}
+			if best.miner != "" {
+				projection.Miners[vendor] = best.miner
+				projection.Hashrate += best.hashrate
+				projection.Power += best.power
+				projection.Covered += best.covered
+			}
+		}
+		if projection.Covered > 0 {
+			projections = append(projections, projection)
+		}
+	}
+	return true, map[string]interface{}{"projections": projections}, nil
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/host"
+
+	"github.com/bloxos/agent/internal/collector"
+	"github.com/bloxos/agent/internal/config"
+	"github.com/bloxos/agent/internal/resolver"
+	"github.com/bloxos/agent/internal/system"
+	"github.com/bloxos/agent/internal/ws"
+)
+
+// Boot check results, from best to worst
+const (
+	checkOK      = "ok"
+	checkWarning = "warning"
+	checkFailed  = "failed"
+)
+
+var checkRank = map[string]int{checkOK: 0, checkWarning: 1, checkFailed: 2}
+
+// BootCheck is one self-test of the boot report
+type BootCheck struct {
+	Name    string      `json:"name"` // gpus, fans, dns, disk, clock
+	Status  string      `json:"status"`
+	Message string      `json:"message,omitempty"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// BootReport is the self-test run when the agent starts
+type BootReport struct {
+	Status       string      `json:"status"` // Worst check result
+	Checks       []BootCheck `json:"checks"`
+	Uptime       uint64      `json:"uptime"` // Seconds; small after a power event, large after an agent restart
+	AgentVersion string      `json:"agentVersion"`
+	Timestamp    int64       `json:"timestamp"`
+}
+
+// Thresholds of the boot self-test
+const (
+	bootFanHotTemp  = 60              // °C at which a stopped fan is a fault, not zero-RPM idle
+	bootMinFreeDisk = 1 << 30         // Bytes
+	bootDNSTimeout  = 5 * time.Second // Per host
+	bootMinYear     = 2024            // An earlier clock means a dead RTC battery and no NTP yet
+)
+
+// sendBootReport runs the self-test and sends it once connected, flagging
+// a degraded rig with an event as well
+func sendBootReport(cfg *config.Config, coll *collector.Collector) {
+	report := runBootChecks(cfg, coll)
+	log.Printf("Boot self-test: %s", report.Status)
+	for _, check := range report.Checks {
+		if check.Status != checkOK {
+			log.Printf("  %s: %s (%s)", check.Name, check.Status, check.Message)
+		}
+	}
+
+	for !wsClient.AnyConnected() {
+		time.Sleep(time.Second)
+	}
+	if err := wsClient.SendBootReport(report); err != nil {
+		log.Printf("Failed to send boot report: %v", err)
+	}
+
+	if report.Status != checkOK {
+		severity := "warning"
+		if report.Status == checkFailed {
+			severity = "critical"
+		}
+		event := &ws.Event{
+			Type:     "boot_degraded",
+			Severity: severity,
+			Message:  "Rig came up degraded: " + failedChecks(report),
+			Data:     report,
+		}
+		if err := wsClient.SendEvent(event); err != nil {
+			log.Printf("Failed to send boot degraded event: %v", err)
+		}
+	}
+}
+
+// runBootChecks runs every self-test
+func runBootChecks(cfg *config.Config, coll *collector.Collector) *BootReport {
+	report := &BootReport{
+		Status:       checkOK,
+		AgentVersion: version,
+		Timestamp:    time.Now().UnixMilli(),
+	}
+	if info, err := host.Info(); err == nil {
+		report.Uptime = info.Uptime
+	}
+
+	if cfg.GPUEnabled {
+		gpus, err := coll.GetGPUStats()
+		report.Checks = append(report.Checks, checkGPUs(coll, gpus, err), checkFans(gpus))
+	}
+	report.Checks = append(report.Checks, checkDNS(cfg), checkDisk(), checkClock())
+
+	for _, check := range report.Checks {
+		if checkRank[check.Status] > checkRank[report.Status] {
+			report.Status = check.Status
+		}
+	}
+	return report
+}
+
+// checkGPUs verifies every GPU on the PCI bus answers through its driver
+func checkGPUs(coll *collector.Collector, gpus []collector.GPUStats, err error) BootCheck {
+	check := BootCheck{Name: "gpus", Status: checkOK}
+
+	presence := coll.CheckGPUPresence(gpus, nil)
+	presence.Missing = withoutExcludedGPUs(presence.Missing)
+	check.Data = presence
+	check.Message = fmt.Sprintf("%d of %d GPUs respond", presence.Driver, presence.PCI)
+	switch {
+	case presence.PCI == 0:
+		check.Status = checkWarning
+		check.Message = "no GPUs found on the PCI bus"
+	case err != nil:
+		check.Status = checkFailed
+		check.Message = err.Error()
+	case len(presence.Missing) > 0:
+		check.Status = checkFailed
+	}
+	return check
+}
+
+// checkFans flags fans reporting 0% on a warm GPU or not reporting at all.
+// A stopped fan on a cool GPU is normal zero-RPM idle.
+func checkFans(gpus []collector.GPUStats) BootCheck {
+	check := BootCheck{Name: "fans", Status: checkOK}
+	var stopped, unknown []string
+	for _, gpu := range gpus {
+		switch {
+		case gpu.FanSpeed == nil:
+			unknown = append(unknown, gpu.BusID)
+		case *gpu.FanSpeed == 0 && gpu.Temperature != nil && *gpu.Temperature >= bootFanHotTemp:
+			stopped = append(stopped, gpu.BusID)
+		}
+	}
+
+	switch {
+	case len(stopped) > 0:
+		check.Status = checkFailed
+		check.Message = fmt.Sprintf("fans stopped on hot GPUs %v", stopped)
+	case len(unknown) > 0:
+		check.Status = checkWarning
+		check.Message = fmt.Sprintf("no fan reading from GPUs %v", unknown)
+	}
+	check.Data = map[string][]string{"stopped": stopped, "unknown": unknown}
+	return check
+}
+
+// checkDNS resolves the server and the configured pools
+func checkDNS(cfg *config.Config) BootCheck {
+	check := BootCheck{Name: "dns", Status: checkOK}
+
+	hosts := []string{resolver.HostOf(cfg.ServerURL)}
+	if configs, err := exec.GetConfigs(); err == nil {
+		for _, minerConfig := range configs {
+			for _, pool := range append([]string{minerConfig.Pool}, minerConfig.FailoverPools...) {
+				hosts = append(hosts, resolver.HostOf(pool))
+			}
+		}
+	}
+
+	failed := map[string]string{}
+	checked := map[string]bool{}
+	for _, hostname := range hosts {
+		if hostname == "" || checked[hostname] {
+			continue
+		}
+		checked[hostname] = true
+		ctx, cancel := context.WithTimeout(context.Background(), bootDNSTimeout)
+		_, err := net.DefaultResolver.LookupHost(ctx, hostname)
+		cancel()
+		if err != nil {
+			failed[hostname] = err.Error()
+		}
+	}
+
+	if len(failed) > 0 {
+		check.Status = checkFailed
+		check.Message = fmt.Sprintf("%d of %d hosts do not resolve", len(failed), len(checked))
+		check.Data = failed
+	}
+	return check
+}
+
+// checkDisk writes a file to the agent state directory and checks the boot
+// media for errors and free space
+func checkDisk() BootCheck {
+	check := BootCheck{Name: "disk", Status: checkOK}
+
+	home, _ := os.UserHomeDir()
+	dir := filepath.Join(home, ".bloxos")
+	path := filepath.Join(dir, ".boot_check")
+	err := os.MkdirAll(dir, 0755)
+	if err == nil {
+		err = os.WriteFile(path, []byte(time.Now().String()), 0644)
+	}
+	if err != nil {
+		check.Status = checkFailed
+		check.Message = fmt.Sprintf("not writable: %v", err)
+		return check
+	}
+	os.Remove(path)
+
+	// Boot media wearing out logs I/O errors before it goes read-only
+	if health := system.CheckDiskHealth(dir); health.IOErrors > 0 || health.FSErrors > 0 {
+		check.Status = checkWarning
+		check.Message = describeDiskHealth(health)
+		check.Data = health
+		return check
+	}
+
+	if usage, err := disk.Usage(dir); err == nil {
+		check.Data = map[string]uint64{"free": usage.Free, "total": usage.Total}
+		if usage.Free < bootMinFreeDisk {
+			check.Status = checkWarning
+			check.Message = fmt.Sprintf("only %d MB free", usage.Free>>20)
+		}
+	}
+	return check
+}
+
+// checkClock rejects clocks from before the agent could have been built and
+// warns when NTP hasn't synced yet
+func checkClock() BootCheck {
+	check := BootCheck{Name: "clock", Status: checkOK}
+
+	now := time.Now()
+	status := system.GetTimeSyncStatus()
+	check.Data = status
+	switch {
+	case now.Year() < bootMinYear:
+		check.Status = checkFailed
+		check.Message = fmt.Sprintf("clock reads %s", now.Format(time.RFC3339))
+	case !status.Synchronized:
+		check.Status = checkWarning
+		check.Message = "clock is not NTP-synchronized"
+	}
+	return check
+}
+
+// failedChecks lists the checks that did not pass
+func failedChecks(report *BootReport) string {
+	message := ""
+	for _, check := range report.Checks {
+		if check.Status == checkOK {
+			continue
+		}
+		if message != "" {
+			message += ", "
+		}
+		message += fmt.Sprintf("%s (%s)", check.Name, check.Message)
+	}
+	return message
+}
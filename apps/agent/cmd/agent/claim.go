@@ -0,0 +1,291 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bloxos/agent/internal/api"
+	"github.com/bloxos/agent/internal/config"
+	"github.com/bloxos/agent/internal/qrcode"
+	"github.com/bloxos/agent/internal/system"
+)
+
+const (
+	// claimPoll is how often the server is asked whether the code was
+	// entered; claimRetryMax caps the wait while it's unreachable
+	claimPoll     = 5 * time.Second
+	claimRetryMax = time.Minute
+	// claimReshow prints the code on the console again, in case kernel
+	// messages scrolled it away
+	claimReshow = 5 * time.Minute
+)
+
+// claimAlphabet leaves out characters easily mistaken for others (0/O,
+// 1/I)
+const claimAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// claimState is the code the rig waits to be claimed with. It's kept
+// across reboots, as the user may have written it down already.
+type claimState struct {
+	Code    string `json:"code"`
+	Secret  string `json:"secret"`
+	Created int64  `json:"created"`
+}
+
+func claimPath() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".bloxos", "claim.json")
+}
+
+func loadClaim() *claimState {
+	data, err := os.ReadFile(claimPath())
+	if err != nil {
+		return nil
+	}
+	var state claimState
+	if err := json.Unmarshal(data, &state); err != nil || state.Code == "" || state.Secret == "" {
+		return nil
+	}
+	return &state
+}
+
+// newClaim generates a code like "ABCD-EFGH" and its secret
+func newClaim() (*claimState, error) {
+	var code strings.Builder
+	for i := 0; i < 8; i++ {
+		if i == 4 {
+			code.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(claimAlphabet))))
+		if err != nil {
+			return nil, err
+		}
+		code.WriteByte(claimAlphabet[n.Int64()])
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	state := &claimState{Code: code.String(), Secret: hex.EncodeToString(secret), Created: time.Now().Unix()}
+	if data, err := json.Marshal(state); err == nil {
+		os.MkdirAll(filepath.Dir(claimPath()), 0755)
+		if err := os.WriteFile(claimPath(), data, 0600); err != nil {
+			log.Printf("Failed to save claim code: %v", err)
+		}
+	}
+	return state, nil
+}
+
+// claimLink is the dashboard page the QR code opens with the code filled in
+func claimLink(cfg *config.Config, code string) string {
+	base := cfg.ClaimURL
+	if base == "" {
+		base = strings.TrimRight(cfg.ServerURL, "/") + "/claim"
+	}
+	separator := "?"
+	if strings.Contains(base, "?") {
+		separator = "&"
+	}
+	return base + separator + "code=" + url.QueryEscape(code)
+}
+
+// claimRig waits until the rig is claimed in the dashboard with a code
+// shown on the console and a local page, then stores and returns the token
+// the server issued for it. Runs on first boot, when no token is
+// configured, so tokens needn't be copied onto every new rig.
+func claimRig(cfg *config.Config, hostname string, sigChan chan os.Signal) string {
+	state := loadClaim()
+	if state == nil {
+		var err error
+		if state, err = newClaim(); err != nil {
+			log.Fatalf("Failed to generate claim code: %v", err)
+		}
+	}
+
+	page := &claimPage{cfg: cfg, hostname: hostname}
+	page.set(state.Code, false)
+	var server *http.Server
+	if cfg.ClaimListen != "" {
+		server = &http.Server{Addr: cfg.ClaimListen, Handler: page, ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Printf("Claim page unavailable: %v", err)
+			}
+		}()
+	}
+
+	client := api.New(cfg.ServerURL, "")
+	registered := false
+	retry := claimPoll
+	var shown time.Time
+	for {
+		if time.Since(shown) >= claimReshow {
+			showClaimCode(cfg, hostname, state.Code)
+			shown = time.Now()
+		}
+
+		wait := claimPoll
+		if !registered {
+			err := client.StartClaim(&api.ClaimRequest{
+				Code:         state.Code,
+				Secret:       state.Secret,
+				Hostname:     hostname,
+				InstanceID:   instanceID,
+				AgentVersion: version,
+				Addresses:    localAddresses(),
+			})
+			if err != nil {
+				log.Printf("Claim: server unreachable, retrying in %s: %v", retry, err)
+				wait = retry
+				retry = min(retry*2, claimRetryMax)
+			} else {
+				registered = true
+				retry = claimPoll
+				page.set(state.Code, true)
+			}
+		}
+
+		if registered {
+			status, err := client.PollClaim(state.Code, state.Secret)
+			switch {
+			case err != nil:
+				if cfg.Debug {
+					log.Printf("Claim poll failed: %v", err)
+				}
+			case status.Status == "claimed" && status.Token != "":
+				if err := config.SaveToken(status.Token); err != nil {
+					log.Printf("Failed to save token, the rig must be claimed again after a restart: %v", err)
+				}
+				os.Remove(claimPath())
+				if server != nil {
+					server.Close()
+				}
+				log.Println("Rig claimed")
+				system.WriteConsole("\nBloxOs: rig claimed, starting the agent\n")
+				return status.Token
+			case status.Status == "expired":
+				log.Println("Claim code expired, generating a new one")
+				if state, err = newClaim(); err != nil {
+					log.Fatalf("Failed to generate claim code: %v", err)
+				}
+				registered = false
+				page.set(state.Code, false)
+				shown = time.Time{}
+				continue
+			}
+		}
+
+		select {
+		case <-sigChan:
+			log.Println("Shutting down")
+			os.Exit(0)
+		case <-time.After(wait):
+		}
+	}
+}
+
+// showClaimCode prints the code and its QR code to the log and the rig's
+// monitor
+func showClaimCode(cfg *config.Config, hostname, code string) {
+	link := claimLink(cfg, code)
+	var b strings.Builder
+	fmt.Fprintf(&b, "\nBloxOs: this rig (%s) is waiting to be claimed.\n", hostname)
+	fmt.Fprintf(&b, "Enter the code %s in the dashboard, or scan:\n\n", code)
+	if qr, err := qrcode.Encode(link); err == nil {
+		b.WriteString(qr.Terminal())
+	}
+	fmt.Fprintf(&b, "\n%s\n", link)
+	if cfg.ClaimListen != "" {
+		_, port, _ := net.SplitHostPort(cfg.ClaimListen)
+		for _, address := range localAddresses() {
+			fmt.Fprintf(&b, "Code also shown at http://%s\n", net.JoinHostPort(address, port))
+		}
+	}
+
+	fmt.Print(b.String())
+	if err := system.WriteConsole(b.String()); err != nil && cfg.Debug {
+		log.Printf("Failed to write to the console: %v", err)
+	}
+}
+
+// localAddresses returns the rig's LAN IPv4 addresses
+func localAddresses() []string {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+	var addresses []string
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLoopback() && ipnet.IP.To4() != nil {
+			addresses = append(addresses, ipnet.IP.String())
+		}
+	}
+	return addresses
+}
+
+// claimPage serves the claim code on the LAN, for rigs without a monitor
+type claimPage struct {
+	cfg      *config.Config
+	hostname string
+
+	mu         sync.Mutex
+	code       string
+	registered bool
+}
+
+func (p *claimPage) set(code string, registered bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.code = code
+	p.registered = registered
+}
+
+func (p *claimPage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	p.mu.Lock()
+	code, registered := p.code, p.registered
+	p.mu.Unlock()
+
+	link := claimLink(p.cfg, code)
+	qr := ""
+	if c, err := qrcode.Encode(link); err == nil {
+		qr = c.SVG(6)
+	}
+	status := "Connecting to the server&hellip; the code works once it's reachable."
+	if registered {
+		status = "Waiting for the code to be entered in the dashboard."
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	// Refreshes to pick up a new code or the claim
+	fmt.Fprintf(w, `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta http-equiv="refresh" content="10"><title>Claim %s</title></head>
+<body style="font-family:sans-serif;text-align:center">
+<h1>%s</h1>
+<p>Enter this code in the BloxOs dashboard to add the rig:</p>
+<p style="font-size:3em;font-family:monospace">%s</p>
+%s
+<p><a href="%s">%s</a></p>
+<p>%s</p>
+</body></html>
+`, html.EscapeString(p.hostname), html.EscapeString(p.hostname), html.EscapeString(code), qr,
+		html.EscapeString(link), html.EscapeString(link), status)
+}
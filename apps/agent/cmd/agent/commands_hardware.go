@@ -0,0 +1,282 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bloxos/agent/internal/config"
+	"github.com/bloxos/agent/internal/executor"
+	"github.com/bloxos/agent/internal/ipmi"
+)
+
+// handleGetInventory returns a full hardware inventory of the rig
+func handleGetInventory() (bool, interface{}, error) {
+	inventory, err := coll.GetInventory()
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to collect inventory: %w", err)
+	}
+
+	log.Printf("Inventory collected: %d GPU(s), %d disk(s), %d NIC(s)",
+		len(inventory.GPUs), len(inventory.Storage), len(inventory.NICs))
+	return true, inventory, nil
+}
+
+// handleBMCPower runs an IPMI chassis power action
+func handleBMCPower(payload interface{}) (bool, interface{}, error) {
+	if bmc == nil {
+		return false, nil, fmt.Errorf("no BMC available")
+	}
+
+	var req struct {
+		Action string `json:"action"` // status, on, off, cycle, reset, soft
+	}
+	if err := decodePayload(payload, &req); err != nil {
+		return false, nil, err
+	}
+	if req.Action == "" {
+		req.Action = "status"
+	}
+	if !ipmi.IsPowerAction(req.Action) {
+		return false, nil, fmt.Errorf("invalid power action: %s", req.Action)
+	}
+
+	// Actions that take the rig down run after responding
+	if req.Action != "status" {
+		go func() {
+			time.Sleep(2 * time.Second)
+			log.Printf("BMC power %s", req.Action)
+			if _, err := bmc.Power(req.Action); err != nil {
+				log.Printf("BMC power %s failed: %v", req.Action, err)
+			}
+		}()
+		return true, nil, nil
+	}
+
+	status, err := bmc.Power("status")
+	if err != nil {
+		return false, nil, err
+	}
+	return true, map[string]string{"status": status}, nil
+}
+
+// handleNvidiaSetup sets NVIDIA persistence and compute mode
+func handleNvidiaSetup(payload interface{}, cfg *config.Config) (bool, interface{}, error) {
+	req := struct {
+		Persistence *bool  `json:"persistence"`
+		ComputeMode string `json:"computeMode"`
+	}{}
+	if payload != nil {
+		if err := decodePayload(payload, &req); err != nil {
+			return false, nil, err
+		}
+	}
+
+	persistence := cfg.NvidiaPersistence
+	if req.Persistence != nil {
+		persistence = *req.Persistence
+	}
+	computeMode := cfg.NvidiaComputeMode
+	if req.ComputeMode != "" {
+		computeMode = req.ComputeMode
+	}
+
+	status, err := exec.SetupNvidia(persistence, computeMode)
+	if err != nil {
+		return false, status, err
+	}
+	return true, status, nil
+}
+
+// handleFlashVBIOS flashes a GPU vBIOS in two steps: verify and back up,
+// then flash on a repeated request carrying the returned nonce
+func handleFlashVBIOS(payload interface{}, cfg *config.Config) (bool, interface{}, error) {
+	if payload == nil {
+		return false, nil, fmt.Errorf("flash request required")
+	}
+
+	var req executor.VBIOSFlashRequest
+	if err := decodePayload(payload, &req); err != nil {
+		return false, nil, err
+	}
+
+	var allowed []string
+	for _, model := range strings.Split(cfg.VBIOSModels, ",") {
+		if model = strings.TrimSpace(model); model != "" {
+			allowed = append(allowed, model)
+		}
+	}
+
+	result, err := exec.FlashVBIOS(&req, allowed)
+	if err != nil {
+		return false, nil, err
+	}
+
+	if result.Stage == "flashed" {
+		log.Printf("Flashed vBIOS on %s GPU %d (backup: %s)", req.Vendor, req.GPUIndex, result.Backup)
+	}
+	return true, result, nil
+}
+
+// handlePowerSave switches idle power saving on or off, e.g. for
+// maintenance. Enabling it stops the miner first.
+func handlePowerSave(payload interface{}) (bool, interface{}, error) {
+	var req struct {
+		Enabled bool `json:"enabled"`
+		Suspend bool `json:"suspend"` // Suspend the rig once GPUs are idle
+	}
+	if err := decodePayload(payload, &req); err != nil {
+		return false, nil, err
+	}
+
+	if !req.Enabled {
+		if err := exec.ExitPowerSave(); err != nil {
+			return false, nil, err
+		}
+		return true, nil, nil
+	}
+
+	if err := exec.StopMiner(); err != nil {
+		return false, nil, fmt.Errorf("failed to stop miner: %w", err)
+	}
+	return enterPowerSave(req.Suspend)
+}
+
+// enterPowerSave drops the idle GPUs to minimum power and optionally
+// suspends the rig once the command result has been sent
+func enterPowerSave(suspend bool) (bool, interface{}, error) {
+	status, err := exec.EnterPowerSave()
+	if err != nil {
+		return false, nil, err
+	}
+
+	if suspend {
+		go func() {
+			time.Sleep(2 * time.Second)
+			if err := exec.Suspend(); err != nil {
+				log.Printf("Suspend failed: %v", err)
+			}
+		}()
+	}
+	return true, status, nil
+}
+
+// handleParkGPUs takes GPUs out of mining at minimum power and reports
+// what each one saves
+func handleParkGPUs(payload interface{}) (bool, interface{}, error) {
+	var req struct {
+		BusIDs []string `json:"busIds"`
+	}
+	if err := decodePayload(payload, &req); err != nil {
+		return false, nil, err
+	}
+	parked, err := exec.ParkGPUs(req.BusIDs)
+	if err != nil {
+		return false, nil, err
+	}
+	return true, parked, nil
+}
+
+// handleUnparkGPUs returns parked GPUs to mining; no bus IDs unparks all
+func handleUnparkGPUs(payload interface{}) (bool, interface{}, error) {
+	var req struct {
+		BusIDs []string `json:"busIds"`
+	}
+	if payload != nil {
+		if err := decodePayload(payload, &req); err != nil {
+			return false, nil, err
+		}
+	}
+	parked, err := exec.UnparkGPUs(req.BusIDs)
+	if err != nil {
+		return false, nil, err
+	}
+	return true, parked, nil
+}
+
+// handleDisableGPU excludes GPUs from mining, OC and the GPU watchdogs
+// until enable_gpu, across reboots
+func handleDisableGPU(payload interface{}) (bool, interface{}, error) {
+	var req struct {
+		BusIDs []string `json:"busIds"`
+		BusID  string   `json:"busId"`
+		Reason string   `json:"reason"`
+	}
+	if err := decodePayload(payload, &req); err != nil {
+		return false, nil, err
+	}
+	if req.BusID != "" {
+		req.BusIDs = append(req.BusIDs, req.BusID)
+	}
+	disabled, err := exec.DisableGPUs(req.BusIDs, req.Reason)
+	if err != nil {
+		return false, disabled, err
+	}
+	return true, disabled, nil
+}
+
+// handleEnableGPU returns disabled GPUs to mining; no bus IDs enables all
+func handleEnableGPU(payload interface{}) (bool, interface{}, error) {
+	var req struct {
+		BusIDs []string `json:"busIds"`
+		BusID  string   `json:"busId"`
+	}
+	if payload != nil {
+		if err := decodePayload(payload, &req); err != nil {
+			return false, nil, err
+		}
+	}
+	if req.BusID != "" {
+		req.BusIDs = append(req.BusIDs, req.BusID)
+	}
+	disabled, err := exec.EnableGPUs(req.BusIDs)
+	if err != nil {
+		return false, disabled, err
+	}
+	return true, disabled, nil
+}
+
+// handleSetLEDs turns GPU RGB lighting off or sets a static color
+func handleSetLEDs(payload interface{}) (bool, interface{}, error) {
+	req := executor.LEDRequest{Mode: "off"}
+	if payload != nil {
+		if err := decodePayload(payload, &req); err != nil {
+			return false, nil, err
+		}
+	}
+
+	results, err := exec.SetLEDs(&req)
+	if err != nil {
+		return false, results, err
+	}
+	return true, results, nil
+}
+
+// handleSetFans sets GPU fan speeds on their own, without a full OC. The
+// payload is one setting (all GPUs unless gpuIndex is given) or a list:
+//
+//	{"speed": 80}
+//	{"gpus": [{"gpuIndex": 0, "speed": 90}, {"gpuIndex": 1, "fans": [70, 85]}]}
+func handleSetFans(payload interface{}) (bool, interface{}, error) {
+	if payload == nil {
+		return false, nil, fmt.Errorf("fan settings required")
+	}
+	req := struct {
+		executor.FanSetting
+		GPUs []executor.FanSetting `json:"gpus"`
+	}{FanSetting: executor.FanSetting{GPUIndex: -1}}
+	if err := decodePayload(payload, &req); err != nil {
+		return false, nil, err
+	}
+
+	settings := req.GPUs
+	if len(settings) == 0 {
+		settings = []executor.FanSetting{req.FanSetting}
+	}
+	results, err := exec.SetFans(settings)
+	if err != nil {
+		return false, results, err
+	}
+	return true, results, nil
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bloxos/agent/internal/config"
+	"github.com/bloxos/agent/internal/network"
+	"github.com/bloxos/agent/internal/ws"
+)
+
+// speedTestRunning is set while a speed test runs
+var speedTestRunning atomic.Bool
+
+// handleSpeedTest measures bandwidth and latency to the server in the
+// background and reports the result as a speed_test event
+func handleSpeedTest(payload interface{}, cfg *config.Config) (bool, interface{}, error) {
+	testCfg := network.SpeedTestConfig{
+		DownloadURL: cfg.SpeedTestDownloadURL,
+		UploadURL:   cfg.SpeedTestUploadURL,
+	}
+	if payload != nil {
+		if err := decodePayload(payload, &testCfg); err != nil {
+			return false, nil, err
+		}
+	}
+	// Latency is always measured against the configured server
+	testCfg.ServerURL = cfg.ServerURL
+	if testCfg.Bytes > network.MaxSpeedTestBytes {
+		return false, nil, fmt.Errorf("bytes must be at most %d", network.MaxSpeedTestBytes)
+	}
+
+	// Transfers only go to the server or the configured endpoints, so the
+	// command can't point the rig at an arbitrary host
+	for _, target := range []string{testCfg.DownloadURL, testCfg.UploadURL} {
+		if err := checkSpeedTestURL(target, cfg); err != nil {
+			return false, nil, err
+		}
+	}
+
+	if !speedTestRunning.CompareAndSwap(false, true) {
+		return false, nil, fmt.Errorf("a speed test is already running")
+	}
+	go runSpeedTest(testCfg)
+	return true, map[string]interface{}{"started": true}, nil
+}
+
+// runSpeedTest runs a speed test and reports how it went
+func runSpeedTest(testCfg network.SpeedTestConfig) {
+	defer speedTestRunning.Store(false)
+
+	log.Println("Running speed test...")
+	event := &ws.Event{Type: "speed_test", Severity: "info"}
+	result, err := network.RunSpeedTest(testCfg)
+	if err != nil {
+		event.Severity = "warning"
+		event.Message = fmt.Sprintf("Speed test failed: %v", err)
+	} else {
+		event.Message = fmt.Sprintf("Speed test: latency %.1fms, down %.1f Mbps, up %.1f Mbps",
+			result.LatencyMs, result.DownloadMbps, result.UploadMbps)
+		event.Data = result
+	}
+	log.Println(event.Message)
+
+	if wsClient == nil || !wsClient.AnyConnected() {
+		return
+	}
+	if err := wsClient.SendEvent(event); err != nil {
+		log.Printf("Failed to send speed test event: %v", err)
+	}
+}
+
+// checkSpeedTestURL accepts a transfer URL on the server's host or on the
+// host of the configured (or default) speed test endpoints
+func checkSpeedTestURL(target string, cfg *config.Config) error {
+	if target == "" {
+		return nil
+	}
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("invalid speed test URL %q", target)
+	}
+
+	allowed := []string{cfg.ServerURL, network.DefaultDownloadURL, network.DefaultUploadURL}
+	for _, configured := range []string{cfg.SpeedTestDownloadURL, cfg.SpeedTestUploadURL} {
+		if configured != "" {
+			allowed = append(allowed, configured)
+		}
+	}
+	for _, candidate := range allowed {
+		if host, err := url.Parse(candidate); err == nil && strings.EqualFold(host.Hostname(), u.Hostname()) {
+			return nil
+		}
+	}
+	return fmt.Errorf("speed test URL %q is not on the server or a configured speed test host", target)
+}
+
+// handleConfigureNetwork sets a static IP (or DHCP) on an interface. The
+// change is applied in the background after responding, since it will
+// usually drop the connection, and rolled back if the server is unreachable.
+func handleConfigureNetwork(payload interface{}, cfg *config.Config) (bool, interface{}, error) {
+	var netCfg network.NetworkConfig
+	if err := decodePayload(payload, &netCfg); err != nil {
+		return false, nil, err
+	}
+	if err := netCfg.Validate(); err != nil {
+		return false, nil, err
+	}
+	if netCfg.RollbackTimeout <= 0 {
+		netCfg.RollbackTimeout = 60
+	}
+
+	backend, err := network.DetectBackend()
+	if err != nil {
+		return false, nil, err
+	}
+
+	target, err := network.ServerAddress(cfg.ServerURL)
+	if err != nil {
+		return false, nil, err
+	}
+
+	go func() {
+		time.Sleep(2 * time.Second)
+		log.Printf("Applying network config on %s via %s", netCfg.Interface, backend.Name())
+		err := network.ApplyWithRollback(backend, &netCfg, target)
+		sendNetworkEvent(&netCfg, err)
+	}()
+
+	return true, map[string]interface{}{
+		"backend":         backend.Name(),
+		"interface":       netCfg.Interface,
+		"rollbackTimeout": netCfg.RollbackTimeout,
+	}, nil
+}
+
+// pendingNetworkEvent holds the outcome of the last network config until
+// the server has it; the change itself usually drops the connection
+var (
+	pendingNetworkMu    sync.Mutex
+	pendingNetworkEvent *ws.Event
+)
+
+// sendNetworkEvent reports whether a network config was applied, rolled
+// back or failed, since the command itself returns before it is applied
+func sendNetworkEvent(netCfg *network.NetworkConfig, err error) {
+	event := &ws.Event{Type: "network", Severity: "info"}
+	status := "applied"
+	switch {
+	case err == nil:
+		event.Message = fmt.Sprintf("Network config applied on %s", netCfg.Interface)
+	case errors.Is(err, network.ErrRolledBack):
+		status = "rolled_back"
+		event.Severity = "warning"
+		event.Message = fmt.Sprintf("Network config on %s rolled back: %v", netCfg.Interface, err)
+	default:
+		status = "failed"
+		event.Severity = "critical"
+		event.Message = fmt.Sprintf("Network config on %s failed: %v", netCfg.Interface, err)
+	}
+	event.Data = map[string]interface{}{"interface": netCfg.Interface, "status": status}
+	log.Println(event.Message)
+
+	pendingNetworkMu.Lock()
+	pendingNetworkEvent = event
+	pendingNetworkMu.Unlock()
+	flushNetworkEvent()
+}
+
+// flushNetworkEvent sends the pending network event, keeping it for the
+// next connection when the server can't be reached
+func flushNetworkEvent() {
+	pendingNetworkMu.Lock()
+	defer pendingNetworkMu.Unlock()
+	if pendingNetworkEvent == nil || wsClient == nil || !wsClient.AnyConnected() {
+		return
+	}
+	if err := wsClient.SendEvent(pendingNetworkEvent); err != nil {
+		log.Printf("Failed to send network event, retrying after reconnecting: %v", err)
+		return
+	}
+	pendingNetworkEvent = nil
+}
+
+// handleWifiScan lists nearby Wi-Fi networks
+func handleWifiScan(payload interface{}) (bool, interface{}, error) {
+	var req struct {
+		Interface string `json:"interface"`
+	}
+	if payload != nil {
+		if err := decodePayload(payload, &req); err != nil {
+			return false, nil, err
+		}
+	}
+
+	networks, err := network.ScanWifi(req.Interface)
+	if err != nil {
+		return false, nil, fmt.Errorf("wifi scan failed: %w", err)
+	}
+	return true, networks, nil
+}
+
+// handleWifiConfigure saves (and optionally connects to) a Wi-Fi network
+func handleWifiConfigure(payload interface{}) (bool, interface{}, error) {
+	var wifiCfg network.WifiConfig
+	if err := decodePayload(payload, &wifiCfg); err != nil {
+		return false, nil, err
+	}
+
+	if err := network.ConfigureWifi(&wifiCfg); err != nil {
+		return false, nil, fmt.Errorf("wifi configure failed: %w", err)
+	}
+
+	log.Printf("Wi-Fi network %q configured (priority %d)", wifiCfg.SSID, wifiCfg.Priority)
+	return true, nil, nil
+}
+
+// handleWifiPrioritize changes the autoconnect priority of a saved network
+func handleWifiPrioritize(payload interface{}) (bool, interface{}, error) {
+	var req struct {
+		Interface string `json:"interface"`
+		SSID      string `json:"ssid"`
+		Priority  int    `json:"priority"`
+	}
+	if err := decodePayload(payload, &req); err != nil {
+		return false, nil, err
+	}
+	if req.SSID == "" {
+		return false, nil, fmt.Errorf("ssid required")
+	}
+
+	if err := network.PrioritizeWifi(req.Interface, req.SSID, req.Priority); err != nil {
+		return false, nil, fmt.Errorf("wifi prioritize failed: %w", err)
+	}
+	return true, nil, nil
+}
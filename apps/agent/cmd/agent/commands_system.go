@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/bloxos/agent/internal/config"
+	"github.com/bloxos/agent/internal/system"
+)
+
+// handleSetHostname changes the OS hostname
+func handleSetHostname(payload interface{}) (bool, interface{}, error) {
+	var req struct {
+		Hostname string `json:"hostname"`
+	}
+	if err := decodePayload(payload, &req); err != nil {
+		return false, nil, err
+	}
+	if req.Hostname == "" {
+		return false, nil, fmt.Errorf("hostname required")
+	}
+
+	return applyHostname(req.Hostname)
+}
+
+// handleRenameRig derives a hostname from the dashboard rig name and applies it
+func handleRenameRig(payload interface{}) (bool, interface{}, error) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := decodePayload(payload, &req); err != nil {
+		return false, nil, err
+	}
+
+	hostname := system.HostnameFromRigName(req.Name)
+	if hostname == "" {
+		return false, nil, fmt.Errorf("rig name %q does not contain any valid hostname characters", req.Name)
+	}
+
+	return applyHostname(hostname)
+}
+
+// applyHostname sets the hostname and refreshes the identity sent at auth
+func applyHostname(hostname string) (bool, interface{}, error) {
+	previous, _ := os.Hostname()
+
+	if err := system.SetHostname(hostname); err != nil {
+		return false, nil, fmt.Errorf("failed to set hostname: %w", err)
+	}
+
+	setAuthInfo("hostname", hostname)
+
+	log.Printf("Hostname changed: %s -> %s", previous, hostname)
+	return true, map[string]string{
+		"hostname": hostname,
+		"previous": previous,
+	}, nil
+}
+
+// handleSetTimezone changes the system timezone the local schedules run in
+func handleSetTimezone(payload interface{}) (bool, interface{}, error) {
+	var req struct {
+		Timezone string `json:"timezone"`
+	}
+	if err := decodePayload(payload, &req); err != nil {
+		return false, nil, err
+	}
+	if req.Timezone == "" {
+		return false, nil, fmt.Errorf("timezone required")
+	}
+	return applyTimezone(req.Timezone)
+}
+
+// applyTimezone sets the timezone and refreshes the one sent at auth
+func applyTimezone(timezone string) (bool, interface{}, error) {
+	previous := system.Timezone()
+	if err := system.SetTimezone(timezone); err != nil {
+		return false, nil, fmt.Errorf("failed to set timezone: %w", err)
+	}
+	// The schedulers read local time on each check, so they follow within
+	// a minute
+	setAuthInfo("timezone", timezone)
+
+	log.Printf("Timezone changed: %s -> %s", previous, timezone)
+	return true, map[string]string{
+		"timezone": timezone,
+		"previous": previous,
+	}, nil
+}
+
+// handleSetLocale changes the system locale
+func handleSetLocale(payload interface{}) (bool, interface{}, error) {
+	var req struct {
+		Locale string `json:"locale"`
+	}
+	if err := decodePayload(payload, &req); err != nil {
+		return false, nil, err
+	}
+	if req.Locale == "" {
+		return false, nil, fmt.Errorf("locale required")
+	}
+
+	previous := system.Locale()
+	if err := system.SetLocale(req.Locale); err != nil {
+		return false, nil, fmt.Errorf("failed to set locale: %w", err)
+	}
+	log.Printf("Locale changed: %s -> %s", previous, req.Locale)
+	return true, map[string]string{
+		"locale":   req.Locale,
+		"previous": previous,
+	}, nil
+}
+
+// applyProvisionedLocale sets the timezone and locale from the config when
+// the system's differ, e.g. on a freshly flashed image. Runs before the
+// server connections exist.
+func applyProvisionedLocale(cfg *config.Config) {
+	if cfg.Timezone != "" && cfg.Timezone != system.Timezone() {
+		if err := system.SetTimezone(cfg.Timezone); err != nil {
+			log.Printf("Provisioning: failed to set timezone: %v", err)
+		} else {
+			log.Printf("Timezone set to %s", cfg.Timezone)
+		}
+	}
+	if cfg.Locale != "" && cfg.Locale != system.Locale() {
+		if err := system.SetLocale(cfg.Locale); err != nil {
+			log.Printf("Provisioning: failed to set locale: %v", err)
+		} else {
+			log.Printf("Locale set to %s", cfg.Locale)
+		}
+	}
+}
+
+// handleSyncTime forces an immediate NTP resync
+func handleSyncTime() (bool, interface{}, error) {
+	method, err := system.ForceTimeSync()
+	if err != nil {
+		return false, nil, fmt.Errorf("time sync failed: %w", err)
+	}
+
+	log.Printf("Clock resynced via %s", method)
+	return true, system.GetTimeSyncStatus(), nil
+}
+
+// handleListGPUProcesses lists the processes using a GPU, marking the
+// agent's own miners
+func handleListGPUProcesses() (bool, interface{}, error) {
+	procs, err := system.ListGPUProcesses()
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to list GPU processes: %w", err)
+	}
+
+	managed := map[int]bool{}
+	for _, api := range exec.MinerAPIs() {
+		managed[api.PID] = true
+	}
+	for i := range procs {
+		procs[i].Managed = managed[procs[i].PID]
+	}
+	return true, procs, nil
+}
+
+// handleKillProcess kills a GPU process such as a stuck dev-fee or a
+// leftover benchmark. The name must match the PID's current process.
+func handleKillProcess(payload interface{}) (bool, interface{}, error) {
+	var req struct {
+		PID   int    `json:"pid"`
+		Name  string `json:"name"`
+		Force bool   `json:"force"` // SIGKILL right away
+	}
+	if err := decodePayload(payload, &req); err != nil {
+		return false, nil, err
+	}
+	if req.PID <= 0 || req.Name == "" {
+		return false, nil, fmt.Errorf("pid and name required")
+	}
+	for _, api := range exec.MinerAPIs() {
+		if api.PID == req.PID {
+			return false, nil, fmt.Errorf("pid %d is the agent's %s miner, use stop_miner", req.PID, api.Name)
+		}
+	}
+
+	if err := system.KillGPUProcess(req.PID, req.Name, req.Force); err != nil {
+		return false, nil, err
+	}
+
+	log.Printf("Killed GPU process %d (%s)", req.PID, req.Name)
+	return true, map[string]interface{}{"pid": req.PID, "name": req.Name}, nil
+}
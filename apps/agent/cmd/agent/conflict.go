@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/bloxos/agent/internal/ws"
+)
+
+// tokenConflictPath holds the current token conflict, for local tools
+// such as the console status screen; it's removed once resolved
+func tokenConflictPath() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".bloxos", "token_conflict.json")
+}
+
+// handleTokenConflict records a token conflict reported by the server and
+// raises an event where one can still be delivered, i.e. to the server
+// when it kept this agent connected, or to the extra servers
+func handleTokenConflict(conflict *ws.TokenConflict) {
+	if conflict == nil {
+		if err := os.Remove(tokenConflictPath()); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to clear token conflict: %v", err)
+		}
+		return
+	}
+
+	if data, err := json.MarshalIndent(conflict, "", "  "); err == nil {
+		os.MkdirAll(filepath.Dir(tokenConflictPath()), 0755)
+		if err := os.WriteFile(tokenConflictPath(), data, 0644); err != nil {
+			log.Printf("Failed to save token conflict: %v", err)
+		}
+	}
+
+	message := "Another agent is connected with this rig's token"
+	if conflict.Hostname != "" {
+		message += fmt.Sprintf(" (host %s)", conflict.Hostname)
+	}
+	if conflict.Refused {
+		message += "; this agent was refused and retries less often"
+	}
+	event := &ws.Event{
+		Type:     "token_conflict",
+		Severity: "critical",
+		Message:  message + ". Cloned disk image? Give each rig its own token.",
+		Data:     conflict,
+	}
+	go func() {
+		if wsClient.AnyConnected() {
+			if err := wsClient.SendEvent(event); err != nil && !conflict.Refused {
+				log.Printf("Failed to send token conflict event: %v", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bloxos/agent/internal/collector"
+	"github.com/bloxos/agent/internal/system"
+	"github.com/bloxos/agent/internal/ws"
+)
+
+// De-rating detection: each GPU's daily peak clocks under load and its
+// hashrate at each setting are kept for fingerprintDays. A card whose
+// recent week is deratingDrop below its first week is flagged; failing
+// memory and dried-out thermal paste show up like this weeks before the
+// card crashes.
+const (
+	fingerprintDays  = 56
+	deratingWindow   = 7    // Days compared at each end of the history
+	deratingDrop     = 0.05 // Share lost before a card is flagged
+	fingerprintLoad  = 90   // Utilization (%) at which clocks count as a ceiling
+	fingerprintFlush = 15 * time.Minute
+)
+
+// gpuFingerprint is the performance history of the card in one slot
+type gpuFingerprint struct {
+	Name    string            `json:"name"`
+	Days    []fingerprintDay  `json:"days"`              // Oldest first
+	Flagged map[string]string `json:"flagged,omitempty"` // Metric -> date reported
+}
+
+// fingerprintDay holds one day's peaks and hashrates
+type fingerprintDay struct {
+	Date      string                `json:"date"`    // YYYY-MM-DD
+	CoreMax   int                   `json:"coreMax"` // MHz
+	MemMax    int                   `json:"memMax"`  // MHz
+	Hashrates map[string]*rateTotal `json:"hashrates,omitempty"`
+}
+
+// rateTotal averages a day's hashrate at one setting
+type rateTotal struct {
+	Sum   float64 `json:"sum"`
+	Count int     `json:"count"`
+}
+
+// gpuDerating is a flagged metric of a card, reported with the stats
+type gpuDerating struct {
+	Index    int     `json:"index"`
+	BusID    string  `json:"busId"`
+	Name     string  `json:"name"`
+	Metric   string  `json:"metric"`            // "coreClock", "memClock" or "hashrate"
+	Setting  string  `json:"setting,omitempty"` // For hashrate: "algorithm@memClock"
+	Baseline float64 `json:"baseline"`          // First week
+	Recent   float64 `json:"recent"`            // Last week
+	Drop     float64 `json:"drop"`              // Percent
+	Days     int     `json:"days"`              // History compared
+}
+
+var (
+	fingerprintMu    sync.Mutex
+	fingerprints     map[string]*gpuFingerprint // By bus ID
+	fingerprintSaved time.Time
+	fingerprintDirty bool
+)
+
+func fingerprintsPath() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".bloxos", "gpu_fingerprints.json")
+}
+
+// loadFingerprints restores the history kept across reboots
+func loadFingerprints() {
+	fingerprintMu.Lock()
+	defer fingerprintMu.Unlock()
+	if fingerprints != nil {
+		return
+	}
+	fingerprints = make(map[string]*gpuFingerprint)
+	data, err := os.ReadFile(fingerprintsPath())
+	if err != nil {
+		return
+	}
+	if err := json.Unmarshal(data, &fingerprints); err != nil {
+		log.Printf("Ignoring invalid GPU fingerprints: %v", err)
+		fingerprints = make(map[string]*gpuFingerprint)
+	}
+}
+
+// flushFingerprints saves the history when it changed
+func flushFingerprints() {
+	fingerprintMu.Lock()
+	defer fingerprintMu.Unlock()
+	saveFingerprintsLocked()
+}
+
+func saveFingerprintsLocked() {
+	if !fingerprintDirty || system.DiskDegraded() {
+		return
+	}
+	data, err := json.Marshal(fingerprints)
+	if err == nil {
+		os.MkdirAll(filepath.Dir(fingerprintsPath()), 0755)
+		err = os.WriteFile(fingerprintsPath(), data, 0644)
+	}
+	if err != nil {
+		log.Printf("Failed to save GPU fingerprints: %v", err)
+		return
+	}
+	fingerprintDirty = false
+	fingerprintSaved = time.Now()
+}
+
+// recordFingerprints adds a stats poll to each card's history and returns
+// the cards that have de-rated. Newly flagged cards are reported with an
+// event.
+func recordFingerprints(client *ws.Client, gpus []collector.GPUStats, miner *collector.MinerStats) []gpuDerating {
+	loadFingerprints()
+
+	// Hashrate per bus ID
+	hashrates := map[string]float64{}
+	if miner != nil && miner.Running && miner.Algorithm != "" {
+		for _, minerGPU := range miner.GPUStats {
+			if gpu := collector.MinerGPU(gpus, minerGPU); gpu != nil && minerGPU.Hashrate > 0 {
+				hashrates[gpu.BusID] = minerGPU.Hashrate
+			}
+		}
+	}
+
+	fingerprintMu.Lock()
+	defer fingerprintMu.Unlock()
+
+	today := time.Now().Format("2006-01-02")
+	var derated []gpuDerating
+	for _, gpu := range gpus {
+		// A disabled card idles, which isn't de-rating
+		if gpu.BusID == "" || exec.GPUDisabled(gpu.BusID) {
+			continue
+		}
+		history := fingerprints[gpu.BusID]
+		if history == nil || history.Name != gpu.Name {
+			// New card, or a different one in the slot
+			history = &gpuFingerprint{Name: gpu.Name}
+			fingerprints[gpu.BusID] = history
+			fingerprintDirty = true
+		}
+		if len(history.Days) == 0 || history.Days[len(history.Days)-1].Date != today {
+			history.Days = append(history.Days, fingerprintDay{Date: today})
+			if len(history.Days) > fingerprintDays {
+				history.Days = history.Days[len(history.Days)-fingerprintDays:]
+			}
+			fingerprintDirty = true
+		}
+		day := &history.Days[len(history.Days)-1]
+
+		if gpu.Utilization != nil && *gpu.Utilization >= fingerprintLoad {
+			if gpu.CoreClock != nil && *gpu.CoreClock > day.CoreMax {
+				day.CoreMax = *gpu.CoreClock
+				fingerprintDirty = true
+			}
+			if gpu.MemoryClock != nil && *gpu.MemoryClock > day.MemMax {
+				day.MemMax = *gpu.MemoryClock
+				fingerprintDirty = true
+			}
+		}
+		if hashrate, ok := hashrates[gpu.BusID]; ok && gpu.MemoryClock != nil {
+			// The memory clock, rounded to 25 MHz, stands in for the applied
+			// overclock; the core clock boosts too much to tell settings apart
+			setting := fmt.Sprintf("%s@%d", miner.Algorithm, roundClock(*gpu.MemoryClock))
+			if day.Hashrates == nil {
+				day.Hashrates = make(map[string]*rateTotal)
+			}
+			if day.Hashrates[setting] == nil {
+				day.Hashrates[setting] = &rateTotal{}
+			}
+			day.Hashrates[setting].Sum += hashrate
+			day.Hashrates[setting].Count++
+			fingerprintDirty = true
+		}
+
+		for _, flag := range history.derating() {
+			flag.Index, flag.BusID, flag.Name = gpu.Index, gpu.BusID, gpu.Name
+			derated = append(derated, flag)
+			key := flag.Metric + flag.Setting
+			if history.Flagged[key] == "" {
+				if history.Flagged == nil {
+					history.Flagged = make(map[string]string)
+				}
+				history.Flagged[key] = today
+				fingerprintDirty = true
+				sendDeratingEvent(client, flag)
+			}
+		}
+	}
+
+	if time.Since(fingerprintSaved) >= fingerprintFlush {
+		saveFingerprintsLocked()
+	}
+	return derated
+}
+
+// derating compares the last week with the first week of the history.
+// Flags the card no longer trips are cleared, so a repasted card can be
+// flagged again later.
+func (p *gpuFingerprint) derating() []gpuDerating {
+	if len(p.Days) < 2*deratingWindow {
+		return nil
+	}
+	early := p.Days[:deratingWindow]
+	recent := p.Days[len(p.Days)-deratingWindow:]
+
+	var flags []gpuDerating
+	check := func(metric, setting string, baseline, now float64) {
+		if baseline > 0 && now > 0 && now < baseline*(1-deratingDrop) {
+			flags = append(flags, gpuDerating{
+				Metric:   metric,
+				Setting:  setting,
+				Baseline: baseline,
+				Recent:   now,
+				Drop:     (baseline - now) / baseline * 100,
+				Days:     len(p.Days),
+			})
+		}
+	}
+	check("coreClock", "", medianOf(early, func(d fingerprintDay) float64 { return float64(d.CoreMax) }),
+		medianOf(recent, func(d fingerprintDay) float64 { return float64(d.CoreMax) }))
+	check("memClock", "", medianOf(early, func(d fingerprintDay) float64 { return float64(d.MemMax) }),
+		medianOf(recent, func(d fingerprintDay) float64 { return float64(d.MemMax) }))
+
+	// Hashrate only where the same setting ran in both weeks
+	settings := map[string]bool{}
+	for _, day := range early {
+		for setting := range day.Hashrates {
+			settings[setting] = true
+		}
+	}
+	for setting := range settings {
+		average := func(d fingerprintDay) float64 {
+			if total := d.Hashrates[setting]; total != nil && total.Count > 0 {
+				return total.Sum / float64(total.Count)
+			}
+			return 0
+		}
+		check("hashrate", setting, medianOf(early, average), medianOf(recent, average))
+	}
+
+	flagged := map[string]bool{}
+	for _, flag := range flags {
+		flagged[flag.Metric+flag.Setting] = true
+	}
+	for key := range p.Flagged {
+		if !flagged[key] {
+			delete(p.Flagged, key)
+			fingerprintDirty = true
+		}
+	}
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Metric+flags[i].Setting < flags[j].Metric+flags[j].Setting })
+	return flags
+}
+
+// medianOf is the median of a value over the days that have it
+func medianOf(days []fingerprintDay, value func(fingerprintDay) float64) float64 {
+	var values []float64
+	for _, day := range days {
+		if v := value(day); v > 0 {
+			values = append(values, v)
+		}
+	}
+	if len(values) == 0 {
+		return 0
+	}
+	sort.Float64s(values)
+	if len(values)%2 == 1 {
+		return values[len(values)/2]
+	}
+	return (values[len(values)/2-1] + values[len(values)/2]) / 2
+}
+
+func roundClock(mhz int) int {
+	return (mhz + 12) / 25 * 25
+}
+
+// sendDeratingEvent reports a newly de-rated card
+func sendDeratingEvent(client *ws.Client, flag gpuDerating) {
+	what := map[string]string{"coreClock": "core clock ceiling", "memClock": "memory clock ceiling", "hashrate": "hashrate at " + flag.Setting}[flag.Metric]
+	message := fmt.Sprintf("GPU %d (%s) %s down %.1f%% over %d days (%.0f -> %.0f)",
+		flag.Index, flag.Name, what, flag.Drop, flag.Days, flag.Baseline, flag.Recent)
+	log.Println(message)
+	if !client.AnyConnected() {
+		return
+	}
+	event := &ws.Event{Type: "gpu_derating", Severity: "warning", Message: message, Data: flag}
+	go func() {
+		if err := client.SendEvent(event); err != nil {
+			log.Printf("Failed to send de-rating event: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bloxos/agent/internal/executor"
+	"github.com/bloxos/agent/internal/installer"
+	"github.com/bloxos/agent/internal/network"
+	"github.com/bloxos/agent/internal/plugins"
+	"github.com/bloxos/agent/internal/system"
+	"github.com/bloxos/agent/internal/ws"
+)
+
+// commandDoc documents a command for describe_commands. Payload is a zero
+// value of what the handler decodes, nil for commands without one; for
+// handlers decoding an anonymous struct it repeats that struct, so the two
+// must be changed together.
+type commandDoc struct {
+	Name        string
+	Description string
+	Payload     interface{}
+	Required    []string // Payload fields the handler rejects when missing
+}
+
+// commandDocs lists the built-in commands in the order handleCommand
+// dispatches them
+var commandDocs = []commandDoc{
+	{"start_miner", "Start a miner, replacing the running one", executor.MinerConfig{}, []string{"name", "algorithm", "wallet"}},
+	{"stop_miner", "Stop the miners", nil, nil},
+	{"validate_miner_config", "Check a miner config without starting it", executor.MinerConfig{}, nil},
+	{"restart_miner", "Restart the running miners", nil, nil},
+	{"pause_miner", "Stop mining for a while, resuming automatically", struct {
+		Minutes int    `json:"minutes"`
+		Reason  string `json:"reason"`
+	}{}, nil},
+	{"resume_miner", "End a pause early", nil, nil},
+	{"mine", "Mine a coin or algorithm with the best installed miner", struct {
+		Coin          string   `json:"coin"`
+		Algorithm     string   `json:"algorithm"`
+		Pool          string   `json:"pool"`
+		FailoverPools []string `json:"failoverPools"`
+		Preset        string   `json:"preset"`
+		PoolTLS       bool     `json:"poolTls"`
+		NiceHash      bool     `json:"nicehash"`
+		Wallet        string   `json:"wallet"`
+		Worker        string   `json:"worker"`
+		AutoInstall   *bool    `json:"autoInstall"`
+	}{}, []string{"wallet"}},
+	{"install_miner", "Download and install a miner", struct {
+		MinerName string `json:"minerName"`
+	}{}, []string{"minerName"}},
+	{"uninstall_miner", "Remove an installed miner", struct {
+		MinerName string `json:"minerName"`
+	}{}, []string{"minerName"}},
+	{"list_miners", "List installed and available miners", nil, nil},
+	{"apply_oc", "Apply GPU overclock settings", executor.OCConfig{}, nil},
+	{"sync_oc_presets", "Store OC presets from the server", struct {
+		Presets []executor.OCPreset `json:"presets"`
+		Replace bool                `json:"replace"`
+	}{}, []string{"presets"}},
+	{"sync_coin_presets", "Store coin and pool presets from the server", struct {
+		Presets []executor.CoinPreset `json:"presets"`
+		Replace bool                  `json:"replace"`
+	}{}, []string{"presets"}},
+	{"list_coin_presets", "List the coin presets", nil, nil},
+	{"apply_oc_profile", "Apply a stored OC preset by name", struct {
+		Name string `json:"name"`
+	}{}, []string{"name"}},
+	{"set_oc_schedule", "Set the time windows switching OC presets", executor.OCSchedule{}, nil},
+	{"import_hiveos", "Import a HiveOS flight sheet and OC export", struct {
+		executor.HiveOSExport
+		Worker string `json:"worker"`
+		Apply  bool   `json:"apply"`
+	}{}, nil},
+	{"reboot", "Reboot the rig", struct {
+		Method string `json:"method"`
+	}{}, nil},
+	{"apt_update", "List pending OS package updates", struct {
+		Refresh bool `json:"refresh"`
+	}{}, nil},
+	{"apply_os_updates", "Install OS package updates", struct {
+		Packages []string `json:"packages"`
+		All      bool     `json:"all"`
+		Reboot   string   `json:"reboot"`
+	}{}, nil},
+	{"install_driver", "Install a GPU driver version", struct {
+		installer.DriverInstallRequest
+		Reboot *bool `json:"reboot"`
+	}{}, nil},
+	{"set_update_channel", "Set the image update channel", struct {
+		Channel string `json:"channel"`
+	}{}, []string{"channel"}},
+	{"shutdown", "Power the rig off", nil, nil},
+	{"get_inventory", "Collect the hardware inventory", nil, nil},
+	{"speed_test", "Measure latency and bandwidth", network.SpeedTestConfig{}, nil},
+	{"set_hostname", "Set the system hostname", struct {
+		Hostname string `json:"hostname"`
+	}{}, []string{"hostname"}},
+	{"set_timezone", "Set the system timezone local schedules run in", struct {
+		Timezone string `json:"timezone"`
+	}{}, []string{"timezone"}},
+	{"set_locale", "Set the system locale", struct {
+		Locale string `json:"locale"`
+	}{}, []string{"locale"}},
+	{"rename_rig", "Rename the rig", struct {
+		Name string `json:"name"`
+	}{}, []string{"name"}},
+	{"configure_network", "Configure a wired interface", network.NetworkConfig{}, nil},
+	{"wifi_scan", "Scan for WiFi networks", struct {
+		Interface string `json:"interface"`
+	}{}, nil},
+	{"wifi_configure", "Join a WiFi network", network.WifiConfig{}, nil},
+	{"wifi_prioritize", "Set the priority of a saved WiFi network", struct {
+		Interface string `json:"interface"`
+		SSID      string `json:"ssid"`
+		Priority  int    `json:"priority"`
+	}{}, []string{"ssid"}},
+	{"sync_time", "Resync the system clock", nil, nil},
+	{"bmc_power", "Control power through the BMC", struct {
+		Action string `json:"action"`
+	}{}, nil},
+	{"nvidia_setup", "Set NVIDIA persistence and compute mode", struct {
+		Persistence *bool  `json:"persistence"`
+		ComputeMode string `json:"computeMode"`
+	}{}, nil},
+	{"set_leds", "Set the rig and GPU LEDs", executor.LEDRequest{}, nil},
+	{"set_fans", "Set GPU fan speeds", struct {
+		executor.FanSetting
+		GPUs []executor.FanSetting `json:"gpus"`
+	}{}, nil},
+	{"set_stats_filter", "Limit the stats sent to the server", StatsFilter{}, nil},
+	{"set_tags", "Set the rig's tags", struct {
+		Tags    map[string]string `json:"tags"`
+		Replace bool              `json:"replace"`
+	}{}, nil},
+	{"power_save", "Idle the GPUs, optionally suspending the rig", struct {
+		Enabled bool `json:"enabled"`
+		Suspend bool `json:"suspend"`
+	}{}, nil},
+	{"park_gpus", "Drop GPUs outside the miners' device lists to minimum power", struct {
+		BusIDs []string `json:"busIds"`
+	}{}, []string{"busIds"}},
+	{"unpark_gpus", "Restore parked GPUs, all of them without busIds", struct {
+		BusIDs []string `json:"busIds"`
+	}{}, nil},
+	{"disable_gpu", "Exclude GPUs from mining, OC and the GPU watchdogs until re-enabled, across reboots", struct {
+		BusIDs []string `json:"busIds"`
+		BusID  string   `json:"busId"`
+		Reason string   `json:"reason"`
+	}{}, nil},
+	{"enable_gpu", "Return disabled GPUs to mining, all of them without busIds", struct {
+		BusIDs []string `json:"busIds"`
+		BusID  string   `json:"busId"`
+	}{}, nil},
+	{"flash_vbios", "Flash a GPU VBIOS in two confirmed stages", executor.VBIOSFlashRequest{}, nil},
+	{"list_gpu_processes", "List the processes using the GPUs", nil, nil},
+	{"kill_process", "Kill a process", struct {
+		PID   int    `json:"pid"`
+		Name  string `json:"name"`
+		Force bool   `json:"force"`
+	}{}, []string{"pid", "name"}},
+	{"capture_screen", "Capture the local console", struct {
+		Source    string `json:"source"`
+		UploadURL string `json:"uploadUrl"`
+	}{}, nil},
+	{"set_reboot_policy", "Set when the agent may reboot the rig", system.RebootPolicy{}, nil},
+	{"set_thermal_target", "Set the GPU temperature target", executor.ThermalTarget{}, nil},
+	{"sync_benchmarks", "Store miner benchmarks from the server", struct {
+		Benchmarks []executor.Benchmark `json:"benchmarks"`
+		Replace    bool                 `json:"replace"`
+	}{}, nil},
+	{"project_hashrate", "Project the rig's hashrate per algorithm", struct {
+		Algorithms []string `json:"algorithms"`
+	}{}, nil},
+	{"open_tunnel", "Open a support tunnel through a bastion", struct {
+		Bastion     string `json:"bastion"`
+		User        string `json:"user"`
+		PrivateKey  string `json:"privateKey"`
+		HostKey     string `json:"hostKey"`
+		RemotePort  int    `json:"remotePort"`
+		Target      string `json:"target"`
+		Duration    int    `json:"duration"`
+		RequestedBy string `json:"requestedBy"`
+		Reason      string `json:"reason"`
+	}{}, []string{"requestedBy"}},
+	{"close_tunnel", "Close the support tunnel", nil, nil},
+	{"set_tariff", "Set the electricity tariff", executor.Tariff{}, nil},
+	{"sync_coin_prices", "Store coin prices for profit estimates", struct {
+		Prices  []executor.CoinPrice `json:"prices"`
+		Replace bool                 `json:"replace"`
+	}{}, nil},
+	{"set_playbooks", "Set the recovery playbooks", struct {
+		Playbooks []playbook `json:"playbooks"`
+	}{}, nil},
+	{"reset_recovery", "Leave safe mode and reset the playbooks", nil, nil},
+	{"describe_commands", "Describe the commands this agent accepts", nil, nil},
+}
+
+// describeCommands returns the schema of every command this agent accepts:
+// the built-in ones, then the installed command plugins, whose payloads
+// are their own
+func describeCommands() map[string]interface{} {
+	builtin := map[string]bool{}
+	commands := make([]map[string]interface{}, 0, len(commandDocs))
+	for _, doc := range commandDocs {
+		builtin[doc.Name] = true
+		command := map[string]interface{}{
+			"name":        doc.Name,
+			"description": doc.Description,
+			"scope":       commandScope(doc.Name),
+		}
+		if doc.Payload != nil {
+			payload := jsonSchema(reflect.TypeOf(doc.Payload), map[reflect.Type]bool{})
+			if len(doc.Required) > 0 {
+				payload["required"] = doc.Required
+			}
+			command["payload"] = payload
+		}
+		if feature, ok := commandFeatures[doc.Name]; ok {
+			command["feature"] = feature
+			command["enabled"] = featureEnabled(feature)
+		}
+		commands = append(commands, command)
+	}
+
+	var names []string
+	for name := range plugins.List(plugins.Dir("commands")) {
+		if !builtin[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		commands = append(commands, map[string]interface{}{
+			"name":   name,
+			"scope":  commandScope(name),
+			"plugin": true,
+		})
+	}
+
+	return map[string]interface{}{
+		"version":  version,
+		"commands": commands,
+		// Any object payload may also carry a selector for broadcasts
+		"selector": jsonSchema(reflect.TypeOf(commandSelector{}), map[reflect.Type]bool{}),
+	}
+}
+
+// commandScope is the token scope a command needs
+func commandScope(name string) string {
+	if scope, ok := commandScopes[name]; ok {
+		return scope
+	}
+	return ws.ScopeSystem
+}
+
+func handleDescribeCommands() (bool, interface{}, error) {
+	return true, describeCommands(), nil
+}
+
+// runDescribeCommands prints the command schema, for building tools
+// without a server
+func runDescribeCommands() {
+	data, err := json.MarshalIndent(describeCommands(), "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to describe commands: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(string(data))
+}
+
+var (
+	timeType        = reflect.TypeOf(time.Time{})
+	durationType    = reflect.TypeOf(time.Duration(0))
+	unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+// jsonSchema describes how encoding/json decodes into t as a JSON Schema.
+// Types decoding themselves accept whatever they like, so they are left
+// open; seen stops recursive types.
+func jsonSchema(t reflect.Type, seen map[reflect.Type]bool) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == durationType:
+		return map[string]interface{}{"type": "integer", "description": "nanoseconds"}
+	case reflect.PtrTo(t).Implements(unmarshalerType):
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]interface{}{"type": "array", "items": jsonSchema(t.Elem(), seen)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": jsonSchema(t.Elem(), seen)}
+	case reflect.Struct:
+		if seen[t] {
+			return map[string]interface{}{"type": "object"}
+		}
+		seen[t] = true
+		defer delete(seen, t)
+		properties := map[string]interface{}{}
+		structFields(t, properties, seen, false)
+		return map[string]interface{}{"type": "object", "properties": properties}
+	}
+	// interface{} and anything else json can't restrict
+	return map[string]interface{}{}
+}
+
+// structFields adds the JSON fields of t to properties, flattening
+// embedded structs the way encoding/json does: their fields never shadow
+// the outer struct's
+func structFields(t reflect.Type, properties map[string]interface{}, seen map[reflect.Type]bool, embedded bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			structFields(fieldType, properties, seen, true)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if _, ok := properties[name]; !ok || !embedded {
+			properties[name] = jsonSchema(field.Type, seen)
+		}
+	}
+}
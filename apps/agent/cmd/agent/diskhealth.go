@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bloxos/agent/internal/system"
+	"github.com/bloxos/agent/internal/ws"
+)
+
+// diskCheckInterval is how often the boot media is checked
+const diskCheckInterval = time.Minute
+
+// diskWriteCommands write a lot to the disk, so they are refused while it
+// is failing rather than finishing half-written
+var diskWriteCommands = map[string]bool{
+	"install_miner":      true,
+	"uninstall_miner":    true,
+	"install_driver":     true,
+	"apply_os_updates":   true,
+	"set_update_channel": true,
+	"flash_vbios":        true,
+}
+
+var (
+	diskHealthMu sync.Mutex
+	diskHealth   *system.DiskHealth // Last check, nil until the first
+)
+
+// stateDir is where the agent keeps its state
+func stateDir() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".bloxos")
+}
+
+// checkDiskWrite refuses write-heavy commands in degraded disk mode
+func checkDiskWrite(cmd string) error {
+	if !diskWriteCommands[cmd] || !system.DiskDegraded() {
+		return nil
+	}
+	return fmt.Errorf("%s refused: the boot disk is failing (%s); reflash or replace it first", cmd, describeDiskHealth(currentDiskHealth()))
+}
+
+// currentDiskHealth is the last check while the disk is degraded
+func currentDiskHealth() *system.DiskHealth {
+	diskHealthMu.Lock()
+	defer diskHealthMu.Unlock()
+	if diskHealth == nil || !diskHealth.Degraded() {
+		return nil
+	}
+	return diskHealth
+}
+
+// runDiskMonitor watches the boot media for a read-only remount or I/O
+// errors and switches the agent to degraded disk mode, in which it avoids
+// writing. Mounts already read-only at start while the state directory is
+// writable are read-only by design and not reported.
+func runDiskMonitor(client *ws.Client) {
+	dir := stateDir()
+	var designReadOnly []string
+	if first := system.CheckDiskHealth(dir); len(first.ReadOnlyMounts) > 0 && stateWritable(dir) {
+		designReadOnly = first.ReadOnlyMounts
+	}
+
+	degraded := false
+	for {
+		health := system.CheckDiskHealth(dir)
+		health.Ignore(designReadOnly)
+
+		diskHealthMu.Lock()
+		diskHealth = health
+		diskHealthMu.Unlock()
+
+		if health.Degraded() != degraded {
+			degraded = health.Degraded()
+			system.SetDiskDegraded(degraded)
+			reportDiskHealth(client, health)
+		}
+		time.Sleep(diskCheckInterval)
+	}
+}
+
+// stateWritable tries writing a file to the state directory
+func stateWritable(dir string) bool {
+	path := filepath.Join(dir, ".disk_check")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return false
+	}
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		return false
+	}
+	os.Remove(path)
+	return true
+}
+
+// reportDiskHealth raises an event when degraded disk mode starts or ends
+func reportDiskHealth(client *ws.Client, health *system.DiskHealth) {
+	event := &ws.Event{Type: "disk_recovered", Severity: "info", Message: "Boot disk is healthy again, leaving degraded disk mode", Data: health}
+	if health.Degraded() {
+		event = &ws.Event{
+			Type:     "disk_degraded",
+			Severity: "critical",
+			Message:  fmt.Sprintf("Boot disk is failing (%s); the agent avoids writing to it. Reflash or replace the boot media.", describeDiskHealth(health)),
+			Data:     health,
+		}
+	}
+	log.Println(event.Message)
+	if client.AnyConnected() {
+		if err := client.SendEvent(event); err != nil {
+			log.Printf("Failed to send disk event: %v", err)
+		}
+	}
+}
+
+// describeDiskHealth summarizes what is wrong with the disk
+func describeDiskHealth(health *system.DiskHealth) string {
+	if health == nil {
+		return "unknown"
+	}
+	var problems []string
+	if health.ReadOnly {
+		problems = append(problems, "remounted read-only: "+strings.Join(health.ReadOnlyMounts, ", "))
+	}
+	if health.IOErrors > 0 {
+		problems = append(problems, fmt.Sprintf("%d I/O errors on %s", health.IOErrors, health.Device))
+	}
+	if health.FSErrors > 0 {
+		problems = append(problems, fmt.Sprintf("%d filesystem errors", health.FSErrors))
+	}
+	return strings.Join(problems, "; ")
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/bloxos/agent/internal/installer"
+	"github.com/bloxos/agent/internal/ws"
+)
+
+// driverInstalling is set while install_driver runs
+var driverInstalling atomic.Bool
+
+// handleInstallDriver installs a GPU driver in the background, reporting
+// driver_install events. The rig reboots into the new driver unless
+// "reboot" is false; the driver is verified (or rolled back) at startup.
+func handleInstallDriver(payload interface{}) (bool, interface{}, error) {
+	if payload == nil {
+		return false, nil, fmt.Errorf("vendor and version required")
+	}
+	var req struct {
+		installer.DriverInstallRequest
+		Reboot *bool `json:"reboot"` // Default true
+	}
+	if err := decodePayload(payload, &req); err != nil {
+		return false, nil, err
+	}
+	reboot := req.Reboot == nil || *req.Reboot
+
+	if !driverInstalling.CompareAndSwap(false, true) {
+		return false, nil, fmt.Errorf("a driver install is already running")
+	}
+	if osUpdating.Load() {
+		driverInstalling.Store(false)
+		return false, nil, fmt.Errorf("an OS update is running")
+	}
+
+	go runDriverInstall(req.DriverInstallRequest, reboot)
+	return true, map[string]interface{}{
+		"vendor":  req.Vendor,
+		"version": req.Version,
+		"reboot":  reboot,
+	}, nil
+}
+
+// runDriverInstall stops the miner, installs the driver and reboots
+func runDriverInstall(req installer.DriverInstallRequest, reboot bool) {
+	defer driverInstalling.Store(false)
+
+	data := map[string]interface{}{"stage": "start", "vendor": req.Vendor, "version": req.Version}
+	sendDriverEvent("info", fmt.Sprintf("Installing %s driver %s", req.Vendor, req.Version), data)
+
+	// The installer can't replace modules the miner holds open
+	running, _ := exec.GetMinerStatus()["running"].(bool)
+	if running {
+		serialized(func() {
+			if err := exec.StopMiner(); err != nil {
+				log.Printf("Failed to stop miner: %v", err)
+			}
+		})
+	}
+
+	err := inst.InstallDriver(req, func(message string) {
+		data["stage"] = "progress"
+		sendDriverEvent("info", message, data)
+	})
+	if err != nil {
+		data["stage"] = "failed"
+		sendDriverEvent("warning", fmt.Sprintf("Driver install failed: %v", err), data)
+		if running {
+			restartStoppedMiner(true)
+		}
+		return
+	}
+
+	if !reboot {
+		data["stage"] = "installed"
+		sendDriverEvent("warning", fmt.Sprintf("%s driver %s installed, reboot to load and verify it", req.Vendor, req.Version), data)
+		return
+	}
+	data["stage"] = "rebooting"
+	sendDriverEvent("info", fmt.Sprintf("%s driver %s installed, rebooting", req.Vendor, req.Version), data)
+	rebootRig("soft")
+}
+
+// verifyDriverInstall checks a driver installed before the reboot, rebooting
+// again if it had to roll back to the previous one
+func verifyDriverInstall() {
+	state, err := inst.VerifyDriver()
+	if err != nil {
+		log.Printf("Driver verification: %v", err)
+		return
+	}
+	if state == nil {
+		return
+	}
+	if state.Status == installer.DriverVerified {
+		recordUpdate()
+	}
+
+	severity := "info"
+	var message string
+	switch state.Status {
+	case installer.DriverVerified:
+		message = fmt.Sprintf("%s driver %s verified", state.Request.Vendor, state.Request.Version)
+	case installer.DriverRolledBack:
+		severity = "warning"
+		message = fmt.Sprintf("Rolled back to %s driver %s", state.Request.Vendor, state.Request.Version)
+	case installer.DriverRollingBack:
+		severity = "warning"
+		message = fmt.Sprintf("%s driver %s failed (%s), rolling back", state.Request.Vendor, state.Request.Version, state.Message)
+	default:
+		severity = "critical"
+		message = fmt.Sprintf("%s driver install failed: %s", state.Request.Vendor, state.Message)
+	}
+
+	// Report once the connection is up, the rig just booted
+	for i := 0; i < 60 && !wsClient.AnyConnected(); i++ {
+		time.Sleep(time.Second)
+	}
+	sendDriverEvent(severity, message, state)
+
+	if state.Status == installer.DriverRollingBack {
+		rebootRig("soft")
+	}
+}
+
+// sendDriverEvent logs and reports a driver install step
+func sendDriverEvent(severity, message string, data interface{}) {
+	log.Println(message)
+	if !wsClient.AnyConnected() {
+		return
+	}
+	event := &ws.Event{
+		Type:     "driver_install",
+		Severity: severity,
+		Message:  message,
+		Data:     data,
+	}
+	if err := wsClient.SendEvent(event); err != nil {
+		log.Printf("Failed to send driver install event: %v", err)
+	}
+}
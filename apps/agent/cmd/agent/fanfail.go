@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/bloxos/agent/internal/collector"
+	"github.com/bloxos/agent/internal/config"
+	"github.com/bloxos/agent/internal/ws"
+)
+
+// handleFanFault reports a newly failed GPU fan as a critical event and
+// applies the configured response
+func handleFanFault(client *ws.Client, cfg *config.Config, fault collector.FanFault) {
+	message := fmt.Sprintf("GPU %s (%s) fan %s: %d RPM at %d%%", fault.BusID, fault.Name, fault.Reason, fault.RPM, fault.Commanded)
+	if fault.Expected > 0 {
+		message += fmt.Sprintf(", expected ~%d RPM", fault.Expected)
+	}
+
+	data := map[string]interface{}{"fault": fault, "action": cfg.FanFailAction}
+	switch cfg.FanFailAction {
+	case "powercap":
+		watts, err := exec.CapGPUPower(fault.Vendor, fault.BusID, cfg.FanFailPowerCap)
+		if err != nil {
+			message += fmt.Sprintf("; power cap failed: %v", err)
+			data["error"] = err.Error()
+		} else {
+			message += fmt.Sprintf("; power capped to %d W", watts)
+			data["powerLimit"] = watts
+		}
+	case "stop":
+		// Miners can't drop a single GPU yet, so the whole rig stops. This
+		// runs from the main loop, which mustn't wait behind a long command.
+		go func() {
+			var err error
+			serialized(func() { err = exec.StopMiner() })
+			if err != nil {
+				message += fmt.Sprintf("; stopping miner failed: %v", err)
+				data["error"] = err.Error()
+			} else {
+				message += "; miner stopped"
+			}
+			sendFanFailure(client, message, data)
+		}()
+		return
+	}
+	sendFanFailure(client, message, data)
+}
+
+// sendFanFailure logs a fan fault and sends it as a critical event
+func sendFanFailure(client *ws.Client, message string, data map[string]interface{}) {
+	log.Println(message)
+
+	event := &ws.Event{
+		Type:     "fan_failure",
+		Severity: "critical",
+		Message:  message,
+		Data:     data,
+	}
+	if err := client.SendEvent(event); err != nil {
+		log.Printf("Failed to send fan failure event: %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// featureDefaults are the features the server can switch per rig at
+// authentication, and whether each is on until it does. Servers that
+// don't send flags leave the defaults (or the last flags received).
+var featureDefaults = map[string]bool{
+	"os_updates":      true, // Package, driver and image channel updates
+	"vbios_flash":     true,
+	"process_control": true, // Killing processes on the rig
+	"screen_capture":  true,
+	"history_upload":  true, // Stats buffered during outages
+	"remote_tunnel":   true, // Support tunnels to the rig
+}
+
+// commandFeatures maps commands to the feature they need
+var commandFeatures = map[string]string{
+	"apply_os_updates":   "os_updates",
+	"install_driver":     "os_updates",
+	"set_update_channel": "os_updates",
+	"flash_vbios":        "vbios_flash",
+	"kill_process":       "process_control",
+	"capture_screen":     "screen_capture",
+	"open_tunnel":        "remote_tunnel",
+}
+
+var (
+	featuresMu sync.Mutex
+	features   map[string]bool // Last flags from the server
+)
+
+// featuresPath is where the server's flags are kept, so they are enforced
+// from startup rather than only once the agent has authenticated
+func featuresPath() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".bloxos", "features.json")
+}
+
+// loadFeatures restores the stored flags
+func loadFeatures() {
+	data, err := os.ReadFile(featuresPath())
+	if err != nil {
+		return
+	}
+	var stored map[string]bool
+	if err := json.Unmarshal(data, &stored); err != nil {
+		log.Printf("Ignoring invalid feature flags: %v", err)
+		return
+	}
+	featuresMu.Lock()
+	features = stored
+	featuresMu.Unlock()
+}
+
+// featureNames lists the switchable features, sent at auth
+func featureNames() string {
+	var names []string
+	for name := range featureDefaults {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// applyFeatureFlags stores the flags sent at authentication. Features
+// the server leaves out fall back to their defaults.
+func applyFeatureFlags(flags map[string]bool) {
+	if flags == nil {
+		return
+	}
+
+	known := map[string]bool{}
+	for name, enabled := range flags {
+		if _, ok := featureDefaults[name]; ok {
+			known[name] = enabled
+		}
+	}
+
+	featuresMu.Lock()
+	defer featuresMu.Unlock()
+	for name, enabled := range featureDefaults {
+		before, after := enabled, enabled
+		if v, ok := features[name]; ok {
+			before = v
+		}
+		if v, ok := known[name]; ok {
+			after = v
+		}
+		if before != after {
+			log.Printf("Feature %s %s by the server", name, map[bool]string{true: "enabled", false: "disabled"}[after])
+		}
+	}
+	features = known
+
+	if data, err := json.Marshal(known); err == nil {
+		os.MkdirAll(filepath.Dir(featuresPath()), 0755)
+		if err := os.WriteFile(featuresPath(), data, 0644); err != nil {
+			log.Printf("Failed to save feature flags: %v", err)
+		}
+	}
+}
+
+// featureEnabled reports whether a feature is on for this rig
+func featureEnabled(name string) bool {
+	featuresMu.Lock()
+	defer featuresMu.Unlock()
+	if enabled, ok := features[name]; ok {
+		return enabled
+	}
+	return featureDefaults[name]
+}
+
+// checkFeature rejects a command whose feature is disabled
+func checkFeature(command string) error {
+	name, ok := commandFeatures[command]
+	if !ok || featureEnabled(name) {
+		return nil
+	}
+	return fmt.Errorf("%s is disabled for this rig (feature %s)", command, name)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/bloxos/agent/internal/collector"
+)
+
+// healthDigest is a coarse view of the rig sent with every heartbeat, so
+// the server stays roughly current between stats messages or when one is
+// lost
+type healthDigest struct {
+	MinerRunning bool    `json:"minerRunning"`
+	Hashrate     float64 `json:"hashrate"` // H/s
+	MaxGPUTemp   *int    `json:"maxGpuTemp,omitempty"`
+	Alerts       int     `json:"alerts"` // Missing GPUs, failed fans and stalled shares
+}
+
+var (
+	healthMu    sync.Mutex
+	health      healthDigest
+	gpuAlerts   int
+	minerAlerts int
+)
+
+// recordGPUHealth updates the digest from a stats collection
+func recordGPUHealth(gpus []collector.GPUStats, alerts int) {
+	var maxTemp *int
+	for _, gpu := range gpus {
+		if gpu.Temperature != nil && (maxTemp == nil || *gpu.Temperature > *maxTemp) {
+			temp := *gpu.Temperature
+			maxTemp = &temp
+		}
+	}
+
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	health.MaxGPUTemp = maxTemp
+	gpuAlerts = alerts
+	health.Alerts = gpuAlerts + minerAlerts
+}
+
+// recordMinerHealth updates the digest from a miner poll
+func recordMinerHealth(stats *collector.MinerStats) {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	health.MinerRunning = stats != nil && stats.Running
+	health.Hashrate = 0
+	minerAlerts = 0
+	if health.MinerRunning {
+		health.Hashrate = stats.Hashrate
+		if stats.SharesStalled {
+			minerAlerts = 1
+		}
+	}
+	health.Alerts = gpuAlerts + minerAlerts
+}
+
+// heartbeatHealth returns the digest for the next heartbeat
+func heartbeatHealth() interface{} {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	digest := health
+	return &digest
+}
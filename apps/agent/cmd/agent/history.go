@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/bloxos/agent/internal/collector"
+	"github.com/bloxos/agent/internal/history"
+	"github.com/bloxos/agent/internal/ws"
+)
+
+// historyBatchSamples is the most samples per history message, 6 hours at
+// the default poll interval
+const historyBatchSamples = 720
+
+// offlineHistory holds the stats polls made while disconnected
+var offlineHistory history.Buffer
+
+// recordHistory buffers a stats poll the server didn't get, flattened to
+// the series graphs are drawn from
+func recordHistory(timestamp int64, gpus []collector.GPUStats, cpu *collector.CPUStats, miner *collector.MinerStats) {
+	if !featureEnabled("history_upload") {
+		return
+	}
+
+	values := map[string]float64{}
+	setInt := func(name string, v *int) {
+		if v != nil {
+			values[name] = float64(*v)
+		}
+	}
+
+	for _, gpu := range gpus {
+		prefix := fmt.Sprintf("gpu%d.", gpu.Index)
+		setInt(prefix+"temperature", gpu.Temperature)
+		setInt(prefix+"memTemp", gpu.MemTemp)
+		setInt(prefix+"fanSpeed", gpu.FanSpeed)
+		setInt(prefix+"powerDraw", gpu.PowerDraw)
+		setInt(prefix+"coreClock", gpu.CoreClock)
+		setInt(prefix+"memoryClock", gpu.MemoryClock)
+		setInt(prefix+"utilization", gpu.Utilization)
+	}
+	if cpu != nil {
+		setInt("cpu.temperature", cpu.Temperature)
+		if cpu.Usage != nil {
+			values["cpu.usage"] = *cpu.Usage
+		}
+	}
+	if miner != nil && miner.Running {
+		values["miner.hashrate"] = miner.Hashrate
+		values["miner.accepted"] = float64(miner.Shares.Accepted)
+		values["miner.rejected"] = float64(miner.Shares.Rejected)
+		for _, gpu := range miner.GPUStats {
+			values[fmt.Sprintf("gpu%d.hashrate", gpu.Index)] = gpu.Hashrate
+		}
+	}
+
+	offlineHistory.Add(history.Sample{Time: timestamp, Values: values})
+}
+
+// uploadHistory sends the polls buffered during an outage in compressed
+// batches. Servers that can't take them get only current stats.
+func uploadHistory(client *ws.Client) {
+	samples := offlineHistory.Drain()
+	if len(samples) == 0 || !featureEnabled("history_upload") {
+		return
+	}
+
+	for start := 0; start < len(samples); start += historyBatchSamples {
+		end := start + historyBatchSamples
+		if end > len(samples) {
+			end = len(samples)
+		}
+		batch, err := history.Encode(samples[start:end])
+		if err != nil {
+			log.Printf("Failed to encode stats history: %v", err)
+			return
+		}
+		if err := client.SendHistory(batch); errors.Is(err, ws.ErrHistoryUnsupported) {
+			log.Printf("Dropping %d buffered stats samples: %v", len(samples)-start, err)
+			return
+		} else if err != nil {
+			log.Printf("Keeping %d buffered stats samples for the next connection: %v", len(samples)-start, err)
+			offlineHistory.Requeue(samples[start:])
+			return
+		}
+	}
+	log.Printf("Uploaded %d stats samples buffered while offline", len(samples))
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/bloxos/agent/internal/system"
+)
+
+// buildChannel is the channel the agent binary was built for, set with
+// -ldflags "-X main.buildChannel=beta"
+var buildChannel = system.ChannelStable
+
+// imageAuthInfo returns the image and update channel info sent at auth
+func imageAuthInfo() string {
+	data, _ := json.Marshal(system.GetImageInfo(version, buildChannel))
+	return string(data)
+}
+
+// recordUpdate stamps an OS, driver or agent update and republishes the
+// image info
+func recordUpdate() {
+	if err := system.RecordUpdate(); err != nil {
+		log.Printf("Failed to record update time: %v", err)
+	}
+	setAuthInfo("image", imageAuthInfo())
+}
+
+// handleSetUpdateChannel switches the rig between the stable and beta
+// update channels
+func handleSetUpdateChannel(payload interface{}) (bool, interface{}, error) {
+	var req struct {
+		Channel string `json:"channel"`
+	}
+	if err := decodePayload(payload, &req); err != nil {
+		return false, nil, err
+	}
+	if err := system.SetUpdateChannel(req.Channel); err != nil {
+		return false, nil, fmt.Errorf("failed to set update channel: %w", err)
+	}
+	setAuthInfo("image", imageAuthInfo())
+
+	log.Printf("Update channel set to %s", req.Channel)
+	return true, system.GetImageInfo(version, buildChannel), nil
+}
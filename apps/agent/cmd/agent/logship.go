@@ -0,0 +1,76 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bloxos/agent/internal/config"
+	"github.com/bloxos/agent/internal/logship"
+)
+
+var logShipper *logship.Shipper
+
+// minerLogDir is where miners write their output while logs are shipped.
+// It's in the temp directory, usually RAM, to spare the rig's flash.
+func minerLogDir() string {
+	return filepath.Join(os.TempDir(), "bloxos", "miner-logs")
+}
+
+// startLogShipping sends the agent's log, its other output and the
+// miners' output to the farm's syslog server or Loki
+func startLogShipping(cfg *config.Config) error {
+	shipper, err := logship.New(cfg.LogShip, cfg.LogShipLabels)
+	if err != nil {
+		return err
+	}
+	if err := exec.SetMinerLogDir(minerLogDir()); err != nil {
+		return err
+	}
+	if err := teeStdout(shipper.Writer("agent", "")); err != nil {
+		return err
+	}
+	log.SetOutput(io.MultiWriter(shipper.Writer("agent", ""), log.Writer()))
+	go shipper.FollowDir(minerLogDir())
+
+	logShipper = shipper
+	endpoint, _ := url.Parse(strings.TrimSpace(cfg.LogShip))
+	log.Printf("Shipping logs to %s", endpoint.Redacted())
+	return nil
+}
+
+// stopLogShipping sends what is still queued
+func stopLogShipping() {
+	if logShipper != nil {
+		logShipper.Close()
+	}
+}
+
+// teeStdout copies what is printed to stdout, where the executor and
+// collector report, to w as well
+func teeStdout(w io.Writer) error {
+	r, pw, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	stdout := os.Stdout
+	os.Stdout = pw
+	go func() {
+		buf := make([]byte, 32<<10)
+		for {
+			n, err := r.Read(buf)
+			if n > 0 {
+				// A closed console mustn't block the agent's output
+				stdout.Write(buf[:n])
+				w.Write(buf[:n])
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return nil
+}
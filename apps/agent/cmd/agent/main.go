@@ -4,15 +4,34 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
+	"github.com/bloxos/agent/internal/asic"
 	"github.com/bloxos/agent/internal/collector"
 	"github.com/bloxos/agent/internal/config"
 	"github.com/bloxos/agent/internal/executor"
 	"github.com/bloxos/agent/internal/installer"
+	"github.com/bloxos/agent/internal/ipmi"
+	"github.com/bloxos/agent/internal/network"
+	"github.com/bloxos/agent/internal/plugins"
+	"github.com/bloxos/agent/internal/pool"
+	"github.com/bloxos/agent/internal/powermeter"
+	"github.com/bloxos/agent/internal/resolver"
+	"github.com/bloxos/agent/internal/rpc"
+	"github.com/bloxos/agent/internal/simulate"
+	"github.com/bloxos/agent/internal/stratum"
+	"github.com/bloxos/agent/internal/system"
+	"github.com/bloxos/agent/internal/usbwatchdog"
 	"github.com/bloxos/agent/internal/ws"
 )
 
@@ -20,25 +39,182 @@ const version = "0.3.0"
 
 var exec *executor.Executor
 var inst *installer.Installer
+var coll *collector.Collector
+var wsClient *ws.Client
+var bmc *ipmi.Client
+var powerMeters []powermeter.Meter
+var stratumProxy *stratum.Proxy
+var asicMonitor *asic.Monitor
+var dnsResolver *resolver.Resolver
+var shareAuditor = pool.NewAuditor()
+var instanceID string
+
+// ocScheduleChanged wakes the OC scheduler when a new schedule is stored
+var ocScheduleChanged = make(chan struct{}, 1)
 
 func main() {
+	// Under simulation this binary also plays nvidia-smi and the miners
+	simulate.Dispatch()
+
+	// Printed before the banner so the output is plain JSON
+	if len(os.Args) > 1 && os.Args[1] == "describe-commands" {
+		runDescribeCommands()
+		return
+	}
+
 	fmt.Printf("BloxOs Agent v%s\n", version)
 
+	if len(os.Args) > 1 && os.Args[1] == "simulate" {
+		runSimulate(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && (os.Args[1] == "install-service" || os.Args[1] == "uninstall-service") {
+		runServiceCommand(os.Args[1], os.Args[2:])
+		return
+	}
+
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
 		log.Fatalf("Config error: %v", err)
 	}
 
+	// Set up signal handling for graceful shutdown. Under the Windows
+	// service manager, stop requests arrive the same way.
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	startService(sigChan)
+
 	if cfg.Debug {
 		log.Printf("Config: server=%s, interval=%ds, gpu=%v, cpu=%v",
 			cfg.ServerURL, cfg.PollInterval, cfg.GPUEnabled, cfg.CPUEnabled)
 	}
 
+	if err := loadStatsFilter(cfg); err != nil {
+		log.Fatalf("Config error: %v", err)
+	}
+	loadFeatures()
+	loadPlaybooks()
+
 	// Create components
-	coll := collector.New()
+	coll = collector.New()
 	exec = executor.New(cfg.Debug)
 	inst = installer.New(cfg.Debug)
+	if cfg.StratumProxy != "" {
+		stratumProxy = stratum.New(cfg.StratumProxy, cfg.Debug)
+		exec.SetStratumProxy(stratumProxy)
+	}
+	exec.SetMinerEnv(cfg.MinerEnv, minerEnvAllow(cfg))
+	exec.SetMinerAPIAccess(cfg.MinerAPIAuth, cfg.MinerAPIBind)
+	exec.SetSafeMode(safeModeActive())
+
+	// Secrets older agents and the installer left in plaintext
+	if err := config.MigrateSecrets(cfg); err != nil {
+		log.Printf("Failed to move secrets to the encrypted store: %v", err)
+	}
+	if err := exec.EncryptConfigs(); err != nil {
+		log.Printf("Failed to encrypt miner configs: %v", err)
+	}
+	exec.SetStagger(executor.Stagger{
+		Miners: time.Duration(cfg.MinerStagger) * time.Second,
+		OC:     time.Duration(cfg.OCStagger) * time.Millisecond,
+	}, reportStageProgress)
+
+	// Ship agent and miner logs to the farm's own log stack
+	if cfg.LogShip != "" {
+		if err := startLogShipping(cfg); err != nil {
+			log.Fatalf("Log shipping config error: %v", err)
+		}
+	}
+	if cfg.IPMIEnabled {
+		bmc = ipmi.New(cfg.IPMIHost, cfg.IPMIUser, cfg.IPMIPassword, cfg.Debug)
+		if !bmc.Available() {
+			bmc = nil
+		}
+	}
+
+	powerMeters, err = powermeter.ParseList(cfg.PowerMeters)
+	if err != nil {
+		log.Fatalf("Power meter config error: %v", err)
+	}
+
+	if cfg.USBWatchdog != "" {
+		usbDongle, err = usbwatchdog.New(cfg.USBWatchdog)
+		if err != nil {
+			log.Fatalf("USB watchdog config error: %v", err)
+		}
+	}
+
+	if cfg.ASICs != "" {
+		asicMonitor, err = asic.NewMonitor(cfg.ASICs)
+		if err != nil {
+			log.Fatalf("ASIC config error: %v", err)
+		}
+		asicMonitor.Start(time.Duration(cfg.PollInterval) * time.Second)
+	}
+
+	// Survive ISP DNS outages: DoH fallback for the agent, pinned IPs for miners
+	if cfg.DNSFallback {
+		home, _ := os.UserHomeDir()
+		dnsResolver = resolver.New(filepath.Join(home, ".bloxos", "dns_cache.json"), cfg.Debug)
+		if transport, ok := http.DefaultTransport.(*http.Transport); ok {
+			transport.DialContext = dnsResolver.DialContext
+		}
+		if stratumProxy != nil {
+			stratumProxy.SetDialer(dnsResolver.DialContext)
+		}
+		dnsResolver.Watch(func() []string {
+			hosts := []string{resolver.HostOf(cfg.ServerURL)}
+			if configs, err := exec.GetConfigs(); err == nil {
+				for _, minerConfig := range configs {
+					for _, pool := range append([]string{minerConfig.Pool}, minerConfig.FailoverPools...) {
+						hosts = append(hosts, resolver.HostOf(pool))
+					}
+				}
+			}
+			return hosts
+		}, time.Minute)
+	}
+
+	// Sample GPU throttle reasons for the per-interval counters
+	if cfg.GPUEnabled {
+		coll.StartThrottleMonitor()
+	}
+
+	// Sample temps and power between polls, so short spikes show up
+	if cfg.GPUEnabled && cfg.GPUSampleInterval > 0 {
+		coll.StartGPUSampler(time.Duration(cfg.GPUSampleInterval) * time.Second)
+	}
+
+	// Poll miner APIs on the ports they were started with, and read the
+	// output of miners without one
+	coll.SetMinerAPIs(minerEndpoints)
+	coll.SetOutputMiners(outputMiners)
+
+	// Take over miners left running by the previous agent
+	if cfg.MinerOnExit == executor.MinerExitAdopt {
+		if adopted, err := exec.AdoptMiner(); err != nil {
+			log.Printf("Miner adoption failed: %v", err)
+		} else if adopted > 0 {
+			log.Printf("Adopted %d running miner process(es)", adopted)
+		}
+	}
+
+	// Keep NVIDIA OC settings from resetting when the miner exits
+	if cfg.GPUEnabled {
+		// A nil status means there are no NVIDIA GPUs to set up
+		if status, err := exec.SetupNvidia(cfg.NvidiaPersistence, cfg.NvidiaComputeMode); err != nil && status != nil {
+			log.Printf("NVIDIA setup: %v", err)
+		}
+
+		// Parked cards came back at full power with the driver
+		if parked := exec.RestoreParkedGPUs(); len(parked) > 0 {
+			log.Printf("Restored %d parked GPU(s)", len(parked))
+		}
+	}
+
+	// Timezone and locale from provisioning, before anything schedules
+	applyProvisionedLocale(cfg)
 
 	// Get initial system info
 	sysInfo, err := coll.GetSystemInfo()
@@ -47,23 +223,74 @@ func main() {
 	}
 	log.Printf("Hostname: %s, OS: %s %s", sysInfo.Hostname, sysInfo.OS, sysInfo.OSVersion)
 
+	// A new agent version counts as an update
+	if err := system.RecordAgentVersion(version); err != nil {
+		log.Printf("Failed to record agent version: %v", err)
+	}
+	sysInfo.Image = system.GetImageInfo(version, buildChannel)
+	if sysInfo.Image.Version != "" {
+		log.Printf("Image: %s (%s channel)", sysInfo.Image.Version, sysInfo.Image.Channel)
+	}
+
+	// Tells this rig apart from clones of its disk
+	instanceID = system.InstanceID()
+
+	// First boot without a token: wait to be claimed in the dashboard
+	if cfg.Token == "" {
+		cfg.Token = claimRig(cfg, sysInfo.Hostname, sigChan)
+	}
+
 	// Create WebSocket client
-	wsClient := ws.NewClient(cfg.ServerURL, cfg.Token, cfg.Debug)
+	wsClient = ws.NewClient(cfg.ServerURL, cfg.Token, cfg.Debug)
+	wsClient.SetAuthInfo("hostname", sysInfo.Hostname)
+	wsClient.SetAuthInfo("agentVersion", version)
+	wsClient.SetAuthInfo("image", imageAuthInfo())
+	wsClient.SetAuthInfo("features", featureNames())
+	wsClient.SetAuthInfo("selectors", selectorFields)
+	wsClient.SetAuthInfo("instanceId", instanceID)
+	wsClient.SetAuthInfo("timezone", sysInfo.Timezone)
+	wsClient.SetCommandScopes(commandScopes)
+	wsClient.SetOutboundLimits(cfg.MaxMessageRate, time.Duration(cfg.BatchWindow)*time.Millisecond)
+	wsClient.SetKeepalive(ws.Keepalive{Heartbeat: cfg.HeartbeatInterval, TCPKeepAlive: cfg.TCPKeepAlive, HandshakeTimeout: cfg.HandshakeTimeout})
+	wsClient.SetHeartbeatData(heartbeatHealth)
+	if err := loadTags(cfg); err != nil {
+		log.Fatalf("Failed to load tags: %v", err)
+	}
+	if dnsResolver != nil {
+		wsClient.SetDialer(dnsResolver.DialContext)
+	}
+	if cfg.Transport == "grpc" {
+		addr, useTLS, err := grpcAddr(cfg)
+		if err != nil {
+			log.Fatalf("Invalid gRPC address: %v", err)
+		}
+		log.Printf("Using gRPC transport to %s", addr)
+		wsClient.SetTransport(rpc.Transport(addr, useTLS))
+	}
 
 	// Set up command handler
-	wsClient.SetCommandHandler(func(cmd *ws.Command) (bool, error) {
+	wsClient.SetCommandHandler(func(cmd *ws.Command) (bool, interface{}, error) {
 		return handleCommand(cmd, cfg)
 	})
 
 	// Set up connect handler
 	wsClient.SetConnectHandler(func() {
 		log.Println("Connected to server")
+		applyFeatureFlags(wsClient.Features())
 		// Send initial stats immediately
 		sendStats(wsClient, coll, cfg)
 		// Send miner status
 		sendMinerStatus(wsClient, coll)
+		// Fill the graphs' gap from the outage
+		go uploadHistory(wsClient)
+		// Report a network change that dropped the connection
+		go flushNetworkEvent()
 	})
 
+	// Cloned disk images share a token; don't fight the other rig over it
+	handleTokenConflict(nil) // Left from the last run
+	wsClient.SetConflictHandler(handleTokenConflict)
+
 	// Set up disconnect handler
 	wsClient.SetDisconnectHandler(func() {
 		log.Println("Disconnected from server")
@@ -74,47 +301,165 @@ func main() {
 	if err := wsClient.Connect(); err != nil {
 		log.Fatalf("Failed to start WebSocket client: %v", err)
 	}
+	if err := connectExtraServers(cfg, coll, sysInfo.Hostname); err != nil {
+		log.Fatalf("Failed to connect extra servers: %v", err)
+	}
 
-	// Set up signal handling for graceful shutdown
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	// Report GPUs, fans, DNS, disk and clock so a degraded boot is flagged
+	go sendBootReport(cfg, coll)
+
+	// Check a GPU driver installed before the last reboot
+	go verifyDriverInstall()
+
+	// Stop writing to boot media that went read-only or reports errors
+	go runDiskMonitor(wsClient)
+
+	// Restart the agent or reboot when the server stays unreachable
+	if cfg.WatchdogOffline > 0 {
+		go runWatchdog(cfg)
+	}
+
+	// Keep the USB watchdog dongle from power-cycling a healthy rig
+	mainLoopBeat.Store(time.Now().Unix())
+	if usbDongle != nil {
+		go runUSBWatchdog(usbDongle)
+	}
 
-	// Start stats collection loop
-	ticker := time.NewTicker(time.Duration(cfg.PollInterval) * time.Second)
-	defer ticker.Stop()
+	// Reboot every few days per the maintenance policy, and check how the
+	// last scheduled reboot went
+	go runRebootPolicy()
+	go verifyScheduledReboot()
+
+	// Confirm a reboot the server asked for, or report that it failed
+	go reportReboot()
+
+	// Recover from crash loops and degraded mining per the server's playbooks
+	go runPlaybooks(wsClient)
+
+	// Resume paused mining when the pause runs out
+	go runPauseTimer(wsClient)
+
+	// Switch OC presets on the local schedule
+	if cfg.GPUEnabled {
+		go runOCSchedule(wsClient)
+	}
+
+	// Start stats collection loop, aligned to wall-clock boundaries so
+	// samples from all rigs line up
+	statsTick := alignedTicker(time.Duration(cfg.PollInterval) * time.Second)
 
 	// Miner status ticker (every 10 seconds)
-	minerTicker := time.NewTicker(10 * time.Second)
-	defer minerTicker.Stop()
+	minerTick := alignedTicker(10 * time.Second)
+
+	// Pool API ticker (disabled when interval is 0)
+	var poolTick <-chan time.Time
+	if cfg.PoolStatsInterval > 0 {
+		poolTick = alignedTicker(time.Duration(cfg.PoolStatsInterval) * time.Second)
+	}
 
 	log.Printf("Starting stats collection (every %ds)...", cfg.PollInterval)
 
 	// Main loop
 	for {
 		select {
-		case <-ticker.C:
-			if wsClient.IsConnected() {
-				sendStats(wsClient, coll, cfg)
-			}
-		case <-minerTicker.C:
-			if wsClient.IsConnected() {
+		case <-statsTick:
+			// Also while offline: fan and temperature protection keep
+			// running and the polls are kept for upload (see history.go)
+			sendStats(wsClient, coll, cfg)
+		case <-minerTick:
+			if wsClient.AnyConnected() {
 				sendMinerStatus(wsClient, coll)
 			}
+		case <-poolTick:
+			if wsClient.AnyConnected() {
+				// Pool APIs can be slow; don't hold up the main loop
+				go sendPoolStats(wsClient, cfg)
+			}
 		case sig := <-sigChan:
 			log.Printf("Received %v, shutting down...", sig)
+			if cfg.MinerOnExit == executor.MinerExitStop {
+				if err := exec.StopMiner(); err != nil {
+					log.Printf("Failed to stop miner: %v", err)
+				}
+			} else {
+				log.Printf("Leaving miner running (miner-on-exit=%s)", cfg.MinerOnExit)
+			}
+			exec.StopHeadlessX()
+			exec.FlushBenchmarks()
+			flushFingerprints()
+			closeTunnel()
 			wsClient.Close()
+			for _, client := range extraClients {
+				client.Close()
+			}
+			stopLogShipping()
+			stopService()
 			return
 		}
+		mainLoopBeat.Store(time.Now().Unix())
 	}
 }
 
+// alignedTicker ticks on wall-clock multiples of interval (:00 and :30 for
+// 30s). Each deadline is recomputed, so ticks don't drift with load.
+func alignedTicker(interval time.Duration) <-chan time.Time {
+	tick := make(chan time.Time, 1)
+	go func() {
+		for {
+			now := time.Now()
+			t := <-time.After(now.Truncate(interval).Add(interval).Sub(now))
+			select {
+			case tick <- t:
+			default: // Previous tick still pending; skip
+			}
+		}
+	}()
+	return tick
+}
+
+// minerEnvAllow splits -miner-env-allow into variable names
+func minerEnvAllow(cfg *config.Config) []string {
+	var names []string
+	for _, name := range strings.Split(cfg.MinerEnvAllow, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// grpcAddr returns the gRPC server address, defaulting to the server URL
+// host, and whether to use TLS (https server URLs)
+func grpcAddr(cfg *config.Config) (string, bool, error) {
+	u, err := url.Parse(cfg.ServerURL)
+	if err != nil {
+		return "", false, err
+	}
+	useTLS := u.Scheme == "https" || u.Scheme == "wss"
+
+	addr := cfg.GRPCAddr
+	if addr == "" {
+		addr = u.Hostname()
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, rpc.DefaultPort)
+	}
+	return addr, useTLS, nil
+}
+
 // sendStats collects and sends stats to the server
 func sendStats(client *ws.Client, coll *collector.Collector, cfg *config.Config) {
 	stats := make(map[string]interface{})
 
+	// Collection time, so graphs and backfilled samples sort correctly
+	timestamp := time.Now().UnixMilli()
+	stats["timestamp"] = timestamp
+
 	// Collect GPU stats
+	var gpus []collector.GPUStats
 	if cfg.GPUEnabled {
-		gpus, err := coll.GetGPUStats()
+		var err error
+		gpus, err = coll.GetGPUStats()
 		if err != nil {
 			if cfg.Debug {
 				log.Printf("GPU stats error: %v", err)
@@ -127,9 +472,82 @@ func sendStats(client *ws.Client, coll *collector.Collector, cfg *config.Config)
 		}
 	}
 
+	// Cross-check PCI, driver and miner GPU lists for cards that dropped out
+	alerts := 0
+	if cfg.GPUEnabled {
+		presence := coll.CheckGPUPresence(gpus, coll.LastMinerStats())
+		presence.Missing = withoutExcludedGPUs(presence.Missing)
+		stats["gpuPresence"] = presence
+		alerts += len(presence.Missing)
+		for _, gpu := range presence.Missing {
+			if gpu.New {
+				sendGPUMissing(client, gpu)
+			}
+		}
+	}
+
+	// Catch dead fans before the memory cooks
+	if cfg.GPUEnabled {
+		faults := coll.CheckFans(gpus)
+		if len(faults) > 0 {
+			stats["fanFaults"] = faults
+		}
+		for _, fault := range faults {
+			if fault.New {
+				handleFanFault(client, cfg, fault)
+			}
+		}
+		alerts += len(faults)
+	}
+	recordGPUHealth(gpus, alerts)
+
+	// Hold memory temperatures with the power limit instead of stopping
+	if cfg.GPUEnabled && client == wsClient {
+		rememberGPUs(gpus)
+		if derated := recordFingerprints(client, gpus, coll.LastMinerStats()); len(derated) > 0 {
+			stats["derating"] = derated
+		}
+		if throttled := controlMemTemp(client, gpus); len(throttled) > 0 {
+			stats["thermal"] = throttled
+		}
+	}
+
+	// Playbooks part way through a recovery, and safe mode
+	if recovering := recoveryStatus(); recovering != nil {
+		stats["recovery"] = recovering
+	}
+
+	// An open support tunnel is shown for as long as it is open
+	if open := tunnelStatus(); open != nil {
+		stats["tunnel"] = open
+	}
+
+	// Report NVIDIA persistence/compute mode setup result
+	if nvidiaStatus := exec.NvidiaSetupStatus(); nvidiaStatus != nil {
+		stats["nvidiaSetup"] = nvidiaStatus
+	}
+
+	if powerSave := exec.PowerSaveStatus(); powerSave != nil {
+		stats["powerSave"] = powerSave
+	}
+	if parked := exec.ParkedGPUs(); len(parked) > 0 {
+		stats["parkedGpus"] = parked
+	}
+	if disabled := exec.DisabledGPUs(); len(disabled) > 0 {
+		stats["disabledGpus"] = disabled
+	}
+	if conflict := wsClient.TokenConflict(); conflict != nil {
+		stats["tokenConflict"] = conflict
+	}
+	if disk := currentDiskHealth(); disk != nil {
+		stats["disk"] = disk
+	}
+
 	// Collect CPU stats
+	var cpu *collector.CPUStats
 	if cfg.CPUEnabled {
-		cpu, err := coll.GetCPUStats()
+		var err error
+		cpu, err = coll.GetCPUStats()
 		if err != nil {
 			if cfg.Debug {
 				log.Printf("CPU stats error: %v", err)
@@ -142,20 +560,188 @@ func sendStats(client *ws.Client, coll *collector.Collector, cfg *config.Config)
 		}
 	}
 
-	// Send stats via WebSocket
-	if err := client.SendStats(stats); err != nil {
+	// Collect network stats (Wi-Fi link state)
+	if netStats := network.GetStats(); netStats != nil {
+		stats["network"] = netStats
+	}
+
+	// Collect wall power from external meters
+	var wall *powermeter.Stats
+	if len(powerMeters) > 0 {
+		wall = powermeter.ReadAll(powerMeters)
+		gpuWatts := 0
+		for _, gpu := range gpus {
+			if gpu.PowerDraw != nil {
+				gpuWatts += *gpu.PowerDraw
+			}
+		}
+		if len(gpus) > 0 {
+			wall.GPUWatts = &gpuWatts
+		}
+		stats["wallPower"] = wall
+	}
+
+	// Earnings and power cost per day
+	if profit := profitability(cfg, gpus, cpu, wall); profit != nil {
+		stats["profitability"] = profit
+	}
+
+	// Collect BMC sensors (server-grade boards)
+	if bmc != nil {
+		bmcStats, err := bmc.GetStats()
+		if err != nil {
+			if cfg.Debug {
+				log.Printf("BMC stats error: %v", err)
+			}
+		} else {
+			stats["bmc"] = bmcStats
+		}
+	}
+
+	// Report LAN ASICs as sub-devices (polled in the background)
+	if asicMonitor != nil {
+		stats["asics"] = asicMonitor.Devices()
+	}
+
+	// Report DNS outages and the hosts running on pinned IPs
+	if dnsResolver != nil {
+		if status := dnsResolver.Status(); status.Degraded {
+			stats["dns"] = status
+		}
+	}
+
+	// Collect stratum proxy failover and share counters
+	if stratumProxy != nil {
+		if proxyStats := stratumProxy.Stats(); proxyStats != nil {
+			stats["stratumProxy"] = proxyStats
+		}
+	}
+
+	// USB watchdog dongle heartbeat
+	if dongle := usbWatchdogStats(); dongle != nil {
+		stats["usbWatchdog"] = dongle
+	}
+
+	// Sensors reported by the user's collector plugins
+	collectCustom(stats)
+
+	// Collect clock sync status
+	timeStatus := system.GetTimeSyncStatus()
+	if offset, ok := client.ServerClockOffset(); ok {
+		ms := float64(offset.Microseconds()) / 1000
+		timeStatus.ServerOffsetMs = &ms
+	}
+	stats["time"] = timeStatus
+
+	// Keep what the server misses for upload once it's back
+	if client == wsClient && !client.IsConnected() {
+		recordHistory(timestamp, gpus, cpu, coll.DetectRunningMiner())
+		if !client.AnyConnected() {
+			return
+		}
+	}
+
+	// Drop groups and fields the server doesn't want this time
+	statsFilter.apply(stats)
+	if client == wsClient {
+		rememberPayload(ws.TypeStats, stats)
+	}
+
+	// Send stats via WebSocket (only to mirrors when offline)
+	if err := client.SendStats(stats); err != nil && client.IsConnected() {
 		log.Printf("Failed to send stats: %v", err)
 	} else if cfg.Debug {
 		log.Printf("Stats sent successfully")
 	}
 }
 
+// sendGPUMissing reports a GPU that dropped out of the PCI bus, the
+// driver or the miner
+func sendGPUMissing(client *ws.Client, gpu collector.MissingGPU) {
+	severity := "critical"
+	var message string
+	switch gpu.Source {
+	case "pci":
+		message = fmt.Sprintf("GPU %s (%s) fell off the PCI bus", gpu.BusID, gpu.Name)
+	case "driver":
+		message = fmt.Sprintf("GPU %s (%s) is on the PCI bus but not reported by the driver", gpu.BusID, gpu.Name)
+	default:
+		severity = "warning"
+		message = fmt.Sprintf("GPU %s (%s) is not used by the miner", gpu.BusID, gpu.Name)
+	}
+	log.Println(message)
+
+	event := &ws.Event{
+		Type:     "gpu_missing",
+		Severity: severity,
+		Message:  message,
+		Data:     gpu,
+	}
+	if err := client.SendEvent(event); err != nil {
+		log.Printf("Failed to send GPU missing event: %v", err)
+	}
+}
+
+// minerEndpoints maps the executor's miner APIs to the collector's, by
+// canonical miner name
+func minerEndpoints() map[string][]collector.MinerEndpoint {
+	endpoints := map[string][]collector.MinerEndpoint{}
+	for _, api := range exec.MinerAPIs() {
+		endpoints[api.Name] = append(endpoints[api.Name], collector.MinerEndpoint{Port: api.Port, Host: api.Host, Key: api.Key})
+	}
+	return endpoints
+}
+
+// outputMiners lists the running miners whose stats the collector parses
+// from their output
+func outputMiners() []collector.OutputMiner {
+	var miners []collector.OutputMiner
+	for _, miner := range exec.OutputMiners() {
+		miners = append(miners, collector.OutputMiner{
+			Name:      miner.Name,
+			Algorithm: miner.Algorithm,
+			Pool:      miner.Pool,
+			PID:       miner.PID,
+			Log:       miner.Log,
+			Offset:    miner.Offset,
+			Started:   miner.Started,
+			Hashrate:  miner.Patterns.Hashrate,
+			Accepted:  miner.Patterns.Accepted,
+			Rejected:  miner.Patterns.Rejected,
+			Unit:      miner.Patterns.Unit,
+		})
+	}
+	return miners
+}
+
+// withoutExcludedGPUs drops the GPUs taken out of mining on purpose from
+// the missing ones: disabled cards entirely, as a dying card may be off the
+// bus, and parked cards where the miner doesn't use them
+func withoutExcludedGPUs(missing []collector.MissingGPU) []collector.MissingGPU {
+	parked := map[string]bool{}
+	for _, card := range exec.ParkedGPUs() {
+		parked[card.BusID] = true
+	}
+	var kept []collector.MissingGPU
+	for _, gpu := range missing {
+		if exec.GPUDisabled(gpu.BusID) || (gpu.Source == "miner" && parked[gpu.BusID]) {
+			continue
+		}
+		kept = append(kept, gpu)
+	}
+	return kept
+}
+
 // sendMinerStatus sends current miner status to the server
 func sendMinerStatus(client *ws.Client, coll *collector.Collector) {
 	// First try to get detailed stats from miner API
+	collectedAt := time.Now().UnixMilli()
 	minerStats := coll.DetectRunningMiner()
+	recordMinerHealth(minerStats)
 	
 	if minerStats != nil && minerStats.Running {
+		shareAuditor.Record(minerStats.Shares.Accepted)
+
 		status := map[string]interface{}{
 			"name":      minerStats.Name,
 			"version":   minerStats.Version,
@@ -168,36 +754,278 @@ func sendMinerStatus(client *ws.Client, coll *collector.Collector) {
 				"accepted": minerStats.Shares.Accepted,
 				"rejected": minerStats.Shares.Rejected,
 			},
+			"timestamp": collectedAt,
 		}
 		
 		if len(minerStats.GPUStats) > 0 {
 			status["gpuStats"] = minerStats.GPUStats
 		}
+
+		if minerStats.Secondary != nil {
+			status["primary"] = minerStats.Primary
+			status["secondary"] = minerStats.Secondary
+		}
+
+		// Ethash-family DAG epoch, seen in the jobs passing the proxy
+		if stratumProxy != nil {
+			if epoch := stratumProxy.Epoch(minerStats.Algorithm); epoch != nil {
+				status["dag"] = epoch
+			}
+		}
+
+		if minerStats.SharesPerMinute != nil {
+			status["sharesPerMinute"] = *minerStats.SharesPerMinute
+		}
+		if minerStats.LastShareAgo != nil {
+			status["lastShareAgo"] = *minerStats.LastShareAgo
+		}
+		if minerStats.SharesStalled {
+			status["sharesStalled"] = true
+		}
+
+		// What the pool sees, for "pool shows less than the rig"
+		if minerStats.Difficulty > 0 {
+			status["difficulty"] = minerStats.Difficulty
+		}
+		if minerStats.EffectiveHashrate != nil {
+			status["effectiveHashrate"] = *minerStats.EffectiveHashrate
+			if minerStats.Hashrate > 0 {
+				status["effectiveShare"] = math.Round(*minerStats.EffectiveHashrate / minerStats.Hashrate * 100)
+			}
+		}
+		if minerStats.StallNew {
+			sendShareStallEvent(client, minerStats)
+		}
+		if pause := exec.PauseStatus(); pause != nil {
+			status["paused"] = pause
+		}
+
+		// Learn this rig's hashrates, and hold the miner to them
+		if client == wsClient {
+			recordBenchmarks(minerStats)
+			if expected, ok := expectedHashrate(minerStats); ok {
+				status["expectedHashrate"] = expected
+				checkHashrate(client, minerStats, expected)
+			}
+		}
 		
+		rememberPayload(ws.TypeMinerStatus, status)
 		if err := client.SendMinerStatus(status); err != nil {
 			log.Printf("Failed to send miner status: %v", err)
 		}
 		return
 	}
+	if client == wsClient {
+		resetHashrateWatch()
+	}
 	
 	// Fallback to basic executor status
 	status := exec.GetMinerStatus()
+	status["timestamp"] = collectedAt
+	if pause := exec.PauseStatus(); pause != nil {
+		status["paused"] = pause
+	}
+	rememberPayload(ws.TypeMinerStatus, status)
 	if err := client.SendMinerStatus(status); err != nil {
 		log.Printf("Failed to send miner status: %v", err)
 	}
 }
 
+// maxEpochWait caps how long an automatic miner restart waits out a DAG
+// epoch change
+const maxEpochWait = 20 * time.Minute
+
+// waitForDAGEpoch holds back an automatic miner restart or stop that would
+// land next to a DAG epoch change and cost an extra DAG rebuild
+func waitForDAGEpoch(reason string) {
+	if stratumProxy == nil {
+		return
+	}
+	minerConfig, err := exec.GetConfig()
+	if err != nil {
+		return
+	}
+	delay := stratumProxy.RestartDelay(minerConfig.Algorithm)
+	if delay <= 0 {
+		return
+	}
+	if delay > maxEpochWait {
+		delay = maxEpochWait
+	}
+	log.Printf("Delaying %s by %s around a DAG epoch change", reason, delay.Round(time.Second))
+	time.Sleep(delay)
+}
+
+// sendShareStallEvent reports a miner that hashes without getting shares
+// accepted, usually a wrong wallet, worker or pool
+func sendShareStallEvent(client *ws.Client, minerStats *collector.MinerStats) {
+	message := fmt.Sprintf("%s is hashing but no share was accepted for %d minutes",
+		minerStats.Name, *minerStats.LastShareAgo/60)
+	log.Println(message)
+
+	event := &ws.Event{
+		Type:     "no_shares",
+		Severity: "warning",
+		Message:  message,
+		Data: map[string]interface{}{
+			"miner":        minerStats.Name,
+			"pool":         minerStats.Pool,
+			"hashrate":     minerStats.Hashrate,
+			"accepted":     minerStats.Shares.Accepted,
+			"lastShareAgo": *minerStats.LastShareAgo,
+		},
+	}
+	if err := client.SendEvent(event); err != nil {
+		log.Printf("Failed to send share stall event: %v", err)
+	}
+}
+
+// sendPoolStats fetches account stats from the configured pool's API
+func sendPoolStats(client *ws.Client, cfg *config.Config) {
+	minerConfig, err := exec.GetConfig()
+	if err != nil || minerConfig.Pool == "" || minerConfig.Wallet == "" {
+		return
+	}
+
+	adapter, ok := pool.ForPool(minerConfig.Pool)
+	if !ok {
+		if cfg.Debug {
+			log.Printf("No pool API adapter for %s", minerConfig.Pool)
+		}
+		return
+	}
+
+	stats, err := adapter.Fetch(minerConfig.Wallet, minerConfig.Worker)
+	if err != nil {
+		log.Printf("Pool stats error (%s): %v", adapter.Name(), err)
+		return
+	}
+
+	// Reconcile with the miner's own share counts
+	stats.Audit = shareAuditor.Audit(stats)
+	if shareAuditor.ShouldAlert(stats.Audit) {
+		log.Printf("Share audit: %s", stats.Audit.Message)
+		event := &ws.Event{
+			Type:     "share_audit",
+			Severity: "warning",
+			Message:  stats.Audit.Message,
+			Data:     stats.Audit,
+		}
+		if err := client.SendEvent(event); err != nil {
+			log.Printf("Failed to send share audit event: %v", err)
+		}
+	}
+
+	if err := client.SendPoolStats(stats); err != nil {
+		log.Printf("Failed to send pool stats: %v", err)
+	}
+}
+
+// runOCSchedule applies the scheduled OC preset whenever the active
+// window changes, reporting each switch as an event
+func runOCSchedule(client *ws.Client) {
+	applied := ""
+	for {
+		schedule, err := exec.OCSchedule()
+		if err != nil {
+			log.Printf("OC schedule: %v", err)
+		}
+
+		preset := ""
+		var window *executor.OCScheduleWindow
+		if schedule != nil {
+			preset, window, err = schedule.PresetAt(time.Now())
+			if err != nil {
+				log.Printf("OC schedule: %v", err)
+			}
+		}
+
+		if preset == "" {
+			applied = "" // Reapply when the next window opens
+		}
+
+		// Power saving owns the GPUs until mining resumes
+		if preset != "" && preset != applied && exec.PowerSaveStatus() == nil {
+			event := &ws.Event{Type: "oc_schedule", Severity: "info"}
+			if window != nil {
+				event.Message = fmt.Sprintf("Switched to OC profile %q (%s-%s)", preset, window.Start, window.End)
+			} else {
+				event.Message = fmt.Sprintf("Switched to default OC profile %q", preset)
+			}
+
+			var results []executor.OCPresetResult
+			serialized(func() { results, err = exec.ApplyOCPreset(preset) })
+			if err != nil {
+				event.Severity = "warning"
+				event.Message = fmt.Sprintf("Scheduled OC profile %q failed: %v", preset, err)
+			}
+			event.Data = results
+			log.Println(event.Message)
+
+			// Don't retry a failing preset every minute; the next window change will
+			applied = preset
+			if client.AnyConnected() {
+				if err := client.SendEvent(event); err != nil {
+					log.Printf("Failed to send OC schedule event: %v", err)
+				}
+			}
+		}
+
+		select {
+		case <-time.After(time.Minute):
+		case <-ocScheduleChanged:
+			applied = ""
+		}
+	}
+}
+
+// commandMu serializes commands, from every server connection, and the
+// background actions that start, stop or tune the miner, e.g. a pause
+// running out
+var commandMu sync.Mutex
+
+// serialized runs a background miner action between commands. Only call
+// it from goroutines, never from a command handler.
+func serialized(action func()) {
+	commandMu.Lock()
+	defer commandMu.Unlock()
+	action()
+}
+
 // handleCommand handles commands from the server
-func handleCommand(cmd *ws.Command, cfg *config.Config) (bool, error) {
+func handleCommand(cmd *ws.Command, cfg *config.Config) (bool, interface{}, error) {
+	commandMu.Lock()
+	defer commandMu.Unlock()
 	log.Printf("Executing command: %s", cmd.Type)
 
+	if err := checkFeature(cmd.Type); err != nil {
+		return false, nil, err
+	}
+
+	// Broadcasts to a group of rigs are acknowledged, not run, elsewhere
+	if matched, skipped, err := checkSelector(cmd.Type, cmd.Payload); !matched {
+		return err == nil, skipped, err
+	}
+
+	if err := checkDiskWrite(cmd.Type); err != nil {
+		return false, nil, err
+	}
+
 	switch cmd.Type {
 	case "start_miner":
 		return handleStartMiner(cmd.Payload, cfg)
 	case "stop_miner":
 		return handleStopMiner(cmd.Payload, cfg)
+	case "validate_miner_config":
+		return handleValidateMinerConfig(cmd.Payload)
 	case "restart_miner":
 		return handleRestartMiner(cmd.Payload, cfg)
+	case "pause_miner":
+		return handlePauseMiner(cmd.Payload, cfg)
+	case "resume_miner":
+		return handleResumeMiner()
+	case "mine":
+		return handleMine(cmd.Payload, cfg)
 	case "install_miner":
 		return handleInstallMiner(cmd.Payload, cfg)
 	case "uninstall_miner":
@@ -206,168 +1034,612 @@ func handleCommand(cmd *ws.Command, cfg *config.Config) (bool, error) {
 		return handleListMiners(cfg)
 	case "apply_oc":
 		return handleApplyOC(cmd.Payload, cfg)
+	case "sync_oc_presets":
+		return handleSyncOCPresets(cmd.Payload)
+	case "sync_coin_presets":
+		return handleSyncCoinPresets(cmd.Payload)
+	case "list_coin_presets":
+		return handleListCoinPresets()
+	case "apply_oc_profile":
+		return handleApplyOCProfile(cmd.Payload)
+	case "set_oc_schedule":
+		return handleSetOCSchedule(cmd.Payload)
+	case "import_hiveos":
+		return handleImportHiveOS(cmd.Payload)
 	case "reboot":
-		return handleReboot(cfg)
+		return handleReboot(cmd.ID, cmd.Payload, cfg)
+	case "apt_update":
+		return handleAptUpdate(cmd.Payload)
+	case "apply_os_updates":
+		return handleApplyOSUpdates(cmd.Payload)
+	case "install_driver":
+		return handleInstallDriver(cmd.Payload)
+	case "set_update_channel":
+		return handleSetUpdateChannel(cmd.Payload)
 	case "shutdown":
 		return handleShutdown(cfg)
+	case "get_inventory":
+		return handleGetInventory()
+	case "speed_test":
+		return handleSpeedTest(cmd.Payload, cfg)
+	case "set_hostname":
+		return handleSetHostname(cmd.Payload)
+	case "set_timezone":
+		return handleSetTimezone(cmd.Payload)
+	case "set_locale":
+		return handleSetLocale(cmd.Payload)
+	case "rename_rig":
+		return handleRenameRig(cmd.Payload)
+	case "configure_network":
+		return handleConfigureNetwork(cmd.Payload, cfg)
+	case "wifi_scan":
+		return handleWifiScan(cmd.Payload)
+	case "wifi_configure":
+		return handleWifiConfigure(cmd.Payload)
+	case "wifi_prioritize":
+		return handleWifiPrioritize(cmd.Payload)
+	case "sync_time":
+		return handleSyncTime()
+	case "bmc_power":
+		return handleBMCPower(cmd.Payload)
+	case "nvidia_setup":
+		return handleNvidiaSetup(cmd.Payload, cfg)
+	case "set_leds":
+		return handleSetLEDs(cmd.Payload)
+	case "set_fans":
+		return handleSetFans(cmd.Payload)
+	case "set_stats_filter":
+		return handleSetStatsFilter(cmd.Payload, cfg)
+	case "set_tags":
+		return handleSetTags(cmd.Payload)
+	case "power_save":
+		return handlePowerSave(cmd.Payload)
+	case "park_gpus":
+		return handleParkGPUs(cmd.Payload)
+	case "disable_gpu":
+		return handleDisableGPU(cmd.Payload)
+	case "enable_gpu":
+		return handleEnableGPU(cmd.Payload)
+	case "unpark_gpus":
+		return handleUnparkGPUs(cmd.Payload)
+	case "flash_vbios":
+		return handleFlashVBIOS(cmd.Payload, cfg)
+	case "list_gpu_processes":
+		return handleListGPUProcesses()
+	case "kill_process":
+		return handleKillProcess(cmd.Payload)
+	case "capture_screen":
+		return handleCaptureScreen(cmd.Payload)
+	case "set_reboot_policy":
+		return handleSetRebootPolicy(cmd.Payload)
+	case "set_thermal_target":
+		return handleSetThermalTarget(cmd.Payload)
+	case "sync_benchmarks":
+		return handleSyncBenchmarks(cmd.Payload)
+	case "project_hashrate":
+		return handleProjectHashrate(cmd.Payload)
+	case "open_tunnel":
+		return handleOpenTunnel(cmd.Payload)
+	case "close_tunnel":
+		return handleCloseTunnel()
+	case "set_tariff":
+		return handleSetTariff(cmd.Payload)
+	case "sync_coin_prices":
+		return handleSyncCoinPrices(cmd.Payload)
+	case "set_playbooks":
+		return handleSetPlaybooks(cmd.Payload)
+	case "reset_recovery":
+		return handleResetRecovery()
+	case "describe_commands":
+		return handleDescribeCommands()
 	default:
-		return false, fmt.Errorf("unknown command type: %s", cmd.Type)
+		// Farms extend the agent with executables named after the command
+		if path := plugins.Find(plugins.Dir("commands"), cmd.Type); path != "" {
+			return handlePluginCommand(path, cmd)
+		}
+		return false, nil, fmt.Errorf("unknown command type: %s", cmd.Type)
 	}
 }
 
-func handleStartMiner(payload interface{}, cfg *config.Config) (bool, error) {
+func handleStartMiner(payload interface{}, cfg *config.Config) (bool, interface{}, error) {
 	if payload == nil {
-		return false, fmt.Errorf("miner config required")
+		return false, nil, fmt.Errorf("miner config required")
 	}
 
 	// Convert payload to MinerConfig
 	data, err := json.Marshal(payload)
 	if err != nil {
-		return false, fmt.Errorf("invalid payload: %w", err)
+		return false, nil, fmt.Errorf("invalid payload: %w", err)
 	}
 
 	var config executor.MinerConfig
 	if err := json.Unmarshal(data, &config); err != nil {
-		return false, fmt.Errorf("invalid miner config: %w", err)
+		return false, nil, fmt.Errorf("invalid miner config: %w", err)
 	}
 
 	if err := exec.StartMiner(&config); err != nil {
-		return false, err
+		return false, nil, err
 	}
 
-	return true, nil
+	return true, nil, nil
 }
 
-func handleStopMiner(payload interface{}, cfg *config.Config) (bool, error) {
+// handleValidateMinerConfig checks a start_miner config and returns the
+// command line it would run, without starting the miner
+func handleValidateMinerConfig(payload interface{}) (bool, interface{}, error) {
+	if payload == nil {
+		return false, nil, fmt.Errorf("miner config required")
+	}
+
+	var config executor.MinerConfig
+	if err := decodePayload(payload, &config); err != nil {
+		return false, nil, err
+	}
+
+	result := exec.ValidateMinerConfig(&config)
+	return result.Valid, result, nil
+}
+
+func handleStopMiner(payload interface{}, cfg *config.Config) (bool, interface{}, error) {
 	if err := exec.StopMiner(); err != nil {
-		return false, err
+		return false, nil, err
+	}
+	exec.CancelPause()
+	notifyPauseChanged()
+
+	// Don't leave idle cards at mining clocks
+	if cfg.IdlePowerSave {
+		return enterPowerSave(cfg.IdleSuspend)
 	}
-	return true, nil
+	return true, nil, nil
 }
 
-func handleRestartMiner(payload interface{}, cfg *config.Config) (bool, error) {
+func handleRestartMiner(payload interface{}, cfg *config.Config) (bool, interface{}, error) {
 	if err := exec.RestartMiner(); err != nil {
-		return false, err
+		return false, nil, err
 	}
-	return true, nil
+	return true, nil, nil
 }
 
-func handleApplyOC(payload interface{}, cfg *config.Config) (bool, error) {
+// handleMine starts mining a coin or algorithm with automatically chosen
+// miners: one instance per GPU vendor, or a single instance when the same
+// miner ranks best for both
+func handleMine(payload interface{}, cfg *config.Config) (bool, interface{}, error) {
 	if payload == nil {
-		return false, fmt.Errorf("OC config required")
+		return false, nil, fmt.Errorf("coin or algorithm, pool and wallet required")
+	}
+
+	var req struct {
+		Coin          string   `json:"coin"`
+		Algorithm     string   `json:"algorithm"`
+		Pool          string   `json:"pool"`
+		FailoverPools []string `json:"failoverPools"`
+		Preset        string   `json:"preset"`   // "COIN @ pool" instead of coin and pool
+		PoolTLS       bool     `json:"poolTls"`  // TLS endpoint of the preset pool
+		NiceHash      bool     `json:"nicehash"` // Mine to NiceHash; the pool defaults to the algorithm's endpoint
+		Wallet        string   `json:"wallet"`
+		Worker        string   `json:"worker"`
+		AutoInstall   *bool    `json:"autoInstall"` // Install the recommended miner if none is installed (default true)
+	}
+	if err := decodePayload(payload, &req); err != nil {
+		return false, nil, err
+	}
+
+	base := executor.MinerConfig{
+		Algorithm:     req.Algorithm,
+		Coin:          req.Coin,
+		Pool:          req.Pool,
+		FailoverPools: req.FailoverPools,
+		Preset:        req.Preset,
+		PoolTLS:       req.PoolTLS,
+		NiceHash:      req.NiceHash,
+		Wallet:        req.Wallet,
+		Worker:        req.Worker,
+	}
+	if base.Preset != "" {
+		if err := exec.ResolveCoinPreset(&base); err != nil {
+			return false, nil, err
+		}
+	}
+
+	algorithm := base.Algorithm
+	if algorithm == "" {
+		algorithm = executor.AlgorithmForCoin(base.Coin)
+		if algorithm == "" {
+			return false, nil, fmt.Errorf("unknown coin %q, specify an algorithm", base.Coin)
+		}
+		base.Algorithm = algorithm
+	}
+	if base.NiceHash {
+		if err := executor.ResolveNiceHash(&base); err != nil {
+			return false, nil, err
+		}
+		algorithm = base.Algorithm
+	}
+	if base.Pool == "" {
+		return false, nil, fmt.Errorf("pool required")
+	}
+
+	var vendors []string
+	if executor.CPUAlgorithm(algorithm) {
+		vendors = append(vendors, "cpu")
+	} else {
+		drivers := installer.DetectDrivers()
+		if drivers.NvidiaGPUs {
+			vendors = append(vendors, "nvidia")
+		}
+		if drivers.AMDGPUs {
+			vendors = append(vendors, "amd")
+		}
+		if len(vendors) == 0 {
+			return false, nil, fmt.Errorf("no NVIDIA or AMD GPUs detected")
+		}
+	}
+
+	autoInstall := req.AutoInstall == nil || *req.AutoInstall
+	miners := map[string]string{}
+	for _, vendor := range vendors {
+		name, installed, err := exec.SelectMiner(algorithm, vendor)
+		if err != nil {
+			return false, nil, err
+		}
+		if !installed {
+			if !autoInstall {
+				return false, nil, fmt.Errorf("no miner for %s on %s GPUs is installed (recommended: %s)", algorithm, vendor, name)
+			}
+			log.Printf("Installing %s for %s on %s GPUs", name, algorithm, vendor)
+			if err := inst.Install(name); err != nil {
+				return false, nil, fmt.Errorf("failed to install %s: %w", name, err)
+			}
+		}
+		miners[vendor] = name
+	}
+
+	var configs []*executor.MinerConfig
+	if len(vendors) == 1 || miners["nvidia"] == miners["amd"] {
+		config := base
+		config.Name = miners[vendors[0]]
+		configs = append(configs, &config)
+	} else {
+		for _, vendor := range vendors {
+			config := base
+			config.Name = miners[vendor]
+			config.GPUVendor = vendor
+			configs = append(configs, &config)
+		}
+	}
+
+	if err := exec.StartMiners(configs); err != nil {
+		return false, nil, err
+	}
+
+	log.Printf("Mining %s with %v", algorithm, miners)
+	return true, map[string]interface{}{
+		"algorithm": algorithm,
+		"miners":    miners,
+	}, nil
+}
+
+func handleApplyOC(payload interface{}, cfg *config.Config) (bool, interface{}, error) {
+	if payload == nil {
+		return false, nil, fmt.Errorf("OC config required")
 	}
 
 	// Convert payload to OCConfig
 	data, err := json.Marshal(payload)
 	if err != nil {
-		return false, fmt.Errorf("invalid payload: %w", err)
+		return false, nil, fmt.Errorf("invalid payload: %w", err)
 	}
 
 	var config executor.OCConfig
 	if err := json.Unmarshal(data, &config); err != nil {
-		return false, fmt.Errorf("invalid OC config: %w", err)
+		return false, nil, fmt.Errorf("invalid OC config: %w", err)
 	}
 
 	if err := exec.ApplyOC(&config); err != nil {
-		return false, err
+		return false, nil, err
+	}
+
+	return true, nil, nil
+}
+
+// handleSyncOCPresets stores OC presets pushed by the server
+func handleSyncOCPresets(payload interface{}) (bool, interface{}, error) {
+	var req struct {
+		Presets []executor.OCPreset `json:"presets"`
+		Replace bool                `json:"replace"` // Replace the whole store instead of merging by name
+	}
+	if payload == nil {
+		return false, nil, fmt.Errorf("presets required")
+	}
+	if err := decodePayload(payload, &req); err != nil {
+		return false, nil, err
+	}
+
+	count, err := exec.SyncOCPresets(req.Presets, req.Replace)
+	if err != nil {
+		return false, nil, err
+	}
+
+	log.Printf("Synced %d OC preset(s), %d stored", len(req.Presets), count)
+	return true, map[string]interface{}{"stored": count}, nil
+}
+
+// handleSyncCoinPresets stores coin/pool presets pushed by the server
+func handleSyncCoinPresets(payload interface{}) (bool, interface{}, error) {
+	var req struct {
+		Presets []executor.CoinPreset `json:"presets"`
+		Replace bool                  `json:"replace"` // Replace the synced store instead of merging by coin
+	}
+	if payload == nil {
+		return false, nil, fmt.Errorf("presets required")
+	}
+	if err := decodePayload(payload, &req); err != nil {
+		return false, nil, err
+	}
+
+	count, err := exec.SyncCoinPresets(req.Presets, req.Replace)
+	if err != nil {
+		return false, nil, err
+	}
+
+	log.Printf("Synced %d coin preset(s), %d stored", len(req.Presets), count)
+	return true, map[string]interface{}{"stored": count}, nil
+}
+
+// handleListCoinPresets returns the built-in and synced coin presets
+func handleListCoinPresets() (bool, interface{}, error) {
+	presets, err := exec.CoinPresets()
+	if err != nil {
+		return false, nil, err
+	}
+	return true, presets, nil
+}
+
+// handleApplyOCProfile applies a stored OC preset by name
+func handleApplyOCProfile(payload interface{}) (bool, interface{}, error) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if payload != nil {
+		if err := decodePayload(payload, &req); err != nil {
+			return false, nil, err
+		}
+	}
+	if req.Name == "" {
+		return false, nil, fmt.Errorf("preset name required")
 	}
 
-	return true, nil
+	results, err := exec.ApplyOCPreset(req.Name)
+	if err != nil {
+		return false, results, err
+	}
+	return true, results, nil
 }
 
-func handleReboot(cfg *config.Config) (bool, error) {
+// handleSetOCSchedule stores the OC preset schedule; an empty schedule
+// disables it
+func handleSetOCSchedule(payload interface{}) (bool, interface{}, error) {
+	var schedule executor.OCSchedule
+	if payload != nil {
+		if err := decodePayload(payload, &schedule); err != nil {
+			return false, nil, err
+		}
+	}
+
+	if err := exec.SetOCSchedule(&schedule); err != nil {
+		return false, nil, err
+	}
+
+	select {
+	case ocScheduleChanged <- struct{}{}:
+	default:
+	}
+
+	preset, _, _ := schedule.PresetAt(time.Now())
+	return true, map[string]interface{}{"current": preset}, nil
+}
+
+// handleImportHiveOS converts a HiveOS flight sheet, wallets and OC profile
+// into agent configs, optionally applying them right away
+func handleImportHiveOS(payload interface{}) (bool, interface{}, error) {
+	var req struct {
+		executor.HiveOSExport
+		Worker string `json:"worker"` // Replaces %WORKER_NAME% (default: hostname)
+		Apply  bool   `json:"apply"`  // Start the miners and apply the OC
+	}
+	if payload == nil {
+		return false, nil, fmt.Errorf("HiveOS export required")
+	}
+	if err := decodePayload(payload, &req); err != nil {
+		return false, nil, err
+	}
+	if req.Worker == "" {
+		req.Worker, _ = os.Hostname()
+	}
+
+	result, err := executor.ImportHiveOS(&req.HiveOSExport, req.Worker)
+	if err != nil {
+		return false, nil, err
+	}
+	if !req.Apply {
+		return true, result, nil
+	}
+
+	if len(result.NvidiaOC) > 0 {
+		if err := exec.ApplyVendorOC("nvidia", result.NvidiaOC); err != nil {
+			return false, result, fmt.Errorf("nvidia OC: %w", err)
+		}
+	}
+	if len(result.AMDOC) > 0 {
+		if err := exec.ApplyVendorOC("amd", result.AMDOC); err != nil {
+			return false, result, fmt.Errorf("amd OC: %w", err)
+		}
+	}
+	if len(result.Miners) > 0 {
+		if err := exec.StartMiners(result.Miners); err != nil {
+			return false, result, err
+		}
+	}
+
+	log.Printf("Imported HiveOS config: %d miner(s)", len(result.Miners))
+	return true, result, nil
+}
+
+// handleReboot acknowledges and then reboots; the outcome is reported once
+// the agent is back (see reboot.go)
+func handleReboot(commandID string, payload interface{}, cfg *config.Config) (bool, interface{}, error) {
+	var req struct {
+		Method string `json:"method"` // "soft" (default) or "bmc"
+	}
+	if payload != nil {
+		if err := decodePayload(payload, &req); err != nil {
+			return false, nil, err
+		}
+	}
+	if req.Method == "bmc" && bmc == nil {
+		return false, nil, fmt.Errorf("no BMC available for power cycle")
+	}
+
+	reboot, start := acceptReboot(commandID, req.Method)
+	if !start {
+		return true, map[string]interface{}{"reboot": reboot, "repeated": true}, nil
+	}
+
 	// Start reboot in background so we can respond first
-	go func() {
-		time.Sleep(2 * time.Second)
-		exec.Reboot()
-	}()
-	return true, nil
+	go rebootForCommand(req.Method)
+	return true, map[string]interface{}{"reboot": reboot}, nil
 }
 
-func handleShutdown(cfg *config.Config) (bool, error) {
+// rebootRig reboots the OS ("soft") or power cycles via the BMC ("bmc"),
+// escalating to the BMC when a soft reboot doesn't happen
+func rebootRig(method string) {
+	if method == "bmc" {
+		log.Println("Power cycling via BMC...")
+		if _, err := bmc.Power("cycle"); err != nil {
+			log.Printf("BMC power cycle failed: %v", err)
+		}
+		return
+	}
+
+	// A reboot that hangs is left to the USB watchdog
+	usbWatchdogHold.Store(true)
+	if err := exec.Reboot(); err != nil {
+		usbWatchdogHold.Store(false)
+		log.Printf("Reboot failed: %v", err)
+	} else {
+		// Still alive: give the OS time to go down before escalating
+		time.Sleep(3 * time.Minute)
+	}
+
+	// The OS did not reboot; fall back to an out-of-band power cycle
+	if bmc != nil {
+		log.Println("Reboot did not complete, power cycling via BMC...")
+		if _, err := bmc.Power("cycle"); err != nil {
+			log.Printf("BMC power cycle failed: %v", err)
+		}
+	}
+}
+
+func handleShutdown(cfg *config.Config) (bool, interface{}, error) {
 	// Start shutdown in background so we can respond first
 	go func() {
 		time.Sleep(2 * time.Second)
 		exec.Shutdown()
 	}()
-	return true, nil
+	return true, nil, nil
 }
 
 // handleInstallMiner installs a miner from GitHub releases
-func handleInstallMiner(payload interface{}, cfg *config.Config) (bool, error) {
+func handleInstallMiner(payload interface{}, cfg *config.Config) (bool, interface{}, error) {
 	if payload == nil {
-		return false, fmt.Errorf("miner name required")
+		return false, nil, fmt.Errorf("miner name required")
 	}
 
 	// Extract miner name from payload
 	data, err := json.Marshal(payload)
 	if err != nil {
-		return false, fmt.Errorf("invalid payload: %w", err)
+		return false, nil, fmt.Errorf("invalid payload: %w", err)
 	}
 
 	var req struct {
 		MinerName string `json:"minerName"`
 	}
 	if err := json.Unmarshal(data, &req); err != nil {
-		return false, fmt.Errorf("invalid install request: %w", err)
+		return false, nil, fmt.Errorf("invalid install request: %w", err)
 	}
 
 	if req.MinerName == "" {
-		return false, fmt.Errorf("miner name required")
+		return false, nil, fmt.Errorf("miner name required")
 	}
 
 	log.Printf("Installing miner: %s", req.MinerName)
 
 	// Install the miner (this may take a while)
 	if err := inst.Install(req.MinerName); err != nil {
-		return false, fmt.Errorf("failed to install %s: %w", req.MinerName, err)
+		return false, nil, fmt.Errorf("failed to install %s: %w", req.MinerName, err)
 	}
 
 	log.Printf("Miner %s installed successfully", req.MinerName)
-	return true, nil
+	return true, nil, nil
 }
 
 // handleUninstallMiner removes an installed miner
-func handleUninstallMiner(payload interface{}, cfg *config.Config) (bool, error) {
+func handleUninstallMiner(payload interface{}, cfg *config.Config) (bool, interface{}, error) {
 	if payload == nil {
-		return false, fmt.Errorf("miner name required")
+		return false, nil, fmt.Errorf("miner name required")
 	}
 
 	data, err := json.Marshal(payload)
 	if err != nil {
-		return false, fmt.Errorf("invalid payload: %w", err)
+		return false, nil, fmt.Errorf("invalid payload: %w", err)
 	}
 
 	var req struct {
 		MinerName string `json:"minerName"`
 	}
 	if err := json.Unmarshal(data, &req); err != nil {
-		return false, fmt.Errorf("invalid uninstall request: %w", err)
+		return false, nil, fmt.Errorf("invalid uninstall request: %w", err)
 	}
 
 	if req.MinerName == "" {
-		return false, fmt.Errorf("miner name required")
+		return false, nil, fmt.Errorf("miner name required")
 	}
 
 	log.Printf("Uninstalling miner: %s", req.MinerName)
 
 	if err := inst.Uninstall(req.MinerName); err != nil {
-		return false, fmt.Errorf("failed to uninstall %s: %w", req.MinerName, err)
+		return false, nil, fmt.Errorf("failed to uninstall %s: %w", req.MinerName, err)
 	}
 
 	log.Printf("Miner %s uninstalled successfully", req.MinerName)
-	return true, nil
+	return true, nil, nil
+}
+
+// decodePayload converts a generic command payload into the given struct
+func decodePayload(payload interface{}, v interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+	return nil
 }
 
 // handleListMiners returns list of available and installed miners
-func handleListMiners(cfg *config.Config) (bool, error) {
+func handleListMiners(cfg *config.Config) (bool, interface{}, error) {
 	installed, err := inst.ListInstalled()
 	if err != nil {
-		return false, fmt.Errorf("failed to list installed miners: %w", err)
+		return false, nil, fmt.Errorf("failed to list installed miners: %w", err)
 	}
 
 	available := inst.ListAvailable()
 	
 	log.Printf("Available miners: %d, Installed miners: %d", len(available), len(installed))
-	return true, nil
+	return true, map[string]interface{}{
+		"installed": installed,
+		"available": available,
+	}, nil
 }
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+
+	"github.com/bloxos/agent/internal/system"
+	"github.com/bloxos/agent/internal/ws"
+)
+
+// osUpdating is set while apply_os_updates runs
+var osUpdating atomic.Bool
+
+// handleAptUpdate refreshes the package lists and returns the upgradable
+// packages, marking the ones apply_os_updates installs by default
+func handleAptUpdate(payload interface{}) (bool, interface{}, error) {
+	req := struct {
+		Refresh bool `json:"refresh"`
+	}{Refresh: true}
+	if payload != nil {
+		if err := decodePayload(payload, &req); err != nil {
+			return false, nil, err
+		}
+	}
+
+	updates, err := system.ListOSUpdates(req.Refresh)
+	if err != nil {
+		return false, nil, err
+	}
+	rebootRequired, _ := system.RebootRequired()
+	return true, map[string]interface{}{
+		"updates":        updates,
+		"selected":       updateNames(defaultOSUpdates(updates)),
+		"rebootRequired": rebootRequired,
+	}, nil
+}
+
+// handleApplyOSUpdates installs security and driver updates (or the given
+// packages, or all with "all") in the background, reporting progress as
+// os_update events and rebooting afterwards if the update requires it
+func handleApplyOSUpdates(payload interface{}) (bool, interface{}, error) {
+	var req struct {
+		Packages []string `json:"packages"` // Explicit selection
+		All      bool     `json:"all"`      // Every upgradable package
+		Reboot   string   `json:"reboot"`   // "auto" (default) or "never"
+	}
+	if payload != nil {
+		if err := decodePayload(payload, &req); err != nil {
+			return false, nil, err
+		}
+	}
+	if req.Reboot == "" {
+		req.Reboot = "auto"
+	}
+	if req.Reboot != "auto" && req.Reboot != "never" {
+		return false, nil, fmt.Errorf("reboot must be auto or never")
+	}
+
+	if !osUpdating.CompareAndSwap(false, true) {
+		return false, nil, fmt.Errorf("an OS update is already running")
+	}
+	if driverInstalling.Load() {
+		osUpdating.Store(false)
+		return false, nil, fmt.Errorf("a driver install is running")
+	}
+
+	updates, err := system.ListOSUpdates(true)
+	if err != nil {
+		osUpdating.Store(false)
+		return false, nil, err
+	}
+
+	selected, err := selectOSUpdates(updates, req.Packages, req.All)
+	if err != nil {
+		osUpdating.Store(false)
+		return false, nil, err
+	}
+	if len(selected) == 0 {
+		osUpdating.Store(false)
+		return true, map[string]interface{}{"packages": []string{}}, nil
+	}
+
+	go runOSUpdate(selected, req.Reboot)
+	return true, map[string]interface{}{
+		"packages": updateNames(selected),
+		"reboot":   req.Reboot,
+	}, nil
+}
+
+// defaultOSUpdates picks security fixes, GPU drivers and kernels
+func defaultOSUpdates(updates []system.PackageUpdate) []system.PackageUpdate {
+	var selected []system.PackageUpdate
+	for _, update := range updates {
+		if update.Security || update.Class != "other" {
+			selected = append(selected, update)
+		}
+	}
+	return selected
+}
+
+// selectOSUpdates resolves the requested packages against the upgradable ones
+func selectOSUpdates(updates []system.PackageUpdate, packages []string, all bool) ([]system.PackageUpdate, error) {
+	if all {
+		return updates, nil
+	}
+	if len(packages) == 0 {
+		return defaultOSUpdates(updates), nil
+	}
+
+	byName := map[string]system.PackageUpdate{}
+	for _, update := range updates {
+		byName[update.Name] = update
+	}
+	var selected []system.PackageUpdate
+	var unknown []string
+	for _, name := range packages {
+		if update, ok := byName[name]; ok {
+			selected = append(selected, update)
+		} else {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("no update available for %s", strings.Join(unknown, ", "))
+	}
+	return selected, nil
+}
+
+// runOSUpdate installs the updates, stopping the miner around driver and
+// kernel upgrades, then reboots or restarts the miner
+func runOSUpdate(updates []system.PackageUpdate, reboot string) {
+	defer osUpdating.Store(false)
+
+	names := updateNames(updates)
+	sendOSUpdateEvent("info", fmt.Sprintf("Installing %d OS updates", len(names)),
+		map[string]interface{}{"stage": "start", "packages": names})
+
+	// Drivers replaced under a running miner crash it or hang the GPUs
+	minerStopped := false
+	for _, update := range updates {
+		if update.Class != "other" {
+			if running, _ := exec.GetMinerStatus()["running"].(bool); running {
+				waitForDAGEpoch("the driver/kernel update")
+				log.Println("Stopping miner for driver/kernel updates")
+				serialized(func() {
+					if err := exec.StopMiner(); err != nil {
+						log.Printf("Failed to stop miner: %v", err)
+					}
+				})
+				minerStopped = true
+			}
+			break
+		}
+	}
+
+	reported := -1
+	err := system.ApplyOSUpdates(names, func(progress system.OSUpdateProgress) {
+		// Report every 10%, not every apt status line
+		if step := int(progress.Percent) / 10; step > reported {
+			reported = step
+			sendOSUpdateEvent("info", fmt.Sprintf("OS update %.0f%%: %s", progress.Percent, progress.Message), progress)
+		}
+	})
+	if err != nil {
+		sendOSUpdateEvent("warning", fmt.Sprintf("OS update failed: %v", err),
+			map[string]interface{}{"stage": "failed", "packages": names})
+		restartStoppedMiner(minerStopped)
+		return
+	}
+
+	recordUpdate()
+
+	required, requiredBy := system.RebootRequired()
+	data := map[string]interface{}{"stage": "done", "packages": names, "rebootRequired": required, "rebootRequiredBy": requiredBy}
+	switch {
+	case required && reboot == "auto":
+		data["stage"] = "rebooting"
+		sendOSUpdateEvent("info", "OS updates installed, rebooting", data)
+		serialized(func() {
+			if err := exec.StopMiner(); err != nil {
+				log.Printf("Failed to stop miner: %v", err)
+			}
+		})
+		rebootRig("soft")
+	case required:
+		sendOSUpdateEvent("warning", "OS updates installed, a reboot is required", data)
+		restartStoppedMiner(minerStopped)
+	default:
+		sendOSUpdateEvent("info", "OS updates installed", data)
+		restartStoppedMiner(minerStopped)
+	}
+}
+
+// restartStoppedMiner resumes mining after an update that didn't reboot
+func restartStoppedMiner(stopped bool) {
+	if !stopped {
+		return
+	}
+	serialized(func() {
+		if err := exec.RestartMiner(); err != nil {
+			log.Printf("Failed to restart miner after OS update: %v", err)
+		}
+	})
+}
+
+// sendOSUpdateEvent logs and reports an OS update step
+func sendOSUpdateEvent(severity, message string, data interface{}) {
+	log.Println(message)
+	if !wsClient.AnyConnected() {
+		return
+	}
+	event := &ws.Event{
+		Type:     "os_update",
+		Severity: severity,
+		Message:  message,
+		Data:     data,
+	}
+	if err := wsClient.SendEvent(event); err != nil {
+		log.Printf("Failed to send OS update event: %v", err)
+	}
+}
+
+func updateNames(updates []system.PackageUpdate) []string {
+	names := make([]string, 0, len(updates))
+	for _, update := range updates {
+		names = append(names, update.Name)
+	}
+	return names
+}
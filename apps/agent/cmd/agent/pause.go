@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bloxos/agent/internal/config"
+	"github.com/bloxos/agent/internal/executor"
+	"github.com/bloxos/agent/internal/ws"
+)
+
+// pauseChanged wakes the pause timer when a pause starts or ends
+var pauseChanged = make(chan struct{}, 1)
+
+func notifyPauseChanged() {
+	select {
+	case pauseChanged <- struct{}{}:
+	default:
+	}
+}
+
+// handlePauseMiner stops mining but remembers the flight sheet, resuming
+// it after the given minutes (0 = until resume_miner)
+func handlePauseMiner(payload interface{}, cfg *config.Config) (bool, interface{}, error) {
+	var req struct {
+		Minutes int    `json:"minutes"`
+		Reason  string `json:"reason"`
+	}
+	if payload != nil {
+		if err := decodePayload(payload, &req); err != nil {
+			return false, nil, err
+		}
+	}
+	if req.Minutes < 0 {
+		return false, nil, fmt.Errorf("minutes must not be negative")
+	}
+
+	state, err := exec.PauseMiner(time.Duration(req.Minutes)*time.Minute, req.Reason)
+	if err != nil {
+		return false, state, err
+	}
+	notifyPauseChanged()
+
+	// Don't leave idle cards at mining clocks; no suspend, the pause
+	// timer has to keep running
+	if cfg.IdlePowerSave {
+		if _, err := exec.EnterPowerSave(); err != nil {
+			log.Printf("Power saving during pause failed: %v", err)
+		}
+	}
+	return true, state, nil
+}
+
+// handleResumeMiner restarts the paused flight sheet
+func handleResumeMiner() (bool, interface{}, error) {
+	if err := exec.ResumeMiner(); err != nil {
+		return false, nil, err
+	}
+	notifyPauseChanged()
+	return true, nil, nil
+}
+
+// runPauseTimer resumes mining once a timed pause runs out, also after an
+// agent restart or reboot during the pause
+func runPauseTimer(client *ws.Client) {
+	for {
+		wait := time.Hour
+		// Safe mode keeps the rig stopped; reset_recovery wakes the timer
+		if state := exec.PauseStatus(); state != nil && state.ResumeAt > 0 && !safeModeActive() {
+			wait = time.Until(time.Unix(state.ResumeAt, 0))
+			if wait <= 0 {
+				wait = time.Minute // Retry if the miner doesn't start
+				serialized(func() { autoResume(client, state) })
+			}
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-pauseChanged:
+		}
+	}
+}
+
+// autoResume resumes a pause that ran out and reports how it went
+func autoResume(client *ws.Client, state *executor.PauseState) {
+	paused := time.Since(time.Unix(state.Since, 0)).Round(time.Minute)
+	event := &ws.Event{
+		Type:     "mining_resumed",
+		Severity: "info",
+		Message:  fmt.Sprintf("Mining resumed after a %s pause", paused),
+		Data:     state,
+	}
+	if err := exec.ResumeMiner(); err != nil {
+		event.Severity = "warning"
+		event.Message = fmt.Sprintf("Failed to resume mining after pause: %v", err)
+	}
+	log.Println(event.Message)
+
+	if client.AnyConnected() {
+		if err := client.SendEvent(event); err != nil {
+			log.Printf("Failed to send resume event: %v", err)
+		}
+	}
+}
@@ -0,0 +1,435 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bloxos/agent/internal/system"
+	"github.com/bloxos/agent/internal/ws"
+)
+
+// Conditions a recovery playbook reacts to
+const (
+	triggerMinerCrash    = "miner_crash"    // A miner the agent started exited on its own
+	triggerHashrateLow   = "hashrate_low"   // Well below the benchmarked hashrate (see checkHashrate)
+	triggerSharesStalled = "shares_stalled" // Hashing without accepted shares
+)
+
+// playbookActions are the steps a stage can take, run in the order given;
+// a reboot always runs last
+var playbookActions = map[string]bool{
+	"restart_miner": true,
+	"stop_miner":    true,
+	"reset_oc":      true, // Stock clocks, power limits and fans
+	"reboot":        true, // The miner is restarted after the reboot
+	"safe_mode":     true, // Stop mining at stock settings until reset_recovery
+	"alert":         true, // Report the stage as critical
+}
+
+// playbook is a recovery procedure pushed by the server: once the trigger
+// has occurred Count times within Window seconds the first stage runs, and
+// each further occurrence before the rig has settled runs the next one
+type playbook struct {
+	Name    string          `json:"name"`
+	Trigger string          `json:"trigger"`
+	Count   int             `json:"count,omitempty"`  // Default 1
+	Window  int             `json:"window,omitempty"` // Seconds (default 600)
+	Stages  []playbookStage `json:"stages"`
+}
+
+type playbookStage struct {
+	Actions []string `json:"actions"`
+	Settle  int      `json:"settle,omitempty"`  // Seconds without the trigger that count as recovered (default 600)
+	Message string   `json:"message,omitempty"` // Included in the stage's event
+}
+
+// playbookState is a playbook's progress
+type playbookState struct {
+	Stage       int     `json:"stage"` // Stages run so far
+	Occurrences []int64 `json:"occurrences,omitempty"`
+	LastAction  int64   `json:"lastAction,omitempty"`
+	LastSeen    int64   `json:"lastSeen,omitempty"` // Last occurrence
+	Exhausted   bool    `json:"exhausted,omitempty"`
+}
+
+// recoveryState is kept across the reboots playbooks do
+type recoveryState struct {
+	Playbooks map[string]*playbookState `json:"playbooks"` // By playbook name
+	SafeMode  bool                      `json:"safeMode,omitempty"`
+	Resume    bool                      `json:"resume,omitempty"` // Restart the miner after a playbook reboot
+}
+
+var (
+	recoveryMu sync.Mutex
+	playbooks  []playbook
+	recovery   = &recoveryState{Playbooks: map[string]*playbookState{}}
+)
+
+func playbooksPath() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".bloxos", "playbooks.json")
+}
+
+func recoveryStatePath() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".bloxos", "recovery.json")
+}
+
+// loadPlaybooks restores the playbooks and their progress
+func loadPlaybooks() {
+	recoveryMu.Lock()
+	defer recoveryMu.Unlock()
+
+	if data, err := os.ReadFile(playbooksPath()); err == nil {
+		if err := json.Unmarshal(data, &playbooks); err != nil {
+			log.Printf("Ignoring invalid recovery playbooks: %v", err)
+			playbooks = nil
+		}
+	}
+	if data, err := os.ReadFile(recoveryStatePath()); err == nil {
+		json.Unmarshal(data, recovery)
+	}
+	if recovery.Playbooks == nil {
+		recovery.Playbooks = map[string]*playbookState{}
+	}
+}
+
+// saveRecoveryState writes the progress. Called with recoveryMu held. The
+// progress stays in memory only while the disk is failing.
+func saveRecoveryState() {
+	if system.DiskDegraded() {
+		return
+	}
+	data, _ := json.Marshal(recovery)
+	os.MkdirAll(filepath.Dir(recoveryStatePath()), 0755)
+	if err := os.WriteFile(recoveryStatePath(), data, 0644); err != nil {
+		log.Printf("Recovery: %v", err)
+	}
+}
+
+func (p *playbook) validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("playbook name required")
+	}
+	switch p.Trigger {
+	case triggerMinerCrash, triggerHashrateLow, triggerSharesStalled:
+	default:
+		return fmt.Errorf("playbook %s: unknown trigger %q", p.Name, p.Trigger)
+	}
+	if p.Count < 0 || p.Window < 0 {
+		return fmt.Errorf("playbook %s: count and window must not be negative", p.Name)
+	}
+	if len(p.Stages) == 0 {
+		return fmt.Errorf("playbook %s: at least one stage required", p.Name)
+	}
+	for i, stage := range p.Stages {
+		if len(stage.Actions) == 0 {
+			return fmt.Errorf("playbook %s: stage %d has no actions", p.Name, i+1)
+		}
+		for _, action := range stage.Actions {
+			if !playbookActions[action] {
+				return fmt.Errorf("playbook %s: unknown action %q", p.Name, action)
+			}
+		}
+	}
+	return nil
+}
+
+// handleSetPlaybooks replaces the recovery playbooks. Progress is kept for
+// playbooks that stay.
+func handleSetPlaybooks(payload interface{}) (bool, interface{}, error) {
+	var req struct {
+		Playbooks []playbook `json:"playbooks"`
+	}
+	if payload != nil {
+		if err := decodePayload(payload, &req); err != nil {
+			return false, nil, err
+		}
+	}
+	names := map[string]bool{}
+	for i := range req.Playbooks {
+		if err := req.Playbooks[i].validate(); err != nil {
+			return false, nil, err
+		}
+		if names[req.Playbooks[i].Name] {
+			return false, nil, fmt.Errorf("duplicate playbook %s", req.Playbooks[i].Name)
+		}
+		names[req.Playbooks[i].Name] = true
+	}
+
+	data, err := json.Marshal(req.Playbooks)
+	if err != nil {
+		return false, nil, err
+	}
+	os.MkdirAll(filepath.Dir(playbooksPath()), 0755)
+	if err := os.WriteFile(playbooksPath(), data, 0644); err != nil {
+		return false, nil, fmt.Errorf("failed to save playbooks: %w", err)
+	}
+
+	recoveryMu.Lock()
+	defer recoveryMu.Unlock()
+	playbooks = req.Playbooks
+	for name := range recovery.Playbooks {
+		if !names[name] {
+			delete(recovery.Playbooks, name)
+		}
+	}
+	saveRecoveryState()
+
+	log.Printf("Recovery playbooks updated: %d", len(playbooks))
+	return true, map[string]interface{}{"playbooks": len(playbooks)}, nil
+}
+
+// handleResetRecovery leaves safe mode and starts every playbook over
+func handleResetRecovery() (bool, interface{}, error) {
+	recoveryMu.Lock()
+	defer recoveryMu.Unlock()
+	wasSafe := recovery.SafeMode
+	recovery.SafeMode = false
+	exec.SetSafeMode(false)
+	recovery.Resume = false
+	recovery.Playbooks = map[string]*playbookState{}
+	saveRecoveryState()
+	notifyPauseChanged()
+	return true, map[string]interface{}{"safeMode": wasSafe}, nil
+}
+
+// safeModeActive reports whether a playbook left the rig in safe mode
+func safeModeActive() bool {
+	recoveryMu.Lock()
+	defer recoveryMu.Unlock()
+	return recovery.SafeMode
+}
+
+// recoveryStatus returns the playbooks in progress for the stats, or nil
+func recoveryStatus() map[string]interface{} {
+	recoveryMu.Lock()
+	defer recoveryMu.Unlock()
+
+	active := map[string]int{}
+	for name, state := range recovery.Playbooks {
+		if state.Stage > 0 {
+			active[name] = state.Stage
+		}
+	}
+	if len(active) == 0 && !recovery.SafeMode {
+		return nil
+	}
+	return map[string]interface{}{"safeMode": recovery.SafeMode, "stages": active}
+}
+
+// playbookRun is a stage due to run
+type playbookRun struct {
+	book    playbook
+	stage   int
+	trigger string
+}
+
+// runPlaybooks watches for the playbook triggers and runs the stages due
+func runPlaybooks(client *ws.Client) {
+	recoveryMu.Lock()
+	resume := recovery.Resume && !recovery.SafeMode
+	recovery.Resume = false
+	saveRecoveryState()
+	recoveryMu.Unlock()
+	if resume {
+		log.Println("Recovery: restarting the miner after the playbook reboot")
+		serialized(func() {
+			if err := exec.RestartMiner(); err != nil {
+				log.Printf("Recovery: %v", err)
+			}
+		})
+	}
+
+	crashedPID := 0
+	stalled, low := false, false
+	for range time.Tick(10 * time.Second) {
+		if exec.PauseStatus() != nil || exec.PowerSaveStatus() != nil || osUpdating.Load() || driverInstalling.Load() {
+			continue
+		}
+
+		occurred := map[string]bool{}
+		if pid := exec.MinerExited(); pid != 0 && pid != crashedPID {
+			crashedPID = pid
+			occurred[triggerMinerCrash] = true
+		}
+		stats := coll.LastMinerStats()
+		nowStalled := stats != nil && stats.Running && stats.SharesStalled
+		occurred[triggerSharesStalled] = nowStalled && !stalled
+		stalled = nowStalled
+		nowLow := hashrateLow()
+		occurred[triggerHashrateLow] = nowLow && !low
+		low = nowLow
+
+		for _, run := range duePlaybooks(client, occurred) {
+			run := run
+			serialized(func() { runPlaybookStage(client, run) })
+		}
+	}
+}
+
+// duePlaybooks updates the playbooks' progress with this check's
+// occurrences and returns the stages to run
+func duePlaybooks(client *ws.Client, occurred map[string]bool) []playbookRun {
+	recoveryMu.Lock()
+	defer recoveryMu.Unlock()
+	if recovery.SafeMode {
+		return nil
+	}
+
+	now := time.Now()
+	changed := false
+	restart := false
+	var runs []playbookRun
+	for _, book := range playbooks {
+		state := recovery.Playbooks[book.Name]
+		if state == nil {
+			state = &playbookState{}
+			recovery.Playbooks[book.Name] = state
+		}
+
+		if !occurred[book.Trigger] {
+			// Settled since the last stage: recovered
+			if state.Stage > 0 {
+				settle := time.Duration(book.Stages[min(state.Stage, len(book.Stages))-1].Settle) * time.Second
+				if settle == 0 {
+					settle = 10 * time.Minute
+				}
+				last := time.Unix(max(state.LastAction, state.LastSeen), 0)
+				if now.Sub(last) >= settle {
+					sendRecoveryEvent(client, "info", fmt.Sprintf("Recovery playbook %q: rig recovered after %d stage(s)", book.Name, state.Stage),
+						map[string]interface{}{"playbook": book.Name, "stage": state.Stage, "recovered": true})
+					*state = playbookState{}
+					changed = true
+				}
+			}
+			continue
+		}
+
+		changed = true
+		state.LastSeen = now.Unix()
+		window := time.Duration(book.Window) * time.Second
+		if window == 0 {
+			window = 10 * time.Minute
+		}
+		recent := []int64{now.Unix()}
+		for _, t := range state.Occurrences {
+			if now.Sub(time.Unix(t, 0)) < window {
+				recent = append(recent, t)
+			}
+		}
+		state.Occurrences = recent
+
+		switch {
+		case state.Stage >= len(book.Stages):
+			if !state.Exhausted {
+				state.Exhausted = true
+				sendRecoveryEvent(client, "critical", fmt.Sprintf("Recovery playbook %q: every stage ran and %s persists", book.Name, book.Trigger),
+					map[string]interface{}{"playbook": book.Name, "stage": state.Stage, "exhausted": true})
+			}
+		case state.Stage > 0 || len(state.Occurrences) >= max(book.Count, 1):
+			runs = append(runs, playbookRun{book: book, stage: state.Stage, trigger: book.Trigger})
+			state.Stage++
+			state.LastAction = now.Unix()
+			state.Occurrences = nil
+		case book.Trigger == triggerMinerCrash:
+			// Below the crash count: restart it and keep counting
+			restart = true
+		}
+	}
+
+	if changed {
+		for _, run := range runs {
+			for _, action := range run.book.Stages[run.stage].Actions {
+				if action == "reboot" {
+					recovery.Resume = true
+				}
+			}
+		}
+		saveRecoveryState()
+	}
+	if restart && len(runs) == 0 {
+		runs = append(runs, playbookRun{stage: -1, trigger: triggerMinerCrash})
+	}
+	return runs
+}
+
+// runPlaybookStage carries out a stage's actions and reports them
+func runPlaybookStage(client *ws.Client, run playbookRun) {
+	if run.stage < 0 {
+		log.Println("Recovery: miner exited, restarting it")
+		if err := exec.RestartMiner(); err != nil {
+			log.Printf("Recovery: %v", err)
+		}
+		return
+	}
+
+	stage := run.book.Stages[run.stage]
+	severity := "warning"
+	reboot := false
+	results := map[string]string{}
+	for _, action := range stage.Actions {
+		var err error
+		switch action {
+		case "restart_miner":
+			err = exec.RestartMiner()
+			resetHashrateWatch()
+		case "stop_miner":
+			err = exec.StopMiner()
+		case "reset_oc":
+			err = exec.ResetOC()
+		case "safe_mode":
+			// Nothing may start the miner or overclock until reset_recovery
+			recoveryMu.Lock()
+			recovery.SafeMode = true
+			saveRecoveryState()
+			recoveryMu.Unlock()
+			exec.SetSafeMode(true)
+			exec.StopMiner()
+			err = exec.ResetOC()
+		case "alert":
+			severity = "critical"
+		case "reboot":
+			reboot = true
+			continue
+		}
+		results[action] = "ok"
+		if err != nil {
+			results[action] = err.Error()
+		}
+	}
+
+	message := fmt.Sprintf("Recovery playbook %q stage %d/%d after %s: %s", run.book.Name, run.stage+1, len(run.book.Stages),
+		strings.ReplaceAll(run.trigger, "_", " "), strings.Join(stage.Actions, ", "))
+	if stage.Message != "" {
+		message += " (" + stage.Message + ")"
+	}
+	sendRecoveryEvent(client, severity, message, map[string]interface{}{
+		"playbook": run.book.Name,
+		"trigger":  run.trigger,
+		"stage":    run.stage + 1,
+		"results":  results,
+	})
+
+	if reboot {
+		time.Sleep(2 * time.Second) // Let the event out
+		rebootRig("soft")
+	}
+}
+
+func sendRecoveryEvent(client *ws.Client, severity, message string, data interface{}) {
+	log.Println(message)
+	if !client.AnyConnected() {
+		return
+	}
+	event := &ws.Event{Type: "recovery", Severity: severity, Message: message, Data: data}
+	if err := client.SendEvent(event); err != nil {
+		log.Printf("Failed to send recovery event: %v", err)
+	}
+}
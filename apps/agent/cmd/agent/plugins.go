@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/bloxos/agent/internal/plugins"
+	"github.com/bloxos/agent/internal/ws"
+)
+
+var (
+	pluginMu       sync.Mutex
+	pluginFailures = map[string]string{} // Last failure by collector plugin
+)
+
+// collectCustom runs the collector plugins and adds what they print to the
+// stats under "custom", by plugin name
+func collectCustom(stats map[string]interface{}) {
+	results, failures := plugins.Collect(plugins.Dir("collectors"))
+	if len(results) > 0 {
+		stats["custom"] = results
+	}
+	if len(failures) > 0 {
+		stats["customErrors"] = failures
+	}
+
+	// Log a failure when it starts or changes, not every poll
+	pluginMu.Lock()
+	defer pluginMu.Unlock()
+	for name, failure := range failures {
+		if pluginFailures[name] != failure {
+			log.Printf("Collector plugin %s failed: %s", name, failure)
+		}
+	}
+	for name := range pluginFailures {
+		if _, ok := failures[name]; !ok {
+			log.Printf("Collector plugin %s recovered", name)
+		}
+	}
+	pluginFailures = failures
+}
+
+// handlePluginCommand runs the command plugin for a command type the agent
+// doesn't know. The payload is passed as JSON on stdin and the JSON the
+// plugin prints is the result; a non-zero exit fails the command.
+func handlePluginCommand(path string, cmd *ws.Command) (bool, interface{}, error) {
+	input, err := json.Marshal(cmd.Payload)
+	if err != nil {
+		return false, nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), plugins.CommandTimeout)
+	defer cancel()
+	result, err := plugins.Run(ctx, path, input,
+		"BLOXOS_COMMAND="+cmd.Type,
+		"BLOXOS_COMMAND_ID="+cmd.ID)
+	if err != nil {
+		return false, nil, fmt.Errorf("command plugin %s: %w", cmd.Type, err)
+	}
+	return true, result, nil
+}
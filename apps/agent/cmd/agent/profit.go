@@ -0,0 +1,150 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/bloxos/agent/internal/collector"
+	"github.com/bloxos/agent/internal/config"
+	"github.com/bloxos/agent/internal/executor"
+	"github.com/bloxos/agent/internal/powermeter"
+)
+
+// profitReport is the rig's live earnings per day, in the tariff currency
+type profitReport struct {
+	Currency    string      `json:"currency,omitempty"`
+	Coin        string      `json:"coin,omitempty"`
+	PricePerKWh float64     `json:"pricePerKwh"`
+	Power       float64     `json:"power"`           // W
+	PowerSource string      `json:"powerSource"`     // "wall" (meters) or "reported" (GPUs and CPU)
+	Gross       *float64    `json:"gross,omitempty"` // Unset without a coin price
+	PowerCost   float64     `json:"powerCost"`
+	Net         *float64    `json:"net,omitempty"`
+	GPUs        []gpuProfit `json:"gpus,omitempty"`
+}
+
+// gpuProfit is one GPU's share, without the rig's overhead
+type gpuProfit struct {
+	Index     int      `json:"index"`
+	Hashrate  float64  `json:"hashrate"`
+	Power     int      `json:"power"`
+	Gross     *float64 `json:"gross,omitempty"`
+	PowerCost float64  `json:"powerCost"`
+	Net       *float64 `json:"net,omitempty"`
+}
+
+// handleSetTariff stores the electricity tariff; no payload removes it and
+// falls back to -electricity-price
+func handleSetTariff(payload interface{}) (bool, interface{}, error) {
+	var tariff *executor.Tariff
+	if payload != nil {
+		tariff = &executor.Tariff{}
+		if err := decodePayload(payload, tariff); err != nil {
+			return false, nil, err
+		}
+	}
+	if err := exec.SetTariff(tariff); err != nil {
+		return false, nil, err
+	}
+	return true, tariff, nil
+}
+
+// handleSyncCoinPrices stores the coin prices and rewards from the server
+func handleSyncCoinPrices(payload interface{}) (bool, interface{}, error) {
+	var req struct {
+		Prices  []executor.CoinPrice `json:"prices"`
+		Replace bool                 `json:"replace"`
+	}
+	if err := decodePayload(payload, &req); err != nil {
+		return false, nil, err
+	}
+	count, err := exec.SyncCoinPrices(req.Prices, req.Replace)
+	if err != nil {
+		return false, nil, err
+	}
+	return true, map[string]interface{}{"prices": count}, nil
+}
+
+// profitability combines the electricity price, measured power and the
+// server's coin prices into earnings per day, or nil when neither an
+// electricity price nor a coin price is known
+func profitability(cfg *config.Config, gpus []collector.GPUStats, cpu *collector.CPUStats, wall *powermeter.Stats) *profitReport {
+	report := &profitReport{PricePerKWh: cfg.ElectricityPrice}
+	tariff, err := exec.Tariff()
+	if err != nil {
+		log.Printf("Profitability: %v", err)
+	}
+	if tariff != nil {
+		report.Currency = tariff.Currency
+		report.PricePerKWh = tariff.PriceAt(time.Now())
+	}
+
+	var price *executor.CoinPrice
+	miner := coll.LastMinerStats()
+	if miner != nil && miner.Running {
+		coin := ""
+		if minerConfig, err := exec.GetConfig(); err == nil {
+			coin = minerConfig.Coin
+		}
+		if price, err = exec.CoinPriceFor(coin, miner.Algorithm); err != nil {
+			log.Printf("Profitability: %v", err)
+		}
+		report.Coin = coin
+	}
+	if report.PricePerKWh == 0 && tariff == nil && price == nil {
+		return nil
+	}
+
+	// Earnings and power cost per day
+	costPerDay := func(watts float64) float64 {
+		return watts / 1000 * 24 * report.PricePerKWh
+	}
+	earnings := func(hashrate, cost float64) (*float64, *float64) {
+		if price == nil {
+			return nil, nil
+		}
+		gross := hashrate * price.Reward * price.Price
+		net := gross - cost
+		return &gross, &net
+	}
+
+	if wall != nil {
+		report.Power, report.PowerSource = wall.TotalWatts, "wall"
+	} else {
+		report.PowerSource = "reported"
+		for _, gpu := range gpus {
+			if gpu.PowerDraw != nil {
+				report.Power += float64(*gpu.PowerDraw)
+			}
+		}
+		if cpu != nil && cpu.PowerDraw != nil {
+			report.Power += float64(*cpu.PowerDraw)
+		}
+	}
+	report.PowerCost = costPerDay(report.Power)
+	hashrate := 0.0
+	if miner != nil && miner.Running {
+		hashrate = miner.Hashrate
+	}
+	report.Gross, report.Net = earnings(hashrate, report.PowerCost)
+
+	// Per GPU, matching the miner's GPUs to the driver's
+	hashrates := map[int]float64{}
+	if miner != nil && miner.Running {
+		for _, minerGPU := range miner.GPUStats {
+			if gpu := collector.MinerGPU(gpus, minerGPU); gpu != nil {
+				hashrates[gpu.Index] = minerGPU.Hashrate
+			}
+		}
+	}
+	for _, gpu := range gpus {
+		share := gpuProfit{Index: gpu.Index, Hashrate: hashrates[gpu.Index]}
+		if gpu.PowerDraw != nil {
+			share.Power = *gpu.PowerDraw
+		}
+		share.PowerCost = costPerDay(float64(share.Power))
+		share.Gross, share.Net = earnings(share.Hashrate, share.PowerCost)
+		report.GPUs = append(report.GPUs, share)
+	}
+	return report
+}
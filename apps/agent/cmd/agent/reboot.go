@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/host"
+
+	"github.com/bloxos/agent/internal/system"
+	"github.com/bloxos/agent/internal/ws"
+)
+
+var (
+	rebootMu      sync.Mutex
+	rebootPending bool // A reboot command is being carried out by this process
+)
+
+// acceptReboot records a reboot command before it is acknowledged, and
+// reports whether to reboot. A command that was already carried out, e.g.
+// redelivered because its result was lost in the reboot, is acknowledged
+// again without rebooting twice.
+func acceptReboot(commandID, method string) (*system.RebootRecord, bool) {
+	rebootMu.Lock()
+	defer rebootMu.Unlock()
+
+	if last := system.LastReboot(); last != nil && commandID != "" && last.CommandID == commandID {
+		return last, false
+	}
+	if rebootPending {
+		return system.LastReboot(), false
+	}
+
+	reboot := &system.RebootRecord{CommandID: commandID, Method: method, RequestedAt: time.Now().Unix()}
+	if err := system.RecordReboot(reboot); err != nil {
+		// Reboot anyway; the server only misses the confirmation
+		log.Printf("Failed to record pending reboot: %v", err)
+	}
+	rebootPending = true
+	return reboot, true
+}
+
+// rebootForCommand reboots after the acknowledgment has gone out. When the
+// rig is still up once every fallback has run, the reboot is reported as
+// failed.
+func rebootForCommand(method string) {
+	time.Sleep(2 * time.Second)
+	rebootRig(method)
+
+	time.Sleep(2 * time.Minute)
+	rebootMu.Lock()
+	rebootPending = false
+	rebootMu.Unlock()
+	reportReboot()
+}
+
+// reportReboot tells the server how the last requested reboot went, once
+// connected: "reboot_completed" with the downtime when the rig booted after
+// the request, "reboot_failed" when it didn't. Unreported outcomes are
+// retried at the next start.
+func reportReboot() {
+	reboot := system.LastReboot()
+	if reboot == nil || reboot.ReportedAt != 0 {
+		return
+	}
+	bootTime, err := host.BootTime()
+	if err != nil {
+		log.Printf("Failed to check the last reboot: %v", err)
+		return
+	}
+
+	for {
+		if wsClient.IsConnected() {
+			if sendRebootReport(reboot, int64(bootTime)) {
+				return
+			}
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
+
+// sendRebootReport sends the reboot's outcome and marks it reported
+func sendRebootReport(reboot *system.RebootRecord, bootTime int64) bool {
+	now := time.Now().Unix()
+	event := &ws.Event{Type: "reboot_completed", Severity: "info"}
+	if bootTime >= reboot.RequestedAt {
+		reboot.BootedAt = bootTime
+		downtime := time.Duration(now-reboot.RequestedAt) * time.Second
+		event.Message = fmt.Sprintf("Reboot completed, back online after %s", downtime)
+	} else {
+		reboot.Failed = true
+		event.Type, event.Severity = "reboot_failed", "warning"
+		event.Message = "Requested reboot did not happen"
+	}
+	event.Data = map[string]interface{}{
+		"commandId":   reboot.CommandID,
+		"method":      reboot.Method,
+		"requestedAt": reboot.RequestedAt,
+		"bootedAt":    reboot.BootedAt,
+		"onlineAt":    now,
+		"downtime":    now - reboot.RequestedAt, // Seconds
+	}
+
+	if err := wsClient.SendEvent(event); err != nil {
+		log.Printf("Failed to send reboot report: %v", err)
+		return false
+	}
+	log.Println(event.Message)
+
+	reboot.ReportedAt = now
+	if err := system.RecordReboot(reboot); err != nil {
+		log.Printf("Failed to record reboot report: %v", err)
+	}
+	return true
+}
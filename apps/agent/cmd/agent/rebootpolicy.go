@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/host"
+
+	"github.com/bloxos/agent/internal/collector"
+	"github.com/bloxos/agent/internal/system"
+	"github.com/bloxos/agent/internal/ws"
+)
+
+// rebootPolicyChanged wakes the reboot scheduler when a new policy is stored
+var rebootPolicyChanged = make(chan struct{}, 1)
+
+// Post-reboot verification: how long the miner gets to come back and the
+// share of the pre-reboot hashrate it must reach
+const (
+	rebootVerifyTimeout  = 15 * time.Minute
+	rebootVerifyHashrate = 0.9
+)
+
+// handleSetRebootPolicy stores the scheduled reboot policy; an empty
+// payload removes it
+func handleSetRebootPolicy(payload interface{}) (bool, interface{}, error) {
+	var policy system.RebootPolicy
+	if payload != nil {
+		if err := decodePayload(payload, &policy); err != nil {
+			return false, nil, err
+		}
+	}
+
+	if err := system.SetRebootPolicy(&policy); err != nil {
+		return false, nil, err
+	}
+
+	select {
+	case rebootPolicyChanged <- struct{}{}:
+	default:
+	}
+
+	if policy.EveryDays == 0 {
+		return true, map[string]interface{}{"enabled": false}, nil
+	}
+	result := map[string]interface{}{"enabled": true}
+	if bootTime, err := host.BootTime(); err == nil {
+		result["nextReboot"] = policy.NextReboot(time.Unix(int64(bootTime), 0)).Unix()
+	}
+	return true, result, nil
+}
+
+// runRebootPolicy reboots the rig in the policy's window once it has been
+// up long enough, waiting for nominal hashrate so a rig that is already
+// struggling isn't rebooted on top of it
+func runRebootPolicy() {
+	attempted := false
+	waiting := false
+	for {
+		policy, err := system.GetRebootPolicy()
+		if err != nil {
+			log.Printf("Reboot policy: %v", err)
+		}
+
+		due := false
+		if policy != nil && !attempted {
+			if bootTime, err := host.BootTime(); err == nil {
+				due = policy.Due(time.Unix(int64(bootTime), 0), time.Now())
+			}
+		}
+
+		switch {
+		case due && (osUpdating.Load() || driverInstalling.Load()):
+			// The update reboots the rig itself
+		case due && nominalHashrate(coll.DetectRunningMiner(), policy):
+			waitForDAGEpoch("the scheduled reboot")
+			attempted = true
+			scheduledReboot()
+		case due:
+			if !waiting {
+				log.Println("Scheduled reboot due, waiting for nominal hashrate")
+				waiting = true
+			}
+		case waiting:
+			waiting = false
+			sendRebootEvent("warning", "Scheduled reboot skipped: hashrate was not nominal during the reboot window",
+				map[string]interface{}{"stage": "skipped"})
+		}
+
+		select {
+		case <-time.After(time.Minute):
+		case <-rebootPolicyChanged:
+			attempted = false
+		}
+	}
+}
+
+// nominalHashrate reports whether the miner runs at the policy's minimum
+// hashrate, or near what the benchmarks expect, or with every GPU hashing
+// when neither is known
+func nominalHashrate(stats *collector.MinerStats, policy *system.RebootPolicy) bool {
+	if stats == nil || !stats.Running || stats.Hashrate <= 0 {
+		return false
+	}
+	if policy.MinHashrate > 0 {
+		return stats.Hashrate >= policy.MinHashrate
+	}
+	if expected, ok := expectedHashrate(stats); ok {
+		return stats.Hashrate >= expected*rebootVerifyHashrate
+	}
+	for _, gpu := range stats.GPUStats {
+		if gpu.Hashrate <= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// scheduledReboot records the miner state, stops the miner and reboots
+func scheduledReboot() {
+	reboot := &system.ScheduledReboot{RequestedAt: time.Now().Unix()}
+	if uptime, err := host.Uptime(); err == nil {
+		reboot.Uptime = uptime
+	}
+	if stats := coll.LastMinerStats(); stats != nil {
+		reboot.Miner = stats.Name
+		reboot.Hashrate = stats.Hashrate
+	}
+
+	if err := system.RecordScheduledReboot(reboot); err != nil {
+		log.Printf("Failed to record scheduled reboot: %v", err)
+	}
+	sendRebootEvent("info", fmt.Sprintf("Scheduled reboot after %.1f days up", float64(reboot.Uptime)/86400),
+		map[string]interface{}{"stage": "rebooting", "reboot": reboot})
+
+	serialized(func() {
+		if err := exec.StopMiner(); err != nil {
+			log.Printf("Failed to stop miner: %v", err)
+		}
+	})
+	rebootRig("soft")
+}
+
+// verifyScheduledReboot checks that mining came back after a policy reboot
+func verifyScheduledReboot() {
+	reboot := system.TakeScheduledReboot()
+	if reboot == nil {
+		return
+	}
+
+	var stats *collector.MinerStats
+	recovered := false
+	for deadline := time.Now().Add(rebootVerifyTimeout); time.Now().Before(deadline); time.Sleep(30 * time.Second) {
+		stats = coll.DetectRunningMiner()
+		if stats != nil && stats.Running && stats.Hashrate > 0 &&
+			stats.Hashrate >= reboot.Hashrate*rebootVerifyHashrate {
+			recovered = true
+			break
+		}
+	}
+
+	data := map[string]interface{}{"stage": "verified", "reboot": reboot}
+	if stats != nil {
+		data["hashrate"] = stats.Hashrate
+	}
+	severity, message := "info", "Scheduled reboot completed, hashrate recovered"
+	if !recovered {
+		data["stage"] = "degraded"
+		severity = "warning"
+		message = fmt.Sprintf("Hashrate did not recover within %s of the scheduled reboot", rebootVerifyTimeout)
+	}
+
+	for i := 0; i < 60 && !wsClient.AnyConnected(); i++ {
+		time.Sleep(time.Second)
+	}
+	sendRebootEvent(severity, message, data)
+}
+
+// sendRebootEvent logs and reports a scheduled reboot step
+func sendRebootEvent(severity, message string, data interface{}) {
+	log.Println(message)
+	if !wsClient.AnyConnected() {
+		return
+	}
+	event := &ws.Event{
+		Type:     "scheduled_reboot",
+		Severity: severity,
+		Message:  message,
+		Data:     data,
+	}
+	if err := wsClient.SendEvent(event); err != nil {
+		log.Printf("Failed to send scheduled reboot event: %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import "github.com/bloxos/agent/internal/ws"
+
+// commandScopes is the token scope each command needs when the server
+// limits the token (see ws.Client.SetCommandScopes). Commands missing here
+// need ws.ScopeSystem, so a new command is locked down until listed.
+var commandScopes = map[string]string{
+	// Reporting only
+	"validate_miner_config": ws.ScopeRead,
+	"list_miners":           ws.ScopeRead,
+	"list_coin_presets":     ws.ScopeRead,
+	"get_inventory":         ws.ScopeRead,
+	"wifi_scan":             ws.ScopeRead,
+	"list_gpu_processes":    ws.ScopeRead,
+	"apt_update":            ws.ScopeRead,
+	"speed_test":            ws.ScopeRead,
+	"project_hashrate":      ws.ScopeRead,
+	"describe_commands":     ws.ScopeRead,
+
+	// Mining and tuning
+	"start_miner":        ws.ScopeMiner,
+	"stop_miner":         ws.ScopeMiner,
+	"restart_miner":      ws.ScopeMiner,
+	"pause_miner":        ws.ScopeMiner,
+	"resume_miner":       ws.ScopeMiner,
+	"mine":               ws.ScopeMiner,
+	"install_miner":      ws.ScopeMiner,
+	"uninstall_miner":    ws.ScopeMiner,
+	"apply_oc":           ws.ScopeMiner,
+	"sync_oc_presets":    ws.ScopeMiner,
+	"sync_coin_presets":  ws.ScopeMiner,
+	"apply_oc_profile":   ws.ScopeMiner,
+	"set_oc_schedule":    ws.ScopeMiner,
+	"import_hiveos":      ws.ScopeMiner,
+	"set_leds":           ws.ScopeMiner,
+	"set_fans":           ws.ScopeMiner,
+	"set_thermal_target": ws.ScopeMiner,
+	"power_save":         ws.ScopeMiner,
+	"park_gpus":          ws.ScopeMiner,
+	"unpark_gpus":        ws.ScopeMiner,
+	"disable_gpu":        ws.ScopeMiner,
+	"enable_gpu":         ws.ScopeMiner,
+	"set_stats_filter":   ws.ScopeMiner,
+	"set_tags":           ws.ScopeMiner,
+	"sync_benchmarks":    ws.ScopeMiner,
+	"set_playbooks":      ws.ScopeMiner,
+	"reset_recovery":     ws.ScopeMiner,
+	"set_tariff":         ws.ScopeMiner,
+	"sync_coin_prices":   ws.ScopeMiner,
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bloxos/agent/internal/system"
+)
+
+// maxInlineScreenshot is the largest PNG returned in the command result;
+// bigger ones need an upload URL
+const maxInlineScreenshot = 2 << 20
+
+// handleCaptureScreen captures the console text and a framebuffer
+// screenshot, so a rig that looks frozen can be checked for a kernel panic
+// or oops on screen. The PNG is PUT to uploadUrl when given (e.g. a
+// pre-signed URL), otherwise returned base64-encoded.
+func handleCaptureScreen(payload interface{}) (bool, interface{}, error) {
+	var req struct {
+		Source    string `json:"source"` // "all" (default), "console" or "framebuffer"
+		UploadURL string `json:"uploadUrl"`
+	}
+	if payload != nil {
+		if err := decodePayload(payload, &req); err != nil {
+			return false, nil, err
+		}
+	}
+	switch req.Source {
+	case "":
+		req.Source = "all"
+	case "all", "console", "framebuffer":
+	default:
+		return false, nil, fmt.Errorf("invalid source %q (use all, console or framebuffer)", req.Source)
+	}
+
+	result := map[string]interface{}{"capturedAt": time.Now().Unix()}
+	var errs []string
+
+	if req.Source != "framebuffer" {
+		console, err := system.CaptureConsole()
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("console: %v", err))
+		} else {
+			result["console"] = console
+		}
+	}
+
+	if req.Source != "console" {
+		screen, err := system.CaptureFramebuffer()
+		if err == nil {
+			info := map[string]interface{}{
+				"device": screen.Device,
+				"width":  screen.Width,
+				"height": screen.Height,
+				"size":   len(screen.PNG),
+				"format": "png",
+			}
+			switch {
+			case req.UploadURL != "":
+				if err = uploadScreenshot(req.UploadURL, screen.PNG); err == nil {
+					info["uploaded"] = true
+				}
+			case len(screen.PNG) > maxInlineScreenshot:
+				err = fmt.Errorf("screenshot is %d bytes, send an uploadUrl", len(screen.PNG))
+			default:
+				info["data"] = base64.StdEncoding.EncodeToString(screen.PNG)
+			}
+			result["framebuffer"] = info
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("framebuffer: %v", err))
+		}
+	}
+
+	if len(errs) > 0 {
+		result["errors"] = errs
+	}
+	_, hasConsole := result["console"]
+	_, hasScreen := result["framebuffer"]
+	if !hasConsole && !hasScreen {
+		return false, result, fmt.Errorf("screen capture failed: %v", errs)
+	}
+
+	log.Printf("Screen captured (%s)", req.Source)
+	return true, result, nil
+}
+
+// uploadScreenshot PUTs the PNG to the given URL
+func uploadScreenshot(url string, data []byte) error {
+	httpReq, err := http.NewRequest(http.MethodPut, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "image/png")
+
+	client := &http.Client{Timeout: time.Minute}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("upload failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("upload failed: status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/bloxos/agent/internal/installer"
+)
+
+// commandSelector narrows a command broadcast to a group of rigs: the
+// server sends the same command to every rig and only the rigs matching
+// all of the given conditions act on it. Lists match any of their entries.
+type commandSelector struct {
+	Vendors         []string          `json:"vendors"`         // GPU vendors, any of which must be present ("nvidia", "amd")
+	Tags            map[string]string `json:"tags"`            // Tags that must be set to these values ("*" = set to anything)
+	MinersInstalled []string          `json:"minersInstalled"` // Miners, any of which must be installed
+}
+
+// selectorFields are the conditions this agent evaluates, sent at auth so
+// the server only broadcasts to agents that won't ignore the selector
+const selectorFields = "vendors,tags,minersInstalled"
+
+// matchSelector evaluates the "selector" of a command payload. It returns
+// the reason a rig is left out, or "" when it matches or the payload has
+// no selector.
+func matchSelector(payload interface{}) (string, error) {
+	fields, ok := payload.(map[string]interface{})
+	if !ok || fields["selector"] == nil {
+		return "", nil
+	}
+	var selector commandSelector
+	if err := decodePayload(fields["selector"], &selector); err != nil {
+		return "", fmt.Errorf("invalid selector: %w", err)
+	}
+
+	if len(selector.Vendors) > 0 {
+		drivers := installer.DetectDrivers()
+		present := map[string]bool{"nvidia": drivers.NvidiaGPUs, "amd": drivers.AMDGPUs}
+		if !anyOf(selector.Vendors, func(vendor string) bool { return present[strings.ToLower(vendor)] }) {
+			return fmt.Sprintf("no %s GPU", strings.Join(selector.Vendors, " or ")), nil
+		}
+	}
+
+	if len(selector.Tags) > 0 {
+		rigTagsMu.Lock()
+		tags := rigTags
+		rigTagsMu.Unlock()
+
+		var keys []string
+		for key := range selector.Tags {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			want := selector.Tags[key]
+			value, ok := tags[strings.ToLower(key)]
+			if !ok {
+				return fmt.Sprintf("tag %s is not set", key), nil
+			}
+			if want != "*" && !strings.EqualFold(value, want) {
+				return fmt.Sprintf("tag %s is %s, not %s", key, value, want), nil
+			}
+		}
+	}
+
+	if len(selector.MinersInstalled) > 0 {
+		installed, err := inst.ListInstalled()
+		if err != nil {
+			return "", fmt.Errorf("failed to list installed miners: %w", err)
+		}
+		if !anyOf(selector.MinersInstalled, func(miner string) bool { return contains(installed, strings.ToLower(miner)) }) {
+			return fmt.Sprintf("%s not installed", strings.Join(selector.MinersInstalled, " or ")), nil
+		}
+	}
+	return "", nil
+}
+
+// checkSelector reports whether a broadcast command is meant for this rig,
+// with the result to send back when it is not
+func checkSelector(cmd string, payload interface{}) (bool, interface{}, error) {
+	reason, err := matchSelector(payload)
+	if err != nil {
+		return false, nil, err
+	}
+	if reason == "" {
+		return true, nil, nil
+	}
+	log.Printf("Skipping %s: selector does not match (%s)", cmd, reason)
+	return false, map[string]interface{}{"skipped": true, "reason": reason}, nil
+}
+
+func anyOf(values []string, match func(string) bool) bool {
+	for _, value := range values {
+		if match(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/bloxos/agent/internal/collector"
+	"github.com/bloxos/agent/internal/config"
+	"github.com/bloxos/agent/internal/system"
+	"github.com/bloxos/agent/internal/ws"
+)
+
+// ExtraServer is an additional server connection with its own token
+type ExtraServer struct {
+	URL   string `json:"url"`
+	Token string `json:"token"`
+	Scope string `json:"scope"` // "stats" (default) or "full"
+}
+
+// extraClients are the connections to -extra-servers
+var extraClients []*ws.Client
+
+// The stats and miner status last sent to the primary server, by message
+// type. A server that connects gets these instead of a fresh collection,
+// which would take the GPU samples and alerts meant for the next interval.
+var (
+	lastPayloadsMu sync.Mutex
+	lastPayloads   = map[string]interface{}{}
+)
+
+// rememberPayload records a payload sent to the primary server
+func rememberPayload(msgType string, data interface{}) {
+	lastPayloadsMu.Lock()
+	lastPayloads[msgType] = data
+	lastPayloadsMu.Unlock()
+}
+
+// replayPayloads sends the last stats and miner status to a server that
+// just connected
+func replayPayloads(client *ws.Client) {
+	lastPayloadsMu.Lock()
+	stats, status := lastPayloads[ws.TypeStats], lastPayloads[ws.TypeMinerStatus]
+	lastPayloadsMu.Unlock()
+
+	if stats != nil {
+		if err := client.SendStats(stats); err != nil {
+			log.Printf("Failed to send stats: %v", err)
+		}
+	}
+	if status != nil {
+		if err := client.SendMinerStatus(status); err != nil {
+			log.Printf("Failed to send miner status: %v", err)
+		}
+	}
+}
+
+// setAuthInfo updates an identity value on every server connection
+func setAuthInfo(key, value string) {
+	wsClient.SetAuthInfo(key, value)
+	for _, client := range extraClients {
+		client.SetAuthInfo(key, value)
+	}
+}
+
+// connectExtraServers connects to the additional servers and mirrors the
+// primary connection's telemetry to them. Full-scope servers may also send
+// commands.
+func connectExtraServers(cfg *config.Config, coll *collector.Collector, hostname string) error {
+	if cfg.ExtraServers == "" {
+		return nil
+	}
+
+	var servers []ExtraServer
+	if err := json.Unmarshal([]byte(cfg.ExtraServers), &servers); err != nil {
+		return fmt.Errorf("invalid extra servers: %w", err)
+	}
+
+	for _, server := range servers {
+		if server.URL == "" || server.Token == "" {
+			return fmt.Errorf("extra server needs url and token")
+		}
+		switch server.Scope {
+		case "":
+			server.Scope = ws.ScopeStats
+		case ws.ScopeStats, ws.ScopeFull:
+		default:
+			return fmt.Errorf("invalid scope %q for %s (use stats or full)", server.Scope, server.URL)
+		}
+
+		client := ws.NewClient(server.URL, server.Token, cfg.Debug)
+		client.SetScope(server.Scope)
+		client.SetAuthInfo("hostname", hostname)
+		client.SetAuthInfo("agentVersion", version)
+		client.SetAuthInfo("image", imageAuthInfo())
+		client.SetAuthInfo("selectors", selectorFields)
+		client.SetAuthInfo("instanceId", instanceID)
+		client.SetAuthInfo("timezone", system.Timezone())
+		client.SetOutboundLimits(cfg.MaxMessageRate, time.Duration(cfg.BatchWindow)*time.Millisecond)
+		client.SetKeepalive(ws.Keepalive{Heartbeat: cfg.HeartbeatInterval, TCPKeepAlive: cfg.TCPKeepAlive, HandshakeTimeout: cfg.HandshakeTimeout})
+		client.SetHeartbeatData(heartbeatHealth)
+		client.SetCommandScopes(commandScopes)
+		rigTagsMu.Lock()
+		if data, err := json.Marshal(rigTags); err == nil {
+			client.SetAuthInfo("tags", string(data))
+		}
+		rigTagsMu.Unlock()
+		if dnsResolver != nil {
+			client.SetDialer(dnsResolver.DialContext)
+		}
+		client.SetCommandHandler(func(cmd *ws.Command) (bool, interface{}, error) {
+			return handleCommand(cmd, cfg)
+		})
+
+		url := server.URL
+		client.SetConnectHandler(func() {
+			log.Printf("Connected to %s", url)
+			replayPayloads(client)
+		})
+		client.SetDisconnectHandler(func() {
+			log.Printf("Disconnected from %s", url)
+		})
+
+		log.Printf("Connecting to %s (%s)...", server.URL, server.Scope)
+		if err := client.Connect(); err != nil {
+			return err
+		}
+		wsClient.AddMirror(client)
+		extraClients = append(extraClients, client)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// serviceName is the systemd unit and Windows service the agent
+	// installs itself as
+	serviceName        = "bloxos-agent"
+	serviceDisplayName = "BloxOs Mining Rig Agent"
+)
+
+// runServiceCommand installs or removes the agent as a system service that
+// starts at boot and restarts when it dies:
+//
+//	agent install-service [-server URL] [-token TOKEN] [flags...]
+//	agent uninstall-service
+//
+// Flags after install-service are passed to the agent at every start.
+func runServiceCommand(command string, args []string) {
+	var err error
+	switch command {
+	case "install-service":
+		var exe string
+		if exe, err = serviceExecutable(); err == nil {
+			err = installService(exe, args)
+		}
+	case "uninstall-service":
+		err = uninstallService()
+	}
+	if err != nil {
+		log.Fatalf("Failed to %s: %v", command, err)
+	}
+	fmt.Printf("Done: %s %s\n", command, serviceName)
+}
+
+// serviceExecutable is the absolute path of this binary, which the service
+// runs
+func serviceExecutable() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	return filepath.Abs(exe)
+}
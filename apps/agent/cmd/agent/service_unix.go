@@ -0,0 +1,94 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bloxos/agent/internal/config"
+)
+
+// systemdUnit matches bloxos-agent.service from the installer, running
+// this binary with the given arguments
+const systemdUnit = `[Unit]
+Description=%s
+After=network.target
+
+[Service]
+Type=simple
+User=root
+EnvironmentFile=-/etc/bloxos/agent.env
+ExecStart=%s
+Restart=always
+RestartSec=10
+# Let the miner outlive agent restarts (see -miner-on-exit)
+KillMode=process
+
+[Install]
+WantedBy=multi-user.target
+`
+
+func unitPath() string {
+	return filepath.Join("/etc/systemd/system", serviceName+".service")
+}
+
+// installService writes the systemd unit, then enables and starts it
+func installService(exe string, args []string) error {
+	// The token and passwords go to the encrypted store, not the unit
+	args, err := config.StoreSecretFlags(args)
+	if err != nil {
+		return err
+	}
+
+	command := []string{strconv.Quote(exe)}
+	for _, arg := range args {
+		command = append(command, strconv.Quote(arg))
+	}
+	unit := fmt.Sprintf(systemdUnit, serviceDisplayName, strings.Join(command, " "))
+
+	// Other flags may carry tokens too (-extra-servers); keep the unit
+	// private then
+	mode := os.FileMode(0644)
+	if len(args) > 0 {
+		mode = 0600
+	}
+	if err := os.WriteFile(unitPath(), []byte(unit), mode); err != nil {
+		return err
+	}
+	if err := systemctl("daemon-reload"); err != nil {
+		return err
+	}
+	return systemctl("enable", "--now", serviceName)
+}
+
+// uninstallService stops and removes the systemd unit
+func uninstallService() error {
+	if _, err := os.Stat(unitPath()); os.IsNotExist(err) {
+		return fmt.Errorf("%s is not installed", unitPath())
+	}
+	systemctl("disable", "--now", serviceName)
+	if err := os.Remove(unitPath()); err != nil {
+		return err
+	}
+	return systemctl("daemon-reload")
+}
+
+func systemctl(args ...string) error {
+	output, err := osexec.Command("systemctl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("systemctl %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// startService does nothing outside Windows; systemd stops the agent with
+// SIGTERM
+func startService(stop chan<- os.Signal) {}
+
+// stopService does nothing outside Windows
+func stopService() {}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+var (
+	serviceExited  = make(chan struct{}) // Closed once the agent has shut down
+	serviceRunning sync.WaitGroup
+)
+
+// installService registers the agent to start at boot and restart when it
+// dies, like the systemd unit, and registers its event log source
+func installService(exe string, args []string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	if s, err := m.OpenService(serviceName); err == nil {
+		s.Close()
+		return fmt.Errorf("%s is already installed (uninstall-service first)", serviceName)
+	}
+	s, err := m.CreateService(serviceName, exe, mgr.Config{
+		DisplayName:      serviceDisplayName,
+		Description:      "Reports rig stats to the BloxOs server and runs its commands",
+		StartType:        mgr.StartAutomatic,
+		DelayedAutoStart: true, // Once the network is up
+	}, args...)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	// Restart after 10 seconds, also after a clean exit with an error code
+	restart := mgr.RecoveryAction{Type: mgr.ServiceRestart, Delay: 10 * time.Second}
+	if err := s.SetRecoveryActions([]mgr.RecoveryAction{restart, restart, restart}, uint32((24 * time.Hour).Seconds())); err != nil {
+		s.Delete()
+		return fmt.Errorf("failed to set restart policy: %w", err)
+	}
+	if err := s.SetRecoveryActionsOnNonCrashFailures(true); err != nil {
+		s.Delete()
+		return fmt.Errorf("failed to set restart policy: %w", err)
+	}
+
+	if err := eventlog.InstallAsEventCreate(serviceName, eventlog.Error|eventlog.Warning|eventlog.Info); err != nil &&
+		!strings.Contains(err.Error(), "exists") { // Left by an earlier install
+		s.Delete()
+		return fmt.Errorf("failed to register event log source: %w", err)
+	}
+	return s.Start()
+}
+
+// uninstallService stops the service and removes it and its event log
+// source
+func uninstallService() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("%s is not installed", serviceName)
+	}
+	defer s.Close()
+
+	if status, err := s.Control(svc.Stop); err == nil {
+		for deadline := time.Now().Add(30 * time.Second); status.State != svc.Stopped && time.Now().Before(deadline); {
+			time.Sleep(500 * time.Millisecond)
+			if status, err = s.Query(); err != nil {
+				break
+			}
+		}
+	}
+	if err := s.Delete(); err != nil {
+		return err
+	}
+	eventlog.Remove(serviceName)
+	return nil
+}
+
+// startService reports to the service manager when Windows started the
+// agent as a service: stop requests arrive on stop, like SIGTERM under
+// systemd, and the log goes to the event log
+func startService(stop chan<- os.Signal) {
+	if isService, err := svc.IsWindowsService(); err != nil || !isService {
+		return
+	}
+	if events, err := eventlog.Open(serviceName); err == nil {
+		log.SetOutput(eventLogWriter{events})
+		log.SetFlags(0) // Entries are timestamped
+	}
+
+	serviceRunning.Add(1)
+	go func() {
+		defer serviceRunning.Done()
+		if err := svc.Run(serviceName, &agentService{stop: stop}); err != nil {
+			log.Printf("Service failed: %v", err)
+		}
+	}()
+}
+
+// stopService tells the service manager the agent has stopped. Exiting
+// before that counts as a crash, which restarts the service.
+func stopService() {
+	close(serviceExited)
+	serviceRunning.Wait()
+}
+
+// agentService answers the service manager
+type agentService struct {
+	stop chan<- os.Signal
+}
+
+func (s *agentService) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				status <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending, WaitHint: 30000}
+				select {
+				case s.stop <- os.Interrupt:
+				default: // Already shutting down
+				}
+			}
+		case <-serviceExited:
+			return false, 0
+		}
+	}
+}
+
+// eventLogWriter sends each log line to the Windows event log
+type eventLogWriter struct {
+	events *eventlog.Log
+}
+
+func (w eventLogWriter) Write(p []byte) (int, error) {
+	message := strings.TrimSpace(string(p))
+	var err error
+	switch lower := strings.ToLower(message); {
+	case strings.Contains(lower, "fatal") || strings.Contains(lower, "panic"):
+		err = w.events.Error(1, message)
+	case strings.Contains(lower, "failed") || strings.Contains(lower, "error"):
+		err = w.events.Warning(1, message)
+	default:
+		err = w.events.Info(1, message)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
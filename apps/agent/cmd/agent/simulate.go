@@ -0,0 +1,129 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/bloxos/agent/internal/collector"
+	"github.com/bloxos/agent/internal/config"
+	"github.com/bloxos/agent/internal/executor"
+	"github.com/bloxos/agent/internal/installer"
+	"github.com/bloxos/agent/internal/platform"
+	"github.com/bloxos/agent/internal/simulate"
+	"github.com/bloxos/agent/internal/ws"
+)
+
+// runSimulate runs the agent against the built-in fake server with fake
+// GPUs and miners, and exits non-zero when a scripted step fails:
+//
+//	agent simulate [-gpus N] [-script steps.json] [-timeout 5m] [-debug]
+func runSimulate(args []string) {
+	flags := flag.NewFlagSet("simulate", flag.ExitOnError)
+	gpus := flags.Int("gpus", 2, "Number of fake GPUs")
+	script := flags.String("script", "", "JSON file of command steps (default: built-in script)")
+	timeout := flags.Duration("timeout", 5*time.Minute, "Give up when the script takes longer")
+	interval := flags.Int("interval", 5, "Stats interval in seconds")
+	debug := flags.Bool("debug", false, "Log every message")
+	flags.Parse(args)
+
+	steps := simulate.DefaultScript()
+	if *script != "" {
+		var err error
+		if steps, err = simulate.LoadScript(*script); err != nil {
+			log.Fatalf("Simulate: %v", err)
+		}
+	}
+
+	sandbox, err := simulate.Setup(*gpus)
+	if err != nil {
+		log.Fatalf("Simulate: %v", err)
+	}
+	defer sandbox.Cleanup()
+	log.Printf("Simulating %d GPUs in %s", sandbox.GPUs, sandbox.Dir)
+
+	cfg := config.DefaultConfig()
+	cfg.ServerURL = "http://simulator"
+	cfg.Token = "simulate"
+	cfg.PollInterval = *interval
+	cfg.Debug = *debug
+	cfg.IPMIEnabled = false
+	cfg.DNSFallback = false
+	cfg.MinerOnExit = executor.MinerExitStop
+
+	// HOME now points into the sandbox, so state and miners stay there
+	coll = collector.NewWithPlatform(platform.Host, sandbox.FS())
+	exec = executor.NewWithPlatform(cfg.Debug, platform.Host, sandbox.FS())
+	inst = installer.New(cfg.Debug)
+	inst.SetDryRun(true)
+	coll.SetMinerAPIs(minerEndpoints)
+	coll.SetOutputMiners(outputMiners)
+
+	// The fake miners find the sandbox through the environment
+	exec.SetMinerEnv(cfg.MinerEnv, []string{simulate.EnvSandbox, simulate.EnvGPUs})
+	exec.SetMinerAPIAccess(cfg.MinerAPIAuth, "")
+
+	server := simulate.NewServer(steps, cfg.Debug)
+	wsClient = ws.NewClient(cfg.ServerURL, cfg.Token, cfg.Debug)
+	wsClient.SetTransport(server.Transport())
+	wsClient.SetOutboundLimits(cfg.MaxMessageRate, time.Duration(cfg.BatchWindow)*time.Millisecond)
+	wsClient.SetHeartbeatData(heartbeatHealth)
+	wsClient.SetCommandScopes(commandScopes)
+	wsClient.SetCommandHandler(func(cmd *ws.Command) (bool, interface{}, error) {
+		return handleCommand(cmd, cfg)
+	})
+	wsClient.SetConnectHandler(func() {
+		sendStats(wsClient, coll, cfg)
+		sendMinerStatus(wsClient, coll)
+	})
+	if err := wsClient.Connect(); err != nil {
+		log.Fatalf("Simulate: %v", err)
+	}
+	go runPauseTimer(wsClient)
+	loadPlaybooks()
+	exec.SetSafeMode(safeModeActive())
+	go runPlaybooks(wsClient)
+
+	statsTick := time.NewTicker(time.Duration(cfg.PollInterval) * time.Second)
+	defer statsTick.Stop()
+	deadline := time.After(*timeout)
+
+	timedOut := false
+loop:
+	for {
+		select {
+		case <-statsTick.C:
+			if wsClient.IsConnected() {
+				sendStats(wsClient, coll, cfg)
+				sendMinerStatus(wsClient, coll)
+			}
+		case <-server.Done():
+			break loop
+		case <-deadline:
+			timedOut = true
+			break loop
+		}
+	}
+
+	if err := exec.StopMiner(); err != nil {
+		log.Printf("Failed to stop miner: %v", err)
+	}
+	wsClient.Close()
+
+	fmt.Println(server.Summary())
+	failures := server.Failures()
+	if timedOut {
+		failures = append(failures, fmt.Sprintf("timed out after %v", *timeout))
+	}
+	if len(failures) > 0 {
+		fmt.Println("FAILED:")
+		for _, failure := range failures {
+			fmt.Printf("  %s\n", failure)
+		}
+		sandbox.Cleanup()
+		os.Exit(1)
+	}
+	fmt.Println("PASSED")
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/bloxos/agent/internal/executor"
+	"github.com/bloxos/agent/internal/ws"
+)
+
+// stageNames are the staggered operations as shown to the user
+var stageNames = map[string]string{
+	"miner_start": "Starting miners",
+	"oc":          "Applying OC",
+}
+
+// reportStageProgress sends each step of a staggered miner start or OC
+// application, so the dashboard can show how far along it is
+func reportStageProgress(progress executor.StageProgress) {
+	message := fmt.Sprintf("%s %d/%d: %s", stageNames[progress.Operation], progress.Step, progress.Total, progress.Target)
+	log.Println(message)
+	if wsClient == nil || !wsClient.AnyConnected() {
+		return
+	}
+	event := &ws.Event{
+		Type:     "staged_progress",
+		Severity: "info",
+		Message:  message,
+		Data:     progress,
+	}
+	if err := wsClient.SendEvent(event); err != nil {
+		log.Printf("Failed to send progress event: %v", err)
+	}
+}
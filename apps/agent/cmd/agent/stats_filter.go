@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bloxos/agent/internal/config"
+)
+
+// StatsFilter selects which stats groups and fields are sent and how often,
+// so large farms can send only what they use
+type StatsFilter struct {
+	Skip      []string       `json:"skip,omitempty"`      // Groups never sent, e.g. "cpu", "network"
+	Intervals map[string]int `json:"intervals,omitempty"` // Minimum seconds between sends per group
+	Exclude   []string       `json:"exclude,omitempty"`   // "group.field" paths, e.g. "gpus.coreClock"
+}
+
+// statsFilterState is the active filter and when each group was last sent
+type statsFilterState struct {
+	mu       sync.Mutex
+	filter   *StatsFilter
+	lastSent map[string]time.Time
+}
+
+var statsFilter = &statsFilterState{lastSent: map[string]time.Time{}}
+
+// statsFilterPath is where a server-pushed filter is kept; it takes
+// precedence over -stats-filter
+func statsFilterPath() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".bloxos", "stats_filter.json")
+}
+
+// loadStatsFilter activates the stored server filter or the configured one
+func loadStatsFilter(cfg *config.Config) error {
+	raw := []byte(cfg.StatsFilter)
+	if data, err := os.ReadFile(statsFilterPath()); err == nil {
+		raw = data
+	}
+	if len(raw) == 0 {
+		return nil
+	}
+
+	var filter StatsFilter
+	if err := json.Unmarshal(raw, &filter); err != nil {
+		return fmt.Errorf("invalid stats filter: %w", err)
+	}
+	statsFilter.set(&filter)
+	return nil
+}
+
+func (s *statsFilterState) set(filter *StatsFilter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.filter = filter
+	s.lastSent = map[string]time.Time{}
+}
+
+// apply removes skipped groups, groups sent within their interval and
+// excluded fields from a stats payload
+func (s *statsFilterState) apply(stats map[string]interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	filter := s.filter
+	if filter == nil {
+		return
+	}
+
+	for _, group := range filter.Skip {
+		delete(stats, group)
+	}
+
+	now := time.Now()
+	for group := range stats {
+		interval, ok := filter.Intervals[group]
+		if !ok {
+			continue
+		}
+		if now.Sub(s.lastSent[group]) < time.Duration(interval)*time.Second {
+			delete(stats, group)
+			continue
+		}
+		s.lastSent[group] = now
+	}
+
+	excluded := map[string][]string{}
+	for _, path := range filter.Exclude {
+		if group, field, ok := strings.Cut(path, "."); ok {
+			excluded[group] = append(excluded[group], field)
+		}
+	}
+	for group, fields := range excluded {
+		value, ok := stats[group]
+		if !ok {
+			continue
+		}
+		stats[group] = dropFields(value, fields)
+	}
+}
+
+// dropFields removes fields from an object or from each object of an
+// array, going through JSON so typed stats structs are handled too
+func dropFields(value interface{}, fields []string) interface{} {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return value
+	}
+
+	drop := func(v interface{}) {
+		if obj, ok := v.(map[string]interface{}); ok {
+			for _, field := range fields {
+				delete(obj, field)
+			}
+		}
+	}
+	if list, ok := generic.([]interface{}); ok {
+		for _, item := range list {
+			drop(item)
+		}
+	} else {
+		drop(generic)
+	}
+	return generic
+}
+
+// handleSetStatsFilter stores a stats filter pushed by the server. An
+// empty filter reverts to the configured one.
+func handleSetStatsFilter(payload interface{}, cfg *config.Config) (bool, interface{}, error) {
+	var filter StatsFilter
+	if payload != nil {
+		if err := decodePayload(payload, &filter); err != nil {
+			return false, nil, err
+		}
+	}
+
+	path := statsFilterPath()
+	if len(filter.Skip) == 0 && len(filter.Intervals) == 0 && len(filter.Exclude) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return false, nil, err
+		}
+		statsFilter.set(nil)
+		if err := loadStatsFilter(cfg); err != nil {
+			return false, nil, err
+		}
+		return true, nil, nil
+	}
+
+	for group, interval := range filter.Intervals {
+		if interval < 0 {
+			return false, nil, fmt.Errorf("interval for %s must not be negative", group)
+		}
+	}
+
+	data, err := json.Marshal(filter)
+	if err != nil {
+		return false, nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return false, nil, err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return false, nil, fmt.Errorf("failed to save stats filter: %w", err)
+	}
+
+	statsFilter.set(&filter)
+	return true, filter, nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/bloxos/agent/internal/config"
+)
+
+// tagKey limits tag names to simple identifiers (location, rack, owner,
+// power_circuit, ...)
+var tagKey = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,63}$`)
+
+// rigTags are the labels the server groups rigs by
+var (
+	rigTagsMu sync.Mutex
+	rigTags   map[string]string
+)
+
+// tagsPath is where server-set tags are kept; they replace -tags
+func tagsPath() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".bloxos", "tags.json")
+}
+
+// loadTags activates the stored server tags or the configured ones and
+// adds them to the identity sent at auth
+func loadTags(cfg *config.Config) error {
+	tags, err := parseTags(cfg.Tags)
+	if err != nil {
+		return err
+	}
+	if data, err := os.ReadFile(tagsPath()); err == nil {
+		tags = map[string]string{}
+		if err := json.Unmarshal(data, &tags); err != nil {
+			return fmt.Errorf("invalid %s: %w", tagsPath(), err)
+		}
+	}
+
+	rigTagsMu.Lock()
+	defer rigTagsMu.Unlock()
+	rigTags = tags
+	publishTags(tags)
+	return nil
+}
+
+// parseTags parses "key=value,key=value"
+func parseTags(spec string) (map[string]string, error) {
+	tags := map[string]string{}
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid tag %q (use key=value)", pair)
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		if !tagKey.MatchString(key) {
+			return nil, fmt.Errorf("invalid tag name %q", key)
+		}
+		tags[key] = strings.TrimSpace(value)
+	}
+	return tags, nil
+}
+
+// publishTags sends the tags as JSON with the next authentication
+func publishTags(tags map[string]string) {
+	data, _ := json.Marshal(tags)
+	setAuthInfo("tags", string(data))
+}
+
+// handleSetTags updates the rig tags. Tags are merged unless replace is
+// set; an empty value removes a tag.
+func handleSetTags(payload interface{}) (bool, interface{}, error) {
+	var req struct {
+		Tags    map[string]string `json:"tags"`
+		Replace bool              `json:"replace"`
+	}
+	if err := decodePayload(payload, &req); err != nil {
+		return false, nil, err
+	}
+
+	rigTagsMu.Lock()
+	defer rigTagsMu.Unlock()
+
+	tags := map[string]string{}
+	if !req.Replace {
+		for key, value := range rigTags {
+			tags[key] = value
+		}
+	}
+	for key, value := range req.Tags {
+		key = strings.ToLower(strings.TrimSpace(key))
+		if !tagKey.MatchString(key) {
+			return false, nil, fmt.Errorf("invalid tag name %q", key)
+		}
+		if value = strings.TrimSpace(value); value == "" {
+			delete(tags, key)
+			continue
+		}
+		tags[key] = value
+	}
+
+	data, err := json.Marshal(tags)
+	if err != nil {
+		return false, nil, err
+	}
+	path := tagsPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return false, nil, err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return false, nil, fmt.Errorf("failed to save tags: %w", err)
+	}
+
+	rigTags = tags
+	publishTags(tags)
+	return true, tags, nil
+}
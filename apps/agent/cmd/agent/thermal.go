@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/bloxos/agent/internal/collector"
+	"github.com/bloxos/agent/internal/executor"
+	"github.com/bloxos/agent/internal/ws"
+)
+
+// handleSetThermalTarget stores the memory temperature target; an empty
+// target turns the controller off and gives throttled GPUs their power back
+func handleSetThermalTarget(payload interface{}) (bool, interface{}, error) {
+	var target executor.ThermalTarget
+	if payload != nil {
+		if err := decodePayload(payload, &target); err != nil {
+			return false, nil, err
+		}
+	}
+
+	restored, err := exec.SetThermalTarget(&target)
+	if err != nil {
+		return false, nil, err
+	}
+	return true, map[string]interface{}{"restored": restored}, nil
+}
+
+// controlMemTemp runs the memory temperature controller on a stats poll
+// and returns the GPUs it is holding back. Throttling a GPU and giving it
+// its power back are reported as events, not every step in between.
+func controlMemTemp(client *ws.Client, gpus []collector.GPUStats) []executor.ThermalAction {
+	target, err := exec.ThermalTarget()
+	if err != nil {
+		log.Printf("Thermal control: %v", err)
+	}
+	if target == nil || exec.PowerSaveStatus() != nil {
+		return exec.ThermalStatus()
+	}
+
+	var readings []executor.ThermalReading
+	for _, gpu := range gpus {
+		readings = append(readings, executor.ThermalReading{Index: gpu.Index, Vendor: gpu.Vendor, BusID: gpu.BusID, MemTemp: gpu.MemTemp})
+	}
+
+	for _, action := range exec.ControlMemTemp(target, readings) {
+		event := &ws.Event{Type: "thermal_powercap", Severity: "warning", Data: action}
+		switch {
+		case action.Error != "":
+			event.Message = fmt.Sprintf("GPU %d memory at %d °C (target %d °C), power limit change failed: %s", action.GPUIndex, action.MemTemp, action.Target, action.Error)
+		case action.Restored:
+			event.Severity = "info"
+			event.Message = fmt.Sprintf("GPU %d memory back to %d °C, power limit restored to %d W", action.GPUIndex, action.MemTemp, action.Watts)
+		default:
+			log.Printf("GPU %d memory at %d °C (target %d °C): power limit %d W (%d%%)", action.GPUIndex, action.MemTemp, action.Target, action.Watts, action.Percent)
+			if !thermalReported[action.BusID] {
+				thermalReported[action.BusID] = true
+				event.Message = fmt.Sprintf("GPU %d memory at %d °C (target %d °C), lowering the power limit to %d W", action.GPUIndex, action.MemTemp, action.Target, action.Watts)
+			}
+		}
+		if action.Restored {
+			delete(thermalReported, action.BusID)
+		}
+		if event.Message == "" {
+			continue
+		}
+
+		log.Println(event.Message)
+		if client.AnyConnected() {
+			if err := client.SendEvent(event); err != nil {
+				log.Printf("Failed to send thermal event: %v", err)
+			}
+		}
+	}
+	return exec.ThermalStatus()
+}
+
+// thermalReported are the GPUs whose throttling has been reported, by bus
+// ID; only the stats loop touches it
+var thermalReported = map[string]bool{}
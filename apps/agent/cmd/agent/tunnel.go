@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bloxos/agent/internal/tunnel"
+	"github.com/bloxos/agent/internal/ws"
+)
+
+var (
+	tunnelMu     sync.Mutex
+	activeTunnel *tunnel.Tunnel
+)
+
+// tunnelAuditPath is the local record of every tunnel, kept even when the
+// server can't be told
+func tunnelAuditPath() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".bloxos", "tunnel-audit.log")
+}
+
+// auditTunnel appends an entry to the audit log and reports it to the
+// server
+func auditTunnel(entry tunnel.Entry) {
+	if data, err := json.Marshal(entry); err == nil {
+		os.MkdirAll(filepath.Dir(tunnelAuditPath()), 0755)
+		if f, err := os.OpenFile(tunnelAuditPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600); err == nil {
+			f.Write(append(data, '\n'))
+			f.Close()
+		} else {
+			log.Printf("Failed to write tunnel audit log: %v", err)
+		}
+	}
+
+	message := fmt.Sprintf("Support tunnel %s", entry.Event)
+	if entry.Remote != "" {
+		message += " from " + entry.Remote
+	}
+	if entry.Detail != "" {
+		message += ": " + entry.Detail
+	}
+	log.Println(message)
+
+	if wsClient.AnyConnected() {
+		event := &ws.Event{Type: "tunnel", Severity: "info", Message: message, Data: entry}
+		if entry.Event == "opened" || entry.Event == "connected" {
+			event.Severity = "warning" // Someone can reach the rig
+		}
+		go func() {
+			if err := wsClient.SendEvent(event); err != nil {
+				log.Printf("Failed to send tunnel event: %v", err)
+			}
+		}()
+	}
+}
+
+// handleOpenTunnel opens a reverse SSH tunnel to a support bastion for a
+// limited time. Only one tunnel is open at a time.
+func handleOpenTunnel(payload interface{}) (bool, interface{}, error) {
+	var req struct {
+		Bastion     string `json:"bastion"`
+		User        string `json:"user"`
+		PrivateKey  string `json:"privateKey"`
+		HostKey     string `json:"hostKey"`
+		RemotePort  int    `json:"remotePort"`
+		Target      string `json:"target"`
+		Duration    int    `json:"duration"` // Seconds (default 1 hour, at most 8)
+		RequestedBy string `json:"requestedBy"`
+		Reason      string `json:"reason"`
+	}
+	if err := decodePayload(payload, &req); err != nil {
+		return false, nil, err
+	}
+	if req.RequestedBy == "" {
+		return false, nil, fmt.Errorf("requestedBy required for the audit log")
+	}
+
+	tunnelMu.Lock()
+	defer tunnelMu.Unlock()
+	if activeTunnel != nil {
+		select {
+		case <-activeTunnel.Done():
+			activeTunnel = nil
+		default:
+			return false, nil, fmt.Errorf("a tunnel is already open (close_tunnel first)")
+		}
+	}
+
+	auditTunnel(tunnel.Entry{Event: "requested", Detail: fmt.Sprintf("by %s: %s", req.RequestedBy, req.Reason)})
+
+	config := tunnel.Config{
+		Bastion:    req.Bastion,
+		User:       req.User,
+		PrivateKey: []byte(req.PrivateKey),
+		HostKey:    []byte(req.HostKey),
+		RemotePort: req.RemotePort,
+		Target:     req.Target,
+		Duration:   time.Duration(req.Duration) * time.Second,
+	}
+	var dial func(ctx context.Context, network, addr string) (net.Conn, error)
+	if dnsResolver != nil {
+		dial = dnsResolver.DialContext
+	}
+	t, err := tunnel.Open(context.Background(), config, dial, auditTunnel)
+	if err != nil {
+		auditTunnel(tunnel.Entry{Event: "failed", Detail: err.Error()})
+		return false, nil, err
+	}
+	activeTunnel = t
+	return true, t.Status(), nil
+}
+
+// handleCloseTunnel closes the open tunnel, if any
+func handleCloseTunnel() (bool, interface{}, error) {
+	tunnelMu.Lock()
+	t := activeTunnel
+	activeTunnel = nil
+	tunnelMu.Unlock()
+
+	if t == nil {
+		return true, map[string]interface{}{"closed": false}, nil
+	}
+	t.Close("closed by the server")
+	return true, map[string]interface{}{"closed": true}, nil
+}
+
+// tunnelStatus returns the open tunnel for the stats, or nil
+func tunnelStatus() *tunnel.Status {
+	tunnelMu.Lock()
+	defer tunnelMu.Unlock()
+	if activeTunnel == nil {
+		return nil
+	}
+	select {
+	case <-activeTunnel.Done():
+		activeTunnel = nil
+		return nil
+	default:
+	}
+	status := activeTunnel.Status()
+	return &status
+}
+
+// closeTunnel closes the open tunnel when the agent exits
+func closeTunnel() {
+	tunnelMu.Lock()
+	defer tunnelMu.Unlock()
+	if activeTunnel != nil {
+		activeTunnel.Close("agent stopped")
+		activeTunnel = nil
+	}
+}
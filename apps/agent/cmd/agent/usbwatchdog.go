@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bloxos/agent/internal/usbwatchdog"
+	"github.com/bloxos/agent/internal/ws"
+)
+
+const (
+	// usbWatchdogPet is the time between heartbeats, well inside the
+	// shortest timeout the dongles can be set to
+	usbWatchdogPet = 5 * time.Second
+	// usbWatchdogStall is how long the main loop may hang, e.g. on a
+	// driver call stuck behind a crashed GPU, before the dongle is left to
+	// power-cycle the rig
+	usbWatchdogStall = 5 * time.Minute
+)
+
+var (
+	usbDongle *usbwatchdog.Dongle
+
+	// mainLoopBeat is the Unix time of the main loop's last pass
+	mainLoopBeat atomic.Int64
+	// usbWatchdogHold stops the heartbeat once a reboot is under way, so
+	// a reboot that hangs ends in a power cycle
+	usbWatchdogHold atomic.Bool
+
+	usbWatchdogMu     sync.Mutex
+	usbWatchdogStatus *usbWatchdogReport
+)
+
+// usbWatchdogReport is the dongle's state in the stats
+type usbWatchdogReport struct {
+	Device  string `json:"device"`
+	Petting bool   `json:"petting"`
+	Reason  string `json:"reason,omitempty"` // Why the heartbeat stopped
+	LastPet int64  `json:"lastPet,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// runUSBWatchdog pets the USB watchdog dongle while the agent is healthy.
+// When the OS freezes, or the agent stops or hangs, the heartbeat stops and
+// the dongle power-cycles the rig at the end of its timeout, which must be
+// longer than the rig takes to boot.
+func runUSBWatchdog(dongle *usbwatchdog.Dongle) {
+	report := &usbWatchdogReport{Device: dongle.Name()}
+	log.Printf("USB watchdog: petting %s every %s", dongle.Name(), usbWatchdogPet)
+	for range time.Tick(usbWatchdogPet) {
+		reason := usbWatchdogUnhealthy()
+		if reason != "" {
+			first := report.Reason == ""
+			report.Petting = false
+			report.Reason = reason
+			setUSBWatchdogReport(report)
+			if first {
+				log.Printf("USB watchdog: %s, no longer petting %s", reason, dongle.Name())
+				sendUSBWatchdogEvent("critical", fmt.Sprintf("USB watchdog stopped (%s); the dongle will power-cycle the rig", reason), report)
+			}
+			continue
+		}
+		if report.Reason != "" {
+			log.Printf("USB watchdog: healthy again, petting %s", dongle.Name())
+			report.Reason = ""
+		}
+
+		err := dongle.Pet()
+		failing := report.Error != ""
+		report.Petting = err == nil
+		report.Error = ""
+		if err != nil {
+			report.Error = err.Error()
+		} else {
+			report.LastPet = time.Now().Unix()
+		}
+		setUSBWatchdogReport(report)
+		switch {
+		case err != nil && !failing:
+			log.Printf("USB watchdog: %s: %v", dongle.Name(), err)
+			sendUSBWatchdogEvent("warning", fmt.Sprintf("USB watchdog %s not responding: %v", dongle.Name(), err), report)
+		case err == nil && failing:
+			log.Printf("USB watchdog: %s responding again", dongle.Name())
+			sendUSBWatchdogEvent("info", fmt.Sprintf("USB watchdog %s responding again", dongle.Name()), report)
+		}
+	}
+}
+
+// usbWatchdogUnhealthy returns why the rig shouldn't be kept alive, or ""
+func usbWatchdogUnhealthy() string {
+	if usbWatchdogHold.Load() {
+		return "rebooting"
+	}
+	if stalled := time.Since(time.Unix(mainLoopBeat.Load(), 0)); stalled > usbWatchdogStall {
+		return fmt.Sprintf("agent main loop stalled for %s", stalled.Round(time.Second))
+	}
+	return ""
+}
+
+func setUSBWatchdogReport(report *usbWatchdogReport) {
+	usbWatchdogMu.Lock()
+	defer usbWatchdogMu.Unlock()
+	copied := *report
+	usbWatchdogStatus = &copied
+}
+
+// usbWatchdogStats returns the dongle's state, or nil without one
+func usbWatchdogStats() *usbWatchdogReport {
+	usbWatchdogMu.Lock()
+	defer usbWatchdogMu.Unlock()
+	return usbWatchdogStatus
+}
+
+func sendUSBWatchdogEvent(severity, message string, report *usbWatchdogReport) {
+	if wsClient == nil || !wsClient.AnyConnected() {
+		return
+	}
+	event := &ws.Event{
+		Type:     "usb_watchdog",
+		Severity: severity,
+		Message:  message,
+		Data:     report,
+	}
+	if err := wsClient.SendEvent(event); err != nil {
+		log.Printf("Failed to send USB watchdog event: %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/bloxos/agent/internal/config"
+)
+
+// watchdogRebootInterval is the least time between two watchdog reboots, so
+// a rig whose network is down for good doesn't reboot in a loop
+const watchdogRebootInterval = 24 * time.Hour
+
+// watchdogState survives the agent restarts and reboots the watchdog does
+type watchdogState struct {
+	Restarts   int   `json:"restarts"`             // Agent restarts since the last connection
+	LastReboot int64 `json:"lastReboot,omitempty"` // Unix seconds
+}
+
+func watchdogStatePath() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".bloxos", "watchdog.json")
+}
+
+// runWatchdog recovers from connection failures a reconnect can't fix, such
+// as corrupted TLS state or a stuck network stack: it restarts the agent
+// after -watchdog-offline minutes without authenticating and, if that
+// didn't help, reboots the rig. A running miner keeps mining without the
+// server, so the watchdog leaves it alone.
+func runWatchdog(cfg *config.Config) {
+	limit := time.Duration(cfg.WatchdogOffline) * time.Minute
+	for range time.Tick(time.Minute) {
+		offline := wsClient.OfflineFor()
+		if offline == 0 {
+			if state := loadWatchdogState(); state.Restarts > 0 {
+				state.Restarts = 0
+				saveWatchdogState(state)
+			}
+			continue
+		}
+		if offline < limit {
+			continue
+		}
+		if running, _ := exec.GetMinerStatus()["running"].(bool); running {
+			continue
+		}
+		if osUpdating.Load() || driverInstalling.Load() {
+			continue
+		}
+		// The server refuses the token, which no restart fixes
+		if conflict := wsClient.TokenConflict(); conflict != nil && conflict.Refused {
+			continue
+		}
+
+		state := loadWatchdogState()
+		lastReboot := time.Unix(state.LastReboot, 0)
+		if cfg.WatchdogReboot && state.Restarts > 0 && time.Since(lastReboot) > watchdogRebootInterval {
+			log.Printf("Watchdog: not authenticated for %s after an agent restart, rebooting", offline.Round(time.Minute))
+			state.Restarts = 0
+			state.LastReboot = time.Now().Unix()
+			saveWatchdogState(state)
+			rebootRig("soft")
+			continue
+		}
+
+		log.Printf("Watchdog: not authenticated for %s, restarting the agent", offline.Round(time.Minute))
+		state.Restarts++
+		saveWatchdogState(state)
+		restartAgent()
+	}
+}
+
+// restartAgent replaces the agent process with a fresh copy of itself,
+// falling back to exiting for the service manager to restart it
+func restartAgent() {
+	exec.StopHeadlessX()
+
+	exe, err := os.Executable()
+	if err == nil {
+		err = syscall.Exec(exe, os.Args, os.Environ())
+	}
+	log.Printf("Watchdog: re-exec failed (%v), exiting", err)
+	os.Exit(1)
+}
+
+func loadWatchdogState() *watchdogState {
+	state := &watchdogState{}
+	if data, err := os.ReadFile(watchdogStatePath()); err == nil {
+		json.Unmarshal(data, state)
+	}
+	return state
+}
+
+func saveWatchdogState(state *watchdogState) {
+	path := watchdogStatePath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		log.Printf("Watchdog: %v", err)
+		return
+	}
+	data, _ := json.Marshal(state)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		log.Printf("Watchdog: %v", err)
+	}
+}
@@ -296,6 +296,8 @@ EnvironmentFile=$CONFIG_DIR/agent.env
 ExecStart=$INSTALL_DIR/bloxos-agent --server \${BLOXOS_SERVER} --token \${BLOXOS_TOKEN}
 Restart=always
 RestartSec=10
+# Let the miner outlive agent restarts (see -miner-on-exit)
+KillMode=process
 StandardOutput=append:$INSTALL_DIR/logs/agent.log
 StandardError=append:$INSTALL_DIR/logs/agent.log
 
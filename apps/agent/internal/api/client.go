@@ -62,6 +62,44 @@ func (c *Client) Register(sysInfo *collector.SystemInfo) error {
 	return err
 }
 
+// ClaimRequest announces a rig waiting to be claimed with a code. The
+// secret, never shown, proves the token poll comes from the same rig.
+type ClaimRequest struct {
+	Code         string   `json:"code"`
+	Secret       string   `json:"secret"`
+	Hostname     string   `json:"hostname"`
+	InstanceID   string   `json:"instanceId,omitempty"`
+	AgentVersion string   `json:"agentVersion"`
+	Addresses    []string `json:"addresses,omitempty"` // LAN IPs, to tell rigs apart
+}
+
+// ClaimStatus is the state of a claim code
+type ClaimStatus struct {
+	Status string `json:"status"` // "pending", "claimed" or "expired"
+	Token  string `json:"token,omitempty"`
+}
+
+// StartClaim registers a claim code; needs no token
+func (c *Client) StartClaim(req *ClaimRequest) error {
+	_, err := c.post("/api/agent/claim", req)
+	return err
+}
+
+// PollClaim checks whether a claim code was entered in the dashboard, and
+// returns the rig's token once it was
+func (c *Client) PollClaim(code, secret string) (*ClaimStatus, error) {
+	body, err := c.post("/api/agent/claim/status", map[string]string{"code": code, "secret": secret})
+	if err != nil {
+		return nil, err
+	}
+
+	var status ClaimStatus
+	if err := json.Unmarshal(body, &status); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return &status, nil
+}
+
 // ReportStats sends stats to the server
 func (c *Client) ReportStats(payload *ReportPayload) (*CommandResponse, error) {
 	payload.Token = c.token
@@ -103,7 +141,9 @@ func (c *Client) post(path string, payload interface{}) ([]byte, error) {
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+c.token)
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
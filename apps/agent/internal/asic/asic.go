@@ -0,0 +1,341 @@
+package asic
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rescanInterval is how often configured subnets are rescanned for new devices
+const rescanInterval = 10 * time.Minute
+
+// maxScanHosts bounds subnet scans (a /22)
+const maxScanHosts = 1024
+
+// Board is a single hashboard (chain) of an ASIC
+type Board struct {
+	Index    int      `json:"index"`
+	Hashrate *float64 `json:"hashrate,omitempty"` // H/s
+	Temp     *float64 `json:"temp,omitempty"`     // Chip temperature, Celsius
+	Chips    *int     `json:"chips,omitempty"`
+}
+
+// Device is an ASIC miner reported as a sub-device of the rig
+type Device struct {
+	IP          string   `json:"ip"`
+	Online      bool     `json:"online"`
+	Vendor      string   `json:"vendor,omitempty"` // antminer, whatsminer, iceriver
+	Model       string   `json:"model,omitempty"`
+	Hashrate    *float64 `json:"hashrate,omitempty"`    // H/s, short window
+	HashrateAvg *float64 `json:"hashrateAvg,omitempty"` // H/s, since start
+	Accepted    int      `json:"accepted"`
+	Rejected    int      `json:"rejected"`
+	Uptime      int      `json:"uptime"` // Seconds
+	Power       *float64 `json:"power,omitempty"`
+	Fans        []int    `json:"fans,omitempty"` // RPM
+	Boards      []Board  `json:"boards,omitempty"`
+	Pool        string   `json:"pool,omitempty"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// Monitor polls a set of ASICs given as IPs and/or CIDR subnets
+type Monitor struct {
+	hosts   []string
+	subnets []*net.IPNet
+
+	mu         sync.Mutex
+	discovered []string
+	lastScan   time.Time
+	devices    []Device
+}
+
+// NewMonitor parses a comma-separated list of IPs and subnets, e.g.
+// "192.168.1.50,192.168.2.0/24"
+func NewMonitor(spec string) (*Monitor, error) {
+	m := &Monitor{}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			_, subnet, err := net.ParseCIDR(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid ASIC subnet %q: %w", entry, err)
+			}
+			ones, bits := subnet.Mask.Size()
+			if bits != 32 || 1<<(bits-ones) > maxScanHosts {
+				return nil, fmt.Errorf("ASIC subnet %q is too large (max /22, IPv4 only)", entry)
+			}
+			m.subnets = append(m.subnets, subnet)
+			continue
+		}
+		if net.ParseIP(entry) == nil {
+			return nil, fmt.Errorf("invalid ASIC address %q", entry)
+		}
+		m.hosts = append(m.hosts, entry)
+	}
+	return m, nil
+}
+
+// Start polls in the background; Devices returns the latest results
+func (m *Monitor) Start(interval time.Duration) {
+	go func() {
+		for {
+			devices := m.Poll()
+			m.mu.Lock()
+			m.devices = devices
+			m.mu.Unlock()
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// Devices returns the results of the last background poll
+func (m *Monitor) Devices() []Device {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.devices
+}
+
+// Poll queries every known ASIC, rescanning subnets when due
+func (m *Monitor) Poll() []Device {
+	m.mu.Lock()
+	if len(m.subnets) > 0 && time.Since(m.lastScan) > rescanInterval {
+		m.mu.Unlock()
+		found := scanSubnets(m.subnets)
+		m.mu.Lock()
+		m.discovered = found
+		m.lastScan = time.Now()
+	}
+	targets := append(append([]string{}, m.hosts...), m.discovered...)
+	m.mu.Unlock()
+
+	devices := make([]Device, len(targets))
+	var wg sync.WaitGroup
+	for i, ip := range targets {
+		wg.Add(1)
+		go func(i int, ip string) {
+			defer wg.Done()
+			devices[i] = pollDevice(ip)
+		}(i, ip)
+	}
+	wg.Wait()
+
+	return devices
+}
+
+// scanSubnets returns hosts in the subnets with the miner API port open
+func scanSubnets(subnets []*net.IPNet) []string {
+	var mu sync.Mutex
+	var found []string
+	sem := make(chan struct{}, 64)
+	var wg sync.WaitGroup
+
+	for _, subnet := range subnets {
+		base := subnet.IP.To4()
+		ones, bits := subnet.Mask.Size()
+		count := 1 << (bits - ones)
+		start := uint32(base[0])<<24 | uint32(base[1])<<16 | uint32(base[2])<<8 | uint32(base[3])
+
+		for i := 1; i < count-1; i++ { // Skip network and broadcast
+			n := start + uint32(i)
+			ip := net.IPv4(byte(n>>24), byte(n>>16), byte(n>>8), byte(n)).String()
+
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(ip string) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				conn, err := net.DialTimeout("tcp", net.JoinHostPort(ip, apiPort), 500*time.Millisecond)
+				if err != nil {
+					return
+				}
+				conn.Close()
+				mu.Lock()
+				found = append(found, ip)
+				mu.Unlock()
+			}(ip)
+		}
+	}
+	wg.Wait()
+
+	sort.Strings(found)
+	return found
+}
+
+var (
+	fanKey       = regexp.MustCompile(`^fan(\d+)$`)
+	chainRateKey = regexp.MustCompile(`^chain_rate(\d+)$`)
+)
+
+// pollDevice reads summary, stats and pool info from one ASIC
+func pollDevice(ip string) Device {
+	dev := Device{IP: ip}
+
+	summary, err := queryAny(ip, "summary")
+	if err != nil {
+		dev.Error = err.Error()
+		return dev
+	}
+	dev.Online = true
+
+	if s := firstObject(summary, "SUMMARY"); s != nil {
+		// Antminer reports GH/s, Whatsminer and most others MH/s
+		if v, ok := num(s, "GHS 5s"); ok {
+			dev.Hashrate = floatPtr(v * 1e9)
+		} else if v, ok := num(s, "MHS 5s"); ok {
+			dev.Hashrate = floatPtr(v * 1e6)
+		}
+		if v, ok := num(s, "GHS av"); ok {
+			dev.HashrateAvg = floatPtr(v * 1e9)
+		} else if v, ok := num(s, "MHS av"); ok {
+			dev.HashrateAvg = floatPtr(v * 1e6)
+		}
+		if v, ok := num(s, "Accepted"); ok {
+			dev.Accepted = int(v)
+		}
+		if v, ok := num(s, "Rejected"); ok {
+			dev.Rejected = int(v)
+		}
+		if v, ok := num(s, "Elapsed"); ok {
+			dev.Uptime = int(v)
+		}
+		if v, ok := num(s, "Power"); ok {
+			dev.Power = floatPtr(v)
+		}
+		// Whatsminer puts fans in the summary
+		for _, key := range []string{"Fan Speed In", "Fan Speed Out"} {
+			if v, ok := num(s, key); ok {
+				dev.Fans = append(dev.Fans, int(v))
+			}
+		}
+	}
+
+	if stats, err := queryAny(ip, "stats"); err == nil {
+		readAntminerStats(&dev, objects(stats, "STATS"))
+	}
+
+	if dev.Vendor == "" {
+		if devs, err := query(ip, "cmd", "devs"); err == nil {
+			readWhatsminerDevs(&dev, objects(devs, "DEVS"))
+		}
+		if details, err := query(ip, "cmd", "devdetails"); err == nil {
+			if d := firstObject(details, "DEVDETAILS"); d != nil {
+				dev.Model, _ = d["Model"].(string)
+			}
+		}
+	}
+
+	if pools, err := queryAny(ip, "pools"); err == nil {
+		for _, pool := range objects(pools, "POOLS") {
+			if status, _ := pool["Status"].(string); status == "Alive" {
+				dev.Pool, _ = pool["URL"].(string)
+				break
+			}
+		}
+	}
+
+	return dev
+}
+
+// readAntminerStats parses bmminer/cgminer STATS: the first entry carries
+// the model, the second per-chain rates, temps and fans
+func readAntminerStats(dev *Device, stats []map[string]interface{}) {
+	boards := map[int]*Board{}
+
+	for _, entry := range stats {
+		if model, ok := entry["Type"].(string); ok && model != "" {
+			dev.Model = model
+			lower := strings.ToLower(model)
+			switch {
+			case strings.Contains(lower, "antminer"):
+				dev.Vendor = "antminer"
+			case strings.Contains(lower, "iceriver") || strings.HasPrefix(lower, "ks"):
+				dev.Vendor = "iceriver"
+			}
+		}
+
+		fans := map[int]int{}
+		for key := range entry {
+			if match := fanKey.FindStringSubmatch(key); match != nil {
+				if v, ok := num(entry, key); ok && v > 0 {
+					idx, _ := strconv.Atoi(match[1])
+					fans[idx] = int(v)
+				}
+			}
+			match := chainRateKey.FindStringSubmatch(key)
+			if match == nil {
+				continue
+			}
+			rate, ok := num(entry, key)
+			if !ok || rate == 0 {
+				continue
+			}
+			idx, _ := strconv.Atoi(match[1])
+			board := &Board{Index: idx, Hashrate: floatPtr(rate * 1e9)}
+			if v, ok := num(entry, "temp2_"+match[1]); ok && v > 0 {
+				board.Temp = floatPtr(v)
+			} else if v, ok := num(entry, "temp"+match[1]); ok && v > 0 {
+				board.Temp = floatPtr(v)
+			}
+			if v, ok := num(entry, "chain_acn"+match[1]); ok {
+				chips := int(v)
+				board.Chips = &chips
+			}
+			boards[idx] = board
+		}
+		if len(fans) > 0 && len(dev.Fans) == 0 {
+			indexes := make([]int, 0, len(fans))
+			for idx := range fans {
+				indexes = append(indexes, idx)
+			}
+			sort.Ints(indexes)
+			for _, idx := range indexes {
+				dev.Fans = append(dev.Fans, fans[idx])
+			}
+		}
+	}
+
+	for _, board := range boards {
+		dev.Boards = append(dev.Boards, *board)
+	}
+	sort.Slice(dev.Boards, func(i, j int) bool { return dev.Boards[i].Index < dev.Boards[j].Index })
+}
+
+// readWhatsminerDevs parses btminer DEVS, one entry per hashboard
+func readWhatsminerDevs(dev *Device, devs []map[string]interface{}) {
+	if len(devs) == 0 {
+		return
+	}
+	dev.Vendor = "whatsminer"
+
+	for i, entry := range devs {
+		board := Board{Index: i}
+		if v, ok := num(entry, "Slot"); ok {
+			board.Index = int(v)
+		}
+		if v, ok := num(entry, "MHS av"); ok {
+			board.Hashrate = floatPtr(v * 1e6)
+		}
+		if v, ok := num(entry, "Chip Temp Avg"); ok {
+			board.Temp = floatPtr(v)
+		} else if v, ok := num(entry, "Temperature"); ok {
+			board.Temp = floatPtr(v)
+		}
+		if v, ok := num(entry, "Effective Chips"); ok {
+			chips := int(v)
+			board.Chips = &chips
+		}
+		dev.Boards = append(dev.Boards, board)
+	}
+}
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
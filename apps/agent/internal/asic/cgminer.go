@@ -0,0 +1,98 @@
+package asic
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// apiPort is the cgminer-compatible API port used by Antminer, Whatsminer
+// and most custom ASIC firmware
+const apiPort = "4028"
+
+// query sends a cgminer API request and returns the decoded response. The
+// request uses the "command" key (cgminer/bmminer); Whatsminer's btminer
+// also accepts "cmd".
+func query(ip, key, command string) (map[string]interface{}, error) {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(ip, apiPort), 3*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	request, _ := json.Marshal(map[string]string{key: command})
+	if _, err := conn.Write(request); err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(conn)
+	if err != nil && len(body) == 0 {
+		return nil, err
+	}
+
+	// Antminer firmware terminates with a NUL byte and some versions emit
+	// "}{" between objects of multi-value arrays
+	body = bytes.TrimRight(body, "\x00\r\n ")
+	body = bytes.ReplaceAll(body, []byte("}{"), []byte("},{"))
+
+	var data map[string]interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, fmt.Errorf("invalid API response: %w", err)
+	}
+
+	if status := firstObject(data, "STATUS"); status != nil {
+		if s, _ := status["STATUS"].(string); s == "E" || s == "F" {
+			msg, _ := status["Msg"].(string)
+			return nil, fmt.Errorf("API error: %s", msg)
+		}
+	}
+	return data, nil
+}
+
+// queryAny tries the cgminer "command" form, then the btminer "cmd" form
+func queryAny(ip, command string) (map[string]interface{}, error) {
+	data, err := query(ip, "command", command)
+	if err == nil {
+		return data, nil
+	}
+	if alt, altErr := query(ip, "cmd", command); altErr == nil {
+		return alt, nil
+	}
+	return nil, err
+}
+
+// objects returns the array of objects stored under key (e.g. "SUMMARY")
+func objects(data map[string]interface{}, key string) []map[string]interface{} {
+	list, _ := data[key].([]interface{})
+	var result []map[string]interface{}
+	for _, item := range list {
+		if obj, ok := item.(map[string]interface{}); ok {
+			result = append(result, obj)
+		}
+	}
+	return result
+}
+
+func firstObject(data map[string]interface{}, key string) map[string]interface{} {
+	if list := objects(data, key); len(list) > 0 {
+		return list[0]
+	}
+	return nil
+}
+
+// num reads a numeric field that firmware may encode as a number or string
+func num(obj map[string]interface{}, key string) (float64, bool) {
+	switch v := obj[key].(type) {
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
@@ -4,11 +4,14 @@ import (
 	"bufio"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/bloxos/agent/internal/platform"
+	"github.com/bloxos/agent/internal/system"
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/host"
 	"github.com/shirou/gopsutil/v3/mem"
@@ -21,13 +24,22 @@ type GPUStats struct {
 	Vendor      string  `json:"vendor"` // NVIDIA, AMD, INTEL
 	Temperature *int    `json:"temperature"`
 	MemTemp     *int    `json:"memTemp"`
+	// Junction (hotspot) temperature, AMD only: NVML's sensors are the
+	// GPU edge, memory, board and power supply, none of them the hotspot
+	HotspotTemp *int    `json:"hotspotTemp,omitempty"`
 	FanSpeed    *int    `json:"fanSpeed"`
+	FanRPM      *int    `json:"fanRpm,omitempty"`    // Measured; AMD, or NVIDIA while an X server runs
+	FanMaxRPM   *int    `json:"fanMaxRpm,omitempty"` // AMD only
 	PowerDraw   *int    `json:"powerDraw"`
 	CoreClock   *int    `json:"coreClock"`
 	MemoryClock *int    `json:"memoryClock"`
 	Utilization *int    `json:"utilization"`
 	VRAM        int     `json:"vram"`
 	BusID       string  `json:"busId"`
+	PCIeErrors  *PCIeErrors `json:"pcieErrors,omitempty"`
+	Throttle    *ThrottleStats `json:"throttle,omitempty"`
+	Samples     *GPUSamples `json:"samples,omitempty"` // Min/avg/max between reports
+	Card        *CardID `json:"card,omitempty"` // Board identity from the PCI subsystem IDs
 }
 
 // CPUStats holds CPU stats
@@ -40,6 +52,16 @@ type CPUStats struct {
 	Usage       *float64 `json:"usage"`
 	Frequency   *int     `json:"frequency"`
 	PowerDraw   *int     `json:"powerDraw"`
+
+	// Load and stall metrics; percentages and rates cover the time since
+	// the previous sample
+	Load1           *float64 `json:"load1,omitempty"`
+	Load5           *float64 `json:"load5,omitempty"`
+	Load15          *float64 `json:"load15,omitempty"`
+	IOWait          *float64 `json:"iowait,omitempty"`          // Percent
+	Steal           *float64 `json:"steal,omitempty"`           // Percent (VMs)
+	ContextSwitches *float64 `json:"contextSwitches,omitempty"` // Per second
+	ProcsBlocked    *int     `json:"procsBlocked,omitempty"`    // Tasks in uninterruptible I/O wait
 }
 
 // SystemInfo holds basic system information
@@ -51,17 +73,61 @@ type SystemInfo struct {
 	Uptime    uint64 `json:"uptime"`
 	MemTotal  uint64 `json:"memTotal"`
 	MemUsed   uint64 `json:"memUsed"`
+	Timezone  string `json:"timezone,omitempty"` // IANA name
+	Locale    string `json:"locale,omitempty"`
+
+	Image *system.ImageInfo `json:"image,omitempty"` // Set by the agent, which knows its version
 }
 
 // Collector collects hardware stats
 type Collector struct {
+	run platform.Runner
+	fs  platform.FS
+
 	prevCPUIdle  uint64
 	prevCPUTotal uint64
+
+	prevCPUTimes *cpu.TimesStat
+	prevCtxt     uint64
+	prevCtxtAt   time.Time
+
+	throttleMu sync.Mutex
+	throttle   map[string]*ThrottleStats // By normalized bus ID
+
+	sampleMu       sync.Mutex
+	samples        map[string]*gpuSampleSums // By normalized bus ID (see samples.go)
+	sampleInterval time.Duration
+
+	minerMu    sync.Mutex
+	lastMiner  *MinerStats
+	minerAPIs  func() map[string][]MinerEndpoint // API endpoints of agent-started miners
+	apiSessions map[string]apiSession // Miner API logins by address (see minerauth.go)
+	outputMiners func() []OutputMiner  // Agent-started miners parsed from their output
+
+	outputMu sync.Mutex
+	outputs  map[string]*outputParser // By log path (see output.go)
+
+	fans   fanMonitor
+	shares shareTracker
+	devFee devFeeTracker
+
+	presenceMu  sync.Mutex
+	knownGPUs   map[string]string    // Bus ID -> name of every GPU seen since start
+	missingSeen map[string]time.Time // "source/busID" -> first detected
+
+	cardMu sync.Mutex
+	cards  map[string]*CardID // By normalized bus ID
 }
 
 // New creates a new collector
 func New() *Collector {
-	return &Collector{}
+	return NewWithPlatform(platform.Host, platform.Host)
+}
+
+// NewWithPlatform creates a collector that runs tools and reads sysfs
+// through the given backends, e.g. a platform.Fake in tests
+func NewWithPlatform(run platform.Runner, fs platform.FS) *Collector {
+	return &Collector{run: run, fs: fs}
 }
 
 // GetSystemInfo collects basic system information
@@ -86,6 +152,8 @@ func (c *Collector) GetSystemInfo() (*SystemInfo, error) {
 		Uptime:    hostInfo.Uptime,
 		MemTotal:  memInfo.Total,
 		MemUsed:   memInfo.Used,
+		Timezone:  system.Timezone(),
+		Locale:    system.Locale(),
 	}, nil
 }
 
@@ -99,6 +167,7 @@ func (c *Collector) GetGPUStats() ([]GPUStats, error) {
 	if err != nil {
 		lastError = err
 	} else {
+		c.addNvidiaFanRPM(nvidiaGPUs)
 		allGPUs = append(allGPUs, nvidiaGPUs...)
 	}
 
@@ -119,6 +188,10 @@ func (c *Collector) GetGPUStats() ([]GPUStats, error) {
 		// Re-index GPUs sequentially
 		for i := range allGPUs {
 			allGPUs[i].Index = i
+			allGPUs[i].PCIeErrors = c.getPCIeErrors(allGPUs[i].BusID)
+			allGPUs[i].Throttle = c.takeThrottleStats(allGPUs[i].BusID)
+			allGPUs[i].Samples = c.takeGPUSamples(allGPUs[i].BusID)
+			allGPUs[i].Card = c.cardID(allGPUs[i].BusID, allGPUs[i].Name)
 		}
 		return allGPUs, nil
 	}
@@ -133,11 +206,17 @@ func (c *Collector) GetGPUStats() ([]GPUStats, error) {
 // getNvidiaGPUStats collects NVIDIA GPU stats via nvidia-smi
 func (c *Collector) getNvidiaGPUStats() ([]GPUStats, error) {
 	// Check if nvidia-smi exists
-	if _, err := exec.LookPath("nvidia-smi"); err != nil {
+	if _, err := c.run.LookPath("nvidia-smi"); err != nil {
 		return nil, fmt.Errorf("nvidia-smi not found")
 	}
 
-	cmd := exec.Command("nvidia-smi",
+	// The XML report is the primary source; the CSV query is the fallback
+	// for drivers whose XML can't be parsed
+	if gpus, err := c.getNvidiaGPUStatsXML(); err == nil && len(gpus) > 0 {
+		return gpus, nil
+	}
+
+	cmd := c.run.Command("nvidia-smi",
 		"--query-gpu=index,name,temperature.gpu,temperature.memory,fan.speed,power.draw,clocks.gr,clocks.mem,utilization.gpu,memory.total,pci.bus_id",
 		"--format=csv,noheader,nounits")
 
@@ -212,7 +291,7 @@ func (c *Collector) getAMDGPUStats() ([]GPUStats, error) {
 // getAMDGPUStatsFromRocmSmi uses rocm-smi to get AMD GPU stats
 func (c *Collector) getAMDGPUStatsFromRocmSmi() ([]GPUStats, error) {
 	// Check if rocm-smi exists
-	rocmSmi, err := exec.LookPath("rocm-smi")
+	rocmSmi, err := c.run.LookPath("rocm-smi")
 	if err != nil {
 		return nil, fmt.Errorf("rocm-smi not found")
 	}
@@ -220,7 +299,7 @@ func (c *Collector) getAMDGPUStatsFromRocmSmi() ([]GPUStats, error) {
 	var gpus []GPUStats
 
 	// Get GPU list
-	cmd := exec.Command(rocmSmi, "--showproductname")
+	cmd := c.run.Command(rocmSmi, "--showproductname")
 	output, err := cmd.Output()
 	if err != nil {
 		return nil, fmt.Errorf("rocm-smi failed: %w", err)
@@ -274,16 +353,22 @@ func (c *Collector) getAMDGPUStatsFromRocmSmi() ([]GPUStats, error) {
 		}
 
 		// Get temperature
-		cmd = exec.Command(rocmSmi, "-d", fmt.Sprintf("%d", i), "--showtemp")
+		cmd = c.run.Command(rocmSmi, "-d", fmt.Sprintf("%d", i), "--showtemp")
 		if output, err := cmd.Output(); err == nil {
 			temp := parseRocmSmiValue(string(output), "Temperature")
 			if temp > 0 {
 				gpu.Temperature = &temp
 			}
+			if junction := parseRocmSmiValue(string(output), "Sensor junction"); junction > 0 {
+				gpu.HotspotTemp = &junction
+			}
+			if memTemp := parseRocmSmiValue(string(output), "Sensor memory"); memTemp > 0 {
+				gpu.MemTemp = &memTemp
+			}
 		}
 
 		// Get fan speed
-		cmd = exec.Command(rocmSmi, "-d", fmt.Sprintf("%d", i), "--showfan")
+		cmd = c.run.Command(rocmSmi, "-d", fmt.Sprintf("%d", i), "--showfan")
 		if output, err := cmd.Output(); err == nil {
 			fan := parseRocmSmiValue(string(output), "Fan Speed")
 			if fan > 0 {
@@ -292,7 +377,7 @@ func (c *Collector) getAMDGPUStatsFromRocmSmi() ([]GPUStats, error) {
 		}
 
 		// Get power
-		cmd = exec.Command(rocmSmi, "-d", fmt.Sprintf("%d", i), "--showpower")
+		cmd = c.run.Command(rocmSmi, "-d", fmt.Sprintf("%d", i), "--showpower")
 		if output, err := cmd.Output(); err == nil {
 			power := parseRocmSmiValue(string(output), "Average Graphics Package Power")
 			if power > 0 {
@@ -301,7 +386,7 @@ func (c *Collector) getAMDGPUStatsFromRocmSmi() ([]GPUStats, error) {
 		}
 
 		// Get clocks
-		cmd = exec.Command(rocmSmi, "-d", fmt.Sprintf("%d", i), "--showclocks")
+		cmd = c.run.Command(rocmSmi, "-d", fmt.Sprintf("%d", i), "--showclocks")
 		if output, err := cmd.Output(); err == nil {
 			core := parseRocmSmiValue(string(output), "sclk")
 			if core > 0 {
@@ -314,7 +399,7 @@ func (c *Collector) getAMDGPUStatsFromRocmSmi() ([]GPUStats, error) {
 		}
 
 		// Get VRAM
-		cmd = exec.Command(rocmSmi, "-d", fmt.Sprintf("%d", i), "--showmeminfo", "vram")
+		cmd = c.run.Command(rocmSmi, "-d", fmt.Sprintf("%d", i), "--showmeminfo", "vram")
 		if output, err := cmd.Output(); err == nil {
 			vram := parseRocmSmiValue(string(output), "Total Memory")
 			if vram > 0 {
@@ -323,7 +408,7 @@ func (c *Collector) getAMDGPUStatsFromRocmSmi() ([]GPUStats, error) {
 		}
 
 		// Get utilization
-		cmd = exec.Command(rocmSmi, "-d", fmt.Sprintf("%d", i), "--showuse")
+		cmd = c.run.Command(rocmSmi, "-d", fmt.Sprintf("%d", i), "--showuse")
 		if output, err := cmd.Output(); err == nil {
 			util := parseRocmSmiValue(string(output), "GPU use")
 			if util >= 0 {
@@ -332,7 +417,7 @@ func (c *Collector) getAMDGPUStatsFromRocmSmi() ([]GPUStats, error) {
 		}
 
 		// Get PCI bus ID
-		cmd = exec.Command(rocmSmi, "-d", fmt.Sprintf("%d", i), "--showbus")
+		cmd = c.run.Command(rocmSmi, "-d", fmt.Sprintf("%d", i), "--showbus")
 		if output, err := cmd.Output(); err == nil {
 			lines := strings.Split(string(output), "\n")
 			for _, line := range lines {
@@ -357,7 +442,7 @@ func (c *Collector) getAMDGPUStatsFromSysfs() ([]GPUStats, error) {
 
 	// Find AMD GPU devices
 	drmPath := "/sys/class/drm"
-	entries, err := os.ReadDir(drmPath)
+	entries, err := c.fs.ReadDir(drmPath)
 	if err != nil {
 		return nil, fmt.Errorf("cannot read %s: %w", drmPath, err)
 	}
@@ -374,7 +459,7 @@ func (c *Collector) getAMDGPUStatsFromSysfs() ([]GPUStats, error) {
 
 		// Check if it's an AMD GPU by looking for vendor ID
 		vendorPath := filepath.Join(cardPath, "vendor")
-		vendorData, err := os.ReadFile(vendorPath)
+		vendorData, err := c.fs.ReadFile(vendorPath)
 		if err != nil {
 			continue
 		}
@@ -391,25 +476,34 @@ func (c *Collector) getAMDGPUStatsFromSysfs() ([]GPUStats, error) {
 
 		// Try to get the product name
 		productPath := filepath.Join(cardPath, "product_name")
-		if data, err := os.ReadFile(productPath); err == nil {
+		if data, err := c.fs.ReadFile(productPath); err == nil {
 			gpu.Name = strings.TrimSpace(string(data))
 		}
 
 		// Get temperature from hwmon
 		hwmonPath := filepath.Join(cardPath, "hwmon")
-		if hwmonEntries, err := os.ReadDir(hwmonPath); err == nil && len(hwmonEntries) > 0 {
+		if hwmonEntries, err := c.fs.ReadDir(hwmonPath); err == nil && len(hwmonEntries) > 0 {
 			hwmon := filepath.Join(hwmonPath, hwmonEntries[0].Name())
 
 			// Temperature (temp1_input is edge temp, temp2 is junction, temp3 is mem)
-			if data, err := os.ReadFile(filepath.Join(hwmon, "temp1_input")); err == nil {
+			if data, err := c.fs.ReadFile(filepath.Join(hwmon, "temp1_input")); err == nil {
 				if temp, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil {
 					t := temp / 1000 // Convert millidegrees
 					gpu.Temperature = &t
 				}
 			}
 
+			// Junction (hotspot) temperature; it throttles while edge
+			// temp still looks fine
+			if data, err := c.fs.ReadFile(filepath.Join(hwmon, "temp2_input")); err == nil {
+				if temp, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil {
+					t := temp / 1000
+					gpu.HotspotTemp = &t
+				}
+			}
+
 			// Memory temperature
-			if data, err := os.ReadFile(filepath.Join(hwmon, "temp3_input")); err == nil {
+			if data, err := c.fs.ReadFile(filepath.Join(hwmon, "temp3_input")); err == nil {
 				if temp, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil {
 					t := temp / 1000
 					gpu.MemTemp = &t
@@ -417,15 +511,17 @@ func (c *Collector) getAMDGPUStatsFromSysfs() ([]GPUStats, error) {
 			}
 
 			// Fan speed (PWM to percentage)
-			if data, err := os.ReadFile(filepath.Join(hwmon, "pwm1")); err == nil {
+			if data, err := c.fs.ReadFile(filepath.Join(hwmon, "pwm1")); err == nil {
 				if pwm, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil {
 					fan := (pwm * 100) / 255
 					gpu.FanSpeed = &fan
 				}
 			}
+			gpu.FanRPM = c.readSysfsIntPtr(filepath.Join(hwmon, "fan1_input"))
+			gpu.FanMaxRPM = c.readSysfsIntPtr(filepath.Join(hwmon, "fan1_max"))
 
 			// Power (power1_average in microwatts)
-			if data, err := os.ReadFile(filepath.Join(hwmon, "power1_average")); err == nil {
+			if data, err := c.fs.ReadFile(filepath.Join(hwmon, "power1_average")); err == nil {
 				if power, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil {
 					p := power / 1000000 // Convert to watts
 					gpu.PowerDraw = &p
@@ -434,7 +530,7 @@ func (c *Collector) getAMDGPUStatsFromSysfs() ([]GPUStats, error) {
 		}
 
 		// Get clocks from pp_dpm_sclk and pp_dpm_mclk
-		if data, err := os.ReadFile(filepath.Join(cardPath, "pp_dpm_sclk")); err == nil {
+		if data, err := c.fs.ReadFile(filepath.Join(cardPath, "pp_dpm_sclk")); err == nil {
 			// Format: "0: 500Mhz\n1: 800Mhz *\n" (* marks active)
 			lines := strings.Split(string(data), "\n")
 			for _, line := range lines {
@@ -451,7 +547,7 @@ func (c *Collector) getAMDGPUStatsFromSysfs() ([]GPUStats, error) {
 			}
 		}
 
-		if data, err := os.ReadFile(filepath.Join(cardPath, "pp_dpm_mclk")); err == nil {
+		if data, err := c.fs.ReadFile(filepath.Join(cardPath, "pp_dpm_mclk")); err == nil {
 			lines := strings.Split(string(data), "\n")
 			for _, line := range lines {
 				if strings.Contains(line, "*") {
@@ -468,21 +564,21 @@ func (c *Collector) getAMDGPUStatsFromSysfs() ([]GPUStats, error) {
 		}
 
 		// Get VRAM from mem_info_vram_total
-		if data, err := os.ReadFile(filepath.Join(cardPath, "mem_info_vram_total")); err == nil {
+		if data, err := c.fs.ReadFile(filepath.Join(cardPath, "mem_info_vram_total")); err == nil {
 			if vram, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64); err == nil {
 				gpu.VRAM = int(vram / 1024 / 1024) // Convert to MB
 			}
 		}
 
 		// Get GPU utilization from gpu_busy_percent
-		if data, err := os.ReadFile(filepath.Join(cardPath, "gpu_busy_percent")); err == nil {
+		if data, err := c.fs.ReadFile(filepath.Join(cardPath, "gpu_busy_percent")); err == nil {
 			if util, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil {
 				gpu.Utilization = &util
 			}
 		}
 
 		// Get PCI bus ID
-		if data, err := os.ReadFile(filepath.Join(cardPath, "uevent")); err == nil {
+		if data, err := c.fs.ReadFile(filepath.Join(cardPath, "uevent")); err == nil {
 			lines := strings.Split(string(data), "\n")
 			for _, line := range lines {
 				if strings.HasPrefix(line, "PCI_SLOT_NAME=") {
@@ -571,6 +667,8 @@ func (c *Collector) GetCPUStats() (*CPUStats, error) {
 		stats.PowerDraw = &power
 	}
 
+	c.addLoadStats(stats)
+
 	return stats, nil
 }
 
@@ -578,14 +676,14 @@ func (c *Collector) GetCPUStats() (*CPUStats, error) {
 func (c *Collector) getCPUTemperature() int {
 	// Try k10temp for AMD, coretemp for Intel
 	hwmonPath := "/sys/class/hwmon"
-	entries, err := os.ReadDir(hwmonPath)
+	entries, err := c.fs.ReadDir(hwmonPath)
 	if err != nil {
 		return 0
 	}
 
 	for _, entry := range entries {
 		namePath := filepath.Join(hwmonPath, entry.Name(), "name")
-		nameData, err := os.ReadFile(namePath)
+		nameData, err := c.fs.ReadFile(namePath)
 		if err != nil {
 			continue
 		}
@@ -594,7 +692,7 @@ func (c *Collector) getCPUTemperature() int {
 		// Look for CPU temperature sensors
 		if name == "k10temp" || name == "coretemp" || name == "zenpower" {
 			tempPath := filepath.Join(hwmonPath, entry.Name(), "temp1_input")
-			tempData, err := os.ReadFile(tempPath)
+			tempData, err := c.fs.ReadFile(tempPath)
 			if err != nil {
 				continue
 			}
@@ -612,7 +710,7 @@ func (c *Collector) getCPUTemperature() int {
 	}
 
 	for _, path := range paths {
-		data, err := os.ReadFile(path)
+		data, err := c.fs.ReadFile(path)
 		if err != nil {
 			continue
 		}
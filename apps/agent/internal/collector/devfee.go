@@ -0,0 +1,153 @@
+package collector
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Dev-fee tracking settings
+const (
+	devFeeMaxInterval = 10 * time.Minute // Longer pool switches are failovers
+	devFeeObserveMin  = time.Hour        // Tracking before the observed share is reported
+)
+
+// DevFee is the share of a miner's time that mines for its developer
+type DevFee struct {
+	Percent     float64  `json:"percent"`            // Advertised fee
+	Source      string   `json:"source"`             // "api" or "default" (published fee for the miner and algorithm)
+	Mining      bool     `json:"mining,omitempty"`   // In a dev-fee interval now
+	Intervals   int      `json:"intervals"`          // Dev-fee intervals seen since the miner started
+	Seconds     int      `json:"seconds"`            // Time spent in them
+	Observed    *float64 `json:"observed,omitempty"` // Percent of the tracked time, after an hour
+	Effective   float64  `json:"effective"`          // Observed where known, else advertised
+	NetHashrate float64  `json:"netHashrate"`        // H/s left for the user's pool
+}
+
+// Published dev fees (%) by miner and algorithm; "" is the miner's default
+var devFees = map[string]map[string]float64{
+	"t-rex":        {"": 1, "octopus": 2},
+	"lolminer":     {"": 1, "ethash": 0.7, "etchash": 0.7},
+	"gminer":       {"": 2, "ethash": 1, "etchash": 1},
+	"nbminer":      {"": 2, "ethash": 1, "etchash": 1},
+	"teamredminer": {"": 2.5, "ethash": 0.75, "etchash": 0.75, "kawpow": 2, "autolykos2": 2},
+	"xmrig":        {"": 1},
+	"srbminer":     {"": 0.85},
+	"bzminer":      {"": 1, "ethash": 0.5, "etchash": 0.5},
+	"phoenixminer": {"": 0.65},
+	"claymore":     {"": 1},
+	"cpuminer-opt": {"": 0},
+}
+
+// devFeeTracker times the miner's switches away from the user's pool.
+// Miners don't announce dev-fee mining in their APIs, but they report the
+// pool they are connected to, which changes while the fee is mined.
+type devFeeTracker struct {
+	mu        sync.Mutex
+	miner     string
+	uptime    int
+	started   time.Time // First poll of this miner run
+	lastPoll  time.Time
+	pool      string    // The user's pool
+	away      time.Time // Start of the current switch, zero on the user's pool
+	intervals int
+	spent     time.Duration // In finished intervals
+}
+
+// trackDevFee fills the dev-fee fields of a miner from the fee its API
+// reports, or the published fee, and the dev-fee intervals seen so far
+func (c *Collector) trackDevFee(stats *MinerStats) {
+	if stats == nil || !stats.Running {
+		return
+	}
+	if stats.DevFee == nil {
+		percent, ok := defaultDevFee(stats.Name, stats.Algorithm)
+		if !ok {
+			return
+		}
+		stats.DevFee = &DevFee{Percent: percent, Source: "default"}
+	}
+	fee := stats.DevFee
+
+	t := &c.devFee
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+
+	// A new miner, or the same one restarted, starts over
+	if t.miner != stats.Name || stats.Uptime < t.uptime {
+		t.miner, t.started, t.lastPoll = stats.Name, now, time.Time{}
+		t.pool, t.away, t.intervals, t.spent = "", time.Time{}, 0, 0
+	}
+	t.uptime = stats.Uptime
+
+	// Switches happen between two polls; the midpoint is the best guess
+	switchedAt := now
+	if !t.lastPoll.IsZero() {
+		switchedAt = t.lastPoll.Add(now.Sub(t.lastPoll) / 2)
+	}
+
+	pool := poolHost(stats.Pool)
+	switch {
+	case pool == "":
+		// API not answering yet
+	case t.pool == "":
+		t.pool = pool
+	case pool == t.pool:
+		if !t.away.IsZero() {
+			t.intervals++
+			t.spent += switchedAt.Sub(t.away)
+			t.away = time.Time{}
+		}
+	case t.away.IsZero():
+		t.away = switchedAt
+	case now.Sub(t.away) > devFeeMaxInterval:
+		// Too long for a dev fee: the miner failed over to another pool
+		t.pool = pool
+		t.away = time.Time{}
+	}
+	t.lastPoll = now
+
+	spent := t.spent
+	if !t.away.IsZero() {
+		fee.Mining = true
+		spent += now.Sub(t.away)
+	}
+	fee.Intervals = t.intervals
+	fee.Seconds = int(spent.Seconds())
+	fee.Effective = fee.Percent
+	if tracked := now.Sub(t.started); tracked >= devFeeObserveMin && t.intervals > 0 {
+		observed := float64(int(spent.Seconds()/tracked.Seconds()*10000+0.5)) / 100
+		fee.Observed = &observed
+		fee.Effective = observed
+	}
+	fee.NetHashrate = stats.Hashrate * (1 - fee.Effective/100)
+}
+
+// defaultDevFee returns the published fee of a miner for an algorithm
+func defaultDevFee(miner, algorithm string) (float64, bool) {
+	fees, ok := devFees[miner]
+	if !ok {
+		return 0, false
+	}
+	if fee, ok := fees[strings.ToLower(algorithm)]; ok {
+		return fee, true
+	}
+	return fees[""], true
+}
+
+// poolHost reduces a pool URL to host:port, since miners report the same
+// pool with and without scheme or user
+func poolHost(pool string) string {
+	pool = strings.TrimSpace(pool)
+	if i := strings.Index(pool, "://"); i >= 0 {
+		pool = pool[i+3:]
+	}
+	if i := strings.LastIndex(pool, "@"); i >= 0 {
+		pool = pool[i+1:]
+	}
+	if i := strings.Index(pool, "/"); i >= 0 {
+		pool = pool[:i]
+	}
+	return strings.ToLower(pool)
+}
@@ -0,0 +1,180 @@
+package collector
+
+import (
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FanFault is a GPU fan that stopped or spins far below its commanded speed
+type FanFault struct {
+	BusID     string `json:"busId"`
+	Name      string `json:"name,omitempty"`
+	Vendor    string `json:"vendor"`
+	Reason    string `json:"reason"`    // "stopped" or "slow"
+	Commanded int    `json:"commanded"` // Percent
+	RPM       int    `json:"rpm"`
+	Expected  int    `json:"expected,omitempty"` // RPM
+	Since     int64  `json:"since"`              // Unix seconds
+	New       bool   `json:"-"`                  // First reported in this check
+}
+
+// Fan fault thresholds
+const (
+	fanMinCommanded = 30  // Percent; below it zero-RPM idle modes may stop the fan
+	fanSlowFraction = 0.4 // Of the expected RPM
+	fanFaultSamples = 2   // Consecutive bad samples before reporting
+)
+
+// fanMonitor learns each fan's RPM per commanded percent and tracks faults
+type fanMonitor struct {
+	mu          sync.Mutex
+	rpmPerPct   map[string]float64   // Bus ID -> highest healthy RPM per percent
+	badSamples  map[string]int       // Bus ID -> consecutive bad samples
+	faultsSince map[string]time.Time // Bus ID -> first reported
+}
+
+var nvSettingsFanRPM = regexp.MustCompile(`\[fan:(\d+)\]\):\s*(\d+)`)
+
+// headlessXSocket is the socket of the X server the executor starts for
+// nvidia-settings (display :9)
+const headlessXSocket = "/tmp/.X11-unix/X9"
+
+// CheckFans compares each GPU's commanded fan percent with the measured
+// RPM. GPUs without an RPM reading are skipped.
+func (c *Collector) CheckFans(gpus []GPUStats) []FanFault {
+	m := &c.fans
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.rpmPerPct == nil {
+		m.rpmPerPct = map[string]float64{}
+		m.badSamples = map[string]int{}
+		m.faultsSince = map[string]time.Time{}
+	}
+
+	var faults []FanFault
+	for _, gpu := range gpus {
+		if gpu.FanSpeed == nil || gpu.FanRPM == nil || gpu.BusID == "" {
+			continue
+		}
+		busID := normalizeBusID(gpu.BusID)
+		commanded, rpm := *gpu.FanSpeed, *gpu.FanRPM
+
+		// Expected RPM from the fan's rated maximum or what it did before
+		expected := 0
+		if gpu.FanMaxRPM != nil && *gpu.FanMaxRPM > 0 {
+			expected = *gpu.FanMaxRPM * commanded / 100
+		} else if ratio := m.rpmPerPct[busID]; ratio > 0 {
+			expected = int(ratio * float64(commanded))
+		}
+
+		reason := ""
+		switch {
+		case commanded < fanMinCommanded:
+		case rpm == 0:
+			reason = "stopped"
+		case expected > 0 && float64(rpm) < float64(expected)*fanSlowFraction:
+			reason = "slow"
+		}
+
+		if reason == "" {
+			if commanded >= fanMinCommanded {
+				if ratio := float64(rpm) / float64(commanded); ratio > m.rpmPerPct[busID] {
+					m.rpmPerPct[busID] = ratio
+				}
+			}
+			delete(m.badSamples, busID)
+			delete(m.faultsSince, busID)
+			continue
+		}
+
+		m.badSamples[busID]++
+		if m.badSamples[busID] < fanFaultSamples {
+			continue
+		}
+		fault := FanFault{
+			BusID:     busID,
+			Name:      gpu.Name,
+			Vendor:    gpu.Vendor,
+			Reason:    reason,
+			Commanded: commanded,
+			RPM:       rpm,
+			Expected:  expected,
+		}
+		since, ok := m.faultsSince[busID]
+		if !ok {
+			since = time.Now()
+			m.faultsSince[busID] = since
+			fault.New = true
+		}
+		fault.Since = since.Unix()
+		faults = append(faults, fault)
+	}
+	return faults
+}
+
+// addNvidiaFanRPM reads measured fan speeds through nvidia-settings, which
+// needs an X server: the desktop's or the executor's headless one.
+// nvidia-smi only reports the commanded percent.
+func (c *Collector) addNvidiaFanRPM(gpus []GPUStats) {
+	if len(gpus) == 0 {
+		return
+	}
+	display := os.Getenv("DISPLAY")
+	if display == "" {
+		if _, err := c.fs.Stat(headlessXSocket); err != nil {
+			return
+		}
+		display = ":9"
+	}
+	if _, err := c.run.LookPath("nvidia-settings"); err != nil {
+		return
+	}
+
+	output, err := c.run.Command("nvidia-settings", "-c", display, "-q", "GPUCurrentFanSpeedRPM").Output()
+	if err != nil {
+		return
+	}
+	rpms := map[int]int{}
+	for _, match := range nvSettingsFanRPM.FindAllStringSubmatch(string(output), -1) {
+		fan, _ := strconv.Atoi(match[1])
+		rpm, _ := strconv.Atoi(match[2])
+		rpms[fan] = rpm
+	}
+
+	// Fans are numbered across the rig; assume the same count per GPU and
+	// report the slowest fan of each card
+	fansPerGPU := len(rpms) / len(gpus)
+	if fansPerGPU == 0 || len(rpms)%len(gpus) != 0 {
+		return
+	}
+	for i := range gpus {
+		slowest := -1
+		for fan := i * fansPerGPU; fan < (i+1)*fansPerGPU; fan++ {
+			if rpm, ok := rpms[fan]; ok && (slowest < 0 || rpm < slowest) {
+				slowest = rpm
+			}
+		}
+		if slowest >= 0 {
+			rpm := slowest
+			gpus[i].FanRPM = &rpm
+		}
+	}
+}
+
+// readSysfsIntPtr reads an integer sysfs attribute, nil if missing
+func (c *Collector) readSysfsIntPtr(path string) *int {
+	data, err := c.fs.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	v, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil
+	}
+	return &v
+}
@@ -0,0 +1,450 @@
+package collector
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/mem"
+)
+
+// Inventory is a full hardware inventory of the rig, collected on demand
+type Inventory struct {
+	Board   BoardInfo        `json:"board"`
+	BIOS    BIOSInfo         `json:"bios"`
+	CPU     CPUInventory     `json:"cpu"`
+	Memory  MemoryInventory  `json:"memory"`
+	GPUs    []GPUInventory   `json:"gpus"`
+	Storage []StorageDevice  `json:"storage"`
+	NICs    []NetworkAdapter `json:"nics"`
+}
+
+// BoardInfo describes the motherboard
+type BoardInfo struct {
+	SystemVendor  string `json:"systemVendor"`
+	SystemProduct string `json:"systemProduct"`
+	Vendor        string `json:"vendor"`
+	Name          string `json:"name"`
+	Version       string `json:"version"`
+}
+
+// BIOSInfo describes the system firmware
+type BIOSInfo struct {
+	Vendor  string `json:"vendor"`
+	Version string `json:"version"`
+	Date    string `json:"date"`
+}
+
+// CPUInventory describes the installed CPU
+type CPUInventory struct {
+	Model   string `json:"model"`
+	Vendor  string `json:"vendor"`
+	Cores   int    `json:"cores"`
+	Threads int    `json:"threads"`
+	MaxMHz  int    `json:"maxMhz"`
+	CacheKB int    `json:"cacheKb"`
+	Sockets int    `json:"sockets"`
+}
+
+// MemoryInventory describes system RAM and the installed modules
+type MemoryInventory struct {
+	Total   uint64         `json:"total"`
+	Modules []MemoryModule `json:"modules,omitempty"`
+}
+
+// MemoryModule is a single populated DIMM slot (from dmidecode)
+type MemoryModule struct {
+	Locator      string `json:"locator"`
+	SizeMB       int    `json:"sizeMb"`
+	Type         string `json:"type"`
+	SpeedMTs     int    `json:"speedMts"`
+	Manufacturer string `json:"manufacturer"`
+	PartNumber   string `json:"partNumber"`
+}
+
+// GPUInventory holds static identification data for a GPU
+type GPUInventory struct {
+	BusID           string `json:"busId"`
+	Name            string `json:"name"`
+	Vendor          string `json:"vendor"`
+	VendorID        string `json:"vendorId"`
+	DeviceID        string `json:"deviceId"`
+	SubsystemVendor string `json:"subsystemVendor"`
+	SubsystemDevice string `json:"subsystemDevice"`
+	Brand           string `json:"brand,omitempty"` // Decoded from the subsystem vendor
+	Model           string `json:"model,omitempty"` // Exact board, e.g. "ASUS TUF RTX 3080 V2 LHR"
+	VBIOS           string `json:"vbios"`
+	VRAM            int    `json:"vram"`
+	MemoryVendor    string `json:"memoryVendor,omitempty"`
+	Driver          string `json:"driver"`
+}
+
+// StorageDevice is a block device
+type StorageDevice struct {
+	Name       string `json:"name"`
+	Model      string `json:"model"`
+	Serial     string `json:"serial,omitempty"`
+	Size       uint64 `json:"size"` // Bytes
+	Rotational bool   `json:"rotational"`
+	Removable  bool   `json:"removable"`
+}
+
+// NetworkAdapter is a physical network interface
+type NetworkAdapter struct {
+	Name   string   `json:"name"`
+	MAC    string   `json:"mac"`
+	MTU    int      `json:"mtu"`
+	Speed  int      `json:"speed,omitempty"` // Mbit/s
+	Driver string   `json:"driver,omitempty"`
+	Addrs  []string `json:"addrs,omitempty"`
+}
+
+// PCI vendor IDs for GPU vendors
+var gpuVendorIDs = map[string]string{
+	"0x10de": "NVIDIA",
+	"0x1002": "AMD",
+	"0x8086": "INTEL",
+}
+
+// GetInventory collects a complete hardware inventory. This is expensive
+// (dmidecode, PCI walk, nvidia-smi) and is only run on demand.
+func (c *Collector) GetInventory() (*Inventory, error) {
+	inv := &Inventory{
+		Board: BoardInfo{
+			SystemVendor:  c.readSysfs("/sys/class/dmi/id/sys_vendor"),
+			SystemProduct: c.readSysfs("/sys/class/dmi/id/product_name"),
+			Vendor:        c.readSysfs("/sys/class/dmi/id/board_vendor"),
+			Name:          c.readSysfs("/sys/class/dmi/id/board_name"),
+			Version:       c.readSysfs("/sys/class/dmi/id/board_version"),
+		},
+		BIOS: BIOSInfo{
+			Vendor:  c.readSysfs("/sys/class/dmi/id/bios_vendor"),
+			Version: c.readSysfs("/sys/class/dmi/id/bios_version"),
+			Date:    c.readSysfs("/sys/class/dmi/id/bios_date"),
+		},
+	}
+
+	inv.CPU = c.getCPUInventory()
+
+	if memInfo, err := mem.VirtualMemory(); err == nil {
+		inv.Memory.Total = memInfo.Total
+	}
+	inv.Memory.Modules = c.getMemoryModules()
+
+	inv.GPUs = c.getGPUInventory()
+	inv.Storage = c.getStorageDevices()
+	inv.NICs = c.getNetworkAdapters()
+
+	return inv, nil
+}
+
+// getCPUInventory reads static CPU information
+func (c *Collector) getCPUInventory() CPUInventory {
+	var inv CPUInventory
+
+	cpuInfo, err := cpu.Info()
+	if err != nil || len(cpuInfo) == 0 {
+		return inv
+	}
+
+	inv.Model = cpuInfo[0].ModelName
+	inv.Vendor = cpuInfo[0].VendorID
+	inv.CacheKB = int(cpuInfo[0].CacheSize)
+	inv.Cores, _ = cpu.Counts(false)
+	inv.Threads, _ = cpu.Counts(true)
+
+	// Count distinct physical packages
+	sockets := make(map[string]bool)
+	for _, info := range cpuInfo {
+		sockets[info.PhysicalID] = true
+	}
+	inv.Sockets = len(sockets)
+
+	// cpuinfo_max_freq is in kHz
+	if val, err := strconv.Atoi(c.readSysfs("/sys/devices/system/cpu/cpu0/cpufreq/cpuinfo_max_freq")); err == nil {
+		inv.MaxMHz = val / 1000
+	} else {
+		inv.MaxMHz = int(cpuInfo[0].Mhz)
+	}
+
+	return inv
+}
+
+// getMemoryModules parses dmidecode memory device entries (requires root)
+func (c *Collector) getMemoryModules() []MemoryModule {
+	output, err := c.run.Command("dmidecode", "-t", "17").Output()
+	if err != nil {
+		return nil
+	}
+
+	var modules []MemoryModule
+	var current *MemoryModule
+
+	flush := func() {
+		if current != nil && current.SizeMB > 0 {
+			modules = append(modules, *current)
+		}
+		current = nil
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(string(output)))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "Memory Device" {
+			flush()
+			current = &MemoryModule{}
+			continue
+		}
+		if current == nil {
+			continue
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key := strings.TrimSpace(parts[0])
+		value := strings.TrimSpace(parts[1])
+
+		switch key {
+		case "Size":
+			// "8192 MB", "16 GB" or "No Module Installed"
+			fields := strings.Fields(value)
+			if len(fields) == 2 {
+				if size, err := strconv.Atoi(fields[0]); err == nil {
+					if fields[1] == "GB" {
+						size *= 1024
+					}
+					current.SizeMB = size
+				}
+			}
+		case "Locator":
+			current.Locator = value
+		case "Type":
+			current.Type = value
+		case "Speed":
+			if fields := strings.Fields(value); len(fields) > 0 {
+				current.SpeedMTs, _ = strconv.Atoi(fields[0])
+			}
+		case "Manufacturer":
+			current.Manufacturer = value
+		case "Part Number":
+			current.PartNumber = value
+		}
+	}
+	flush()
+
+	return modules
+}
+
+// getGPUInventory walks the PCI bus for display controllers
+func (c *Collector) getGPUInventory() []GPUInventory {
+	var gpus []GPUInventory
+
+	pciPath := "/sys/bus/pci/devices"
+	entries, err := c.fs.ReadDir(pciPath)
+	if err != nil {
+		return nil
+	}
+
+	nvidiaInfo := c.getNvidiaInventoryInfo()
+
+	for _, entry := range entries {
+		devPath := filepath.Join(pciPath, entry.Name())
+
+		// 0x03xxxx = display controller
+		if !strings.HasPrefix(c.readSysfs(filepath.Join(devPath, "class")), "0x03") {
+			continue
+		}
+
+		vendorID := c.readSysfs(filepath.Join(devPath, "vendor"))
+		gpu := GPUInventory{
+			BusID:           entry.Name(),
+			Vendor:          gpuVendorIDs[vendorID],
+			VendorID:        vendorID,
+			DeviceID:        c.readSysfs(filepath.Join(devPath, "device")),
+			SubsystemVendor: c.readSysfs(filepath.Join(devPath, "subsystem_vendor")),
+			SubsystemDevice: c.readSysfs(filepath.Join(devPath, "subsystem_device")),
+		}
+		if gpu.Vendor == "" {
+			gpu.Vendor = "UNKNOWN"
+		}
+
+		if link, err := os.Readlink(filepath.Join(devPath, "driver")); err == nil {
+			gpu.Driver = filepath.Base(link)
+		}
+
+		switch gpu.Vendor {
+		case "NVIDIA":
+			if info, ok := nvidiaInfo[normalizeBusID(gpu.BusID)]; ok {
+				gpu.Name = info.Name
+				gpu.VBIOS = info.VBIOS
+				gpu.VRAM = info.VRAM
+			}
+		case "AMD":
+			gpu.Name = c.readSysfs(filepath.Join(devPath, "product_name"))
+			gpu.VBIOS = c.readSysfs(filepath.Join(devPath, "vbios_version"))
+			gpu.MemoryVendor = c.readSysfs(filepath.Join(devPath, "mem_info_vram_vendor"))
+			if vram, err := strconv.ParseInt(c.readSysfs(filepath.Join(devPath, "mem_info_vram_total")), 10, 64); err == nil {
+				gpu.VRAM = int(vram / 1024 / 1024)
+			}
+		}
+
+		if gpu.Name == "" {
+			gpu.Name = c.lspciName(gpu.BusID)
+		}
+		if card := c.cardID(gpu.BusID, gpu.Name); card != nil {
+			gpu.Brand = card.Brand
+			gpu.Model = card.Model
+		}
+
+		gpus = append(gpus, gpu)
+	}
+
+	return gpus
+}
+
+// getNvidiaInventoryInfo queries vBIOS versions from nvidia-smi, keyed by bus ID
+func (c *Collector) getNvidiaInventoryInfo() map[string]GPUInventory {
+	result := make(map[string]GPUInventory)
+
+	output, err := c.run.Command("nvidia-smi",
+		"--query-gpu=pci.bus_id,name,vbios_version,memory.total",
+		"--format=csv,noheader,nounits").Output()
+	if err != nil {
+		return result
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(string(output)))
+	for scanner.Scan() {
+		parts := strings.Split(scanner.Text(), ",")
+		if len(parts) < 4 {
+			continue
+		}
+		info := GPUInventory{
+			Name:  strings.TrimSpace(parts[1]),
+			VBIOS: strings.TrimSpace(parts[2]),
+		}
+		if vram := parseIntPtr(parts[3]); vram != nil {
+			info.VRAM = *vram
+		}
+		result[normalizeBusID(parts[0])] = info
+	}
+
+	return result
+}
+
+// getStorageDevices lists physical block devices from sysfs
+func (c *Collector) getStorageDevices() []StorageDevice {
+	var devices []StorageDevice
+
+	entries, err := c.fs.ReadDir("/sys/block")
+	if err != nil {
+		return nil
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "ram") ||
+			strings.HasPrefix(name, "zram") || strings.HasPrefix(name, "dm-") {
+			continue
+		}
+
+		blockPath := filepath.Join("/sys/block", name)
+		dev := StorageDevice{
+			Name:       name,
+			Model:      c.readSysfs(filepath.Join(blockPath, "device", "model")),
+			Serial:     c.readSysfs(filepath.Join(blockPath, "device", "serial")),
+			Rotational: c.readSysfs(filepath.Join(blockPath, "queue", "rotational")) == "1",
+			Removable:  c.readSysfs(filepath.Join(blockPath, "removable")) == "1",
+		}
+
+		// size is always in 512-byte sectors
+		if sectors, err := strconv.ParseUint(c.readSysfs(filepath.Join(blockPath, "size")), 10, 64); err == nil {
+			dev.Size = sectors * 512
+		}
+
+		devices = append(devices, dev)
+	}
+
+	return devices
+}
+
+// getNetworkAdapters lists physical network interfaces
+func (c *Collector) getNetworkAdapters() []NetworkAdapter {
+	var adapters []NetworkAdapter
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+
+	for _, iface := range ifaces {
+		// Only interfaces backed by a device (skips lo, docker, veth, etc.)
+		devicePath := filepath.Join("/sys/class/net", iface.Name, "device")
+		if _, err := c.fs.Stat(devicePath); err != nil {
+			continue
+		}
+
+		adapter := NetworkAdapter{
+			Name: iface.Name,
+			MAC:  iface.HardwareAddr.String(),
+			MTU:  iface.MTU,
+		}
+
+		if speed, err := strconv.Atoi(c.readSysfs(filepath.Join("/sys/class/net", iface.Name, "speed"))); err == nil && speed > 0 {
+			adapter.Speed = speed
+		}
+		if link, err := os.Readlink(filepath.Join(devicePath, "driver")); err == nil {
+			adapter.Driver = filepath.Base(link)
+		}
+		if addrs, err := iface.Addrs(); err == nil {
+			for _, addr := range addrs {
+				adapter.Addrs = append(adapter.Addrs, addr.String())
+			}
+		}
+
+		adapters = append(adapters, adapter)
+	}
+
+	return adapters
+}
+
+// lspciName returns the device description reported by lspci
+func (c *Collector) lspciName(busID string) string {
+	output, err := c.run.Command("lspci", "-s", busID).Output()
+	if err != nil {
+		return ""
+	}
+	// "01:00.0 VGA compatible controller: NVIDIA Corporation GA102 [GeForce RTX 3080]"
+	parts := strings.SplitN(strings.TrimSpace(string(output)), ": ", 2)
+	if len(parts) != 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+// normalizeBusID converts nvidia-smi style bus IDs (00000000:01:00.0) to
+// the sysfs form (0000:01:00.0)
+func normalizeBusID(busID string) string {
+	busID = strings.ToLower(strings.TrimSpace(busID))
+	parts := strings.SplitN(busID, ":", 2)
+	if len(parts) == 2 && len(parts[0]) > 4 {
+		return parts[0][len(parts[0])-4:] + ":" + parts[1]
+	}
+	return busID
+}
+
+// readSysfs reads a sysfs attribute, returning "" on error
+func (c *Collector) readSysfs(path string) string {
+	data, err := c.fs.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,57 @@
+package collector
+
+import (
+	"math"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/load"
+)
+
+// addLoadStats adds load averages, iowait/steal percentages and the
+// context switch rate. I/O stalls (e.g. a dying USB boot drive) show up
+// here long before CPU usage moves.
+func (c *Collector) addLoadStats(stats *CPUStats) {
+	if avg, err := load.Avg(); err == nil {
+		stats.Load1 = roundPtr(avg.Load1)
+		stats.Load5 = roundPtr(avg.Load5)
+		stats.Load15 = roundPtr(avg.Load15)
+	}
+
+	if times, err := cpu.Times(false); err == nil && len(times) > 0 {
+		current := times[0]
+		if prev := c.prevCPUTimes; prev != nil {
+			total := cpuTotal(current) - cpuTotal(*prev)
+			if total > 0 {
+				stats.IOWait = roundPtr((current.Iowait - prev.Iowait) / total * 100)
+				stats.Steal = roundPtr((current.Steal - prev.Steal) / total * 100)
+			}
+		}
+		c.prevCPUTimes = &current
+	}
+
+	if misc, err := load.Misc(); err == nil {
+		blocked := misc.ProcsBlocked
+		stats.ProcsBlocked = &blocked
+
+		now := time.Now()
+		if !c.prevCtxtAt.IsZero() && uint64(misc.Ctxt) >= c.prevCtxt {
+			if elapsed := now.Sub(c.prevCtxtAt).Seconds(); elapsed > 0 {
+				stats.ContextSwitches = roundPtr(float64(uint64(misc.Ctxt)-c.prevCtxt) / elapsed)
+			}
+		}
+		c.prevCtxt = uint64(misc.Ctxt)
+		c.prevCtxtAt = now
+	}
+}
+
+// cpuTotal sums all CPU time counters; guest time is already included in
+// user and nice
+func cpuTotal(t cpu.TimesStat) float64 {
+	return t.User + t.System + t.Idle + t.Nice + t.Iowait + t.Irq + t.Softirq + t.Steal
+}
+
+func roundPtr(v float64) *float64 {
+	v = math.Round(v*100) / 100
+	return &v
+}
@@ -4,8 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
-	"os/exec"
 	"strconv"
 	"strings"
 	"time"
@@ -25,6 +25,38 @@ type MinerStats struct {
 	} `json:"shares"`
 	Uptime    int           `json:"uptime"` // Seconds
 	GPUStats  []GPUMinerStats `json:"gpuStats,omitempty"`
+	CPUThreads int          `json:"cpuThreads,omitempty"` // Threads mining on the CPU, CPU miners only
+
+	// Derived from the accepted counter over recent polls
+	SharesPerMinute *float64 `json:"sharesPerMinute,omitempty"`
+	LastShareAgo    *int     `json:"lastShareAgo,omitempty"` // Seconds since the last accepted share
+	SharesStalled   bool     `json:"sharesStalled,omitempty"` // Hashing but no accepted share for 20 minutes
+	StallNew        bool     `json:"-"`                       // Stall first reported in this poll
+
+	// Current share difficulty in hashes per share, where the miner API
+	// reports it, and the hashrate the pool credits: accepted shares times
+	// their difficulty over the last hour. Pools pay on the latter.
+	Difficulty        float64  `json:"difficulty,omitempty"`
+	EffectiveHashrate *float64 `json:"effectiveHashrate,omitempty"` // H/s
+
+	// Developer fee and the hashrate left after it
+	DevFee *DevFee `json:"devFee,omitempty"`
+
+	// Per-algorithm breakdown, set only when dual mining. The top-level
+	// fields above always describe the primary algorithm.
+	Primary   *AlgorithmStats `json:"primary,omitempty"`
+	Secondary *AlgorithmStats `json:"secondary,omitempty"`
+}
+
+// AlgorithmStats holds the stats of one algorithm of a dual-mining miner
+type AlgorithmStats struct {
+	Algorithm string  `json:"algorithm"`
+	Pool      string  `json:"pool"`
+	Hashrate  float64 `json:"hashrate"` // H/s
+	Shares    struct {
+		Accepted int `json:"accepted"`
+		Rejected int `json:"rejected"`
+	} `json:"shares"`
 }
 
 // GPUMinerStats holds per-GPU stats from a miner
@@ -34,13 +66,20 @@ type GPUMinerStats struct {
 	Temperature int    `json:"temperature"`
 	FanSpeed   int     `json:"fanSpeed"`
 	Power      int     `json:"power"`
+	LHRUnlock  *float64 `json:"lhrUnlock,omitempty"` // Percent of full hashrate unlocked (LHR cards)
+	LHRTune    *float64 `json:"lhrTune,omitempty"`   // Current LHR tune value
+	SecondaryHashrate float64 `json:"secondaryHashrate,omitempty"` // Dual mining: H/s of the secondary algorithm
+	BusID      string   `json:"busId,omitempty"` // PCI address as seen by the miner, where reported
+	Accepted   *int     `json:"accepted,omitempty"` // Accepted shares, where the miner counts them per GPU
+	SharesPerMinute *float64 `json:"sharesPerMinute,omitempty"`
+	LastShareAgo    *int     `json:"lastShareAgo,omitempty"` // Seconds
 }
 
 // Known miner processes and their API ports
 var minerAPIs = map[string]struct {
 	processes []string
 	port      int
-	apiType   string // "http" or "ccminer"
+	apiType   string // "http", "ccminer" or "cdm" (Claymore JSON-RPC over TCP)
 }{
 	"t-rex":          {[]string{"t-rex"}, 4067, "http"},
 	"lolminer":       {[]string{"lolMiner", "lolminer"}, 4068, "http"},
@@ -50,19 +89,46 @@ var minerAPIs = map[string]struct {
 	"nbminer":        {[]string{"nbminer"}, 4072, "http"},
 	"srbminer":       {[]string{"SRBMiner-MULTI", "srbminer-multi"}, 4073, "http"},
 	"bzminer":        {[]string{"bzminer"}, 4074, "http"},
+	"phoenixminer":   {[]string{"PhoenixMiner"}, 4075, "cdm"},
+	"claymore":       {[]string{"ethdcrminer64"}, 4076, "cdm"},
+	"cpuminer-opt":   {[]string{"cpuminer"}, 4077, "ccminer"},
 }
 
 // DetectRunningMiner detects which miner is currently running
 func (c *Collector) DetectRunningMiner() *MinerStats {
+	stats := c.detectRunningMiner()
+	c.trackShares(stats)
+	c.trackDevFee(stats)
+
+	c.minerMu.Lock()
+	c.lastMiner = stats
+	c.minerMu.Unlock()
+	return stats
+}
+
+// LastMinerStats returns the result of the latest DetectRunningMiner call
+func (c *Collector) LastMinerStats() *MinerStats {
+	c.minerMu.Lock()
+	defer c.minerMu.Unlock()
+	return c.lastMiner
+}
+
+func (c *Collector) detectRunningMiner() *MinerStats {
+	// Miners without an API, parsed from their output
+	if stats := c.outputMinerStats(); stats != nil {
+		return stats
+	}
+
 	for minerName, info := range minerAPIs {
 		for _, procName := range info.processes {
 			// Check if process is running
-			cmd := exec.Command("pgrep", "-x", procName)
+			cmd := c.run.Command("pgrep", "-x", procName)
 			if err := cmd.Run(); err == nil {
 				// Process found, try to get stats from API
-				stats := c.getMinerStats(minerName, info.port)
-				if stats != nil {
-					return stats
+				for _, api := range c.apiEndpoints(minerName, info.port) {
+					if stats := c.getMinerStats(minerName, api); stats != nil {
+						return stats
+					}
 				}
 				
 				// Process running but API not responding
@@ -79,12 +145,13 @@ func (c *Collector) DetectRunningMiner() *MinerStats {
 }
 
 // getMinerStats fetches stats from a miner's HTTP API
-func (c *Collector) getMinerStats(minerName string, port int) *MinerStats {
+func (c *Collector) getMinerStats(minerName string, api MinerEndpoint) *MinerStats {
 	client := &http.Client{Timeout: 2 * time.Second}
+	port := api.Port
 	
 	switch minerName {
 	case "t-rex":
-		return c.getTrexStats(client, port)
+		return c.getTrexStats(client, api)
 	case "lolminer":
 		return c.getLolMinerStats(client, port)
 	case "gminer":
@@ -92,19 +159,30 @@ func (c *Collector) getMinerStats(minerName string, port int) *MinerStats {
 	case "teamredminer":
 		return c.getTeamRedMinerStats(client, port)
 	case "xmrig":
-		return c.getXMRigStats(client, port)
+		return c.getXMRigStats(client, api)
 	case "nbminer":
 		return c.getNBMinerStats(client, port)
 	case "srbminer":
 		return c.getSRBMinerStats(client, port)
+	case "phoenixminer", "claymore":
+		return c.getCDMStats(minerName, api)
+	case "cpuminer-opt":
+		return c.getCCMinerStats(minerName, port)
 	default:
 		return nil
 	}
 }
 
 // getTrexStats fetches T-Rex miner stats
-func (c *Collector) getTrexStats(client *http.Client, port int) *MinerStats {
-	url := fmt.Sprintf("http://127.0.0.1:%d/summary", port)
+func (c *Collector) getTrexStats(client *http.Client, api MinerEndpoint) *MinerStats {
+	sid, err := c.trexSession(client, api)
+	if err != nil {
+		return nil
+	}
+	url := fmt.Sprintf("http://%s/summary", api.address())
+	if sid != "" {
+		url += "?sid=" + sid
+	}
 	resp, err := client.Get(url)
 	if err != nil {
 		return nil
@@ -122,20 +200,47 @@ func (c *Collector) getTrexStats(client *http.Client, port int) *MinerStats {
 		Accepted  int     `json:"accepted_count"`
 		Rejected  int     `json:"rejected_count"`
 		Pool      struct {
-			URL string `json:"url"`
+			URL        string     `json:"url"`
+			Difficulty difficulty `json:"difficulty"`
 		} `json:"active_pool"`
 		GPUs []struct {
 			DeviceID    int     `json:"device_id"`
+			PCIDomain   int     `json:"pci_domain"`
+			PCIBus      int     `json:"pci_bus"`
+			PCIID       int     `json:"pci_id"`
 			Hashrate    float64 `json:"hashrate"`
 			Temperature int     `json:"temperature"`
 			Fan         int     `json:"fan_speed"`
 			Power       int     `json:"power"`
+			LHRTune     *float64 `json:"lhr_tune"`
+			LHRUnlock   *float64 `json:"lhr_unlock_percent"`
+			Shares      struct {
+				Accepted *int `json:"accepted_count"`
+			} `json:"shares"`
 		} `json:"gpus"`
+		DualStat *struct {
+			Algorithm string  `json:"algorithm"`
+			Hashrate  float64 `json:"hashrate"`
+			Accepted  int     `json:"accepted_count"`
+			Rejected  int     `json:"rejected_count"`
+			Pool      struct {
+				URL string `json:"url"`
+			} `json:"active_pool"`
+			GPUs []struct {
+				DeviceID int     `json:"device_id"`
+				Hashrate float64 `json:"hashrate"`
+			} `json:"gpus"`
+		} `json:"dual_stat"`
 	}
 
 	if err := json.Unmarshal(body, &data); err != nil {
 		return nil
 	}
+	// An expired session gets an error instead of the summary
+	if data.Version == "" && sid != "" {
+		c.dropSession(api)
+		return nil
+	}
 
 	stats := &MinerStats{
 		Name:      "t-rex",
@@ -145,6 +250,7 @@ func (c *Collector) getTrexStats(client *http.Client, port int) *MinerStats {
 		Pool:      data.Pool.URL,
 		Hashrate:  data.Hashrate,
 		Uptime:    data.Uptime,
+		Difficulty: float64(data.Pool.Difficulty),
 	}
 	stats.Shares.Accepted = data.Accepted
 	stats.Shares.Rejected = data.Rejected
@@ -156,9 +262,28 @@ func (c *Collector) getTrexStats(client *http.Client, port int) *MinerStats {
 			Temperature: gpu.Temperature,
 			FanSpeed:    gpu.Fan,
 			Power:       gpu.Power,
+			LHRTune:     gpu.LHRTune,
+			LHRUnlock:   gpu.LHRUnlock,
+			BusID:       pciBusID(gpu.PCIDomain, gpu.PCIBus, gpu.PCIID),
+			Accepted:    gpu.Shares.Accepted,
 		})
 	}
 
+	if dual := data.DualStat; dual != nil && dual.Algorithm != "" {
+		secondary := &AlgorithmStats{
+			Algorithm: dual.Algorithm,
+			Pool:      dual.Pool.URL,
+			Hashrate:  dual.Hashrate,
+		}
+		secondary.Shares.Accepted = dual.Accepted
+		secondary.Shares.Rejected = dual.Rejected
+		setDual(stats, secondary)
+
+		for _, gpu := range dual.GPUs {
+			stats.setSecondaryHashrate(gpu.DeviceID, gpu.Hashrate)
+		}
+	}
+
 	return stats
 }
 
@@ -188,11 +313,23 @@ func (c *Collector) getLolMinerStats(client *http.Client, port int) *MinerStats
 		} `json:"Stratum"`
 		GPUs []struct {
 			Index       int     `json:"Index"`
+			PCIAddress  string  `json:"PCIE_Address"` // "bus:device" in hex
 			Performance float64 `json:"Performance"`
 			Temp        int     `json:"Temp (deg C)"`
 			Fan         int     `json:"Fan Speed (%)"`
 			Power       int     `json:"Power (W)"`
 		} `json:"GPUs"`
+		// Newer API versions list each algorithm separately
+		Algorithms []struct {
+			Algorithm         string    `json:"Algorithm"`
+			Pool              string    `json:"Pool"`
+			PerformanceFactor float64   `json:"Performance_Factor"`
+			TotalPerformance  float64   `json:"Total_Performance"`
+			TotalAccepted     int       `json:"Total_Accepted"`
+			TotalRejected     int       `json:"Total_Rejected"`
+			WorkerPerformance []float64 `json:"Worker_Performance"`
+			WorkerAccepted    []int     `json:"Worker_Accepted"`
+		} `json:"Algorithms"`
 	}
 
 	if err := json.Unmarshal(body, &data); err != nil {
@@ -223,9 +360,43 @@ func (c *Collector) getLolMinerStats(client *http.Client, port int) *MinerStats
 			Temperature: gpu.Temp,
 			FanSpeed:    gpu.Fan,
 			Power:       gpu.Power,
+			BusID:       lolMinerBusID(gpu.PCIAddress),
 		})
 	}
 
+	// Worker_Accepted is ordered like the GPUs array
+	if len(data.Algorithms) > 0 {
+		for i, accepted := range data.Algorithms[0].WorkerAccepted {
+			if i < len(stats.GPUStats) {
+				accepted := accepted
+				stats.GPUStats[i].Accepted = &accepted
+			}
+		}
+	}
+
+	if len(data.Algorithms) >= 2 {
+		algo := data.Algorithms[1]
+		factor := algo.PerformanceFactor
+		if factor == 0 {
+			factor = 1000000
+		}
+		secondary := &AlgorithmStats{
+			Algorithm: algo.Algorithm,
+			Pool:      algo.Pool,
+			Hashrate:  algo.TotalPerformance * factor,
+		}
+		secondary.Shares.Accepted = algo.TotalAccepted
+		secondary.Shares.Rejected = algo.TotalRejected
+		setDual(stats, secondary)
+
+		// Worker_Performance is ordered like the GPUs array
+		for i, perf := range algo.WorkerPerformance {
+			if i < len(data.GPUs) {
+				stats.setSecondaryHashrate(data.GPUs[i].Index, perf*factor)
+			}
+		}
+	}
+
 	return stats
 }
 
@@ -247,10 +418,16 @@ func (c *Collector) getGMinerStats(client *http.Client, port int) *MinerStats {
 		Server    string `json:"server"`
 		Devices   []struct {
 			GPUId       int     `json:"gpu_id"`
+			BusID       string  `json:"bus_id"`
 			Speed       float64 `json:"speed"`
 			Temperature int     `json:"temperature"`
 			Fan         int     `json:"fan"`
 			Power       int     `json:"power_usage"`
+			LHRUnlock   *float64 `json:"lhr_unlock"`
+			Accepted    *int     `json:"accepted_shares"`
+			Speed2      float64  `json:"speed2"`
+			Accepted2   int      `json:"accepted_shares2"`
+			Rejected2   int      `json:"rejected_shares2"`
 		} `json:"devices"`
 		TotalSpeed     float64 `json:"total_speed"`
 		AcceptedShares int     `json:"total_accepted_shares"`
@@ -280,9 +457,27 @@ func (c *Collector) getGMinerStats(client *http.Client, port int) *MinerStats {
 			Temperature: gpu.Temperature,
 			FanSpeed:    gpu.Fan,
 			Power:       gpu.Power,
+			LHRUnlock:   gpu.LHRUnlock,
+			BusID:       gpu.BusID,
+			Accepted:    gpu.Accepted,
 		})
 	}
 
+	// Dual mining reports "Ethash + KHeavyHash" and *2 fields per device
+	if algos := strings.Split(data.Algorithm, "+"); len(algos) == 2 {
+		stats.Algorithm = strings.TrimSpace(algos[0])
+		secondary := &AlgorithmStats{
+			Algorithm: strings.TrimSpace(algos[1]),
+		}
+		for _, gpu := range data.Devices {
+			secondary.Hashrate += gpu.Speed2
+			secondary.Shares.Accepted += gpu.Accepted2
+			secondary.Shares.Rejected += gpu.Rejected2
+			stats.setSecondaryHashrate(gpu.GPUId, gpu.Speed2)
+		}
+		setDual(stats, secondary)
+	}
+
 	return stats
 }
 
@@ -344,9 +539,9 @@ func (c *Collector) getTeamRedMinerStats(client *http.Client, port int) *MinerSt
 }
 
 // getXMRigStats fetches XMRig stats
-func (c *Collector) getXMRigStats(client *http.Client, port int) *MinerStats {
-	url := fmt.Sprintf("http://127.0.0.1:%d/1/summary", port)
-	resp, err := client.Get(url)
+func (c *Collector) getXMRigStats(client *http.Client, api MinerEndpoint) *MinerStats {
+	url := fmt.Sprintf("http://%s/1/summary", api.address())
+	resp, err := getWithToken(client, url, api)
 	if err != nil {
 		return nil
 	}
@@ -358,15 +553,18 @@ func (c *Collector) getXMRigStats(client *http.Client, port int) *MinerStats {
 		Version string `json:"version"`
 		Algo    string `json:"algo"`
 		Uptime  int    `json:"uptime"`
+		Donate  *int   `json:"donate_level"`
 		Connection struct {
 			Pool string `json:"pool"`
 		} `json:"connection"`
 		Hashrate struct {
-			Total []float64 `json:"total"`
+			Total   []float64   `json:"total"`
+			Threads [][]float64 `json:"threads"`
 		} `json:"hashrate"`
 		Results struct {
-			Accepted int `json:"shares_good"`
-			Rejected int `json:"shares_total"`
+			Accepted   int     `json:"shares_good"`
+			Rejected   int     `json:"shares_total"`
+			Difficulty float64 `json:"diff_current"`
 		} `json:"results"`
 	}
 
@@ -387,9 +585,15 @@ func (c *Collector) getXMRigStats(client *http.Client, port int) *MinerStats {
 		Pool:      data.Connection.Pool,
 		Hashrate:  hashrate,
 		Uptime:    data.Uptime,
+		CPUThreads: len(data.Hashrate.Threads),
+		Difficulty: data.Results.Difficulty,
 	}
 	stats.Shares.Accepted = data.Results.Accepted
 	stats.Shares.Rejected = data.Results.Rejected - data.Results.Accepted
+	// --donate-level lowers the 1% default
+	if data.Donate != nil {
+		stats.DevFee = &DevFee{Percent: float64(*data.Donate), Source: "api"}
+	}
 
 	return stats
 }
@@ -410,18 +614,28 @@ func (c *Collector) getNBMinerStats(client *http.Client, port int) *MinerStats {
 		Miner   struct {
 			Devices []struct {
 				ID          int     `json:"id"`
+				PCIBus      int     `json:"pci_bus_id"`
 				Hashrate    string  `json:"hashrate_raw"`
 				Temperature int     `json:"temperature"`
 				Fan         int     `json:"fan"`
 				Power       int     `json:"power"`
+				LHR         *float64 `json:"lhr"`
+				Accepted    *int     `json:"accepted_shares"`
+				Hashrate2   string   `json:"hashrate2_raw"`
 			} `json:"devices"`
-			TotalHashrate string `json:"total_hashrate_raw"`
+			TotalHashrate  string `json:"total_hashrate_raw"`
+			TotalHashrate2 string `json:"total_hashrate2_raw"`
 		} `json:"miner"`
 		Stratum struct {
 			Algorithm string `json:"algorithm"`
 			URL       string `json:"url"`
 			Accepted  int    `json:"accepted_shares"`
 			Rejected  int    `json:"rejected_shares"`
+			Difficulty difficulty `json:"difficulty"`
+			DualMine  bool   `json:"dual_mine"`
+			URL2      string `json:"url2"`
+			Accepted2 int    `json:"accepted_shares2"`
+			Rejected2 int    `json:"rejected_shares2"`
 		} `json:"stratum"`
 	}
 
@@ -438,6 +652,7 @@ func (c *Collector) getNBMinerStats(client *http.Client, port int) *MinerStats {
 		Algorithm: data.Stratum.Algorithm,
 		Pool:      data.Stratum.URL,
 		Hashrate:  hashrate,
+		Difficulty: float64(data.Stratum.Difficulty),
 	}
 	stats.Shares.Accepted = data.Stratum.Accepted
 	stats.Shares.Rejected = data.Stratum.Rejected
@@ -450,9 +665,30 @@ func (c *Collector) getNBMinerStats(client *http.Client, port int) *MinerStats {
 			Temperature: gpu.Temperature,
 			FanSpeed:    gpu.Fan,
 			Power:       gpu.Power,
+			LHRUnlock:   gpu.LHR,
+			BusID:       pciBusID(0, gpu.PCIBus, 0),
+			Accepted:    gpu.Accepted,
 		})
 	}
 
+	// Dual mining reports algorithms like "ethash_kaspa"
+	if data.Stratum.DualMine {
+		secondary := &AlgorithmStats{Pool: data.Stratum.URL2}
+		if algos := strings.SplitN(data.Stratum.Algorithm, "_", 2); len(algos) == 2 {
+			stats.Algorithm = algos[0]
+			secondary.Algorithm = algos[1]
+		}
+		secondary.Hashrate, _ = strconv.ParseFloat(data.Miner.TotalHashrate2, 64)
+		secondary.Shares.Accepted = data.Stratum.Accepted2
+		secondary.Shares.Rejected = data.Stratum.Rejected2
+		setDual(stats, secondary)
+
+		for _, gpu := range data.Miner.Devices {
+			hr, _ := strconv.ParseFloat(gpu.Hashrate2, 64)
+			stats.setSecondaryHashrate(gpu.ID, hr)
+		}
+	}
+
 	return stats
 }
 
@@ -474,13 +710,16 @@ func (c *Collector) getSRBMinerStats(client *http.Client, port int) *MinerStats
 		Pool      string `json:"pool"`
 		Hashrate  struct {
 			Total float64 `json:"total"`
+			CPU   float64 `json:"cpu"`
 		} `json:"hashrate"`
+		CPUWorkers int `json:"total_cpu_workers"`
 		Shares struct {
 			Accepted int `json:"accepted"`
 			Rejected int `json:"rejected"`
 		} `json:"shares"`
 		Devices []struct {
 			ID          int     `json:"id"`
+			BusID       int     `json:"bus_id"`
 			Hashrate    float64 `json:"hashrate"`
 			Temperature int     `json:"temperature"`
 			Fan         int     `json:"fan_speed_rpm"`
@@ -500,6 +739,11 @@ func (c *Collector) getSRBMinerStats(client *http.Client, port int) *MinerStats
 		Pool:      data.Pool,
 		Hashrate:  data.Hashrate.Total,
 		Uptime:    data.Uptime * 60,
+		CPUThreads: data.CPUWorkers,
+	}
+	// Older builds leave the total at 0 when only the CPU mines
+	if stats.Hashrate == 0 {
+		stats.Hashrate = data.Hashrate.CPU
 	}
 	stats.Shares.Accepted = data.Shares.Accepted
 	stats.Shares.Rejected = data.Shares.Rejected
@@ -511,19 +755,267 @@ func (c *Collector) getSRBMinerStats(client *http.Client, port int) *MinerStats
 			Temperature: gpu.Temperature,
 			FanSpeed:    gpu.Fan,
 			Power:       gpu.Power,
+			BusID:       pciBusID(0, gpu.BusID, 0),
 		})
 	}
 
 	return stats
 }
 
+// getCDMStats fetches stats over the Claymore remote management protocol
+// spoken by PhoenixMiner and Claymore's miner. miner_getstat2 adds per-GPU
+// shares and PCI buses to the miner_getstat1 fields:
+//
+//	0 version, 1 uptime (minutes), 2 "kH/s;accepted;rejected",
+//	3 per-GPU kH/s, 6 "temp;fan" per GPU, 7 pool, 9 per-GPU accepted,
+//	15 per-GPU PCI bus
+func (c *Collector) getCDMStats(minerName string, api MinerEndpoint) *MinerStats {
+	result := cdmRequest(api, "miner_getstat2")
+	if result == nil {
+		result = cdmRequest(api, "miner_getstat1")
+	}
+	if len(result) < 8 {
+		return nil
+	}
+
+	stats := &MinerStats{
+		Name:      minerName,
+		Version:   result[0],
+		Running:   true,
+		Algorithm: "ethash",
+		Pool:      strings.Split(result[7], ";")[0],
+	}
+	// PhoenixMiner appends the coin, e.g. "PM 6.2c - ETC"
+	if strings.HasSuffix(strings.ToUpper(result[0]), " - ETC") {
+		stats.Algorithm = "etchash"
+	}
+	if minutes, err := strconv.Atoi(result[1]); err == nil {
+		stats.Uptime = minutes * 60
+	}
+
+	total := cdmInts(result[2])
+	if len(total) > 0 {
+		stats.Hashrate = float64(total[0]) * 1000
+	}
+	if len(total) > 2 {
+		stats.Shares.Accepted = total[1]
+		stats.Shares.Rejected = total[2]
+	}
+
+	sensors := cdmInts(result[6])
+	var accepted, buses []int
+	if len(result) > 9 {
+		accepted = cdmInts(result[9])
+	}
+	if len(result) > 15 {
+		buses = cdmInts(result[15])
+	}
+	for i, khs := range cdmInts(result[3]) {
+		gpu := GPUMinerStats{Index: i, Hashrate: float64(khs) * 1000}
+		if 2*i+1 < len(sensors) {
+			gpu.Temperature = sensors[2*i]
+			gpu.FanSpeed = sensors[2*i+1]
+		}
+		if i < len(accepted) {
+			count := accepted[i]
+			gpu.Accepted = &count
+		}
+		if i < len(buses) {
+			gpu.BusID = pciBusID(0, buses[i], 0)
+		}
+		stats.GPUStats = append(stats.GPUStats, gpu)
+	}
+
+	return stats
+}
+
+// cdmRequest sends one remote management request, with the password when
+// the miner has one, and returns its result strings, or nil when the miner
+// doesn't answer or know the method
+func cdmRequest(api MinerEndpoint, method string) []string {
+	conn, err := net.DialTimeout("tcp", api.address(), 2*time.Second)
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(3 * time.Second))
+
+	request, _ := json.Marshal(struct {
+		ID       int    `json:"id"`
+		JSONRPC  string `json:"jsonrpc"`
+		Method   string `json:"method"`
+		Password string `json:"psw,omitempty"`
+	}{0, "2.0", method, api.Key})
+	if _, err := conn.Write(append(request, '\n')); err != nil {
+		return nil
+	}
+
+	var response struct {
+		Result []string `json:"result"`
+	}
+	if err := json.NewDecoder(conn).Decode(&response); err != nil {
+		return nil
+	}
+	return response.Result
+}
+
+// cdmInts parses a ";"-separated list of numbers; "off" and "N/A" read as 0
+func cdmInts(field string) []int {
+	if field == "" {
+		return nil
+	}
+	var values []int
+	for _, part := range strings.Split(field, ";") {
+		n, _ := strconv.Atoi(strings.TrimSpace(part))
+		values = append(values, n)
+	}
+	return values
+}
+
+// getCCMinerStats fetches stats over the ccminer text API spoken by
+// cpuminer-opt: "summary" answers with "KEY=value;..." pairs ending in "|"
+func (c *Collector) getCCMinerStats(minerName string, port int) *MinerStats {
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", port), 2*time.Second)
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(3 * time.Second))
+
+	if _, err := conn.Write([]byte("summary")); err != nil {
+		return nil
+	}
+	body, err := io.ReadAll(conn)
+	if err != nil && len(body) == 0 {
+		return nil
+	}
+
+	fields := map[string]string{}
+	for _, pair := range strings.Split(strings.TrimRight(strings.TrimSpace(string(body)), "|"), ";") {
+		if key, value, ok := strings.Cut(pair, "="); ok {
+			fields[key] = value
+		}
+	}
+	if fields["NAME"] == "" {
+		return nil
+	}
+
+	stats := &MinerStats{
+		Name:      minerName,
+		Version:   fields["VER"],
+		Running:   true,
+		Algorithm: fields["ALGO"],
+		Pool:      fields["URL"],
+	}
+	// HS is only sent by newer builds; KHS is always there
+	if hs, err := strconv.ParseFloat(fields["HS"], 64); err == nil {
+		stats.Hashrate = hs
+	} else if khs, err := strconv.ParseFloat(fields["KHS"], 64); err == nil {
+		stats.Hashrate = khs * 1000
+	}
+	stats.Uptime, _ = strconv.Atoi(fields["UPTIME"])
+	stats.CPUThreads, _ = strconv.Atoi(fields["CPUS"])
+	stats.Shares.Accepted, _ = strconv.Atoi(fields["ACC"])
+	stats.Shares.Rejected, _ = strconv.Atoi(fields["REJ"])
+	return stats
+}
+
+// setDual fills the per-algorithm breakdown of a dual-mining miner, taking
+// the primary algorithm from the top-level fields
+func setDual(stats *MinerStats, secondary *AlgorithmStats) {
+	primary := &AlgorithmStats{
+		Algorithm: stats.Algorithm,
+		Pool:      stats.Pool,
+		Hashrate:  stats.Hashrate,
+	}
+	primary.Shares = stats.Shares
+	stats.Primary = primary
+	stats.Secondary = secondary
+}
+
+// setSecondaryHashrate sets the secondary algorithm hashrate of a GPU
+func (s *MinerStats) setSecondaryHashrate(index int, hashrate float64) {
+	for i := range s.GPUStats {
+		if s.GPUStats[i].Index == index {
+			s.GPUStats[i].SecondaryHashrate = hashrate
+			return
+		}
+	}
+}
+
+// MinerGPU finds the GPU behind one of a miner's per-GPU stats: by PCI
+// address where the miner reports it, else by index. It returns nil when
+// no GPU matches.
+func MinerGPU(gpus []GPUStats, stats GPUMinerStats) *GPUStats {
+	for i := range gpus {
+		if stats.BusID != "" {
+			if gpus[i].BusID != "" && normalizeBusID(gpus[i].BusID) == normalizeBusID(stats.BusID) {
+				return &gpus[i]
+			}
+		} else if gpus[i].Index == stats.Index {
+			return &gpus[i]
+		}
+	}
+	return nil
+}
+
+// pciBusID formats a PCI address; bus 0 is treated as not reported since
+// GPUs never sit on the root bus
+func pciBusID(domain, bus, device int) string {
+	if bus <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%04x:%02x:%02x.0", domain, bus, device)
+}
+
+// difficulty is a share difficulty that miners report as a number or a
+// string with an SI suffix, e.g. "4.29 G"
+type difficulty float64
+
+var siMultipliers = map[string]float64{"": 1, "k": 1e3, "K": 1e3, "M": 1e6, "G": 1e9, "T": 1e12, "P": 1e15}
+
+func (d *difficulty) UnmarshalJSON(data []byte) error {
+	var value float64
+	if json.Unmarshal(data, &value) == nil {
+		*d = difficulty(value)
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return nil // Unknown form: not reported
+	}
+	text = strings.TrimSpace(text)
+	number := strings.TrimRight(text, "kKMGTP ")
+	multiplier, ok := siMultipliers[strings.TrimSpace(text[len(number):])]
+	value, err := strconv.ParseFloat(number, 64)
+	if !ok || err != nil {
+		return nil
+	}
+	*d = difficulty(value * multiplier)
+	return nil
+}
+
+// lolMinerBusID converts lolMiner's "bus:device" hex address
+func lolMinerBusID(address string) string {
+	parts := strings.SplitN(address, ":", 2)
+	if len(parts) != 2 {
+		return ""
+	}
+	bus, err1 := strconv.ParseInt(parts[0], 16, 32)
+	device, err2 := strconv.ParseInt(parts[1], 16, 32)
+	if err1 != nil || err2 != nil {
+		return ""
+	}
+	return pciBusID(0, int(bus), int(device))
+}
+
 // detectMinerFromProc checks /proc for miner processes
 func (c *Collector) detectMinerFromProc() *MinerStats {
 	// Use pgrep to find common miner processes
-	miners := []string{"t-rex", "lolMiner", "gminer", "teamredminer", "xmrig", "nbminer", "SRBMiner", "bzminer", "phoenixminer", "claymore"}
+	miners := []string{"t-rex", "lolMiner", "gminer", "teamredminer", "xmrig", "nbminer", "SRBMiner", "bzminer", "phoenixminer", "claymore", "cpuminer"}
 	
 	for _, miner := range miners {
-		cmd := exec.Command("pgrep", "-f", miner)
+		cmd := c.run.Command("pgrep", "-f", miner)
 		output, err := cmd.Output()
 		if err == nil && len(strings.TrimSpace(string(output))) > 0 {
 			return &MinerStats{
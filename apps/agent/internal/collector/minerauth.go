@@ -0,0 +1,117 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// MinerEndpoint is where the API of a miner the agent started listens
+type MinerEndpoint struct {
+	Port int
+	Host string // Bind address, empty = 127.0.0.1
+	Key  string // T-Rex API key, xmrig access token or CDM password
+}
+
+// address is where to reach the API from the rig itself
+func (api MinerEndpoint) address() string {
+	host := api.Host
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, strconv.Itoa(api.Port))
+}
+
+// SetMinerAPIs sets where to look up the API endpoints of the miners the
+// agent started, by canonical name; known miners otherwise use their
+// default port without a key
+func (c *Collector) SetMinerAPIs(source func() map[string][]MinerEndpoint) {
+	c.minerMu.Lock()
+	defer c.minerMu.Unlock()
+	c.minerAPIs = source
+}
+
+// apiEndpoints returns the endpoints to poll for a miner, allocated ones
+// first
+func (c *Collector) apiEndpoints(minerName string, defaultPort int) []MinerEndpoint {
+	c.minerMu.Lock()
+	source := c.minerAPIs
+	c.minerMu.Unlock()
+
+	var endpoints []MinerEndpoint
+	if source != nil {
+		endpoints = source()[minerName]
+	}
+	for _, api := range endpoints {
+		if api.Port == defaultPort {
+			return endpoints
+		}
+	}
+	return append(endpoints, MinerEndpoint{Port: defaultPort})
+}
+
+// apiSession is a login to a miner API, valid for the key it was made with
+type apiSession struct {
+	key, sid string
+}
+
+// trexSession logs in to a T-Rex API protected with a key and returns the
+// session ID its requests take, or "" without a key. Sessions are kept
+// until T-Rex stops accepting them.
+func (c *Collector) trexSession(client *http.Client, api MinerEndpoint) (string, error) {
+	if api.Key == "" {
+		return "", nil
+	}
+	c.minerMu.Lock()
+	session := c.apiSessions[api.address()]
+	c.minerMu.Unlock()
+	if session.key == api.Key && session.sid != "" {
+		return session.sid, nil
+	}
+
+	resp, err := client.Get(fmt.Sprintf("http://%s/login?password=%s", api.address(), url.QueryEscape(api.Key)))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	var login struct {
+		SID     string `json:"sid"`
+		Success int    `json:"success"`
+	}
+	if err := json.Unmarshal(body, &login); err != nil || login.Success != 1 || login.SID == "" {
+		return "", fmt.Errorf("T-Rex API login refused")
+	}
+
+	c.minerMu.Lock()
+	if c.apiSessions == nil {
+		c.apiSessions = map[string]apiSession{}
+	}
+	c.apiSessions[api.address()] = apiSession{key: api.Key, sid: login.SID}
+	c.minerMu.Unlock()
+	return login.SID, nil
+}
+
+// dropSession forgets a session the miner no longer accepts
+func (c *Collector) dropSession(api MinerEndpoint) {
+	c.minerMu.Lock()
+	defer c.minerMu.Unlock()
+	delete(c.apiSessions, api.address())
+}
+
+// getWithToken sends a GET with the API's key as a bearer token, as xmrig
+// expects it
+func getWithToken(client *http.Client, url string, api MinerEndpoint) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if api.Key != "" {
+		req.Header.Set("Authorization", "Bearer "+api.Key)
+	}
+	return client.Do(req)
+}
@@ -0,0 +1,156 @@
+package collector
+
+import (
+	"bufio"
+	"path/filepath"
+	"strings"
+)
+
+// CardID identifies the exact board of a GPU. The chip name alone ("GeForce
+// RTX 3080") doesn't tell an ASUS TUF from a Zotac Trinity, which differ
+// in memory cooling, power limits and safe overclocks.
+type CardID struct {
+	SubsystemVendor string `json:"subsystemVendor"` // e.g. "0x1043"
+	SubsystemDevice string `json:"subsystemDevice"` // e.g. "0x87d1"
+	Brand           string `json:"brand,omitempty"` // e.g. "ASUS"
+	Model           string `json:"model,omitempty"` // e.g. "ASUS TUF RTX 3080 V2 LHR"
+	LHR             bool   `json:"lhr,omitempty"`   // NVIDIA Lite Hash Rate revision
+}
+
+// Board vendors by PCI subsystem vendor ID
+var subsystemVendors = map[string]string{
+	"0x1002": "AMD",
+	"0x1028": "Dell",
+	"0x103c": "HP",
+	"0x1043": "ASUS",
+	"0x10b0": "Gainward",
+	"0x10de": "NVIDIA",
+	"0x1458": "Gigabyte",
+	"0x1462": "MSI",
+	"0x148c": "PowerColor",
+	"0x1565": "Biostar",
+	"0x1569": "Palit",
+	"0x1682": "XFX",
+	"0x174b": "Sapphire",
+	"0x17aa": "Lenovo",
+	"0x1849": "ASRock",
+	"0x196e": "PNY",
+	"0x19da": "Zotac",
+	"0x1b4c": "Galax",
+	"0x1da2": "Sapphire",
+	"0x3842": "EVGA",
+	"0x7377": "Colorful",
+}
+
+// NVIDIA device IDs of the LHR revisions (and of chips only sold as LHR)
+var lhrDeviceIDs = map[string]bool{
+	"0x2208": true, // RTX 3080 Ti
+	"0x2216": true, // RTX 3080 LHR
+	"0x2482": true, // RTX 3070 Ti
+	"0x2488": true, // RTX 3070 LHR
+	"0x2489": true, // RTX 3060 Ti LHR
+	"0x2504": true, // RTX 3060 LHR
+}
+
+// cardID returns the board identity of the GPU at busID, or nil when the
+// device isn't in sysfs. The result is cached since it can't change while
+// the card is in the slot.
+func (c *Collector) cardID(busID, chipName string) *CardID {
+	if busID == "" {
+		return nil
+	}
+	key := normalizeBusID(busID)
+
+	c.cardMu.Lock()
+	defer c.cardMu.Unlock()
+	if card, ok := c.cards[key]; ok {
+		return card
+	}
+	if c.cards == nil {
+		c.cards = make(map[string]*CardID)
+	}
+
+	var card *CardID
+	devPath := filepath.Join("/sys/bus/pci/devices", key)
+	if subVendor := c.readSysfs(filepath.Join(devPath, "subsystem_vendor")); subVendor != "" {
+		card = c.decodeCard(key, chipName,
+			c.readSysfs(filepath.Join(devPath, "vendor")),
+			c.readSysfs(filepath.Join(devPath, "device")),
+			subVendor,
+			c.readSysfs(filepath.Join(devPath, "subsystem_device")))
+	}
+	c.cards[key] = card
+	return card
+}
+
+// decodeCard names the board from its subsystem IDs: the brand from our
+// table (or the PCI ID database), the variant from the PCI ID database
+// where it lists the board, otherwise the chip name
+func (c *Collector) decodeCard(busID, chipName, vendorID, deviceID, subVendor, subDevice string) *CardID {
+	card := &CardID{
+		SubsystemVendor: subVendor,
+		SubsystemDevice: subDevice,
+		Brand:           subsystemVendors[subVendor],
+		LHR:             vendorID == "0x10de" && lhrDeviceIDs[deviceID],
+	}
+
+	names := c.lspciSubsystem(busID)
+	if card.Brand == "" {
+		card.Brand = shortVendorName(names["SVendor"])
+	}
+
+	// lspci prints "Device 87d1" for boards missing from pci.ids
+	variant := names["SDevice"]
+	if variant == "" || strings.HasPrefix(variant, "Device ") {
+		variant = shortChipName(chipName)
+	}
+	if variant == "" {
+		return card
+	}
+	if card.LHR && !strings.Contains(variant, "LHR") {
+		variant += " LHR"
+	}
+	if card.Brand == "" || strings.HasPrefix(strings.ToLower(variant), strings.ToLower(card.Brand)) {
+		card.Model = variant
+	} else {
+		card.Model = card.Brand + " " + variant
+	}
+	return card
+}
+
+// lspciSubsystem returns lspci's machine-readable fields for a device,
+// e.g. "SVendor" and "SDevice"
+func (c *Collector) lspciSubsystem(busID string) map[string]string {
+	fields := make(map[string]string)
+	output, err := c.run.Command("lspci", "-vmm", "-s", busID).Output()
+	if err != nil {
+		return fields
+	}
+	scanner := bufio.NewScanner(strings.NewReader(string(output)))
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 2)
+		if len(parts) == 2 {
+			fields[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+	return fields
+}
+
+// shortChipName drops the vendor and family from a driver's GPU name:
+// "NVIDIA GeForce RTX 3080" -> "RTX 3080", "AMD Radeon RX 6800 XT" -> "RX 6800 XT"
+func shortChipName(name string) string {
+	for _, prefix := range []string{"NVIDIA ", "GeForce ", "AMD ", "Radeon ", "Intel(R) ", "Intel "} {
+		name = strings.TrimPrefix(name, prefix)
+	}
+	return strings.TrimSpace(name)
+}
+
+// shortVendorName drops the company suffix from a pci.ids vendor name:
+// "ASUSTeK Computer Inc." -> "ASUSTeK"
+func shortVendorName(name string) string {
+	fields := strings.Fields(name)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.TrimSuffix(fields[0], ",")
+}
@@ -0,0 +1,94 @@
+package collector
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// nvidiaSMILog is the subset of `nvidia-smi -q -x` output the collector
+// reads. Element names are stable across driver versions while CSV query
+// fields come and go, and values always use "." decimals and unit suffixes.
+type nvidiaSMILog struct {
+	DriverVersion string         `xml:"driver_version"`
+	GPUs          []nvidiaSMIGPU `xml:"gpu"`
+}
+
+type nvidiaSMIGPU struct {
+	ID          string `xml:"id,attr"`
+	ProductName string `xml:"product_name"`
+	PCIBusID    string `xml:"pci>pci_bus_id"`
+	FanSpeed    string `xml:"fan_speed"`
+	MemoryTotal string `xml:"fb_memory_usage>total"`
+	GPUUtil     string `xml:"utilization>gpu_util"`
+	GPUTemp     string `xml:"temperature>gpu_temp"`
+	MemoryTemp  string `xml:"temperature>memory_temp"`
+	GraphicsClk string `xml:"clocks>graphics_clock"`
+	MemClk      string `xml:"clocks>mem_clock"`
+
+	// Drivers before 530 report power_readings, later ones
+	// gpu_power_readings with separate average and instant values
+	PowerReadings struct {
+		PowerDraw string `xml:"power_draw"`
+	} `xml:"power_readings"`
+	GPUPowerReadings struct {
+		PowerDraw        string `xml:"power_draw"`
+		AveragePowerDraw string `xml:"average_power_draw"`
+		InstantPowerDraw string `xml:"instant_power_draw"`
+	} `xml:"gpu_power_readings"`
+}
+
+// getNvidiaGPUStatsXML collects NVIDIA GPU stats from `nvidia-smi -q -x`
+func (c *Collector) getNvidiaGPUStatsXML() ([]GPUStats, error) {
+	output, err := c.run.Command("nvidia-smi", "-q", "-x").Output()
+	if err != nil {
+		return nil, fmt.Errorf("nvidia-smi -q -x failed: %w", err)
+	}
+	return parseNvidiaSMIXML(output)
+}
+
+// parseNvidiaSMIXML converts `nvidia-smi -q -x` output to GPU stats. GPUs
+// are listed in nvidia-smi index order.
+func parseNvidiaSMIXML(data []byte) ([]GPUStats, error) {
+	var smiLog nvidiaSMILog
+	if err := xml.Unmarshal(data, &smiLog); err != nil {
+		return nil, fmt.Errorf("invalid nvidia-smi XML: %w", err)
+	}
+
+	var gpus []GPUStats
+	for i, entry := range smiLog.GPUs {
+		gpu := GPUStats{
+			Index:  i,
+			Name:   strings.TrimSpace(entry.ProductName),
+			Vendor: "NVIDIA",
+			BusID:  strings.TrimSpace(entry.PCIBusID),
+		}
+		if gpu.BusID == "" {
+			gpu.BusID = entry.ID
+		}
+
+		gpu.Temperature = parseIntPtr(entry.GPUTemp)
+		gpu.MemTemp = parseIntPtr(entry.MemoryTemp)
+		gpu.FanSpeed = parseIntPtr(entry.FanSpeed)
+		gpu.CoreClock = parseIntPtr(entry.GraphicsClk)
+		gpu.MemoryClock = parseIntPtr(entry.MemClk)
+		gpu.Utilization = parseIntPtr(entry.GPUUtil)
+		if vram := parseIntPtr(entry.MemoryTotal); vram != nil {
+			gpu.VRAM = *vram
+		}
+
+		for _, power := range []string{
+			entry.GPUPowerReadings.PowerDraw,
+			entry.GPUPowerReadings.AveragePowerDraw,
+			entry.GPUPowerReadings.InstantPowerDraw,
+			entry.PowerReadings.PowerDraw,
+		} {
+			if gpu.PowerDraw = parseIntPtr(power); gpu.PowerDraw != nil {
+				break
+			}
+		}
+
+		gpus = append(gpus, gpu)
+	}
+	return gpus, nil
+}
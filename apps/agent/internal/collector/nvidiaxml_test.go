@@ -0,0 +1,117 @@
+package collector
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func intPtr(v int) *int { return &v }
+
+func TestParseNvidiaSMIXML(t *testing.T) {
+	tests := []struct {
+		file string
+		want []GPUStats
+	}{
+		{
+			// power_readings schema; a passive CMP card without fan or power readings
+			file: "nvidia-smi-470.xml",
+			want: []GPUStats{
+				{
+					Index: 0, Name: "NVIDIA GeForce RTX 3070", Vendor: "NVIDIA", BusID: "00000000:01:00.0",
+					Temperature: intPtr(57), FanSpeed: intPtr(62), PowerDraw: intPtr(120),
+					CoreClock: intPtr(1140), MemoryClock: intPtr(7600), Utilization: intPtr(100), VRAM: 7982,
+				},
+				{
+					Index: 1, Name: "NVIDIA CMP 30HX", Vendor: "NVIDIA", BusID: "00000000:02:00.0",
+					Temperature: intPtr(64),
+					CoreClock:   intPtr(1530), MemoryClock: intPtr(7000), Utilization: intPtr(99), VRAM: 5945,
+				},
+			},
+		},
+		{
+			// gpu_power_readings with power_draw; HBM reports a memory temperature
+			file: "nvidia-smi-535.xml",
+			want: []GPUStats{
+				{
+					Index: 0, Name: "NVIDIA A100-SXM4-40GB", Vendor: "NVIDIA", BusID: "00000000:0A:00.0",
+					Temperature: intPtr(33), MemTemp: intPtr(44), PowerDraw: intPtr(56),
+					CoreClock: intPtr(1275), MemoryClock: intPtr(1215), Utilization: intPtr(0), VRAM: 40960,
+				},
+			},
+		},
+		{
+			// gpu_power_readings with only average and instant draw
+			file: "nvidia-smi-550.xml",
+			want: []GPUStats{
+				{
+					Index: 0, Name: "NVIDIA GeForce RTX 3080", Vendor: "NVIDIA", BusID: "00000000:03:00.0",
+					Temperature: intPtr(61), FanSpeed: intPtr(70), PowerDraw: intPtr(224),
+					CoreClock: intPtr(1410), MemoryClock: intPtr(9251), Utilization: intPtr(100), VRAM: 10240,
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			gpus, err := parseNvidiaSMIXML(data)
+			if err != nil {
+				t.Fatalf("parseNvidiaSMIXML: %v", err)
+			}
+			if len(gpus) != len(tt.want) {
+				t.Fatalf("got %d GPUs, want %d", len(gpus), len(tt.want))
+			}
+			for i, want := range tt.want {
+				got := gpus[i]
+				if got.Index != want.Index || got.Name != want.Name || got.Vendor != want.Vendor ||
+					got.BusID != want.BusID || got.VRAM != want.VRAM {
+					t.Errorf("gpu %d: got %d %q %q %q %d MiB, want %d %q %q %q %d MiB", i,
+						got.Index, got.Name, got.Vendor, got.BusID, got.VRAM,
+						want.Index, want.Name, want.Vendor, want.BusID, want.VRAM)
+				}
+				for _, field := range []struct {
+					name      string
+					got, want *int
+				}{
+					{"temperature", got.Temperature, want.Temperature},
+					{"memTemp", got.MemTemp, want.MemTemp},
+					{"fanSpeed", got.FanSpeed, want.FanSpeed},
+					{"powerDraw", got.PowerDraw, want.PowerDraw},
+					{"coreClock", got.CoreClock, want.CoreClock},
+					{"memoryClock", got.MemoryClock, want.MemoryClock},
+					{"utilization", got.Utilization, want.Utilization},
+				} {
+					if !equalIntPtr(field.got, field.want) {
+						t.Errorf("gpu %d %s: got %s, want %s", i, field.name, formatIntPtr(field.got), formatIntPtr(field.want))
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestParseNvidiaSMIXMLInvalid(t *testing.T) {
+	if _, err := parseNvidiaSMIXML([]byte("NVIDIA-SMI has failed because it couldn't communicate with the NVIDIA driver.")); err == nil {
+		t.Error("expected an error for non-XML output")
+	}
+}
+
+func equalIntPtr(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func formatIntPtr(v *int) string {
+	if v == nil {
+		return "N/A"
+	}
+	return fmt.Sprint(*v)
+}
@@ -0,0 +1,314 @@
+package collector
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OutputMiner is a running miner without an API whose stats are parsed
+// from its output; see executor.OutputPatterns for the patterns
+type OutputMiner struct {
+	Name      string
+	Algorithm string
+	Pool      string
+	PID       int
+	Log       string
+	Offset    int64 // Where this run's output starts in the log
+	Started   time.Time
+
+	Hashrate string
+	Accepted string
+	Rejected string
+	Unit     string
+}
+
+const (
+	// outputStale is how long without a hashrate line before the miner
+	// counts as hashing nothing; miners print one every 10-60 seconds
+	outputStale = 3 * time.Minute
+	// outputReadMax bounds a read, e.g. the first one after an agent
+	// restart with a long log behind
+	outputReadMax = 256 << 10
+	// outputLineMax bounds an unterminated line kept between reads
+	outputLineMax = 64 << 10
+)
+
+// ansiRe matches the color codes most miners put in their output
+var ansiRe = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+
+// outputParser follows the log of one miner run
+type outputParser struct {
+	pid      int
+	offset   int64
+	partial  []byte
+	skipLine bool // Read started mid-line
+
+	hashrate, accepted, rejected *regexp.Regexp
+	unit                         string
+
+	total      float64 // Latest total hashrate line, H/s
+	totalAt    time.Time
+	gpus       map[int]float64 // Latest per-GPU hashrates, H/s
+	gpusAt     time.Time
+	sharesOK   int
+	sharesFail int
+}
+
+// SetOutputMiners sets where to look up the miners the agent started
+// whose stats come from their output
+func (c *Collector) SetOutputMiners(source func() []OutputMiner) {
+	c.minerMu.Lock()
+	defer c.minerMu.Unlock()
+	c.outputMiners = source
+}
+
+// outputMinerStats returns the stats of the first running output-parsed
+// miner, or nil when there is none
+func (c *Collector) outputMinerStats() *MinerStats {
+	c.minerMu.Lock()
+	source := c.outputMiners
+	c.minerMu.Unlock()
+	if source == nil {
+		return nil
+	}
+	miners := source()
+
+	c.outputMu.Lock()
+	defer c.outputMu.Unlock()
+
+	// Forget the runs that ended
+	current := map[string]bool{}
+	for _, miner := range miners {
+		current[miner.Log] = true
+	}
+	for log := range c.outputs {
+		if !current[log] {
+			delete(c.outputs, log)
+		}
+	}
+
+	for _, miner := range miners {
+		if !c.processAlive(miner.PID) {
+			continue
+		}
+		parser := c.outputs[miner.Log]
+		if parser == nil || parser.pid != miner.PID {
+			parser = newOutputParser(miner)
+			if c.outputs == nil {
+				c.outputs = make(map[string]*outputParser)
+			}
+			c.outputs[miner.Log] = parser
+		}
+		parser.read(miner.Log)
+		return parser.stats(miner)
+	}
+	return nil
+}
+
+// processAlive checks /proc where there is one
+func (c *Collector) processAlive(pid int) bool {
+	if _, err := c.fs.Stat("/proc"); err != nil {
+		return true
+	}
+	_, err := c.fs.Stat(fmt.Sprintf("/proc/%d", pid))
+	return err == nil
+}
+
+func newOutputParser(miner OutputMiner) *outputParser {
+	p := &outputParser{pid: miner.PID, offset: miner.Offset, unit: miner.Unit, gpus: map[int]float64{}}
+	// Validated when the miner started
+	p.hashrate, _ = regexp.Compile(miner.Hashrate)
+	if miner.Accepted != "" {
+		p.accepted, _ = regexp.Compile(miner.Accepted)
+	}
+	if miner.Rejected != "" {
+		p.rejected, _ = regexp.Compile(miner.Rejected)
+	}
+	return p
+}
+
+// read parses the output written since the last read
+func (p *outputParser) read(path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return
+	}
+
+	size := info.Size()
+	if size < p.offset {
+		// Truncated by the log shipper
+		p.offset = 0
+		p.partial = nil
+	}
+	if size-p.offset > outputReadMax {
+		p.offset = size - outputReadMax
+		p.partial = nil
+		p.skipLine = true
+	}
+	data := make([]byte, size-p.offset)
+	n, _ := f.ReadAt(data, p.offset)
+	data = data[:n]
+	p.offset += int64(n)
+
+	if p.skipLine {
+		i := bytes.IndexAny(data, "\r\n")
+		if i < 0 {
+			return
+		}
+		data = data[i+1:]
+		p.skipLine = false
+	}
+
+	data = append(p.partial, data...)
+	// Progress lines are often redrawn with a carriage return
+	end := bytes.LastIndexAny(data, "\r\n")
+	if end < 0 {
+		p.partial = data
+		if len(p.partial) > outputLineMax {
+			p.partial = nil
+			p.skipLine = true
+		}
+		return
+	}
+	p.partial = append([]byte(nil), data[end+1:]...)
+
+	now := time.Now()
+	for _, line := range strings.FieldsFunc(string(data[:end]), func(r rune) bool { return r == '\n' || r == '\r' }) {
+		p.parseLine(ansiRe.ReplaceAllString(line, ""), now)
+	}
+}
+
+func (p *outputParser) parseLine(line string, now time.Time) {
+	if p.hashrate != nil {
+		if m := p.hashrate.FindStringSubmatch(line); m != nil {
+			p.parseHashrate(m, now)
+		}
+	}
+	if p.accepted != nil {
+		if m := p.accepted.FindStringSubmatch(line); m != nil {
+			p.sharesOK = shareCount(m, p.sharesOK)
+		}
+	}
+	if p.rejected != nil {
+		if m := p.rejected.FindStringSubmatch(line); m != nil {
+			p.sharesFail = shareCount(m, p.sharesFail)
+		}
+	}
+}
+
+func (p *outputParser) parseHashrate(m []string, now time.Time) {
+	value, ok := submatch(p.hashrate, m, "hashrate", 1)
+	if !ok {
+		return
+	}
+	rate, err := strconv.ParseFloat(strings.ReplaceAll(value, ",", ""), 64)
+	if err != nil {
+		return
+	}
+	unit := p.unit
+	if u, ok := submatch(p.hashrate, m, "unit", 2); ok && u != "" {
+		unit = u
+	}
+	rate *= hashUnitMultiplier(unit)
+
+	if gpu, ok := submatch(p.hashrate, m, "gpu", 0); ok && gpu != "" {
+		index, err := strconv.Atoi(gpu)
+		if err != nil {
+			return
+		}
+		p.gpus[index] = rate
+		p.gpusAt = now
+		return
+	}
+	p.total = rate
+	p.totalAt = now
+}
+
+// submatch returns the group named name, or the group at position when the
+// pattern names none of its groups
+func submatch(re *regexp.Regexp, m []string, name string, position int) (string, bool) {
+	if i := re.SubexpIndex(name); i > 0 {
+		return m[i], true
+	}
+	for _, n := range re.SubexpNames() {
+		if n != "" {
+			return "", false
+		}
+	}
+	if position <= 0 || position >= len(m) {
+		return "", false
+	}
+	return m[position], true
+}
+
+// shareCount counts a share line, or takes the total the line carries
+func shareCount(m []string, count int) int {
+	if len(m) > 1 {
+		if total, err := strconv.Atoi(m[1]); err == nil {
+			return total
+		}
+	}
+	return count + 1
+}
+
+// hashUnitMultiplier converts e.g. "MH/s", "kh" or "G" to H/s. Units
+// without a hash prefix, like "G/s" (graphs) or "Sol/s", are taken as is.
+func hashUnitMultiplier(unit string) float64 {
+	unit = strings.TrimSpace(unit)
+	if unit == "" {
+		return 1
+	}
+	multiplier, ok := siMultipliers[strings.ToUpper(unit[:1])]
+	if !ok || multiplier == 1 {
+		return 1
+	}
+	if rest := unit[1:]; rest == "" || strings.HasPrefix(strings.ToLower(rest), "h") {
+		return multiplier
+	}
+	return 1
+}
+
+// stats reports the parsed values. A miner that stopped printing its
+// hashrate is reported as hashing nothing, so the hashrate watchdogs act
+// on it like on an API-reported zero.
+func (p *outputParser) stats(miner OutputMiner) *MinerStats {
+	now := time.Now()
+	stats := &MinerStats{
+		Name:      miner.Name,
+		Running:   true,
+		Algorithm: miner.Algorithm,
+		Pool:      miner.Pool,
+		Uptime:    int(now.Sub(miner.Started).Seconds()),
+	}
+	stats.Shares.Accepted = p.sharesOK
+	stats.Shares.Rejected = p.sharesFail
+
+	if now.Sub(p.gpusAt) < outputStale {
+		indexes := make([]int, 0, len(p.gpus))
+		for index := range p.gpus {
+			indexes = append(indexes, index)
+		}
+		sort.Ints(indexes)
+		var sum float64
+		for _, index := range indexes {
+			stats.GPUStats = append(stats.GPUStats, GPUMinerStats{Index: index, Hashrate: p.gpus[index]})
+			sum += p.gpus[index]
+		}
+		stats.Hashrate = sum
+	}
+	if now.Sub(p.totalAt) < outputStale {
+		stats.Hashrate = p.total
+	}
+	return stats
+}
@@ -0,0 +1,102 @@
+package collector
+
+import (
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// PCIeErrors holds cumulative PCIe AER error counters for a GPU. Rising
+// correctable counts usually mean a failing riser, cable or slot.
+type PCIeErrors struct {
+	Correctable int64            `json:"correctable"`
+	NonFatal    int64            `json:"nonFatal"`
+	Fatal       int64            `json:"fatal"`
+	Breakdown   map[string]int64 `json:"breakdown,omitempty"` // Non-zero correctable counters (RxErr, BadTLP...)
+
+	// Counters of the upstream (slot/switch) port, which sees link errors
+	// from the other side
+	PortBusID       string `json:"portBusId,omitempty"`
+	PortCorrectable *int64 `json:"portCorrectable,omitempty"`
+	PortNonFatal    *int64 `json:"portNonFatal,omitempty"`
+	PortFatal       *int64 `json:"portFatal,omitempty"`
+}
+
+var pciAddress = regexp.MustCompile(`^[0-9a-f]{4}:[0-9a-f]{2}:[0-9a-f]{2}\.[0-7]$`)
+
+// getPCIeErrors reads AER counters from sysfs for the device at busID.
+// Returns nil when the kernel doesn't expose AER stats for the device.
+func (c *Collector) getPCIeErrors(busID string) *PCIeErrors {
+	if busID == "" {
+		return nil
+	}
+	devPath := filepath.Join("/sys/bus/pci/devices", normalizeBusID(busID))
+
+	correctable, breakdown, ok := c.readAERFile(filepath.Join(devPath, "aer_dev_correctable"))
+	if !ok {
+		return nil
+	}
+	nonFatal, _, _ := c.readAERFile(filepath.Join(devPath, "aer_dev_nonfatal"))
+	fatal, _, _ := c.readAERFile(filepath.Join(devPath, "aer_dev_fatal"))
+
+	errors := &PCIeErrors{
+		Correctable: correctable,
+		NonFatal:    nonFatal,
+		Fatal:       fatal,
+	}
+	if len(breakdown) > 0 {
+		errors.Breakdown = breakdown
+	}
+
+	// The parent directory of the resolved device is its upstream bridge
+	if resolved, err := filepath.EvalSymlinks(devPath); err == nil {
+		parent := filepath.Dir(resolved)
+		if pciAddress.MatchString(filepath.Base(parent)) {
+			if total, _, ok := c.readAERFile(filepath.Join(parent, "aer_dev_correctable")); ok {
+				errors.PortBusID = filepath.Base(parent)
+				errors.PortCorrectable = &total
+				if total, _, ok := c.readAERFile(filepath.Join(parent, "aer_dev_nonfatal")); ok {
+					errors.PortNonFatal = &total
+				}
+				if total, _, ok := c.readAERFile(filepath.Join(parent, "aer_dev_fatal")); ok {
+					errors.PortFatal = &total
+				}
+			}
+		}
+	}
+
+	return errors
+}
+
+// readAERFile parses an aer_dev_* file:
+//
+//	RxErr 0
+//	BadTLP 2
+//	...
+//	TOTAL_ERR_COR 2
+func (c *Collector) readAERFile(path string) (int64, map[string]int64, bool) {
+	data, err := c.fs.ReadFile(path)
+	if err != nil {
+		return 0, nil, false
+	}
+
+	var total int64
+	counters := map[string]int64{}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		value, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		if strings.HasPrefix(fields[0], "TOTAL_ERR_") {
+			total = value
+		} else if value > 0 {
+			counters[fields[0]] = value
+		}
+	}
+	return total, counters, true
+}
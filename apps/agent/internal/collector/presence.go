@@ -0,0 +1,149 @@
+package collector
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// GPUPresence cross-checks the GPUs on the PCI bus, those the driver
+// (nvidia-smi/amdgpu) reports and those the running miner uses
+type GPUPresence struct {
+	PCI     int          `json:"pci"`
+	Driver  int          `json:"driver"`
+	Miner   *int         `json:"miner,omitempty"` // Nil when no miner reports per-GPU stats
+	Missing []MissingGPU `json:"missing,omitempty"`
+}
+
+// MissingGPU is a GPU that dropped out of one of the enumerations
+type MissingGPU struct {
+	BusID  string `json:"busId"`
+	Name   string `json:"name,omitempty"`
+	Source string `json:"source"` // Where it is missing: "pci", "driver" or "miner"
+	Since  int64  `json:"since"`  // Unix seconds
+	New    bool   `json:"-"`      // First detected in this check
+}
+
+// miningVendorIDs are the PCI vendors of mining GPUs; onboard graphics
+// (Intel, ASPEED BMCs) are ignored
+var miningVendorIDs = map[string]bool{
+	"0x10de": true, // NVIDIA
+	"0x1002": true, // AMD
+}
+
+// CheckGPUPresence compares the PCI bus, the driver view in gpus and the
+// miner's GPUs. A GPU that fell off the bus disappears from PCI (or reads
+// back as 0xff), one with a crashed driver context from the driver list,
+// and one the miner dropped from the miner's device list.
+func (c *Collector) CheckGPUPresence(gpus []GPUStats, miner *MinerStats) *GPUPresence {
+	c.presenceMu.Lock()
+	defer c.presenceMu.Unlock()
+
+	if c.knownGPUs == nil {
+		c.knownGPUs = map[string]string{}
+		c.missingSeen = map[string]time.Time{}
+	}
+
+	pci := c.pciGPUs()
+	driver := map[string]string{} // Bus ID -> vendor
+	for _, gpu := range gpus {
+		if gpu.BusID == "" {
+			continue
+		}
+		busID := normalizeBusID(gpu.BusID)
+		driver[busID] = gpu.Vendor
+		c.knownGPUs[busID] = gpu.Name
+	}
+	for busID := range pci {
+		if _, ok := c.knownGPUs[busID]; !ok {
+			c.knownGPUs[busID] = c.lspciName(busID)
+		}
+	}
+
+	presence := &GPUPresence{PCI: len(pci), Driver: len(driver)}
+	var missing []MissingGPU
+
+	for busID, name := range c.knownGPUs {
+		if !pci[busID] {
+			missing = append(missing, MissingGPU{BusID: busID, Name: name, Source: "pci"})
+		} else if _, ok := driver[busID]; !ok {
+			missing = append(missing, MissingGPU{BusID: busID, Name: name, Source: "driver"})
+		}
+	}
+
+	if miner != nil && miner.Running && len(miner.GPUStats) > 0 {
+		count := len(miner.GPUStats)
+		presence.Miner = &count
+
+		// Only compare vendors the miner mines on: with one instance per
+		// vendor the detected miner sees only part of the rig
+		used := map[string]bool{}
+		vendors := map[string]bool{}
+		for _, gpu := range miner.GPUStats {
+			if gpu.BusID == "" {
+				continue
+			}
+			busID := normalizeBusID(gpu.BusID)
+			used[busID] = true
+			vendors[driver[busID]] = true
+		}
+		if len(used) > 0 {
+			for busID, vendor := range driver {
+				if vendors[vendor] && !used[busID] {
+					missing = append(missing, MissingGPU{BusID: busID, Name: c.knownGPUs[busID], Source: "miner"})
+				}
+			}
+		}
+	}
+
+	// Track when each GPU went missing; forget the ones that came back
+	now := time.Now()
+	current := map[string]bool{}
+	for i := range missing {
+		key := missing[i].Source + "/" + missing[i].BusID
+		current[key] = true
+		since, ok := c.missingSeen[key]
+		if !ok {
+			since = now
+			c.missingSeen[key] = now
+			missing[i].New = true
+		}
+		missing[i].Since = since.Unix()
+	}
+	for key := range c.missingSeen {
+		if !current[key] {
+			delete(c.missingSeen, key)
+		}
+	}
+
+	sort.Slice(missing, func(i, j int) bool { return missing[i].BusID < missing[j].BusID })
+	presence.Missing = missing
+	return presence
+}
+
+// pciGPUs returns the mining GPUs present on the PCI bus. Devices whose
+// config space reads back as all ones have fallen off the bus.
+func (c *Collector) pciGPUs() map[string]bool {
+	gpus := map[string]bool{}
+	pciPath := "/sys/bus/pci/devices"
+	entries, err := c.fs.ReadDir(pciPath)
+	if err != nil {
+		return gpus
+	}
+
+	for _, entry := range entries {
+		devPath := filepath.Join(pciPath, entry.Name())
+		if !strings.HasPrefix(c.readSysfs(filepath.Join(devPath, "class")), "0x03") {
+			continue
+		}
+		if !miningVendorIDs[c.readSysfs(filepath.Join(devPath, "vendor"))] {
+			continue
+		}
+		if c.readSysfs(filepath.Join(devPath, "revision")) == "0xff" {
+			continue
+		}
+		gpus[entry.Name()] = true
+	}
+	return gpus
+}
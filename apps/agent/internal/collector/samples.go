@@ -0,0 +1,200 @@
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Range summarizes a reading's fast samples over a stats interval
+type Range struct {
+	Min int `json:"min"`
+	Avg int `json:"avg"`
+	Max int `json:"max"`
+}
+
+// GPUSamples holds a GPU's temperatures and power sampled every few
+// seconds between two stats reports. A spike that trips the miner and is
+// gone by the next report still shows in Max.
+type GPUSamples struct {
+	Samples     int    `json:"samples"`    // Since the previous stats report
+	IntervalMs  int    `json:"intervalMs"` // Between samples
+	Temperature *Range `json:"temperature,omitempty"`
+	MemTemp     *Range `json:"memTemp,omitempty"`
+	HotspotTemp *Range `json:"hotspotTemp,omitempty"` // AMD only (see GPUStats)
+	PowerDraw   *Range `json:"powerDraw,omitempty"`
+}
+
+// rangeSum accumulates the samples of one reading
+type rangeSum struct {
+	n, min, max, sum int
+}
+
+func (r *rangeSum) add(v *int) {
+	if v == nil {
+		return
+	}
+	if r.n == 0 || *v < r.min {
+		r.min = *v
+	}
+	if r.n == 0 || *v > r.max {
+		r.max = *v
+	}
+	r.sum += *v
+	r.n++
+}
+
+func (r *rangeSum) result() *Range {
+	if r.n == 0 {
+		return nil
+	}
+	// Rounded to the nearest, as the readings are whole degrees and watts
+	return &Range{Min: r.min, Avg: (r.sum + r.n/2) / r.n, Max: r.max}
+}
+
+// gpuSampleSums accumulates a GPU's samples for the current interval
+type gpuSampleSums struct {
+	samples                       int
+	temp, memTemp, hotspot, power rangeSum
+}
+
+// StartGPUSampler samples GPU temperatures and power every interval in the
+// background, for the min/avg/max reported with each GPU's stats
+func (c *Collector) StartGPUSampler(interval time.Duration) {
+	c.sampleMu.Lock()
+	c.sampleInterval = interval
+	c.sampleMu.Unlock()
+
+	if _, err := c.run.LookPath("nvidia-smi"); err == nil {
+		go c.sampleNvidiaGPUs(interval)
+	}
+	go c.sampleAMDGPUs(interval)
+}
+
+// recordGPUSample adds one sample for a GPU; readings it lacks are nil
+func (c *Collector) recordGPUSample(busID string, temp, memTemp, hotspot, power *int) {
+	c.sampleMu.Lock()
+	defer c.sampleMu.Unlock()
+
+	if c.samples == nil {
+		c.samples = map[string]*gpuSampleSums{}
+	}
+	key := normalizeBusID(busID)
+	sums, ok := c.samples[key]
+	if !ok {
+		sums = &gpuSampleSums{}
+		c.samples[key] = sums
+	}
+	sums.samples++
+	sums.temp.add(temp)
+	sums.memTemp.add(memTemp)
+	sums.hotspot.add(hotspot)
+	sums.power.add(power)
+}
+
+// takeGPUSamples returns the ranges of a GPU and starts a new interval
+func (c *Collector) takeGPUSamples(busID string) *GPUSamples {
+	c.sampleMu.Lock()
+	defer c.sampleMu.Unlock()
+
+	key := normalizeBusID(busID)
+	sums, ok := c.samples[key]
+	if !ok || sums.samples == 0 {
+		return nil
+	}
+	delete(c.samples, key)
+	return &GPUSamples{
+		Samples:     sums.samples,
+		IntervalMs:  int(c.sampleInterval / time.Millisecond),
+		Temperature: sums.temp.result(),
+		MemTemp:     sums.memTemp.result(),
+		HotspotTemp: sums.hotspot.result(),
+		PowerDraw:   sums.power.result(),
+	}
+}
+
+// sampleNvidiaGPUs streams temperatures and power from nvidia-smi in loop
+// mode, restarting it if it exits
+func (c *Collector) sampleNvidiaGPUs(interval time.Duration) {
+	for {
+		cmd := c.run.Command("nvidia-smi",
+			"--query-gpu=pci.bus_id,temperature.gpu,temperature.memory,power.draw",
+			"--format=csv,noheader,nounits", "-lms", fmt.Sprint(interval.Milliseconds()))
+		stdout, err := cmd.StdoutPipe()
+		if err == nil {
+			err = cmd.Start()
+		}
+		if err == nil {
+			scanner := bufio.NewScanner(stdout)
+			for scanner.Scan() {
+				parts := strings.Split(scanner.Text(), ",")
+				if len(parts) != 4 {
+					continue
+				}
+				c.recordGPUSample(strings.TrimSpace(parts[0]),
+					parseIntPtr(parts[1]), parseIntPtr(parts[2]), nil, parseIntPtr(parts[3]))
+			}
+			cmd.Wait()
+		}
+		time.Sleep(10 * time.Second)
+	}
+}
+
+// sampleAMDGPUs reads temperatures and power from sysfs
+func (c *Collector) sampleAMDGPUs(interval time.Duration) {
+	for {
+		entries, err := c.fs.ReadDir("/sys/class/drm")
+		if err != nil {
+			return
+		}
+
+		found := false
+		for _, entry := range entries {
+			if !strings.HasPrefix(entry.Name(), "card") || strings.Contains(entry.Name(), "-") {
+				continue
+			}
+			cardPath := filepath.Join("/sys/class/drm", entry.Name(), "device")
+			if vendor, _ := c.fs.ReadFile(filepath.Join(cardPath, "vendor")); strings.TrimSpace(string(vendor)) != "0x1002" {
+				continue
+			}
+			found = true
+
+			link, err := os.Readlink(cardPath)
+			if err != nil {
+				continue
+			}
+			hwmons, err := c.fs.ReadDir(filepath.Join(cardPath, "hwmon"))
+			if err != nil || len(hwmons) == 0 {
+				continue
+			}
+			hwmon := filepath.Join(cardPath, "hwmon", hwmons[0].Name())
+
+			// temp1 is edge, temp2 junction, temp3 memory, in millidegrees
+			temp := func(sensor string) *int {
+				if v := c.readSysfsIntPtr(filepath.Join(hwmon, sensor+"_input")); v != nil {
+					t := *v / 1000
+					return &t
+				}
+				return nil
+			}
+			// Microwatts; RDNA3 only has the instantaneous power1_input
+			power := c.readSysfsIntPtr(filepath.Join(hwmon, "power1_average"))
+			if power == nil {
+				power = c.readSysfsIntPtr(filepath.Join(hwmon, "power1_input"))
+			}
+			if power != nil {
+				*power /= 1000000
+			}
+			c.recordGPUSample(filepath.Base(link), temp("temp1"), temp("temp3"), temp("temp2"), power)
+		}
+
+		// Nothing to sample on NVIDIA-only rigs
+		if !found {
+			return
+		}
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,167 @@
+package collector
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Share rate settings
+const (
+	shareRateWindow = 15 * time.Minute // Rolling window for shares/minute
+	shareRateMin    = time.Minute      // Shortest span a rate is derived from
+	shareStallAfter = 20 * time.Minute // Hashing without an accepted share
+
+	// Pool-side hashrate is noisy: it needs a longer window and enough
+	// shares to mean something
+	effectiveWindow    = time.Hour
+	effectiveMinShares = 10
+)
+
+// shareSample is an accepted-share counter reading
+type shareSample struct {
+	at       time.Time
+	accepted int
+}
+
+// workSample is the work the pool credited up to a counter reading
+type workSample struct {
+	at       time.Time
+	accepted int
+	work     float64 // Hashes: each accepted share counts its difficulty
+}
+
+// shareHistory is the recent counter readings of a miner or one of its GPUs
+type shareHistory struct {
+	samples   []shareSample
+	lastShare time.Time // Last counter increase, or when tracking started
+	work      []workSample
+}
+
+// shareTracker derives share rates from the cumulative counters miners
+// report
+type shareTracker struct {
+	mu       sync.Mutex
+	miner    string
+	history  map[string]*shareHistory // "miner" or "miner/gpu" -> readings
+	stallFor map[string]time.Time     // Miner -> first reported stall
+}
+
+// trackShares fills the shares/minute and time-since-last-share fields of
+// the miner and of the GPUs that report their own accepted count
+func (c *Collector) trackShares(stats *MinerStats) {
+	if stats == nil || !stats.Running {
+		return
+	}
+	t := &c.shares
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.history == nil || t.miner != stats.Name {
+		t.miner = stats.Name
+		t.history = map[string]*shareHistory{}
+		t.stallFor = map[string]time.Time{}
+	}
+	now := time.Now()
+
+	// Counters are only meaningful once the API answers
+	if stats.Version == "" && stats.Hashrate == 0 && stats.Shares.Accepted == 0 {
+		return
+	}
+	stats.SharesPerMinute, stats.LastShareAgo = t.record(stats.Name, stats.Shares.Accepted, stats.Uptime, now)
+	if stats.Difficulty > 0 {
+		stats.EffectiveHashrate = t.recordWork(stats.Name, stats.Shares.Accepted, stats.Difficulty, now)
+	}
+
+	for i := range stats.GPUStats {
+		gpu := &stats.GPUStats[i]
+		if gpu.Accepted == nil {
+			continue
+		}
+		key := stats.Name + "/" + gpu.BusID
+		if gpu.BusID == "" {
+			key = stats.Name + "/" + strconv.Itoa(gpu.Index)
+		}
+		gpu.SharesPerMinute, gpu.LastShareAgo = t.record(key, *gpu.Accepted, stats.Uptime, now)
+	}
+
+	// A miner that hashes but gets nothing accepted usually has a pool or
+	// wallet problem the raw counters hide
+	stalled := stats.Hashrate > 0 && stats.LastShareAgo != nil &&
+		time.Duration(*stats.LastShareAgo)*time.Second >= shareStallAfter
+	if !stalled {
+		delete(t.stallFor, stats.Name)
+		return
+	}
+	stats.SharesStalled = true
+	if _, ok := t.stallFor[stats.Name]; !ok {
+		t.stallFor[stats.Name] = now
+		stats.StallNew = true
+	}
+}
+
+// record adds a counter reading and returns the shares per minute over the
+// window, once it spans at least a minute, and the seconds since the last
+// accepted share
+func (t *shareTracker) record(key string, accepted, uptime int, now time.Time) (*float64, *int) {
+	h := t.history[key]
+	if h == nil || (len(h.samples) > 0 && accepted < h.samples[len(h.samples)-1].accepted) {
+		// New miner or counters reset by a restart. Without shares yet,
+		// the miner's uptime tells how long it has gone without one.
+		h = &shareHistory{lastShare: now}
+		if accepted == 0 && uptime > 0 {
+			h.lastShare = now.Add(-time.Duration(uptime) * time.Second)
+		}
+		t.history[key] = h
+	}
+
+	if n := len(h.samples); n > 0 && accepted > h.samples[n-1].accepted {
+		h.lastShare = now
+	}
+	h.samples = append(h.samples, shareSample{at: now, accepted: accepted})
+
+	cutoff := now.Add(-shareRateWindow)
+	drop := 0
+	for drop < len(h.samples)-1 && h.samples[drop].at.Before(cutoff) {
+		drop++
+	}
+	h.samples = h.samples[drop:]
+
+	ago := int(now.Sub(h.lastShare).Seconds())
+	first := h.samples[0]
+	span := now.Sub(first.at)
+	if span < shareRateMin {
+		return nil, &ago
+	}
+	rate := float64(accepted-first.accepted) / span.Minutes()
+	rate = float64(int(rate*100+0.5)) / 100
+	return &rate, &ago
+}
+
+// recordWork credits the shares accepted since the last reading at the
+// current difficulty and returns the pool-side hashrate over the window.
+// Called after record, which starts a new history when counters reset.
+func (t *shareTracker) recordWork(key string, accepted int, difficulty float64, now time.Time) *float64 {
+	h := t.history[key]
+	var work float64
+	if n := len(h.work); n > 0 {
+		last := h.work[n-1]
+		work = last.work + float64(accepted-last.accepted)*difficulty
+	}
+	h.work = append(h.work, workSample{at: now, accepted: accepted, work: work})
+
+	cutoff := now.Add(-effectiveWindow)
+	drop := 0
+	for drop < len(h.work)-1 && h.work[drop].at.Before(cutoff) {
+		drop++
+	}
+	h.work = h.work[drop:]
+
+	first := h.work[0]
+	span := now.Sub(first.at)
+	if span < shareRateMin || accepted-first.accepted < effectiveMinShares {
+		return nil
+	}
+	rate := (work - first.work) / span.Seconds()
+	return &rate
+}
@@ -0,0 +1,211 @@
+package collector
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ThrottleStats counts the seconds a GPU spent throttled, sampled once a
+// second in the background
+type ThrottleStats struct {
+	PowerSeconds   int   `json:"powerSeconds"`   // Since the previous stats report
+	ThermalSeconds int   `json:"thermalSeconds"` // Since the previous stats report
+	SampledSeconds int   `json:"sampledSeconds"` // Samples in this interval
+	PowerTotal     int64 `json:"powerTotal"`     // Since agent start
+	ThermalTotal   int64 `json:"thermalTotal"`   // Since agent start
+}
+
+// NVIDIA clocks_throttle_reasons bits
+const (
+	nvThrottleSWPowerCap   = 0x04
+	nvThrottleSWThermal    = 0x20
+	nvThrottleHWThermal    = 0x40
+	nvThrottleHWPowerBrake = 0x80
+)
+
+// AMD heuristics: below the top DPM level while busy counts as throttled,
+// attributed to power near the cap or temperature near the critical limit
+const (
+	amdBusyPercent      = 50
+	amdPowerCapFraction = 0.95
+	amdThermalMargin    = 5000 // Millidegrees below temp*_crit
+)
+
+// StartThrottleMonitor samples GPU throttle reasons every second
+func (c *Collector) StartThrottleMonitor() {
+	if _, err := c.run.LookPath("nvidia-smi"); err == nil {
+		go c.sampleNvidiaThrottle()
+	}
+	go c.sampleAMDThrottle()
+}
+
+// takeThrottleStats returns the counters of a GPU and starts a new interval
+func (c *Collector) takeThrottleStats(busID string) *ThrottleStats {
+	c.throttleMu.Lock()
+	defer c.throttleMu.Unlock()
+
+	counter, ok := c.throttle[normalizeBusID(busID)]
+	if !ok {
+		return nil
+	}
+	stats := *counter
+	counter.PowerSeconds = 0
+	counter.ThermalSeconds = 0
+	counter.SampledSeconds = 0
+	return &stats
+}
+
+// recordThrottle adds one second-long sample for a GPU
+func (c *Collector) recordThrottle(busID string, power, thermal bool) {
+	c.throttleMu.Lock()
+	defer c.throttleMu.Unlock()
+
+	if c.throttle == nil {
+		c.throttle = map[string]*ThrottleStats{}
+	}
+	key := normalizeBusID(busID)
+	counter, ok := c.throttle[key]
+	if !ok {
+		counter = &ThrottleStats{}
+		c.throttle[key] = counter
+	}
+
+	counter.SampledSeconds++
+	if power {
+		counter.PowerSeconds++
+		counter.PowerTotal++
+	}
+	if thermal {
+		counter.ThermalSeconds++
+		counter.ThermalTotal++
+	}
+}
+
+// sampleNvidiaThrottle streams throttle reasons from nvidia-smi in loop
+// mode, restarting it if it exits
+func (c *Collector) sampleNvidiaThrottle() {
+	for {
+		cmd := c.run.Command("nvidia-smi",
+			"--query-gpu=pci.bus_id,clocks_throttle_reasons.active",
+			"--format=csv,noheader", "-l", "1")
+		stdout, err := cmd.StdoutPipe()
+		if err == nil {
+			err = cmd.Start()
+		}
+		if err == nil {
+			scanner := bufio.NewScanner(stdout)
+			for scanner.Scan() {
+				parts := strings.Split(scanner.Text(), ",")
+				if len(parts) != 2 {
+					continue
+				}
+				mask, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimSpace(parts[1]), "0x"), 16, 64)
+				if err != nil {
+					continue
+				}
+				c.recordThrottle(strings.TrimSpace(parts[0]),
+					mask&(nvThrottleSWPowerCap|nvThrottleHWPowerBrake) != 0,
+					mask&(nvThrottleSWThermal|nvThrottleHWThermal) != 0)
+			}
+			cmd.Wait()
+		}
+		time.Sleep(10 * time.Second)
+	}
+}
+
+// sampleAMDThrottle infers throttling from sysfs clocks, power and temps
+func (c *Collector) sampleAMDThrottle() {
+	for {
+		entries, err := c.fs.ReadDir("/sys/class/drm")
+		if err != nil {
+			return
+		}
+
+		found := false
+		for _, entry := range entries {
+			if !strings.HasPrefix(entry.Name(), "card") || strings.Contains(entry.Name(), "-") {
+				continue
+			}
+			cardPath := filepath.Join("/sys/class/drm", entry.Name(), "device")
+			if vendor, _ := c.fs.ReadFile(filepath.Join(cardPath, "vendor")); strings.TrimSpace(string(vendor)) != "0x1002" {
+				continue
+			}
+			found = true
+
+			link, err := os.Readlink(cardPath)
+			if err != nil {
+				continue
+			}
+			power, thermal := c.amdThrottleSample(cardPath)
+			c.recordThrottle(filepath.Base(link), power, thermal)
+		}
+
+		// Nothing to sample on NVIDIA-only rigs
+		if !found {
+			return
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// amdThrottleSample reports whether a card is currently power or thermally
+// throttled
+func (c *Collector) amdThrottleSample(cardPath string) (power, thermal bool) {
+	busy := c.readSysfsInt(filepath.Join(cardPath, "gpu_busy_percent"))
+	if busy < amdBusyPercent {
+		return false, false
+	}
+
+	// Active sclk level below the highest one
+	data, err := c.fs.ReadFile(filepath.Join(cardPath, "pp_dpm_sclk"))
+	if err != nil {
+		return false, false
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	active := -1
+	for i, line := range lines {
+		if strings.Contains(line, "*") {
+			active = i
+		}
+	}
+	if active < 0 || active == len(lines)-1 {
+		return false, false
+	}
+
+	hwmons, err := c.fs.ReadDir(filepath.Join(cardPath, "hwmon"))
+	if err != nil || len(hwmons) == 0 {
+		return false, false
+	}
+	hwmon := filepath.Join(cardPath, "hwmon", hwmons[0].Name())
+
+	if powerCap := c.readSysfsInt(filepath.Join(hwmon, "power1_cap")); powerCap > 0 {
+		if draw := c.readSysfsInt(filepath.Join(hwmon, "power1_average")); float64(draw) >= float64(powerCap)*amdPowerCapFraction {
+			power = true
+		}
+	}
+
+	// temp1 is edge, temp2 junction, temp3 memory
+	for _, sensor := range []string{"temp1", "temp2", "temp3"} {
+		crit := c.readSysfsInt(filepath.Join(hwmon, sensor+"_crit"))
+		temp := c.readSysfsInt(filepath.Join(hwmon, sensor+"_input"))
+		if crit > 0 && temp >= crit-amdThermalMargin {
+			thermal = true
+		}
+	}
+
+	return power, thermal
+}
+
+// readSysfsInt reads an integer sysfs attribute, returning 0 on error
+func (c *Collector) readSysfsInt(path string) int64 {
+	data, err := c.fs.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	v, _ := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	return v
+}
@@ -3,7 +3,9 @@ package config
 import (
 	"flag"
 	"fmt"
+	"net"
 	"os"
+	"strconv"
 )
 
 // Config holds the agent configuration
@@ -14,8 +16,134 @@ type Config struct {
 	Debug         bool
 	GPUEnabled    bool
 	CPUEnabled    bool
+
+	// Seconds between the fast GPU temperature and power samples reported
+	// as min/avg/max per poll interval (0 = disabled)
+	GPUSampleInterval int
+
+	// NVIDIA driver modes applied at startup
+	NvidiaPersistence bool
+	NvidiaComputeMode string
+
+	// Speed test endpoints (empty = public defaults)
+	SpeedTestDownloadURL string
+	SpeedTestUploadURL   string
+
+	// IPMI/BMC access (empty host = local in-band BMC)
+	IPMIEnabled  bool
+	IPMIHost     string
+	IPMIUser     string
+	IPMIPassword string
+
+	// External wall power meters (comma-separated type:address specs)
+	PowerMeters string
+
+	// Pool API polling (0 = disabled)
+	PoolStatsInterval int // seconds
+
+	// Embedded stratum proxy listen address (empty = disabled)
+	StratumProxy string
+
+	// LAN ASICs to monitor (comma-separated IPs and/or CIDR subnets)
+	ASICs string
+
+	// DNS-over-HTTPS fallback and pinning of cached pool IPs
+	DNSFallback bool
+
+	// GPU models allowed for vBIOS flashing (comma-separated, empty = disabled)
+	VBIOSModels string
+
+	// Drop GPUs to minimum power when the miner is stopped, optionally
+	// suspending the rig
+	IdlePowerSave bool
+	IdleSuspend   bool
+
+	// What happens to the miner when the agent exits: stop, leave or adopt
+	MinerOnExit string
+
+	// Stats groups/fields to send and their cadence (JSON, see StatsFilter)
+	StatsFilter string
+
+	// Server connection: "websocket" or "grpc", and the gRPC address
+	// (empty = server host on the default gRPC port)
+	Transport string
+	GRPCAddr  string
+
+	// Additional servers (JSON list of {url, token, scope}), e.g. a
+	// customer's read-only monitoring server
+	ExtraServers string
+
+	// Rig labels sent at auth, e.g. "location=dc1,rack=r4,owner=acme"
+	Tags string
+
+	// Response to a dead or stalling GPU fan: alert, powercap (to
+	// FanFailPowerCap percent of the current limit) or stop the miner
+	FanFailAction   string
+	FanFailPowerCap int
+
+	// Restart the agent after this many minutes without an authenticated
+	// server connection while no miner is running (0 = disabled), then
+	// reboot the rig if WatchdogReboot is set and restarting didn't help
+	WatchdogOffline int
+	WatchdogReboot  bool
+
+	// USB watchdog dongle petted while the agent is healthy, as
+	// type:device (empty = none)
+	USBWatchdog string
+
+	// Outbound shaping: at most MaxMessageRate frames per second (0 =
+	// unlimited); messages queued within BatchWindow ms share a frame when
+	// the server supports batches (0 = no batching)
+	MaxMessageRate float64
+	BatchWindow    int
+
+	// Keeping the connection alive through NAT: seconds between heartbeats
+	// and between TCP keepalive probes (0 = system default), and to
+	// connect and authenticate. The server can override them.
+	HeartbeatInterval int
+	TCPKeepAlive      int
+	HandshakeTimeout  int
+
+	// Environment miners inherit: "clean" (an allowlist plus the
+	// comma-separated MinerEnvAllow names, NAME_* for a prefix) or
+	// "inherit" (everything the agent has)
+	MinerEnv      string
+	MinerEnvAllow string
+
+	// Miner APIs get a new key on every start where the miner supports
+	// one; those APIs may then listen on MinerAPIBind (empty = localhost)
+	MinerAPIAuth bool
+	MinerAPIBind string
+
+	// Electricity price per kWh for the profitability report, until the
+	// server sets a tariff (0 = unknown)
+	ElectricityPrice float64
+
+	// Agent and miner logs shipped to a syslog server or Loki (empty =
+	// disabled), with extra labels like "farm=f1,site=north"
+	LogShip       string
+	LogShipLabels string
+
+	// Timezone (IANA name) and locale applied at startup, for images
+	// that boot in UTC (empty = leave the system's)
+	Timezone string
+	Locale   string
+
+	// Spacing against inrush current tripping breakers on dense racks:
+	// seconds between starting miner instances and milliseconds between
+	// GPUs when applying OC (0 = all at once)
+	MinerStagger int
+	OCStagger    int
+
+	// Without a token, wait to be claimed with a code shown on the console
+	// and a local page on ClaimListen (empty = console only); the QR code
+	// links to ClaimURL (empty = the server URL + /claim)
+	Claim       bool
+	ClaimListen string
+	ClaimURL    string
 }
 
+
 // DefaultConfig returns a config with default values
 func DefaultConfig() *Config {
 	return &Config{
@@ -24,6 +152,26 @@ func DefaultConfig() *Config {
 		Debug:        false,
 		GPUEnabled:   true,
 		CPUEnabled:   true,
+		GPUSampleInterval: 2,
+
+		NvidiaPersistence: true,
+		NvidiaComputeMode: "DEFAULT",
+		IPMIEnabled:  true,
+
+		PoolStatsInterval: 300,
+		DNSFallback:       true,
+		MinerOnExit:       "adopt",
+		Transport:         "websocket",
+		FanFailAction:     "alert",
+		FanFailPowerCap:   50,
+		MaxMessageRate:    5,
+		BatchWindow:       200,
+		HeartbeatInterval: 30,
+		HandshakeTimeout:  45,
+		MinerEnv:          "clean",
+		MinerAPIAuth:      true,
+		Claim:             true,
+		ClaimListen:       ":4060",
 	}
 }
 
@@ -35,9 +183,55 @@ func Load() (*Config, error) {
 	flag.StringVar(&cfg.ServerURL, "server", cfg.ServerURL, "BloxOs server URL")
 	flag.StringVar(&cfg.Token, "token", "", "Rig authentication token (required)")
 	flag.IntVar(&cfg.PollInterval, "interval", cfg.PollInterval, "Poll interval in seconds")
+	flag.IntVar(&cfg.GPUSampleInterval, "gpu-sample-interval", cfg.GPUSampleInterval, "Seconds between GPU temperature and power samples, reported as min/avg/max per poll interval (0 = disabled)")
 	flag.BoolVar(&cfg.Debug, "debug", cfg.Debug, "Enable debug logging")
 	flag.BoolVar(&cfg.GPUEnabled, "gpu", cfg.GPUEnabled, "Enable GPU monitoring")
 	flag.BoolVar(&cfg.CPUEnabled, "cpu", cfg.CPUEnabled, "Enable CPU monitoring")
+	flag.BoolVar(&cfg.NvidiaPersistence, "nvidia-persistence", cfg.NvidiaPersistence, "Enable NVIDIA persistence mode at startup")
+	flag.StringVar(&cfg.NvidiaComputeMode, "nvidia-compute-mode", cfg.NvidiaComputeMode, "NVIDIA compute mode at startup (DEFAULT, PROHIBITED, EXCLUSIVE_PROCESS)")
+	flag.StringVar(&cfg.SpeedTestDownloadURL, "speedtest-download-url", "", "Speed test download URL (%d = bytes)")
+	flag.StringVar(&cfg.SpeedTestUploadURL, "speedtest-upload-url", "", "Speed test upload URL")
+	flag.BoolVar(&cfg.IPMIEnabled, "ipmi", cfg.IPMIEnabled, "Enable IPMI/BMC monitoring when a BMC is present")
+	flag.StringVar(&cfg.IPMIHost, "ipmi-host", "", "BMC address for out-of-band IPMI (default: local BMC)")
+	flag.StringVar(&cfg.IPMIUser, "ipmi-user", "ADMIN", "BMC username for out-of-band IPMI")
+	flag.StringVar(&cfg.PowerMeters, "power-meters", "", "Wall power meters, e.g. hs110:192.168.1.50,shelly:192.168.1.60#0,pzem:/dev/ttyUSB0")
+	flag.IntVar(&cfg.PoolStatsInterval, "pool-stats-interval", cfg.PoolStatsInterval, "Pool API polling interval in seconds (0 = disabled)")
+	flag.StringVar(&cfg.StratumProxy, "stratum-proxy", "", "Run miners through a local stratum failover proxy on this address, e.g. 127.0.0.1:3333")
+	flag.StringVar(&cfg.ASICs, "asics", "", "ASIC miners to monitor, e.g. 192.168.1.50,192.168.2.0/24")
+	flag.StringVar(&cfg.VBIOSModels, "vbios-models", "", "GPU models allowed for vBIOS flashing, e.g. \"RX 580,RX 570\" (empty = disabled)")
+	flag.BoolVar(&cfg.DNSFallback, "dns-fallback", cfg.DNSFallback, "Fall back to DNS-over-HTTPS and cached IPs when the local resolver fails")
+	flag.BoolVar(&cfg.IdlePowerSave, "idle-power-save", false, "Drop GPUs to minimum power states while the miner is stopped")
+	flag.BoolVar(&cfg.IdleSuspend, "idle-suspend", false, "Suspend the rig after stopping the miner (requires -idle-power-save)")
+	flag.StringVar(&cfg.MinerOnExit, "miner-on-exit", cfg.MinerOnExit, "Miner handling when the agent exits: stop, leave (unmanaged) or adopt (take over on restart)")
+	flag.StringVar(&cfg.StatsFilter, "stats-filter", "", `Stats filter JSON, e.g. {"skip":["cpu"],"intervals":{"network":300},"exclude":["gpus.coreClock"]}`)
+	flag.StringVar(&cfg.Transport, "transport", cfg.Transport, "Server transport: websocket or grpc")
+	flag.StringVar(&cfg.GRPCAddr, "grpc-addr", "", "gRPC server address for -transport=grpc (default: server host, port 50051)")
+	flag.StringVar(&cfg.ExtraServers, "extra-servers", "", `Additional servers, e.g. [{"url":"https://monitor.example.com","token":"...","scope":"stats"}] (scope: stats or full)`)
+	flag.StringVar(&cfg.Tags, "tags", "", "Rig tags sent to the server, e.g. location=dc1,rack=r4,owner=acme,circuit=c2")
+	flag.StringVar(&cfg.FanFailAction, "fan-fail-action", cfg.FanFailAction, "Response to a failed GPU fan: alert, powercap or stop (the miner)")
+	flag.IntVar(&cfg.FanFailPowerCap, "fan-fail-power-cap", cfg.FanFailPowerCap, "Power limit for a GPU with a failed fan, in percent of its current limit (-fan-fail-action=powercap)")
+	flag.IntVar(&cfg.WatchdogOffline, "watchdog-offline", 0, "Restart the agent after this many minutes unable to authenticate while no miner is running (0 = disabled)")
+	flag.BoolVar(&cfg.WatchdogReboot, "watchdog-reboot", false, "Reboot the rig when restarting the agent didn't restore the connection (-watchdog-offline)")
+	flag.StringVar(&cfg.USBWatchdog, "usb-watchdog", "", "USB watchdog dongle to pet while the agent is healthy, e.g. opendev:/dev/ttyACM0, qinheng:/dev/ttyUSB0 or hex:/dev/ttyUSB0#1E")
+	flag.Float64Var(&cfg.MaxMessageRate, "max-msg-rate", cfg.MaxMessageRate, "Most messages sent to a server per second (0 = unlimited)")
+	flag.IntVar(&cfg.BatchWindow, "batch-window", cfg.BatchWindow, "Milliseconds to collect small outgoing messages into one frame (0 = no batching)")
+	flag.IntVar(&cfg.HeartbeatInterval, "heartbeat-interval", cfg.HeartbeatInterval, "Seconds between heartbeats; lower it when a NAT router drops idle connections")
+	flag.IntVar(&cfg.TCPKeepAlive, "tcp-keepalive", 0, "Seconds between TCP keepalive probes (0 = system default)")
+	flag.IntVar(&cfg.HandshakeTimeout, "handshake-timeout", cfg.HandshakeTimeout, "Seconds to connect and authenticate before retrying")
+	flag.StringVar(&cfg.MinerEnv, "miner-env", cfg.MinerEnv, "Environment passed to miners: clean (allowlisted variables only) or inherit (the agent's full environment)")
+	flag.StringVar(&cfg.MinerEnvAllow, "miner-env-allow", "", "Extra variables passed to miners in clean mode, e.g. \"MY_VAR,GPU_TUNE_*\"")
+	flag.BoolVar(&cfg.MinerAPIAuth, "miner-api-auth", cfg.MinerAPIAuth, "Protect miner APIs with a key generated on every start (T-Rex, xmrig, PhoenixMiner, Claymore)")
+	flag.StringVar(&cfg.MinerAPIBind, "miner-api-bind", "", "Address the key-protected miner APIs listen on, e.g. 0.0.0.0 for monitoring from the LAN (empty = localhost)")
+	flag.Float64Var(&cfg.ElectricityPrice, "electricity-price", 0, "Electricity price per kWh, for profitability until the server sets a tariff")
+	flag.StringVar(&cfg.LogShip, "log-ship", "", "Ship agent and miner logs to syslog://host:514, syslog+tcp://, syslog+tls:// or loki://host:3100 (empty = disabled)")
+	flag.StringVar(&cfg.LogShipLabels, "log-ship-labels", "", "Extra labels on shipped logs, e.g. farm=f1,site=north")
+	flag.StringVar(&cfg.Timezone, "timezone", "", "System timezone set at startup, e.g. Europe/Berlin (empty = unchanged)")
+	flag.StringVar(&cfg.Locale, "locale", "", "System locale set at startup, e.g. en_US.UTF-8 (empty = unchanged)")
+	flag.IntVar(&cfg.MinerStagger, "miner-stagger", 0, "Seconds between starting miner instances, against inrush power spikes (0 = all at once)")
+	flag.IntVar(&cfg.OCStagger, "oc-stagger", 0, "Milliseconds between GPUs when applying OC, against inrush power spikes (0 = all at once)")
+	flag.BoolVar(&cfg.Claim, "claim", cfg.Claim, "Without a token, show a claim code to enter in the dashboard instead of exiting")
+	flag.StringVar(&cfg.ClaimListen, "claim-listen", cfg.ClaimListen, "Address of the local page showing the claim code (empty = console only)")
+	flag.StringVar(&cfg.ClaimURL, "claim-url", "", "Dashboard page the claim QR code links to (default: server URL + /claim)")
 	flag.Parse()
 
 	// Environment variable overrides
@@ -48,9 +242,189 @@ func Load() (*Config, error) {
 		cfg.Token = token
 	}
 
+	if meters := os.Getenv("BLOXOS_POWER_METERS"); meters != "" {
+		cfg.PowerMeters = meters
+	}
+	if asics := os.Getenv("BLOXOS_ASICS"); asics != "" {
+		cfg.ASICs = asics
+	}
+	if password := os.Getenv("BLOXOS_IPMI_PASSWORD"); password != "" {
+		cfg.IPMIPassword = password
+	}
+	if filter := os.Getenv("BLOXOS_STATS_FILTER"); filter != "" {
+		cfg.StatsFilter = filter
+	}
+	if transport := os.Getenv("BLOXOS_TRANSPORT"); transport != "" {
+		cfg.Transport = transport
+	}
+	if addr := os.Getenv("BLOXOS_GRPC_ADDR"); addr != "" {
+		cfg.GRPCAddr = addr
+	}
+	if servers := os.Getenv("BLOXOS_EXTRA_SERVERS"); servers != "" {
+		cfg.ExtraServers = servers
+	}
+	if tags := os.Getenv("BLOXOS_TAGS"); tags != "" {
+		cfg.Tags = tags
+	}
+	if action := os.Getenv("BLOXOS_FAN_FAIL_ACTION"); action != "" {
+		cfg.FanFailAction = action
+	}
+	if mode := os.Getenv("BLOXOS_MINER_ENV"); mode != "" {
+		cfg.MinerEnv = mode
+	}
+	if allow := os.Getenv("BLOXOS_MINER_ENV_ALLOW"); allow != "" {
+		cfg.MinerEnvAllow = allow
+	}
+	if bind := os.Getenv("BLOXOS_MINER_API_BIND"); bind != "" {
+		cfg.MinerAPIBind = bind
+	}
+	if endpoint := os.Getenv("BLOXOS_LOG_SHIP"); endpoint != "" {
+		cfg.LogShip = endpoint
+	}
+	if labels := os.Getenv("BLOXOS_LOG_SHIP_LABELS"); labels != "" {
+		cfg.LogShipLabels = labels
+	}
+	if timezone := os.Getenv("BLOXOS_TIMEZONE"); timezone != "" {
+		cfg.Timezone = timezone
+	}
+	if locale := os.Getenv("BLOXOS_LOCALE"); locale != "" {
+		cfg.Locale = locale
+	}
+	if minutes := os.Getenv("BLOXOS_WATCHDOG_OFFLINE"); minutes != "" {
+		n, err := strconv.Atoi(minutes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid BLOXOS_WATCHDOG_OFFLINE %q", minutes)
+		}
+		cfg.WatchdogOffline = n
+	}
+	if dongle := os.Getenv("BLOXOS_USB_WATCHDOG"); dongle != "" {
+		cfg.USBWatchdog = dongle
+	}
+	if rate := os.Getenv("BLOXOS_MAX_MSG_RATE"); rate != "" {
+		n, err := strconv.ParseFloat(rate, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid BLOXOS_MAX_MSG_RATE %q", rate)
+		}
+		cfg.MaxMessageRate = n
+	}
+	if seconds := os.Getenv("BLOXOS_HEARTBEAT_INTERVAL"); seconds != "" {
+		n, err := strconv.Atoi(seconds)
+		if err != nil {
+			return nil, fmt.Errorf("invalid BLOXOS_HEARTBEAT_INTERVAL %q", seconds)
+		}
+		cfg.HeartbeatInterval = n
+	}
+	if seconds := os.Getenv("BLOXOS_TCP_KEEPALIVE"); seconds != "" {
+		n, err := strconv.Atoi(seconds)
+		if err != nil {
+			return nil, fmt.Errorf("invalid BLOXOS_TCP_KEEPALIVE %q", seconds)
+		}
+		cfg.TCPKeepAlive = n
+	}
+	if seconds := os.Getenv("BLOXOS_GPU_SAMPLE_INTERVAL"); seconds != "" {
+		n, err := strconv.Atoi(seconds)
+		if err != nil {
+			return nil, fmt.Errorf("invalid BLOXOS_GPU_SAMPLE_INTERVAL %q", seconds)
+		}
+		cfg.GPUSampleInterval = n
+	}
+	if seconds := os.Getenv("BLOXOS_MINER_STAGGER"); seconds != "" {
+		n, err := strconv.Atoi(seconds)
+		if err != nil {
+			return nil, fmt.Errorf("invalid BLOXOS_MINER_STAGGER %q", seconds)
+		}
+		cfg.MinerStagger = n
+	}
+	if ms := os.Getenv("BLOXOS_OC_STAGGER"); ms != "" {
+		n, err := strconv.Atoi(ms)
+		if err != nil {
+			return nil, fmt.Errorf("invalid BLOXOS_OC_STAGGER %q", ms)
+		}
+		cfg.OCStagger = n
+	}
+	if price := os.Getenv("BLOXOS_ELECTRICITY_PRICE"); price != "" {
+		n, err := strconv.ParseFloat(price, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid BLOXOS_ELECTRICITY_PRICE %q", price)
+		}
+		cfg.ElectricityPrice = n
+	}
+
+	if url := os.Getenv("BLOXOS_CLAIM_URL"); url != "" {
+		cfg.ClaimURL = url
+	}
+
+	// Secrets not given as flags or in the environment come from the
+	// encrypted store (see secrets.go)
+	loadSecrets(cfg)
+
 	// Validate required fields
-	if cfg.Token == "" {
-		return nil, fmt.Errorf("token is required (use -token flag or BLOXOS_TOKEN env)")
+	if cfg.Token == "" && !cfg.Claim {
+		return nil, fmt.Errorf("token is required (use -token flag or BLOXOS_TOKEN env, or -claim)")
+	}
+	switch cfg.MinerOnExit {
+	case "stop", "leave", "adopt":
+	default:
+		return nil, fmt.Errorf("invalid -miner-on-exit %q (use stop, leave or adopt)", cfg.MinerOnExit)
+	}
+	switch cfg.Transport {
+	case "websocket", "grpc":
+	default:
+		return nil, fmt.Errorf("invalid -transport %q (use websocket or grpc)", cfg.Transport)
+	}
+	switch cfg.FanFailAction {
+	case "alert", "powercap", "stop":
+	default:
+		return nil, fmt.Errorf("invalid -fan-fail-action %q (use alert, powercap or stop)", cfg.FanFailAction)
+	}
+	if cfg.FanFailPowerCap < 10 || cfg.FanFailPowerCap > 100 {
+		return nil, fmt.Errorf("-fan-fail-power-cap must be between 10 and 100")
+	}
+	if cfg.WatchdogOffline < 0 {
+		return nil, fmt.Errorf("-watchdog-offline must not be negative")
+	}
+	if cfg.WatchdogOffline > 0 && cfg.WatchdogOffline < 5 {
+		return nil, fmt.Errorf("-watchdog-offline must be at least 5 minutes")
+	}
+	switch cfg.MinerEnv {
+	case "clean", "inherit":
+	default:
+		return nil, fmt.Errorf("invalid -miner-env %q (use clean or inherit)", cfg.MinerEnv)
+	}
+	if cfg.MinerAPIBind != "" {
+		if net.ParseIP(cfg.MinerAPIBind) == nil {
+			return nil, fmt.Errorf("invalid -miner-api-bind %q (expected an IP address)", cfg.MinerAPIBind)
+		}
+		if !cfg.MinerAPIAuth {
+			return nil, fmt.Errorf("-miner-api-bind requires -miner-api-auth, unprotected miner APIs stay on localhost")
+		}
+	}
+	if cfg.MaxMessageRate < 0 {
+		return nil, fmt.Errorf("-max-msg-rate must not be negative")
+	}
+	if cfg.ElectricityPrice < 0 {
+		return nil, fmt.Errorf("-electricity-price must not be negative")
+	}
+	if cfg.BatchWindow < 0 || cfg.BatchWindow > 5000 {
+		return nil, fmt.Errorf("-batch-window must be between 0 and 5000 ms")
+	}
+	if cfg.HeartbeatInterval < 5 || cfg.HeartbeatInterval > 300 {
+		return nil, fmt.Errorf("-heartbeat-interval must be between 5 and 300 seconds")
+	}
+	if cfg.TCPKeepAlive != 0 && (cfg.TCPKeepAlive < 5 || cfg.TCPKeepAlive > 300) {
+		return nil, fmt.Errorf("-tcp-keepalive must be 0 or between 5 and 300 seconds")
+	}
+	if cfg.HandshakeTimeout < 5 || cfg.HandshakeTimeout > 120 {
+		return nil, fmt.Errorf("-handshake-timeout must be between 5 and 120 seconds")
+	}
+	if cfg.GPUSampleInterval < 0 || cfg.GPUSampleInterval > 10 {
+		return nil, fmt.Errorf("-gpu-sample-interval must be between 0 and 10 seconds")
+	}
+	if cfg.MinerStagger < 0 || cfg.MinerStagger > 120 {
+		return nil, fmt.Errorf("-miner-stagger must be between 0 and 120 seconds")
+	}
+	if cfg.OCStagger < 0 || cfg.OCStagger > 30000 {
+		return nil, fmt.Errorf("-oc-stagger must be between 0 and 30000 ms")
 	}
 
 	return cfg, nil
@@ -0,0 +1,143 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bloxos/agent/internal/secrets"
+)
+
+// EnvFile is the environment file the installer writes and the systemd
+// unit reads
+const EnvFile = "/etc/bloxos/agent.env"
+
+// secretSettings are kept in the encrypted secrets store instead of in
+// plaintext flags or EnvFile. Flags and the environment still take
+// precedence, e.g. to replace a token.
+var secretSettings = []struct {
+	flag, env, name string
+	field           func(cfg *Config) *string
+}{
+	{"token", "BLOXOS_TOKEN", "token", func(cfg *Config) *string { return &cfg.Token }},
+	{"", "BLOXOS_IPMI_PASSWORD", "ipmiPassword", func(cfg *Config) *string { return &cfg.IPMIPassword }}, // Environment only
+	// Smart plug specs may carry passwords, e.g. shelly:admin:secret@192.168.1.60
+	{"power-meters", "BLOXOS_POWER_METERS", "powerMeters", func(cfg *Config) *string { return &cfg.PowerMeters }},
+}
+
+// legacyTokenPath is where claimed tokens were kept in plaintext
+func legacyTokenPath() string {
+	return filepath.Join(secrets.Dir(), "token")
+}
+
+// loadSecrets fills the secret settings not given otherwise from the store
+func loadSecrets(cfg *Config) {
+	for _, setting := range secretSettings {
+		field := setting.field(cfg)
+		if *field != "" {
+			continue
+		}
+		value, err := secrets.Get(setting.name)
+		if err != nil {
+			fmt.Printf("Warning: secrets store unreadable: %v\n", err)
+			break
+		}
+		*field = value
+	}
+	if cfg.Token == "" {
+		if data, err := os.ReadFile(legacyTokenPath()); err == nil {
+			cfg.Token = strings.TrimSpace(string(data))
+		}
+	}
+}
+
+// SaveToken stores the token the server issued when the rig was claimed
+func SaveToken(token string) error {
+	return secrets.Set("token", token)
+}
+
+// MigrateSecrets moves secrets kept in plaintext by older agents and the
+// installer into the encrypted store: the claimed token file and the
+// secret settings in EnvFile. The values in use are cfg's.
+func MigrateSecrets(cfg *Config) error {
+	if _, err := os.Stat(legacyTokenPath()); err == nil {
+		if err := SaveToken(cfg.Token); err != nil {
+			return fmt.Errorf("store token: %w", err)
+		}
+		os.Remove(legacyTokenPath())
+	}
+
+	data, err := os.ReadFile(EnvFile)
+	if err != nil {
+		return nil
+	}
+	lines := strings.Split(string(data), "\n")
+	moved := 0
+	for i, line := range lines {
+		name, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok {
+			continue
+		}
+		for _, setting := range secretSettings {
+			if name != setting.env {
+				continue
+			}
+			value = strings.Trim(value, `"'`)
+			if value != "" {
+				// The running value wins over a stale file
+				if current := *setting.field(cfg); current != "" {
+					value = current
+				}
+				if err := secrets.Set(setting.name, value); err != nil {
+					return fmt.Errorf("store %s: %w", setting.name, err)
+				}
+			}
+			lines[i] = fmt.Sprintf("# %s is kept in the encrypted secrets store", name)
+			moved++
+		}
+	}
+	if moved == 0 {
+		return nil
+	}
+	info, err := os.Stat(EnvFile)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(EnvFile, []byte(strings.Join(lines, "\n")), info.Mode().Perm()); err != nil {
+		return fmt.Errorf("rewrite %s: %w", EnvFile, err)
+	}
+	fmt.Printf("Moved %d secret(s) from %s to the encrypted secrets store\n", moved, EnvFile)
+	return nil
+}
+
+// StoreSecretFlags stores the secret settings among args in the encrypted
+// store and returns the other args, so a service definition needn't carry
+// them in plaintext
+func StoreSecretFlags(args []string) ([]string, error) {
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+		var store string
+		for _, setting := range secretSettings {
+			if strings.HasPrefix(args[i], "-") && setting.flag != "" && name == setting.flag {
+				store = setting.name
+			}
+		}
+		if store == "" {
+			rest = append(rest, args[i])
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("flag -%s needs a value", name)
+			}
+			i++
+			value = args[i]
+		}
+		if err := secrets.Set(store, value); err != nil {
+			return nil, fmt.Errorf("store -%s: %w", name, err)
+		}
+	}
+	return rest, nil
+}
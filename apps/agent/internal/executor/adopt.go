@@ -0,0 +1,168 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/bloxos/agent/internal/secrets"
+)
+
+// Agent exit policies for the managed miner
+const (
+	MinerExitStop  = "stop"  // Stop the miner with the agent
+	MinerExitLeave = "leave" // Leave it running unmanaged
+	MinerExitAdopt = "adopt" // Leave it running and take it over on restart
+)
+
+// runningState records the running miner processes so a restarted agent
+// can take them over
+type runningState struct {
+	Primary runningProcess   `json:"primary"`
+	Extra   []runningProcess `json:"extra,omitempty"`
+}
+
+type runningProcess struct {
+	Name   string `json:"name"`
+	Vendor string `json:"vendor,omitempty"`
+	PID    int    `json:"pid"`
+	Exe    string `json:"exe"` // Binary path, guards against PID reuse
+	Port   int    `json:"port,omitempty"`
+	// The API's bind address and key, which the collector needs to keep
+	// polling it
+	APIHost string `json:"apiHost,omitempty"`
+	APIKey  string `json:"apiKey,omitempty"`
+}
+
+// AdoptMiner takes over miners left running by a previous agent. It returns
+// the number of processes adopted.
+func (e *Executor) AdoptMiner() (int, error) {
+	e.minerMu.Lock()
+	defer e.minerMu.Unlock()
+
+	data, err := secrets.ReadFile(e.statePath())
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var state runningState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return 0, fmt.Errorf("invalid miner state: %w", err)
+	}
+
+	if !state.Primary.alive() {
+		// The primary is gone; extras are restarted with it by the server
+		os.Remove(e.statePath())
+		return 0, nil
+	}
+
+	// The miner points at the embedded proxy, which died with the old agent
+	if e.proxy != nil {
+		configs, err := e.loadConfigs()
+		if err != nil {
+			return 0, fmt.Errorf("no saved config to restart the stratum proxy: %w", err)
+		}
+		if err := e.proxy.Start(append([]string{configs[0].Pool}, configs[0].FailoverPools...)); err != nil {
+			return 0, err
+		}
+	}
+
+	e.procMu.Lock()
+	e.minerPID = state.Primary.PID
+	e.minerName = state.Primary.Name
+	e.minerPort = state.Primary.Port
+	apis := []MinerAPI{state.Primary.api()}
+	for _, extra := range state.Extra {
+		if extra.alive() {
+			e.extraMiners = append(e.extraMiners, minerInstance{name: extra.Name, vendor: extra.Vendor, pid: extra.PID, port: extra.Port})
+			apis = append(apis, extra.api())
+		}
+	}
+	e.procMu.Unlock()
+
+	// States from older agents have no ports; the collector then uses
+	// the default ones
+	var known []MinerAPI
+	for _, api := range apis {
+		if api.Port > 0 {
+			known = append(known, api)
+		}
+	}
+	e.setMinerAPIs(known)
+	return len(apis), nil
+}
+
+// saveRunningState records the started miner processes. It's encrypted,
+// as it holds the miner API keys.
+func (e *Executor) saveRunningState(exes map[int]string) error {
+	apis := map[int]MinerAPI{}
+	for _, api := range e.MinerAPIs() {
+		apis[api.PID] = api
+	}
+
+	state := runningState{
+		Primary: runningProcess{
+			Name:    e.minerName,
+			PID:     e.minerPID,
+			Exe:     exes[e.minerPID],
+			Port:    e.minerPort,
+			APIHost: apis[e.minerPID].Host,
+			APIKey:  apis[e.minerPID].Key,
+		},
+	}
+	for _, instance := range e.extraMiners {
+		state.Extra = append(state.Extra, runningProcess{
+			Name:    instance.name,
+			Vendor:  instance.vendor,
+			PID:     instance.pid,
+			Exe:     exes[instance.pid],
+			Port:    instance.port,
+			APIHost: apis[instance.pid].Host,
+			APIKey:  apis[instance.pid].Key,
+		})
+	}
+
+	if err := os.MkdirAll(e.configPath, 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return secrets.WriteFile(e.statePath(), data)
+}
+
+func (e *Executor) statePath() string {
+	return filepath.Join(e.configPath, "miner_state.json")
+}
+
+// api is the recorded API endpoint of the process
+func (p runningProcess) api() MinerAPI {
+	return MinerAPI{Name: canonicalMinerName(p.Name), PID: p.PID, Port: p.Port, Host: p.APIHost, Key: p.APIKey}
+}
+
+// alive reports whether the recorded process still runs the same binary
+func (p runningProcess) alive() bool {
+	if p.PID <= 0 || !processAlive(p.PID) {
+		return false
+	}
+	exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", p.PID))
+	if err != nil {
+		return false
+	}
+	return p.Exe == "" || exe == p.Exe
+}
+
+// processAlive reports whether a process exists
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return process.Signal(syscall.Signal(0)) == nil
+}
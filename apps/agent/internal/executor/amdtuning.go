@@ -0,0 +1,215 @@
+package executor
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DPMState sets the clock and voltage of a single DPM (P-state) level
+type DPMState struct {
+	Domain  string `json:"domain"`  // "core" or "mem"
+	Index   int    `json:"index"`   // P-state level
+	Clock   int    `json:"clock"`   // MHz
+	Voltage int    `json:"voltage"` // mV
+}
+
+// Hard voltage bounds on top of the driver's own OD_RANGE
+const (
+	minSafeVoltage = 700
+	maxSafeVoltage = 1200
+)
+
+// memTweakArgs matches amdmemtweak "--TIMING value" pairs
+var memTweakArgs = regexp.MustCompile(`^(--[A-Za-z0-9_]+ \d+)( --[A-Za-z0-9_]+ \d+)*$`)
+
+// memTweakFamilies are lspci name fragments of Polaris and Vega GPUs
+var memTweakFamilies = []string{"ellesmere", "baffin", "lexa", "polaris", "vega"}
+
+// odRange holds the overdrive limits reported by the driver
+type odRange struct {
+	minCore, maxCore int
+	minMem, maxMem   int
+	minVolt, maxVolt int
+}
+
+// applyAMDAdvanced writes per-P-state clocks/voltages to pp_od_clk_voltage and
+// memory timings via amdmemtweak. Both can hang or damage a card when pushed
+// too far, so they require AllowUnsafe and are range-checked first.
+func (e *Executor) applyAMDAdvanced(idx int, config *OCConfig) error {
+	if !config.AllowUnsafe {
+		return fmt.Errorf("P-state and memory timing changes require allowUnsafe")
+	}
+
+	var errors []string
+
+	if len(config.DPMStates) > 0 {
+		if err := e.applyDPMStates(idx, config.DPMStates); err != nil {
+			errors = append(errors, err.Error())
+		}
+	}
+
+	if config.MemTweak != "" {
+		if err := e.applyMemTweak(idx, config.MemTweak); err != nil {
+			errors = append(errors, err.Error())
+		}
+	}
+
+	if len(errors) > 0 {
+		return fmt.Errorf("%s", strings.Join(errors, "; "))
+	}
+	return nil
+}
+
+// applyDPMStates validates every state against OD_RANGE before writing any,
+// and resets the table to defaults if a write fails part way
+func (e *Executor) applyDPMStates(idx int, states []DPMState) error {
+	odPath := fmt.Sprintf("/sys/class/drm/card%d/device/pp_od_clk_voltage", idx)
+	data, err := e.fs.ReadFile(odPath)
+	if err != nil {
+		return fmt.Errorf("overdrive not available (set amdgpu.ppfeaturemask=0xffffffff): %w", err)
+	}
+	limits := parseODRange(string(data))
+
+	var commands []string
+	for _, state := range states {
+		var prefix string
+		var minClock, maxClock int
+		switch state.Domain {
+		case "core":
+			prefix, minClock, maxClock = "s", limits.minCore, limits.maxCore
+		case "mem":
+			prefix, minClock, maxClock = "m", limits.minMem, limits.maxMem
+		default:
+			return fmt.Errorf("invalid DPM domain %q (expected core or mem)", state.Domain)
+		}
+
+		if maxClock > 0 && (state.Clock < minClock || state.Clock > maxClock) {
+			return fmt.Errorf("%s state %d clock %dMHz outside %d-%dMHz", state.Domain, state.Index, state.Clock, minClock, maxClock)
+		}
+		if state.Voltage < minSafeVoltage || state.Voltage > maxSafeVoltage {
+			return fmt.Errorf("%s state %d voltage %dmV outside %d-%dmV", state.Domain, state.Index, state.Voltage, minSafeVoltage, maxSafeVoltage)
+		}
+		if limits.maxVolt > 0 && (state.Voltage < limits.minVolt || state.Voltage > limits.maxVolt) {
+			return fmt.Errorf("%s state %d voltage %dmV outside driver range %d-%dmV", state.Domain, state.Index, state.Voltage, limits.minVolt, limits.maxVolt)
+		}
+
+		commands = append(commands, fmt.Sprintf("%s %d %d %d", prefix, state.Index, state.Clock, state.Voltage))
+	}
+
+	for _, command := range commands {
+		if err := e.fs.WriteFile(odPath, []byte(command), 0644); err != nil {
+			// Restore the default table rather than leave it half-applied
+			e.fs.WriteFile(odPath, []byte("r"), 0644)
+			e.fs.WriteFile(odPath, []byte("c"), 0644)
+			return fmt.Errorf("writing %q failed, reset to defaults: %w", command, err)
+		}
+	}
+	if err := e.fs.WriteFile(odPath, []byte("c"), 0644); err != nil {
+		return fmt.Errorf("commit failed: %w", err)
+	}
+
+	if e.debug {
+		fmt.Printf("Applied %d DPM state(s) to GPU%d\n", len(commands), idx)
+	}
+	return nil
+}
+
+// parseODRange reads the OD_RANGE section of pp_od_clk_voltage:
+//
+//	OD_RANGE:
+//	SCLK:     300MHz       2000MHz
+//	MCLK:     300MHz       2250MHz
+//	VDDC:     750mV        1200mV
+func parseODRange(content string) odRange {
+	var r odRange
+	inRange := false
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "OD_") {
+			inRange = line == "OD_RANGE:"
+			continue
+		}
+		if !inRange {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		low := parseUnit(fields[1])
+		high := parseUnit(fields[2])
+		switch strings.TrimSuffix(fields[0], ":") {
+		case "SCLK":
+			r.minCore, r.maxCore = low, high
+		case "MCLK":
+			r.minMem, r.maxMem = low, high
+		case "VDDC":
+			r.minVolt, r.maxVolt = low, high
+		}
+	}
+	return r
+}
+
+// parseUnit parses values like "2000MHz" or "1200mV"
+func parseUnit(s string) int {
+	s = strings.TrimRight(s, "MHzmV")
+	v, _ := strconv.Atoi(s)
+	return v
+}
+
+// applyMemTweak applies memory timings with amdmemtweak
+func (e *Executor) applyMemTweak(idx int, tweak string) error {
+	tweak = strings.Join(strings.Fields(tweak), " ")
+	if !memTweakArgs.MatchString(tweak) {
+		return fmt.Errorf("invalid memTweak %q (expected --TIMING value pairs)", tweak)
+	}
+
+	path, err := e.run.LookPath("amdmemtweak")
+	if err != nil {
+		return fmt.Errorf("amdmemtweak not installed")
+	}
+
+	// Only GDDR5 (Polaris) and HBM2 (Vega) timings are supported
+	name := e.lspciGPUName(idx)
+	supported := false
+	for _, family := range memTweakFamilies {
+		if strings.Contains(strings.ToLower(name), family) {
+			supported = true
+			break
+		}
+	}
+	if !supported {
+		return fmt.Errorf("memory timing tuning is only supported on Polaris/Vega (found %q)", name)
+	}
+
+	args := append([]string{"--i", strconv.Itoa(idx)}, strings.Fields(tweak)...)
+	output, err := e.run.Command(path, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("amdmemtweak failed: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	if e.debug {
+		fmt.Printf("Applied memory timings to GPU%d: %s\n", idx, tweak)
+	}
+	return nil
+}
+
+// lspciGPUName returns the lspci description of a DRM card
+func (e *Executor) lspciGPUName(idx int) string {
+	link, err := os.Readlink(fmt.Sprintf("/sys/class/drm/card%d/device", idx))
+	if err != nil {
+		return ""
+	}
+	parts := strings.Split(link, "/")
+	busID := parts[len(parts)-1]
+
+	output, err := e.run.Command("lspci", "-s", busID).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
@@ -0,0 +1,66 @@
+package executor
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+)
+
+// minerAPIAuth are the miners whose API can be protected with a key, and
+// the flags setting it
+var minerAPIAuth = map[string]struct {
+	args func(key string) []string
+	// The API may listen beyond localhost once protected. The CDM miners
+	// (PhoenixMiner, Claymore) only take the password, their bind address
+	// stays as it is.
+	bindable bool
+}{
+	"t-rex":        {func(key string) []string { return []string{"--api-key", key} }, true},
+	"xmrig":        {func(key string) []string { return []string{"--http-access-token", key} }, true},
+	"phoenixminer": {func(key string) []string { return []string{"-cdmpass", key} }, false},
+	"claymore":     {func(key string) []string { return []string{"-mpsw", key} }, false},
+}
+
+// SetMinerAPIAccess sets whether miner APIs get a fresh key on every start
+// where the miner supports one, and the address those protected APIs
+// listen on (empty = 127.0.0.1). Unprotected APIs always stay on localhost.
+func (e *Executor) SetMinerAPIAccess(auth bool, bind string) {
+	e.apiAuth = auth
+	e.apiBind = bind
+}
+
+// newMinerAPI returns the API endpoint for a miner about to start on port
+func (e *Executor) newMinerAPI(name string, port int) (MinerAPI, error) {
+	name = canonicalMinerName(name)
+	api := MinerAPI{Name: name, Port: port}
+	auth, ok := minerAPIAuth[name]
+	if !e.apiAuth || !ok {
+		return api, nil
+	}
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		return api, fmt.Errorf("failed to generate miner API key: %w", err)
+	}
+	api.Key = hex.EncodeToString(key)
+	if auth.bindable {
+		api.Host = e.apiBind
+	}
+	return api, nil
+}
+
+// bindHost is the address the API listens on
+func (api MinerAPI) bindHost() string {
+	if api.Host == "" {
+		return "127.0.0.1"
+	}
+	return api.Host
+}
+
+// authArgs are the flags protecting the API with its key
+func (api MinerAPI) authArgs() []string {
+	auth, ok := minerAPIAuth[api.Name]
+	if !ok || api.Key == "" {
+		return nil
+	}
+	return auth.args(api.Key)
+}
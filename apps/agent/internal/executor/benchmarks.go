@@ -0,0 +1,267 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bloxos/agent/internal/system"
+)
+
+// Benchmark learning: readings are averaged with this weight once the miner
+// has warmed up, and readings far below the average are treated as a
+// problem with the rig rather than a new normal
+const (
+	benchmarkWeight    = 0.1
+	benchmarkWarmup    = 10 * time.Minute
+	benchmarkOutlier   = 0.7
+	benchmarkSaveEvery = 10 * time.Minute
+)
+
+// Benchmark is the hashrate one GPU of a model reaches on an algorithm with
+// a miner version, learned while mining or synced from the server
+type Benchmark struct {
+	GPUModel  string  `json:"gpuModel"` // As the driver names it, e.g. "NVIDIA GeForce RTX 3070"
+	Algorithm string  `json:"algorithm"`
+	Miner     string  `json:"miner"`
+	Version   string  `json:"version,omitempty"` // Empty = any version
+	Hashrate  float64 `json:"hashrate"`          // H/s
+	Power     int     `json:"power,omitempty"`   // W
+	Samples   int     `json:"samples,omitempty"` // Readings averaged on this rig; 0 = from the server
+	Updated   int64   `json:"updated"`           // Unix seconds
+}
+
+// BenchmarkReading is one GPU's hashrate from a miner poll
+type BenchmarkReading struct {
+	GPUModel string
+	Hashrate float64
+	Power    int
+}
+
+// benchmarkStore is the benchmark database, kept in memory and saved
+// every few minutes
+type benchmarkStore struct {
+	mu      sync.Mutex
+	loaded  bool
+	entries map[string]*Benchmark
+	dirty   bool
+	saved   time.Time
+}
+
+func (b *Benchmark) key() string {
+	return strings.Join([]string{b.GPUModel, b.Algorithm, b.Miner, b.Version}, "|")
+}
+
+func (e *Executor) benchmarksPath() string {
+	return filepath.Join(e.configPath, "benchmarks.json")
+}
+
+// loadBenchmarks reads the database on first use. Called with the store
+// locked.
+func (e *Executor) loadBenchmarks() {
+	s := &e.benchmarks
+	if s.loaded {
+		return
+	}
+	s.loaded = true
+	s.entries = map[string]*Benchmark{}
+
+	data, err := os.ReadFile(e.benchmarksPath())
+	if err != nil {
+		return
+	}
+	var list []*Benchmark
+	if err := json.Unmarshal(data, &list); err != nil {
+		fmt.Printf("Ignoring invalid benchmark database: %v\n", err)
+		return
+	}
+	for _, b := range list {
+		s.entries[b.key()] = b
+	}
+}
+
+// saveBenchmarks writes the database. Called with the store locked.
+func (e *Executor) saveBenchmarks() error {
+	s := &e.benchmarks
+	list := make([]*Benchmark, 0, len(s.entries))
+	for _, b := range s.entries {
+		list = append(list, b)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].key() < list[j].key() })
+
+	if err := os.MkdirAll(e.configPath, 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(e.benchmarksPath(), data, 0644); err != nil {
+		return err
+	}
+	s.dirty = false
+	s.saved = time.Now()
+	return nil
+}
+
+// RecordBenchmarks learns from a poll of a miner that has run for uptime.
+// GPUs with the same model are averaged together.
+func (e *Executor) RecordBenchmarks(algorithm, miner, version string, uptime time.Duration, readings []BenchmarkReading) {
+	if algorithm == "" || miner == "" || uptime < benchmarkWarmup {
+		return
+	}
+
+	s := &e.benchmarks
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e.loadBenchmarks()
+
+	now := time.Now()
+	for _, reading := range readings {
+		if reading.GPUModel == "" || reading.Hashrate <= 0 {
+			continue
+		}
+		b := &Benchmark{GPUModel: reading.GPUModel, Algorithm: strings.ToLower(algorithm), Miner: canonicalMinerName(miner), Version: version}
+		if existing, ok := s.entries[b.key()]; ok && existing.Samples > 0 {
+			b = existing
+			if reading.Hashrate < b.Hashrate*benchmarkOutlier {
+				continue
+			}
+			b.Hashrate += (reading.Hashrate - b.Hashrate) * benchmarkWeight
+			if reading.Power > 0 {
+				b.Power += int(float64(reading.Power-b.Power) * benchmarkWeight)
+			}
+		} else {
+			b.Hashrate = reading.Hashrate
+			b.Power = reading.Power
+			s.entries[b.key()] = b
+		}
+		b.Samples++
+		b.Updated = now.Unix()
+		s.dirty = true
+	}
+
+	// Learning is kept in memory while the disk is failing
+	if s.dirty && now.Sub(s.saved) >= benchmarkSaveEvery && !system.DiskDegraded() {
+		if err := e.saveBenchmarks(); err != nil {
+			fmt.Printf("Warning: failed to save benchmarks: %v\n", err)
+		}
+	}
+}
+
+// SyncBenchmarks stores benchmarks from the server, merging them with the
+// database unless replace is set, and returns the ones learned on this rig
+// for the server to collect. Learned entries are never overwritten.
+func (e *Executor) SyncBenchmarks(benchmarks []Benchmark, replace bool) ([]Benchmark, error) {
+	s := &e.benchmarks
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e.loadBenchmarks()
+
+	if replace {
+		for key, b := range s.entries {
+			if b.Samples == 0 {
+				delete(s.entries, key)
+			}
+		}
+	}
+	for _, b := range benchmarks {
+		if b.GPUModel == "" || b.Algorithm == "" || b.Miner == "" || b.Hashrate <= 0 {
+			return nil, fmt.Errorf("benchmark needs gpuModel, algorithm, miner and hashrate")
+		}
+		b.Algorithm = strings.ToLower(b.Algorithm)
+		b.Miner = canonicalMinerName(b.Miner)
+		b.Samples = 0
+		if existing, ok := s.entries[b.key()]; ok && existing.Samples > 0 {
+			continue
+		}
+		entry := b
+		s.entries[b.key()] = &entry
+	}
+	if err := e.saveBenchmarks(); err != nil {
+		return nil, fmt.Errorf("failed to save benchmarks: %w", err)
+	}
+
+	var learned []Benchmark
+	for _, b := range s.entries {
+		if b.Samples > 0 {
+			learned = append(learned, *b)
+		}
+	}
+	sort.Slice(learned, func(i, j int) bool { return learned[i].key() < learned[j].key() })
+	return learned, nil
+}
+
+// ExpectedHashrate returns the benchmark for a GPU model on an algorithm
+// with a miner: the exact version if known, else the most recent entry for
+// any version, preferring what was learned on this rig. ok is false when
+// there is none.
+func (e *Executor) ExpectedHashrate(gpuModel, algorithm, miner, version string) (Benchmark, bool) {
+	s := &e.benchmarks
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e.loadBenchmarks()
+
+	algorithm = strings.ToLower(algorithm)
+	miner = canonicalMinerName(miner)
+	if b, ok := s.entries[(&Benchmark{GPUModel: gpuModel, Algorithm: algorithm, Miner: miner, Version: version}).key()]; ok {
+		return *b, true
+	}
+
+	var best *Benchmark
+	better := func(b *Benchmark) bool {
+		if (b.Samples > 0) != (best.Samples > 0) {
+			return b.Samples > 0
+		}
+		return b.Updated > best.Updated
+	}
+	for _, b := range s.entries {
+		if b.GPUModel != gpuModel || b.Algorithm != algorithm || b.Miner != miner {
+			continue
+		}
+		if best == nil || better(b) {
+			best = b
+		}
+	}
+	if best == nil {
+		return Benchmark{}, false
+	}
+	return *best, true
+}
+
+// BenchmarkMiners lists the miners with a benchmark for a GPU model on an
+// algorithm
+func (e *Executor) BenchmarkMiners(gpuModel, algorithm string) []string {
+	s := &e.benchmarks
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e.loadBenchmarks()
+
+	seen := map[string]bool{}
+	var miners []string
+	for _, b := range s.entries {
+		if b.GPUModel == gpuModel && b.Algorithm == strings.ToLower(algorithm) && !seen[b.Miner] {
+			seen[b.Miner] = true
+			miners = append(miners, b.Miner)
+		}
+	}
+	sort.Strings(miners)
+	return miners
+}
+
+// FlushBenchmarks saves unsaved learning, e.g. before the agent exits
+func (e *Executor) FlushBenchmarks() {
+	s := &e.benchmarks
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dirty {
+		if err := e.saveBenchmarks(); err != nil {
+			fmt.Printf("Warning: failed to save benchmarks: %v\n", err)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CoinPreset maps a coin to its algorithm, known pools and the quirks of
+// individual miners, so flight sheets can say "KAS @ herominers" instead of
+// spelling out stratum URLs per rig
+type CoinPreset struct {
+	Coin      string                `json:"coin"`
+	Algorithm string                `json:"algorithm"`
+	Pools     map[string]PoolPreset `json:"pools,omitempty"`  // Pool key ("2miners", "herominers") -> endpoints
+	Miners    map[string]MinerQuirk `json:"miners,omitempty"` // Miner name -> quirks for this coin
+}
+
+// PoolPreset is a pool's stratum endpoints for one coin
+type PoolPreset struct {
+	Host     string   `json:"host"`
+	Port     int      `json:"port"`
+	TLSPort  int      `json:"tlsPort,omitempty"`  // 0 = no TLS endpoint
+	Failover []string `json:"failover,omitempty"` // Backup hosts on the same ports
+}
+
+// MinerQuirk adjusts the launch of one miner for a coin
+type MinerQuirk struct {
+	Algorithm   string   `json:"algorithm,omitempty"`   // The miner's own name for the algorithm
+	ExtraArgs   []string `json:"extraArgs,omitempty"`   // Always added
+	TLSArgs     []string `json:"tlsArgs,omitempty"`     // Added for TLS pools
+	StripScheme bool     `json:"stripScheme,omitempty"` // Pass host:port instead of a stratum URL
+}
+
+// builtinCoinPresets ship with the agent; synced presets override them
+// per coin
+var builtinCoinPresets = []CoinPreset{
+	{
+		Coin: "ETC", Algorithm: "etchash",
+		Pools: map[string]PoolPreset{
+			"2miners": {Host: "etc.2miners.com", Port: 1010, TLSPort: 11010},
+			"f2pool":  {Host: "etc.f2pool.com", Port: 8118},
+		},
+		Miners: map[string]MinerQuirk{
+			"lolminer":     {Algorithm: "ETCHASH", TLSArgs: []string{"--tls", "on"}, StripScheme: true},
+			"gminer":       {TLSArgs: []string{"--ssl", "1"}, StripScheme: true},
+			"phoenixminer": {ExtraArgs: []string{"-coin", "etc"}},
+		},
+	},
+	{
+		Coin: "RVN", Algorithm: "kawpow",
+		Pools: map[string]PoolPreset{
+			"2miners": {Host: "rvn.2miners.com", Port: 6060, TLSPort: 16060},
+		},
+		Miners: map[string]MinerQuirk{
+			"gminer": {TLSArgs: []string{"--ssl", "1"}, StripScheme: true},
+		},
+	},
+	{
+		Coin: "ERG", Algorithm: "autolykos2",
+		Pools: map[string]PoolPreset{
+			"2miners":  {Host: "erg.2miners.com", Port: 8888, TLSPort: 18888},
+			"nanopool": {Host: "ergo-eu1.nanopool.org", Port: 11111, TLSPort: 11433, Failover: []string{"ergo-eu2.nanopool.org", "ergo-us-east1.nanopool.org"}},
+		},
+		Miners: map[string]MinerQuirk{
+			"lolminer": {Algorithm: "AUTOLYKOS2", TLSArgs: []string{"--tls", "on"}, StripScheme: true},
+			"gminer":   {TLSArgs: []string{"--ssl", "1"}, StripScheme: true},
+		},
+	},
+	{
+		Coin: "KAS", Algorithm: "kheavyhash",
+		Pools: map[string]PoolPreset{
+			"herominers": {Host: "kaspa.herominers.com", Port: 1206},
+			"woolypooly": {Host: "pool.woolypooly.com", Port: 3112},
+		},
+		Miners: map[string]MinerQuirk{
+			"lolminer":     {Algorithm: "KASPA", TLSArgs: []string{"--tls", "on"}, StripScheme: true},
+			"teamredminer": {Algorithm: "kas"},
+			"gminer":       {TLSArgs: []string{"--ssl", "1"}, StripScheme: true},
+		},
+	},
+	{
+		Coin: "CLORE", Algorithm: "kawpow",
+		Pools: map[string]PoolPreset{
+			"2miners": {Host: "clore.2miners.com", Port: 2020, TLSPort: 12020},
+		},
+	},
+	{
+		Coin: "FLUX", Algorithm: "zelhash",
+		Pools: map[string]PoolPreset{
+			"2miners": {Host: "flux.2miners.com", Port: 9090, TLSPort: 19090},
+		},
+		Miners: map[string]MinerQuirk{
+			"lolminer": {Algorithm: "FLUX", TLSArgs: []string{"--tls", "on"}, StripScheme: true},
+		},
+	},
+}
+
+// CoinPresets returns the built-in presets merged with the synced ones
+func (e *Executor) CoinPresets() ([]CoinPreset, error) {
+	merged := map[string]CoinPreset{}
+	for _, preset := range builtinCoinPresets {
+		merged[preset.Coin] = preset
+	}
+
+	synced, err := e.syncedCoinPresets()
+	if err != nil {
+		return nil, err
+	}
+	for _, preset := range synced {
+		merged[preset.Coin] = preset
+	}
+
+	list := make([]CoinPreset, 0, len(merged))
+	for _, preset := range merged {
+		list = append(list, preset)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Coin < list[j].Coin })
+	return list, nil
+}
+
+// SyncCoinPresets stores presets pushed by the server. With replace set
+// the synced store is replaced, otherwise presets are added or updated by
+// coin. Built-in presets stay available for coins not synced.
+func (e *Executor) SyncCoinPresets(presets []CoinPreset, replace bool) (int, error) {
+	stored := map[string]CoinPreset{}
+	if !replace {
+		existing, err := e.syncedCoinPresets()
+		if err != nil {
+			return 0, err
+		}
+		for _, preset := range existing {
+			stored[preset.Coin] = preset
+		}
+	}
+	for _, preset := range presets {
+		preset.Coin = strings.ToUpper(preset.Coin)
+		if preset.Coin == "" || preset.Algorithm == "" {
+			return 0, fmt.Errorf("coin preset needs coin and algorithm")
+		}
+		for key, pool := range preset.Pools {
+			if pool.Host == "" || pool.Port <= 0 {
+				return 0, fmt.Errorf("pool %s for %s needs host and port", key, preset.Coin)
+			}
+		}
+		stored[preset.Coin] = preset
+	}
+
+	list := make([]CoinPreset, 0, len(stored))
+	for _, preset := range stored {
+		list = append(list, preset)
+	}
+
+	if err := os.MkdirAll(e.configPath, 0755); err != nil {
+		return 0, err
+	}
+	data, err := json.Marshal(list)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.WriteFile(filepath.Join(e.configPath, "coin_presets.json"), data, 0644); err != nil {
+		return 0, fmt.Errorf("failed to save coin presets: %w", err)
+	}
+	return len(list), nil
+}
+
+func (e *Executor) syncedCoinPresets() ([]CoinPreset, error) {
+	data, err := os.ReadFile(filepath.Join(e.configPath, "coin_presets.json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var presets []CoinPreset
+	if err := json.Unmarshal(data, &presets); err != nil {
+		return nil, fmt.Errorf("invalid coin preset store: %w", err)
+	}
+	return presets, nil
+}
+
+// coinPreset finds the preset for a coin
+func (e *Executor) coinPreset(coin string) (*CoinPreset, error) {
+	presets, err := e.CoinPresets()
+	if err != nil {
+		return nil, err
+	}
+	for i := range presets {
+		if strings.EqualFold(presets[i].Coin, coin) {
+			return &presets[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no preset for coin %q", coin)
+}
+
+// ResolveCoinPreset fills the coin, algorithm, pool and failover pools of
+// a config from a "COIN @ pool" reference in config.Preset. Explicitly set
+// fields are kept.
+func (e *Executor) ResolveCoinPreset(config *MinerConfig) error {
+	coin, poolKey, ok := strings.Cut(config.Preset, "@")
+	coin, poolKey = strings.TrimSpace(coin), strings.ToLower(strings.TrimSpace(poolKey))
+	if !ok || coin == "" || poolKey == "" {
+		return fmt.Errorf("invalid preset %q (use \"COIN @ pool\")", config.Preset)
+	}
+
+	preset, err := e.coinPreset(coin)
+	if err != nil {
+		return err
+	}
+	pool, ok := preset.Pools[poolKey]
+	if !ok {
+		keys := make([]string, 0, len(preset.Pools))
+		for key := range preset.Pools {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		return fmt.Errorf("no %s pool %q (known: %s)", preset.Coin, poolKey, strings.Join(keys, ", "))
+	}
+
+	scheme, port := "stratum+tcp", pool.Port
+	if config.PoolTLS {
+		if pool.TLSPort == 0 {
+			return fmt.Errorf("%s pool %s has no TLS endpoint", preset.Coin, poolKey)
+		}
+		scheme, port = "stratum+ssl", pool.TLSPort
+	}
+	endpoint := func(host string) string {
+		return scheme + "://" + net.JoinHostPort(host, strconv.Itoa(port))
+	}
+
+	if config.Coin == "" {
+		config.Coin = preset.Coin
+	}
+	if config.Algorithm == "" {
+		config.Algorithm = preset.Algorithm
+	}
+	if config.Pool == "" {
+		config.Pool = endpoint(pool.Host)
+	}
+	if len(config.FailoverPools) == 0 {
+		for _, host := range pool.Failover {
+			config.FailoverPools = append(config.FailoverPools, endpoint(host))
+		}
+	}
+	return nil
+}
+
+// withMinerQuirks returns a copy of config adjusted for the miner's quirks
+// with the config's coin
+func (e *Executor) withMinerQuirks(config *MinerConfig) *MinerConfig {
+	coin := config.Coin
+	if coin == "" {
+		coin = algorithmCoins[strings.ToLower(config.Algorithm)]
+	}
+	if coin == "" {
+		return config
+	}
+	preset, err := e.coinPreset(coin)
+	if err != nil {
+		return config
+	}
+	quirk, ok := preset.Miners[strings.ToLower(config.Name)]
+	if !ok {
+		return config
+	}
+
+	adjusted := *config
+	if quirk.Algorithm != "" && strings.EqualFold(config.Algorithm, preset.Algorithm) {
+		adjusted.Algorithm = quirk.Algorithm
+	}
+	adjusted.ExtraArgs = append(append([]string(nil), quirk.ExtraArgs...), config.ExtraArgs...)
+
+	scheme, hostPort, found := strings.Cut(config.Pool, "://")
+	tlsPool := found && (strings.Contains(scheme, "ssl") || strings.Contains(scheme, "tls"))
+	if tlsPool {
+		adjusted.ExtraArgs = append(adjusted.ExtraArgs, quirk.TLSArgs...)
+	}
+	if quirk.StripScheme && found {
+		adjusted.Pool = hostPort
+	}
+	return &adjusted
+}
@@ -0,0 +1,77 @@
+package executor
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// configFileFlags is the flag each miner takes its config file with
+var configFileFlags = map[string]string{
+	"t-rex":    "-c",
+	"gminer":   "--config",
+	"xmrig":    "--config",
+	"srbminer": "--config-file",
+	"bzminer":  "-c",
+}
+
+// configFileAPIArgs bind the miner API to the allocated port; flags override
+// the config file. BzMiner has no such flag, its config uses %API_PORT%.
+var configFileAPIArgs = map[string]func(api MinerAPI) []string{
+	"t-rex": func(api MinerAPI) []string {
+		return []string{"--api-bind-http", net.JoinHostPort(api.bindHost(), strconv.Itoa(api.Port))}
+	},
+	"gminer": func(api MinerAPI) []string { return []string{"--api", strconv.Itoa(api.Port)} },
+	"xmrig": func(api MinerAPI) []string {
+		return []string{"--http-host", api.bindHost(), "--http-port", strconv.Itoa(api.Port)}
+	},
+	"srbminer": func(api MinerAPI) []string { return []string{"--api-enable", "--api-port", strconv.Itoa(api.Port)} },
+}
+
+// renderConfigFile fills the HiveOS-style placeholders of a miner config
+// file template
+func renderConfigFile(config *MinerConfig, apiPort int) string {
+	return strings.NewReplacer(
+		"%WAL%", config.Wallet,
+		"%URL%", config.Pool,
+		"%WORKER_NAME%", config.Worker,
+		"%ALGO%", config.Algorithm,
+		"%COIN%", config.Coin,
+		"%API_PORT%", strconv.Itoa(apiPort),
+	).Replace(config.ConfigFile)
+}
+
+// configFileArgs writes the rendered config file and returns the miner
+// arguments using it. Pool, wallet and algorithm come from the file only.
+func (e *Executor) configFileArgs(config *MinerConfig, api MinerAPI) ([]string, error) {
+	apiPort := api.Port
+	name := canonicalMinerName(config.Name)
+	flag, ok := configFileFlags[name]
+	if !ok {
+		return nil, fmt.Errorf("%s does not support config files", config.Name)
+	}
+
+	// xmrig and BzMiner read JSON; T-Rex, GMiner and SRBMiner accept it too
+	ext := ".json"
+	if !strings.HasPrefix(strings.TrimSpace(config.ConfigFile), "{") {
+		ext = ".conf"
+	}
+	dir := filepath.Join(e.configPath, "miner-configs")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	// One file per instance; the API port tells instances apart
+	path := filepath.Join(dir, fmt.Sprintf("%s-%d%s", name, apiPort, ext))
+	if err := os.WriteFile(path, []byte(renderConfigFile(config, apiPort)), 0600); err != nil {
+		return nil, fmt.Errorf("failed to write miner config file: %w", err)
+	}
+
+	args := []string{flag, path}
+	if apiArgs, ok := configFileAPIArgs[name]; ok {
+		args = append(args, apiArgs(api)...)
+	}
+	return append(args, api.authArgs()...), nil
+}
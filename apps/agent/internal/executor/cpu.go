@@ -0,0 +1,58 @@
+package executor
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// cpuMiners are the miners that take thread and affinity options
+var cpuMiners = []string{"xmrig", "cpuminer-opt", "srbminer"}
+
+// cpuArgs returns the thread count and CPU affinity arguments of a CPU
+// miner, using its flag names
+func cpuArgs(config *MinerConfig, threadsFlag, affinityFlag string) ([]string, error) {
+	var args []string
+	if config.CPUThreads < 0 || config.CPUThreads > runtime.NumCPU() {
+		return nil, fmt.Errorf("cpuThreads must be between 0 and %d", runtime.NumCPU())
+	}
+	if config.CPUThreads > 0 {
+		args = append(args, threadsFlag, strconv.Itoa(config.CPUThreads))
+	}
+	if config.CPUAffinity != "" {
+		mask, err := cpuAffinityMask(config.CPUAffinity)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, affinityFlag, mask)
+	}
+	return args, nil
+}
+
+// cpuAffinityMask converts a core list like "0-3,6" into the hex mask the
+// miners take ("0x4f")
+func cpuAffinityMask(cores string) (string, error) {
+	var mask uint64
+	for _, part := range strings.Split(cores, ",") {
+		part = strings.TrimSpace(part)
+		first, last, isRange := strings.Cut(part, "-")
+		from, err := strconv.Atoi(first)
+		if err != nil {
+			return "", fmt.Errorf("invalid cpuAffinity %q", cores)
+		}
+		to := from
+		if isRange {
+			if to, err = strconv.Atoi(last); err != nil || to < from {
+				return "", fmt.Errorf("invalid cpuAffinity %q", cores)
+			}
+		}
+		if from < 0 || to >= runtime.NumCPU() || to >= 64 {
+			return "", fmt.Errorf("cpuAffinity %q names a core this rig doesn't have", cores)
+		}
+		for core := from; core <= to; core++ {
+			mask |= 1 << uint(core)
+		}
+	}
+	return fmt.Sprintf("0x%x", mask), nil
+}
@@ -0,0 +1,193 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DisabledGPU is a card excluded from mining until re-enabled, e.g. a dying
+// one, kept across reboots. Unlike a parked card its power settings are
+// left alone: it may be gone from the bus.
+type DisabledGPU struct {
+	BusID  string `json:"busId"`
+	Reason string `json:"reason,omitempty"`
+	Since  int64  `json:"since"` // Unix seconds
+}
+
+func (e *Executor) disabledPath() string {
+	return filepath.Join(e.configPath, "disabled_gpus.json")
+}
+
+// loadDisabledGPUs reads the list on first use. Called with disabledMu held.
+func (e *Executor) loadDisabledGPUs() {
+	if e.disabled != nil {
+		return
+	}
+	e.disabled = make(map[string]*DisabledGPU)
+	data, err := os.ReadFile(e.disabledPath())
+	if err != nil {
+		return
+	}
+	var list []DisabledGPU
+	if err := json.Unmarshal(data, &list); err != nil {
+		fmt.Printf("Ignoring invalid disabled GPU list: %v\n", err)
+		return
+	}
+	for i := range list {
+		e.disabled[list[i].BusID] = &list[i]
+	}
+}
+
+// saveDisabledGPUs writes the list. Called with disabledMu held.
+func (e *Executor) saveDisabledGPUs() error {
+	if err := os.MkdirAll(e.configPath, 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(e.disabledListLocked())
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(e.disabledPath(), data, 0644); err != nil {
+		return fmt.Errorf("failed to save disabled GPUs: %w", err)
+	}
+	return nil
+}
+
+// DisableGPUs excludes the GPUs at busIDs from miner device lists, OC and
+// the GPU watchdogs until EnableGPUs. Cards that already fell off the bus
+// can be disabled too. A running miner is restarted without them.
+func (e *Executor) DisableGPUs(busIDs []string, reason string) ([]DisabledGPU, error) {
+	if len(busIDs) == 0 {
+		return nil, fmt.Errorf("bus IDs required")
+	}
+
+	e.disabledMu.Lock()
+	e.loadDisabledGPUs()
+	added := 0
+	for _, busID := range busIDs {
+		busID = sysfsBusID(busID)
+		if strings.Count(busID, ":") != 2 {
+			e.disabledMu.Unlock()
+			return nil, fmt.Errorf("invalid bus ID %q", busID)
+		}
+		if card, ok := e.disabled[busID]; ok {
+			card.Reason = reason
+			continue
+		}
+		e.disabled[busID] = &DisabledGPU{BusID: busID, Reason: reason, Since: time.Now().Unix()}
+		fmt.Printf("Disabled GPU %s\n", busID)
+		added++
+	}
+	err := e.saveDisabledGPUs()
+	list := e.disabledListLocked()
+	e.disabledMu.Unlock()
+	if err != nil {
+		return list, err
+	}
+
+	if added > 0 {
+		if err := e.RestartRunningMiner(); err != nil {
+			return list, fmt.Errorf("restart miner: %w", err)
+		}
+	}
+	return list, nil
+}
+
+// EnableGPUs returns disabled GPUs to mining; no bus IDs enables all
+func (e *Executor) EnableGPUs(busIDs []string) ([]DisabledGPU, error) {
+	e.disabledMu.Lock()
+	e.loadDisabledGPUs()
+	var enable []string
+	if len(busIDs) == 0 {
+		for busID := range e.disabled {
+			enable = append(enable, busID)
+		}
+	}
+	for _, busID := range busIDs {
+		busID = sysfsBusID(busID)
+		if _, ok := e.disabled[busID]; !ok {
+			e.disabledMu.Unlock()
+			return nil, fmt.Errorf("GPU %s is not disabled", busID)
+		}
+		enable = append(enable, busID)
+	}
+	for _, busID := range enable {
+		delete(e.disabled, busID)
+		fmt.Printf("Enabled GPU %s\n", busID)
+	}
+	var err error
+	if len(enable) > 0 {
+		err = e.saveDisabledGPUs()
+	}
+	list := e.disabledListLocked()
+	e.disabledMu.Unlock()
+	if err != nil {
+		return list, err
+	}
+
+	if len(enable) > 0 {
+		if err := e.RestartRunningMiner(); err != nil {
+			return list, fmt.Errorf("restart miner: %w", err)
+		}
+	}
+	return list, nil
+}
+
+// DisabledGPUs lists the disabled GPUs
+func (e *Executor) DisabledGPUs() []DisabledGPU {
+	e.disabledMu.Lock()
+	defer e.disabledMu.Unlock()
+	e.loadDisabledGPUs()
+	return e.disabledListLocked()
+}
+
+// GPUDisabled reports whether the GPU at busID, in any of the forms
+// drivers and miners report, is disabled
+func (e *Executor) GPUDisabled(busID string) bool {
+	e.disabledMu.Lock()
+	defer e.disabledMu.Unlock()
+	e.loadDisabledGPUs()
+	_, ok := e.disabled[sysfsBusID(busID)]
+	return ok
+}
+
+func (e *Executor) disabledListLocked() []DisabledGPU {
+	list := make([]DisabledGPU, 0, len(e.disabled))
+	for _, card := range e.disabled {
+		list = append(list, *card)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].BusID < list[j].BusID })
+	return list
+}
+
+// disabledNvidiaIndexes returns the number of NVIDIA cards and the indexes
+// of the disabled ones; nvidia-smi and nvidia-settings number cards in PCI
+// bus order
+func (e *Executor) disabledNvidiaIndexes() (int, map[int]bool) {
+	disabled := map[int]bool{}
+	count := 0
+	for _, device := range e.listGPUDevices() {
+		if device.vendor != "nvidia" {
+			continue
+		}
+		if e.GPUDisabled(device.busID) {
+			disabled[count] = true
+		}
+		count++
+	}
+	return count, disabled
+}
+
+// amdCardDisabled reports whether DRM card idx is a disabled GPU
+func (e *Executor) amdCardDisabled(idx int) bool {
+	link, err := os.Readlink(fmt.Sprintf("/sys/class/drm/card%d/device", idx))
+	if err != nil {
+		return false
+	}
+	return e.GPUDisabled(filepath.Base(link))
+}
@@ -0,0 +1,111 @@
+package executor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Miner environment modes (see SetMinerEnv)
+const (
+	MinerEnvClean   = "clean"   // Only allowlisted variables reach the miner
+	MinerEnvInherit = "inherit" // The miner gets the agent's whole environment
+)
+
+// minerEnvAllow are the agent's variables a miner gets in clean mode. A
+// trailing * matches a prefix. LD_LIBRARY_PATH and LD_PRELOAD are left
+// out on purpose: a host CUDA or OpenCL install on the library path is
+// the usual cause of a miner crashing on a library mismatch.
+var minerEnvAllow = []string{
+	"PATH", "HOME", "USER", "LOGNAME", "SHELL", "TERM", "TMPDIR",
+	"LANG", "LC_*", "TZ",
+	"DISPLAY", "XAUTHORITY",
+	"CUDA_*", "GPU_*", "HSA_*", "ROC_*", "ROCR_*",
+}
+
+// minerLibDirs are directories next to a miner binary that hold its
+// bundled libraries
+var minerLibDirs = []string{"lib", "libs"}
+
+// SetMinerEnv sets which of the agent's environment variables miners
+// inherit: in clean mode only the default allowlist plus extra (names,
+// or prefixes like "MY_*"), in inherit mode all of them
+func (e *Executor) SetMinerEnv(mode string, extra []string) {
+	e.envInherit = mode == MinerEnvInherit
+	e.envAllow = extra
+}
+
+// minerEnv builds a miner's environment: the agent's variables the mode
+// lets through, LD_LIBRARY_PATH pointing at the libraries bundled with
+// the miner, then the config's own variables, which win over both
+func (e *Executor) minerEnv(config *MinerConfig, minerDir string) []string {
+	var env []string
+	var hostLibs string
+	for _, kv := range os.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		if !e.envInherit && !e.envAllowed(name) {
+			continue
+		}
+		if name == "LD_LIBRARY_PATH" {
+			hostLibs = value
+			continue
+		}
+		env = append(env, kv)
+	}
+
+	libs := minerLibPath(config, minerDir)
+	if hostLibs != "" {
+		libs = append(libs, hostLibs)
+	}
+	if len(libs) > 0 {
+		env = append(env, "LD_LIBRARY_PATH="+strings.Join(libs, ":"))
+	}
+
+	// Later duplicates override earlier ones in exec.Cmd
+	for k, v := range config.Env {
+		env = append(env, k+"="+v)
+	}
+	return env
+}
+
+// envAllowed reports whether a variable passes the clean mode allowlist
+func (e *Executor) envAllowed(name string) bool {
+	for _, lists := range [][]string{minerEnvAllow, e.envAllow} {
+		for _, allowed := range lists {
+			if prefix, ok := strings.CutSuffix(allowed, "*"); ok {
+				if strings.HasPrefix(name, prefix) {
+					return true
+				}
+			} else if name == allowed {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// minerLibPath lists the library directories of a miner: the config's
+// LibraryPath (relative to the miner's directory), bundled lib
+// directories, and the miner's directory itself when it ships .so files
+func minerLibPath(config *MinerConfig, minerDir string) []string {
+	var dirs []string
+	for _, dir := range config.LibraryPath {
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(minerDir, dir)
+		}
+		dirs = append(dirs, dir)
+	}
+	if minerDir == "" {
+		return dirs
+	}
+	for _, sub := range minerLibDirs {
+		dir := filepath.Join(minerDir, sub)
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			dirs = append(dirs, dir)
+		}
+	}
+	if libs, _ := filepath.Glob(filepath.Join(minerDir, "*.so*")); len(libs) > 0 {
+		dirs = append(dirs, minerDir)
+	}
+	return dirs
+}
@@ -3,24 +3,61 @@ package executor
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
+
+	"github.com/bloxos/agent/internal/installer"
+	"github.com/bloxos/agent/internal/platform"
+	"github.com/bloxos/agent/internal/secrets"
+	"github.com/bloxos/agent/internal/stratum"
 )
 
 // MinerConfig holds configuration for starting a miner
 type MinerConfig struct {
-	Name       string            `json:"name"`       // t-rex, lolminer, etc.
-	Algorithm  string            `json:"algorithm"`  // ethash, kawpow, etc.
-	Pool       string            `json:"pool"`       // stratum+tcp://pool:port
-	Wallet     string            `json:"wallet"`     // wallet address
-	Worker     string            `json:"worker"`     // worker name
-	ExtraArgs  []string          `json:"extraArgs"`  // additional arguments
-	Env        map[string]string `json:"env"`        // environment variables
+	Name          string            `json:"name"`          // t-rex, lolminer, etc.
+	Algorithm     string            `json:"algorithm"`     // ethash, kawpow, etc.
+	Coin          string            `json:"coin"`          // ETC, RVN, etc. (for wallet validation)
+	Pool          string            `json:"pool"`          // stratum+tcp://pool:port
+	FailoverPools []string          `json:"failoverPools"` // backup pools (stratum proxy only)
+	Wallet        string            `json:"wallet"`        // wallet address
+	Worker        string            `json:"worker"`        // worker name
+	ExtraArgs     []string          `json:"extraArgs"`     // additional arguments
+	Env           map[string]string `json:"env"`           // environment variables
+	GPUVendor     string            `json:"gpuVendor"`     // "nvidia" or "amd" to use only that vendor's GPUs, "cpu" for SRBMiner CPU-only
+	Preset        string            `json:"preset"`        // Coin preset reference, e.g. "KAS @ herominers"
+	PoolTLS       bool              `json:"poolTls"`       // Use the preset pool's TLS endpoint
+	StratumMode   string            `json:"stratumMode"`   // stratum, ethproxy, ethstratum1 (NiceHash) or ethstratum2; empty = from the pool scheme
+	NiceHash      bool              `json:"nicehash"`      // Mine to NiceHash: pool from the algorithm, NiceHash wallet and login rules
+	Hooks         *MinerHooks       `json:"hooks"`         // Site scripts run before start and after stop
+	ConfigFile    string            `json:"configFile"`    // Miner config file template (%WAL%, %URL%, ...) used instead of pool flags
+	Output        *OutputPatterns   `json:"output"`        // Stats parsed from the output, for miners without an API
+
+	// 4GB card tuning (lolMiner, TeamRedMiner)
+	ZombieMode     bool   `json:"zombieMode"`     // keep mining once the DAG outgrows VRAM
+	ZombieTune     string `json:"zombieTune"`     // lolMiner --zombie-tune: "auto" or per-GPU values
+	FourGAllocSize int    `json:"fourGAllocSize"` // MB of VRAM to allocate on 4GB cards
+
+	// LHR unlock (T-Rex, GMiner, NBMiner); values use the miner's own notation
+	LHRTune     string `json:"lhrTune"`     // per-GPU unlock values, comma-separated
+	LHRAutotune string `json:"lhrAutotune"` // T-Rex autotune mode: off, down, full
+	LHRLowPower bool   `json:"lhrLowPower"` // T-Rex low-power LHR mode
+	LHRMode     int    `json:"lhrMode"`     // NBMiner LHR mode (1 or 2)
+	LHRAlgo     string `json:"lhrAlgo"`     // T-Rex secondary algo filling LHR gaps (dual LHR)
+
+	// CPU mining (XMRig, cpuminer-opt, SRBMiner)
+	CPUThreads  int    `json:"cpuThreads"`  // mining threads, 0 = miner default
+	CPUAffinity string `json:"cpuAffinity"` // cores to pin threads to, e.g. "0-3,6"
+
+	// Extra LD_LIBRARY_PATH directories, e.g. a bundled CUDA runtime;
+	// relative paths are inside the miner's directory
+	LibraryPath []string `json:"libraryPath"`
 }
 
 // OCConfig holds overclocking configuration
@@ -32,79 +69,399 @@ type OCConfig struct {
 	CoreLock    *int `json:"coreLock"`    // Lock core MHz
 	MemLock     *int `json:"memLock"`     // Lock mem MHz
 	FanSpeed    *int `json:"fanSpeed"`    // Percent (0 = auto)
+
+	// Advanced AMD tuning (Polaris/Vega); ignored unless AllowUnsafe is set
+	DPMStates   []DPMState `json:"dpmStates"`   // Per P-state clock/voltage
+	MemTweak    string     `json:"memTweak"`    // amdmemtweak timings, e.g. "--REF 30 --RTP 6"
+	AllowUnsafe bool       `json:"allowUnsafe"` // Explicit opt-in for timing/voltage changes
 }
 
 // Executor handles command execution on the rig
 type Executor struct {
+	// Running miners. minerMu serializes starts and stops, which may come
+	// from commands and timers at once; procMu guards the fields below for
+	// quick reads such as GetMinerStatus while a start is under way.
+	minerMu     sync.Mutex
+	procMu      sync.Mutex
 	minerPID    int
 	minerName   string
 	minerCmd    *exec.Cmd
+	minerPort   int
+	safeMode    bool // Starts and OC changes refused (see safemode.go)
 	minersPath  string
 	configPath  string
 	debug       bool
+	proxy       *stratum.Proxy
+	envInherit  bool     // Miners get the agent's whole environment
+	envAllow    []string // Extra variables miners get in clean mode
+	minerLogDir string   // Where miners write their output (see SetMinerLogDir)
+	apiAuth     bool     // Miner APIs get a key (see SetMinerAPIAccess)
+	apiBind     string   // Address of the protected miner APIs
+	run         platform.Runner
+	fs          platform.FS
+
+	nvidiaStatus *NvidiaSetupStatus
+
+	// Miners running alongside the primary one (see StartMiners)
+	extraMiners []minerInstance
+
+	// The configs last started, also while they can't be saved (see
+	// saveConfigs)
+	configsMu    sync.Mutex
+	savedConfigs []*MinerConfig
+
+	// vBIOS flashes awaiting confirmation, by nonce
+	vbiosMu      sync.Mutex
+	vbiosPending map[string]*pendingFlash
+
+	// Idle power saving, restored when a miner starts
+	powerSaveMu sync.Mutex
+	powerSave   *powerSaveState
+
+	// GPUs taken out of mining at minimum power, by sysfs bus ID
+	parkMu sync.Mutex
+	parked map[string]*ParkedGPU
+
+	// GPUs disabled until re-enabled, by sysfs bus ID (see disabled.go)
+	disabledMu sync.Mutex
+	disabled   map[string]*DisabledGPU
+
+	// API ports of the running miners (see MinerAPIs)
+	apiMu        sync.Mutex
+	apiPorts     []MinerAPI
+	outputMiners []OutputMiner // Miners parsed from their output (see output.go)
+
+	// X server for nvidia-settings (see xserver.go)
+	xMu         sync.Mutex
+	xCmd        *exec.Cmd // Headless server started by the agent
+	xDone       chan struct{}
+	xDisplay    string
+	xManualFans map[int]bool // GPUs whose fan speed needs X to keep running
+
+	// GPUs throttled by the memory temperature controller, by bus ID
+	thermalMu sync.Mutex
+	thermal   map[string]*thermalState
+
+	// Expected hashrates per GPU model (see benchmarks.go)
+	benchmarks benchmarkStore
+
+	// Delays between power-hungry steps (see stagger.go)
+	staggerMu     sync.Mutex
+	stagger       Stagger
+	stageProgress func(StageProgress)
+}
+
+// minerInstance is an additional miner process, e.g. for the other GPU vendor
+type minerInstance struct {
+	name   string
+	vendor string
+	pid    int
+	port   int
 }
 
 // New creates a new executor
 func New(debug bool) *Executor {
+	return NewWithPlatform(debug, platform.Host, platform.Host)
+}
+
+// NewWithPlatform creates an executor that runs GPU tools and writes sysfs
+// through the given backends, e.g. a platform.Fake in tests
+func NewWithPlatform(debug bool, run platform.Runner, fs platform.FS) *Executor {
 	home, _ := os.UserHomeDir()
 	return &Executor{
 		minersPath: filepath.Join(home, "miners"),
 		configPath: filepath.Join(home, ".bloxos"),
 		debug:      debug,
+		run:        run,
+		fs:         fs,
 	}
 }
 
+// SetStratumProxy routes miners through the embedded stratum proxy
+func (e *Executor) SetStratumProxy(proxy *stratum.Proxy) {
+	e.proxy = proxy
+}
+
 // StartMiner starts a miner with the given configuration
 func (e *Executor) StartMiner(config *MinerConfig) error {
+	return e.StartMiners([]*MinerConfig{config})
+}
+
+// StartMiners starts several miners side by side, e.g. one for the NVIDIA
+// and one for the AMD cards. The first config is the primary miner.
+func (e *Executor) StartMiners(configs []*MinerConfig) error {
+	e.minerMu.Lock()
+	defer e.minerMu.Unlock()
+	return e.startMiners(configs)
+}
+
+// startMiners is StartMiners for callers holding minerMu
+func (e *Executor) startMiners(configs []*MinerConfig) error {
+	if len(configs) == 0 {
+		return fmt.Errorf("miner config required")
+	}
+	if err := e.checkSafeMode(); err != nil {
+		return err
+	}
+
+	for _, config := range configs {
+		if config.Output != nil {
+			if err := config.Output.validate(); err != nil {
+				return err
+			}
+		}
+
+		// Expand "COIN @ pool" references from the coin preset library
+		if config.Preset != "" {
+			if err := e.ResolveCoinPreset(config); err != nil {
+				return err
+			}
+		}
+
+		// Refuse to mine to a malformed address. A config file or the
+		// arguments of a miner read from its output may carry their own
+		// wallet instead.
+		if config.NiceHash {
+			if err := ResolveNiceHash(config); err != nil {
+				return err
+			}
+		} else if (config.ConfigFile == "" && config.Output == nil) || config.Wallet != "" {
+			if err := ValidateWallet(config.Coin, config.Wallet); err != nil {
+				return err
+			}
+		}
+
+		// Check GPUs and driver versions before the miner fails opaquely
+		if err := installer.CheckCompatibility(config.Name); err != nil {
+			return err
+		}
+	}
+
+	// Bring GPUs back from idle power saving
+	if err := e.ExitPowerSave(); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+
 	// Stop any running miner first
-	if e.minerPID > 0 {
-		if err := e.StopMiner(); err != nil {
+	if e.minerPID > 0 || len(e.extraMiners) > 0 {
+		if err := e.stopMiner(); err != nil {
 			return fmt.Errorf("failed to stop existing miner: %w", err)
 		}
 	}
 
-	// Build the command based on miner type
-	cmd, err := e.buildMinerCommand(config)
-	if err != nil {
-		return fmt.Errorf("failed to build miner command: %w", err)
+	// Site-specific preparation, e.g. the CPU governor
+	runHooks("preStart", configs)
+
+	// A failed start stops the miners that did start and runs the postStop
+	// hooks balancing the preStart ones
+	abort := func() {
+		if e.minerPID > 0 {
+			e.stopMinerConfigs(configs)
+		} else {
+			runHooks("postStop", configs)
+		}
 	}
 
-	// Set environment variables
-	cmd.Env = os.Environ()
-	for k, v := range config.Env {
-		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
+	// Point the miners at the local proxy, which connects to the real pools.
+	// It serves the primary's pools; miners on other pools connect directly.
+	proxyURL := ""
+	if e.proxy != nil {
+		pools := append([]string{configs[0].Pool}, configs[0].FailoverPools...)
+		if err := e.proxy.Start(pools); err != nil {
+			abort()
+			return err
+		}
+		proxyURL = e.proxy.LocalURL()
 	}
 
-	// Start the miner
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("failed to start miner: %w", err)
+	exes := map[int]string{}
+	taken := map[int]bool{}
+	logNames := map[string]bool{}
+	var apis []MinerAPI
+	var outputMiners []OutputMiner
+	for i, config := range configs {
+		launch := config
+		if proxyURL != "" && !samePools(config, configs[0]) {
+			fmt.Printf("%s mines to other pools than the primary miner, bypassing the stratum proxy\n", config.Name)
+		} else if proxyURL != "" {
+			proxied := *config
+			proxied.Pool = proxyURL
+			launch = &proxied
+		}
+
+		// Build the command based on miner type
+		port, err := allocateAPIPort(config.Name, taken)
+		var api MinerAPI
+		if err == nil {
+			api, err = e.newMinerAPI(config.Name, port)
+		}
+		if err != nil {
+			abort()
+			return err
+		}
+		cmd, err := e.buildMinerCommand(launch, api)
+		if err != nil {
+			abort()
+			return fmt.Errorf("failed to build miner command: %w", err)
+		}
+
+		// Environment: allowlisted host variables, bundled libraries and
+		// the config's own variables (see env.go)
+		cmd.Env = e.minerEnv(config, cmd.Dir)
+
+		// Own process group, so the miner can outlive the agent
+		cmd.SysProcAttr = minerProcAttr()
+
+		logFile := e.openMinerLog(config, logNames)
+		var logOffset int64
+		if logFile != nil {
+			if info, err := logFile.Stat(); err == nil {
+				logOffset = info.Size()
+			}
+			cmd.Stdout = logFile
+			cmd.Stderr = logFile
+			// The miner has its own descriptor once started
+			defer logFile.Close()
+		}
+
+		// Start the miner, spaced from the previous instance (see stagger.go)
+		e.staggerStep("miner_start", i, len(configs), config.Name, e.staggerDelays().Miners)
+		if err := cmd.Start(); err != nil {
+			abort()
+			return fmt.Errorf("failed to start miner: %w", err)
+		}
+
+		e.procMu.Lock()
+		if i == 0 {
+			e.minerPID = cmd.Process.Pid
+			e.minerName = config.Name
+			e.minerCmd = cmd
+			e.minerPort = port
+		} else {
+			e.extraMiners = append(e.extraMiners, minerInstance{
+				name:   config.Name,
+				vendor: config.GPUVendor,
+				pid:    cmd.Process.Pid,
+				port:   port,
+			})
+		}
+		e.procMu.Unlock()
+		api.PID = cmd.Process.Pid
+		apis = append(apis, api)
+		e.setMinerAPIs(apis)
+		if config.Output != nil && logFile != nil {
+			outputMiners = append(outputMiners, OutputMiner{
+				Name:      config.Name,
+				Algorithm: config.Algorithm,
+				Pool:      config.Pool,
+				PID:       cmd.Process.Pid,
+				Log:       logFile.Name(),
+				Offset:    logOffset,
+				Started:   time.Now(),
+				Patterns:  *config.Output,
+			})
+			e.setOutputMiners(outputMiners)
+		}
+
+		if exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", cmd.Process.Pid)); err == nil {
+			exes[cmd.Process.Pid] = exe
+		}
+
+		fmt.Printf("Started %s miner (PID: %d, API port: %d)\n", config.Name, cmd.Process.Pid, port)
 	}
 
-	e.minerPID = cmd.Process.Pid
-	e.minerName = config.Name
-	e.minerCmd = cmd
+	// Record the processes for adoption after an agent restart
+	if err := e.saveRunningState(exes); err != nil && e.debug {
+		fmt.Printf("Warning: failed to save miner state: %v\n", err)
+	}
 
 	// Save config for restart
-	if err := e.saveConfig(config); err != nil {
+	if err := e.saveConfigs(configs); err != nil {
 		// Non-fatal, just log
 		if e.debug {
 			fmt.Printf("Warning: failed to save config: %v\n", err)
 		}
 	}
 
-	fmt.Printf("Started %s miner (PID: %d)\n", config.Name, e.minerPID)
+	// Any start ends a pause
+	os.Remove(e.pausePath())
+
 	return nil
 }
 
-// StopMiner stops the currently running miner
+// samePools reports whether two configs mine to the same pools, in order
+func samePools(a, b *MinerConfig) bool {
+	if a.Pool != b.Pool || len(a.FailoverPools) != len(b.FailoverPools) {
+		return false
+	}
+	for i := range a.FailoverPools {
+		if a.FailoverPools[i] != b.FailoverPools[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// StopMiner stops the currently running miner and any additional instances
 func (e *Executor) StopMiner() error {
+	e.minerMu.Lock()
+	defer e.minerMu.Unlock()
+	return e.stopMiner()
+}
+
+// stopMiner is StopMiner for callers holding minerMu
+func (e *Executor) stopMiner() error {
+	// The saved configs are the ones running
+	configs, _ := e.loadConfigs()
+	return e.stopMinerConfigs(configs)
+}
+
+// stopMinerConfigs stops the miners and runs the postStop hooks of the
+// flight sheet they were started with
+func (e *Executor) stopMinerConfigs(configs []*MinerConfig) error {
+	// The proxy only serves the running miner
+	if e.proxy != nil {
+		defer e.proxy.Stop()
+	}
+
+	for _, instance := range e.extraMiners {
+		if err := e.stopProcess(instance.pid); err != nil && e.debug {
+			fmt.Printf("Failed to stop %s (PID: %d): %v\n", instance.name, instance.pid, err)
+		}
+	}
+	e.procMu.Lock()
+	e.extraMiners = nil
+	e.procMu.Unlock()
+	e.setMinerAPIs(nil)
+	e.setOutputMiners(nil)
+	os.Remove(e.statePath())
+
 	if e.minerPID == 0 {
-		// Try to find and kill any known miner processes
-		return e.killMinerProcesses()
+		// Try to find and kill any known miner processes, e.g. ones not
+		// adopted after an agent restart
+		err := e.killMinerProcesses()
+		runHooks("postStop", configs)
+		return err
+	}
+
+	if err := e.stopProcess(e.minerPID); err != nil {
+		return err
 	}
 
-	// Send SIGTERM first
-	process, err := os.FindProcess(e.minerPID)
+	e.procMu.Lock()
+	e.minerPID = 0
+	e.minerName = ""
+	e.minerCmd = nil
+	e.procMu.Unlock()
+
+	fmt.Println("Miner stopped")
+	runHooks("postStop", configs)
+	return nil
+}
+
+// stopProcess sends SIGTERM and escalates to SIGKILL after 5 seconds
+func (e *Executor) stopProcess(pid int) error {
+	process, err := os.FindProcess(pid)
 	if err != nil {
 		return fmt.Errorf("failed to find process: %w", err)
 	}
@@ -120,7 +477,13 @@ func (e *Executor) StopMiner() error {
 	done := make(chan error, 1)
 	go func() {
 		_, err := process.Wait()
-		done <- err
+		if err != nil {
+			// Not our child (adopted after an agent restart): poll instead
+			for processAlive(pid) {
+				time.Sleep(200 * time.Millisecond)
+			}
+		}
+		done <- nil
 	}()
 
 	select {
@@ -132,22 +495,35 @@ func (e *Executor) StopMiner() error {
 		<-done
 	}
 
-	e.minerPID = 0
-	e.minerName = ""
-	e.minerCmd = nil
-
-	fmt.Println("Miner stopped")
 	return nil
 }
 
-// RestartMiner restarts the miner with the saved configuration
+// RestartMiner restarts the miner(s) with the saved configuration
 func (e *Executor) RestartMiner() error {
-	config, err := e.loadConfig()
+	e.minerMu.Lock()
+	defer e.minerMu.Unlock()
+	return e.restartMiner()
+}
+
+// RestartRunningMiner restarts the miners only if the agent started them,
+// e.g. after the GPUs they may use changed
+func (e *Executor) RestartRunningMiner() error {
+	e.minerMu.Lock()
+	defer e.minerMu.Unlock()
+	if e.minerPID == 0 {
+		return nil
+	}
+	return e.restartMiner()
+}
+
+// restartMiner is RestartMiner for callers holding minerMu
+func (e *Executor) restartMiner() error {
+	configs, err := e.loadConfigs()
 	if err != nil {
 		return fmt.Errorf("no saved config to restart: %w", err)
 	}
 
-	if err := e.StopMiner(); err != nil {
+	if err := e.stopMiner(); err != nil {
 		// Continue anyway
 		if e.debug {
 			fmt.Printf("Warning during stop: %v\n", err)
@@ -156,29 +532,33 @@ func (e *Executor) RestartMiner() error {
 
 	time.Sleep(2 * time.Second) // Brief pause before restart
 
-	return e.StartMiner(config)
+	return e.startMiners(configs)
 }
 
 // ApplyOC applies overclocking settings (NVIDIA or AMD)
 func (e *Executor) ApplyOC(config *OCConfig) error {
+	if err := e.checkSafeMode(); err != nil {
+		return err
+	}
+
 	// Try NVIDIA first, then AMD
 	hasNvidia := false
 	hasAMD := false
 
-	if _, err := exec.LookPath("nvidia-smi"); err == nil {
+	if _, err := e.run.LookPath("nvidia-smi"); err == nil {
 		hasNvidia = true
 	}
-	if _, err := exec.LookPath("rocm-smi"); err == nil {
+	if _, err := e.run.LookPath("rocm-smi"); err == nil {
 		hasAMD = true
 	}
 
 	// Check sysfs for AMD GPUs
 	if !hasAMD {
-		if entries, err := os.ReadDir("/sys/class/drm"); err == nil {
+		if entries, err := e.fs.ReadDir("/sys/class/drm"); err == nil {
 			for _, entry := range entries {
 				if strings.HasPrefix(entry.Name(), "card") && !strings.Contains(entry.Name(), "-") {
 					vendorPath := fmt.Sprintf("/sys/class/drm/%s/device/vendor", entry.Name())
-					if data, err := os.ReadFile(vendorPath); err == nil {
+					if data, err := e.fs.ReadFile(vendorPath); err == nil {
 						if strings.TrimSpace(string(data)) == "0x1002" {
 							hasAMD = true
 							break
@@ -216,6 +596,37 @@ func (e *Executor) ApplyOC(config *OCConfig) error {
 
 // applyNvidiaOC applies overclocking for NVIDIA GPUs
 func (e *Executor) applyNvidiaOC(config *OCConfig) error {
+	// Disabled cards keep their settings. With them, or when staggered,
+	// the cards are set one at a time.
+	delay := e.staggerDelays().OC
+	if count, disabled := e.disabledNvidiaIndexes(); len(disabled) > 0 || (delay > 0 && count > 1) {
+		if config.GPUIndex >= 0 {
+			if disabled[config.GPUIndex] {
+				return fmt.Errorf("GPU %d is disabled", config.GPUIndex)
+			}
+		} else {
+			var cards []int
+			for i := 0; i < count; i++ {
+				if !disabled[i] {
+					cards = append(cards, i)
+				}
+			}
+			var errors []string
+			for step, i := range cards {
+				e.staggerStep("oc", step, len(cards), fmt.Sprintf("nvidia gpu%d", i), delay)
+				card := *config
+				card.GPUIndex = i
+				if err := e.applyNvidiaOC(&card); err != nil {
+					errors = append(errors, fmt.Sprintf("gpu%d: %v", i, err))
+				}
+			}
+			if len(errors) > 0 {
+				return fmt.Errorf("%s", strings.Join(errors, "; "))
+			}
+			return nil
+		}
+	}
+
 	gpuArg := fmt.Sprintf("%d", config.GPUIndex)
 	if config.GPUIndex < 0 {
 		gpuArg = "" // Apply to all GPUs
@@ -256,17 +667,10 @@ func (e *Executor) applyNvidiaOC(config *OCConfig) error {
 		}
 	}
 
-	// Core/mem offsets require nvidia-settings which needs X server
-	if config.CoreOffset != nil || config.MemOffset != nil {
-		if e.debug {
-			fmt.Println("Core/mem offsets require nvidia-settings (X server)")
-		}
-	}
-
-	// Fan speed requires nvidia-settings
-	if config.FanSpeed != nil && *config.FanSpeed > 0 {
-		if e.debug {
-			fmt.Println("Fan speed control requires nvidia-settings")
+	// Core/mem offsets and fan speed require nvidia-settings, which needs an X server
+	if config.CoreOffset != nil || config.MemOffset != nil || config.FanSpeed != nil {
+		if err := e.applyNvidiaSettingsOC(config); err != nil {
+			errors = append(errors, err.Error())
 		}
 	}
 
@@ -284,34 +688,32 @@ func (e *Executor) applyAMDOC(config *OCConfig) error {
 	// Determine GPU indices
 	gpuIndices := []int{}
 	if config.GPUIndex < 0 {
-		// Find all AMD GPUs
-		entries, _ := os.ReadDir("/sys/class/drm")
-		for _, entry := range entries {
-			if strings.HasPrefix(entry.Name(), "card") && !strings.Contains(entry.Name(), "-") {
-				vendorPath := fmt.Sprintf("/sys/class/drm/%s/device/vendor", entry.Name())
-				if data, err := os.ReadFile(vendorPath); err == nil {
-					if strings.TrimSpace(string(data)) == "0x1002" {
-						idx, _ := strconv.Atoi(strings.TrimPrefix(entry.Name(), "card"))
-						gpuIndices = append(gpuIndices, idx)
-					}
-				}
+		// Disabled cards keep their settings
+		for _, idx := range e.amdCards() {
+			if !e.amdCardDisabled(idx) {
+				gpuIndices = append(gpuIndices, idx)
 			}
 		}
 	} else {
+		if e.amdCardDisabled(config.GPUIndex) {
+			return fmt.Errorf("gpu%d is disabled", config.GPUIndex)
+		}
 		gpuIndices = []int{config.GPUIndex}
 	}
 
-	for _, idx := range gpuIndices {
+	delay := e.staggerDelays().OC
+	for step, idx := range gpuIndices {
+		e.staggerStep("oc", step, len(gpuIndices), fmt.Sprintf("amd gpu%d", idx), delay)
 		cardPath := fmt.Sprintf("/sys/class/drm/card%d/device", idx)
 
 		// Apply power limit via pp_power_profile_mode or power_cap
 		if config.PowerLimit != nil {
 			hwmonPath := fmt.Sprintf("%s/hwmon", cardPath)
-			if entries, err := os.ReadDir(hwmonPath); err == nil && len(entries) > 0 {
+			if entries, err := e.fs.ReadDir(hwmonPath); err == nil && len(entries) > 0 {
 				powerCapPath := fmt.Sprintf("%s/%s/power1_cap", hwmonPath, entries[0].Name())
 				// Convert watts to microwatts
 				power := *config.PowerLimit * 1000000
-				if err := os.WriteFile(powerCapPath, []byte(fmt.Sprintf("%d", power)), 0644); err != nil {
+				if err := e.fs.WriteFile(powerCapPath, []byte(fmt.Sprintf("%d", power)), 0644); err != nil {
 					errors = append(errors, fmt.Sprintf("gpu%d power: %v", idx, err))
 				} else if e.debug {
 					fmt.Printf("Set GPU%d power limit to %dW\n", idx, *config.PowerLimit)
@@ -324,13 +726,13 @@ func (e *Executor) applyAMDOC(config *OCConfig) error {
 			odPath := fmt.Sprintf("%s/pp_od_clk_voltage", cardPath)
 			// Write "s 1 <freq>" to set max core clock
 			cmd := fmt.Sprintf("s 1 %d", *config.CoreLock)
-			if err := os.WriteFile(odPath, []byte(cmd), 0644); err != nil {
+			if err := e.fs.WriteFile(odPath, []byte(cmd), 0644); err != nil {
 				if e.debug {
 					fmt.Printf("GPU%d core lock failed: %v\n", idx, err)
 				}
 			} else {
 				// Commit changes
-				os.WriteFile(odPath, []byte("c"), 0644)
+				e.fs.WriteFile(odPath, []byte("c"), 0644)
 				if e.debug {
 					fmt.Printf("Set GPU%d core clock to %dMHz\n", idx, *config.CoreLock)
 				}
@@ -342,33 +744,40 @@ func (e *Executor) applyAMDOC(config *OCConfig) error {
 			odPath := fmt.Sprintf("%s/pp_od_clk_voltage", cardPath)
 			// Write "m 1 <freq>" to set max mem clock
 			cmd := fmt.Sprintf("m 1 %d", *config.MemLock)
-			if err := os.WriteFile(odPath, []byte(cmd), 0644); err != nil {
+			if err := e.fs.WriteFile(odPath, []byte(cmd), 0644); err != nil {
 				if e.debug {
 					fmt.Printf("GPU%d mem lock failed: %v\n", idx, err)
 				}
 			} else {
-				os.WriteFile(odPath, []byte("c"), 0644)
+				e.fs.WriteFile(odPath, []byte("c"), 0644)
 				if e.debug {
 					fmt.Printf("Set GPU%d memory clock to %dMHz\n", idx, *config.MemLock)
 				}
 			}
 		}
 
+		// Apply per-P-state and memory timing tuning
+		if len(config.DPMStates) > 0 || config.MemTweak != "" {
+			if err := e.applyAMDAdvanced(idx, config); err != nil {
+				errors = append(errors, fmt.Sprintf("gpu%d advanced: %v", idx, err))
+			}
+		}
+
 		// Apply fan speed
 		if config.FanSpeed != nil {
 			hwmonPath := fmt.Sprintf("%s/hwmon", cardPath)
-			if entries, err := os.ReadDir(hwmonPath); err == nil && len(entries) > 0 {
+			if entries, err := e.fs.ReadDir(hwmonPath); err == nil && len(entries) > 0 {
 				hwmon := fmt.Sprintf("%s/%s", hwmonPath, entries[0].Name())
 
 				if *config.FanSpeed == 0 {
 					// Auto fan control
-					os.WriteFile(fmt.Sprintf("%s/pwm1_enable", hwmon), []byte("2"), 0644)
+					e.fs.WriteFile(fmt.Sprintf("%s/pwm1_enable", hwmon), []byte("2"), 0644)
 				} else {
 					// Manual fan control
-					os.WriteFile(fmt.Sprintf("%s/pwm1_enable", hwmon), []byte("1"), 0644)
+					e.fs.WriteFile(fmt.Sprintf("%s/pwm1_enable", hwmon), []byte("1"), 0644)
 					// Convert percentage to PWM (0-255)
 					pwm := (*config.FanSpeed * 255) / 100
-					if err := os.WriteFile(fmt.Sprintf("%s/pwm1", hwmon), []byte(fmt.Sprintf("%d", pwm)), 0644); err != nil {
+					if err := e.fs.WriteFile(fmt.Sprintf("%s/pwm1", hwmon), []byte(fmt.Sprintf("%d", pwm)), 0644); err != nil {
 						errors = append(errors, fmt.Sprintf("gpu%d fan: %v", idx, err))
 					} else if e.debug {
 						fmt.Printf("Set GPU%d fan to %d%%\n", idx, *config.FanSpeed)
@@ -390,14 +799,14 @@ func (e *Executor) applyAMDOC(config *OCConfig) error {
 // Reboot reboots the system
 func (e *Executor) Reboot() error {
 	fmt.Println("Rebooting system...")
-	cmd := exec.Command("sudo", "reboot")
+	cmd := e.run.Command("sudo", "reboot")
 	return cmd.Run()
 }
 
 // Shutdown shuts down the system
 func (e *Executor) Shutdown() error {
 	fmt.Println("Shutting down system...")
-	cmd := exec.Command("sudo", "shutdown", "-h", "now")
+	cmd := e.run.Command("sudo", "shutdown", "-h", "now")
 	return cmd.Run()
 }
 
@@ -409,6 +818,8 @@ func (e *Executor) GetMinerStatus() map[string]interface{} {
 		"pid":     0,
 	}
 
+	e.procMu.Lock()
+	defer e.procMu.Unlock()
 	if e.minerPID > 0 {
 		// Check if process is still running
 		process, err := os.FindProcess(e.minerPID)
@@ -422,17 +833,65 @@ func (e *Executor) GetMinerStatus() map[string]interface{} {
 		}
 	}
 
+	if len(e.extraMiners) > 0 {
+		instances := []map[string]interface{}{{
+			"name":    e.minerName,
+			"pid":     e.minerPID,
+			"running": status["running"],
+		}}
+		for _, instance := range e.extraMiners {
+			running := false
+			if process, err := os.FindProcess(instance.pid); err == nil {
+				running = process.Signal(syscall.Signal(0)) == nil
+			}
+			instances = append(instances, map[string]interface{}{
+				"name":      instance.name,
+				"gpuVendor": instance.vendor,
+				"pid":       instance.pid,
+				"running":   running,
+			})
+		}
+		status["instances"] = instances
+	}
+
 	return status
 }
 
 // buildMinerCommand builds the command to start a miner
-func (e *Executor) buildMinerCommand(config *MinerConfig) (*exec.Cmd, error) {
+func (e *Executor) buildMinerCommand(config *MinerConfig, api MinerAPI) (*exec.Cmd, error) {
 	minerPath := e.findMiner(config.Name)
 	if minerPath == "" {
 		return nil, fmt.Errorf("miner %s not found", config.Name)
 	}
 
+	// Miners driven by a config file get it instead of the pool flags
+	if config.ConfigFile != "" {
+		config = e.withMinerQuirks(config)
+		args, err := e.configFileArgs(config, api)
+		if err != nil {
+			return nil, err
+		}
+		cmd := exec.Command(minerPath, append(args, config.ExtraArgs...)...)
+		cmd.Dir = filepath.Dir(minerPath)
+		return cmd, nil
+	}
+
+	// Stratum variants, then the miner-specific algorithm names and pool
+	// formats
+	config, err := withStratumMode(withNiceHash(config))
+	if err != nil {
+		return nil, err
+	}
+	config = e.withMinerQuirks(config)
+
+	// Cards left out of mining (see parking.go)
+	devices, err := e.minerDevices(config)
+	if err != nil {
+		return nil, err
+	}
+
 	args := []string{}
+	apiPort := api.Port
 
 	switch strings.ToLower(config.Name) {
 	case "t-rex", "trex":
@@ -442,7 +901,19 @@ func (e *Executor) buildMinerCommand(config *MinerConfig) (*exec.Cmd, error) {
 		if config.Worker != "" {
 			args = append(args, "-w", config.Worker)
 		}
-		args = append(args, "--api-bind-http", "127.0.0.1:4067")
+		if config.LHRTune != "" {
+			args = append(args, "--lhr-tune", config.LHRTune)
+		}
+		if config.LHRAutotune != "" {
+			args = append(args, "--lhr-autotune-mode", config.LHRAutotune)
+		}
+		if config.LHRLowPower {
+			args = append(args, "--lhr-low-power")
+		}
+		if config.LHRAlgo != "" {
+			args = append(args, "--lhr-algo", config.LHRAlgo)
+		}
+		args = append(args, "--api-bind-http", net.JoinHostPort(api.bindHost(), strconv.Itoa(apiPort)))
 
 	case "lolminer":
 		args = append(args, "--algo", config.Algorithm)
@@ -451,7 +922,24 @@ func (e *Executor) buildMinerCommand(config *MinerConfig) (*exec.Cmd, error) {
 		if config.Worker != "" {
 			args = append(args, "--worker", config.Worker)
 		}
-		args = append(args, "--apiport", "4068")
+		if config.FourGAllocSize > 0 {
+			args = append(args, "--4g-alloc-size", strconv.Itoa(config.FourGAllocSize))
+		}
+		if config.ZombieTune != "" {
+			args = append(args, "--zombie-tune", config.ZombieTune)
+		} else if config.ZombieMode {
+			args = append(args, "--zombie-tune", "auto")
+		}
+		// A device list already selects the vendor's cards
+		if devices == nil {
+			switch config.GPUVendor {
+			case "nvidia":
+				args = append(args, "--devices", "NVIDIA")
+			case "amd":
+				args = append(args, "--devices", "AMD")
+			}
+		}
+		args = append(args, "--apiport", strconv.Itoa(apiPort))
 
 	case "gminer":
 		args = append(args, "--algo", config.Algorithm)
@@ -460,7 +948,16 @@ func (e *Executor) buildMinerCommand(config *MinerConfig) (*exec.Cmd, error) {
 		if config.Worker != "" {
 			args = append(args, "--worker", config.Worker)
 		}
-		args = append(args, "--api", "4069")
+		if config.LHRTune != "" {
+			args = append(args, "--lhr_tune", config.LHRTune)
+		}
+		switch config.GPUVendor {
+		case "nvidia":
+			args = append(args, "--opencl", "0")
+		case "amd":
+			args = append(args, "--cuda", "0")
+		}
+		args = append(args, "--api", strconv.Itoa(apiPort))
 
 	case "teamredminer", "trm":
 		args = append(args, "-a", config.Algorithm)
@@ -469,31 +966,117 @@ func (e *Executor) buildMinerCommand(config *MinerConfig) (*exec.Cmd, error) {
 		if config.Worker != "" {
 			args = append(args, "-w", config.Worker)
 		}
-		args = append(args, "--api_listen=127.0.0.1:4070")
+		if config.FourGAllocSize > 0 {
+			args = append(args, fmt.Sprintf("--eth_4g_max_alloc=%d", config.FourGAllocSize))
+		} else if config.ZombieMode {
+			// Leave room for the driver on 4GB cards
+			args = append(args, "--eth_4g_max_alloc=4076")
+		}
+		args = append(args, fmt.Sprintf("--api_listen=127.0.0.1:%d", apiPort))
 
 	case "xmrig":
 		args = append(args, "-o", config.Pool)
 		args = append(args, "-u", config.Wallet)
 		args = append(args, "-a", config.Algorithm)
-		args = append(args, "--http-host", "127.0.0.1")
-		args = append(args, "--http-port", "4071")
+		args = append(args, "--http-host", api.bindHost())
+		args = append(args, "--http-port", strconv.Itoa(apiPort))
+		cpu, err := cpuArgs(config, "--threads", "--cpu-affinity")
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, cpu...)
+
+	case "cpuminer-opt", "cpuminer":
+		args = append(args, "-a", config.Algorithm)
+		args = append(args, "-o", config.Pool)
+		args = append(args, "-u", config.Wallet)
+		cpu, err := cpuArgs(config, "--threads", "--cpu-affinity")
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, cpu...)
+		// ccminer-style API, read-only unless --api-remote is given
+		args = append(args, "-b", fmt.Sprintf("127.0.0.1:%d", apiPort))
 
 	case "nbminer":
 		args = append(args, "-a", config.Algorithm)
 		args = append(args, "-o", config.Pool)
 		args = append(args, "-u", config.Wallet)
-		args = append(args, "--api", "127.0.0.1:4072")
+		if config.LHRTune != "" {
+			args = append(args, "--lhr", config.LHRTune)
+		}
+		if config.LHRMode > 0 {
+			args = append(args, "--lhr-mode", strconv.Itoa(config.LHRMode))
+		}
+		switch config.GPUVendor {
+		case "nvidia":
+			args = append(args, "--platform", "1")
+		case "amd":
+			args = append(args, "--platform", "2")
+		}
+		args = append(args, "--api", fmt.Sprintf("127.0.0.1:%d", apiPort))
 
 	case "srbminer", "srbminer-multi":
 		args = append(args, "--algorithm", config.Algorithm)
 		args = append(args, "--pool", config.Pool)
 		args = append(args, "--wallet", config.Wallet)
-		args = append(args, "--api-enable", "--api-port", "4073")
+		switch config.GPUVendor {
+		case "nvidia":
+			args = append(args, "--disable-gpu-amd")
+		case "amd":
+			args = append(args, "--disable-gpu-nvidia")
+		case "cpu":
+			args = append(args, "--disable-gpu")
+		}
+		cpu, err := cpuArgs(config, "--cpu-threads", "--cpu-affinity")
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, cpu...)
+		args = append(args, "--api-enable", "--api-port", strconv.Itoa(apiPort))
+
+	case "phoenixminer", "phoenix":
+		// Ethash forks are picked with -coin (see the coin presets)
+		args = append(args, "-pool", config.Pool)
+		args = append(args, "-wal", config.Wallet)
+		if config.Worker != "" {
+			args = append(args, "-worker", config.Worker)
+		}
+		switch config.GPUVendor {
+		case "nvidia":
+			args = append(args, "-nvidia")
+		case "amd":
+			args = append(args, "-amd")
+		}
+		// Read-only remote management (CDM protocol) for stats
+		args = append(args, "-cdm", "1", "-cdmport", strconv.Itoa(apiPort))
+
+	case "claymore":
+		args = append(args, "-epool", config.Pool)
+		args = append(args, "-ewal", config.Wallet)
+		if config.Worker != "" {
+			args = append(args, "-eworker", config.Worker)
+		}
+		switch config.GPUVendor {
+		case "nvidia":
+			args = append(args, "-platform", "2")
+		case "amd":
+			args = append(args, "-platform", "1")
+		}
+		// A negative port makes remote management read-only
+		args = append(args, "-mport", fmt.Sprintf("-%d", apiPort))
 
 	default:
-		return nil, fmt.Errorf("unsupported miner: %s", config.Name)
+		// Unknown miners run on their extra arguments alone when their
+		// stats can be read from the output
+		if config.Output == nil {
+			return nil, fmt.Errorf("unsupported miner: %s", config.Name)
+		}
 	}
 
+	args = append(args, deviceArgs(config.Name, devices)...)
+	args = append(args, api.authArgs()...)
+
 	// Add extra arguments
 	args = append(args, config.ExtraArgs...)
 
@@ -519,6 +1102,11 @@ func (e *Executor) findMiner(name string) string {
 		"nbminer":        {"nbminer"},
 		"srbminer":       {"SRBMiner-MULTI", "srbminer-multi"},
 		"srbminer-multi": {"SRBMiner-MULTI", "srbminer-multi"},
+		"phoenixminer":   {"PhoenixMiner", "phoenixminer"},
+		"phoenix":        {"PhoenixMiner", "phoenixminer"},
+		"claymore":       {"ethdcrminer64"},
+		"cpuminer-opt":   {"cpuminer"},
+		"cpuminer":       {"cpuminer"},
 	}
 
 	candidates := exeNames[name]
@@ -555,10 +1143,10 @@ func (e *Executor) findMiner(name string) string {
 
 // killMinerProcesses kills any known miner processes
 func (e *Executor) killMinerProcesses() error {
-	miners := []string{"t-rex", "lolMiner", "gminer", "teamredminer", "xmrig", "nbminer", "SRBMiner-MULTI"}
+	miners := []string{"t-rex", "lolMiner", "gminer", "teamredminer", "xmrig", "nbminer", "SRBMiner-MULTI", "PhoenixMiner", "ethdcrminer64", "cpuminer"}
 	
 	for _, miner := range miners {
-		exec.Command("pkill", "-9", miner).Run()
+		e.run.Command("pkill", "-9", miner).Run()
 	}
 
 	return nil
@@ -575,12 +1163,86 @@ func (e *Executor) saveConfig(config *MinerConfig) error {
 		return err
 	}
 
-	return os.WriteFile(filepath.Join(e.configPath, "miner.json"), data, 0644)
+	// Wallets and pool credentials are encrypted at rest
+	return secrets.WriteFile(filepath.Join(e.configPath, "miner.json"), data)
+}
+
+// saveConfigs saves the primary config to miner.json and, when several
+// miners run side by side, all of them to miners.json. They are kept in
+// memory too, so restarts use them while the disk is failing.
+func (e *Executor) saveConfigs(configs []*MinerConfig) error {
+	e.configsMu.Lock()
+	e.savedConfigs = configs
+	e.configsMu.Unlock()
+
+	if err := e.saveConfig(configs[0]); err != nil {
+		return err
+	}
+
+	path := filepath.Join(e.configPath, "miners.json")
+	if len(configs) == 1 {
+		os.Remove(path)
+		return nil
+	}
+
+	data, err := json.Marshal(configs)
+	if err != nil {
+		return err
+	}
+
+	return secrets.WriteFile(path, data)
+}
+
+// EncryptConfigs encrypts miner configs saved in plaintext by older agents
+func (e *Executor) EncryptConfigs() error {
+	for _, name := range []string{"miner.json", "miners.json"} {
+		if err := secrets.EncryptFile(filepath.Join(e.configPath, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadConfigs loads the saved miner configs for restart
+func (e *Executor) loadConfigs() ([]*MinerConfig, error) {
+	e.configsMu.Lock()
+	saved := e.savedConfigs
+	e.configsMu.Unlock()
+	if saved != nil {
+		return saved, nil
+	}
+
+	if data, err := secrets.ReadFile(filepath.Join(e.configPath, "miners.json")); err == nil {
+		var configs []*MinerConfig
+		if err := json.Unmarshal(data, &configs); err == nil && len(configs) > 0 {
+			return configs, nil
+		}
+	}
+
+	config, err := e.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	return []*MinerConfig{config}, nil
+}
+
+// GetConfig returns the last miner config that was started
+func (e *Executor) GetConfig() (*MinerConfig, error) {
+	configs, err := e.loadConfigs()
+	if err != nil {
+		return nil, err
+	}
+	return configs[0], nil
+}
+
+// GetConfigs returns the configs of all miners last started together
+func (e *Executor) GetConfigs() ([]*MinerConfig, error) {
+	return e.loadConfigs()
 }
 
 // loadConfig loads the saved miner config
 func (e *Executor) loadConfig() (*MinerConfig, error) {
-	data, err := os.ReadFile(filepath.Join(e.configPath, "miner.json"))
+	data, err := secrets.ReadFile(filepath.Join(e.configPath, "miner.json"))
 	if err != nil {
 		return nil, err
 	}
@@ -595,7 +1257,7 @@ func (e *Executor) loadConfig() (*MinerConfig, error) {
 
 // runNvidiaSmi runs nvidia-smi with the given arguments
 func (e *Executor) runNvidiaSmi(args ...string) error {
-	cmd := exec.Command("nvidia-smi", args...)
+	cmd := e.run.Command("nvidia-smi", args...)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("%v: %s", err, string(output))
@@ -0,0 +1,391 @@
+package executor
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FanSetting sets the fans of one GPU, or of every GPU with GPUIndex -1.
+// GPU indexes are the ones ApplyOC uses: nvidia-settings order for NVIDIA,
+// the DRM card number for AMD.
+type FanSetting struct {
+	GPUIndex int    `json:"gpuIndex"`
+	Vendor   string `json:"vendor,omitempty"` // "nvidia" or "amd"; empty = every vendor present
+	Speed    *int   `json:"speed,omitempty"`  // Percent for every fan of the card, 0 = auto
+	Fans     []int  `json:"fans,omitempty"`   // Percent per fan, for cards with several fan headers
+}
+
+// FanResult is the outcome for one GPU
+type FanResult struct {
+	GPUIndex  int    `json:"gpuIndex"`
+	Vendor    string `json:"vendor"`
+	Auto      bool   `json:"auto,omitempty"`      // Handed back to the driver's fan curve
+	Commanded []int  `json:"commanded,omitempty"` // Percent per fan
+	RPMs      []int  `json:"rpms,omitempty"`      // Measured per fan once settled
+	Error     string `json:"error,omitempty"`
+
+	fans []string // NVIDIA fan numbers or AMD fanN_input paths to read RPMs from
+}
+
+// fanSettleTime is how long fans get to reach the new speed before the
+// achieved RPMs are read
+const fanSettleTime = 5 * time.Second
+
+var nvSettingsFanRPM = regexp.MustCompile(`\[fan:(\d+)\]\):\s*(\d+)`)
+
+// SetFans sets GPU fan speeds without touching clocks or power limits,
+// and reports the RPMs the fans reached
+func (e *Executor) SetFans(settings []FanSetting) ([]FanResult, error) {
+	if len(settings) == 0 {
+		return nil, fmt.Errorf("no fan settings given")
+	}
+	for _, s := range settings {
+		if err := s.validate(); err != nil {
+			return nil, fmt.Errorf("gpu %d: %w", s.GPUIndex, err)
+		}
+	}
+
+	_, err := e.run.LookPath("nvidia-smi")
+	hasNvidia := err == nil
+	amdCards := e.amdCards()
+	for _, s := range settings {
+		if s.Vendor == "nvidia" && !hasNvidia {
+			return nil, fmt.Errorf("no NVIDIA GPUs found")
+		}
+		if s.Vendor == "amd" && len(amdCards) == 0 {
+			return nil, fmt.Errorf("no AMD GPUs found")
+		}
+	}
+	if !hasNvidia && len(amdCards) == 0 {
+		return nil, fmt.Errorf("no supported GPU tools found (nvidia-smi or rocm-smi)")
+	}
+
+	var results []FanResult
+	display := ""
+	if hasNvidia {
+		var nvidia []FanResult
+		nvidia, display = e.setNvidiaFans(settings)
+		results = append(results, nvidia...)
+	}
+	results = append(results, e.setAMDFans(settings, amdCards)...)
+
+	applied := 0
+	for _, result := range results {
+		if result.Error == "" {
+			applied++
+		}
+	}
+	if applied > 0 {
+		time.Sleep(fanSettleTime)
+		e.readFanRPMs(results, display)
+	}
+	if display != "" {
+		e.releaseX()
+	}
+
+	if applied == 0 {
+		return results, fmt.Errorf("failed to set fans on all %d GPU(s)", len(results))
+	}
+	return results, nil
+}
+
+// validate checks a setting's speeds
+func (s *FanSetting) validate() error {
+	switch s.Vendor {
+	case "", "nvidia", "amd":
+	default:
+		return fmt.Errorf("unknown vendor %q", s.Vendor)
+	}
+	if s.Speed == nil && len(s.Fans) == 0 {
+		return fmt.Errorf("speed or fans required")
+	}
+	if s.Speed != nil && len(s.Fans) > 0 {
+		return fmt.Errorf("set speed or fans, not both")
+	}
+	if s.Speed != nil && (*s.Speed < 0 || *s.Speed > 100) {
+		return fmt.Errorf("speed must be 0-100")
+	}
+	for _, speed := range s.Fans {
+		if speed < 1 || speed > 100 {
+			return fmt.Errorf("fan speeds must be 1-100 (use speed 0 for auto)")
+		}
+	}
+	return nil
+}
+
+// speeds returns the percent for each of a card's fans, nil for auto
+func (s *FanSetting) speeds(fanCount int) ([]int, error) {
+	if s.Speed != nil && *s.Speed == 0 {
+		return nil, nil
+	}
+	if fanCount == 0 {
+		return nil, fmt.Errorf("no controllable fans")
+	}
+	if s.Speed != nil {
+		speeds := make([]int, fanCount)
+		for i := range speeds {
+			speeds[i] = *s.Speed
+		}
+		return speeds, nil
+	}
+	if len(s.Fans) != fanCount {
+		return nil, fmt.Errorf("card has %d fan(s), got %d speed(s)", fanCount, len(s.Fans))
+	}
+	return s.Fans, nil
+}
+
+// setNvidiaFans applies the NVIDIA settings through nvidia-settings. It
+// returns the display the RPMs can be read on, "" when there is none.
+func (e *Executor) setNvidiaFans(settings []FanSetting) ([]FanResult, string) {
+	var mine []FanSetting
+	manual := false
+	for _, s := range settings {
+		if s.Vendor == "" || s.Vendor == "nvidia" {
+			mine = append(mine, s)
+			manual = manual || s.Speed == nil || *s.Speed > 0
+		}
+	}
+	if len(mine) == 0 {
+		return nil, ""
+	}
+	failAll := func(err error) []FanResult {
+		var results []FanResult
+		for _, s := range mine {
+			results = append(results, FanResult{GPUIndex: s.GPUIndex, Vendor: "nvidia", Error: err.Error()})
+		}
+		return results
+	}
+
+	// Fans are automatic unless an X server holds them, no need to start one
+	e.xMu.Lock()
+	running := e.xDisplay != ""
+	e.xMu.Unlock()
+	if !manual && !running {
+		var results []FanResult
+		for _, s := range mine {
+			results = append(results, FanResult{GPUIndex: s.GPUIndex, Vendor: "nvidia", Auto: true})
+		}
+		return results, ""
+	}
+
+	display, err := e.ensureX()
+	if err != nil {
+		return failAll(err), ""
+	}
+	gpuCount := e.nvidiaSettingsCount(display, "gpus", nvSettingsGPU)
+	if gpuCount == 0 {
+		e.releaseX()
+		return failAll(fmt.Errorf("nvidia-settings found no GPUs on %s", display)), ""
+	}
+	// Same per-GPU fan numbering as applyNvidiaSettingsOC
+	fansPerGPU := e.nvidiaSettingsCount(display, "fans", nvSettingsFan) / gpuCount
+
+	var results []FanResult
+	var args []string
+	for _, s := range mine {
+		gpus := []int{s.GPUIndex}
+		if s.GPUIndex < 0 {
+			gpus = nil
+			for i := 0; i < gpuCount; i++ {
+				gpus = append(gpus, i)
+			}
+		}
+		for _, gpu := range gpus {
+			result := FanResult{GPUIndex: gpu, Vendor: "nvidia"}
+			speeds, err := s.speeds(fansPerGPU)
+			if gpu >= gpuCount {
+				err = fmt.Errorf("no NVIDIA GPU %d", gpu)
+			}
+			if err != nil {
+				result.Error = err.Error()
+				results = append(results, result)
+				continue
+			}
+
+			for fan := gpu * fansPerGPU; fan < (gpu+1)*fansPerGPU; fan++ {
+				result.fans = append(result.fans, strconv.Itoa(fan))
+			}
+			if speeds == nil {
+				result.Auto = true
+				args = append(args, "-a", fmt.Sprintf("[gpu:%d]/GPUFanControlState=0", gpu))
+			} else {
+				result.Commanded = speeds
+				args = append(args, "-a", fmt.Sprintf("[gpu:%d]/GPUFanControlState=1", gpu))
+				for i, speed := range speeds {
+					args = append(args, "-a", fmt.Sprintf("[fan:%d]/GPUTargetFanSpeed=%d", gpu*fansPerGPU+i, speed))
+				}
+			}
+			results = append(results, result)
+		}
+	}
+	if len(args) == 0 {
+		return results, display
+	}
+
+	output, err := e.run.Command("nvidia-settings", append([]string{"-c", display}, args...)...).CombinedOutput()
+	if e.debug {
+		fmt.Printf("nvidia-settings %v: %s\n", args, string(output))
+	}
+	// Failed assignments are reported in the output, not the exit status
+	if err == nil && strings.Contains(string(output), "ERROR") {
+		err = fmt.Errorf("assignment failed")
+	}
+	if err != nil {
+		err = fmt.Errorf("nvidia-settings: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	// Manual fan control reverts to auto when the X server exits
+	e.xMu.Lock()
+	if e.xManualFans == nil {
+		e.xManualFans = map[int]bool{}
+	}
+	for i := range results {
+		switch {
+		case results[i].Error != "":
+		case err != nil:
+			results[i].Error = err.Error()
+		case results[i].Auto:
+			delete(e.xManualFans, results[i].GPUIndex)
+		default:
+			e.xManualFans[results[i].GPUIndex] = true
+		}
+	}
+	e.xMu.Unlock()
+
+	return results, display
+}
+
+// setAMDFans applies the AMD settings through the hwmon pwm attributes
+func (e *Executor) setAMDFans(settings []FanSetting, cards []int) []FanResult {
+	if len(cards) == 0 {
+		return nil
+	}
+
+	var results []FanResult
+	for _, s := range settings {
+		if s.Vendor != "" && s.Vendor != "amd" {
+			continue
+		}
+		indices := cards
+		if s.GPUIndex >= 0 {
+			indices = []int{s.GPUIndex}
+		}
+		for _, idx := range indices {
+			result := FanResult{GPUIndex: idx, Vendor: "amd"}
+			if err := e.setAMDCardFans(idx, &s, &result); err != nil {
+				result.Error = err.Error()
+			}
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// setAMDCardFans sets the fans of one AMD card. Cards with several fan
+// headers have pwm1, pwm2, ...
+func (e *Executor) setAMDCardFans(idx int, s *FanSetting, result *FanResult) error {
+	hwmon := e.amdHwmon(idx)
+	if hwmon == "" {
+		return fmt.Errorf("no AMD GPU %d", idx)
+	}
+	fanCount := 0
+	for {
+		if _, err := e.fs.Stat(filepath.Join(hwmon, fmt.Sprintf("pwm%d", fanCount+1))); err != nil {
+			break
+		}
+		fanCount++
+	}
+
+	speeds, err := s.speeds(fanCount)
+	if err != nil {
+		return err
+	}
+	for fan := 1; fan <= fanCount; fan++ {
+		enable := filepath.Join(hwmon, fmt.Sprintf("pwm%d_enable", fan))
+		if speeds == nil {
+			if err := e.fs.WriteFile(enable, []byte("2"), 0644); err != nil {
+				return fmt.Errorf("fan %d: %v", fan, err)
+			}
+		} else {
+			e.fs.WriteFile(enable, []byte("1"), 0644)
+			// Convert percentage to PWM (0-255)
+			pwm := speeds[fan-1] * 255 / 100
+			if err := e.fs.WriteFile(filepath.Join(hwmon, fmt.Sprintf("pwm%d", fan)), []byte(strconv.Itoa(pwm)), 0644); err != nil {
+				return fmt.Errorf("fan %d: %v", fan, err)
+			}
+		}
+		result.fans = append(result.fans, filepath.Join(hwmon, fmt.Sprintf("fan%d_input", fan)))
+	}
+	if e.debug {
+		fmt.Printf("Set GPU%d fans to %v (nil = auto)\n", idx, speeds)
+	}
+	result.Auto = speeds == nil
+	result.Commanded = speeds
+	return nil
+}
+
+// readFanRPMs fills in the measured RPMs of the applied results
+func (e *Executor) readFanRPMs(results []FanResult, display string) {
+	nvidia := map[int]int{}
+	if display != "" {
+		if output, err := e.run.Command("nvidia-settings", "-c", display, "-q", "GPUCurrentFanSpeedRPM").Output(); err == nil {
+			for _, match := range nvSettingsFanRPM.FindAllStringSubmatch(string(output), -1) {
+				fan, _ := strconv.Atoi(match[1])
+				rpm, _ := strconv.Atoi(match[2])
+				nvidia[fan] = rpm
+			}
+		}
+	}
+
+	for i := range results {
+		if results[i].Error != "" {
+			continue
+		}
+		for _, fan := range results[i].fans {
+			if results[i].Vendor == "nvidia" {
+				n, _ := strconv.Atoi(fan)
+				if rpm, ok := nvidia[n]; ok {
+					results[i].RPMs = append(results[i].RPMs, rpm)
+				}
+				continue
+			}
+			if data, err := e.fs.ReadFile(fan); err == nil {
+				if rpm, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil {
+					results[i].RPMs = append(results[i].RPMs, rpm)
+				}
+			}
+		}
+	}
+}
+
+// amdCards returns the DRM card numbers of the AMD GPUs
+func (e *Executor) amdCards() []int {
+	var cards []int
+	entries, _ := e.fs.ReadDir("/sys/class/drm")
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), "card") && !strings.Contains(entry.Name(), "-") {
+			vendorPath := fmt.Sprintf("/sys/class/drm/%s/device/vendor", entry.Name())
+			if data, err := e.fs.ReadFile(vendorPath); err == nil {
+				if strings.TrimSpace(string(data)) == "0x1002" {
+					idx, _ := strconv.Atoi(strings.TrimPrefix(entry.Name(), "card"))
+					cards = append(cards, idx)
+				}
+			}
+		}
+	}
+	return cards
+}
+
+// amdHwmon returns the hwmon directory of an AMD card, "" if it has none
+func (e *Executor) amdHwmon(idx int) string {
+	hwmonPath := fmt.Sprintf("/sys/class/drm/card%d/device/hwmon", idx)
+	entries, err := e.fs.ReadDir(hwmonPath)
+	if err != nil || len(entries) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s", hwmonPath, entries[0].Name())
+}
@@ -0,0 +1,358 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// HiveOSExport holds HiveOS flight sheet, wallet and OC profile JSON as
+// returned by the HiveOS API
+type HiveOSExport struct {
+	FlightSheet *HiveFlightSheet `json:"flightSheet"`
+	Wallets     []HiveWallet     `json:"wallets"`
+	OC          *HiveOC          `json:"oc"`
+}
+
+// HiveFlightSheet is a HiveOS flight sheet
+type HiveFlightSheet struct {
+	Name  string                `json:"name"`
+	Items []HiveFlightSheetItem `json:"items"`
+}
+
+// HiveFlightSheetItem is one coin/miner entry of a flight sheet
+type HiveFlightSheetItem struct {
+	Coin        string `json:"coin"`
+	WalletID    int    `json:"wal_id"`
+	Miner       string `json:"miner"`
+	MinerConfig struct {
+		URL        string `json:"url"` // One pool per line, the rest are failovers
+		Algo       string `json:"algo"`
+		Template   string `json:"template"` // e.g. "%WAL%.%WORKER_NAME%"
+		Pass       string `json:"pass"`
+		UserConfig string `json:"user_config"` // Extra miner arguments
+	} `json:"miner_config"`
+}
+
+// HiveWallet is a HiveOS wallet
+type HiveWallet struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Coin string `json:"coin"`
+	Wal  string `json:"wal"`
+}
+
+// HiveOC is a HiveOS overclocking profile. Values are space-separated per
+// GPU of that vendor; the last value repeats for the remaining GPUs.
+type HiveOC struct {
+	Name   string `json:"name"`
+	Nvidia *struct {
+		CoreClock  hiveValues `json:"core_clock"` // Offset, or a lock when >= 500
+		MemClock   hiveValues `json:"mem_clock"`
+		PowerLimit hiveValues `json:"power_limit"`
+		FanSpeed   hiveValues `json:"fan_speed"`
+	} `json:"nvidia"`
+	AMD *struct {
+		CoreClock  hiveValues `json:"core_clock"`
+		MemClock   hiveValues `json:"mem_clock"`
+		CoreVddc   hiveValues `json:"core_vddc"`
+		PowerLimit hiveValues `json:"power_limit"`
+		FanSpeed   hiveValues `json:"fan_speed"`
+	} `json:"amd"`
+}
+
+// HiveOSImport is the result of converting a HiveOS export. OC GPUIndex is
+// the position among the vendor's GPUs, as in HiveOS, or -1 for all.
+type HiveOSImport struct {
+	Miners   []*MinerConfig `json:"miners"`
+	NvidiaOC []OCConfig     `json:"nvidiaOc,omitempty"`
+	AMDOC    []OCConfig     `json:"amdOc,omitempty"`
+	Warnings []string       `json:"warnings,omitempty"`
+}
+
+// hiveMinerNames maps HiveOS miner ids to executor miner names
+var hiveMinerNames = map[string]string{
+	"trex":         "t-rex",
+	"lolminer":     "lolminer",
+	"gminer":       "gminer",
+	"teamredminer": "teamredminer",
+	"nbminer":      "nbminer",
+	"xmrig":        "xmrig",
+	"xmrig-new":    "xmrig",
+	"srbminer":     "srbminer",
+	"phoenixminer": "phoenixminer",
+	"claymore":     "claymore",
+	"cpuminer-opt": "cpuminer-opt",
+}
+
+// nvidiaCoreLockMin is the HiveOS threshold above which core_clock is a lock
+const nvidiaCoreLockMin = 500
+
+// hiveValues accepts HiveOS values given as strings ("1100 1150") or numbers
+type hiveValues string
+
+func (v *hiveValues) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*v = hiveValues(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("invalid HiveOS value %s", data)
+	}
+	*v = hiveValues(n.String())
+	return nil
+}
+
+// ints parses the per-GPU values; empty means not set
+func (v hiveValues) ints() ([]int, error) {
+	var values []int
+	for _, field := range strings.Fields(string(v)) {
+		n, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q", field)
+		}
+		values = append(values, int(n))
+	}
+	return values, nil
+}
+
+// ImportHiveOS converts a HiveOS export into miner and OC configs. worker
+// replaces %WORKER_NAME% in wallet templates.
+func ImportHiveOS(export *HiveOSExport, worker string) (*HiveOSImport, error) {
+	result := &HiveOSImport{}
+
+	if export.FlightSheet != nil {
+		wallets := map[int]HiveWallet{}
+		for _, wallet := range export.Wallets {
+			wallets[wallet.ID] = wallet
+		}
+
+		seen := map[string]bool{}
+		for _, item := range export.FlightSheet.Items {
+			name, ok := hiveMinerNames[strings.ToLower(item.Miner)]
+			if !ok {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("%s: miner %q is not supported", item.Coin, item.Miner))
+				continue
+			}
+			if seen[name] {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("%s: second %s entry (dual mining) is not imported", item.Coin, name))
+				continue
+			}
+
+			wallet, ok := wallets[item.WalletID]
+			if !ok {
+				return nil, fmt.Errorf("%s: wallet %d not found in export", item.Coin, item.WalletID)
+			}
+
+			var pools []string
+			for _, line := range strings.Split(item.MinerConfig.URL, "\n") {
+				if line = strings.TrimSpace(line); line != "" {
+					pools = append(pools, line)
+				}
+			}
+			if len(pools) == 0 {
+				return nil, fmt.Errorf("%s: flight sheet item has no pool URL", item.Coin)
+			}
+
+			config := &MinerConfig{
+				Name:          name,
+				Algorithm:     item.MinerConfig.Algo,
+				Coin:          item.Coin,
+				Pool:          pools[0],
+				FailoverPools: pools[1:],
+				ExtraArgs:     strings.Fields(item.MinerConfig.UserConfig),
+			}
+			config.Wallet, config.Worker = expandHiveTemplate(item.MinerConfig.Template, wallet.Wal, worker)
+
+			if config.Algorithm == "" {
+				config.Algorithm = AlgorithmForCoin(item.Coin)
+			}
+			if config.Algorithm == "" {
+				return nil, fmt.Errorf("%s: flight sheet item has no algorithm", item.Coin)
+			}
+
+			seen[name] = true
+			result.Miners = append(result.Miners, config)
+		}
+	}
+
+	if oc := export.OC; oc != nil {
+		if oc.Nvidia != nil {
+			configs, err := hiveOCConfigs(map[string]hiveValues{
+				"core":  oc.Nvidia.CoreClock,
+				"mem":   oc.Nvidia.MemClock,
+				"power": oc.Nvidia.PowerLimit,
+				"fan":   oc.Nvidia.FanSpeed,
+			}, func(config *OCConfig, field string, value int) {
+				switch field {
+				case "core":
+					if value >= nvidiaCoreLockMin {
+						config.CoreLock = intPtr(value)
+					} else {
+						config.CoreOffset = intPtr(value)
+					}
+				case "mem":
+					config.MemOffset = intPtr(value)
+				case "power":
+					config.PowerLimit = intPtr(value)
+				case "fan":
+					config.FanSpeed = intPtr(value)
+				}
+			})
+			if err != nil {
+				return nil, fmt.Errorf("nvidia OC: %w", err)
+			}
+			result.NvidiaOC = configs
+		}
+
+		if oc.AMD != nil {
+			if oc.AMD.CoreVddc != "" {
+				result.Warnings = append(result.Warnings, "amd core_vddc is not imported (use dpmStates with allowUnsafe)")
+			}
+			configs, err := hiveOCConfigs(map[string]hiveValues{
+				"core":  oc.AMD.CoreClock,
+				"mem":   oc.AMD.MemClock,
+				"power": oc.AMD.PowerLimit,
+				"fan":   oc.AMD.FanSpeed,
+			}, func(config *OCConfig, field string, value int) {
+				switch field {
+				case "core":
+					config.CoreLock = intPtr(value)
+				case "mem":
+					config.MemLock = intPtr(value)
+				case "power":
+					config.PowerLimit = intPtr(value)
+				case "fan":
+					config.FanSpeed = intPtr(value)
+				}
+			})
+			if err != nil {
+				return nil, fmt.Errorf("amd OC: %w", err)
+			}
+			result.AMDOC = configs
+		}
+	}
+
+	return result, nil
+}
+
+// expandHiveTemplate fills a HiveOS wallet template. A trailing
+// ".%WORKER_NAME%" becomes the separate worker field.
+func expandHiveTemplate(template, wallet, worker string) (string, string) {
+	if template == "" {
+		template = "%WAL%"
+	}
+
+	workerField := ""
+	if strings.HasSuffix(template, ".%WORKER_NAME%") {
+		template = strings.TrimSuffix(template, ".%WORKER_NAME%")
+		workerField = worker
+	}
+
+	expanded := strings.NewReplacer("%WAL%", wallet, "%WORKER_NAME%", worker).Replace(template)
+	return expanded, workerField
+}
+
+// hiveOCConfigs turns per-GPU value lists into OC configs: one for all GPUs
+// when every field has a single value, otherwise one per GPU position
+func hiveOCConfigs(fields map[string]hiveValues, set func(*OCConfig, string, int)) ([]OCConfig, error) {
+	parsed := map[string][]int{}
+	count := 0
+	for field, raw := range fields {
+		values, err := raw.ints()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", field, err)
+		}
+		if len(values) > 0 {
+			parsed[field] = values
+		}
+		if len(values) > count {
+			count = len(values)
+		}
+	}
+	if count == 0 {
+		return nil, nil
+	}
+
+	if count == 1 {
+		config := OCConfig{GPUIndex: -1}
+		for field, values := range parsed {
+			set(&config, field, values[0])
+		}
+		return []OCConfig{config}, nil
+	}
+
+	configs := make([]OCConfig, count)
+	for i := range configs {
+		configs[i].GPUIndex = i
+		for field, values := range parsed {
+			value := values[len(values)-1]
+			if i < len(values) {
+				value = values[i]
+			}
+			set(&configs[i], field, value)
+		}
+	}
+	return configs, nil
+}
+
+// ApplyVendorOC applies OC configs to one vendor's GPUs only. GPUIndex is
+// the position among that vendor's GPUs, or -1 for all of them.
+func (e *Executor) ApplyVendorOC(vendor string, configs []OCConfig) error {
+	if err := e.checkSafeMode(); err != nil {
+		return err
+	}
+	var indexes []int
+	for _, gpu := range e.listGPUModels() {
+		if gpu.vendor == vendor {
+			indexes = append(indexes, gpu.index)
+		}
+	}
+	if len(indexes) == 0 {
+		return fmt.Errorf("no %s GPUs detected", vendor)
+	}
+
+	var cards []OCConfig
+	for _, config := range configs {
+		targets := indexes
+		if config.GPUIndex >= 0 {
+			if config.GPUIndex >= len(indexes) {
+				continue // Profile covers more GPUs than the rig has
+			}
+			targets = indexes[config.GPUIndex : config.GPUIndex+1]
+		}
+		for _, idx := range targets {
+			oc := config
+			oc.GPUIndex = idx
+			cards = append(cards, oc)
+		}
+	}
+
+	var errors []string
+	delay := e.staggerDelays().OC
+	for step := range cards {
+		oc := &cards[step]
+		e.staggerStep("oc", step, len(cards), fmt.Sprintf("%s gpu%d", vendor, oc.GPUIndex), delay)
+		var err error
+		if vendor == "nvidia" {
+			err = e.applyNvidiaOC(oc)
+		} else {
+			err = e.applyAMDOC(oc)
+		}
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("gpu%d: %v", oc.GPUIndex, err))
+		}
+	}
+
+	if len(errors) > 0 {
+		return fmt.Errorf("%s", strings.Join(errors, "; "))
+	}
+	return nil
+}
+
+func intPtr(v int) *int {
+	return &v
+}
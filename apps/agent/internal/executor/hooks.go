@@ -0,0 +1,134 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bloxos/agent/internal/plugins"
+)
+
+// Hook timeouts: the default, unless the flight sheet sets its own, and
+// the most a flight sheet may set, as hooks hold up starts and stops
+const (
+	defaultHookTimeout = 30 * time.Second
+	maxHookTimeout     = 5 * time.Minute
+)
+
+// MinerHooks are site-specific scripts run around a flight sheet's miners,
+// e.g. to set the CPU governor, switch case fans or notify monitoring.
+// They name executables in the hooks plugin directory, so the server can
+// only pick among scripts installed on the rig.
+type MinerHooks struct {
+	PreStart []string `json:"preStart"` // Before the miners start
+	PostStop []string `json:"postStop"` // After they stopped
+	Timeout  int      `json:"timeout"`  // Seconds per hook, 0 = 30, at most 300
+}
+
+// timeout returns how long each of the hooks may run
+func (h *MinerHooks) timeout() time.Duration {
+	timeout := defaultHookTimeout
+	if h.Timeout > 0 {
+		timeout = time.Duration(h.Timeout) * time.Second
+	}
+	if timeout > maxHookTimeout {
+		timeout = maxHookTimeout
+	}
+	return timeout
+}
+
+// hook is a hook to run and the timeout of the config that named it
+type hook struct {
+	name    string
+	timeout time.Duration
+}
+
+// hookMiner is what a hook learns about the miners on stdin
+type hookMiner struct {
+	Name      string `json:"name"`
+	Algorithm string `json:"algorithm"`
+	Coin      string `json:"coin,omitempty"`
+	Pool      string `json:"pool"`
+	GPUVendor string `json:"gpuVendor,omitempty"`
+}
+
+// runHooks runs the stage's hooks ("preStart" or "postStop") of the
+// configs one after another. Failures are logged but don't stop the
+// miners starting or stopping: a missed governor change beats a rig that
+// doesn't mine.
+func runHooks(stage string, configs []*MinerConfig) {
+	var hooks []hook
+	seen := map[string]bool{}
+	miners := make([]hookMiner, 0, len(configs))
+	for _, config := range configs {
+		if config == nil {
+			continue
+		}
+		miners = append(miners, hookMiner{
+			Name:      config.Name,
+			Algorithm: config.Algorithm,
+			Coin:      config.Coin,
+			Pool:      config.Pool,
+			GPUVendor: config.GPUVendor,
+		})
+		if config.Hooks == nil {
+			continue
+		}
+		names := config.Hooks.PreStart
+		if stage == "postStop" {
+			names = config.Hooks.PostStop
+		}
+		for _, name := range names {
+			if !seen[name] {
+				seen[name] = true
+				hooks = append(hooks, hook{name: name, timeout: config.Hooks.timeout()})
+			}
+		}
+	}
+	if len(hooks) == 0 {
+		return
+	}
+
+	input, _ := json.Marshal(map[string]interface{}{"stage": stage, "miners": miners})
+	dir := plugins.Dir("hooks")
+	for _, h := range hooks {
+		name := h.name
+		path := plugins.Find(dir, name)
+		if path == "" {
+			fmt.Printf("Hook %s: not installed in %s\n", name, dir)
+			continue
+		}
+
+		started := time.Now()
+		ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+		output, err := plugins.RunScript(ctx, path, input, "BLOXOS_HOOK_STAGE="+stage)
+		cancel()
+		if err != nil {
+			fmt.Printf("Hook %s (%s) failed after %s: %v\n", name, stage, time.Since(started).Round(time.Millisecond), err)
+			continue
+		}
+		fmt.Printf("Hook %s (%s) done in %s\n", name, stage, time.Since(started).Round(time.Millisecond))
+		for _, line := range strings.Split(string(output), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				fmt.Printf("  %s: %s\n", name, line)
+			}
+		}
+	}
+}
+
+// missingHooks lists the hooks of a config that aren't installed
+func missingHooks(config *MinerConfig) []string {
+	if config.Hooks == nil {
+		return nil
+	}
+	var missing []string
+	dir := plugins.Dir("hooks")
+	for _, name := range append(append([]string(nil), config.Hooks.PreStart...), config.Hooks.PostStop...) {
+		if plugins.Find(dir, name) == "" && !containsString(missing, name) {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,166 @@
+package executor
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// LEDRequest sets GPU RGB lighting
+type LEDRequest struct {
+	Mode       string `json:"mode"`                 // "off" or "static"
+	Color      string `json:"color,omitempty"`      // RRGGBB for static
+	Brightness *int   `json:"brightness,omitempty"` // Percent for static (sysfs LEDs and OpenRGB devices that support it)
+	Device     *int   `json:"device,omitempty"`     // OpenRGB device index; nil = all GPUs
+}
+
+// LEDResult is the outcome for one lighting device
+type LEDResult struct {
+	Backend string `json:"backend"` // "openrgb" or "sysfs"
+	Device  string `json:"device"`
+	Error   string `json:"error,omitempty"`
+}
+
+var (
+	ledColorPattern  = regexp.MustCompile(`^[0-9A-Fa-f]{6}$`)
+	openRGBDevicePat = regexp.MustCompile(`^(\d+): (.+)$`)
+)
+
+// SetLEDs turns GPU lighting off or sets a static color, using OpenRGB
+// when installed and GPU-attached LEDs in /sys/class/leds otherwise
+func (e *Executor) SetLEDs(req *LEDRequest) ([]LEDResult, error) {
+	switch req.Mode {
+	case "off":
+	case "static":
+		req.Color = strings.TrimPrefix(req.Color, "#")
+		if !ledColorPattern.MatchString(req.Color) {
+			return nil, fmt.Errorf("color must be RRGGBB, got %q", req.Color)
+		}
+	default:
+		return nil, fmt.Errorf("mode must be off or static")
+	}
+	if req.Brightness != nil && (*req.Brightness < 0 || *req.Brightness > 100) {
+		return nil, fmt.Errorf("brightness must be 0-100")
+	}
+
+	var results []LEDResult
+	if _, err := e.run.LookPath("openrgb"); err == nil {
+		results = append(results, e.setOpenRGB(req)...)
+	}
+	if req.Device == nil {
+		results = append(results, e.setSysfsLEDs(req)...)
+	}
+
+	if len(results) == 0 {
+		return nil, fmt.Errorf("no controllable GPU LEDs found (install OpenRGB for RGB control)")
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Error != "" {
+			failed++
+		}
+	}
+	if failed == len(results) {
+		return results, fmt.Errorf("failed to set LEDs on all %d device(s)", failed)
+	}
+	return results, nil
+}
+
+// setOpenRGB applies the request to OpenRGB GPU devices
+func (e *Executor) setOpenRGB(req *LEDRequest) []LEDResult {
+	devices, err := e.openRGBGPUs()
+	if err != nil {
+		return []LEDResult{{Backend: "openrgb", Error: err.Error()}}
+	}
+
+	var results []LEDResult
+	for index, name := range devices {
+		if req.Device != nil && *req.Device != index {
+			continue
+		}
+		result := LEDResult{Backend: "openrgb", Device: fmt.Sprintf("%d: %s", index, name)}
+
+		device := strconv.Itoa(index)
+		var args []string
+		if req.Mode == "off" {
+			args = []string{"-d", device, "-m", "off"}
+		} else {
+			args = []string{"-d", device, "-m", "static", "-c", req.Color}
+			if req.Brightness != nil {
+				args = append(args, "-b", strconv.Itoa(*req.Brightness))
+			}
+		}
+
+		output, err := e.run.Command("openrgb", args...).CombinedOutput()
+		if err != nil && req.Mode == "off" {
+			// Not every controller has an "off" mode; black works everywhere
+			output, err = e.run.Command("openrgb", "-d", device, "-m", "static", "-c", "000000").CombinedOutput()
+		}
+		if err != nil {
+			result.Error = fmt.Sprintf("%v: %s", err, strings.TrimSpace(string(output)))
+		} else if e.debug {
+			fmt.Printf("openrgb %v: %s\n", args, string(output))
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// openRGBGPUs lists OpenRGB devices of type GPU by device index
+func (e *Executor) openRGBGPUs() (map[int]string, error) {
+	output, err := e.run.Command("openrgb", "--list-devices").Output()
+	if err != nil {
+		return nil, fmt.Errorf("openrgb --list-devices: %w", err)
+	}
+
+	devices := map[int]string{}
+	current, name := -1, ""
+	for _, line := range strings.Split(string(output), "\n") {
+		if m := openRGBDevicePat.FindStringSubmatch(line); m != nil {
+			current, _ = strconv.Atoi(m[1])
+			name = strings.TrimSpace(m[2])
+			continue
+		}
+		field := strings.TrimSpace(line)
+		if current >= 0 && strings.HasPrefix(field, "Type:") && strings.TrimSpace(strings.TrimPrefix(field, "Type:")) == "GPU" {
+			devices[current] = name
+		}
+	}
+	return devices, nil
+}
+
+// setSysfsLEDs drives LED class devices attached to display controllers.
+// These only support brightness, so static colors map to on.
+func (e *Executor) setSysfsLEDs(req *LEDRequest) []LEDResult {
+	entries, err := e.fs.ReadDir("/sys/class/leds")
+	if err != nil {
+		return nil
+	}
+
+	var results []LEDResult
+	for _, entry := range entries {
+		ledPath := filepath.Join("/sys/class/leds", entry.Name())
+		class, err := e.fs.ReadFile(filepath.Join(ledPath, "device", "class"))
+		if err != nil || !strings.HasPrefix(strings.TrimSpace(string(class)), "0x03") {
+			continue // Not a display controller
+		}
+		result := LEDResult{Backend: "sysfs", Device: entry.Name()}
+
+		brightness := int64(0)
+		if req.Mode == "static" {
+			data, _ := e.fs.ReadFile(filepath.Join(ledPath, "max_brightness"))
+			brightness, _ = strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+			if req.Brightness != nil {
+				brightness = brightness * int64(*req.Brightness) / 100
+			}
+		}
+		if err := e.fs.WriteFile(filepath.Join(ledPath, "brightness"), []byte(strconv.FormatInt(brightness, 10)), 0644); err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results
+}
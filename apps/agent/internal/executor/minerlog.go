@@ -0,0 +1,58 @@
+package executor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bloxos/agent/internal/system"
+)
+
+// SetMinerLogDir makes miners write their output to <miner>.log files in
+// dir, e.g. for shipping to a central log server. The files belong to the
+// miners rather than a pipe into the agent, so miners keep running and
+// logging across agent restarts. Empty discards the output, the default.
+func (e *Executor) SetMinerLogDir(dir string) error {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	e.minerLogDir = dir
+	return nil
+}
+
+// openMinerLog opens the log file of a miner about to start, or returns
+// nil when output is discarded. Instances of the same miner get their
+// own files; used tracks the names taken by this start. Miners whose
+// stats come from their output always get one.
+func (e *Executor) openMinerLog(config *MinerConfig, used map[string]bool) *os.File {
+	dir := e.minerLogDir
+	if dir == "" && config.Output != nil {
+		dir = defaultMinerLogDir()
+	}
+	if dir == "" {
+		return nil
+	}
+	// Logs are written for as long as the miner runs: keep them off a
+	// failing disk
+	if system.DiskDegraded() {
+		dir = filepath.Join(system.VolatileDir(), "miner-logs")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		fmt.Printf("Warning: failed to create %s: %v\n", dir, err)
+		return nil
+	}
+	name := canonicalMinerName(config.Name)
+	for i := 2; used[name]; i++ {
+		name = fmt.Sprintf("%s-%d", canonicalMinerName(config.Name), i)
+	}
+	used[name] = true
+
+	f, err := os.OpenFile(filepath.Join(dir, name+".log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		fmt.Printf("Warning: failed to open %s log: %v\n", config.Name, err)
+		return nil
+	}
+	return f
+}
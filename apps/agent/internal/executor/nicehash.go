@@ -0,0 +1,123 @@
+package executor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NiceHash stratum endpoints: one host per algorithm, routed to the
+// nearest region
+const (
+	niceHashHost    = "%s.auto.nicehash.com"
+	niceHashPort    = 9200
+	niceHashTLSPort = 443
+)
+
+// niceHashAlgorithms maps our algorithm names to NiceHash's
+var niceHashAlgorithms = map[string]string{
+	"ethash":     "daggerhashimoto",
+	"etchash":    "etchash",
+	"kawpow":     "kawpow",
+	"autolykos2": "autolykos",
+	"kheavyhash": "kheavyhash",
+	"octopus":    "octopus",
+	"zelhash":    "zelhash",
+	"beamhash":   "beamv3",
+	"randomx":    "randomxmonero",
+	"nexapow":    "nexapow",
+	"alephium":   "alephium",
+	"fishhash":   "fishhash",
+}
+
+// ResolveNiceHash prepares a config mining to NiceHash: the algorithm may
+// be given in NiceHash's naming, the pool defaults to the algorithm's
+// auto-region endpoint, and ethash-family algorithms use the
+// EthereumStratum/1.0.0 dialect NiceHash requires. The wallet must be a
+// NiceHash mining address. Explicitly set fields are kept.
+func ResolveNiceHash(config *MinerConfig) error {
+	algorithm := strings.ToLower(config.Algorithm)
+	for ours, theirs := range niceHashAlgorithms {
+		if algorithm == theirs {
+			algorithm = ours
+			break
+		}
+	}
+	name, ok := niceHashAlgorithms[algorithm]
+	if !ok {
+		return fmt.Errorf("NiceHash doesn't offer %q", config.Algorithm)
+	}
+	config.Algorithm = algorithm
+
+	if config.Pool == "" {
+		host := fmt.Sprintf(niceHashHost, name)
+		if config.PoolTLS {
+			config.Pool = fmt.Sprintf("stratum+ssl://%s:%d", host, niceHashTLSPort)
+		} else {
+			config.Pool = fmt.Sprintf("stratum+tcp://%s:%d", host, niceHashPort)
+		}
+	}
+	if config.StratumMode == "" && (algorithm == "ethash" || algorithm == "etchash") {
+		config.StratumMode = StratumEthV1
+	}
+	return ValidateNiceHashWallet(config.Wallet)
+}
+
+// ValidateNiceHashWallet checks a NiceHash mining address: the "NHb"
+// address of a NiceHash account or an external BTC address. NHb addresses
+// use NiceHash's own encoding, so only their format is checked.
+func ValidateNiceHashWallet(wallet string) error {
+	if wallet == "" {
+		return fmt.Errorf("wallet is required")
+	}
+	address := wallet
+	if idx := strings.Index(address, "."); idx > 0 {
+		address = address[:idx]
+	}
+
+	if strings.HasPrefix(address, "NHb") {
+		if len(address) < 34 || len(address) > 36 {
+			return fmt.Errorf("invalid NiceHash mining address %q: wrong length", address)
+		}
+		for _, c := range address {
+			if !strings.ContainsRune(base58Alphabet, c) {
+				return fmt.Errorf("invalid NiceHash mining address %q: invalid character %q", address, c)
+			}
+		}
+		return nil
+	}
+	if err := ValidateWallet("BTC", wallet); err != nil {
+		return fmt.Errorf("not a NiceHash mining address (NHb... or BTC): %w", err)
+	}
+	return nil
+}
+
+// withNiceHash returns a copy of config with the login and flags NiceHash
+// needs beyond the stratum dialect: the worker joined to the address,
+// since NiceHash ignores separate worker fields, and extranonce
+// subscription for miners that don't enable it themselves
+func withNiceHash(config *MinerConfig) *MinerConfig {
+	if !config.NiceHash {
+		return config
+	}
+	adjusted := *config
+	if adjusted.Worker != "" && !strings.Contains(adjusted.Wallet, ".") {
+		adjusted.Wallet += "." + adjusted.Worker
+	}
+	adjusted.Worker = ""
+
+	var args []string
+	switch canonicalMinerName(config.Name) {
+	case "cpuminer-opt":
+		if !strings.HasSuffix(adjusted.Pool, "#xnsub") {
+			adjusted.Pool += "#xnsub"
+		}
+	case "xmrig":
+		if !containsString(config.ExtraArgs, "--nicehash") {
+			args = append(args, "--nicehash")
+		}
+	case "srbminer":
+		args = append(args, "--nicehash", "true")
+	}
+	adjusted.ExtraArgs = append(args, config.ExtraArgs...)
+	return &adjusted
+}
@@ -0,0 +1,109 @@
+package executor
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// NvidiaGPUMode is the persistence and compute mode of one GPU
+type NvidiaGPUMode struct {
+	Index       int    `json:"index"`
+	Persistence bool   `json:"persistence"`
+	ComputeMode string `json:"computeMode"`
+}
+
+// NvidiaSetupStatus records the outcome of the last driver mode setup
+type NvidiaSetupStatus struct {
+	Success     bool            `json:"success"`
+	Persistence bool            `json:"persistence"` // Requested persistence mode
+	ComputeMode string          `json:"computeMode"` // Requested compute mode
+	GPUs        []NvidiaGPUMode `json:"gpus,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	Time        int64           `json:"time"` // Unix seconds
+}
+
+// nvidiaComputeModes maps accepted compute mode names to nvidia-smi values
+var nvidiaComputeModes = map[string]string{
+	"DEFAULT":           "0",
+	"PROHIBITED":        "2",
+	"EXCLUSIVE_PROCESS": "3",
+}
+
+// SetupNvidia sets persistence mode and compute mode on all NVIDIA GPUs.
+// Without persistence mode the driver unloads when the last CUDA context
+// closes, which resets clocks and power limits.
+func (e *Executor) SetupNvidia(persistence bool, computeMode string) (*NvidiaSetupStatus, error) {
+	if computeMode == "" {
+		computeMode = "DEFAULT"
+	}
+	computeMode = strings.ToUpper(computeMode)
+	modeValue, ok := nvidiaComputeModes[computeMode]
+	if !ok {
+		return nil, fmt.Errorf("invalid compute mode %q (DEFAULT, PROHIBITED or EXCLUSIVE_PROCESS)", computeMode)
+	}
+
+	if _, err := e.run.LookPath("nvidia-smi"); err != nil {
+		return nil, fmt.Errorf("nvidia-smi not found")
+	}
+
+	status := &NvidiaSetupStatus{
+		Persistence: persistence,
+		ComputeMode: computeMode,
+		Time:        time.Now().Unix(),
+	}
+
+	var errors []string
+	pm := "0"
+	if persistence {
+		pm = "1"
+	}
+	if err := e.runNvidiaSmi("-pm", pm); err != nil {
+		errors = append(errors, fmt.Sprintf("persistence mode: %v", err))
+	}
+	if err := e.runNvidiaSmi("-c", modeValue); err != nil {
+		errors = append(errors, fmt.Sprintf("compute mode: %v", err))
+	}
+
+	status.GPUs = e.queryNvidiaModes()
+	status.Success = len(errors) == 0
+	if !status.Success {
+		status.Error = strings.Join(errors, "; ")
+	}
+
+	e.nvidiaStatus = status
+
+	if !status.Success {
+		return status, fmt.Errorf("%s", status.Error)
+	}
+	return status, nil
+}
+
+// NvidiaSetupStatus returns the result of the last SetupNvidia call, or nil
+func (e *Executor) NvidiaSetupStatus() *NvidiaSetupStatus {
+	return e.nvidiaStatus
+}
+
+// queryNvidiaModes reads the current persistence and compute mode per GPU
+func (e *Executor) queryNvidiaModes() []NvidiaGPUMode {
+	output, err := e.run.Command("nvidia-smi",
+		"--query-gpu=index,persistence_mode,compute_mode",
+		"--format=csv,noheader").Output()
+	if err != nil {
+		return nil
+	}
+
+	var modes []NvidiaGPUMode
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		fields := strings.Split(line, ",")
+		if len(fields) < 3 {
+			continue
+		}
+		var mode NvidiaGPUMode
+		fmt.Sscanf(strings.TrimSpace(fields[0]), "%d", &mode.Index)
+		mode.Persistence = strings.TrimSpace(fields[1]) == "Enabled"
+		mode.ComputeMode = strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(fields[2]), " ", "_"))
+		modes = append(modes, mode)
+	}
+	return modes
+}
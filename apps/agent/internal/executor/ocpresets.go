@@ -0,0 +1,215 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// OCPreset is a named set of OC settings with per-GPU-model variants, so
+// the server can reference it by name instead of resending full payloads
+type OCPreset struct {
+	Name    string              `json:"name"`
+	Models  map[string]OCConfig `json:"models,omitempty"`  // GPU model name fragment ("RTX 3070", "RX 6800") -> settings
+	Default *OCConfig           `json:"default,omitempty"` // GPUs matching no model; nil leaves them untouched
+}
+
+// OCPresetResult is the outcome of applying a preset to one GPU
+type OCPresetResult struct {
+	Vendor string `json:"vendor"`
+	Index  int    `json:"index"`
+	Model  string `json:"model"`
+	Match  string `json:"match,omitempty"` // Matched model key, "default", or "" when skipped
+	Error  string `json:"error,omitempty"`
+}
+
+// gpuModel is a GPU as addressed by the vendor's OC tooling
+type gpuModel struct {
+	vendor string
+	index  int // nvidia-smi index or DRM card number
+	name   string
+}
+
+// SyncOCPresets stores presets pushed by the server. With replace set the
+// local store is replaced, otherwise presets are added or updated by name.
+func (e *Executor) SyncOCPresets(presets []OCPreset, replace bool) (int, error) {
+	for _, preset := range presets {
+		if preset.Name == "" {
+			return 0, fmt.Errorf("preset name required")
+		}
+	}
+
+	stored := map[string]OCPreset{}
+	if !replace {
+		existing, err := e.OCPresets()
+		if err != nil {
+			return 0, err
+		}
+		for _, preset := range existing {
+			stored[preset.Name] = preset
+		}
+	}
+	for _, preset := range presets {
+		stored[preset.Name] = preset
+	}
+
+	list := make([]OCPreset, 0, len(stored))
+	for _, preset := range stored {
+		list = append(list, preset)
+	}
+
+	if err := os.MkdirAll(e.configPath, 0755); err != nil {
+		return 0, err
+	}
+	data, err := json.Marshal(list)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.WriteFile(filepath.Join(e.configPath, "oc_presets.json"), data, 0644); err != nil {
+		return 0, fmt.Errorf("failed to save OC presets: %w", err)
+	}
+	return len(list), nil
+}
+
+// OCPresets returns the locally stored presets
+func (e *Executor) OCPresets() ([]OCPreset, error) {
+	data, err := os.ReadFile(filepath.Join(e.configPath, "oc_presets.json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var presets []OCPreset
+	if err := json.Unmarshal(data, &presets); err != nil {
+		return nil, fmt.Errorf("invalid OC preset store: %w", err)
+	}
+	return presets, nil
+}
+
+// ApplyOCPreset applies a stored preset, picking the settings for each GPU
+// by its model name
+func (e *Executor) ApplyOCPreset(name string) ([]OCPresetResult, error) {
+	if err := e.checkSafeMode(); err != nil {
+		return nil, err
+	}
+	presets, err := e.OCPresets()
+	if err != nil {
+		return nil, err
+	}
+	var preset *OCPreset
+	for i := range presets {
+		if presets[i].Name == name {
+			preset = &presets[i]
+			break
+		}
+	}
+	if preset == nil {
+		return nil, fmt.Errorf("OC preset %q not found", name)
+	}
+
+	gpus := e.listGPUModels()
+	if len(gpus) == 0 {
+		return nil, fmt.Errorf("no NVIDIA or AMD GPUs detected")
+	}
+
+	matched := 0
+	for _, gpu := range gpus {
+		if config, _ := preset.forModel(gpu.name); config != nil {
+			matched++
+		}
+	}
+
+	var results []OCPresetResult
+	failed, applied := 0, 0
+	delay := e.staggerDelays().OC
+	for _, gpu := range gpus {
+		result := OCPresetResult{Vendor: gpu.vendor, Index: gpu.index, Model: gpu.name}
+
+		config, match := preset.forModel(gpu.name)
+		if config == nil {
+			results = append(results, result)
+			continue
+		}
+		result.Match = match
+
+		e.staggerStep("oc", applied, matched, fmt.Sprintf("%s gpu%d", gpu.vendor, gpu.index), delay)
+		applied++
+		oc := *config
+		oc.GPUIndex = gpu.index
+		if gpu.vendor == "nvidia" {
+			err = e.applyNvidiaOC(&oc)
+		} else {
+			err = e.applyAMDOC(&oc)
+		}
+		if err != nil {
+			result.Error = err.Error()
+			failed++
+		}
+		results = append(results, result)
+	}
+
+	if failed > 0 {
+		return results, fmt.Errorf("preset %q failed on %d GPU(s)", name, failed)
+	}
+	return results, nil
+}
+
+// forModel returns the settings for a GPU model; the longest matching model
+// key wins, so "RTX 3070 Ti" takes precedence over "RTX 3070"
+func (p *OCPreset) forModel(model string) (*OCConfig, string) {
+	lower := strings.ToLower(model)
+	best := ""
+	for key := range p.Models {
+		if strings.Contains(lower, strings.ToLower(key)) && len(key) > len(best) {
+			best = key
+		}
+	}
+	if best != "" {
+		config := p.Models[best]
+		return &config, best
+	}
+	if p.Default != nil {
+		return p.Default, "default"
+	}
+	return nil, ""
+}
+
+// listGPUModels lists NVIDIA GPUs by nvidia-smi index and AMD GPUs by DRM card
+func (e *Executor) listGPUModels() []gpuModel {
+	var gpus []gpuModel
+
+	if output, err := e.run.Command("nvidia-smi", "--query-gpu=index,name", "--format=csv,noheader").Output(); err == nil {
+		for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+			fields := strings.SplitN(line, ",", 2)
+			if len(fields) != 2 {
+				continue
+			}
+			idx, err := strconv.Atoi(strings.TrimSpace(fields[0]))
+			if err != nil {
+				continue
+			}
+			gpus = append(gpus, gpuModel{vendor: "nvidia", index: idx, name: strings.TrimSpace(fields[1])})
+		}
+	}
+
+	if entries, err := e.fs.ReadDir("/sys/class/drm"); err == nil {
+		for _, entry := range entries {
+			if !strings.HasPrefix(entry.Name(), "card") || strings.Contains(entry.Name(), "-") {
+				continue
+			}
+			vendor, _ := e.fs.ReadFile(fmt.Sprintf("/sys/class/drm/%s/device/vendor", entry.Name()))
+			if strings.TrimSpace(string(vendor)) != "0x1002" {
+				continue
+			}
+			idx, _ := strconv.Atoi(strings.TrimPrefix(entry.Name(), "card"))
+			gpus = append(gpus, gpuModel{vendor: "amd", index: idx, name: e.lspciGPUName(idx)})
+		}
+	}
+
+	return gpus
+}
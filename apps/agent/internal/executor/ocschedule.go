@@ -0,0 +1,210 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// OCSchedule switches between stored OC presets by time of day, weekday
+// and month, e.g. aggressive at night and conservative in summer afternoons
+type OCSchedule struct {
+	Timezone string             `json:"timezone,omitempty"` // IANA name such as "Europe/Athens"; empty = system time
+	Default  string             `json:"default,omitempty"`  // Preset outside all windows; empty leaves OC unchanged
+	Windows  []OCScheduleWindow `json:"windows"`
+}
+
+// OCScheduleWindow selects a preset during a daily time range. The first
+// matching window wins.
+type OCScheduleWindow struct {
+	Preset string   `json:"preset"`
+	Start  string   `json:"start"`            // "HH:MM"
+	End    string   `json:"end"`              // "HH:MM"; before Start wraps past midnight
+	Days   []string `json:"days,omitempty"`   // "mon".."sun" the window starts on; empty = every day
+	Months []int    `json:"months,omitempty"` // 1-12; empty = all year
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// SetOCSchedule validates and stores a schedule; nil or no windows and no
+// default removes it
+func (e *Executor) SetOCSchedule(schedule *OCSchedule) error {
+	path := filepath.Join(e.configPath, "oc_schedule.json")
+	if schedule == nil || (len(schedule.Windows) == 0 && schedule.Default == "") {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	if err := schedule.validate(); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(e.configPath, 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(schedule)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to save OC schedule: %w", err)
+	}
+	return nil
+}
+
+// OCSchedule returns the stored schedule, or nil if none is set
+func (e *Executor) OCSchedule() (*OCSchedule, error) {
+	data, err := os.ReadFile(filepath.Join(e.configPath, "oc_schedule.json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var schedule OCSchedule
+	if err := json.Unmarshal(data, &schedule); err != nil {
+		return nil, fmt.Errorf("invalid OC schedule: %w", err)
+	}
+	return &schedule, nil
+}
+
+// PresetAt returns the preset scheduled at t and the window that selected
+// it, or nil for the default
+func (s *OCSchedule) PresetAt(t time.Time) (string, *OCScheduleWindow, error) {
+	loc, err := s.location()
+	if err != nil {
+		return "", nil, err
+	}
+	t = t.In(loc)
+
+	for i := range s.Windows {
+		w := &s.Windows[i]
+		if inWindow(t, w.Start, w.End, w.Days, w.Months) {
+			return w.Preset, w, nil
+		}
+	}
+	return s.Default, nil, nil
+}
+
+// inWindow reports whether t falls in a daily time range that starts on
+// one of days in one of months (empty = any)
+func inWindow(t time.Time, startClock, endClock string, days []string, months []int) bool {
+	minute := t.Hour()*60 + t.Minute()
+	start, _ := parseClock(startClock)
+	end, _ := parseClock(endClock)
+
+	// The day the window started on: yesterday for the part of an
+	// overnight window after midnight
+	day := t
+	switch {
+	case start < end:
+		if minute < start || minute >= end {
+			return false
+		}
+	case start > end:
+		if minute < start && minute >= end {
+			return false
+		}
+		if minute < end {
+			day = t.AddDate(0, 0, -1)
+		}
+	default:
+		// Equal start and end covers the whole day
+	}
+	return matchesDay(day, days, months)
+}
+
+func matchesDay(day time.Time, days []string, months []int) bool {
+	if len(months) > 0 {
+		found := false
+		for _, month := range months {
+			if time.Month(month) == day.Month() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(days) == 0 {
+		return true
+	}
+	for _, name := range days {
+		if weekdays[strings.ToLower(name)] == day.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *OCSchedule) location() (*time.Location, error) {
+	return loadLocation(s.Timezone)
+}
+
+// loadLocation returns an IANA timezone, or system time for ""
+func loadLocation(timezone string) (*time.Location, error) {
+	if timezone == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %q: %w", timezone, err)
+	}
+	return loc, nil
+}
+
+func (s *OCSchedule) validate() error {
+	if _, err := s.location(); err != nil {
+		return err
+	}
+
+	for i, w := range s.Windows {
+		if w.Preset == "" {
+			return fmt.Errorf("window %d: preset required", i)
+		}
+		if err := validateWindow(w.Start, w.End, w.Days, w.Months); err != nil {
+			return fmt.Errorf("window %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func validateWindow(start, end string, days []string, months []int) error {
+	if _, err := parseClock(start); err != nil {
+		return fmt.Errorf("start: %w", err)
+	}
+	if _, err := parseClock(end); err != nil {
+		return fmt.Errorf("end: %w", err)
+	}
+	for _, day := range days {
+		if _, ok := weekdays[strings.ToLower(day)]; !ok {
+			return fmt.Errorf("invalid day %q (use mon..sun)", day)
+		}
+	}
+	for _, month := range months {
+		if month < 1 || month > 12 {
+			return fmt.Errorf("invalid month %d", month)
+		}
+	}
+	return nil
+}
+
+// parseClock converts "HH:MM" to minutes since midnight
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q (use HH:MM)", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
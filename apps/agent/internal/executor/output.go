@@ -0,0 +1,73 @@
+package executor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// OutputPatterns read the stats of a miner without an API from its
+// output, e.g. a custom binary started from a config file template. Each
+// is a regular expression matched against every line:
+//
+//   - Hashrate: the value in the first group or one named "hashrate", the
+//     unit in the second or one named "unit"; a group named "gpu" makes it
+//     a per-GPU reading
+//   - Accepted, Rejected: a line per share, or a group holding the total
+//     the miner prints, e.g. `accepted (\d+)/\d+`
+type OutputPatterns struct {
+	Hashrate string `json:"hashrate"`
+	Accepted string `json:"accepted"`
+	Rejected string `json:"rejected"`
+	Unit     string `json:"unit"` // When the hashrate has no unit group, e.g. "MH/s"; default H/s
+}
+
+// validate compiles the patterns
+func (p *OutputPatterns) validate() error {
+	if p.Hashrate == "" {
+		return fmt.Errorf("output: hashrate pattern required")
+	}
+	for name, pattern := range map[string]string{"hashrate": p.Hashrate, "accepted": p.Accepted, "rejected": p.Rejected} {
+		if pattern == "" {
+			continue
+		}
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("output: invalid %s pattern: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// OutputMiner is a running miner whose stats are parsed from its log
+type OutputMiner struct {
+	Name      string
+	Algorithm string
+	Pool      string
+	PID       int
+	Log       string // Output file, see openMinerLog
+	Offset    int64  // Where this run's output starts; logs are appended to
+	Started   time.Time
+	Patterns  OutputPatterns
+}
+
+// defaultMinerLogDir keeps the output of parsed miners when logs aren't
+// shipped; temporary storage, which is RAM on most images
+func defaultMinerLogDir() string {
+	return filepath.Join(os.TempDir(), "bloxos", "miner-logs")
+}
+
+// OutputMiners lists the running miners whose stats come from their
+// output, the primary miner first
+func (e *Executor) OutputMiners() []OutputMiner {
+	e.apiMu.Lock()
+	defer e.apiMu.Unlock()
+	return append([]OutputMiner(nil), e.outputMiners...)
+}
+
+func (e *Executor) setOutputMiners(miners []OutputMiner) {
+	e.apiMu.Lock()
+	defer e.apiMu.Unlock()
+	e.outputMiners = miners
+}
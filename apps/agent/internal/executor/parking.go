@@ -0,0 +1,512 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parkSettle is how long a parked card gets to drop its clocks before its
+// idle draw is measured
+const parkSettle = 5 * time.Second
+
+// ParkedGPU is a card taken out of mining and held at minimum power
+type ParkedGPU struct {
+	BusID    string   `json:"busId"`
+	Vendor   string   `json:"vendor"`
+	Since    int64    `json:"since"`            // Unix seconds
+	Before   *int     `json:"before,omitempty"` // W drawn before parking
+	After    *int     `json:"after,omitempty"`  // W drawn once parked
+	Saved    *int     `json:"saved,omitempty"`  // W
+	Warnings []string `json:"warnings,omitempty"`
+
+	// Settings restored on unparking
+	powerLimit string // NVIDIA power limit (W)
+	amdCap     string // AMD power1_cap (µW)
+	amdLevel   string // AMD power_dpm_force_performance_level
+}
+
+// parkedRecord is a parked card as saved, with the settings to restore
+type parkedRecord struct {
+	ParkedGPU
+	PowerLimit string `json:"powerLimit,omitempty"`
+	AMDCap     string `json:"amdCap,omitempty"`
+	AMDLevel   string `json:"amdLevel,omitempty"`
+}
+
+func (e *Executor) parkedPath() string {
+	return filepath.Join(e.configPath, "parked_gpus.json")
+}
+
+// loadParkedGPUs reads the parked cards on first use. Called with parkMu
+// held.
+func (e *Executor) loadParkedGPUs() {
+	if e.parked != nil {
+		return
+	}
+	e.parked = make(map[string]*ParkedGPU)
+	data, err := os.ReadFile(e.parkedPath())
+	if err != nil {
+		return
+	}
+	var records []parkedRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		fmt.Printf("Ignoring invalid parked GPU list: %v\n", err)
+		return
+	}
+	for _, record := range records {
+		card := record.ParkedGPU
+		card.powerLimit = record.PowerLimit
+		card.amdCap = record.AMDCap
+		card.amdLevel = record.AMDLevel
+		e.parked[card.BusID] = &card
+	}
+}
+
+// saveParkedGPUs writes the parked cards. Called with parkMu held.
+func (e *Executor) saveParkedGPUs() error {
+	records := make([]parkedRecord, 0, len(e.parked))
+	for _, card := range e.parkedListLocked() {
+		records = append(records, parkedRecord{
+			ParkedGPU:  card,
+			PowerLimit: card.powerLimit,
+			AMDCap:     card.amdCap,
+			AMDLevel:   card.amdLevel,
+		})
+	}
+	if err := os.MkdirAll(e.configPath, 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(e.parkedPath(), data, 0644); err != nil {
+		return fmt.Errorf("failed to save parked GPUs: %w", err)
+	}
+	return nil
+}
+
+// RestoreParkedGPUs lowers the power of the cards parked before a reboot
+// or agent restart again; the driver has reset their power settings. The
+// settings to restore on unparking are the ones saved when parking.
+func (e *Executor) RestoreParkedGPUs() []ParkedGPU {
+	present := map[string]bool{}
+	for _, device := range e.listGPUDevices() {
+		present[device.busID] = true
+	}
+
+	e.parkMu.Lock()
+	defer e.parkMu.Unlock()
+	e.loadParkedGPUs()
+	for _, card := range e.parked {
+		if !present[card.BusID] {
+			fmt.Printf("Parked GPU %s is not on the bus\n", card.BusID)
+			continue
+		}
+		saved := *card
+		card.Warnings = nil
+		e.lowerGPUPower(card)
+		if saved.powerLimit != "" {
+			card.powerLimit = saved.powerLimit
+		}
+		if saved.amdCap != "" {
+			card.amdCap = saved.amdCap
+		}
+		if saved.amdLevel != "" {
+			card.amdLevel = saved.amdLevel
+		}
+		fmt.Printf("Parked GPU %s again\n", card.BusID)
+	}
+	return e.parkedListLocked()
+}
+
+// gpuDevice is a GPU on the PCI bus
+type gpuDevice struct {
+	busID  string // Sysfs form, "0000:01:00.0"
+	vendor string // "nvidia" or "amd"
+}
+
+// ParkGPUs takes the GPUs at busIDs out of the miners' device lists and
+// drops them to their lowest power state, e.g. a card excluded for
+// instability that would otherwise idle at 30-50W. A running miner is
+// restarted without them. The result reports each card's saving.
+func (e *Executor) ParkGPUs(busIDs []string) ([]ParkedGPU, error) {
+	devices := map[string]gpuDevice{}
+	for _, device := range e.listGPUDevices() {
+		devices[device.busID] = device
+	}
+	var targets []gpuDevice
+	for _, busID := range busIDs {
+		device, ok := devices[sysfsBusID(busID)]
+		if !ok {
+			return nil, fmt.Errorf("no GPU at %s", busID)
+		}
+		targets = append(targets, device)
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("bus IDs required")
+	}
+
+	e.parkMu.Lock()
+	e.loadParkedGPUs()
+	var added []*ParkedGPU
+	for _, device := range targets {
+		if _, ok := e.parked[device.busID]; ok {
+			continue
+		}
+		card := &ParkedGPU{BusID: device.busID, Vendor: device.vendor, Since: time.Now().Unix()}
+		card.Before = e.gpuPowerDraw(device)
+		e.parked[device.busID] = card
+		added = append(added, card)
+	}
+	e.parkMu.Unlock()
+
+	// Free the cards before touching their power settings
+	if len(added) > 0 {
+		if err := e.RestartRunningMiner(); err != nil {
+			fmt.Printf("Warning: failed to restart the miner without the parked GPUs: %v\n", err)
+		}
+	}
+	e.parkMu.Lock()
+	for _, card := range added {
+		e.lowerGPUPower(card)
+	}
+	e.parkMu.Unlock()
+	if len(added) > 0 {
+		time.Sleep(parkSettle)
+	}
+
+	e.parkMu.Lock()
+	defer e.parkMu.Unlock()
+	for _, card := range added {
+		card.After = e.gpuPowerDraw(gpuDevice{busID: card.BusID, vendor: card.Vendor})
+		if card.Before != nil && card.After != nil {
+			saved := *card.Before - *card.After
+			card.Saved = &saved
+		}
+		fmt.Printf("Parked GPU %s\n", card.BusID)
+	}
+	if len(added) > 0 {
+		if err := e.saveParkedGPUs(); err != nil {
+			return e.parkedListLocked(), err
+		}
+	}
+	return e.parkedListLocked(), nil
+}
+
+// UnparkGPUs restores the power settings of parked GPUs and returns them
+// to mining; no bus IDs unparks all
+func (e *Executor) UnparkGPUs(busIDs []string) ([]ParkedGPU, error) {
+	e.parkMu.Lock()
+	e.loadParkedGPUs()
+	var restore []*ParkedGPU
+	if len(busIDs) == 0 {
+		for _, card := range e.parked {
+			restore = append(restore, card)
+		}
+	}
+	for _, busID := range busIDs {
+		card, ok := e.parked[sysfsBusID(busID)]
+		if !ok {
+			e.parkMu.Unlock()
+			return nil, fmt.Errorf("GPU %s is not parked", busID)
+		}
+		restore = append(restore, card)
+	}
+	var errors []string
+	for _, card := range restore {
+		if err := e.restoreGPUPower(card); err != nil {
+			errors = append(errors, fmt.Sprintf("%s: %v", card.BusID, err))
+		}
+		delete(e.parked, card.BusID)
+		fmt.Printf("Unparked GPU %s\n", card.BusID)
+	}
+	if len(restore) > 0 {
+		if err := e.saveParkedGPUs(); err != nil {
+			errors = append(errors, err.Error())
+		}
+	}
+	parked := e.parkedListLocked()
+	e.parkMu.Unlock()
+
+	if len(restore) > 0 {
+		if err := e.RestartRunningMiner(); err != nil {
+			errors = append(errors, fmt.Sprintf("restart miner: %v", err))
+		}
+	}
+	if len(errors) > 0 {
+		return parked, fmt.Errorf("failed to unpark: %s", strings.Join(errors, "; "))
+	}
+	return parked, nil
+}
+
+// ParkedGPUs lists the parked GPUs
+func (e *Executor) ParkedGPUs() []ParkedGPU {
+	e.parkMu.Lock()
+	defer e.parkMu.Unlock()
+	e.loadParkedGPUs()
+	return e.parkedListLocked()
+}
+
+func (e *Executor) parkedListLocked() []ParkedGPU {
+	list := make([]ParkedGPU, 0, len(e.parked))
+	for _, card := range e.parked {
+		list = append(list, *card)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].BusID < list[j].BusID })
+	return list
+}
+
+// excludedGPUs returns the bus IDs miners must leave alone: parked and
+// disabled GPUs
+func (e *Executor) excludedGPUs() map[string]bool {
+	excluded := map[string]bool{}
+	e.parkMu.Lock()
+	e.loadParkedGPUs()
+	for busID := range e.parked {
+		excluded[busID] = true
+	}
+	e.parkMu.Unlock()
+
+	e.disabledMu.Lock()
+	e.loadDisabledGPUs()
+	for busID := range e.disabled {
+		excluded[busID] = true
+	}
+	e.disabledMu.Unlock()
+	return excluded
+}
+
+// lowerGPUPower sets the card's minimum power limit and lowest clocks,
+// remembering the previous settings
+func (e *Executor) lowerGPUPower(card *ParkedGPU) {
+	switch card.Vendor {
+	case "nvidia":
+		gpu := nvidiaBusID(card.BusID)
+		if err := e.runNvidiaSmi("-i", gpu, "-rgc"); err != nil {
+			card.Warnings = append(card.Warnings, fmt.Sprintf("reset clocks: %v", err))
+		}
+		e.runNvidiaSmi("-i", gpu, "-rmc") // Not supported by every card
+		current, minimum, err := e.nvidiaPowerLimit(card.BusID)
+		if err != nil {
+			card.Warnings = append(card.Warnings, err.Error())
+			return
+		}
+		if err := e.runNvidiaSmi("-i", gpu, "-pl", strconv.Itoa(minimum)); err != nil {
+			card.Warnings = append(card.Warnings, fmt.Sprintf("power limit: %v", err))
+			return
+		}
+		card.powerLimit = strconv.Itoa(current)
+
+	case "amd":
+		device := filepath.Join("/sys/bus/pci/devices", card.BusID)
+		levelPath := filepath.Join(device, "power_dpm_force_performance_level")
+		if previous, err := e.fs.ReadFile(levelPath); err == nil {
+			if err := e.fs.WriteFile(levelPath, []byte("low"), 0644); err != nil {
+				card.Warnings = append(card.Warnings, fmt.Sprintf("performance level: %v", err))
+			} else {
+				card.amdLevel = strings.TrimSpace(string(previous))
+			}
+		}
+		hwmon, err := e.amdBusHwmon(card.BusID)
+		if err != nil {
+			card.Warnings = append(card.Warnings, err.Error())
+			return
+		}
+		previous, err := e.fs.ReadFile(filepath.Join(hwmon, "power1_cap"))
+		if err != nil {
+			return
+		}
+		minimum, err := e.fs.ReadFile(filepath.Join(hwmon, "power1_cap_min"))
+		if err != nil || strings.TrimSpace(string(minimum)) == "0" {
+			return // Some cards report no usable minimum
+		}
+		if err := e.fs.WriteFile(filepath.Join(hwmon, "power1_cap"), []byte(strings.TrimSpace(string(minimum))), 0644); err != nil {
+			card.Warnings = append(card.Warnings, fmt.Sprintf("power cap: %v", err))
+			return
+		}
+		card.amdCap = strings.TrimSpace(string(previous))
+	}
+}
+
+// restoreGPUPower undoes lowerGPUPower
+func (e *Executor) restoreGPUPower(card *ParkedGPU) error {
+	var errors []string
+	if card.powerLimit != "" {
+		if err := e.runNvidiaSmi("-i", nvidiaBusID(card.BusID), "-pl", card.powerLimit); err != nil {
+			errors = append(errors, fmt.Sprintf("power limit: %v", err))
+		}
+	}
+	if card.amdLevel != "" {
+		levelPath := filepath.Join("/sys/bus/pci/devices", card.BusID, "power_dpm_force_performance_level")
+		if err := e.fs.WriteFile(levelPath, []byte(card.amdLevel), 0644); err != nil {
+			errors = append(errors, fmt.Sprintf("performance level: %v", err))
+		}
+	}
+	if card.amdCap != "" {
+		if hwmon, err := e.amdBusHwmon(card.BusID); err == nil {
+			if err := e.fs.WriteFile(filepath.Join(hwmon, "power1_cap"), []byte(card.amdCap), 0644); err != nil {
+				errors = append(errors, fmt.Sprintf("power cap: %v", err))
+			}
+		}
+	}
+	if len(errors) > 0 {
+		return fmt.Errorf("%s", strings.Join(errors, "; "))
+	}
+	return nil
+}
+
+// gpuPowerDraw reads a card's current draw in watts, or nil when the
+// driver doesn't report it
+func (e *Executor) gpuPowerDraw(device gpuDevice) *int {
+	switch device.vendor {
+	case "nvidia":
+		output, err := e.run.Command("nvidia-smi", "-i", nvidiaBusID(device.busID),
+			"--query-gpu=power.draw", "--format=csv,noheader,nounits").Output()
+		if err != nil {
+			return nil
+		}
+		watts, err := strconv.ParseFloat(strings.TrimSpace(string(output)), 64)
+		if err != nil {
+			return nil
+		}
+		w := int(watts + 0.5)
+		return &w
+	case "amd":
+		hwmon, err := e.amdBusHwmon(device.busID)
+		if err != nil {
+			return nil
+		}
+		for _, name := range []string{"power1_average", "power1_input"} {
+			if data, err := e.fs.ReadFile(filepath.Join(hwmon, name)); err == nil {
+				if microwatts, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64); err == nil {
+					w := int((microwatts + 500000) / 1000000)
+					return &w
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// listGPUDevices lists the NVIDIA and AMD display controllers in PCI bus
+// order, the order miners number them in
+func (e *Executor) listGPUDevices() []gpuDevice {
+	entries, err := e.fs.ReadDir("/sys/bus/pci/devices")
+	if err != nil {
+		return nil
+	}
+	var devices []gpuDevice
+	for _, entry := range entries {
+		path := filepath.Join("/sys/bus/pci/devices", entry.Name())
+		class, _ := e.fs.ReadFile(filepath.Join(path, "class"))
+		// 0x0300xx VGA, 0x0302xx 3D controller
+		if c := strings.TrimSpace(string(class)); !strings.HasPrefix(c, "0x0300") && !strings.HasPrefix(c, "0x0302") {
+			continue
+		}
+		vendor, _ := e.fs.ReadFile(filepath.Join(path, "vendor"))
+		switch strings.TrimSpace(string(vendor)) {
+		case "0x10de":
+			devices = append(devices, gpuDevice{busID: entry.Name(), vendor: "nvidia"})
+		case "0x1002":
+			devices = append(devices, gpuDevice{busID: entry.Name(), vendor: "amd"})
+		}
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].busID < devices[j].busID })
+	return devices
+}
+
+// sysfsBusID converts the bus ID forms drivers and miners report
+// ("00000000:01:00.0", "01:00.0") to the sysfs one
+func sysfsBusID(busID string) string {
+	busID = strings.ToLower(strings.TrimSpace(busID))
+	parts := strings.Split(busID, ":")
+	switch {
+	case len(parts) == 2:
+		return "0000:" + busID
+	case len(parts) == 3 && len(parts[0]) > 4:
+		return parts[0][len(parts[0])-4:] + ":" + parts[1] + ":" + parts[2]
+	}
+	return busID
+}
+
+// minerDevices returns the device numbers a miner should use when GPUs are
+// excluded, or nil to let it use every card. Miners count the cards of the
+// vendor they run on, or all cards when they run on both.
+func (e *Executor) minerDevices(config *MinerConfig) ([]int, error) {
+	excluded := e.excludedGPUs()
+	if len(excluded) == 0 {
+		return nil, nil
+	}
+
+	vendor := config.GPUVendor
+	switch canonicalMinerName(config.Name) {
+	case "t-rex":
+		vendor = "nvidia"
+	case "teamredminer":
+		vendor = "amd"
+	case "xmrig", "cpuminer-opt":
+		return nil, nil
+	}
+	if vendor == "cpu" {
+		return nil, nil
+	}
+
+	var devices []int
+	index := 0
+	for _, device := range e.listGPUDevices() {
+		if vendor != "" && device.vendor != vendor {
+			continue
+		}
+		if !excluded[device.busID] {
+			devices = append(devices, index)
+		}
+		index++
+	}
+	if len(devices) == 0 {
+		return nil, fmt.Errorf("all GPUs for %s are excluded", config.Name)
+	}
+	return devices, nil
+}
+
+// deviceArgs renders a device list in the miner's syntax
+func deviceArgs(name string, devices []int) []string {
+	if len(devices) == 0 {
+		return nil
+	}
+	list := func(sep string, offset int) string {
+		parts := make([]string, len(devices))
+		for i, device := range devices {
+			parts[i] = strconv.Itoa(device + offset)
+		}
+		return strings.Join(parts, sep)
+	}
+
+	switch canonicalMinerName(name) {
+	case "t-rex", "teamredminer", "nbminer":
+		return []string{"-d", list(",", 0)}
+	case "lolminer":
+		return []string{"--devices", list(",", 0)}
+	case "gminer":
+		return append([]string{"--devices"}, strings.Fields(list(" ", 0))...)
+	case "srbminer":
+		return []string{"--gpu-id", list(",", 0)}
+	case "phoenixminer":
+		// Numbered from 1
+		return []string{"-gpus", list(",", 1)}
+	case "claymore":
+		// One character per card: 0-9, then a-z
+		var digits strings.Builder
+		for _, device := range devices {
+			digits.WriteString(strconv.FormatInt(int64(device), 36))
+		}
+		return []string{"-di", digits.String()}
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// PauseState is a paused flight sheet. It is kept on disk so an agent
+// restart or reboot during the pause doesn't lose it.
+type PauseState struct {
+	Since    int64    `json:"since"`              // Unix seconds
+	ResumeAt int64    `json:"resumeAt,omitempty"` // Unix seconds, 0 = until resumed
+	Reason   string   `json:"reason,omitempty"`
+	Miners   []string `json:"miners"` // Resumed with their saved configs
+}
+
+// PauseMiner stops the running miners but keeps their configs for
+// ResumeMiner, unlike StopMiner. A zero duration pauses until resumed.
+// Pausing again while paused changes the resume time.
+func (e *Executor) PauseMiner(duration time.Duration, reason string) (*PauseState, error) {
+	if duration < 0 {
+		return nil, fmt.Errorf("pause duration must not be negative")
+	}
+
+	e.minerMu.Lock()
+	defer e.minerMu.Unlock()
+
+	state := e.PauseStatus()
+	if state == nil {
+		if e.minerPID == 0 && len(e.extraMiners) == 0 {
+			return nil, fmt.Errorf("no miner is running")
+		}
+		configs, err := e.loadConfigs()
+		if err != nil {
+			return nil, fmt.Errorf("no saved miner config to resume: %w", err)
+		}
+		state = &PauseState{Since: time.Now().Unix()}
+		for _, config := range configs {
+			state.Miners = append(state.Miners, config.Name)
+		}
+
+		if err := e.stopMiner(); err != nil {
+			return nil, err
+		}
+	}
+
+	state.Reason = reason
+	state.ResumeAt = 0
+	if duration > 0 {
+		state.ResumeAt = time.Now().Add(duration).Unix()
+	}
+	if err := e.savePause(state); err != nil {
+		return state, fmt.Errorf("miner stopped, but the pause was not saved: %w", err)
+	}
+
+	fmt.Println("Mining paused")
+	return state, nil
+}
+
+// ResumeMiner starts the paused miners again
+func (e *Executor) ResumeMiner() error {
+	e.minerMu.Lock()
+	defer e.minerMu.Unlock()
+	if e.PauseStatus() == nil {
+		return fmt.Errorf("mining is not paused")
+	}
+	configs, err := e.loadConfigs()
+	if err != nil {
+		return fmt.Errorf("no saved config to resume: %w", err)
+	}
+
+	// StartMiners clears the pause once the miners run
+	if err := e.startMiners(configs); err != nil {
+		return err
+	}
+	fmt.Println("Mining resumed")
+	return nil
+}
+
+// CancelPause drops a pause without resuming, e.g. when the miner is
+// stopped for good
+func (e *Executor) CancelPause() {
+	os.Remove(e.pausePath())
+}
+
+// PauseStatus returns the current pause, or nil when mining isn't paused
+func (e *Executor) PauseStatus() *PauseState {
+	data, err := os.ReadFile(e.pausePath())
+	if err != nil {
+		return nil
+	}
+	var state PauseState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil
+	}
+	return &state
+}
+
+func (e *Executor) savePause(state *PauseState) error {
+	if err := os.MkdirAll(e.configPath, 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(e.pausePath(), data, 0644)
+}
+
+func (e *Executor) pausePath() string {
+	return filepath.Join(e.configPath, "pause.json")
+}
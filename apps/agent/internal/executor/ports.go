@@ -0,0 +1,97 @@
+package executor
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// defaultAPIPorts are the API ports miners traditionally get; they are
+// used when free so existing firewall rules and tools keep working
+var defaultAPIPorts = map[string]int{
+	"t-rex":        4067,
+	"lolminer":     4068,
+	"gminer":       4069,
+	"teamredminer": 4070,
+	"xmrig":        4071,
+	"nbminer":      4072,
+	"srbminer":     4073,
+	"bzminer":      4074,
+	"phoenixminer": 4075,
+	"claymore":     4076,
+	"cpuminer-opt": 4077,
+}
+
+// API ports are allocated from this range
+const (
+	apiPortFirst = 4067
+	apiPortLast  = 4199
+)
+
+// MinerAPI is the API endpoint of a miner started by the agent
+type MinerAPI struct {
+	Name string `json:"name"` // Canonical miner name (t-rex, teamredminer, ...)
+	PID  int    `json:"pid"`
+	Port int    `json:"port"`
+	Host string `json:"host,omitempty"` // Bind address, empty = 127.0.0.1
+	Key  string `json:"-"`              // Per-start API key (see apiauth.go)
+}
+
+// canonicalMinerName maps miner name aliases to one name
+func canonicalMinerName(name string) string {
+	name = strings.ToLower(name)
+	switch name {
+	case "trex":
+		return "t-rex"
+	case "trm":
+		return "teamredminer"
+	case "srbminer-multi":
+		return "srbminer"
+	case "phoenix":
+		return "phoenixminer"
+	case "cpuminer":
+		return "cpuminer-opt"
+	}
+	return name
+}
+
+// allocateAPIPort picks a free API port for a miner, preferring its
+// default one. taken holds ports handed out but possibly not bound yet.
+func allocateAPIPort(name string, taken map[int]bool) (int, error) {
+	if port, ok := defaultAPIPorts[canonicalMinerName(name)]; ok && !taken[port] && portFree(port) {
+		taken[port] = true
+		return port, nil
+	}
+	for port := apiPortFirst; port <= apiPortLast; port++ {
+		if !taken[port] && portFree(port) {
+			taken[port] = true
+			return port, nil
+		}
+	}
+	return 0, fmt.Errorf("no free miner API port in %d-%d", apiPortFirst, apiPortLast)
+}
+
+// portFree reports whether nothing listens on the local TCP port
+func portFree(port int) bool {
+	listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		return false
+	}
+	listener.Close()
+	return true
+}
+
+// MinerAPIs returns the API endpoints of the running miners
+func (e *Executor) MinerAPIs() []MinerAPI {
+	e.apiMu.Lock()
+	defer e.apiMu.Unlock()
+	return append([]MinerAPI(nil), e.apiPorts...)
+}
+
+// setMinerAPIs records the API endpoints of the running miners
+func (e *Executor) setMinerAPIs(apis []MinerAPI) {
+	e.apiMu.Lock()
+	defer e.apiMu.Unlock()
+	e.apiPorts = apis
+}
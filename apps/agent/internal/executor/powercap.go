@@ -0,0 +1,110 @@
+package executor
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// CapGPUPower lowers one GPU's power limit to percent of its current
+// limit (not below the card's minimum) and returns the new limit in watts.
+// vendor and busID are as reported by the collector.
+func (e *Executor) CapGPUPower(vendor, busID string, percent int) (int, error) {
+	current, minimum, err := e.gpuPowerLimit(vendor, busID)
+	if err != nil {
+		return 0, err
+	}
+	watts := current * percent / 100
+	if watts < minimum {
+		watts = minimum
+	}
+	if err := e.setGPUPowerLimit(vendor, busID, watts); err != nil {
+		return 0, err
+	}
+	return watts, nil
+}
+
+// gpuPowerLimit returns a GPU's current and minimum power limit in watts
+func (e *Executor) gpuPowerLimit(vendor, busID string) (int, int, error) {
+	switch strings.ToUpper(vendor) {
+	case "NVIDIA":
+		return e.nvidiaPowerLimit(busID)
+	case "AMD":
+		return e.amdPowerLimit(busID)
+	}
+	return 0, 0, fmt.Errorf("power cap not supported for %s GPUs", vendor)
+}
+
+// setGPUPowerLimit sets a GPU's power limit in watts
+func (e *Executor) setGPUPowerLimit(vendor, busID string, watts int) error {
+	switch strings.ToUpper(vendor) {
+	case "NVIDIA":
+		return e.runNvidiaSmi("-i", nvidiaBusID(busID), "-pl", strconv.Itoa(watts))
+	case "AMD":
+		hwmon, err := e.amdBusHwmon(busID)
+		if err != nil {
+			return err
+		}
+		return e.fs.WriteFile(filepath.Join(hwmon, "power1_cap"), []byte(strconv.Itoa(watts*1000000)), 0644)
+	}
+	return fmt.Errorf("power cap not supported for %s GPUs", vendor)
+}
+
+// nvidiaBusID adds the 8-digit PCI domain nvidia-smi wants
+func nvidiaBusID(busID string) string {
+	if parts := strings.SplitN(busID, ":", 2); len(parts) == 2 && len(parts[0]) == 4 {
+		return "0000" + busID
+	}
+	return busID
+}
+
+func (e *Executor) nvidiaPowerLimit(busID string) (int, int, error) {
+	output, err := e.run.Command("nvidia-smi", "-i", nvidiaBusID(busID),
+		"--query-gpu=power.limit,power.min_limit", "--format=csv,noheader,nounits").Output()
+	if err != nil {
+		return 0, 0, fmt.Errorf("nvidia-smi: %w", err)
+	}
+	parts := strings.Split(strings.TrimSpace(string(output)), ",")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("unexpected nvidia-smi output %q", strings.TrimSpace(string(output)))
+	}
+	current, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("power limit not adjustable")
+	}
+	minimum, _ := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	return int(current), int(minimum + 0.5), nil
+}
+
+// amdBusHwmon returns the hwmon directory of the AMD GPU at busID
+func (e *Executor) amdBusHwmon(busID string) (string, error) {
+	hwmonDir := filepath.Join("/sys/bus/pci/devices", busID, "hwmon")
+	hwmons, err := e.fs.ReadDir(hwmonDir)
+	if err != nil || len(hwmons) == 0 {
+		return "", fmt.Errorf("no hwmon for GPU %s", busID)
+	}
+	return filepath.Join(hwmonDir, hwmons[0].Name()), nil
+}
+
+func (e *Executor) amdPowerLimit(busID string) (int, int, error) {
+	hwmon, err := e.amdBusHwmon(busID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Caps are in microwatts
+	readInt := func(name string) int64 {
+		data, err := e.fs.ReadFile(filepath.Join(hwmon, name))
+		if err != nil {
+			return 0
+		}
+		v, _ := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+		return v
+	}
+	current := readInt("power1_cap")
+	if current <= 0 {
+		return 0, 0, fmt.Errorf("power cap not adjustable")
+	}
+	return int(current / 1000000), int((readInt("power1_cap_min") + 999999) / 1000000), nil
+}
@@ -0,0 +1,235 @@
+package executor
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PowerSaveStatus describes the idle power saving state
+type PowerSaveStatus struct {
+	Active   bool     `json:"active"`
+	Since    int64    `json:"since,omitempty"` // Unix seconds
+	GPUs     int      `json:"gpus"`            // GPUs dropped to minimum power
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// powerSaveState remembers what to restore when mining resumes
+type powerSaveState struct {
+	since        time.Time
+	nvidiaLimits map[int]string    // GPU index -> previous power limit (W)
+	amdCaps      map[string]string // hwmon power1_cap path -> previous value
+	amdLevels    map[string]string // power_dpm_force_performance_level path -> previous value
+	warnings     []string
+}
+
+// EnterPowerSave drops idle GPUs to their minimum power states: lowest
+// power limit, automatic fans, and the low-power P-state. Call it only
+// while no miner is running.
+func (e *Executor) EnterPowerSave() (*PowerSaveStatus, error) {
+	e.powerSaveMu.Lock()
+	defer e.powerSaveMu.Unlock()
+
+	if e.powerSave != nil {
+		return e.powerSave.status(), nil
+	}
+
+	state := &powerSaveState{
+		since:        time.Now(),
+		nvidiaLimits: map[int]string{},
+		amdCaps:      map[string]string{},
+		amdLevels:    map[string]string{},
+	}
+
+	if _, err := e.run.LookPath("nvidia-smi"); err == nil {
+		e.nvidiaPowerSave(state)
+	}
+	e.amdPowerSave(state)
+
+	if len(state.nvidiaLimits)+len(state.amdCaps)+len(state.amdLevels) == 0 {
+		return nil, fmt.Errorf("no GPUs could be switched to power saving: %s", strings.Join(state.warnings, "; "))
+	}
+
+	e.powerSave = state
+	fmt.Printf("Power saving enabled on %d GPU(s)\n", state.gpuCount())
+	return state.status(), nil
+}
+
+// ExitPowerSave restores the power limits and performance levels saved by
+// EnterPowerSave. Clock locks reset on entry must be reapplied with the OC.
+func (e *Executor) ExitPowerSave() error {
+	e.powerSaveMu.Lock()
+	defer e.powerSaveMu.Unlock()
+
+	state := e.powerSave
+	if state == nil {
+		return nil
+	}
+	e.powerSave = nil
+
+	var errors []string
+	for idx, limit := range state.nvidiaLimits {
+		if err := e.runNvidiaSmi("-i", strconv.Itoa(idx), "-pl", limit); err != nil {
+			errors = append(errors, fmt.Sprintf("gpu%d power limit: %v", idx, err))
+		}
+	}
+	for path, value := range state.amdCaps {
+		if err := e.fs.WriteFile(path, []byte(value), 0644); err != nil {
+			errors = append(errors, fmt.Sprintf("%s: %v", path, err))
+		}
+	}
+	for path, value := range state.amdLevels {
+		if err := e.fs.WriteFile(path, []byte(value), 0644); err != nil {
+			errors = append(errors, fmt.Sprintf("%s: %v", path, err))
+		}
+	}
+
+	fmt.Println("Power saving disabled")
+	if len(errors) > 0 {
+		return fmt.Errorf("failed to restore power settings: %s", strings.Join(errors, "; "))
+	}
+	return nil
+}
+
+// PowerSaveStatus returns the power saving state, or nil when inactive
+func (e *Executor) PowerSaveStatus() *PowerSaveStatus {
+	e.powerSaveMu.Lock()
+	defer e.powerSaveMu.Unlock()
+
+	if e.powerSave == nil {
+		return nil
+	}
+	return e.powerSave.status()
+}
+
+// Suspend suspends the system to RAM
+func (e *Executor) Suspend() error {
+	fmt.Println("Suspending system...")
+	cmd := e.run.Command("sudo", "systemctl", "suspend")
+	return cmd.Run()
+}
+
+// nvidiaPowerSave sets each NVIDIA GPU to its minimum power limit and
+// releases clock locks so the idle card falls back to P8
+func (e *Executor) nvidiaPowerSave(state *powerSaveState) {
+	cmd := e.run.Command("nvidia-smi",
+		"--query-gpu=index,power.limit,power.min_limit",
+		"--format=csv,noheader,nounits")
+	output, err := cmd.Output()
+	if err != nil {
+		state.warnings = append(state.warnings, fmt.Sprintf("nvidia-smi: %v", err))
+		return
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		parts := strings.Split(line, ",")
+		if len(parts) != 3 {
+			continue
+		}
+		idx, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+		if err != nil {
+			continue
+		}
+		current := strings.TrimSpace(parts[1])
+		minimum := strings.TrimSpace(parts[2])
+
+		gpu := strconv.Itoa(idx)
+		if err := e.runNvidiaSmi("-i", gpu, "-rgc"); err != nil {
+			state.warnings = append(state.warnings, fmt.Sprintf("gpu%d reset clocks: %v", idx, err))
+		}
+		if err := e.runNvidiaSmi("-i", gpu, "-rmc"); err != nil && e.debug {
+			fmt.Printf("GPU%d memory clock reset not supported: %v\n", idx, err)
+		}
+
+		if _, err := strconv.ParseFloat(minimum, 64); err != nil {
+			state.warnings = append(state.warnings, fmt.Sprintf("gpu%d: power limit not adjustable", idx))
+			continue
+		}
+		if err := e.runNvidiaSmi("-i", gpu, "-pl", minimum); err != nil {
+			state.warnings = append(state.warnings, fmt.Sprintf("gpu%d power limit: %v", idx, err))
+			continue
+		}
+		state.nvidiaLimits[idx] = current
+	}
+}
+
+// amdPowerSave sets each AMD GPU to its minimum power cap, the lowest DPM
+// level and automatic fan control
+func (e *Executor) amdPowerSave(state *powerSaveState) {
+	entries, err := e.fs.ReadDir("/sys/class/drm")
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), "card") || strings.Contains(entry.Name(), "-") {
+			continue
+		}
+		cardPath := filepath.Join("/sys/class/drm", entry.Name(), "device")
+		if vendor, _ := e.fs.ReadFile(filepath.Join(cardPath, "vendor")); strings.TrimSpace(string(vendor)) != "0x1002" {
+			continue
+		}
+
+		levelPath := filepath.Join(cardPath, "power_dpm_force_performance_level")
+		if previous, err := e.fs.ReadFile(levelPath); err == nil {
+			if err := e.fs.WriteFile(levelPath, []byte("low"), 0644); err != nil {
+				state.warnings = append(state.warnings, fmt.Sprintf("%s performance level: %v", entry.Name(), err))
+			} else {
+				state.amdLevels[levelPath] = strings.TrimSpace(string(previous))
+			}
+		}
+
+		hwmons, err := e.fs.ReadDir(filepath.Join(cardPath, "hwmon"))
+		if err != nil || len(hwmons) == 0 {
+			continue
+		}
+		hwmon := filepath.Join(cardPath, "hwmon", hwmons[0].Name())
+
+		// Automatic fan control
+		e.fs.WriteFile(filepath.Join(hwmon, "pwm1_enable"), []byte("2"), 0644)
+
+		capPath := filepath.Join(hwmon, "power1_cap")
+		previous, err := e.fs.ReadFile(capPath)
+		if err != nil {
+			continue
+		}
+		minimum, err := e.fs.ReadFile(filepath.Join(hwmon, "power1_cap_min"))
+		if err != nil || strings.TrimSpace(string(minimum)) == "0" {
+			continue // Some cards report no usable minimum
+		}
+		if err := e.fs.WriteFile(capPath, []byte(strings.TrimSpace(string(minimum))), 0644); err != nil {
+			state.warnings = append(state.warnings, fmt.Sprintf("%s power cap: %v", entry.Name(), err))
+			continue
+		}
+		state.amdCaps[capPath] = strings.TrimSpace(string(previous))
+	}
+}
+
+// gpuCount counts GPUs with at least one setting changed
+func (s *powerSaveState) gpuCount() int {
+	cards := map[string]bool{}
+	for path := range s.amdCaps {
+		cards[amdCardOf(path)] = true
+	}
+	for path := range s.amdLevels {
+		cards[amdCardOf(path)] = true
+	}
+	return len(s.nvidiaLimits) + len(cards)
+}
+
+func (s *powerSaveState) status() *PowerSaveStatus {
+	return &PowerSaveStatus{
+		Active:   true,
+		Since:    s.since.Unix(),
+		GPUs:     s.gpuCount(),
+		Warnings: s.warnings,
+	}
+}
+
+// amdCardOf returns the cardN name from a sysfs path below /sys/class/drm
+func amdCardOf(path string) string {
+	rel := strings.TrimPrefix(path, "/sys/class/drm/")
+	return strings.SplitN(rel, "/", 2)[0]
+}
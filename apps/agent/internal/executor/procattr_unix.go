@@ -0,0 +1,11 @@
+//go:build !windows
+
+package executor
+
+import "syscall"
+
+// minerProcAttr starts the miner in its own process group, so it can
+// outlive the agent
+func minerProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setpgid: true}
+}
@@ -0,0 +1,9 @@
+package executor
+
+import "syscall"
+
+// minerProcAttr starts the miner in its own process group, so it can
+// outlive the agent and console signals meant for the agent miss it
+func minerProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
@@ -0,0 +1,201 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Tariff is the electricity price, optionally by time of use, e.g. cheaper
+// at night
+type Tariff struct {
+	Currency string         `json:"currency,omitempty"` // e.g. "USD"; coin prices must use the same
+	Price    float64        `json:"price"`              // Per kWh outside all windows
+	Timezone string         `json:"timezone,omitempty"` // IANA name; empty = system time
+	Windows  []TariffWindow `json:"windows,omitempty"`
+}
+
+// TariffWindow is a price during a daily time range. The first matching
+// window wins.
+type TariffWindow struct {
+	Price  float64  `json:"price"`
+	Start  string   `json:"start"`            // "HH:MM"
+	End    string   `json:"end"`              // "HH:MM"; before Start wraps past midnight
+	Days   []string `json:"days,omitempty"`   // "mon".."sun" the window starts on; empty = every day
+	Months []int    `json:"months,omitempty"` // 1-12; empty = all year
+}
+
+// CoinPrice is what a coin earns, as provided by the server
+type CoinPrice struct {
+	Coin      string  `json:"coin,omitempty"`
+	Algorithm string  `json:"algorithm,omitempty"` // Fallback for miners without a coin
+	Price     float64 `json:"price"`               // Per coin, in the tariff currency
+	Reward    float64 `json:"reward"`              // Coins per day per H/s
+	Updated   int64   `json:"updated,omitempty"`   // Unix seconds, set by the server
+}
+
+func (t *Tariff) validate() error {
+	if t.Price < 0 {
+		return fmt.Errorf("price must not be negative")
+	}
+	if _, err := loadLocation(t.Timezone); err != nil {
+		return err
+	}
+	for i, w := range t.Windows {
+		if w.Price < 0 {
+			return fmt.Errorf("window %d: price must not be negative", i)
+		}
+		if err := validateWindow(w.Start, w.End, w.Days, w.Months); err != nil {
+			return fmt.Errorf("window %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// PriceAt returns the price per kWh at a time
+func (t *Tariff) PriceAt(at time.Time) float64 {
+	loc, err := loadLocation(t.Timezone)
+	if err != nil {
+		return t.Price
+	}
+	at = at.In(loc)
+	for _, w := range t.Windows {
+		if inWindow(at, w.Start, w.End, w.Days, w.Months) {
+			return w.Price
+		}
+	}
+	return t.Price
+}
+
+// SetTariff validates and stores the electricity tariff; nil removes it
+func (e *Executor) SetTariff(tariff *Tariff) error {
+	path := filepath.Join(e.configPath, "tariff.json")
+	if tariff == nil {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	if err := tariff.validate(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(e.configPath, 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(tariff)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to save tariff: %w", err)
+	}
+	return nil
+}
+
+// Tariff returns the stored tariff, or nil if none is set
+func (e *Executor) Tariff() (*Tariff, error) {
+	data, err := os.ReadFile(filepath.Join(e.configPath, "tariff.json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var tariff Tariff
+	if err := json.Unmarshal(data, &tariff); err != nil {
+		return nil, fmt.Errorf("invalid tariff: %w", err)
+	}
+	return &tariff, nil
+}
+
+// SyncCoinPrices stores coin prices pushed by the server. With replace set
+// the stored prices are replaced, otherwise prices are added or updated by
+// coin (or algorithm).
+func (e *Executor) SyncCoinPrices(prices []CoinPrice, replace bool) (int, error) {
+	for _, price := range prices {
+		if price.Coin == "" && price.Algorithm == "" {
+			return 0, fmt.Errorf("coin or algorithm required")
+		}
+		if price.Price < 0 || price.Reward < 0 {
+			return 0, fmt.Errorf("%s: price and reward must not be negative", price.key())
+		}
+	}
+
+	stored := map[string]CoinPrice{}
+	if !replace {
+		existing, err := e.CoinPrices()
+		if err != nil {
+			return 0, err
+		}
+		for _, price := range existing {
+			stored[price.key()] = price
+		}
+	}
+	for _, price := range prices {
+		stored[price.key()] = price
+	}
+
+	list := make([]CoinPrice, 0, len(stored))
+	for _, price := range stored {
+		list = append(list, price)
+	}
+	if err := os.MkdirAll(e.configPath, 0755); err != nil {
+		return 0, err
+	}
+	data, err := json.Marshal(list)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.WriteFile(filepath.Join(e.configPath, "coin_prices.json"), data, 0644); err != nil {
+		return 0, fmt.Errorf("failed to save coin prices: %w", err)
+	}
+	return len(list), nil
+}
+
+// CoinPrices returns the stored coin prices
+func (e *Executor) CoinPrices() ([]CoinPrice, error) {
+	data, err := os.ReadFile(filepath.Join(e.configPath, "coin_prices.json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var prices []CoinPrice
+	if err := json.Unmarshal(data, &prices); err != nil {
+		return nil, fmt.Errorf("invalid coin prices: %w", err)
+	}
+	return prices, nil
+}
+
+// CoinPriceFor returns the price of a coin, or of the algorithm when the
+// coin has none
+func (e *Executor) CoinPriceFor(coin, algorithm string) (*CoinPrice, error) {
+	prices, err := e.CoinPrices()
+	if err != nil {
+		return nil, err
+	}
+	var byAlgorithm *CoinPrice
+	for i := range prices {
+		if coin != "" && strings.EqualFold(prices[i].Coin, coin) {
+			return &prices[i], nil
+		}
+		if prices[i].Coin == "" && algorithm != "" && strings.EqualFold(prices[i].Algorithm, algorithm) {
+			byAlgorithm = &prices[i]
+		}
+	}
+	return byAlgorithm, nil
+}
+
+func (p *CoinPrice) key() string {
+	if p.Coin != "" {
+		return strings.ToUpper(p.Coin)
+	}
+	return "algo:" + strings.ToLower(p.Algorithm)
+}
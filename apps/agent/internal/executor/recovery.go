@@ -0,0 +1,103 @@
+package executor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MinerExited returns the PID of a miner the agent started that has exited
+// without being stopped, or 0 while every miner runs (or none was started)
+func (e *Executor) MinerExited() int {
+	pids := []int{}
+	e.procMu.Lock()
+	if e.minerPID > 0 {
+		pids = append(pids, e.minerPID)
+	}
+	for _, instance := range e.extraMiners {
+		pids = append(pids, instance.pid)
+	}
+	e.procMu.Unlock()
+	for _, pid := range pids {
+		if !processRunning(pid) {
+			return pid
+		}
+	}
+	return 0
+}
+
+// processRunning is processAlive for our own children too: an exited miner
+// stays a zombie, which signals fine, until it is reaped
+func processRunning(pid int) bool {
+	if !processAlive(pid) {
+		return false
+	}
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return true // No procfs; trust the signal
+	}
+	// The state follows the parenthesized command name
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	return len(fields) == 0 || fields[0] != "Z"
+}
+
+// ResetOC puts every GPU back at its stock clocks, power limit and
+// automatic fans, e.g. to rule out an unstable overclock
+func (e *Executor) ResetOC() error {
+	var errors []string
+
+	// NVIDIA: release clock locks and restore the default power limit.
+	// Offsets set through nvidia-settings last until the driver reloads.
+	cmd := e.run.Command("nvidia-smi", "--query-gpu=index,power.default_limit", "--format=csv,noheader,nounits")
+	if output, err := cmd.Output(); err == nil {
+		for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+			parts := strings.Split(line, ",")
+			if len(parts) != 2 {
+				continue
+			}
+			gpu := strings.TrimSpace(parts[0])
+			if err := e.runNvidiaSmi("-i", gpu, "-rgc"); err != nil {
+				errors = append(errors, fmt.Sprintf("gpu%s reset clocks: %v", gpu, err))
+			}
+			e.runNvidiaSmi("-i", gpu, "-rmc") // Not supported by every card
+			if limit := strings.TrimSpace(parts[1]); limit != "" && limit != "[N/A]" {
+				if err := e.runNvidiaSmi("-i", gpu, "-pl", limit); err != nil {
+					errors = append(errors, fmt.Sprintf("gpu%s power limit: %v", gpu, err))
+				}
+			}
+		}
+	}
+
+	// AMD: restore the default overdrive table, performance level, power
+	// cap and fan control
+	for _, idx := range e.amdCards() {
+		cardPath := fmt.Sprintf("/sys/class/drm/card%d/device", idx)
+		odPath := filepath.Join(cardPath, "pp_od_clk_voltage")
+		if _, err := e.fs.ReadFile(odPath); err == nil {
+			if err := e.fs.WriteFile(odPath, []byte("r"), 0644); err != nil {
+				errors = append(errors, fmt.Sprintf("gpu%d reset clocks: %v", idx, err))
+			} else {
+				e.fs.WriteFile(odPath, []byte("c"), 0644)
+			}
+		}
+		e.fs.WriteFile(filepath.Join(cardPath, "power_dpm_force_performance_level"), []byte("auto"), 0644)
+
+		hwmons, err := e.fs.ReadDir(filepath.Join(cardPath, "hwmon"))
+		if err != nil || len(hwmons) == 0 {
+			continue
+		}
+		hwmon := filepath.Join(cardPath, "hwmon", hwmons[0].Name())
+		e.fs.WriteFile(filepath.Join(hwmon, "pwm1_enable"), []byte("2"), 0644)
+		if def, err := e.fs.ReadFile(filepath.Join(hwmon, "power1_cap_default")); err == nil {
+			if err := e.fs.WriteFile(filepath.Join(hwmon, "power1_cap"), []byte(strings.TrimSpace(string(def))), 0644); err != nil {
+				errors = append(errors, fmt.Sprintf("gpu%d power cap: %v", idx, err))
+			}
+		}
+	}
+
+	if len(errors) > 0 {
+		return fmt.Errorf("%s", strings.Join(errors, "; "))
+	}
+	return nil
+}
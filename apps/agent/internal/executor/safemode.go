@@ -0,0 +1,21 @@
+package executor
+
+import "fmt"
+
+// SetSafeMode holds the rig at stock settings: while on, miner starts and
+// OC changes are refused, whoever asks for them
+func (e *Executor) SetSafeMode(on bool) {
+	e.procMu.Lock()
+	e.safeMode = on
+	e.procMu.Unlock()
+}
+
+// checkSafeMode returns an error while safe mode is on
+func (e *Executor) checkSafeMode() error {
+	e.procMu.Lock()
+	defer e.procMu.Unlock()
+	if e.safeMode {
+		return fmt.Errorf("rig is in safe mode; reset recovery to mine again")
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package executor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// coinAlgorithms maps coins to the algorithm used to mine them
+var coinAlgorithms = map[string]string{
+	"ETC":   "etchash",
+	"ETHW":  "ethash",
+	"OCTA":  "ethash",
+	"RVN":   "kawpow",
+	"CLORE": "kawpow",
+	"NEOX":  "kawpow",
+	"ERG":   "autolykos2",
+	"KAS":   "kheavyhash",
+	"FIRO":  "firopow",
+	"BEAM":  "beamhash",
+	"FLUX":  "zelhash",
+	"XMR":   "randomx",
+	"RTM":   "ghostrider",
+}
+
+// minerRanking lists the miners to use per algorithm and GPU vendor, best
+// first. Only miners buildMinerCommand knows how to launch are listed.
+var minerRanking = map[string]map[string][]string{
+	"ethash": {
+		"nvidia": {"t-rex", "lolminer", "gminer", "nbminer", "phoenixminer"},
+		"amd":    {"teamredminer", "lolminer", "gminer", "nbminer", "phoenixminer"},
+	},
+	"etchash": {
+		"nvidia": {"t-rex", "lolminer", "gminer", "nbminer", "phoenixminer"},
+		"amd":    {"teamredminer", "lolminer", "gminer", "nbminer", "phoenixminer"},
+	},
+	"kawpow": {
+		"nvidia": {"t-rex", "gminer", "nbminer"},
+		"amd":    {"teamredminer", "srbminer", "gminer", "nbminer"},
+	},
+	"autolykos2": {
+		"nvidia": {"t-rex", "lolminer", "gminer", "nbminer"},
+		"amd":    {"teamredminer", "lolminer", "srbminer", "nbminer"},
+	},
+	"kheavyhash": {
+		"nvidia": {"lolminer", "gminer"},
+		"amd":    {"lolminer", "teamredminer", "srbminer"},
+	},
+	"firopow": {
+		"nvidia": {"t-rex", "gminer"},
+		"amd":    {"teamredminer", "srbminer", "gminer"},
+	},
+	"beamhash": {
+		"nvidia": {"lolminer", "gminer"},
+		"amd":    {"lolminer", "gminer"},
+	},
+	"zelhash": {
+		"nvidia": {"lolminer", "gminer"},
+		"amd":    {"lolminer"},
+	},
+
+	// CPU algorithms
+	"randomx": {
+		"cpu": {"xmrig", "srbminer"},
+	},
+	"ghostrider": {
+		"cpu": {"xmrig", "cpuminer-opt", "srbminer"},
+	},
+	"yespower": {
+		"cpu": {"cpuminer-opt", "srbminer"},
+	},
+	"yescrypt": {
+		"cpu": {"cpuminer-opt"},
+	},
+	"yescryptr16": {
+		"cpu": {"cpuminer-opt"},
+	},
+}
+
+// AlgorithmForCoin returns the algorithm used to mine a coin, or ""
+func AlgorithmForCoin(coin string) string {
+	return coinAlgorithms[strings.ToUpper(coin)]
+}
+
+// CPUAlgorithm reports whether an algorithm is mined on the CPU
+func CPUAlgorithm(algorithm string) bool {
+	_, ok := minerRanking[strings.ToLower(algorithm)]["cpu"]
+	return ok
+}
+
+// Algorithms lists the GPU algorithms a miner is known for
+func Algorithms() []string {
+	var algorithms []string
+	for algorithm := range minerRanking {
+		if !CPUAlgorithm(algorithm) {
+			algorithms = append(algorithms, algorithm)
+		}
+	}
+	sort.Strings(algorithms)
+	return algorithms
+}
+
+// SelectMiner picks the miner for an algorithm on one GPU vendor ("nvidia"
+// or "amd", or "cpu" for CPU algorithms): the highest ranked installed
+// miner, or the recommended (top ranked) one with installed=false when
+// none of them is installed
+func (e *Executor) SelectMiner(algorithm, vendor string) (name string, installed bool, err error) {
+	ranked := minerRanking[strings.ToLower(algorithm)][vendor]
+	if len(ranked) == 0 {
+		return "", false, fmt.Errorf("no known miner for %s on %s GPUs", algorithm, vendor)
+	}
+
+	for _, miner := range ranked {
+		if e.findMiner(miner) != "" {
+			return miner, true, nil
+		}
+	}
+	return ranked[0], false, nil
+}
@@ -0,0 +1,58 @@
+package executor
+
+import (
+	"fmt"
+	"time"
+)
+
+// Stagger spaces out operations that raise the rig's power draw at once.
+// On dense racks several miners spinning up, or every GPU jumping to its
+// new power limit, can trip a breaker with the inrush.
+type Stagger struct {
+	Miners time.Duration // Between starting miner instances
+	OC     time.Duration // Between GPUs when applying OC to all of them
+}
+
+// StageProgress reports a step of a staggered operation
+type StageProgress struct {
+	Operation string `json:"operation"` // "miner_start" or "oc"
+	Step      int    `json:"step"`      // 1-based
+	Total     int    `json:"total"`
+	Target    string `json:"target"` // Miner name or GPU, e.g. "nvidia gpu2"
+}
+
+// SetStagger sets the delays between staggered steps and where to report
+// them; progress may be nil
+func (e *Executor) SetStagger(stagger Stagger, progress func(StageProgress)) {
+	e.staggerMu.Lock()
+	defer e.staggerMu.Unlock()
+	e.stagger = stagger
+	e.stageProgress = progress
+}
+
+func (e *Executor) staggerDelays() Stagger {
+	e.staggerMu.Lock()
+	defer e.staggerMu.Unlock()
+	return e.stagger
+}
+
+// staggerStep waits out the delay before every step but the first and
+// reports it. Operations with a single step or no delay aren't reported.
+func (e *Executor) staggerStep(operation string, step, total int, target string, delay time.Duration) {
+	if delay <= 0 || total < 2 {
+		return
+	}
+	if step > 0 {
+		time.Sleep(delay)
+	}
+
+	e.staggerMu.Lock()
+	progress := e.stageProgress
+	e.staggerMu.Unlock()
+	if e.debug {
+		fmt.Printf("Staggered %s %d/%d: %s\n", operation, step+1, total, target)
+	}
+	if progress != nil {
+		progress(StageProgress{Operation: operation, Step: step + 1, Total: total, Target: target})
+	}
+}
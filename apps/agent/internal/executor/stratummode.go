@@ -0,0 +1,197 @@
+package executor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Stratum protocol variants. Ethash-family and some newer pools (Kaspa,
+// Alephium, Iron Fish) speak one of several dialects, and every miner
+// selects it differently: by URL scheme, by flag or not at all.
+const (
+	StratumPlain = "stratum"     // Plain stratum, the miner's default
+	StratumProxy = "ethproxy"    // eth-proxy (stratum0)
+	StratumEthV1 = "ethstratum1" // EthereumStratum/1.0.0, as used by NiceHash
+	StratumEthV2 = "ethstratum2" // EthereumStratum/2.0.0
+)
+
+// stratumSchemes maps the pool URL scheme prefixes to a variant
+var stratumSchemes = map[string]string{
+	"stratum":  StratumPlain,
+	"stratum1": StratumEthV1,
+	"stratum2": StratumEthV2,
+	"ethproxy": StratumProxy,
+	"nicehash": StratumEthV1,
+	"ethnh":    StratumEthV1, // NBMiner's name
+}
+
+// poolEndpoint is a pool URL split into its parts
+type poolEndpoint struct {
+	mode     string // One of the Stratum* variants
+	tls      bool
+	hostPort string
+}
+
+// parseStratumPool splits a pool URL like "stratum2+ssl://host:port".
+// Pools without a scheme, or with one that isn't a stratum variant, are
+// plain stratum and passed to the miner as they are.
+func parseStratumPool(pool string) poolEndpoint {
+	plain := poolEndpoint{mode: StratumPlain, hostPort: pool}
+	scheme, hostPort, found := strings.Cut(pool, "://")
+	if !found {
+		return plain
+	}
+	endpoint := poolEndpoint{hostPort: hostPort}
+	variant, transport, _ := strings.Cut(strings.ToLower(scheme), "+")
+	switch transport {
+	case "", "tcp":
+	case "ssl", "tls":
+		endpoint.tls = true
+	default:
+		return plain
+	}
+	// "ssl://" and "tcp://" alone name only the transport
+	switch variant {
+	case "ssl", "tls":
+		endpoint.tls = true
+		variant = "stratum"
+	case "tcp":
+		variant = "stratum"
+	}
+	mode, ok := stratumSchemes[variant]
+	if !ok {
+		return plain
+	}
+	endpoint.mode = mode
+	return endpoint
+}
+
+// stratumMode resolves the variant of a config: StratumMode where set,
+// otherwise the pool URL scheme
+func stratumMode(config *MinerConfig) (poolEndpoint, error) {
+	endpoint := parseStratumPool(config.Pool)
+	switch config.StratumMode {
+	case "":
+	case StratumPlain, StratumProxy, StratumEthV1, StratumEthV2:
+		endpoint.mode = config.StratumMode
+	default:
+		return endpoint, fmt.Errorf("unknown stratum mode %q", config.StratumMode)
+	}
+	return endpoint, nil
+}
+
+// withStratumMode returns a copy of config with the pool and flags each
+// miner needs for the stratum variant. Plain stratum pools are passed on
+// as they are.
+func withStratumMode(config *MinerConfig) (*MinerConfig, error) {
+	endpoint, err := stratumMode(config)
+	if err != nil {
+		return nil, err
+	}
+	if endpoint.mode == StratumPlain {
+		return config, nil
+	}
+
+	name := canonicalMinerName(config.Name)
+	unsupported := fmt.Errorf("%s doesn't support the %s stratum mode", config.Name, endpoint.mode)
+	scheme := func(prefix string) string {
+		if endpoint.tls {
+			return prefix + "+ssl://" + endpoint.hostPort
+		}
+		return prefix + "+tcp://" + endpoint.hostPort
+	}
+	bare := func() string {
+		if endpoint.tls {
+			return "ssl://" + endpoint.hostPort
+		}
+		return endpoint.hostPort
+	}
+
+	var pool string
+	var args []string
+	switch name {
+	case "t-rex":
+		// T-Rex picks the protocol from the scheme
+		switch endpoint.mode {
+		case StratumEthV1:
+			pool = scheme("stratum2")
+		default:
+			return nil, unsupported
+		}
+
+	case "lolminer":
+		modes := map[string]string{StratumProxy: "ETHPROXY", StratumEthV1: "ETHV1"}
+		if modes[endpoint.mode] == "" {
+			return nil, unsupported
+		}
+		pool = endpoint.hostPort
+		args = append(args, "--ethstratum", modes[endpoint.mode])
+		if endpoint.tls {
+			args = append(args, "--tls", "on")
+		}
+
+	case "gminer":
+		modes := map[string]string{StratumProxy: "proxy", StratumEthV1: "stratum"}
+		if modes[endpoint.mode] == "" {
+			return nil, unsupported
+		}
+		pool = endpoint.hostPort
+		args = append(args, "--proto", modes[endpoint.mode])
+		if endpoint.tls {
+			args = append(args, "--ssl", "1")
+		}
+
+	case "teamredminer":
+		modes := map[string]string{StratumProxy: "ethproxy", StratumEthV1: "nicehash"}
+		if modes[endpoint.mode] == "" {
+			return nil, unsupported
+		}
+		pool = scheme("stratum")
+		args = append(args, "--eth_stratum_mode="+modes[endpoint.mode])
+
+	case "nbminer":
+		// NBMiner picks the protocol from the scheme
+		schemes := map[string]string{StratumProxy: "ethproxy", StratumEthV1: "ethnh"}
+		if schemes[endpoint.mode] == "" {
+			return nil, unsupported
+		}
+		pool = scheme(schemes[endpoint.mode])
+
+	case "srbminer":
+		modes := map[string]string{StratumProxy: "0", StratumEthV1: "1", StratumEthV2: "2"}
+		pool = endpoint.hostPort
+		args = append(args, "--esm", modes[endpoint.mode])
+		if endpoint.tls {
+			args = append(args, "--tls", "true")
+		}
+
+	case "phoenixminer":
+		modes := map[string]string{StratumProxy: "2", StratumEthV1: "4", StratumEthV2: "5"}
+		pool = bare()
+		args = append(args, "-proto", modes[endpoint.mode])
+
+	case "claymore":
+		modes := map[string]string{StratumProxy: "0", StratumEthV1: "3"}
+		if modes[endpoint.mode] == "" {
+			return nil, unsupported
+		}
+		pool = bare()
+		args = append(args, "-esm", modes[endpoint.mode])
+
+	case "xmrig":
+		// NiceHash's CryptoNight/RandomX pools need fixed nonce ranges
+		if endpoint.mode != StratumEthV1 {
+			return nil, unsupported
+		}
+		pool = scheme("stratum")
+		args = append(args, "--nicehash")
+
+	default:
+		return nil, unsupported
+	}
+
+	adjusted := *config
+	adjusted.Pool = pool
+	adjusted.ExtraArgs = append(args, config.ExtraArgs...)
+	return &adjusted, nil
+}
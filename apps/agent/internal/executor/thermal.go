@@ -0,0 +1,263 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ThermalTarget keeps GPU memory below a temperature by lowering the power
+// limit step by step while it runs hot and raising it again once it has
+// cooled, rather than stopping the miner
+type ThermalTarget struct {
+	MemTemp    int         `json:"memTemp"`              // °C; 0 = off
+	PerGPU     map[int]int `json:"perGpu,omitempty"`     // Target by GPU index, overriding MemTemp (0 = off for that GPU)
+	Hysteresis int         `json:"hysteresis,omitempty"` // °C below the target before power comes back (default 4)
+	Step       int         `json:"step,omitempty"`       // Percent of the original limit per adjustment (default 5)
+	MinPercent int         `json:"minPercent,omitempty"` // Lowest limit as percent of the original (default 60)
+}
+
+// ThermalReading is one GPU's memory temperature, as collected
+type ThermalReading struct {
+	Index   int
+	Vendor  string
+	BusID   string
+	MemTemp *int
+}
+
+// ThermalAction is a power limit change made by the controller
+type ThermalAction struct {
+	GPUIndex int    `json:"gpuIndex"`
+	BusID    string `json:"busId"`
+	MemTemp  int    `json:"memTemp,omitempty"`
+	Target   int    `json:"target,omitempty"`
+	Percent  int    `json:"percent"` // Of the original limit
+	Watts    int    `json:"watts"`
+	Restored bool   `json:"restored,omitempty"` // Back at the original limit
+	Error    string `json:"error,omitempty"`
+}
+
+// thermalState is a GPU the controller has throttled
+type thermalState struct {
+	index   int
+	vendor  string
+	base    int // Power limit before throttling, W
+	set     int // Limit last set by the controller, W
+	percent int
+}
+
+func (t *ThermalTarget) validate() error {
+	check := func(name string, temp int) error {
+		if temp != 0 && (temp < 50 || temp > 120) {
+			return fmt.Errorf("%s must be between 50 and 120 °C", name)
+		}
+		return nil
+	}
+	if err := check("memTemp", t.MemTemp); err != nil {
+		return err
+	}
+	for index, temp := range t.PerGPU {
+		if err := check(fmt.Sprintf("perGpu[%d]", index), temp); err != nil {
+			return err
+		}
+	}
+	if t.Hysteresis < 0 || t.Hysteresis > 20 {
+		return fmt.Errorf("hysteresis must be between 0 and 20 °C")
+	}
+	if t.Step < 0 || t.Step > 25 {
+		return fmt.Errorf("step must be between 0 and 25 percent")
+	}
+	if t.MinPercent != 0 && (t.MinPercent < 30 || t.MinPercent > 100) {
+		return fmt.Errorf("minPercent must be between 30 and 100")
+	}
+	return nil
+}
+
+// withDefaults fills in the unset tuning values
+func (t ThermalTarget) withDefaults() ThermalTarget {
+	if t.Hysteresis == 0 {
+		t.Hysteresis = 4
+	}
+	if t.Step == 0 {
+		t.Step = 5
+	}
+	if t.MinPercent == 0 {
+		t.MinPercent = 60
+	}
+	return t
+}
+
+// target returns the memory temperature target of a GPU, 0 = none
+func (t *ThermalTarget) target(index int) int {
+	if temp, ok := t.PerGPU[index]; ok {
+		return temp
+	}
+	return t.MemTemp
+}
+
+// SetThermalTarget validates and stores the memory temperature target;
+// nil or no targets turns the controller off and restores throttled GPUs
+func (e *Executor) SetThermalTarget(target *ThermalTarget) ([]ThermalAction, error) {
+	path := filepath.Join(e.configPath, "thermal.json")
+	if target == nil || (target.MemTemp == 0 && len(target.PerGPU) == 0) {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		return e.restoreThermal(nil), nil
+	}
+
+	if err := target.validate(); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(e.configPath, 0755); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(target)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to save thermal target: %w", err)
+	}
+
+	// GPUs no longer targeted get their power back
+	return e.restoreThermal(target), nil
+}
+
+// ThermalTarget returns the stored target, or nil if none is set
+func (e *Executor) ThermalTarget() (*ThermalTarget, error) {
+	data, err := os.ReadFile(filepath.Join(e.configPath, "thermal.json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var target ThermalTarget
+	if err := json.Unmarshal(data, &target); err != nil {
+		return nil, fmt.Errorf("invalid thermal target: %w", err)
+	}
+	return &target, nil
+}
+
+// ControlMemTemp runs one step of the controller: each GPU whose memory
+// is above its target loses Step percent of its original power limit (two
+// steps when 4 °C or more over), down to MinPercent; one that has cooled
+// Hysteresis °C below the target gets a step back. Someone else changing
+// a throttled GPU's limit, e.g. an OC profile, makes that the new original.
+func (e *Executor) ControlMemTemp(target *ThermalTarget, readings []ThermalReading) []ThermalAction {
+	e.thermalMu.Lock()
+	defer e.thermalMu.Unlock()
+	if e.thermal == nil {
+		e.thermal = map[string]*thermalState{}
+	}
+	t := target.withDefaults()
+
+	var actions []ThermalAction
+	for _, gpu := range readings {
+		goal := target.target(gpu.Index)
+		if gpu.MemTemp == nil || goal == 0 {
+			continue
+		}
+		temp := *gpu.MemTemp
+		state := e.thermal[gpu.BusID]
+
+		var step int
+		switch {
+		case temp >= goal+4:
+			step = -2 * t.Step
+		case temp > goal:
+			step = -t.Step
+		case temp <= goal-t.Hysteresis && state != nil:
+			step = t.Step
+		default:
+			continue
+		}
+
+		action := ThermalAction{GPUIndex: gpu.Index, BusID: gpu.BusID, MemTemp: temp, Target: goal}
+		current, minimum, err := e.gpuPowerLimit(gpu.Vendor, gpu.BusID)
+		if err != nil {
+			action.Error = err.Error()
+			actions = append(actions, action)
+			continue
+		}
+		if state == nil || current != state.set {
+			if step > 0 {
+				delete(e.thermal, gpu.BusID) // Reset by someone else; nothing to give back
+				continue
+			}
+			state = &thermalState{index: gpu.Index, vendor: gpu.Vendor, base: current, set: current, percent: 100}
+		}
+
+		percent := state.percent + step
+		if percent < t.MinPercent {
+			percent = t.MinPercent
+		}
+		if percent > 100 {
+			percent = 100
+		}
+		if percent == state.percent {
+			continue // Already at the floor
+		}
+		action.Percent = percent
+
+		watts := state.base * percent / 100
+		if watts < minimum {
+			watts = minimum
+		}
+		action.Watts = watts
+		if err := e.setGPUPowerLimit(gpu.Vendor, gpu.BusID, watts); err != nil {
+			action.Error = err.Error()
+			actions = append(actions, action)
+			continue
+		}
+
+		state.set, state.percent = watts, percent
+		if percent == 100 {
+			action.Restored = true
+			delete(e.thermal, gpu.BusID)
+		} else {
+			e.thermal[gpu.BusID] = state
+		}
+		actions = append(actions, action)
+	}
+	return actions
+}
+
+// restoreThermal puts throttled GPUs the target no longer covers back at
+// their original power limit
+func (e *Executor) restoreThermal(target *ThermalTarget) []ThermalAction {
+	e.thermalMu.Lock()
+	defer e.thermalMu.Unlock()
+
+	var actions []ThermalAction
+	for busID, state := range e.thermal {
+		if target != nil && target.target(state.index) != 0 {
+			continue
+		}
+		action := ThermalAction{GPUIndex: state.index, BusID: busID, Percent: 100, Watts: state.base, Restored: true}
+		if err := e.setGPUPowerLimit(state.vendor, busID, state.base); err != nil {
+			action.Error = err.Error()
+		}
+		delete(e.thermal, busID)
+		actions = append(actions, action)
+	}
+	return actions
+}
+
+// ThermalStatus lists the GPUs the controller is holding below their
+// original power limit
+func (e *Executor) ThermalStatus() []ThermalAction {
+	e.thermalMu.Lock()
+	defer e.thermalMu.Unlock()
+
+	var status []ThermalAction
+	for busID, state := range e.thermal {
+		status = append(status, ThermalAction{GPUIndex: state.index, BusID: busID, Percent: state.percent, Watts: state.set})
+	}
+	sort.Slice(status, func(i, j int) bool { return status[i].GPUIndex < status[j].GPUIndex })
+	return status
+}
@@ -0,0 +1,233 @@
+package executor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bloxos/agent/internal/installer"
+)
+
+// MinerValidation is the result of a dry-run miner start
+type MinerValidation struct {
+	Valid    bool     `json:"valid"`
+	Binary   string   `json:"binary,omitempty"`
+	Command  []string `json:"command,omitempty"` // Command line with the wallet masked
+	Errors   []string `json:"errors,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// minerOptions lists the miners each tuning option is passed to
+var minerOptions = []struct {
+	option string
+	miners []string
+	set    func(*MinerConfig) bool
+}{
+	{"lhrTune", []string{"t-rex", "gminer", "nbminer"}, func(c *MinerConfig) bool { return c.LHRTune != "" }},
+	{"lhrAutotune", []string{"t-rex"}, func(c *MinerConfig) bool { return c.LHRAutotune != "" }},
+	{"lhrLowPower", []string{"t-rex"}, func(c *MinerConfig) bool { return c.LHRLowPower }},
+	{"lhrAlgo", []string{"t-rex"}, func(c *MinerConfig) bool { return c.LHRAlgo != "" }},
+	{"lhrMode", []string{"nbminer"}, func(c *MinerConfig) bool { return c.LHRMode > 0 }},
+	{"zombieMode", []string{"lolminer", "teamredminer"}, func(c *MinerConfig) bool { return c.ZombieMode }},
+	{"zombieTune", []string{"lolminer"}, func(c *MinerConfig) bool { return c.ZombieTune != "" }},
+	{"fourGAllocSize", []string{"lolminer", "teamredminer"}, func(c *MinerConfig) bool { return c.FourGAllocSize > 0 }},
+	{"cpuThreads", cpuMiners, func(c *MinerConfig) bool { return c.CPUThreads > 0 }},
+	{"cpuAffinity", cpuMiners, func(c *MinerConfig) bool { return c.CPUAffinity != "" }},
+}
+
+// dualArgs are the extra arguments enabling a secondary algorithm and the
+// ones that must come with them
+var dualArgs = map[string]map[string][]string{
+	"t-rex": {
+		"--dual-algo": {"--url2", "--user2"},
+		"--lhr-algo":  {"--url2", "--user2"},
+	},
+	"lolminer": {
+		"--dualmode": {"--dualpool", "--dualuser"},
+	},
+	"gminer": {
+		"--dalgo": {"--dserver", "--duser"},
+	},
+}
+
+// managedArgs are the flags the agent sets itself; repeating them in the
+// extra arguments conflicts with the API port or pool the agent tracks
+var managedArgs = map[string][]string{
+	"t-rex":        {"--api-bind-http", "--api-key", "-o", "--url"},
+	"lolminer":     {"--apiport", "--pool"},
+	"gminer":       {"--api", "--server"},
+	"teamredminer": {"--api_listen", "-o"},
+	"xmrig":        {"--http-port", "--http-access-token", "-o", "--url"},
+	"nbminer":      {"--api", "-o"},
+	"srbminer":     {"--api-port", "--pool"},
+	"phoenixminer": {"-cdmport", "-cdmpass", "-pool"},
+	"claymore":     {"-mport", "-mpsw", "-epool"},
+	"cpuminer-opt": {"-b", "-o"},
+}
+
+// ValidateMinerConfig runs every check of a miner start and renders the
+// command line that would be executed, without launching anything
+func (e *Executor) ValidateMinerConfig(config *MinerConfig) *MinerValidation {
+	result := &MinerValidation{}
+	check := *config
+	name := canonicalMinerName(check.Name)
+
+	if check.Preset != "" {
+		if err := e.ResolveCoinPreset(&check); err != nil {
+			result.Errors = append(result.Errors, err.Error())
+		}
+	}
+	// NiceHash fills the pool and checks its own wallet format
+	if check.NiceHash {
+		if err := ResolveNiceHash(&check); err != nil {
+			result.Errors = append(result.Errors, err.Error())
+		}
+	}
+	// A config file carries its own pool and algorithm
+	if check.Algorithm == "" && check.ConfigFile == "" {
+		result.Errors = append(result.Errors, "algorithm is required")
+	}
+	if check.Pool == "" && check.ConfigFile == "" {
+		result.Errors = append(result.Errors, "pool is required")
+	}
+	if !check.NiceHash && (check.ConfigFile == "" || check.Wallet != "") {
+		if err := ValidateWallet(check.Coin, check.Wallet); err != nil {
+			result.Errors = append(result.Errors, err.Error())
+		}
+	}
+	if err := installer.CheckCompatibility(check.Name); err != nil {
+		result.Errors = append(result.Errors, err.Error())
+	}
+	switch check.GPUVendor {
+	case "", "nvidia", "amd":
+	case "cpu":
+		if name != "srbminer" {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("gpuVendor cpu is ignored by %s", check.Name))
+		}
+	default:
+		result.Errors = append(result.Errors, fmt.Sprintf("unknown GPU vendor %q", check.GPUVendor))
+	}
+
+	result.Binary = e.findMiner(check.Name)
+	if result.Binary == "" {
+		result.Errors = append(result.Errors, fmt.Sprintf("miner %s not found", check.Name))
+	}
+
+	for _, opt := range minerOptions {
+		if opt.set(&check) && !containsString(opt.miners, name) {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s is ignored by %s", opt.option, check.Name))
+		}
+	}
+	if check.LHRAlgo != "" && strings.EqualFold(check.LHRAlgo, check.Algorithm) {
+		result.Errors = append(result.Errors, "lhrAlgo must differ from the primary algorithm")
+	}
+	result.Errors = append(result.Errors, checkDualArgs(name, &check)...)
+	for _, arg := range check.ExtraArgs {
+		if containsString(managedArgs[name], argName(arg)) {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("extra argument %s overrides one the agent sets", arg))
+		}
+	}
+	for _, hook := range missingHooks(&check) {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("hook %s is not installed", hook))
+	}
+	if check.Hooks != nil && check.Hooks.timeout() < time.Duration(check.Hooks.Timeout)*time.Second {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("hook timeout is capped at %s", maxHookTimeout))
+	}
+	if e.proxy != nil {
+		result.Warnings = append(result.Warnings, "the miner will connect through the local stratum proxy instead of the pool")
+	}
+
+	// Render the command even for invalid configs where possible, it helps
+	// spotting the problem
+	if result.Binary != "" {
+		port, err := allocateAPIPort(check.Name, map[int]bool{})
+		if err != nil {
+			result.Warnings = append(result.Warnings, err.Error())
+			port = defaultAPIPorts[name]
+		}
+		api, err := e.newMinerAPI(check.Name, port)
+		if err != nil {
+			result.Warnings = append(result.Warnings, err.Error())
+		}
+		// Each start gets its own key; show where it goes
+		if api.Key != "" {
+			api.Key = "<api-key>"
+		}
+		cmd, err := e.buildMinerCommand(&check, api)
+		if err != nil {
+			result.Errors = append(result.Errors, err.Error())
+		} else {
+			result.Command = maskArgs(cmd.Args, check.Wallet)
+		}
+	}
+
+	// Errors like the wallet check quote the address
+	result.Errors = maskArgs(result.Errors, check.Wallet)
+	result.Valid = len(result.Errors) == 0
+	return result
+}
+
+// checkDualArgs checks that dual-mining arguments come with the pool and
+// wallet of the secondary algorithm
+func checkDualArgs(name string, config *MinerConfig) []string {
+	args := map[string]bool{}
+	for _, arg := range config.ExtraArgs {
+		args[argName(arg)] = true
+	}
+	if config.LHRAlgo != "" {
+		args["--lhr-algo"] = true
+	}
+
+	var errors []string
+	for enable, required := range dualArgs[name] {
+		if !args[enable] {
+			continue
+		}
+		for _, arg := range required {
+			if !args[arg] {
+				errors = append(errors, fmt.Sprintf("%s requires %s", enable, arg))
+			}
+		}
+	}
+	sort.Strings(errors)
+	return errors
+}
+
+// argName strips the value from "--flag=value" arguments
+func argName(arg string) string {
+	if i := strings.Index(arg, "="); i > 0 {
+		return arg[:i]
+	}
+	return arg
+}
+
+// maskArgs copies a command line or messages, masking the wallet wherever
+// it appears
+func maskArgs(args []string, wallet string) []string {
+	masked := make([]string, len(args))
+	for i, arg := range args {
+		if wallet != "" {
+			arg = strings.ReplaceAll(arg, wallet, maskWallet(wallet))
+		}
+		masked[i] = arg
+	}
+	return masked
+}
+
+// maskWallet keeps the start and end of an address, enough to recognize it
+func maskWallet(wallet string) string {
+	if len(wallet) <= 10 {
+		return strings.Repeat("*", len(wallet))
+	}
+	return wallet[:6] + "..." + wallet[len(wallet)-4:]
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,346 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bloxos/agent/internal/platform"
+)
+
+// VBIOSFlashRequest describes a vBIOS flash. Flashing takes two calls: the
+// first (without Nonce) downloads and verifies the ROM, backs up the current
+// vBIOS and returns a nonce; the second repeats the request with that nonce.
+type VBIOSFlashRequest struct {
+	Vendor   string `json:"vendor"`   // "nvidia" or "amd"
+	GPUIndex int    `json:"gpuIndex"` // nvidia-smi index or DRM card number
+	Model    string `json:"model"`    // Expected GPU model, must be allowlisted
+	URL      string `json:"url"`      // ROM download URL
+	SHA256   string `json:"sha256"`   // Required checksum of the ROM
+	Nonce    string `json:"nonce"`    // Confirmation nonce from the first call
+}
+
+// VBIOSFlashResult is returned by both stages of a flash
+type VBIOSFlashResult struct {
+	Stage          string `json:"stage"` // "confirm" or "flashed"
+	Nonce          string `json:"nonce,omitempty"`
+	ExpiresIn      int    `json:"expiresIn,omitempty"` // Seconds left to confirm
+	Backup         string `json:"backup"`              // Path of the saved original vBIOS
+	Output         string `json:"output,omitempty"`
+	RebootRequired bool   `json:"rebootRequired,omitempty"`
+}
+
+// pendingFlash is a verified flash awaiting confirmation
+type pendingFlash struct {
+	key     string // vendor/index/sha256 the nonce is bound to
+	romPath string
+	backup  string
+	expires time.Time
+}
+
+const (
+	vbiosConfirmWindow = 5 * time.Minute
+	maxROMSize         = 2 << 20
+)
+
+var (
+	amdvbflashAdapter = regexp.MustCompile(`^\s*(\d+)\s+(?:[0-9A-Fa-f]{4}\s+)?([0-9A-Fa-f]{2})\s+[0-9A-Fa-f]{2}\s`)
+	nvflashAdapter    = regexp.MustCompile(`<(\d+)>.*B:([0-9A-Fa-f]{2})`)
+)
+
+// FlashVBIOS validates and (on confirmation) flashes a GPU vBIOS. Only GPU
+// models in allowedModels can be flashed; an empty list disables flashing.
+func (e *Executor) FlashVBIOS(req *VBIOSFlashRequest, allowedModels []string) (*VBIOSFlashResult, error) {
+	if len(allowedModels) == 0 {
+		return nil, fmt.Errorf("vBIOS flashing is disabled on this rig (no allowed models configured)")
+	}
+	if req.Vendor != "nvidia" && req.Vendor != "amd" {
+		return nil, fmt.Errorf("vendor must be nvidia or amd")
+	}
+	if req.URL == "" || len(req.SHA256) != sha256.Size*2 {
+		return nil, fmt.Errorf("ROM url and sha256 checksum required")
+	}
+	req.SHA256 = strings.ToLower(req.SHA256)
+
+	allowed := false
+	for _, model := range allowedModels {
+		if strings.EqualFold(strings.TrimSpace(model), req.Model) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed || req.Model == "" {
+		return nil, fmt.Errorf("GPU model %q is not allowed for vBIOS flashing", req.Model)
+	}
+
+	var target *gpuModel
+	for _, gpu := range e.listGPUModels() {
+		if gpu.vendor == req.Vendor && gpu.index == req.GPUIndex {
+			gpu := gpu
+			target = &gpu
+			break
+		}
+	}
+	if target == nil {
+		return nil, fmt.Errorf("%s GPU %d not found", req.Vendor, req.GPUIndex)
+	}
+	if !strings.Contains(strings.ToLower(target.name), strings.ToLower(req.Model)) {
+		return nil, fmt.Errorf("GPU %d is %q, not %q", req.GPUIndex, target.name, req.Model)
+	}
+
+	e.procMu.Lock()
+	running := e.minerPID > 0 || len(e.extraMiners) > 0
+	e.procMu.Unlock()
+	if running {
+		return nil, fmt.Errorf("stop the miner before flashing")
+	}
+
+	key := fmt.Sprintf("%s/%d/%s", req.Vendor, req.GPUIndex, req.SHA256)
+	if req.Nonce == "" {
+		return e.prepareFlash(req, key)
+	}
+	return e.confirmFlash(req, key)
+}
+
+// prepareFlash downloads and verifies the ROM and backs up the current vBIOS
+func (e *Executor) prepareFlash(req *VBIOSFlashRequest, key string) (*VBIOSFlashResult, error) {
+	rom, err := downloadROM(req.URL)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(rom)
+	if hex.EncodeToString(sum[:]) != req.SHA256 {
+		return nil, fmt.Errorf("ROM checksum mismatch: got %x", sum)
+	}
+	if err := validateROM(rom, req.Vendor); err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Join(e.configPath, "vbios")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	romPath := filepath.Join(dir, req.SHA256+".rom")
+	if err := os.WriteFile(romPath, rom, 0600); err != nil {
+		return nil, err
+	}
+
+	backup, err := e.backupVBIOS(req.Vendor, req.GPUIndex, dir)
+	if err != nil {
+		return nil, fmt.Errorf("backup of the current vBIOS failed, not flashing: %w", err)
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	nonce := hex.EncodeToString(buf)
+
+	e.vbiosMu.Lock()
+	if e.vbiosPending == nil {
+		e.vbiosPending = map[string]*pendingFlash{}
+	}
+	e.vbiosPending[nonce] = &pendingFlash{
+		key:     key,
+		romPath: romPath,
+		backup:  backup,
+		expires: time.Now().Add(vbiosConfirmWindow),
+	}
+	e.vbiosMu.Unlock()
+
+	return &VBIOSFlashResult{
+		Stage:     "confirm",
+		Nonce:     nonce,
+		ExpiresIn: int(vbiosConfirmWindow.Seconds()),
+		Backup:    backup,
+	}, nil
+}
+
+// confirmFlash consumes the nonce and writes the verified ROM
+func (e *Executor) confirmFlash(req *VBIOSFlashRequest, key string) (*VBIOSFlashResult, error) {
+	e.vbiosMu.Lock()
+	pending := e.vbiosPending[req.Nonce]
+	delete(e.vbiosPending, req.Nonce) // Single use
+	e.vbiosMu.Unlock()
+
+	if pending == nil || pending.key != key {
+		return nil, fmt.Errorf("invalid confirmation nonce")
+	}
+	if time.Now().After(pending.expires) {
+		return nil, fmt.Errorf("confirmation nonce expired")
+	}
+
+	// The ROM must not have changed on disk since it was verified
+	rom, err := os.ReadFile(pending.romPath)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(rom)
+	if hex.EncodeToString(sum[:]) != req.SHA256 {
+		return nil, fmt.Errorf("ROM changed since verification, not flashing")
+	}
+
+	adapter, err := e.flashAdapter(req.Vendor, req.GPUIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if req.Vendor == "amd" {
+		cmd = exec.CommandContext(ctx, "amdvbflash", "-p", adapter, pending.romPath)
+	} else {
+		cmd = exec.CommandContext(ctx, "nvflash", "--index="+adapter, pending.romPath)
+		cmd.Stdin = strings.NewReader("y\ny\n") // nvflash asks for confirmation
+	}
+
+	fmt.Printf("Flashing vBIOS on %s GPU %d (adapter %s)...\n", req.Vendor, req.GPUIndex, adapter)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("flash failed (backup at %s): %v: %s", pending.backup, err, strings.TrimSpace(string(output)))
+	}
+
+	return &VBIOSFlashResult{
+		Stage:          "flashed",
+		Backup:         pending.backup,
+		Output:         strings.TrimSpace(string(output)),
+		RebootRequired: true,
+	}, nil
+}
+
+// backupVBIOS saves the current vBIOS of a GPU into dir
+func (e *Executor) backupVBIOS(vendor string, index int, dir string) (string, error) {
+	adapter, err := e.flashAdapter(vendor, index)
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("backup-%s%d-%s.rom", vendor, index, time.Now().Format("20060102-150405")))
+	var cmd platform.Cmd
+	if vendor == "amd" {
+		cmd = e.run.Command("amdvbflash", "-s", adapter, path)
+	} else {
+		cmd = e.run.Command("nvflash", "--index="+adapter, "--save", path)
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	info, err := os.Stat(path)
+	if err != nil || info.Size() == 0 {
+		return "", fmt.Errorf("backup file is empty")
+	}
+	return path, nil
+}
+
+// flashAdapter maps a GPU to the flash tool's adapter number by PCI bus
+func (e *Executor) flashAdapter(vendor string, index int) (string, error) {
+	bus, err := e.gpuBusNumber(vendor, index)
+	if err != nil {
+		return "", err
+	}
+
+	var output []byte
+	var pattern *regexp.Regexp
+	if vendor == "amd" {
+		output, err = e.run.Command("amdvbflash", "-i").CombinedOutput()
+		pattern = amdvbflashAdapter
+	} else {
+		output, err = e.run.Command("nvflash", "--list").CombinedOutput()
+		pattern = nvflashAdapter
+	}
+	if err != nil {
+		return "", fmt.Errorf("flash tool not available: %v", err)
+	}
+
+	for _, line := range strings.Split(string(output), "\n") {
+		if match := pattern.FindStringSubmatch(line); match != nil && strings.EqualFold(match[2], bus) {
+			return match[1], nil
+		}
+	}
+	return "", fmt.Errorf("GPU on bus %s not found by the flash tool", bus)
+}
+
+// gpuBusNumber returns the two-digit hex PCI bus number of a GPU
+func (e *Executor) gpuBusNumber(vendor string, index int) (string, error) {
+	var busID string
+	if vendor == "amd" {
+		link, err := os.Readlink(fmt.Sprintf("/sys/class/drm/card%d/device", index))
+		if err != nil {
+			return "", err
+		}
+		busID = filepath.Base(link)
+	} else {
+		output, err := e.run.Command("nvidia-smi", "-i", strconv.Itoa(index), "--query-gpu=pci.bus_id", "--format=csv,noheader").Output()
+		if err != nil {
+			return "", err
+		}
+		busID = strings.TrimSpace(string(output))
+	}
+
+	// "0000:01:00.0" or "00000000:01:00.0"
+	parts := strings.Split(busID, ":")
+	if len(parts) < 3 {
+		return "", fmt.Errorf("unexpected PCI bus id %q", busID)
+	}
+	return parts[len(parts)-2], nil
+}
+
+// downloadROM fetches a ROM image, refusing anything larger than maxROMSize
+func downloadROM(url string) ([]byte, error) {
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("ROM download failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ROM download failed: HTTP %d", resp.StatusCode)
+	}
+
+	rom, err := io.ReadAll(io.LimitReader(resp.Body, maxROMSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("ROM download failed: %w", err)
+	}
+	if len(rom) > maxROMSize {
+		return nil, fmt.Errorf("ROM is larger than %d bytes", maxROMSize)
+	}
+	return rom, nil
+}
+
+// validateROM checks the PCI option ROM signature and, for AMD, the image
+// checksum (all bytes of the image must sum to zero)
+func validateROM(rom []byte, vendor string) error {
+	if len(rom) < 512 || !bytes.Equal(rom[:2], []byte{0x55, 0xAA}) {
+		return fmt.Errorf("not a PCI option ROM (missing 55AA signature)")
+	}
+
+	if vendor == "amd" {
+		size := int(rom[2]) * 512
+		if size == 0 || size > len(rom) {
+			return fmt.Errorf("invalid ROM image size %d", size)
+		}
+		var sum byte
+		for _, b := range rom[:size] {
+			sum += b
+		}
+		if sum != 0 {
+			return fmt.Errorf("ROM image checksum invalid (sum %#02x), fix it before flashing", sum)
+		}
+	}
+	return nil
+}
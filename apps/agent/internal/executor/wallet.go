@@ -0,0 +1,286 @@
+package executor
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/sha3"
+)
+
+// algorithmCoins maps algorithms to the coin they most often mine, used to
+// pick miner quirks when the config doesn't name a coin. It is only a hint:
+// kawpow and randomx also mine other coins, so wallets are never checked
+// against it.
+var algorithmCoins = map[string]string{
+	"etchash":    "ETC",
+	"kawpow":     "RVN",
+	"autolykos2": "ERG",
+	"kheavyhash": "KAS",
+	"randomx":    "XMR",
+}
+
+// ValidateWallet checks a wallet address against the coin's address format.
+// Only an explicitly named coin is checked; unknown or unnamed coins and pool
+// account logins are accepted as-is.
+func ValidateWallet(coin, wallet string) error {
+	if wallet == "" {
+		return fmt.Errorf("wallet is required")
+	}
+
+	coin = strings.ToUpper(coin)
+
+	// Many pools accept "wallet.worker" in the wallet field
+	address := wallet
+	if idx := strings.Index(address, "."); idx > 0 {
+		address = address[:idx]
+	}
+
+	var err error
+	switch coin {
+	case "ETH", "ETC", "ETHW", "OCTA":
+		err = validateEVMAddress(address)
+	case "RVN":
+		err = validateBase58Check(address, "R", 60)
+	case "CLORE":
+		err = validateBase58Check(address, "A", 23)
+	case "BTC":
+		if strings.HasPrefix(strings.ToLower(address), "bc1") {
+			err = validateBech32(address, "bc")
+		} else {
+			err = validateBase58Check(address, "13", 0, 5)
+		}
+	case "ERG":
+		err = validateErgoAddress(address)
+	case "KAS":
+		err = validateKaspaAddress(address)
+	case "XMR":
+		err = validateMoneroAddress(address)
+	default:
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("invalid %s wallet address %q: %w", coin, address, err)
+	}
+	return nil
+}
+
+// validateEVMAddress checks 0x-prefixed hex and, for mixed-case addresses,
+// the EIP-55 checksum
+func validateEVMAddress(address string) error {
+	if !strings.HasPrefix(address, "0x") || len(address) != 42 {
+		return fmt.Errorf("expected 0x followed by 40 hex characters")
+	}
+	hexPart := address[2:]
+	if _, err := hex.DecodeString(hexPart); err != nil {
+		return fmt.Errorf("contains non-hex characters")
+	}
+
+	// All-lower or all-upper addresses carry no checksum
+	if hexPart == strings.ToLower(hexPart) || hexPart == strings.ToUpper(hexPart) {
+		return nil
+	}
+
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write([]byte(strings.ToLower(hexPart)))
+	digest := hash.Sum(nil)
+
+	for i, c := range hexPart {
+		if c >= '0' && c <= '9' {
+			continue
+		}
+		nibble := digest[i/2]
+		if i%2 == 0 {
+			nibble >>= 4
+		}
+		upper := c >= 'A' && c <= 'F'
+		if (nibble&0xf >= 8) != upper {
+			return fmt.Errorf("EIP-55 checksum mismatch")
+		}
+	}
+	return nil
+}
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// base58Decode decodes a Bitcoin-alphabet base58 string
+func base58Decode(s string) ([]byte, error) {
+	n := new(big.Int)
+	radix := big.NewInt(58)
+	for _, c := range s {
+		idx := strings.IndexRune(base58Alphabet, c)
+		if idx < 0 {
+			return nil, fmt.Errorf("invalid base58 character %q", c)
+		}
+		n.Mul(n, radix)
+		n.Add(n, big.NewInt(int64(idx)))
+	}
+
+	decoded := n.Bytes()
+	// Leading '1's encode leading zero bytes
+	for _, c := range s {
+		if c != '1' {
+			break
+		}
+		decoded = append([]byte{0}, decoded...)
+	}
+	return decoded, nil
+}
+
+// validateBase58Check checks a 25-byte base58check address with one of the
+// given version bytes (prefixes lists the allowed first characters)
+func validateBase58Check(address, prefixes string, versions ...byte) error {
+	if address == "" || !strings.ContainsRune(prefixes, rune(address[0])) {
+		return fmt.Errorf("must start with %s", strings.Join(strings.Split(prefixes, ""), " or "))
+	}
+
+	decoded, err := base58Decode(address)
+	if err != nil {
+		return err
+	}
+	if len(decoded) != 25 {
+		return fmt.Errorf("wrong length")
+	}
+	if bytes.IndexByte(versions, decoded[0]) < 0 {
+		return fmt.Errorf("unexpected version byte %d", decoded[0])
+	}
+
+	first := sha256.Sum256(decoded[:21])
+	second := sha256.Sum256(first[:])
+	if !bytes.Equal(second[:4], decoded[21:]) {
+		return fmt.Errorf("checksum mismatch")
+	}
+	return nil
+}
+
+// validateErgoAddress checks a mainnet P2PK address (prefix 9, blake2b checksum)
+func validateErgoAddress(address string) error {
+	if !strings.HasPrefix(address, "9") {
+		return fmt.Errorf("must start with 9")
+	}
+	decoded, err := base58Decode(address)
+	if err != nil {
+		return err
+	}
+	if len(decoded) < 5 {
+		return fmt.Errorf("too short")
+	}
+
+	body := decoded[:len(decoded)-4]
+	sum := blake2b.Sum256(body)
+	if !bytes.Equal(sum[:4], decoded[len(decoded)-4:]) {
+		return fmt.Errorf("checksum mismatch")
+	}
+	return nil
+}
+
+// validateMoneroAddress checks format only; Monero uses a block-wise base58
+// variant so the checksum isn't verified here
+func validateMoneroAddress(address string) error {
+	if address == "" || (address[0] != '4' && address[0] != '8') {
+		return fmt.Errorf("must start with 4 or 8")
+	}
+	if len(address) != 95 && len(address) != 106 {
+		return fmt.Errorf("expected 95 or 106 characters")
+	}
+	for _, c := range address {
+		if !strings.ContainsRune(base58Alphabet, c) {
+			return fmt.Errorf("invalid character %q", c)
+		}
+	}
+	return nil
+}
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// validateBech32 checks a segwit address checksum (bech32 or bech32m)
+func validateBech32(address, hrp string) error {
+	lower := strings.ToLower(address)
+	if lower != address && strings.ToUpper(address) != address {
+		return fmt.Errorf("mixed case")
+	}
+	sep := strings.LastIndex(lower, "1")
+	if sep < 1 || lower[:sep] != hrp || len(lower)-sep-1 < 6 {
+		return fmt.Errorf("must start with %s1", hrp)
+	}
+
+	values := make([]int, 0, len(lower)*2)
+	for _, c := range lower[:sep] {
+		values = append(values, int(c)>>5)
+	}
+	values = append(values, 0)
+	for _, c := range lower[:sep] {
+		values = append(values, int(c)&31)
+	}
+	for _, c := range lower[sep+1:] {
+		idx := strings.IndexRune(bech32Charset, c)
+		if idx < 0 {
+			return fmt.Errorf("invalid character %q", c)
+		}
+		values = append(values, idx)
+	}
+
+	generator := []int{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := 1
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ v
+		for i := 0; i < 5; i++ {
+			if (top>>i)&1 == 1 {
+				chk ^= generator[i]
+			}
+		}
+	}
+
+	// bech32 (v0) or bech32m (v1+)
+	if chk != 1 && chk != 0x2bc830a3 {
+		return fmt.Errorf("checksum mismatch")
+	}
+	return nil
+}
+
+// validateKaspaAddress checks a kaspa: cashaddr-style address checksum
+func validateKaspaAddress(address string) error {
+	const prefix = "kaspa"
+	if !strings.HasPrefix(address, prefix+":") {
+		return fmt.Errorf("must start with %s:", prefix)
+	}
+	payload := address[len(prefix)+1:]
+	if len(payload) < 61 {
+		return fmt.Errorf("too short")
+	}
+
+	values := make([]uint64, 0, len(prefix)+1+len(payload))
+	for _, c := range prefix {
+		values = append(values, uint64(c)&31)
+	}
+	values = append(values, 0)
+	for _, c := range payload {
+		idx := strings.IndexRune(bech32Charset, c)
+		if idx < 0 {
+			return fmt.Errorf("invalid character %q", c)
+		}
+		values = append(values, uint64(idx))
+	}
+
+	generator := []uint64{0x98f2bc8e61, 0x79b76d99e2, 0xf33e5fb3c4, 0xae2eabe2a8, 0x1e4f43e470}
+	c := uint64(1)
+	for _, v := range values {
+		top := c >> 35
+		c = (c&0x07ffffffff)<<5 ^ v
+		for i := 0; i < 5; i++ {
+			if (top>>i)&1 == 1 {
+				c ^= generator[i]
+			}
+		}
+	}
+	if c^1 != 0 {
+		return fmt.Errorf("checksum mismatch")
+	}
+	return nil
+}
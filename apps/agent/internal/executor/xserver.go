@@ -0,0 +1,245 @@
+package executor
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// headlessDisplay is the display of the X server started for nvidia-settings,
+// high enough not to clash with a desktop session
+const headlessDisplay = ":9"
+
+// How long Xorg gets to come up and to exit
+const (
+	xStartTimeout = 15 * time.Second
+	xStopTimeout  = 5 * time.Second
+)
+
+var (
+	nvSettingsGPU = regexp.MustCompile(`\[gpu:\d+\]`)
+	nvSettingsFan = regexp.MustCompile(`\[fan:\d+\]`)
+)
+
+// applyNvidiaSettingsOC applies clock offsets and fan speed, which the
+// driver only exposes through nvidia-settings on an X server with
+// cool-bits. Without a running desktop a headless X server is started,
+// and stopped again unless it has to hold manual fan speeds.
+func (e *Executor) applyNvidiaSettingsOC(config *OCConfig) error {
+	// Fans are automatic unless an X server holds them, no need to start one
+	if config.CoreOffset == nil && config.MemOffset == nil && (config.FanSpeed == nil || *config.FanSpeed == 0) {
+		e.xMu.Lock()
+		running := e.xDisplay != ""
+		e.xMu.Unlock()
+		if !running {
+			return nil
+		}
+	}
+
+	display, err := e.ensureX()
+	if err != nil {
+		return err
+	}
+
+	gpuCount := e.nvidiaSettingsCount(display, "gpus", nvSettingsGPU)
+	if gpuCount == 0 {
+		return fmt.Errorf("nvidia-settings found no GPUs on %s", display)
+	}
+	gpus := []int{config.GPUIndex}
+	if config.GPUIndex < 0 {
+		gpus = nil
+		for i := 0; i < gpuCount; i++ {
+			gpus = append(gpus, i)
+		}
+	}
+
+	// nvidia-settings numbers fans across the rig without saying which GPU
+	// they belong to; rigs of identical cards have the same count per GPU
+	fansPerGPU := e.nvidiaSettingsCount(display, "fans", nvSettingsFan) / gpuCount
+
+	var args []string
+	for _, gpu := range gpus {
+		if config.CoreOffset != nil {
+			args = append(args, "-a", fmt.Sprintf("[gpu:%d]/GPUGraphicsClockOffsetAllPerformanceLevels=%d", gpu, *config.CoreOffset))
+		}
+		if config.MemOffset != nil {
+			// Transfer rate offset, i.e. twice the memory clock offset
+			args = append(args, "-a", fmt.Sprintf("[gpu:%d]/GPUMemoryTransferRateOffsetAllPerformanceLevels=%d", gpu, *config.MemOffset))
+		}
+		if config.FanSpeed != nil {
+			if *config.FanSpeed > 0 {
+				args = append(args, "-a", fmt.Sprintf("[gpu:%d]/GPUFanControlState=1", gpu))
+				for fan := gpu * fansPerGPU; fan < (gpu+1)*fansPerGPU; fan++ {
+					args = append(args, "-a", fmt.Sprintf("[fan:%d]/GPUTargetFanSpeed=%d", fan, *config.FanSpeed))
+				}
+			} else {
+				args = append(args, "-a", fmt.Sprintf("[gpu:%d]/GPUFanControlState=0", gpu))
+			}
+		}
+	}
+	if len(args) == 0 {
+		return nil
+	}
+
+	output, err := e.run.Command("nvidia-settings", append([]string{"-c", display}, args...)...).CombinedOutput()
+	if e.debug {
+		fmt.Printf("nvidia-settings %v: %s\n", args, string(output))
+	}
+	// Failed assignments are reported in the output, not the exit status
+	if err == nil && strings.Contains(string(output), "ERROR") {
+		err = fmt.Errorf("assignment failed")
+	}
+	if err != nil {
+		err = fmt.Errorf("nvidia-settings: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	// Manual fan control reverts to auto when the X server exits
+	if config.FanSpeed != nil {
+		e.xMu.Lock()
+		if e.xManualFans == nil {
+			e.xManualFans = map[int]bool{}
+		}
+		for _, gpu := range gpus {
+			if *config.FanSpeed > 0 {
+				e.xManualFans[gpu] = true
+			} else {
+				delete(e.xManualFans, gpu)
+			}
+		}
+		e.xMu.Unlock()
+	}
+	e.releaseX()
+
+	return err
+}
+
+// nvidiaSettingsCount counts the GPUs or fans nvidia-settings reports
+func (e *Executor) nvidiaSettingsCount(display, target string, pattern *regexp.Regexp) int {
+	output, err := e.run.Command("nvidia-settings", "-c", display, "-q", target).Output()
+	if err != nil {
+		return 0
+	}
+	return len(pattern.FindAll(output, -1))
+}
+
+// ensureX returns a display nvidia-settings can use: the desktop's, the
+// running headless server's or a newly started one
+func (e *Executor) ensureX() (string, error) {
+	e.xMu.Lock()
+	defer e.xMu.Unlock()
+
+	if e.xDisplay != "" {
+		return e.xDisplay, nil
+	}
+	if _, err := e.run.LookPath("nvidia-settings"); err != nil {
+		return "", fmt.Errorf("nvidia-settings not installed")
+	}
+
+	if display := os.Getenv("DISPLAY"); display != "" {
+		if err := e.run.Command("nvidia-settings", "-c", display, "-q", "gpus").Run(); err == nil {
+			e.xDisplay = display
+			return display, nil
+		}
+	}
+
+	return e.startHeadlessX()
+}
+
+// startHeadlessX starts Xorg on all NVIDIA GPUs with cool-bits enabled and
+// no monitors required. Callers hold xMu.
+func (e *Executor) startHeadlessX() (string, error) {
+	if _, err := e.run.LookPath("Xorg"); err != nil {
+		return "", fmt.Errorf("offsets and fan control need Xorg (install xserver-xorg-core)")
+	}
+	if _, err := e.run.LookPath("nvidia-xconfig"); err != nil {
+		return "", fmt.Errorf("nvidia-xconfig not installed")
+	}
+
+	if err := os.MkdirAll(e.configPath, 0755); err != nil {
+		return "", err
+	}
+	confPath := filepath.Join(e.configPath, "xorg-headless.conf")
+	output, err := e.run.Command("nvidia-xconfig",
+		"--enable-all-gpus", "--separate-x-screens", "--cool-bits=31",
+		"--allow-empty-initial-configuration", "-o", confPath).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("nvidia-xconfig: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	cmd := exec.Command("Xorg", headlessDisplay, "-config", confPath,
+		"-nolisten", "tcp", "-novtswitch", "-sharevts")
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("failed to start Xorg: %w", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(done)
+
+		e.xMu.Lock()
+		if e.xCmd == cmd {
+			fmt.Println("Headless X server exited")
+			e.xCmd = nil
+			e.xDisplay = ""
+		}
+		e.xMu.Unlock()
+	}()
+
+	deadline := time.Now().Add(xStartTimeout)
+	for {
+		if err := e.run.Command("nvidia-settings", "-c", headlessDisplay, "-q", "gpus").Run(); err == nil {
+			break
+		}
+		select {
+		case <-done:
+			return "", fmt.Errorf("Xorg exited during startup (see /var/log/Xorg.9.log)")
+		case <-time.After(500 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			cmd.Process.Kill()
+			return "", fmt.Errorf("Xorg did not start within %s", xStartTimeout)
+		}
+	}
+
+	fmt.Printf("Started headless X server on %s (PID: %d)\n", headlessDisplay, cmd.Process.Pid)
+	e.xCmd = cmd
+	e.xDone = done
+	e.xDisplay = headlessDisplay
+	return headlessDisplay, nil
+}
+
+// releaseX stops the headless X server once no GPU needs it for manual
+// fan speeds. A desktop's X server is left alone.
+func (e *Executor) releaseX() {
+	e.xMu.Lock()
+	if e.xCmd == nil || len(e.xManualFans) > 0 {
+		e.xMu.Unlock()
+		return
+	}
+	cmd, done := e.xCmd, e.xDone
+	e.xCmd = nil
+	e.xDisplay = ""
+	e.xMu.Unlock()
+
+	cmd.Process.Signal(syscall.SIGTERM)
+	select {
+	case <-done:
+	case <-time.After(xStopTimeout):
+		cmd.Process.Kill()
+	}
+	fmt.Println("Stopped headless X server")
+}
+
+// StopHeadlessX stops the headless X server, e.g. on shutdown. Fans under
+// manual control go back to automatic.
+func (e *Executor) StopHeadlessX() {
+	e.xMu.Lock()
+	e.xManualFans = map[int]bool{}
+	e.xMu.Unlock()
+	e.releaseX()
+}
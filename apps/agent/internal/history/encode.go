@@ -0,0 +1,171 @@
+package history
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// Encoding names the Batch.Data layout. Before gzip the data is:
+//
+//	timestamps: uvarint of the first, then a varint delta-of-delta each
+//	per series, in Series order: a presence bitmap of ceil(count/8)
+//	bytes, then for each present sample the varint delta of its value
+//	from the series' previous value (starting at 0), as round(v*Scale)
+//
+// Polls are evenly spaced and most readings change little between them,
+// so nearly every number is a zero or a one-byte varint that gzip then
+// squeezes further.
+const Encoding = "columnar-delta-gzip-v1"
+
+// scale keeps two decimals, enough for temperatures, percentages and
+// hashrates in H/s
+const scale = 100
+
+// Batch is a compressed run of samples
+type Batch struct {
+	Encoding string   `json:"encoding"`
+	Count    int      `json:"count"`
+	From     int64    `json:"from"` // Unix ms of the first sample
+	To       int64    `json:"to"`   // Unix ms of the last sample
+	Series   []string `json:"series"`
+	Scale    int      `json:"scale"`
+	Data     string   `json:"data"` // Base64 of the gzipped columns
+}
+
+// Encode packs samples, oldest first, into a batch
+func Encode(samples []Sample) (*Batch, error) {
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("no samples")
+	}
+
+	seen := map[string]bool{}
+	var series []string
+	for _, sample := range samples {
+		for name := range sample.Values {
+			if !seen[name] {
+				seen[name] = true
+				series = append(series, name)
+			}
+		}
+	}
+	sort.Strings(series)
+
+	var raw []byte
+	var prevTime, prevDelta int64
+	for i, sample := range samples {
+		if i == 0 {
+			raw = binary.AppendUvarint(raw, uint64(sample.Time))
+		} else {
+			delta := sample.Time - prevTime
+			raw = binary.AppendVarint(raw, delta-prevDelta)
+			prevDelta = delta
+		}
+		prevTime = sample.Time
+	}
+
+	for _, name := range series {
+		bitmap := make([]byte, (len(samples)+7)/8)
+		var deltas []byte
+		var prev int64
+		for i, sample := range samples {
+			value, ok := sample.Values[name]
+			if !ok || math.IsNaN(value) || math.IsInf(value, 0) {
+				continue
+			}
+			bitmap[i/8] |= 1 << uint(i%8)
+			v := int64(math.Round(value * scale))
+			deltas = binary.AppendVarint(deltas, v-prev)
+			prev = v
+		}
+		raw = append(raw, bitmap...)
+		raw = append(raw, deltas...)
+	}
+
+	var buf bytes.Buffer
+	zw, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if _, err := zw.Write(raw); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return &Batch{
+		Encoding: Encoding,
+		Count:    len(samples),
+		From:     samples[0].Time,
+		To:       samples[len(samples)-1].Time,
+		Series:   series,
+		Scale:    scale,
+		Data:     base64.StdEncoding.EncodeToString(buf.Bytes()),
+	}, nil
+}
+
+// Decode unpacks a batch, e.g. in the simulator's fake server
+func Decode(batch *Batch) ([]Sample, error) {
+	if batch.Encoding != Encoding {
+		return nil, fmt.Errorf("unknown history encoding %q", batch.Encoding)
+	}
+	if batch.Scale <= 0 {
+		return nil, fmt.Errorf("invalid history scale %d", batch.Scale)
+	}
+	compressed, err := base64.StdEncoding.DecodeString(batch.Data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid history data: %w", err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, fmt.Errorf("invalid history data: %w", err)
+	}
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid history data: %w", err)
+	}
+	r := bytes.NewReader(raw)
+
+	samples := make([]Sample, batch.Count)
+	var prevDelta int64
+	for i := range samples {
+		if i == 0 {
+			first, err := binary.ReadUvarint(r)
+			if err != nil {
+				return nil, fmt.Errorf("truncated history timestamps")
+			}
+			samples[0].Time = int64(first)
+		} else {
+			dod, err := binary.ReadVarint(r)
+			if err != nil {
+				return nil, fmt.Errorf("truncated history timestamps")
+			}
+			prevDelta += dod
+			samples[i].Time = samples[i-1].Time + prevDelta
+		}
+		samples[i].Values = map[string]float64{}
+	}
+
+	for _, name := range batch.Series {
+		bitmap := make([]byte, (batch.Count+7)/8)
+		if _, err := io.ReadFull(r, bitmap); err != nil {
+			return nil, fmt.Errorf("truncated history series %s", name)
+		}
+		var prev int64
+		for i := range samples {
+			if bitmap[i/8]&(1<<uint(i%8)) == 0 {
+				continue
+			}
+			delta, err := binary.ReadVarint(r)
+			if err != nil {
+				return nil, fmt.Errorf("truncated history series %s", name)
+			}
+			prev += delta
+			samples[i].Values[name] = float64(prev) / float64(batch.Scale)
+		}
+	}
+	return samples, nil
+}
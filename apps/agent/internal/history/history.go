@@ -0,0 +1,72 @@
+// Package history buffers stats samples while the agent is offline and
+// packs them into compact batches for upload once it reconnects
+package history
+
+import (
+	"sync"
+	"time"
+)
+
+// Buffer limits: a day of samples at the default 30s poll interval, with
+// room for shorter intervals
+const (
+	maxAge     = 24 * time.Hour
+	maxSamples = 5760
+)
+
+// Sample is one stats poll flattened to numeric series, e.g.
+// "gpu3.temperature" or "miner.hashrate"
+type Sample struct {
+	Time   int64              // Unix milliseconds
+	Values map[string]float64 // Series missing from a poll are left out
+}
+
+// Buffer holds the samples collected while offline, dropping the oldest
+// beyond a day or maxSamples
+type Buffer struct {
+	mu      sync.Mutex
+	samples []Sample
+}
+
+// Add appends a sample
+func (b *Buffer) Add(sample Sample) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.samples = append(b.samples, sample)
+	cutoff := sample.Time - maxAge.Milliseconds()
+	drop := 0
+	for drop < len(b.samples) && (b.samples[drop].Time < cutoff || len(b.samples)-drop > maxSamples) {
+		drop++
+	}
+	if drop > 0 {
+		b.samples = append([]Sample(nil), b.samples[drop:]...)
+	}
+}
+
+// Len returns the number of buffered samples
+func (b *Buffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.samples)
+}
+
+// Requeue puts back drained samples that couldn't be uploaded, ahead of
+// the ones added since
+func (b *Buffer) Requeue(samples []Sample) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.samples = append(append([]Sample(nil), samples...), b.samples...)
+	if len(b.samples) > maxSamples {
+		b.samples = b.samples[len(b.samples)-maxSamples:]
+	}
+}
+
+// Drain removes and returns the buffered samples, oldest first
+func (b *Buffer) Drain() []Sample {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	samples := b.samples
+	b.samples = nil
+	return samples
+}
@@ -0,0 +1,157 @@
+package installer
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DriverVersions holds the GPU driver stack detected on the rig
+type DriverVersions struct {
+	NvidiaGPUs   bool   `json:"nvidiaGpus"`
+	AMDGPUs      bool   `json:"amdGpus"`
+	NvidiaDriver string `json:"nvidiaDriver,omitempty"`
+	CUDA         string `json:"cuda,omitempty"` // Highest CUDA version the driver supports
+	ROCm         string `json:"rocm,omitempty"`
+	AMDGPUDriver string `json:"amdgpuDriver,omitempty"` // DKMS amdgpu module version
+}
+
+var cudaVersionPattern = regexp.MustCompile(`CUDA Version:\s*([\d.]+)`)
+
+// minerAliases maps executor miner names to AvailableMiners keys
+var minerAliases = map[string]string{
+	"trex":           "t-rex",
+	"trm":            "teamredminer",
+	"srbminer-multi": "srbminer",
+	"phoenix":        "phoenixminer",
+	"cpuminer":       "cpuminer-opt",
+}
+
+// DetectDrivers reports which GPU vendors are present and their driver versions
+func DetectDrivers() *DriverVersions {
+	d := &DriverVersions{}
+
+	if output, err := exec.Command("nvidia-smi", "--query-gpu=driver_version", "--format=csv,noheader").Output(); err == nil {
+		lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+		if len(lines) > 0 && lines[0] != "" {
+			d.NvidiaGPUs = true
+			d.NvidiaDriver = strings.TrimSpace(lines[0])
+		}
+		if header, err := exec.Command("nvidia-smi").Output(); err == nil {
+			if match := cudaVersionPattern.FindSubmatch(header); match != nil {
+				d.CUDA = string(match[1])
+			}
+		}
+	}
+
+	if entries, err := os.ReadDir("/sys/class/drm"); err == nil {
+		for _, entry := range entries {
+			if !strings.HasPrefix(entry.Name(), "card") || strings.Contains(entry.Name(), "-") {
+				continue
+			}
+			vendor, _ := os.ReadFile(fmt.Sprintf("/sys/class/drm/%s/device/vendor", entry.Name()))
+			if strings.TrimSpace(string(vendor)) == "0x1002" {
+				d.AMDGPUs = true
+				break
+			}
+		}
+	}
+	if d.AMDGPUs {
+		if data, err := os.ReadFile("/opt/rocm/.info/version"); err == nil {
+			d.ROCm = strings.TrimSpace(string(data))
+		}
+		if data, err := os.ReadFile("/sys/module/amdgpu/version"); err == nil {
+			d.AMDGPUDriver = strings.TrimSpace(string(data))
+		}
+	}
+
+	return d
+}
+
+// CheckCompatibility verifies that the rig has GPUs and drivers the miner
+// can use, so a mismatch fails with a clear message instead of the miner's
+// own "no CUDA device found" crash
+func CheckCompatibility(minerName string) error {
+	name := strings.ToLower(minerName)
+	if alias, ok := minerAliases[name]; ok {
+		name = alias
+	}
+	info, ok := AvailableMiners[name]
+	if !ok {
+		return nil // Unknown miners are not checked
+	}
+
+	d := DetectDrivers()
+
+	switch info.SupportedGPUs {
+	case "nvidia":
+		if !d.NvidiaGPUs {
+			return fmt.Errorf("%s requires an NVIDIA GPU, but none was detected (is the NVIDIA driver loaded?)", info.Name)
+		}
+	case "amd":
+		if !d.AMDGPUs {
+			return fmt.Errorf("%s requires an AMD GPU, but none was detected", info.Name)
+		}
+	case "both":
+		if !d.NvidiaGPUs && !d.AMDGPUs {
+			return fmt.Errorf("%s requires an NVIDIA or AMD GPU, but none was detected", info.Name)
+		}
+	}
+
+	if d.NvidiaGPUs {
+		if info.MinNvidiaDriver != "" && compareVersions(d.NvidiaDriver, info.MinNvidiaDriver) < 0 {
+			return fmt.Errorf("%s requires NVIDIA driver %s or newer (installed: %s); update the driver or choose another miner",
+				info.Name, info.MinNvidiaDriver, d.NvidiaDriver)
+		}
+		if info.MinCUDA != "" && d.CUDA != "" && compareVersions(d.CUDA, info.MinCUDA) < 0 {
+			return fmt.Errorf("%s requires CUDA %s or newer (driver supports %s); update the NVIDIA driver",
+				info.Name, info.MinCUDA, d.CUDA)
+		}
+	}
+
+	if d.AMDGPUs && info.MinROCm != "" {
+		if d.ROCm == "" {
+			return fmt.Errorf("%s requires ROCm %s or newer, but ROCm is not installed", info.Name, info.MinROCm)
+		}
+		if compareVersions(d.ROCm, info.MinROCm) < 0 {
+			return fmt.Errorf("%s requires ROCm %s or newer (installed: %s)", info.Name, info.MinROCm, d.ROCm)
+		}
+	}
+
+	return nil
+}
+
+// compareVersions compares dotted numeric versions like "535.104.05",
+// returning -1, 0 or 1. Non-numeric suffixes ("5.7.1-98") are ignored.
+func compareVersions(a, b string) int {
+	pa := strings.Split(a, ".")
+	pb := strings.Split(b, ".")
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var na, nb int
+		if i < len(pa) {
+			na = leadingInt(pa[i])
+		}
+		if i < len(pb) {
+			nb = leadingInt(pb[i])
+		}
+		if na != nb {
+			if na < nb {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func leadingInt(s string) int {
+	end := 0
+	for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+		end++
+	}
+	n, _ := strconv.Atoi(s[:end])
+	return n
+}
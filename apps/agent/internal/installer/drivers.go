@@ -0,0 +1,351 @@
+package installer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DriverInstallRequest selects a GPU driver to install
+type DriverInstallRequest struct {
+	Vendor  string `json:"vendor"`            // nvidia or amd
+	Version string `json:"version"`           // NVIDIA driver (535.183.01) or amdgpu-install release (6.1.3)
+	URL     string `json:"url,omitempty"`     // Installer download; NVIDIA defaults to download.nvidia.com, required for AMD
+	SHA256  string `json:"sha256,omitempty"`  // Checksum of the download
+	Usecase string `json:"usecase,omitempty"` // amdgpu-install --usecase (default opencl)
+}
+
+// DriverState is a driver install waiting to be verified after a reboot
+type DriverState struct {
+	Request     DriverInstallRequest  `json:"request"`
+	Previous    *DriverInstallRequest `json:"previous,omitempty"` // What a rollback reinstalls
+	Rollback    bool                  `json:"rollback"`           // This install is a rollback
+	InstalledAt time.Time             `json:"installedAt"`
+	Status      string                `json:"status,omitempty"` // Set by VerifyDriver
+	Message     string                `json:"message,omitempty"`
+}
+
+// Driver verification outcomes
+const (
+	DriverVerified    = "verified"
+	DriverRollingBack = "rolling_back" // Previous driver reinstalled, needs a reboot
+	DriverRolledBack  = "rolled_back"
+	DriverFailed      = "failed"
+)
+
+// driverRecord is the on-disk driver install history
+type driverRecord struct {
+	Installed map[string]DriverInstallRequest `json:"installed"` // Last verified driver per vendor
+	Pending   *DriverState                    `json:"pending,omitempty"`
+}
+
+var nvidiaDriverVersion = regexp.MustCompile(`^\d+\.\d+(\.\d+)?$`)
+
+// InstallDriver downloads and installs a GPU driver, building the kernel
+// module with DKMS when available. The driver is only loaded after a
+// reboot; VerifyDriver then checks it and rolls back on failure.
+func (i *Installer) InstallDriver(req DriverInstallRequest, progress func(message string)) error {
+	if progress == nil {
+		progress = func(string) {}
+	}
+	if err := validateDriverRequest(&req); err != nil {
+		return err
+	}
+
+	record, err := i.loadDriverRecord()
+	if err != nil {
+		return err
+	}
+	if record.Pending != nil {
+		return fmt.Errorf("%s driver %s is waiting for a reboot to be verified", record.Pending.Request.Vendor, record.Pending.Request.Version)
+	}
+
+	// Remember what to roll back to
+	var previous *DriverInstallRequest
+	if installed, ok := record.Installed[req.Vendor]; ok {
+		previous = &installed
+	} else if current := DetectDrivers(); req.Vendor == "nvidia" && current.NvidiaDriver != "" {
+		previous = &DriverInstallRequest{Vendor: "nvidia", Version: current.NvidiaDriver}
+		validateDriverRequest(previous)
+	}
+
+	if err := i.installDriver(req, progress); err != nil {
+		return err
+	}
+
+	record.Pending = &DriverState{Request: req, Previous: previous, InstalledAt: time.Now()}
+	return i.saveDriverRecord(record)
+}
+
+// VerifyDriver checks a driver installed before the last reboot. A driver
+// that didn't load is replaced by the previous one (DriverRollingBack, the
+// caller reboots). It returns nil when no install is pending.
+func (i *Installer) VerifyDriver() (*DriverState, error) {
+	record, err := i.loadDriverRecord()
+	if err != nil || record.Pending == nil {
+		return nil, err
+	}
+	state := record.Pending
+	record.Pending = nil
+
+	loaded, problem := driverLoaded(state.Request)
+	switch {
+	case loaded && state.Rollback:
+		state.Status = DriverRolledBack
+		record.Installed[state.Request.Vendor] = state.Request
+	case loaded:
+		state.Status = DriverVerified
+		record.Installed[state.Request.Vendor] = state.Request
+	case state.Rollback:
+		state.Status = DriverFailed
+		state.Message = fmt.Sprintf("rollback to %s %s failed: %s", state.Request.Vendor, state.Request.Version, problem)
+	default:
+		state.Message = problem
+		if err := i.rollbackDriver(state); err != nil {
+			state.Status = DriverFailed
+			state.Message = fmt.Sprintf("%s; rollback failed: %v", problem, err)
+		} else {
+			state.Status = DriverRollingBack
+			record.Pending = &DriverState{Request: rollbackTarget(state), Rollback: true, InstalledAt: time.Now()}
+		}
+	}
+
+	return state, i.saveDriverRecord(record)
+}
+
+// rollbackTarget is the driver a rollback installs; an AMD rig without a
+// previous install goes back to the in-kernel amdgpu driver
+func rollbackTarget(state *DriverState) DriverInstallRequest {
+	if state.Previous != nil {
+		return *state.Previous
+	}
+	return DriverInstallRequest{Vendor: state.Request.Vendor}
+}
+
+// rollbackDriver reinstalls the previous driver of a failed install
+func (i *Installer) rollbackDriver(state *DriverState) error {
+	progress := func(message string) { fmt.Println(message) }
+	if state.Previous != nil {
+		return i.installDriver(*state.Previous, progress)
+	}
+	if state.Request.Vendor == "amd" {
+		progress("Removing amdgpu-install stack")
+		return runRoot("amdgpu-install", "-y", "--uninstall")
+	}
+	return fmt.Errorf("no previous %s driver recorded", state.Request.Vendor)
+}
+
+// validateDriverRequest checks a request and fills in defaults
+func validateDriverRequest(req *DriverInstallRequest) error {
+	// Only NVIDIA's own download may skip the checksum; anything else runs
+	// as root from wherever the command says
+	defaultURL := ""
+	switch req.Vendor {
+	case "nvidia":
+		if !nvidiaDriverVersion.MatchString(req.Version) {
+			return fmt.Errorf("invalid NVIDIA driver version %q", req.Version)
+		}
+		defaultURL = fmt.Sprintf("https://download.nvidia.com/XFree86/Linux-x86_64/%s/NVIDIA-Linux-x86_64-%s.run", req.Version, req.Version)
+		if req.URL == "" {
+			req.URL = defaultURL
+		}
+	case "amd":
+		if req.URL == "" {
+			return fmt.Errorf("url of the amdgpu-install package required")
+		}
+		if req.Usecase == "" {
+			req.Usecase = "opencl"
+		}
+	default:
+		return fmt.Errorf("vendor must be nvidia or amd")
+	}
+	if !strings.HasPrefix(req.URL, "https://") {
+		return fmt.Errorf("driver url must use https")
+	}
+	req.SHA256 = strings.ToLower(req.SHA256)
+	if req.SHA256 != "" && len(req.SHA256) != sha256.Size*2 {
+		return fmt.Errorf("invalid sha256 checksum")
+	}
+	if req.SHA256 == "" && req.URL != defaultURL {
+		return fmt.Errorf("sha256 checksum required for driver urls outside download.nvidia.com")
+	}
+	return nil
+}
+
+// installDriver downloads and runs the vendor installer
+func (i *Installer) installDriver(req DriverInstallRequest, progress func(string)) error {
+	if err := os.MkdirAll(i.tempDir, 0755); err != nil {
+		return fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(i.tempDir)
+
+	progress(fmt.Sprintf("Downloading %s driver %s", req.Vendor, req.Version))
+	path := filepath.Join(i.tempDir, filepath.Base(req.URL))
+	if err := i.downloadFile(req.URL, path); err != nil {
+		return fmt.Errorf("failed to download: %w", err)
+	}
+	if req.SHA256 != "" {
+		if sum, err := fileSHA256(path); err != nil {
+			return err
+		} else if sum != req.SHA256 {
+			return fmt.Errorf("checksum mismatch: got %s", sum)
+		}
+	}
+
+	dkms := false
+	if _, err := exec.LookPath("dkms"); err == nil {
+		dkms = true
+	}
+
+	switch req.Vendor {
+	case "nvidia":
+		// The installer refuses to run while the modules are loaded
+		progress("Unloading NVIDIA kernel modules")
+		for _, module := range []string{"nvidia_uvm", "nvidia_drm", "nvidia_modeset", "nvidia"} {
+			runRoot("rmmod", module)
+		}
+
+		progress(fmt.Sprintf("Installing NVIDIA driver %s", req.Version))
+		args := []string{path, "--silent", "--no-questions", "--ui=none", "--disable-nouveau"}
+		if dkms {
+			args = append(args, "--dkms")
+		}
+		if err := runRoot("sh", args...); err != nil {
+			return fmt.Errorf("NVIDIA installer failed: %w", err)
+		}
+		if dkms {
+			return checkDKMS("nvidia", req.Version)
+		}
+
+	case "amd":
+		progress("Installing amdgpu-install package")
+		if err := runRoot("env", "DEBIAN_FRONTEND=noninteractive", "apt-get", "install", "-y", path); err != nil {
+			return fmt.Errorf("amdgpu-install package failed: %w", err)
+		}
+		progress(fmt.Sprintf("Installing amdgpu stack (%s)", req.Usecase))
+		if err := runRoot("env", "DEBIAN_FRONTEND=noninteractive", "amdgpu-install", "-y", "--accept-eula", "--usecase="+req.Usecase); err != nil {
+			return fmt.Errorf("amdgpu-install failed: %w", err)
+		}
+		if dkms {
+			return checkDKMS("amdgpu", "")
+		}
+	}
+	return nil
+}
+
+// checkDKMS verifies the module was built for the running kernel, so the
+// reboot doesn't come up without a driver
+func checkDKMS(module, version string) error {
+	kernel, err := exec.Command("uname", "-r").Output()
+	if err != nil {
+		return err
+	}
+	output, err := exec.Command("dkms", "status", module).Output()
+	if err != nil {
+		return fmt.Errorf("dkms status failed: %w", err)
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		if strings.Contains(line, strings.TrimSpace(string(kernel))) && strings.Contains(line, "installed") &&
+			(version == "" || strings.Contains(line, version)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("DKMS did not build %s for kernel %s", module, strings.TrimSpace(string(kernel)))
+}
+
+// driverLoaded reports whether the requested driver is the one running
+func driverLoaded(req DriverInstallRequest) (bool, string) {
+	current := DetectDrivers()
+	switch req.Vendor {
+	case "nvidia":
+		if current.NvidiaDriver == "" {
+			return false, "NVIDIA driver not loaded"
+		}
+		if req.Version != "" && current.NvidiaDriver != req.Version {
+			return false, fmt.Sprintf("NVIDIA driver %s loaded instead of %s", current.NvidiaDriver, req.Version)
+		}
+	case "amd":
+		if !current.AMDGPUs {
+			return false, "no AMD GPUs detected"
+		}
+		// Only a DKMS module reports a version; the in-kernel one doesn't
+		if req.URL != "" && current.AMDGPUDriver == "" {
+			return false, "amdgpu DKMS module not loaded"
+		}
+		if req.Version != "" && req.URL != "" && !strings.HasPrefix(current.ROCm, req.Version) {
+			return false, fmt.Sprintf("ROCm %q installed instead of %s", current.ROCm, req.Version)
+		}
+	}
+	return true, ""
+}
+
+func (i *Installer) driverRecordPath() string {
+	return filepath.Join(i.stateDir, "drivers.json")
+}
+
+func (i *Installer) loadDriverRecord() (*driverRecord, error) {
+	record := &driverRecord{}
+	data, err := os.ReadFile(i.driverRecordPath())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, record); err != nil {
+			return nil, fmt.Errorf("invalid driver record: %w", err)
+		}
+	}
+	if record.Installed == nil {
+		record.Installed = map[string]DriverInstallRequest{}
+	}
+	return record, nil
+}
+
+func (i *Installer) saveDriverRecord(record *driverRecord) error {
+	if err := os.MkdirAll(i.stateDir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(i.driverRecordPath(), data, 0644)
+}
+
+// runRoot runs a command as root, through sudo when needed
+func runRoot(name string, args ...string) error {
+	if os.Geteuid() != 0 {
+		args = append([]string{name}, args...)
+		name = "sudo"
+	}
+	output, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+		if len(lines) > 5 {
+			lines = lines[len(lines)-5:]
+		}
+		return fmt.Errorf("%v: %s", err, strings.Join(lines, "\n"))
+	}
+	return nil
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -25,6 +25,16 @@ type MinerInfo struct {
 	BinaryName     string `json:"binaryName"`     // Name of the binary after extraction
 	SupportedGPUs  string `json:"supportedGpus"`  // "nvidia", "amd", "both", "cpu"
 	SupportedOS    string `json:"supportedOs"`    // "linux", "windows", "both"
+
+	// Miners without GitHub releases are pinned to a version and fetched
+	// from DownloadURL (%s = version) instead
+	DownloadURL string `json:"downloadUrl,omitempty"`
+	Version     string `json:"version,omitempty"`
+
+	// Minimum driver requirements checked before starting (empty = none)
+	MinNvidiaDriver string `json:"minNvidiaDriver,omitempty"`
+	MinCUDA         string `json:"minCuda,omitempty"` // CUDA version supported by the driver
+	MinROCm         string `json:"minRocm,omitempty"`
 }
 
 // Available miners with their GitHub repos
@@ -37,6 +47,9 @@ var AvailableMiners = map[string]MinerInfo{
 		BinaryName:    "t-rex",
 		SupportedGPUs: "nvidia",
 		SupportedOS:   "linux",
+
+		MinNvidiaDriver: "450.80.02",
+		MinCUDA:         "11.1",
 	},
 	"lolminer": {
 		Name:          "lolMiner",
@@ -46,6 +59,8 @@ var AvailableMiners = map[string]MinerInfo{
 		BinaryName:    "lolMiner",
 		SupportedGPUs: "both",
 		SupportedOS:   "linux",
+
+		MinNvidiaDriver: "450.80.02",
 	},
 	"gminer": {
 		Name:          "GMiner",
@@ -55,6 +70,8 @@ var AvailableMiners = map[string]MinerInfo{
 		BinaryName:    "miner",
 		SupportedGPUs: "both",
 		SupportedOS:   "linux",
+
+		MinNvidiaDriver: "450.80.02",
 	},
 	"teamredminer": {
 		Name:          "TeamRedMiner",
@@ -82,6 +99,8 @@ var AvailableMiners = map[string]MinerInfo{
 		BinaryName:    "nbminer",
 		SupportedGPUs: "both",
 		SupportedOS:   "linux",
+
+		MinNvidiaDriver: "418.39",
 	},
 	"srbminer": {
 		Name:          "SRBMiner-Multi",
@@ -92,6 +111,25 @@ var AvailableMiners = map[string]MinerInfo{
 		SupportedGPUs: "amd",
 		SupportedOS:   "linux",
 	},
+	"phoenixminer": {
+		Name:          "PhoenixMiner",
+		Description:   "Ethash/Etchash miner for NVIDIA & AMD",
+		DownloadURL:   "https://phoenixminer.info/downloads/PhoenixMiner_%s_Linux.tar.gz",
+		Version:       "6.2c",
+		AssetPattern:  "PhoenixMiner_%s_Linux.tar.gz",
+		BinaryName:    "PhoenixMiner",
+		SupportedGPUs: "both",
+		SupportedOS:   "linux",
+	},
+	"cpuminer-opt": {
+		Name:          "cpuminer-opt",
+		Description:   "CPU miner for yespower, yescrypt, GhostRider and more",
+		Repo:          "JayDDee/cpuminer-opt",
+		AssetPattern:  "cpuminer-opt-%s-linux.tar.gz",
+		BinaryName:    "cpuminer",
+		SupportedGPUs: "cpu",
+		SupportedOS:   "linux",
+	},
 	"bzminer": {
 		Name:          "BzMiner",
 		Description:   "Multi-algorithm NVIDIA & AMD miner",
@@ -100,6 +138,9 @@ var AvailableMiners = map[string]MinerInfo{
 		BinaryName:    "bzminer",
 		SupportedGPUs: "both",
 		SupportedOS:   "linux",
+
+		MinNvidiaDriver: "470.57.02",
+		MinCUDA:         "11.4",
 	},
 }
 
@@ -107,7 +148,9 @@ var AvailableMiners = map[string]MinerInfo{
 type Installer struct {
 	minersDir string
 	tempDir   string
+	stateDir  string // Driver install records
 	debug     bool
+	dryRun    bool // Validate installs without downloading
 }
 
 // New creates a new Installer
@@ -116,6 +159,7 @@ func New(debug bool) *Installer {
 	return &Installer{
 		minersDir: filepath.Join(home, "miners"),
 		tempDir:   filepath.Join(os.TempDir(), "bloxos-miners"),
+		stateDir:  filepath.Join(home, ".bloxos"),
 		debug:     debug,
 	}
 }
@@ -125,6 +169,12 @@ func (i *Installer) SetMinersDir(dir string) {
 	i.minersDir = dir
 }
 
+// SetDryRun makes Install check a miner and report what it would do
+// instead of downloading it
+func (i *Installer) SetDryRun(dryRun bool) {
+	i.dryRun = dryRun
+}
+
 // ListAvailable returns available miners
 func (i *Installer) ListAvailable() map[string]MinerInfo {
 	return AvailableMiners
@@ -170,6 +220,19 @@ func (i *Installer) Install(minerName string) error {
 		return fmt.Errorf("%s only supports Linux", info.Name)
 	}
 
+	if i.dryRun {
+		if err := CheckCompatibility(minerName); err != nil {
+			return err
+		}
+		source := "github.com/" + info.Repo
+		if info.DownloadURL != "" {
+			source = fmt.Sprintf(info.DownloadURL, info.Version)
+		}
+		fmt.Printf("Dry run: would install %s from %s into %s\n",
+			info.Name, source, filepath.Join(i.minersDir, minerName))
+		return nil
+	}
+
 	fmt.Printf("Installing %s...\n", info.Name)
 
 	// Get latest release from GitHub
@@ -249,6 +312,10 @@ func (i *Installer) Uninstall(minerName string) error {
 
 // getLatestRelease fetches the latest release info from GitHub
 func (i *Installer) getLatestRelease(info MinerInfo) (version string, downloadURL string, err error) {
+	if info.DownloadURL != "" {
+		return info.Version, fmt.Sprintf(info.DownloadURL, info.Version), nil
+	}
+
 	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/releases/latest", info.Repo)
 
 	client := &http.Client{Timeout: 30 * time.Second}
@@ -0,0 +1,182 @@
+package ipmi
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Sensor is a single BMC sensor reading
+type Sensor struct {
+	Name   string  `json:"name"`
+	Value  float64 `json:"value"`
+	Unit   string  `json:"unit"`
+	Status string  `json:"status"`
+}
+
+// Stats holds BMC sensor readings grouped by type
+type Stats struct {
+	PowerWatts   *int     `json:"powerWatts,omitempty"` // DCMI instantaneous power
+	Temperatures []Sensor `json:"temperatures,omitempty"`
+	Fans         []Sensor `json:"fans,omitempty"`
+	Power        []Sensor `json:"power,omitempty"`
+	Voltages     []Sensor `json:"voltages,omitempty"`
+}
+
+// Power actions supported by the chassis command
+var powerActions = map[string]bool{
+	"status": true,
+	"on":     true,
+	"off":    true,
+	"cycle":  true,
+	"reset":  true,
+	"soft":   true,
+}
+
+// Client talks to a BMC through ipmitool, either in-band (/dev/ipmi0) or
+// over the network when a host is configured
+type Client struct {
+	host     string
+	user     string
+	password string
+	debug    bool
+}
+
+// New creates a new IPMI client. An empty host uses the local BMC.
+func New(host, user, password string, debug bool) *Client {
+	return &Client{
+		host:     host,
+		user:     user,
+		password: password,
+		debug:    debug,
+	}
+}
+
+// Available reports whether ipmitool can reach a BMC
+func (c *Client) Available() bool {
+	if _, err := exec.LookPath("ipmitool"); err != nil {
+		return false
+	}
+	if c.host != "" {
+		return true
+	}
+	for _, dev := range []string{"/dev/ipmi0", "/dev/ipmi/0", "/dev/ipmidev/0"} {
+		if _, err := os.Stat(dev); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// GetStats reads all full SDR sensors and the DCMI power reading
+func (c *Client) GetStats() (*Stats, error) {
+	output, err := c.run("-c", "sdr", "list", "full")
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &Stats{}
+
+	// name,value,unit,status
+	reader := csv.NewReader(strings.NewReader(output))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse sdr output: %w", err)
+	}
+
+	for _, record := range records {
+		if len(record) < 4 {
+			continue
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+		if err != nil {
+			continue // "na" / disabled sensors
+		}
+		sensor := Sensor{
+			Name:   strings.TrimSpace(record[0]),
+			Value:  value,
+			Unit:   strings.TrimSpace(record[2]),
+			Status: strings.TrimSpace(record[3]),
+		}
+
+		switch strings.ToLower(sensor.Unit) {
+		case "degrees c":
+			stats.Temperatures = append(stats.Temperatures, sensor)
+		case "rpm":
+			stats.Fans = append(stats.Fans, sensor)
+		case "watts":
+			stats.Power = append(stats.Power, sensor)
+		case "volts":
+			stats.Voltages = append(stats.Voltages, sensor)
+		}
+	}
+
+	stats.PowerWatts = c.dcmiPowerReading()
+
+	return stats, nil
+}
+
+var dcmiPowerRe = regexp.MustCompile(`Instantaneous power reading:\s+(\d+)\s+Watts`)
+
+// dcmiPowerReading returns the whole-system power draw if the BMC supports DCMI
+func (c *Client) dcmiPowerReading() *int {
+	output, err := c.run("dcmi", "power", "reading")
+	if err != nil {
+		return nil
+	}
+	match := dcmiPowerRe.FindStringSubmatch(output)
+	if match == nil {
+		return nil
+	}
+	watts, err := strconv.Atoi(match[1])
+	if err != nil {
+		return nil
+	}
+	return &watts
+}
+
+// IsPowerAction reports whether action is a supported chassis power action
+func IsPowerAction(action string) bool {
+	return powerActions[action]
+}
+
+// Power runs a chassis power action (status, on, off, cycle, reset, soft)
+func (c *Client) Power(action string) (string, error) {
+	if !IsPowerAction(action) {
+		return "", fmt.Errorf("invalid power action: %s", action)
+	}
+	output, err := c.run("chassis", "power", action)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// run executes ipmitool with connection arguments prepended. The password is
+// passed through the environment (-E) so it never shows up in ps output.
+func (c *Client) run(args ...string) (string, error) {
+	var fullArgs []string
+	if c.host != "" {
+		fullArgs = append(fullArgs, "-I", "lanplus", "-H", c.host, "-U", c.user, "-E")
+	}
+	fullArgs = append(fullArgs, args...)
+
+	cmd := exec.Command("ipmitool", fullArgs...)
+	if c.host != "" {
+		cmd.Env = append(os.Environ(), "IPMI_PASSWORD="+c.password)
+	}
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("ipmitool %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	if c.debug {
+		fmt.Printf("ipmitool %v: %s\n", args, string(output))
+	}
+	return string(output), nil
+}
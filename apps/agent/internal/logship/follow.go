@@ -0,0 +1,92 @@
+package logship
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// maxMinerLog is the size at which a followed miner log is truncated once
+// shipped, so logs kept in RAM stay small
+const maxMinerLog = 8 << 20
+
+// followedLog is a miner log file and how far it was shipped
+type followedLog struct {
+	offset int64
+	writer *LineWriter
+}
+
+// FollowDir ships the miner logs in dir (<miner>.log, see
+// executor.SetMinerLogDir) until Close. Files present at the start are
+// followed from their end, since their lines predate the agent; files
+// appearing later are shipped from the start.
+func (s *Shipper) FollowDir(dir string) {
+	logs := map[string]*followedLog{}
+	first := true
+	for {
+		paths, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+		present := map[string]bool{}
+		for _, path := range paths {
+			present[path] = true
+			followed := logs[path]
+			if followed == nil {
+				miner := strings.TrimSuffix(filepath.Base(path), ".log")
+				followed = &followedLog{writer: s.Writer("miner", miner)}
+				if first {
+					if info, err := os.Stat(path); err == nil {
+						followed.offset = info.Size()
+					}
+				}
+				logs[path] = followed
+			}
+			followed.read(path)
+		}
+		for path := range logs {
+			if !present[path] {
+				delete(logs, path)
+			}
+		}
+		first = false
+
+		select {
+		case <-s.done:
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// read ships what was appended since the last read
+func (l *followedLog) read(path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return
+	}
+	if info.Size() < l.offset {
+		// Truncated, or replaced by a new miner run
+		l.offset = 0
+	}
+	if info.Size() == l.offset {
+		return
+	}
+
+	if _, err := f.Seek(l.offset, io.SeekStart); err != nil {
+		return
+	}
+	n, _ := io.Copy(l.writer, f)
+	l.offset += n
+
+	// Miners open their log for appending, so they continue at the start
+	if l.offset >= maxMinerLog {
+		if os.Truncate(path, 0) == nil {
+			l.offset = 0
+		}
+	}
+}
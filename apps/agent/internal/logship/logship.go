@@ -0,0 +1,342 @@
+package logship
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	queueSize     = 5000 // Entries kept while the endpoint is unreachable
+	batchSize     = 500
+	flushInterval = 2 * time.Second
+	maxBackoff    = time.Minute
+)
+
+// Entry is a single log line
+type Entry struct {
+	Time     time.Time
+	Source   string // "agent" or "miner"
+	Miner    string // Miner name for miner output
+	Severity string // critical, error, warning or info
+	Message  string
+}
+
+// sender delivers batches to one kind of endpoint
+type sender interface {
+	send(entries []Entry, labels map[string]string) error
+	close()
+}
+
+// Shipper sends agent and miner logs to a syslog server or Loki,
+// independent of the BloxOS server. Entries are queued and sent in
+// batches; while the endpoint is down the oldest are dropped.
+type Shipper struct {
+	sender sender
+	labels map[string]string // Static labels, e.g. farm=f1
+
+	mu      sync.Mutex
+	queue   []Entry
+	dropped int
+	flushMu sync.Mutex // One batch in flight
+	wake    chan struct{}
+	done    chan struct{}
+}
+
+// New creates a shipper for an endpoint of the form:
+//
+//	syslog://host:514          RFC 5424 over UDP
+//	syslog+tcp://host:601      RFC 5424 over TCP, octet-counted
+//	syslog+tls://host:6514     RFC 5424 over TLS
+//	loki://host:3100           Loki push API (loki+https:// for TLS)
+//	https://host/loki/api/v1/push
+//
+// labels are comma-separated name=value pairs added to every entry.
+func New(endpoint, labels string) (*Shipper, error) {
+	u, err := url.Parse(strings.TrimSpace(endpoint))
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid log endpoint %q", endpoint)
+	}
+
+	var s sender
+	switch strings.ToLower(u.Scheme) {
+	case "syslog", "syslog+udp":
+		s = newSyslog("udp", u.Host)
+	case "syslog+tcp":
+		s = newSyslog("tcp", u.Host)
+	case "syslog+tls":
+		s = newSyslog("tls", u.Host)
+	case "loki", "loki+http", "loki+https":
+		push := *u
+		push.Scheme = "http"
+		if strings.HasSuffix(u.Scheme, "https") {
+			push.Scheme = "https"
+		}
+		if push.Path == "" || push.Path == "/" {
+			push.Path = "/loki/api/v1/push"
+		}
+		s = newLoki(push.String())
+	case "http", "https":
+		s = newLoki(u.String())
+	default:
+		return nil, fmt.Errorf("unsupported log endpoint %q (use syslog://, syslog+tcp://, syslog+tls:// or loki://)", u.Redacted())
+	}
+
+	static, err := parseLabels(labels)
+	if err != nil {
+		return nil, err
+	}
+	shipper := &Shipper{
+		sender: s,
+		labels: static,
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	go shipper.run()
+	return shipper, nil
+}
+
+// labelName is what Loki accepts as a label name
+var labelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+func parseLabels(s string) (map[string]string, error) {
+	labels := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !ok || !labelName.MatchString(name) {
+			return nil, fmt.Errorf("invalid log label %q (use name=value)", pair)
+		}
+		labels[name] = strings.TrimSpace(value)
+	}
+	return labels, nil
+}
+
+// Ship queues an entry without blocking
+func (s *Shipper) Ship(entry Entry) {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	if entry.Severity == "" {
+		entry.Severity = Severity(entry.Message)
+	}
+
+	s.mu.Lock()
+	if len(s.queue) >= queueSize {
+		s.queue = s.queue[1:]
+		s.dropped++
+	}
+	s.queue = append(s.queue, entry)
+	full := len(s.queue) >= batchSize
+	s.mu.Unlock()
+
+	if full {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Close sends what is queued, giving up after a few seconds
+func (s *Shipper) Close() {
+	close(s.done)
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if sent, err := s.flush(); err != nil || sent == 0 {
+			break
+		}
+	}
+	s.sender.close()
+}
+
+func (s *Shipper) run() {
+	backoff := flushInterval
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.wake:
+		case <-time.After(backoff):
+		}
+
+		for {
+			sent, err := s.flush()
+			if err != nil {
+				// Keep the entries and retry later; the queue bounds them
+				if backoff == flushInterval {
+					fmt.Fprintf(os.Stderr, "Log shipping failed: %v\n", err)
+				}
+				backoff *= 2
+				if backoff > maxBackoff {
+					backoff = maxBackoff
+				}
+				break
+			}
+			backoff = flushInterval
+			if sent < batchSize {
+				break
+			}
+		}
+	}
+}
+
+// flush sends up to a batch of queued entries
+func (s *Shipper) flush() (int, error) {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	s.mu.Lock()
+	n := len(s.queue)
+	if n > batchSize {
+		n = batchSize
+	}
+	batch := append([]Entry(nil), s.queue[:n]...)
+	dropped := s.dropped
+	s.mu.Unlock()
+	if n == 0 && dropped == 0 {
+		return 0, nil
+	}
+
+	if dropped > 0 {
+		batch = append(batch, Entry{
+			Time:     time.Now(),
+			Source:   "agent",
+			Severity: "warning",
+			Message:  fmt.Sprintf("Log shipping dropped %d entries while the endpoint was unreachable", dropped),
+		})
+	}
+	if err := s.sender.send(batch, s.streamLabels()); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	// Entries dropped meanwhile came off the front, so up to n of them
+	// were just sent rather than lost
+	sent := s.dropped - dropped
+	if sent > n {
+		sent = n
+	}
+	s.queue = s.queue[n-sent:]
+	s.dropped -= dropped + sent
+	s.mu.Unlock()
+	return n, nil
+}
+
+// streamLabels are the labels of every entry: the rig, looked up each
+// time since the rig can be renamed, and the configured ones
+func (s *Shipper) streamLabels() map[string]string {
+	labels := map[string]string{}
+	if hostname, err := os.Hostname(); err == nil {
+		labels["rig"] = hostname
+	}
+	for name, value := range s.labels {
+		labels[name] = value
+	}
+	return labels
+}
+
+// entryLabels adds an entry's own labels to the stream's
+func entryLabels(stream map[string]string, entry Entry) map[string]string {
+	labels := make(map[string]string, len(stream)+3)
+	for name, value := range stream {
+		labels[name] = value
+	}
+	labels["source"] = entry.Source
+	labels["severity"] = entry.Severity
+	if entry.Miner != "" {
+		labels["miner"] = entry.Miner
+	}
+	return labels
+}
+
+func sortedNames(labels map[string]string) []string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// labelKey identifies a label set
+func labelKey(labels map[string]string) string {
+	var b strings.Builder
+	for _, name := range sortedNames(labels) {
+		fmt.Fprintf(&b, "%s=%q,", name, labels[name])
+	}
+	return b.String()
+}
+
+var (
+	ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+	// The standard log package's timestamp, which entries carry already
+	logTimestamp = regexp.MustCompile(`^\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}(\.\d+)? `)
+)
+
+// Severity guesses the severity of a log line from its wording
+func Severity(line string) string {
+	lower := strings.ToLower(line)
+	switch {
+	case strings.Contains(lower, "panic") || strings.Contains(lower, "fatal") || strings.Contains(lower, "critical"):
+		return "critical"
+	case strings.Contains(lower, "error") || strings.Contains(lower, "fail"):
+		return "error"
+	case strings.Contains(lower, "warn"):
+		return "warning"
+	}
+	return "info"
+}
+
+// Writer returns a writer shipping each line written to it, e.g. to tee
+// the agent's log output
+func (s *Shipper) Writer(source, miner string) *LineWriter {
+	return &LineWriter{ship: func(line string) {
+		s.Ship(Entry{Source: source, Miner: miner, Message: line})
+	}}
+}
+
+// LineWriter splits what is written to it into lines
+type LineWriter struct {
+	mu      sync.Mutex
+	partial []byte
+	ship    func(line string)
+}
+
+func (w *LineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.partial = append(w.partial, p...)
+	for {
+		idx := bytes.IndexByte(w.partial, '\n')
+		if idx < 0 {
+			break
+		}
+		w.emit(w.partial[:idx])
+		w.partial = w.partial[idx+1:]
+	}
+	// Progress bars without newlines shouldn't grow without bound
+	if len(w.partial) > 64<<10 {
+		w.emit(w.partial)
+		w.partial = nil
+	}
+	return len(p), nil
+}
+
+func (w *LineWriter) emit(line []byte) {
+	text := strings.TrimSpace(ansiEscape.ReplaceAllString(string(line), ""))
+	text = logTimestamp.ReplaceAllString(text, "")
+	if text != "" {
+		w.ship(text)
+	}
+}
@@ -0,0 +1,113 @@
+package logship
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// syslogFacility is "daemon"
+const syslogFacility = 3
+
+var syslogSeverities = map[string]int{
+	"critical": 2,
+	"error":    3,
+	"warning":  4,
+	"info":     6,
+}
+
+// syslogSender sends RFC 5424 messages. Labels go into structured data,
+// so collectors can index them like Loki labels.
+type syslogSender struct {
+	network string // udp, tcp or tls
+	addr    string
+	conn    net.Conn
+}
+
+func newSyslog(network, addr string) *syslogSender {
+	return &syslogSender{network: network, addr: addr}
+}
+
+func (s *syslogSender) dial() error {
+	if s.conn != nil {
+		return nil
+	}
+	var err error
+	switch s.network {
+	case "tls":
+		dialer := &net.Dialer{Timeout: 10 * time.Second}
+		s.conn, err = tls.DialWithDialer(dialer, "tcp", s.addr, nil)
+	default:
+		s.conn, err = net.DialTimeout(s.network, s.addr, 10*time.Second)
+	}
+	return err
+}
+
+func (s *syslogSender) send(entries []Entry, labels map[string]string) error {
+	if err := s.dial(); err != nil {
+		return err
+	}
+	hostname := labels["rig"]
+	if hostname == "" {
+		hostname = "-"
+	}
+
+	for i, entry := range entries {
+		message := s.format(entry, hostname, entryLabels(labels, entry))
+		var err error
+		s.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		if s.network == "udp" {
+			_, err = s.conn.Write([]byte(message))
+		} else {
+			// Octet counting (RFC 6587), so messages may span lines
+			_, err = fmt.Fprintf(s.conn, "%d %s", len(message), message)
+		}
+		if err != nil {
+			s.conn.Close()
+			s.conn = nil
+			if i > 0 {
+				// The rest is resent; a few duplicates beat lost lines
+				return fmt.Errorf("sent %d of %d entries: %w", i, len(entries), err)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// format renders an entry as
+// <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID [bloxos@32473 ...] MSG
+func (s *syslogSender) format(entry Entry, hostname string, labels map[string]string) string {
+	app, pid := "bloxos-agent", fmt.Sprint(os.Getpid())
+	if entry.Miner != "" {
+		app, pid = entry.Miner, "-"
+	}
+	severity, ok := syslogSeverities[entry.Severity]
+	if !ok {
+		severity = syslogSeverities["info"]
+	}
+
+	var data strings.Builder
+	data.WriteString("[bloxos@32473")
+	for _, name := range sortedNames(labels) {
+		value := labels[name]
+		value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+		fmt.Fprintf(&data, ` %s="%s"`, name, value)
+	}
+	data.WriteString("]")
+
+	return fmt.Sprintf("<%d>1 %s %s %s %s - %s %s",
+		syslogFacility*8+severity,
+		entry.Time.UTC().Format(time.RFC3339Nano),
+		hostname, app, pid, data.String(), entry.Message)
+}
+
+func (s *syslogSender) close() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
@@ -0,0 +1,299 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bloxos/agent/internal/system"
+)
+
+// NetworkConfig describes the desired IPv4 configuration of an interface
+type NetworkConfig struct {
+	Interface       string   `json:"interface"`
+	DHCP            bool     `json:"dhcp"`
+	Address         string   `json:"address"` // CIDR, e.g. 192.168.1.50/24
+	Gateway         string   `json:"gateway"`
+	DNS             []string `json:"dns"`
+	RollbackTimeout int      `json:"rollbackTimeout"` // Seconds to wait for connectivity
+}
+
+// ErrRolledBack is returned by ApplyWithRollback when the new config lost
+// connectivity and the previous config was restored
+var ErrRolledBack = errors.New("previous config restored")
+
+// Backend applies network configuration through a specific network stack
+type Backend interface {
+	Name() string
+	// Apply applies the config and returns a function that restores the
+	// previous configuration
+	Apply(cfg *NetworkConfig) (rollback func() error, err error)
+}
+
+// Validate checks the config for obvious mistakes before touching the system
+func (n *NetworkConfig) Validate() error {
+	if n.Interface == "" {
+		return fmt.Errorf("interface required")
+	}
+	if _, err := net.InterfaceByName(n.Interface); err != nil {
+		return fmt.Errorf("interface %s not found", n.Interface)
+	}
+	if n.DHCP {
+		return nil
+	}
+
+	ip, ipNet, err := net.ParseCIDR(n.Address)
+	if err != nil || ip.To4() == nil {
+		return fmt.Errorf("invalid address %q (expected IPv4 CIDR like 192.168.1.50/24)", n.Address)
+	}
+
+	gw := net.ParseIP(n.Gateway)
+	if gw == nil || gw.To4() == nil {
+		return fmt.Errorf("invalid gateway %q", n.Gateway)
+	}
+	if !ipNet.Contains(gw) {
+		return fmt.Errorf("gateway %s is not in subnet %s", n.Gateway, ipNet)
+	}
+
+	for _, dns := range n.DNS {
+		if net.ParseIP(dns) == nil {
+			return fmt.Errorf("invalid DNS server %q", dns)
+		}
+	}
+
+	return nil
+}
+
+// DetectBackend returns the network stack managing this system
+func DetectBackend() (Backend, error) {
+	if _, err := exec.LookPath("netplan"); err == nil {
+		if entries, err := os.ReadDir("/etc/netplan"); err == nil && len(entries) > 0 {
+			return &netplanBackend{}, nil
+		}
+	}
+	if _, err := exec.LookPath("nmcli"); err == nil && serviceActive("NetworkManager") {
+		return &networkManagerBackend{}, nil
+	}
+	if serviceActive("systemd-networkd") {
+		return &networkdBackend{}, nil
+	}
+	return nil, fmt.Errorf("no supported network backend found (netplan, NetworkManager, systemd-networkd)")
+}
+
+// ApplyWithRollback applies cfg and verifies that target (host:port) is
+// reachable within the rollback timeout, restoring the old config if not
+func ApplyWithRollback(backend Backend, cfg *NetworkConfig, target string) error {
+	timeout := time.Duration(cfg.RollbackTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = 60 * time.Second
+	}
+
+	rollback, err := backend.Apply(cfg)
+	if err != nil {
+		if rollback != nil {
+			rollback()
+		}
+		return fmt.Errorf("%s: %w", backend.Name(), err)
+	}
+
+	if waitForConnectivity(target, timeout) {
+		return nil
+	}
+
+	if err := rollback(); err != nil {
+		return fmt.Errorf("no connectivity to %s after %v and rollback failed: %w", target, timeout, err)
+	}
+	return fmt.Errorf("no connectivity to %s after %v, %w", target, timeout, ErrRolledBack)
+}
+
+// waitForConnectivity polls a TCP connect to target until it succeeds or times out
+func waitForConnectivity(target string, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		conn, err := net.DialTimeout("tcp", target, 5*time.Second)
+		if err == nil {
+			conn.Close()
+			return true
+		}
+		time.Sleep(2 * time.Second)
+	}
+	return false
+}
+
+// ServerAddress returns the host:port used for connectivity checks
+func ServerAddress(serverURL string) (string, error) {
+	return hostPort(serverURL)
+}
+
+// --- netplan ---
+
+type netplanBackend struct{}
+
+const netplanFile = "/etc/netplan/99-bloxos.yaml"
+
+func (b *netplanBackend) Name() string { return "netplan" }
+
+func (b *netplanBackend) Apply(cfg *NetworkConfig) (func() error, error) {
+	previous, readErr := os.ReadFile(netplanFile)
+	rollback := func() error {
+		if readErr == nil {
+			if err := system.WriteRootFile(netplanFile, string(previous)); err != nil {
+				return err
+			}
+		} else if err := system.RemoveRootFile(netplanFile); err != nil {
+			return err
+		}
+		return runCommand("netplan", "apply")
+	}
+
+	var sb strings.Builder
+	sb.WriteString("# Managed by BloxOs agent\n")
+	sb.WriteString("network:\n  version: 2\n  ethernets:\n")
+	fmt.Fprintf(&sb, "    %s:\n", cfg.Interface)
+	if cfg.DHCP {
+		sb.WriteString("      dhcp4: true\n")
+	} else {
+		sb.WriteString("      dhcp4: false\n")
+		fmt.Fprintf(&sb, "      addresses: [%s]\n", cfg.Address)
+		sb.WriteString("      routes:\n        - to: default\n")
+		fmt.Fprintf(&sb, "          via: %s\n", cfg.Gateway)
+		if len(cfg.DNS) > 0 {
+			fmt.Fprintf(&sb, "      nameservers:\n        addresses: [%s]\n", strings.Join(cfg.DNS, ", "))
+		}
+	}
+
+	if err := system.WriteRootFile(netplanFile, sb.String()); err != nil {
+		return nil, err
+	}
+	if err := runCommand("netplan", "apply"); err != nil {
+		return rollback, err
+	}
+	return rollback, nil
+}
+
+// --- NetworkManager ---
+
+type networkManagerBackend struct{}
+
+func (b *networkManagerBackend) Name() string { return "NetworkManager" }
+
+func (b *networkManagerBackend) Apply(cfg *NetworkConfig) (func() error, error) {
+	conn, err := b.connectionForDevice(cfg.Interface)
+	if err != nil {
+		return nil, err
+	}
+
+	// Snapshot current IPv4 settings for rollback
+	output, err := exec.Command("nmcli", "-t", "-f", "ipv4.method,ipv4.addresses,ipv4.gateway,ipv4.dns",
+		"connection", "show", conn).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read connection %s: %w", conn, err)
+	}
+	previous := []string{"connection", "modify", conn}
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) == 2 {
+			previous = append(previous, parts[0], parts[1])
+		}
+	}
+	rollback := func() error {
+		if err := runCommand("nmcli", previous...); err != nil {
+			return err
+		}
+		return runCommand("nmcli", "connection", "up", conn)
+	}
+
+	args := []string{"connection", "modify", conn}
+	if cfg.DHCP {
+		args = append(args, "ipv4.method", "auto", "ipv4.addresses", "", "ipv4.gateway", "", "ipv4.dns", "")
+	} else {
+		args = append(args, "ipv4.method", "manual",
+			"ipv4.addresses", cfg.Address,
+			"ipv4.gateway", cfg.Gateway,
+			"ipv4.dns", strings.Join(cfg.DNS, " "))
+	}
+
+	if err := runCommand("nmcli", args...); err != nil {
+		return nil, err
+	}
+	if err := runCommand("nmcli", "connection", "up", conn); err != nil {
+		return rollback, err
+	}
+	return rollback, nil
+}
+
+// connectionForDevice finds the active NetworkManager connection on an interface
+func (b *networkManagerBackend) connectionForDevice(device string) (string, error) {
+	output, err := exec.Command("nmcli", "-t", "-f", "NAME,DEVICE", "connection", "show", "--active").Output()
+	if err != nil {
+		return "", fmt.Errorf("nmcli failed: %w", err)
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		idx := strings.LastIndex(line, ":")
+		if idx > 0 && line[idx+1:] == device {
+			return line[:idx], nil
+		}
+	}
+	return "", fmt.Errorf("no active NetworkManager connection on %s", device)
+}
+
+// --- systemd-networkd ---
+
+type networkdBackend struct{}
+
+func (b *networkdBackend) Name() string { return "systemd-networkd" }
+
+func (b *networkdBackend) Apply(cfg *NetworkConfig) (func() error, error) {
+	path := filepath.Join("/etc/systemd/network", fmt.Sprintf("10-bloxos-%s.network", cfg.Interface))
+
+	previous, readErr := os.ReadFile(path)
+	rollback := func() error {
+		if readErr == nil {
+			if err := system.WriteRootFile(path, string(previous)); err != nil {
+				return err
+			}
+		} else if err := system.RemoveRootFile(path); err != nil {
+			return err
+		}
+		return runCommand("systemctl", "restart", "systemd-networkd")
+	}
+
+	var sb strings.Builder
+	sb.WriteString("# Managed by BloxOs agent\n")
+	fmt.Fprintf(&sb, "[Match]\nName=%s\n\n[Network]\n", cfg.Interface)
+	if cfg.DHCP {
+		sb.WriteString("DHCP=ipv4\n")
+	} else {
+		fmt.Fprintf(&sb, "Address=%s\nGateway=%s\n", cfg.Address, cfg.Gateway)
+		for _, dns := range cfg.DNS {
+			fmt.Fprintf(&sb, "DNS=%s\n", dns)
+		}
+	}
+
+	if err := system.WriteRootFile(path, sb.String()); err != nil {
+		return nil, err
+	}
+	if err := runCommand("systemctl", "restart", "systemd-networkd"); err != nil {
+		return rollback, err
+	}
+	return rollback, nil
+}
+
+// serviceActive reports whether a systemd unit is active
+func serviceActive(unit string) bool {
+	return exec.Command("systemctl", "is-active", "--quiet", unit).Run() == nil
+}
+
+// runCommand runs a command and includes its output in the error
+func runCommand(name string, args ...string) error {
+	output, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s: %v: %s", name, strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
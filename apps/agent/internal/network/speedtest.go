@@ -0,0 +1,200 @@
+package network
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Default public speed test endpoints (Cloudflare)
+const (
+	DefaultDownloadURL = "https://speed.cloudflare.com/__down?bytes=%d"
+	DefaultUploadURL   = "https://speed.cloudflare.com/__up"
+)
+
+// MaxSpeedTestBytes caps the transfer size; the upload is held in memory
+const MaxSpeedTestBytes = 100 * 1024 * 1024
+
+// SpeedTestConfig configures a speed test run
+type SpeedTestConfig struct {
+	ServerURL      string `json:"serverUrl"`      // Latency target (BloxOs server)
+	DownloadURL    string `json:"downloadUrl"`    // %d is replaced with the byte count
+	UploadURL      string `json:"uploadUrl"`      // Receives a POST body
+	Bytes          int    `json:"bytes"`          // Transfer size per direction
+	LatencySamples int    `json:"latencySamples"` // Number of TCP connects
+}
+
+// SpeedTestResult holds the measured bandwidth and latency
+type SpeedTestResult struct {
+	LatencyMs     float64  `json:"latencyMs"` // Median TCP connect time
+	LatencyMinMs  float64  `json:"latencyMinMs"`
+	LatencyMaxMs  float64  `json:"latencyMaxMs"`
+	JitterMs      float64  `json:"jitterMs"`
+	DownloadMbps  float64  `json:"downloadMbps"`
+	UploadMbps    float64  `json:"uploadMbps"`
+	DownloadBytes int64    `json:"downloadBytes"`
+	UploadBytes   int64    `json:"uploadBytes"`
+	Errors        []string `json:"errors,omitempty"`
+}
+
+// RunSpeedTest measures latency to the server and download/upload bandwidth
+func RunSpeedTest(cfg SpeedTestConfig) (*SpeedTestResult, error) {
+	if cfg.Bytes <= 0 {
+		cfg.Bytes = 25 * 1024 * 1024
+	}
+	if cfg.Bytes > MaxSpeedTestBytes {
+		return nil, fmt.Errorf("speed test size is limited to %d bytes", MaxSpeedTestBytes)
+	}
+	if cfg.LatencySamples <= 0 {
+		cfg.LatencySamples = 5
+	}
+	if cfg.DownloadURL == "" {
+		cfg.DownloadURL = DefaultDownloadURL
+	}
+	if cfg.UploadURL == "" {
+		cfg.UploadURL = DefaultUploadURL
+	}
+
+	result := &SpeedTestResult{}
+
+	if err := measureLatency(cfg, result); err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("latency: %v", err))
+	}
+	if err := measureDownload(cfg, result); err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("download: %v", err))
+	}
+	if err := measureUpload(cfg, result); err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("upload: %v", err))
+	}
+
+	if len(result.Errors) == 3 {
+		return nil, fmt.Errorf("speed test failed: %v", result.Errors)
+	}
+
+	return result, nil
+}
+
+// measureLatency times TCP connects to the server
+func measureLatency(cfg SpeedTestConfig, result *SpeedTestResult) error {
+	address, err := hostPort(cfg.ServerURL)
+	if err != nil {
+		return err
+	}
+
+	var samples []float64
+	for i := 0; i < cfg.LatencySamples; i++ {
+		start := time.Now()
+		conn, err := net.DialTimeout("tcp", address, 5*time.Second)
+		if err != nil {
+			return err
+		}
+		samples = append(samples, float64(time.Since(start).Microseconds())/1000)
+		conn.Close()
+	}
+
+	// Jitter is the mean difference between consecutive samples, in the
+	// order they were taken
+	if len(samples) > 1 {
+		var total float64
+		for i := 1; i < len(samples); i++ {
+			total += math.Abs(samples[i] - samples[i-1])
+		}
+		result.JitterMs = total / float64(len(samples)-1)
+	}
+
+	sort.Float64s(samples)
+	result.LatencyMinMs = samples[0]
+	result.LatencyMaxMs = samples[len(samples)-1]
+	result.LatencyMs = samples[len(samples)/2]
+
+	return nil
+}
+
+// measureDownload downloads cfg.Bytes and measures throughput
+func measureDownload(cfg SpeedTestConfig, result *SpeedTestResult) error {
+	client := &http.Client{Timeout: 2 * time.Minute}
+
+	target := cfg.DownloadURL
+	if strings.Contains(target, "%d") {
+		target = fmt.Sprintf(target, cfg.Bytes)
+	}
+
+	start := time.Now()
+	resp, err := client.Get(target)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	n, err := io.Copy(io.Discard, resp.Body)
+	if err != nil {
+		return err
+	}
+
+	result.DownloadBytes = n
+	result.DownloadMbps = mbps(n, time.Since(start))
+	return nil
+}
+
+// measureUpload uploads cfg.Bytes of random data and measures throughput
+func measureUpload(cfg SpeedTestConfig, result *SpeedTestResult) error {
+	client := &http.Client{Timeout: 2 * time.Minute}
+
+	payload := make([]byte, cfg.Bytes)
+	if _, err := rand.Read(payload); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	resp, err := client.Post(cfg.UploadURL, "application/octet-stream", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	result.UploadBytes = int64(len(payload))
+	result.UploadMbps = mbps(result.UploadBytes, time.Since(start))
+	return nil
+}
+
+// hostPort extracts a dialable host:port from a server URL
+func hostPort(serverURL string) (string, error) {
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid server URL: %w", err)
+	}
+	if u.Port() != "" {
+		return u.Host, nil
+	}
+	switch u.Scheme {
+	case "https", "wss":
+		return net.JoinHostPort(u.Hostname(), "443"), nil
+	default:
+		return net.JoinHostPort(u.Hostname(), "80"), nil
+	}
+}
+
+// mbps converts bytes transferred over a duration to megabits per second
+func mbps(n int64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(n*8) / d.Seconds() / 1000000
+}
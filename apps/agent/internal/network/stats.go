@@ -0,0 +1,18 @@
+package network
+
+// Stats holds network state included in the periodic stats payload
+type Stats struct {
+	Wifi []WifiStatus `json:"wifi,omitempty"`
+}
+
+// GetStats collects network stats, returning nil when there is nothing to report
+func GetStats() *Stats {
+	stats := &Stats{
+		Wifi: GetWifiStatus(),
+	}
+
+	if len(stats.Wifi) == 0 {
+		return nil
+	}
+	return stats
+}
@@ -0,0 +1,386 @@
+package network
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WifiNetwork is a network found by a scan
+type WifiNetwork struct {
+	SSID     string `json:"ssid"`
+	BSSID    string `json:"bssid"`
+	Signal   int    `json:"signal"` // Percent (nmcli) or dBm (wpa_supplicant)
+	Channel  int    `json:"channel,omitempty"`
+	Security string `json:"security"`
+}
+
+// WifiConfig holds credentials for a Wi-Fi network
+type WifiConfig struct {
+	Interface string `json:"interface"`
+	SSID      string `json:"ssid"`
+	PSK       string `json:"psk"`
+	Priority  int    `json:"priority"`
+	Connect   bool   `json:"connect"` // Connect immediately after saving
+}
+
+// WifiStatus is the current link state of a wireless interface
+type WifiStatus struct {
+	Interface string   `json:"interface"`
+	Connected bool     `json:"connected"`
+	SSID      string   `json:"ssid,omitempty"`
+	Signal    *int     `json:"signal,omitempty"`    // dBm
+	TxBitrate *float64 `json:"txBitrate,omitempty"` // Mbit/s
+	RxBitrate *float64 `json:"rxBitrate,omitempty"` // Mbit/s
+	Frequency *int     `json:"frequency,omitempty"` // MHz
+}
+
+// WifiInterfaces returns all wireless network interfaces
+func WifiInterfaces() []string {
+	var ifaces []string
+	entries, err := os.ReadDir("/sys/class/net")
+	if err != nil {
+		return nil
+	}
+	for _, entry := range entries {
+		if _, err := os.Stat(filepath.Join("/sys/class/net", entry.Name(), "wireless")); err == nil {
+			ifaces = append(ifaces, entry.Name())
+		}
+	}
+	return ifaces
+}
+
+// defaultWifiInterface returns iface or the first wireless interface
+func defaultWifiInterface(iface string) (string, error) {
+	if iface != "" {
+		return iface, nil
+	}
+	ifaces := WifiInterfaces()
+	if len(ifaces) == 0 {
+		return "", fmt.Errorf("no wireless interface found")
+	}
+	return ifaces[0], nil
+}
+
+// useNmcli reports whether NetworkManager manages Wi-Fi on this system
+func useNmcli() bool {
+	_, err := exec.LookPath("nmcli")
+	return err == nil && serviceActive("NetworkManager")
+}
+
+// ScanWifi scans for nearby Wi-Fi networks
+func ScanWifi(iface string) ([]WifiNetwork, error) {
+	iface, err := defaultWifiInterface(iface)
+	if err != nil {
+		return nil, err
+	}
+
+	if useNmcli() {
+		return scanWifiNmcli(iface)
+	}
+	if _, err := exec.LookPath("wpa_cli"); err == nil {
+		return scanWifiWpaCli(iface)
+	}
+	return nil, fmt.Errorf("neither NetworkManager nor wpa_supplicant is available")
+}
+
+func scanWifiNmcli(iface string) ([]WifiNetwork, error) {
+	output, err := exec.Command("nmcli", "-t", "-f", "SSID,BSSID,SIGNAL,CHAN,SECURITY",
+		"device", "wifi", "list", "ifname", iface, "--rescan", "yes").Output()
+	if err != nil {
+		return nil, fmt.Errorf("nmcli scan failed: %w", err)
+	}
+
+	var networks []WifiNetwork
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		fields := splitTerse(line)
+		if len(fields) < 5 || fields[0] == "" {
+			continue
+		}
+		signal, _ := strconv.Atoi(fields[2])
+		channel, _ := strconv.Atoi(fields[3])
+		networks = append(networks, WifiNetwork{
+			SSID:     fields[0],
+			BSSID:    fields[1],
+			Signal:   signal,
+			Channel:  channel,
+			Security: fields[4],
+		})
+	}
+	return networks, nil
+}
+
+func scanWifiWpaCli(iface string) ([]WifiNetwork, error) {
+	if err := runCommand("wpa_cli", "-i", iface, "scan"); err != nil {
+		return nil, err
+	}
+	time.Sleep(5 * time.Second)
+
+	output, err := exec.Command("wpa_cli", "-i", iface, "scan_results").Output()
+	if err != nil {
+		return nil, fmt.Errorf("wpa_cli scan_results failed: %w", err)
+	}
+
+	// bssid / frequency / signal level / flags / ssid
+	var networks []WifiNetwork
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) < 5 || fields[4] == "" {
+			continue
+		}
+		signal, _ := strconv.Atoi(fields[2])
+		networks = append(networks, WifiNetwork{
+			SSID:     fields[4],
+			BSSID:    fields[0],
+			Signal:   signal,
+			Security: fields[3],
+		})
+	}
+	return networks, nil
+}
+
+// ConfigureWifi saves credentials for a network and optionally connects to it
+func ConfigureWifi(cfg *WifiConfig) error {
+	if cfg.SSID == "" {
+		return fmt.Errorf("ssid required")
+	}
+	if cfg.PSK != "" && (len(cfg.PSK) < 8 || len(cfg.PSK) > 63) {
+		return fmt.Errorf("psk must be 8-63 characters")
+	}
+
+	iface, err := defaultWifiInterface(cfg.Interface)
+	if err != nil {
+		return err
+	}
+
+	if useNmcli() {
+		return configureWifiNmcli(iface, cfg)
+	}
+	if _, err := exec.LookPath("wpa_cli"); err == nil {
+		return configureWifiWpaCli(iface, cfg)
+	}
+	return fmt.Errorf("neither NetworkManager nor wpa_supplicant is available")
+}
+
+func configureWifiNmcli(iface string, cfg *WifiConfig) error {
+	name := "bloxos-" + cfg.SSID
+
+	// Recreate the connection so stale credentials never linger
+	exec.Command("nmcli", "connection", "delete", name).Run()
+
+	args := []string{"connection", "add", "type", "wifi", "ifname", iface,
+		"con-name", name, "ssid", cfg.SSID,
+		"connection.autoconnect-priority", strconv.Itoa(cfg.Priority)}
+	if cfg.PSK != "" {
+		args = append(args, "wifi-sec.key-mgmt", "wpa-psk", "wifi-sec.psk", cfg.PSK)
+	}
+	// Not runCommand: the arguments contain the PSK and must not end up in errors
+	if output, err := exec.Command("nmcli", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("nmcli connection add: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	if cfg.Connect {
+		return runCommand("nmcli", "connection", "up", name)
+	}
+	return nil
+}
+
+func configureWifiWpaCli(iface string, cfg *WifiConfig) error {
+	// Remove any existing entry for this SSID
+	if id, err := wpaNetworkID(iface, cfg.SSID); err == nil {
+		runCommand("wpa_cli", "-i", iface, "remove_network", id)
+	}
+
+	output, err := exec.Command("wpa_cli", "-i", iface, "add_network").Output()
+	if err != nil {
+		return fmt.Errorf("wpa_cli add_network failed: %w", err)
+	}
+	id := strings.TrimSpace(string(output))
+
+	settings := [][]string{
+		{"ssid", strconv.Quote(cfg.SSID)},
+		{"priority", strconv.Itoa(cfg.Priority)},
+	}
+	if cfg.PSK != "" {
+		settings = append(settings, []string{"psk", strconv.Quote(cfg.PSK)})
+	} else {
+		settings = append(settings, []string{"key_mgmt", "NONE"})
+	}
+	for _, kv := range settings {
+		if err := wpaCliOK(iface, "set_network", id, kv[0], kv[1]); err != nil {
+			return err
+		}
+	}
+
+	if cfg.Connect {
+		if err := wpaCliOK(iface, "select_network", id); err != nil {
+			return err
+		}
+	}
+	if err := wpaCliOK(iface, "enable_network", id); err != nil {
+		return err
+	}
+	return wpaCliOK(iface, "save_config")
+}
+
+// PrioritizeWifi changes the autoconnect priority of a saved network
+func PrioritizeWifi(iface, ssid string, priority int) error {
+	iface, err := defaultWifiInterface(iface)
+	if err != nil {
+		return err
+	}
+
+	if useNmcli() {
+		name, err := nmcliConnectionForSSID(ssid)
+		if err != nil {
+			return err
+		}
+		return runCommand("nmcli", "connection", "modify", name,
+			"connection.autoconnect-priority", strconv.Itoa(priority))
+	}
+
+	id, err := wpaNetworkID(iface, ssid)
+	if err != nil {
+		return err
+	}
+	if err := wpaCliOK(iface, "set_network", id, "priority", strconv.Itoa(priority)); err != nil {
+		return err
+	}
+	return wpaCliOK(iface, "save_config")
+}
+
+// nmcliConnectionForSSID finds the saved NetworkManager connection for an SSID
+func nmcliConnectionForSSID(ssid string) (string, error) {
+	output, err := exec.Command("nmcli", "-t", "-f", "NAME,TYPE", "connection", "show").Output()
+	if err != nil {
+		return "", fmt.Errorf("nmcli failed: %w", err)
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := splitTerse(line)
+		if len(fields) < 2 || fields[1] != "802-11-wireless" {
+			continue
+		}
+		connSSID, err := exec.Command("nmcli", "-g", "802-11-wireless.ssid", "connection", "show", fields[0]).Output()
+		if err == nil && strings.TrimSpace(string(connSSID)) == ssid {
+			return fields[0], nil
+		}
+	}
+	return "", fmt.Errorf("no saved connection for SSID %q", ssid)
+}
+
+// wpaNetworkID finds the wpa_supplicant network id for an SSID
+func wpaNetworkID(iface, ssid string) (string, error) {
+	output, err := exec.Command("wpa_cli", "-i", iface, "list_networks").Output()
+	if err != nil {
+		return "", fmt.Errorf("wpa_cli list_networks failed: %w", err)
+	}
+	// network id / ssid / bssid / flags
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) >= 2 && fields[1] == ssid {
+			return fields[0], nil
+		}
+	}
+	return "", fmt.Errorf("no saved network for SSID %q", ssid)
+}
+
+// wpaCliOK runs a wpa_cli command and checks for an "OK" reply
+func wpaCliOK(iface string, args ...string) error {
+	output, err := exec.Command("wpa_cli", append([]string{"-i", iface}, args...)...).Output()
+	if err != nil {
+		return fmt.Errorf("wpa_cli %s failed: %w", args[0], err)
+	}
+	if reply := strings.TrimSpace(string(output)); reply != "OK" {
+		return fmt.Errorf("wpa_cli %s: %s", args[0], reply)
+	}
+	return nil
+}
+
+// GetWifiStatus returns the link state of all wireless interfaces
+func GetWifiStatus() []WifiStatus {
+	var statuses []WifiStatus
+	for _, iface := range WifiInterfaces() {
+		statuses = append(statuses, getWifiLink(iface))
+	}
+	return statuses
+}
+
+// getWifiLink parses `iw dev <iface> link`
+func getWifiLink(iface string) WifiStatus {
+	status := WifiStatus{Interface: iface}
+
+	output, err := exec.Command("iw", "dev", iface, "link").Output()
+	if err != nil {
+		return status
+	}
+
+	// Connected to aa:bb:cc:dd:ee:ff (on wlan0)
+	//     SSID: MyNetwork
+	//     freq: 2437
+	//     signal: -52 dBm
+	//     rx bitrate: 72.2 MBit/s
+	//     tx bitrate: 65.0 MBit/s MCS 7 short GI
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "Connected to"):
+			status.Connected = true
+		case strings.HasPrefix(line, "SSID:"):
+			status.SSID = strings.TrimSpace(strings.TrimPrefix(line, "SSID:"))
+		case strings.HasPrefix(line, "freq:"):
+			if f, err := strconv.ParseFloat(firstField(strings.TrimPrefix(line, "freq:")), 64); err == nil {
+				freq := int(f)
+				status.Frequency = &freq
+			}
+		case strings.HasPrefix(line, "signal:"):
+			if signal, err := strconv.Atoi(firstField(strings.TrimPrefix(line, "signal:"))); err == nil {
+				status.Signal = &signal
+			}
+		case strings.HasPrefix(line, "rx bitrate:"):
+			if rate, err := strconv.ParseFloat(firstField(strings.TrimPrefix(line, "rx bitrate:")), 64); err == nil {
+				status.RxBitrate = &rate
+			}
+		case strings.HasPrefix(line, "tx bitrate:"):
+			if rate, err := strconv.ParseFloat(firstField(strings.TrimPrefix(line, "tx bitrate:")), 64); err == nil {
+				status.TxBitrate = &rate
+			}
+		}
+	}
+
+	return status
+}
+
+// firstField returns the first whitespace-separated field of s
+func firstField(s string) string {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+// splitTerse splits nmcli terse output, honoring \: and \\ escapes
+func splitTerse(line string) []string {
+	var fields []string
+	var current strings.Builder
+	escaped := false
+	for _, r := range line {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == ':':
+			fields = append(fields, current.String())
+			current.Reset()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	return append(fields, current.String())
+}
@@ -0,0 +1,179 @@
+package platform
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing/fstest"
+)
+
+// Fake is an in-memory Runner and FS for tests. Commands return recorded
+// output keyed by their full command line; files live in a map keyed by
+// absolute path. Writes land in the same map so tests can assert on them.
+type Fake struct {
+	mu      sync.Mutex
+	outputs map[string]FakeResult
+	files   fstest.MapFS
+	calls   []string
+}
+
+// FakeResult is the recorded result of a command
+type FakeResult struct {
+	Output []byte
+	Err    error
+}
+
+// NewFake creates an empty fake host
+func NewFake() *Fake {
+	return &Fake{
+		outputs: map[string]FakeResult{},
+		files:   fstest.MapFS{},
+	}
+}
+
+// SetOutput records the output of a command line, e.g.
+// SetOutput("nvidia-smi --query-gpu=index --format=csv", "0\n1\n")
+func (f *Fake) SetOutput(cmdline, output string) {
+	f.SetResult(cmdline, FakeResult{Output: []byte(output)})
+}
+
+// SetResult records the output and error of a command line
+func (f *Fake) SetResult(cmdline string, result FakeResult) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.outputs[cmdline] = result
+}
+
+// SetFile creates or replaces a file; parent directories are implied
+func (f *Fake) SetFile(path, content string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.files[fakePath(path)] = &fstest.MapFile{Data: []byte(content), Mode: 0644}
+}
+
+// File returns the content of a file and whether it exists
+func (f *Fake) File(path string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	file, ok := f.files[fakePath(path)]
+	if !ok {
+		return "", false
+	}
+	return string(file.Data), true
+}
+
+// Calls returns the command lines run so far
+func (f *Fake) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+// LookPath finds commands that have recorded output
+func (f *Fake) LookPath(file string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for cmdline := range f.outputs {
+		if cmdline == file || strings.HasPrefix(cmdline, file+" ") {
+			return file, nil
+		}
+	}
+	return "", &exec.Error{Name: file, Err: exec.ErrNotFound}
+}
+
+// Command returns a command that replays the recorded result
+func (f *Fake) Command(name string, args ...string) Cmd {
+	return &fakeCmd{fake: f, cmdline: strings.Join(append([]string{name}, args...), " ")}
+}
+
+func (f *Fake) ReadFile(path string) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.files.ReadFile(fakePath(path))
+}
+
+func (f *Fake) WriteFile(path string, data []byte, perm os.FileMode) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.files[fakePath(path)] = &fstest.MapFile{Data: append([]byte(nil), data...), Mode: perm}
+	return nil
+}
+
+func (f *Fake) ReadDir(path string) ([]os.DirEntry, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.files.ReadDir(fakePath(path))
+}
+
+func (f *Fake) Stat(path string) (os.FileInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.files.Stat(fakePath(path))
+}
+
+// fakePath converts an absolute path to an io/fs path
+func fakePath(path string) string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return "."
+	}
+	return path
+}
+
+type fakeCmd struct {
+	fake    *Fake
+	cmdline string
+	stdout  []byte
+	err     error
+}
+
+func (c *fakeCmd) Output() ([]byte, error) {
+	c.fake.mu.Lock()
+	defer c.fake.mu.Unlock()
+	c.fake.calls = append(c.fake.calls, c.cmdline)
+	result, ok := c.fake.outputs[c.cmdline]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", c.cmdline, fs.ErrNotExist)
+	}
+	return result.Output, result.Err
+}
+
+// StdoutPipe, Start and Wait stream the recorded output at once
+func (c *fakeCmd) StdoutPipe() (io.ReadCloser, error) {
+	return io.NopCloser(readerFunc(func(p []byte) (int, error) {
+		if len(c.stdout) == 0 {
+			return 0, io.EOF
+		}
+		n := copy(p, c.stdout)
+		c.stdout = c.stdout[n:]
+		return n, nil
+	})), nil
+}
+
+func (c *fakeCmd) Start() error {
+	c.stdout, c.err = c.Output()
+	return c.err
+}
+
+func (c *fakeCmd) Wait() error {
+	return c.err
+}
+
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
+
+func (c *fakeCmd) CombinedOutput() ([]byte, error) {
+	return c.Output()
+}
+
+func (c *fakeCmd) Run() error {
+	_, err := c.Output()
+	return err
+}
@@ -0,0 +1,72 @@
+// Package platform abstracts how the agent talks to the host: running
+// vendor tools (nvidia-smi, rocm-smi, lspci, ...) and reading or writing
+// sysfs. The collector and executor go through these interfaces so they
+// can run against recorded tool output in tests and, later, against other
+// backends (NVML, Windows) without changing callers.
+//
+// Long-running processes the agent manages itself (miners, vBIOS flashes)
+// still use os/exec directly.
+package platform
+
+import (
+	"io"
+	"os"
+	"os/exec"
+)
+
+// Runner runs external commands
+type Runner interface {
+	// LookPath resolves a command name like exec.LookPath
+	LookPath(file string) (string, error)
+	// Command prepares a command; *exec.Cmd satisfies Cmd
+	Command(name string, args ...string) Cmd
+}
+
+// Cmd is the part of *exec.Cmd the agent uses for tool commands
+type Cmd interface {
+	Output() ([]byte, error)
+	CombinedOutput() ([]byte, error)
+	Run() error
+
+	// Streaming, for tools run in loop mode
+	StdoutPipe() (io.ReadCloser, error)
+	Start() error
+	Wait() error
+}
+
+// FS reads and writes host files (sysfs, procfs, /dev)
+type FS interface {
+	ReadFile(path string) ([]byte, error)
+	WriteFile(path string, data []byte, perm os.FileMode) error
+	ReadDir(path string) ([]os.DirEntry, error)
+	Stat(path string) (os.FileInfo, error)
+}
+
+// Host is the production implementation backed by os and os/exec
+var Host = host{}
+
+type host struct{}
+
+func (host) LookPath(file string) (string, error) {
+	return exec.LookPath(file)
+}
+
+func (host) Command(name string, args ...string) Cmd {
+	return exec.Command(name, args...)
+}
+
+func (host) ReadFile(path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
+
+func (host) WriteFile(path string, data []byte, perm os.FileMode) error {
+	return os.WriteFile(path, data, perm)
+}
+
+func (host) ReadDir(path string) ([]os.DirEntry, error) {
+	return os.ReadDir(path)
+}
+
+func (host) Stat(path string) (os.FileInfo, error) {
+	return os.Stat(path)
+}
@@ -0,0 +1,148 @@
+package plugins
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// CollectTimeout bounds a collector plugin, so a hung one can't delay
+	// the stats
+	CollectTimeout = 10 * time.Second
+
+	// CommandTimeout bounds a command plugin
+	CommandTimeout = 5 * time.Minute
+
+	// maxOutput is the most stdout a plugin may print
+	maxOutput = 1 << 20
+)
+
+// Dir is where plugins of a kind ("collectors", "commands") are installed
+func Dir(kind string) string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".bloxos", "plugins", kind)
+}
+
+// List returns the runnable plugins in dir by name (the file name without
+// extension). Files anyone can write to are skipped, since the agent runs
+// them with its privileges, usually root.
+func List(dir string) map[string]string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	found := make(map[string]string)
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.Mode()&0111 == 0 || info.Mode()&0002 != 0 {
+			continue
+		}
+		name := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		found[name] = filepath.Join(dir, entry.Name())
+	}
+	return found
+}
+
+// Find returns the path of the plugin called name in dir, or "" if there
+// is none
+func Find(dir, name string) string {
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return ""
+	}
+	return List(dir)[name]
+}
+
+// Run runs a plugin with input on stdin and decodes the JSON it prints.
+// Anything on stderr is returned with the error. env is added to the
+// agent's environment.
+func Run(ctx context.Context, path string, input []byte, env ...string) (interface{}, error) {
+	output, err := RunScript(ctx, path, input, env...)
+	if err != nil {
+		return nil, err
+	}
+	if len(output) == 0 {
+		return nil, nil
+	}
+
+	var result interface{}
+	if err := json.Unmarshal(output, &result); err != nil {
+		return nil, fmt.Errorf("invalid JSON output: %v", err)
+	}
+	return result, nil
+}
+
+// RunScript runs a plugin like Run but returns what it prints as is,
+// trimmed, for scripts that don't speak JSON
+func RunScript(ctx context.Context, path string, input []byte, env ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Dir = filepath.Dir(path)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.WaitDelay = time.Second // Don't wait on children holding stdout
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("timed out")
+		}
+		if detail := strings.TrimSpace(stderr.String()); detail != "" {
+			return nil, fmt.Errorf("%v: %s", err, lastLine(detail))
+		}
+		return nil, err
+	}
+	if stdout.Len() > maxOutput {
+		return nil, fmt.Errorf("output over %d bytes", maxOutput)
+	}
+	return bytes.TrimSpace(stdout.Bytes()), nil
+}
+
+// Collect runs every collector plugin in dir at once and returns their
+// output and failures by plugin name
+func Collect(dir string) (map[string]interface{}, map[string]string) {
+	found := List(dir)
+	if len(found) == 0 {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), CollectTimeout)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[string]interface{})
+	failures := make(map[string]string)
+	for name, path := range found {
+		wg.Add(1)
+		go func(name, path string) {
+			defer wg.Done()
+			result, err := Run(ctx, path, nil)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failures[name] = err.Error()
+			} else if result != nil {
+				results[name] = result
+			}
+		}(name, path)
+	}
+	wg.Wait()
+	return results, failures
+}
+
+func lastLine(s string) string {
+	lines := strings.Split(s, "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
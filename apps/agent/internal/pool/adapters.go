@@ -0,0 +1,330 @@
+package pool
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// --- 2miners (open-ethereum-pool API) ---
+
+type twoMinersAdapter struct {
+	apiBase string
+}
+
+func (a *twoMinersAdapter) Name() string { return "2miners" }
+
+func (a *twoMinersAdapter) Fetch(wallet, worker string) (*Stats, error) {
+	wallet, worker = splitWallet(wallet, worker)
+
+	var data struct {
+		CurrentHashrate float64 `json:"currentHashrate"`
+		Hashrate        float64 `json:"hashrate"`
+		WorkersOnline   int     `json:"workersOnline"`
+		Stats           struct {
+			Balance   float64 `json:"balance"` // Gwei-style base units
+			LastShare int64   `json:"lastShare"`
+		} `json:"stats"`
+		Workers map[string]struct {
+			HR            float64 `json:"hr"`  // Short window
+			HR2           float64 `json:"hr2"` // Long window
+			ReportedHR    float64 `json:"rhr"`
+			Offline       bool    `json:"offline"`
+			LastBeat      int64   `json:"lastBeat"`
+			SharesValid   int     `json:"sharesValid"`
+			SharesStale   int     `json:"sharesStale"`
+			SharesInvalid int     `json:"sharesInvalid"`
+		} `json:"workers"`
+	}
+	if err := getJSON(fmt.Sprintf("%s/accounts/%s", a.apiBase, url.PathEscape(wallet)), &data); err != nil {
+		return nil, err
+	}
+
+	stats := &Stats{
+		Pool:              a.Name(),
+		Wallet:            wallet,
+		Worker:            worker,
+		UnpaidBalance:     floatPtr(data.Stats.Balance / 1e9),
+		EffectiveHashrate: floatPtr(data.CurrentHashrate),
+		AverageHashrate:   floatPtr(data.Hashrate),
+		WorkersOnline:     intPtr(data.WorkersOnline),
+	}
+	if data.Stats.LastShare > 0 {
+		stats.LastShare = int64Ptr(data.Stats.LastShare)
+	}
+
+	if w, ok := data.Workers[worker]; ok && worker != "" {
+		stats.EffectiveHashrate = floatPtr(w.HR)
+		stats.AverageHashrate = floatPtr(w.HR2)
+		stats.ReportedHashrate = floatPtr(w.ReportedHR)
+		stats.WorkerOnline = boolPtr(!w.Offline)
+		stats.LastShare = int64Ptr(w.LastBeat)
+		stats.ValidShares = intPtr(w.SharesValid)
+		stats.StaleShares = intPtr(w.SharesStale)
+		stats.InvalidShares = intPtr(w.SharesInvalid)
+	} else if worker != "" {
+		stats.WorkerOnline = boolPtr(false)
+	}
+
+	return stats, nil
+}
+
+// --- Ethermine-style API (ethermine, etc.ethermine) ---
+
+type ethermineAdapter struct {
+	apiBase string
+}
+
+// ethermineAPIBase maps stratum hosts (us1-etc.ethermine.org) to API hosts
+func ethermineAPIBase(host string) string {
+	if strings.Contains(host, "etc") {
+		return "https://api-etc.ethermine.org"
+	}
+	return "https://api.ethermine.org"
+}
+
+func (a *ethermineAdapter) Name() string { return "ethermine" }
+
+func (a *ethermineAdapter) Fetch(wallet, worker string) (*Stats, error) {
+	wallet, worker = splitWallet(wallet, worker)
+
+	var current struct {
+		Status string `json:"status"`
+		Data   struct {
+			Unpaid           float64 `json:"unpaid"` // Wei
+			CurrentHashrate  float64 `json:"currentHashrate"`
+			ReportedHashrate float64 `json:"reportedHashrate"`
+			AverageHashrate  float64 `json:"averageHashrate"`
+			ActiveWorkers    int     `json:"activeWorkers"`
+			LastSeen         int64   `json:"lastSeen"`
+			ValidShares      int     `json:"validShares"`
+			StaleShares      int     `json:"staleShares"`
+			InvalidShares    int     `json:"invalidShares"`
+		} `json:"data"`
+	}
+	if err := getJSON(fmt.Sprintf("%s/miner/%s/currentStats", a.apiBase, url.PathEscape(wallet)), &current); err != nil {
+		return nil, err
+	}
+	if current.Status != "OK" {
+		return nil, fmt.Errorf("pool API status: %s", current.Status)
+	}
+
+	d := current.Data
+	stats := &Stats{
+		Pool:              a.Name(),
+		Wallet:            wallet,
+		Worker:            worker,
+		UnpaidBalance:     floatPtr(d.Unpaid / 1e18),
+		ReportedHashrate:  floatPtr(d.ReportedHashrate),
+		EffectiveHashrate: floatPtr(d.CurrentHashrate),
+		AverageHashrate:   floatPtr(d.AverageHashrate),
+		WorkersOnline:     intPtr(d.ActiveWorkers),
+		LastShare:         int64Ptr(d.LastSeen),
+		ValidShares:       intPtr(d.ValidShares),
+		StaleShares:       intPtr(d.StaleShares),
+		InvalidShares:     intPtr(d.InvalidShares),
+	}
+
+	if worker == "" {
+		return stats, nil
+	}
+
+	var workers struct {
+		Data []struct {
+			Worker           string  `json:"worker"`
+			CurrentHashrate  float64 `json:"currentHashrate"`
+			ReportedHashrate float64 `json:"reportedHashrate"`
+			LastSeen         int64   `json:"lastSeen"`
+			ValidShares      int     `json:"validShares"`
+			StaleShares      int     `json:"staleShares"`
+			InvalidShares    int     `json:"invalidShares"`
+		} `json:"data"`
+	}
+	if err := getJSON(fmt.Sprintf("%s/miner/%s/workers", a.apiBase, url.PathEscape(wallet)), &workers); err != nil {
+		return stats, nil // Account stats are still useful
+	}
+
+	stats.WorkerOnline = boolPtr(false)
+	for _, w := range workers.Data {
+		if w.Worker != worker {
+			continue
+		}
+		stats.ReportedHashrate = floatPtr(w.ReportedHashrate)
+		stats.EffectiveHashrate = floatPtr(w.CurrentHashrate)
+		stats.LastShare = int64Ptr(w.LastSeen)
+		stats.ValidShares = intPtr(w.ValidShares)
+		stats.StaleShares = intPtr(w.StaleShares)
+		stats.InvalidShares = intPtr(w.InvalidShares)
+		stats.ShareWindow = 3600 // Worker share counts cover the last hour
+		// Ethermine drops workers after ~10 minutes without shares
+		stats.WorkerOnline = boolPtr(time.Since(time.Unix(w.LastSeen, 0)) < 10*time.Minute)
+	}
+
+	return stats, nil
+}
+
+// --- Kryptex ---
+
+type kryptexAdapter struct {
+	coin string
+}
+
+// newKryptexAdapter derives the coin from stratum hosts like etc.kryptex.network
+func newKryptexAdapter(host string) (Adapter, bool) {
+	labels := strings.Split(host, ".")
+	if len(labels) < 3 {
+		return nil, false
+	}
+	// Region-prefixed hosts: etc-eu.kryptex.network
+	coin := strings.SplitN(labels[0], "-", 2)[0]
+	return &kryptexAdapter{coin: coin}, true
+}
+
+func (a *kryptexAdapter) Name() string { return "kryptex" }
+
+func (a *kryptexAdapter) Fetch(wallet, worker string) (*Stats, error) {
+	wallet, worker = splitWallet(wallet, worker)
+
+	var data struct {
+		Balance struct {
+			Unpaid float64 `json:"unpaid"` // Coin units
+		} `json:"balance"`
+		Hashrate struct {
+			Reported  float64 `json:"reported"`
+			Effective float64 `json:"current"`
+			Average   float64 `json:"average24h"`
+		} `json:"hashrate"`
+		Workers []struct {
+			Name      string  `json:"name"`
+			Online    bool    `json:"online"`
+			Reported  float64 `json:"reported_hashrate"`
+			Effective float64 `json:"hashrate"`
+			LastShare int64   `json:"last_share"`
+			Valid     int     `json:"valid_shares"`
+			Stale     int     `json:"stale_shares"`
+			Invalid   int     `json:"invalid_shares"`
+		} `json:"workers"`
+	}
+	apiURL := fmt.Sprintf("https://pool.kryptex.com/%s/api/v1/miner/stats/%s", a.coin, url.PathEscape(wallet))
+	if err := getJSON(apiURL, &data); err != nil {
+		return nil, err
+	}
+
+	stats := &Stats{
+		Pool:              a.Name(),
+		Wallet:            wallet,
+		Worker:            worker,
+		UnpaidBalance:     floatPtr(data.Balance.Unpaid),
+		ReportedHashrate:  floatPtr(data.Hashrate.Reported),
+		EffectiveHashrate: floatPtr(data.Hashrate.Effective),
+		AverageHashrate:   floatPtr(data.Hashrate.Average),
+	}
+
+	online := 0
+	for _, w := range data.Workers {
+		if w.Online {
+			online++
+		}
+		if worker != "" && w.Name == worker {
+			stats.WorkerOnline = boolPtr(w.Online)
+			stats.ReportedHashrate = floatPtr(w.Reported)
+			stats.EffectiveHashrate = floatPtr(w.Effective)
+			stats.LastShare = int64Ptr(w.LastShare)
+			stats.ValidShares = intPtr(w.Valid)
+			stats.StaleShares = intPtr(w.Stale)
+			stats.InvalidShares = intPtr(w.Invalid)
+		}
+	}
+	stats.WorkersOnline = intPtr(online)
+	if worker != "" && stats.WorkerOnline == nil {
+		stats.WorkerOnline = boolPtr(false)
+	}
+
+	return stats, nil
+}
+
+// --- HeroMiners (cryptonote-nodejs-pool API) ---
+
+type heroMinersAdapter struct {
+	apiBase string
+}
+
+// newHeroMinersAdapter derives the API host from stratum hosts like
+// de.kaspa.herominers.com
+func newHeroMinersAdapter(host string) (Adapter, bool) {
+	labels := strings.Split(host, ".")
+	if len(labels) < 3 {
+		return nil, false
+	}
+	// The coin is the label right before herominers.com
+	coin := labels[len(labels)-3]
+	return &heroMinersAdapter{apiBase: fmt.Sprintf("https://%s.herominers.com/api", coin)}, true
+}
+
+func (a *heroMinersAdapter) Name() string { return "herominers" }
+
+func (a *heroMinersAdapter) Fetch(wallet, worker string) (*Stats, error) {
+	wallet, worker = splitWallet(wallet, worker)
+
+	// Balances are in atomic units; the divisor comes from the pool config
+	var poolInfo struct {
+		Config struct {
+			CoinUnits float64 `json:"coinUnits"`
+		} `json:"config"`
+	}
+	if err := getJSON(a.apiBase+"/stats", &poolInfo); err != nil {
+		return nil, err
+	}
+
+	var data struct {
+		Stats struct {
+			Balance    string  `json:"balance"`
+			Hashrate   float64 `json:"hashrate"`
+			Hashrate24 float64 `json:"hashrate_24h"`
+			LastShare  string  `json:"lastShare"`
+		} `json:"stats"`
+		Workers []struct {
+			Name      string  `json:"name"`
+			Hashrate  float64 `json:"hashrate"`
+			LastShare int64   `json:"lastShare"`
+		} `json:"workers"`
+	}
+	apiURL := fmt.Sprintf("%s/stats_address?address=%s&longpoll=false", a.apiBase, url.QueryEscape(wallet))
+	if err := getJSON(apiURL, &data); err != nil {
+		return nil, err
+	}
+
+	stats := &Stats{
+		Pool:              a.Name(),
+		Wallet:            wallet,
+		Worker:            worker,
+		EffectiveHashrate: floatPtr(data.Stats.Hashrate),
+		AverageHashrate:   floatPtr(data.Stats.Hashrate24),
+	}
+
+	var balance float64
+	if _, err := fmt.Sscan(data.Stats.Balance, &balance); err == nil && poolInfo.Config.CoinUnits > 0 {
+		stats.UnpaidBalance = floatPtr(balance / poolInfo.Config.CoinUnits)
+	}
+
+	online := 0
+	for _, w := range data.Workers {
+		// Workers are listed while they have hashrate in the window
+		isOnline := w.Hashrate > 0
+		if isOnline {
+			online++
+		}
+		if worker != "" && w.Name == worker {
+			stats.WorkerOnline = boolPtr(isOnline)
+			stats.EffectiveHashrate = floatPtr(w.Hashrate)
+			stats.LastShare = int64Ptr(w.LastShare)
+		}
+	}
+	stats.WorkersOnline = intPtr(online)
+	if worker != "" && stats.WorkerOnline == nil {
+		stats.WorkerOnline = boolPtr(false)
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,139 @@
+package pool
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Audit thresholds: a divergence is only reported with enough shares for
+// the difference to be meaningful
+const (
+	auditMinShares     = 20
+	auditMaxDivergence = 0.25
+	auditHistory       = 25 * time.Hour
+	auditRealertAfter  = time.Hour
+)
+
+// ShareAudit compares the miner's accepted shares with the pool's count
+// over the pool's share window
+type ShareAudit struct {
+	Window      int     `json:"window"`      // Seconds
+	MinerShares int     `json:"minerShares"` // Accepted per the miner
+	PoolShares  int     `json:"poolShares"`  // Valid + stale per the pool
+	Divergence  float64 `json:"divergence"`  // Relative to the miner's count
+	Divergent   bool    `json:"divergent"`
+	Message     string  `json:"message,omitempty"`
+}
+
+type shareSample struct {
+	time     time.Time
+	accepted int
+}
+
+// Auditor keeps a history of miner-reported accepted shares to reconcile
+// against pool-reported shares. Missing shares at the pool point at dev-fee
+// abuse or a hijacked connection; extra shares at another rig using the
+// same worker name.
+type Auditor struct {
+	mu        sync.Mutex
+	samples   []shareSample
+	lastAlert time.Time
+}
+
+// NewAuditor creates an empty share auditor
+func NewAuditor() *Auditor {
+	return &Auditor{}
+}
+
+// Record adds the miner's cumulative accepted share count
+func (a *Auditor) Record(accepted int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	a.samples = append(a.samples, shareSample{time: now, accepted: accepted})
+
+	cutoff := now.Add(-auditHistory)
+	drop := 0
+	for drop < len(a.samples)-1 && a.samples[drop].time.Before(cutoff) {
+		drop++
+	}
+	a.samples = a.samples[drop:]
+}
+
+// Audit reconciles pool stats with the recorded history. It returns nil
+// when the pool doesn't report windowed shares or history is too short.
+func (a *Auditor) Audit(stats *Stats) *ShareAudit {
+	if stats.ShareWindow <= 0 || stats.ValidShares == nil {
+		return nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	start := time.Now().Add(-time.Duration(stats.ShareWindow) * time.Second)
+	if len(a.samples) == 0 || a.samples[0].time.After(start) {
+		return nil // Not mining long enough to cover the window
+	}
+
+	// Sum increments inside the window; a drop means the miner restarted
+	mined := 0
+	for i := 1; i < len(a.samples); i++ {
+		if a.samples[i].time.Before(start) {
+			continue
+		}
+		delta := a.samples[i].accepted - a.samples[i-1].accepted
+		if delta < 0 {
+			delta = a.samples[i].accepted
+		}
+		mined += delta
+	}
+
+	counted := *stats.ValidShares
+	if stats.StaleShares != nil {
+		counted += *stats.StaleShares
+	}
+
+	audit := &ShareAudit{
+		Window:      stats.ShareWindow,
+		MinerShares: mined,
+		PoolShares:  counted,
+	}
+	if mined < auditMinShares && counted < auditMinShares {
+		return audit
+	}
+
+	base := math.Max(float64(mined), 1)
+	audit.Divergence = math.Round((float64(counted)-float64(mined))/base*1000) / 1000
+	if math.Abs(audit.Divergence) > auditMaxDivergence {
+		audit.Divergent = true
+		window := time.Duration(stats.ShareWindow) * time.Second
+		if counted < mined {
+			audit.Message = fmt.Sprintf("miner reported %d accepted shares in the last %s but %s counted %d (%.0f%% missing): check for dev-fee abuse or a hijacked pool connection",
+				mined, window, stats.Pool, counted, -audit.Divergence*100)
+		} else {
+			audit.Message = fmt.Sprintf("%s counted %d shares in the last %s but the miner reported %d: another rig may be using worker %q",
+				stats.Pool, counted, window, mined, stats.Worker)
+		}
+	}
+	return audit
+}
+
+// ShouldAlert reports whether a divergent audit should raise an event,
+// limiting repeats while the divergence persists
+func (a *Auditor) ShouldAlert(audit *ShareAudit) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if audit == nil || !audit.Divergent {
+		a.lastAlert = time.Time{}
+		return false
+	}
+	if time.Since(a.lastAlert) < auditRealertAfter {
+		return false
+	}
+	a.lastAlert = time.Now()
+	return true
+}
@@ -0,0 +1,111 @@
+package pool
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Stats is the pool-side view of this rig's wallet and worker
+type Stats struct {
+	Pool              string      `json:"pool"` // Adapter name
+	Wallet            string      `json:"wallet"`
+	Worker            string      `json:"worker,omitempty"`
+	UnpaidBalance     *float64    `json:"unpaidBalance,omitempty"` // In coin units
+	ReportedHashrate  *float64    `json:"reportedHashrate,omitempty"`
+	EffectiveHashrate *float64    `json:"effectiveHashrate,omitempty"`
+	AverageHashrate   *float64    `json:"averageHashrate,omitempty"` // Long window (24h where available)
+	WorkerOnline      *bool       `json:"workerOnline,omitempty"`
+	WorkersOnline     *int        `json:"workersOnline,omitempty"`
+	LastShare         *int64      `json:"lastShare,omitempty"` // Unix seconds
+	ValidShares       *int        `json:"validShares,omitempty"`
+	StaleShares       *int        `json:"staleShares,omitempty"`
+	InvalidShares     *int        `json:"invalidShares,omitempty"`
+	ShareWindow       int         `json:"shareWindow,omitempty"` // Seconds covered by the worker's share counts, 0 if unknown
+	Audit             *ShareAudit `json:"audit,omitempty"`
+}
+
+// Adapter fetches account stats from a specific pool's public API
+type Adapter interface {
+	Name() string
+	Fetch(wallet, worker string) (*Stats, error)
+}
+
+// ForPool returns the adapter matching a stratum URL, if the pool is supported
+func ForPool(poolURL string) (Adapter, bool) {
+	host := poolHost(poolURL)
+	if host == "" {
+		return nil, false
+	}
+
+	switch {
+	case strings.HasSuffix(host, ".2miners.com"):
+		// etc.2miners.com, solo-etc.2miners.com
+		return &twoMinersAdapter{apiBase: "https://" + host + "/api"}, true
+	case strings.HasSuffix(host, "ethermine.org"):
+		return &ethermineAdapter{apiBase: ethermineAPIBase(host)}, true
+	case strings.HasSuffix(host, ".kryptex.network") || strings.HasSuffix(host, ".kryptex.com"):
+		return newKryptexAdapter(host)
+	case strings.HasSuffix(host, ".herominers.com"):
+		return newHeroMinersAdapter(host)
+	}
+	return nil, false
+}
+
+// poolHost extracts the hostname from stratum+tcp://host:port style URLs
+func poolHost(poolURL string) string {
+	if !strings.Contains(poolURL, "://") {
+		poolURL = "stratum+tcp://" + poolURL
+	}
+	u, err := url.Parse(poolURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// splitWallet separates "wallet.worker" logins used by many pools
+func splitWallet(wallet, worker string) (string, string) {
+	if idx := strings.Index(wallet, "."); idx > 0 && worker == "" {
+		return wallet[:idx], wallet[idx+1:]
+	}
+	return wallet, worker
+}
+
+// getJSON fetches a URL and decodes the JSON response into v
+func getJSON(apiURL string, v interface{}) error {
+	client := &http.Client{Timeout: 10 * time.Second}
+	req, err := http.NewRequest("GET", apiURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "BloxOS-Agent")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("pool API returned %d", resp.StatusCode)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("invalid pool API response: %w", err)
+	}
+	return nil
+}
+
+func floatPtr(v float64) *float64 { return &v }
+func intPtr(v int) *int           { return &v }
+func boolPtr(v bool) *bool        { return &v }
+func int64Ptr(v int64) *int64     { return &v }
@@ -0,0 +1,102 @@
+package powermeter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Reading is a single measurement from a wall power meter
+type Reading struct {
+	Meter     string   `json:"meter"`
+	Watts     float64  `json:"watts"`
+	Voltage   *float64 `json:"voltage,omitempty"`
+	Current   *float64 `json:"current,omitempty"`   // Amps
+	EnergyKWh *float64 `json:"energyKwh,omitempty"` // Meter lifetime total
+}
+
+// Meter reads power from an external measuring device
+type Meter interface {
+	Name() string
+	Read() (*Reading, error)
+}
+
+// New creates a meter from a spec of the form "type:address[#channel]":
+//
+//	hs110:192.168.1.50
+//	shelly:192.168.1.60#1
+//	pzem:/dev/ttyUSB0#1     (channel = Modbus slave address)
+func New(spec string) (Meter, error) {
+	parts := strings.SplitN(strings.TrimSpace(spec), ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, fmt.Errorf("invalid power meter spec %q (expected type:address)", spec)
+	}
+
+	address := parts[1]
+	channel := 0
+	if idx := strings.LastIndex(address, "#"); idx >= 0 {
+		ch, err := strconv.Atoi(address[idx+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid channel in %q", spec)
+		}
+		channel = ch
+		address = address[:idx]
+	}
+
+	switch strings.ToLower(parts[0]) {
+	case "hs110", "kasa", "tplink":
+		return &kasaMeter{host: address}, nil
+	case "shelly":
+		return &shellyMeter{host: address, channel: channel}, nil
+	case "pzem":
+		if channel == 0 {
+			channel = 1
+		}
+		return &pzemMeter{device: address, slave: byte(channel)}, nil
+	default:
+		return nil, fmt.Errorf("unknown power meter type: %s", parts[0])
+	}
+}
+
+// ParseList creates meters from a comma-separated list of specs
+func ParseList(specs string) ([]Meter, error) {
+	var meters []Meter
+	for _, spec := range strings.Split(specs, ",") {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+		meter, err := New(spec)
+		if err != nil {
+			return nil, err
+		}
+		meters = append(meters, meter)
+	}
+	return meters, nil
+}
+
+// Stats holds wall power readings for the stats payload
+type Stats struct {
+	TotalWatts float64   `json:"totalWatts"`
+	GPUWatts   *int      `json:"gpuWatts,omitempty"` // Sum of GPU-reported power for comparison
+	Meters     []Reading `json:"meters"`
+	Errors     []string  `json:"errors,omitempty"`
+}
+
+// ReadAll reads every meter and sums their power
+func ReadAll(meters []Meter) *Stats {
+	stats := &Stats{}
+	for _, meter := range meters {
+		reading, err := meter.Read()
+		if err != nil {
+			stats.Errors = append(stats.Errors, fmt.Sprintf("%s: %v", meter.Name(), err))
+			continue
+		}
+		stats.Meters = append(stats.Meters, *reading)
+		stats.TotalWatts += reading.Watts
+	}
+	return stats
+}
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
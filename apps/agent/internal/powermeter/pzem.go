@@ -0,0 +1,97 @@
+package powermeter
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pzemMeter reads a PZEM-004T v3 energy monitor over Modbus RTU on a
+// USB-serial adapter (9600 8N1)
+type pzemMeter struct {
+	device string
+	slave  byte
+
+	mu         sync.Mutex
+	configured bool
+}
+
+func (m *pzemMeter) Name() string { return fmt.Sprintf("pzem:%s#%d", m.device, m.slave) }
+
+func (m *pzemMeter) Read() (*Reading, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.configured {
+		// Put the tty into raw 9600 8N1 mode
+		output, err := exec.Command("stty", "-F", m.device, "9600", "cs8", "-cstopb", "-parenb", "raw", "-echo").CombinedOutput()
+		if err != nil {
+			return nil, fmt.Errorf("stty failed: %v: %s", err, strings.TrimSpace(string(output)))
+		}
+		m.configured = true
+	}
+
+	port, err := os.OpenFile(m.device, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer port.Close()
+
+	// Read input registers 0x0000-0x0009
+	request := []byte{m.slave, 0x04, 0x00, 0x00, 0x00, 0x0A}
+	request = binary.LittleEndian.AppendUint16(request, modbusCRC(request))
+	if _, err := port.Write(request); err != nil {
+		return nil, err
+	}
+
+	// slave, function, byte count, 20 data bytes, 2 CRC bytes
+	response := make([]byte, 25)
+	port.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := io.ReadFull(port, response); err != nil {
+		return nil, fmt.Errorf("no response: %w", err)
+	}
+
+	if response[0] != m.slave || response[1] != 0x04 || response[2] != 20 {
+		return nil, fmt.Errorf("unexpected response header % x", response[:3])
+	}
+	if crc := binary.LittleEndian.Uint16(response[23:]); crc != modbusCRC(response[:23]) {
+		return nil, fmt.Errorf("CRC mismatch")
+	}
+
+	reg := func(i int) uint32 {
+		return uint32(binary.BigEndian.Uint16(response[3+i*2:]))
+	}
+	// 32-bit values are split low word first
+	reg32 := func(i int) uint32 {
+		return reg(i) | reg(i+1)<<16
+	}
+
+	return &Reading{
+		Meter:     m.Name(),
+		Voltage:   floatPtr(float64(reg(0)) / 10),     // 0.1V
+		Current:   floatPtr(float64(reg32(1)) / 1000), // 0.001A
+		Watts:     float64(reg32(3)) / 10,             // 0.1W
+		EnergyKWh: floatPtr(float64(reg32(5)) / 1000), // Wh
+	}, nil
+}
+
+// modbusCRC computes the Modbus RTU CRC-16
+func modbusCRC(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,119 @@
+package powermeter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// shellyMeter reads Shelly energy meters and plugs over their local HTTP API.
+// Gen1 devices (EM, Plug S) expose /emeter/<n> or /meter/<n>; Gen2+ devices
+// (Pro EM, Plus Plug) expose the RPC API.
+type shellyMeter struct {
+	host    string
+	channel int
+}
+
+func (m *shellyMeter) Name() string { return fmt.Sprintf("shelly:%s#%d", m.host, m.channel) }
+
+func (m *shellyMeter) Read() (*Reading, error) {
+	client := &http.Client{Timeout: 3 * time.Second}
+
+	if reading, err := m.readGen2(client); err == nil {
+		return reading, nil
+	}
+	return m.readGen1(client)
+}
+
+func (m *shellyMeter) readGen1(client *http.Client) (*Reading, error) {
+	// Energy meters use /emeter, plugs and relays use /meter
+	for _, path := range []string{"emeter", "meter"} {
+		body, err := httpGet(client, fmt.Sprintf("http://%s/%s/%d", m.host, path, m.channel))
+		if err != nil {
+			continue
+		}
+
+		var data struct {
+			Power   float64  `json:"power"`
+			Voltage *float64 `json:"voltage"`
+			Current *float64 `json:"current"`
+			Total   *float64 `json:"total"` // Wh (emeter) or watt-minutes (meter)
+		}
+		if err := json.Unmarshal(body, &data); err != nil {
+			return nil, fmt.Errorf("invalid response: %w", err)
+		}
+
+		reading := &Reading{
+			Meter:   m.Name(),
+			Watts:   data.Power,
+			Voltage: data.Voltage,
+			Current: data.Current,
+		}
+		if data.Total != nil && path == "emeter" {
+			reading.EnergyKWh = floatPtr(*data.Total / 1000)
+		}
+		return reading, nil
+	}
+	return nil, fmt.Errorf("no Shelly meter endpoint responded")
+}
+
+func (m *shellyMeter) readGen2(client *http.Client) (*Reading, error) {
+	// Switch components (plugs) first, then EM1 (energy meters)
+	if body, err := httpGet(client, fmt.Sprintf("http://%s/rpc/Switch.GetStatus?id=%d", m.host, m.channel)); err == nil {
+		var data struct {
+			APower  *float64 `json:"apower"`
+			Voltage *float64 `json:"voltage"`
+			Current *float64 `json:"current"`
+			AEnergy struct {
+				Total *float64 `json:"total"` // Wh
+			} `json:"aenergy"`
+		}
+		if err := json.Unmarshal(body, &data); err == nil && data.APower != nil {
+			reading := &Reading{
+				Meter:   m.Name(),
+				Watts:   *data.APower,
+				Voltage: data.Voltage,
+				Current: data.Current,
+			}
+			if data.AEnergy.Total != nil {
+				reading.EnergyKWh = floatPtr(*data.AEnergy.Total / 1000)
+			}
+			return reading, nil
+		}
+	}
+
+	body, err := httpGet(client, fmt.Sprintf("http://%s/rpc/EM1.GetStatus?id=%d", m.host, m.channel))
+	if err != nil {
+		return nil, err
+	}
+	var data struct {
+		ActPower *float64 `json:"act_power"`
+		Voltage  *float64 `json:"voltage"`
+		Current  *float64 `json:"current"`
+	}
+	if err := json.Unmarshal(body, &data); err != nil || data.ActPower == nil {
+		return nil, fmt.Errorf("no Gen2 power reading")
+	}
+	return &Reading{
+		Meter:   m.Name(),
+		Watts:   *data.ActPower,
+		Voltage: data.Voltage,
+		Current: data.Current,
+	}, nil
+}
+
+// httpGet fetches a URL and returns the body of a 200 response
+func httpGet(client *http.Client, url string) ([]byte, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,390 @@
+// Package qrcode encodes short texts, such as a URL with a claim code, as
+// QR codes for the console and the local provisioning page. It covers
+// byte mode at error correction level L in versions 1 to 5, i.e. up to 106
+// bytes, which is all the agent needs.
+package qrcode
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Code is an encoded QR code
+type Code struct {
+	Size    int
+	modules [][]bool // [y][x], true = dark
+	// function marks finder, timing and alignment patterns and format
+	// bits, which masks leave alone
+	function [][]bool
+}
+
+// versions holds the data and error correction codewords of versions 1-5
+// at level L, each a single block
+var versions = []struct{ data, ec int }{
+	{19, 7},
+	{34, 10},
+	{55, 15},
+	{80, 20},
+	{108, 26},
+}
+
+// Encode encodes text in the smallest version that fits
+func Encode(text string) (*Code, error) {
+	for i, v := range versions {
+		// Mode indicator and 8-bit length come first
+		if len(text) > v.data-2 {
+			continue
+		}
+		version := i + 1
+		c := &Code{Size: 17 + 4*version}
+		c.modules = grid(c.Size)
+		c.function = grid(c.Size)
+		c.drawFunctionPatterns(version)
+		data := encodeData(text, v.data)
+		c.drawCodewords(append(data, reedSolomon(data, v.ec)...))
+		c.applyBestMask()
+		return c, nil
+	}
+	return nil, fmt.Errorf("text too long for a QR code: %d bytes (max %d)", len(text), versions[len(versions)-1].data-2)
+}
+
+// Dark reports whether the module at x, y is dark
+func (c *Code) Dark(x, y int) bool {
+	return x >= 0 && y >= 0 && x < c.Size && y < c.Size && c.modules[y][x]
+}
+
+// Terminal renders the code with block characters, two rows per line,
+// for a console with light text on a dark background
+func (c *Code) Terminal() string {
+	const quiet = 2
+	var b strings.Builder
+	for y := -quiet; y < c.Size+quiet; y += 2 {
+		for x := -quiet; x < c.Size+quiet; x++ {
+			top, bottom := !c.Dark(x, y), !c.Dark(x, y+1) && y+1 < c.Size+quiet
+			switch {
+			case top && bottom:
+				b.WriteString("█")
+			case top:
+				b.WriteString("▀")
+			case bottom:
+				b.WriteString("▄")
+			default:
+				b.WriteString(" ")
+			}
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// SVG renders the code with scale pixels per module
+func (c *Code) SVG(scale int) string {
+	const quiet = 4
+	size := (c.Size + 2*quiet) * scale
+	var path strings.Builder
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.modules[y][x] {
+				fmt.Fprintf(&path, "M%d,%dh1v1h-1z", x+quiet, y+quiet)
+			}
+		}
+	}
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+
+		`<rect width="100%%" height="100%%" fill="#fff"/><path d="%s" fill="#000"/></svg>`,
+		size, size, c.Size+2*quiet, c.Size+2*quiet, path.String())
+}
+
+func grid(size int) [][]bool {
+	g := make([][]bool, size)
+	for i := range g {
+		g[i] = make([]bool, size)
+	}
+	return g
+}
+
+func (c *Code) setFunction(x, y int, dark bool) {
+	c.modules[y][x] = dark
+	c.function[y][x] = true
+}
+
+func (c *Code) drawFunctionPatterns(version int) {
+	// Timing patterns
+	for i := 0; i < c.Size; i++ {
+		c.setFunction(6, i, i%2 == 0)
+		c.setFunction(i, 6, i%2 == 0)
+	}
+
+	// Finder patterns with their separators
+	for _, center := range [][2]int{{3, 3}, {c.Size - 4, 3}, {3, c.Size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := center[0]+dx, center[1]+dy
+				if x < 0 || y < 0 || x >= c.Size || y >= c.Size {
+					continue
+				}
+				dist := max(abs(dx), abs(dy))
+				c.setFunction(x, y, dist != 2 && dist != 4)
+			}
+		}
+	}
+
+	// Versions 2-5 have one alignment pattern, the others would overlap
+	// the finders
+	if version >= 2 {
+		center := c.Size - 7
+		for dy := -2; dy <= 2; dy++ {
+			for dx := -2; dx <= 2; dx++ {
+				c.setFunction(center+dx, center+dy, max(abs(dx), abs(dy)) != 1)
+			}
+		}
+	}
+
+	// Reserve the format bits
+	c.drawFormatBits(0)
+}
+
+// drawFormatBits draws the level (L) and mask, BCH-protected, in both of
+// their places
+func (c *Code) drawFormatBits(mask int) {
+	data := 1<<3 | mask // Level L is 01
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return (bits>>i)&1 != 0 }
+
+	for i := 0; i <= 5; i++ {
+		c.setFunction(8, i, bit(i))
+	}
+	c.setFunction(8, 7, bit(6))
+	c.setFunction(8, 8, bit(7))
+	c.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		c.setFunction(14-i, 8, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		c.setFunction(c.Size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		c.setFunction(8, c.Size-15+i, bit(i))
+	}
+	c.setFunction(8, c.Size-8, true) // Always dark
+}
+
+// encodeData lays out text in byte mode and pads it to capacity codewords
+func encodeData(text string, capacity int) []byte {
+	var bits []bool
+	appendBits := func(value, n int) {
+		for i := n - 1; i >= 0; i-- {
+			bits = append(bits, (value>>i)&1 != 0)
+		}
+	}
+	appendBits(0x4, 4) // Byte mode
+	appendBits(len(text), 8)
+	for i := 0; i < len(text); i++ {
+		appendBits(int(text[i]), 8)
+	}
+	// Terminator, then to a byte boundary
+	appendBits(0, min(4, capacity*8-len(bits)))
+	appendBits(0, (8-len(bits)%8)%8)
+
+	data := make([]byte, 0, capacity)
+	for i := 0; i < len(bits); i += 8 {
+		var b byte
+		for j := 0; j < 8; j++ {
+			if bits[i+j] {
+				b |= 1 << (7 - j)
+			}
+		}
+		data = append(data, b)
+	}
+	for pad := byte(0xEC); len(data) < capacity; pad ^= 0xEC ^ 0x11 {
+		data = append(data, pad)
+	}
+	return data
+}
+
+// reedSolomon computes the error correction codewords over GF(256)
+func reedSolomon(data []byte, degree int) []byte {
+	// Generator polynomial with roots 2^0 .. 2^(degree-1), leading term
+	// omitted
+	divisor := make([]byte, degree)
+	divisor[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range divisor {
+			divisor[j] = gfMultiply(divisor[j], root)
+			if j+1 < len(divisor) {
+				divisor[j] ^= divisor[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+
+	result := make([]byte, degree)
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[degree-1] = 0
+		for i := range result {
+			result[i] ^= gfMultiply(divisor[i], factor)
+		}
+	}
+	return result
+}
+
+func gfMultiply(x, y byte) byte {
+	var z int
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>i)&1) * int(x)
+	}
+	return byte(z)
+}
+
+// drawCodewords fills the data area in the zigzag order, two columns at a
+// time from the bottom right
+func (c *Code) drawCodewords(data []byte) {
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5 // Skip the vertical timing pattern
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < c.Size; vert++ {
+			y := vert
+			if upward {
+				y = c.Size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if c.function[y][x] || i >= len(data)*8 {
+					continue
+				}
+				c.modules[y][x] = (data[i/8]>>(7-i%8))&1 != 0
+				i++
+			}
+		}
+	}
+}
+
+// applyMask inverts the data modules selected by mask; applying it twice
+// undoes it
+func (c *Code) applyMask(mask int) {
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !c.function[y][x] {
+				c.modules[y][x] = !c.modules[y][x]
+			}
+		}
+	}
+}
+
+// applyBestMask picks the mask with the lowest penalty, as readers cope
+// best with an even spread of dark and light modules
+func (c *Code) applyBestMask() {
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		c.applyMask(mask)
+		c.drawFormatBits(mask)
+		if penalty := c.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+		c.applyMask(mask)
+	}
+	c.applyMask(best)
+	c.drawFormatBits(best)
+}
+
+// penalty scores the code by the four rules of the specification: runs,
+// 2x2 blocks, finder-like patterns and the dark/light balance
+func (c *Code) penalty() int {
+	penalty := 0
+	finderLike := []string{"10111010000", "00001011101"}
+
+	for _, rows := range []bool{true, false} {
+		for a := 0; a < c.Size; a++ {
+			var line strings.Builder
+			run := 0
+			var last bool
+			for b := 0; b < c.Size; b++ {
+				dark := c.modules[a][b]
+				if !rows {
+					dark = c.modules[b][a]
+				}
+				if dark {
+					line.WriteByte('1')
+				} else {
+					line.WriteByte('0')
+				}
+				if b > 0 && dark == last {
+					run++
+					if run == 5 {
+						penalty += 3
+					} else if run > 5 {
+						penalty++
+					}
+				} else {
+					run = 1
+				}
+				last = dark
+			}
+			for _, pattern := range finderLike {
+				for s := line.String(); ; {
+					i := strings.Index(s, pattern)
+					if i < 0 {
+						break
+					}
+					penalty += 40
+					s = s[i+1:]
+				}
+			}
+		}
+	}
+
+	dark := 0
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.modules[y][x] {
+				dark++
+			}
+			if x+1 < c.Size && y+1 < c.Size {
+				v := c.modules[y][x]
+				if c.modules[y][x+1] == v && c.modules[y+1][x] == v && c.modules[y+1][x+1] == v {
+					penalty += 3
+				}
+			}
+		}
+	}
+	total := c.Size * c.Size
+	penalty += abs(dark*20-total*10) / total * 10
+	return penalty
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
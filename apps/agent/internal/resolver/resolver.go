@@ -0,0 +1,374 @@
+package resolver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bloxos/agent/internal/system"
+)
+
+// dohServers are DNS-over-HTTPS JSON endpoints addressed by IP, so they
+// are reachable while the local resolver is down
+var dohServers = []string{
+	"https://1.1.1.1/dns-query",
+	"https://8.8.8.8/resolve",
+}
+
+// probeHost is resolved to tell whether the local resolver has recovered,
+// since pinned hosts resolve from /etc/hosts regardless
+const probeHost = "one.one.one.one"
+
+const (
+	hostsFile   = "/etc/hosts"
+	hostsBegin  = "# BEGIN bloxos dns cache"
+	hostsEnd    = "# END bloxos dns cache"
+	lookupLimit = 5 * time.Second
+)
+
+// entry is a cached resolution
+type entry struct {
+	IPs     []string `json:"ips"`
+	Source  string   `json:"source"`  // "system" or "doh"
+	Updated int64    `json:"updated"` // Unix seconds
+}
+
+// Status describes the resolver state for the stats payload
+type Status struct {
+	Degraded bool     `json:"degraded"`         // Local resolver failing
+	Pinned   []string `json:"pinned,omitempty"` // Hosts pinned in /etc/hosts
+}
+
+// Resolver resolves via the system resolver, falls back to DNS-over-HTTPS
+// and then to the last known IPs. While the local resolver is down it pins
+// watched hosts in /etc/hosts so miners keep connecting to their pools.
+type Resolver struct {
+	cachePath string
+	debug     bool
+	client    *http.Client
+
+	mu       sync.Mutex
+	cache    map[string]*entry
+	pinned   map[string][]string
+	degraded bool
+}
+
+// New creates a resolver persisting its cache at cachePath
+func New(cachePath string, debug bool) *Resolver {
+	r := &Resolver{
+		cachePath: cachePath,
+		debug:     debug,
+		// Own transport: DoH servers are IPs and must not loop back through us
+		client: &http.Client{
+			Timeout:   lookupLimit,
+			Transport: &http.Transport{},
+		},
+		cache:  map[string]*entry{},
+		pinned: map[string][]string{},
+	}
+
+	if data, err := os.ReadFile(cachePath); err == nil {
+		json.Unmarshal(data, &r.cache)
+	}
+	return r
+}
+
+// Lookup resolves host: system resolver first, then DoH, then the cache
+func (r *Resolver) Lookup(ctx context.Context, host string) ([]string, error) {
+	if net.ParseIP(host) != nil {
+		return []string{host}, nil
+	}
+
+	ips, sysErr := r.systemLookup(ctx, host)
+	if sysErr == nil {
+		r.store(host, ips, "system")
+		return ips, nil
+	}
+
+	if ips, err := r.dohLookup(ctx, host); err == nil {
+		r.store(host, ips, "doh")
+		return ips, nil
+	}
+
+	r.mu.Lock()
+	cached := r.cache[host]
+	r.mu.Unlock()
+	if cached != nil && len(cached.IPs) > 0 {
+		if r.debug {
+			log.Printf("DNS: using cached IPs for %s: %v", host, cached.IPs)
+		}
+		return cached.IPs, nil
+	}
+
+	return nil, fmt.Errorf("resolve %s: %w", host, sysErr)
+}
+
+// DialContext dials addr resolving its host with Lookup; usable as
+// http.Transport.DialContext
+func (r *Resolver) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := r.Lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}
+	var lastErr error
+	for _, ip := range ips {
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// Watch periodically resolves hosts (e.g. the server and pools) to keep
+// the cache fresh, and pins them in /etc/hosts while the local resolver
+// is failing
+func (r *Resolver) Watch(hosts func() []string, interval time.Duration) {
+	go func() {
+		for {
+			r.check(hosts())
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// Status returns the current resolver state
+func (r *Resolver) Status() *Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	status := &Status{Degraded: r.degraded}
+	for host := range r.pinned {
+		status.Pinned = append(status.Pinned, host)
+	}
+	sort.Strings(status.Pinned)
+	return status
+}
+
+// check refreshes watched hosts and updates the /etc/hosts pins
+func (r *Resolver) check(hosts []string) {
+	ctx := context.Background()
+
+	// Pinned hosts resolve from /etc/hosts, so probe an unpinned name
+	_, probeErr := r.systemLookup(ctx, probeHost)
+
+	pins := map[string][]string{}
+	failing := false
+	for _, host := range hosts {
+		if host == "" || net.ParseIP(host) != nil {
+			continue
+		}
+
+		r.mu.Lock()
+		_, isPinned := r.pinned[host]
+		r.mu.Unlock()
+
+		// A pinned host resolves from /etc/hosts, so only trust the system
+		// resolver for it once the probe succeeds
+		if !isPinned || probeErr == nil {
+			if ips, err := r.systemLookup(ctx, host); err == nil {
+				if !isPinned {
+					r.store(host, ips, "system")
+				}
+				continue
+			}
+		}
+
+		failing = true
+		ips, err := r.dohLookup(ctx, host)
+		if err == nil {
+			r.store(host, ips, "doh")
+		} else {
+			r.mu.Lock()
+			if cached := r.cache[host]; cached != nil {
+				ips = cached.IPs
+			}
+			r.mu.Unlock()
+		}
+		if len(ips) > 0 {
+			pins[host] = ips
+		}
+	}
+
+	r.mu.Lock()
+	changed := !samePins(r.pinned, pins)
+	r.pinned = pins
+	wasDegraded := r.degraded
+	r.degraded = failing
+	r.mu.Unlock()
+
+	if failing && !wasDegraded {
+		log.Printf("DNS: local resolver failing, pinning %d host(s) in %s", len(pins), hostsFile)
+	} else if !failing && wasDegraded {
+		log.Println("DNS: local resolver recovered")
+	}
+
+	if changed {
+		if err := writeHostsBlock(pins); err != nil {
+			log.Printf("DNS: failed to update %s: %v", hostsFile, err)
+		}
+	}
+}
+
+func (r *Resolver) systemLookup(ctx context.Context, host string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, lookupLimit)
+	defer cancel()
+	return net.DefaultResolver.LookupHost(ctx, host)
+}
+
+// dohLookup resolves A records via the DoH JSON API
+func (r *Resolver) dohLookup(ctx context.Context, host string) ([]string, error) {
+	var lastErr error
+	for _, server := range dohServers {
+		ips, err := r.queryDoH(ctx, server, host)
+		if err == nil && len(ips) > 0 {
+			return ips, nil
+		}
+		if err == nil {
+			err = fmt.Errorf("no A records")
+		}
+		lastErr = err
+	}
+	return nil, fmt.Errorf("DoH lookup of %s failed: %w", host, lastErr)
+}
+
+func (r *Resolver) queryDoH(ctx context.Context, server, host string) ([]string, error) {
+	query := url.Values{"name": {host}, "type": {"A"}}
+	req, err := http.NewRequestWithContext(ctx, "GET", server+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/dns-json")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned HTTP %d", server, resp.StatusCode)
+	}
+
+	var data struct {
+		Status int `json:"Status"`
+		Answer []struct {
+			Type int    `json:"type"`
+			Data string `json:"data"`
+		} `json:"Answer"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, err
+	}
+	if data.Status != 0 {
+		return nil, fmt.Errorf("%s returned DNS status %d", server, data.Status)
+	}
+
+	var ips []string
+	for _, answer := range data.Answer {
+		if answer.Type == 1 && net.ParseIP(answer.Data) != nil { // A record
+			ips = append(ips, answer.Data)
+		}
+	}
+	return ips, nil
+}
+
+// store caches a resolution and persists the cache
+func (r *Resolver) store(host string, ips []string, source string) {
+	r.mu.Lock()
+	r.cache[host] = &entry{IPs: ips, Source: source, Updated: time.Now().Unix()}
+	data, err := json.Marshal(r.cache)
+	r.mu.Unlock()
+	// The cache only speeds up the next boot, not worth writing to a
+	// failing disk
+	if err != nil || system.DiskDegraded() {
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.cachePath), 0755); err != nil {
+		return
+	}
+	if err := os.WriteFile(r.cachePath, data, 0644); err != nil && r.debug {
+		log.Printf("DNS: failed to save cache: %v", err)
+	}
+}
+
+// writeHostsBlock replaces the managed block in /etc/hosts
+func writeHostsBlock(pins map[string][]string) error {
+	data, err := os.ReadFile(hostsFile)
+	if err != nil {
+		return err
+	}
+
+	var lines []string
+	inBlock := false
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		switch {
+		case line == hostsBegin:
+			inBlock = true
+		case line == hostsEnd:
+			inBlock = false
+		case !inBlock:
+			lines = append(lines, line)
+		}
+	}
+
+	if len(pins) > 0 {
+		hosts := make([]string, 0, len(pins))
+		for host := range pins {
+			hosts = append(hosts, host)
+		}
+		sort.Strings(hosts)
+
+		lines = append(lines, hostsBegin)
+		for _, host := range hosts {
+			for _, ip := range pins[host] {
+				lines = append(lines, ip+"\t"+host)
+			}
+		}
+		lines = append(lines, hostsEnd)
+	}
+
+	return os.WriteFile(hostsFile, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+func samePins(a, b map[string][]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for host, ips := range a {
+		if strings.Join(ips, ",") != strings.Join(b[host], ",") {
+			return false
+		}
+	}
+	return true
+}
+
+// HostOf returns the host of a server or pool URL such as
+// "stratum+tcp://pool.example.com:4444" or "pool.example.com:4444"
+func HostOf(rawURL string) string {
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "tcp://" + rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
@@ -0,0 +1,158 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.4.0
+// - protoc             (unknown)
+// source: agent.proto
+
+package rpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.62.0 or later.
+const _ = grpc.SupportPackageIsVersion8
+
+const (
+	RigAgent_Connect_FullMethodName = "/bloxos.agent.v1.RigAgent/Connect"
+)
+
+// RigAgentClient is the client API for RigAgent service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// RigAgent is the gRPC equivalent of the /api/agent/ws WebSocket endpoint.
+// Message types and payloads follow the WebSocket protocol (see the ws
+// package); payloads keep their JSON shape as google.protobuf.Value.
+type RigAgentClient interface {
+	// Connect opens the rig session. The rig token is sent as
+	// "authorization: Bearer <token>" metadata and the identity (hostname,
+	// agentVersion, protocol) as "x-bloxos-<key>" metadata. The first server
+	// message is "authenticated" or "error".
+	Connect(ctx context.Context, opts ...grpc.CallOption) (RigAgent_ConnectClient, error)
+}
+
+type rigAgentClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewRigAgentClient(cc grpc.ClientConnInterface) RigAgentClient {
+	return &rigAgentClient{cc}
+}
+
+func (c *rigAgentClient) Connect(ctx context.Context, opts ...grpc.CallOption) (RigAgent_ConnectClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &RigAgent_ServiceDesc.Streams[0], RigAgent_Connect_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &rigAgentConnectClient{ClientStream: stream}
+	return x, nil
+}
+
+type RigAgent_ConnectClient interface {
+	Send(*AgentMessage) error
+	Recv() (*ServerMessage, error)
+	grpc.ClientStream
+}
+
+type rigAgentConnectClient struct {
+	grpc.ClientStream
+}
+
+func (x *rigAgentConnectClient) Send(m *AgentMessage) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *rigAgentConnectClient) Recv() (*ServerMessage, error) {
+	m := new(ServerMessage)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// RigAgentServer is the server API for RigAgent service.
+// All implementations must embed UnimplementedRigAgentServer
+// for forward compatibility
+//
+// RigAgent is the gRPC equivalent of the /api/agent/ws WebSocket endpoint.
+// Message types and payloads follow the WebSocket protocol (see the ws
+// package); payloads keep their JSON shape as google.protobuf.Value.
+type RigAgentServer interface {
+	// Connect opens the rig session. The rig token is sent as
+	// "authorization: Bearer <token>" metadata and the identity (hostname,
+	// agentVersion, protocol) as "x-bloxos-<key>" metadata. The first server
+	// message is "authenticated" or "error".
+	Connect(RigAgent_ConnectServer) error
+	mustEmbedUnimplementedRigAgentServer()
+}
+
+// UnimplementedRigAgentServer must be embedded to have forward compatible implementations.
+type UnimplementedRigAgentServer struct {
+}
+
+func (UnimplementedRigAgentServer) Connect(RigAgent_ConnectServer) error {
+	return status.Errorf(codes.Unimplemented, "method Connect not implemented")
+}
+func (UnimplementedRigAgentServer) mustEmbedUnimplementedRigAgentServer() {}
+
+// UnsafeRigAgentServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to RigAgentServer will
+// result in compilation errors.
+type UnsafeRigAgentServer interface {
+	mustEmbedUnimplementedRigAgentServer()
+}
+
+func RegisterRigAgentServer(s grpc.ServiceRegistrar, srv RigAgentServer) {
+	s.RegisterService(&RigAgent_ServiceDesc, srv)
+}
+
+func _RigAgent_Connect_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(RigAgentServer).Connect(&rigAgentConnectServer{ServerStream: stream})
+}
+
+type RigAgent_ConnectServer interface {
+	Send(*ServerMessage) error
+	Recv() (*AgentMessage, error)
+	grpc.ServerStream
+}
+
+type rigAgentConnectServer struct {
+	grpc.ServerStream
+}
+
+func (x *rigAgentConnectServer) Send(m *ServerMessage) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *rigAgentConnectServer) Recv() (*AgentMessage, error) {
+	m := new(AgentMessage)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// RigAgent_ServiceDesc is the grpc.ServiceDesc for RigAgent service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var RigAgent_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "bloxos.agent.v1.RigAgent",
+	HandlerType: (*RigAgentServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Connect",
+			Handler:       _RigAgent_Connect_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "agent.proto",
+}
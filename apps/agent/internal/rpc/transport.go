@@ -0,0 +1,177 @@
+// Package rpc is the gRPC transport for the agent connection. It carries
+// the same messages as the WebSocket (see ws.Transport) over a
+// bidirectional RigAgent.Connect stream.
+package rpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative agent.proto
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/bloxos/agent/internal/ws"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// DefaultPort is used when the gRPC address has no port
+const DefaultPort = "50051"
+
+// Transport returns a ws.Transport connecting to the gRPC server at addr
+// (host:port), using TLS when useTLS is set
+func Transport(addr string, useTLS bool) ws.Transport {
+	return func(ctx context.Context, token string, authInfo map[string]string, dial ws.DialFunc) (ws.Conn, error) {
+		creds := insecure.NewCredentials()
+		if useTLS {
+			creds = credentials.NewTLS(&tls.Config{})
+		}
+
+		opts := []grpc.DialOption{
+			grpc.WithTransportCredentials(creds),
+			grpc.WithStreamInterceptor(authInterceptor(token, authInfo)),
+			grpc.WithKeepaliveParams(keepalive.ClientParameters{
+				Time:    30 * time.Second,
+				Timeout: 10 * time.Second,
+			}),
+		}
+		if dial != nil {
+			opts = append(opts, grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+				return dial(ctx, "tcp", addr)
+			}))
+		}
+
+		cc, err := grpc.NewClient(addr, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gRPC address: %w", err)
+		}
+
+		streamCtx, cancel := context.WithCancel(context.Background())
+		stream, err := NewRigAgentClient(cc).Connect(streamCtx)
+		if err != nil {
+			cancel()
+			cc.Close()
+			return nil, fmt.Errorf("dial failed: %w", err)
+		}
+		return &conn{cc: cc, stream: stream, cancel: cancel}, nil
+	}
+}
+
+// authInterceptor attaches the rig token and identity to every stream
+func authInterceptor(token string, authInfo map[string]string) grpc.StreamClientInterceptor {
+	pairs := []string{"authorization", "Bearer " + token}
+	for k, v := range authInfo {
+		pairs = append(pairs, "x-bloxos-"+k, v)
+	}
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(metadata.AppendToOutgoingContext(ctx, pairs...), desc, cc, method, opts...)
+	}
+}
+
+// conn adapts a Connect stream to ws.Conn
+type conn struct {
+	cc     *grpc.ClientConn
+	stream RigAgent_ConnectClient
+	cancel context.CancelFunc
+	once   sync.Once
+}
+
+func (c *conn) ReadMessage() (*ws.Message, error) {
+	in, err := c.stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &ws.Message{
+		Type:      in.Type,
+		Timestamp: in.Timestamp,
+		RigID:     in.RigId,
+		RigName:   in.RigName,
+		Protocol:  int(in.Protocol),
+		Message:   in.Message,
+		Features:  in.Features,
+		Scopes:    in.Scopes,
+		Code:      in.Code,
+	}
+	if keepalive := in.Keepalive; keepalive != nil {
+		msg.Keepalive = &ws.Keepalive{
+			Heartbeat:        int(keepalive.Heartbeat),
+			TCPKeepAlive:     int(keepalive.TcpKeepalive),
+			HandshakeTimeout: int(keepalive.HandshakeTimeout),
+		}
+	}
+	if conflict := in.Conflict; conflict != nil {
+		msg.Conflict = &ws.TokenConflict{
+			InstanceID: conflict.InstanceId,
+			Hostname:   conflict.Hostname,
+			Address:    conflict.Address,
+			Since:      conflict.Since,
+			Refused:    conflict.Refused,
+			DetectedAt: conflict.DetectedAt,
+		}
+	}
+	if cmd := in.Command; cmd != nil {
+		msg.Command = &ws.Command{
+			ID:      cmd.Id,
+			Type:    cmd.Type,
+			Payload: cmd.Payload.AsInterface(),
+		}
+		if cmd.CreatedAt != nil {
+			msg.Command.CreatedAt = cmd.CreatedAt.AsTime()
+		}
+	}
+	return msg, nil
+}
+
+func (c *conn) WriteMessage(msg *ws.Message) error {
+	out := &AgentMessage{
+		Type:      msg.Type,
+		Timestamp: msg.Timestamp,
+		CommandId: msg.CommandID,
+		Success:   msg.Success,
+		Error:     msg.Error,
+	}
+	if msg.Data != nil {
+		data, err := toValue(msg.Data)
+		if err != nil {
+			return fmt.Errorf("failed to marshal message: %w", err)
+		}
+		out.Data = data
+	}
+	if err := c.stream.Send(out); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	return nil
+}
+
+func (c *conn) Close() error {
+	var err error
+	c.once.Do(func() {
+		c.stream.CloseSend()
+		c.cancel()
+		err = c.cc.Close()
+	})
+	return err
+}
+
+// toValue converts a payload to a protobuf Value through its JSON form, so
+// field names match the WebSocket messages
+func toValue(data interface{}) (*structpb.Value, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	if err := json.Unmarshal(raw, &generic); err != nil {
+		return nil, err
+	}
+	return structpb.NewValue(generic)
+}
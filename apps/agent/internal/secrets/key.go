@@ -0,0 +1,176 @@
+package secrets
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// keySource is where a file's key comes from, recorded in its header
+type keySource byte
+
+const (
+	sourceTPM       keySource = 1 // Random key sealed in the TPM
+	sourceMachineID keySource = 2 // Derived from the OS machine ID
+	sourceKeyFile   keySource = 3 // Random key next to the data, as a last resort
+)
+
+var (
+	keyMu   sync.Mutex
+	keys    = map[keySource][]byte{}
+	written keySource // Source for new files, chosen on first write
+)
+
+// writeKey returns the key for new files: the TPM's where usable, then the
+// machine ID's
+func writeKey() (keySource, []byte, error) {
+	keyMu.Lock()
+	defer keyMu.Unlock()
+	if written != 0 {
+		return written, keys[written], nil
+	}
+	for _, source := range []keySource{sourceTPM, sourceMachineID, sourceKeyFile} {
+		key, err := loadKey(source)
+		if err == nil {
+			written = source
+			return source, key, nil
+		}
+	}
+	return 0, nil, fmt.Errorf("no encryption key available")
+}
+
+// readKey returns the key of the source a file was written with
+func readKey(source keySource) ([]byte, error) {
+	keyMu.Lock()
+	defer keyMu.Unlock()
+	return loadKey(source)
+}
+
+// loadKey fetches and caches a key. Called with keyMu held.
+func loadKey(source keySource) ([]byte, error) {
+	if key, ok := keys[source]; ok {
+		return key, nil
+	}
+	var key []byte
+	var err error
+	switch source {
+	case sourceTPM:
+		key, err = tpmKey()
+	case sourceMachineID:
+		var id string
+		if id, err = machineID(); err == nil {
+			key, err = deriveKey(id)
+		}
+	case sourceKeyFile:
+		key, err = fileKey()
+	default:
+		err = fmt.Errorf("unknown key source %d", source)
+	}
+	if err != nil {
+		return nil, err
+	}
+	keys[source] = key
+	return key, nil
+}
+
+// deriveKey turns the machine ID into an AES-256 key
+func deriveKey(id string) ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, []byte(id), []byte("bloxos-secrets"), []byte("v1")), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// tpmKey unseals the key from the TPM with tpm2-tools, sealing a new random
+// one on first use. The sealed blobs only open on this machine's TPM.
+func tpmKey() ([]byte, error) {
+	if _, err := os.Stat("/dev/tpmrm0"); err != nil {
+		return nil, fmt.Errorf("no TPM: %w", err)
+	}
+	if _, err := exec.LookPath("tpm2_unseal"); err != nil {
+		return nil, fmt.Errorf("tpm2-tools not installed")
+	}
+
+	tmp, err := os.MkdirTemp("", "bloxos-tpm")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	// The owner hierarchy's primary key is the same every time
+	primary := filepath.Join(tmp, "primary.ctx")
+	if err := runTPM(nil, "tpm2_createprimary", "-Q", "-C", "o", "-c", primary); err != nil {
+		return nil, err
+	}
+
+	pub := filepath.Join(Dir(), "secrets.tpm.pub")
+	priv := filepath.Join(Dir(), "secrets.tpm.priv")
+	if _, err := os.Stat(priv); os.IsNotExist(err) {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(Dir(), 0755); err != nil {
+			return nil, err
+		}
+		if err := runTPM(key, "tpm2_create", "-Q", "-C", primary, "-i", "-", "-u", pub, "-r", priv); err != nil {
+			return nil, err
+		}
+	}
+
+	loaded := filepath.Join(tmp, "key.ctx")
+	if err := runTPM(nil, "tpm2_load", "-Q", "-C", primary, "-u", pub, "-r", priv, "-c", loaded); err != nil {
+		return nil, err
+	}
+	var key bytes.Buffer
+	cmd := exec.Command("tpm2_unseal", "-c", loaded)
+	cmd.Stdout = &key
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("tpm2_unseal: %w", err)
+	}
+	if key.Len() != 32 {
+		return nil, fmt.Errorf("tpm2_unseal: unexpected key size %d", key.Len())
+	}
+	return key.Bytes(), nil
+}
+
+func runTPM(stdin []byte, name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %v: %s", name, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// fileKey is a random key kept beside the data, for systems with neither
+// a TPM nor a machine ID; it only keeps secrets out of casual reads
+func fileKey() ([]byte, error) {
+	path := filepath.Join(Dir(), "secrets.key")
+	if key, err := os.ReadFile(path); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(Dir(), 0755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, key, 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
@@ -0,0 +1,21 @@
+//go:build !windows
+
+package secrets
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// machineID returns systemd's machine ID, generated on first boot
+func machineID() (string, error) {
+	for _, path := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id"} {
+		if data, err := os.ReadFile(path); err == nil {
+			if id := strings.TrimSpace(string(data)); id != "" {
+				return id, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no machine ID")
+}
@@ -0,0 +1,21 @@
+package secrets
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// machineID returns the GUID Windows generates at installation
+func machineID() (string, error) {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, `SOFTWARE\Microsoft\Cryptography`, registry.QUERY_VALUE|registry.WOW64_64KEY)
+	if err != nil {
+		return "", err
+	}
+	defer key.Close()
+	id, _, err := key.GetStringValue("MachineGuid")
+	if err != nil || id == "" {
+		return "", fmt.Errorf("no machine ID: %v", err)
+	}
+	return id, nil
+}
@@ -0,0 +1,182 @@
+// Package secrets keeps the rig token, miner configs with their wallets
+// and pool credentials, and device passwords encrypted on disk. The key is
+// sealed in the TPM where there is one, and otherwise derived from the
+// machine ID, so a copied file is useless on another machine.
+package secrets
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/bloxos/agent/internal/system"
+)
+
+// magic starts every encrypted file, followed by the key source, the
+// nonce and the AES-GCM ciphertext
+var magic = []byte("BLOXOS-ENC1")
+
+// Dir holds the named secrets and the key material
+func Dir() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".bloxos")
+}
+
+func storePath() string {
+	return filepath.Join(Dir(), "secrets.enc")
+}
+
+// Encrypted reports whether data is an encrypted file
+func Encrypted(data []byte) bool {
+	return bytes.HasPrefix(data, magic)
+}
+
+// WriteFile encrypts data into path, readable by the owner only
+func WriteFile(path string, data []byte) error {
+	if system.DiskDegraded() {
+		return fmt.Errorf("not writing %s: the boot disk is failing", path)
+	}
+	source, key, err := writeKey()
+	if err != nil {
+		return err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	header := append(append([]byte(nil), magic...), byte(source))
+	out := append(append(header, nonce...), gcm.Seal(nil, nonce, data, header)...)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// Replace atomically: a torn write would lose the file for good
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, out, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// ReadFile decrypts path. A plaintext file, e.g. from an older agent, is
+// returned as is and encrypted in place, unless the disk is failing.
+func ReadFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !Encrypted(data) {
+		if system.DiskDegraded() {
+			return data, nil
+		}
+		if err := WriteFile(path, data); err != nil {
+			fmt.Printf("Warning: failed to encrypt %s: %v\n", path, err)
+		}
+		return data, nil
+	}
+
+	if len(data) < len(magic)+1 {
+		return nil, fmt.Errorf("%s: truncated", path)
+	}
+	header := data[:len(magic)+1]
+	key, err := readKey(keySource(header[len(magic)]))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	rest := data[len(header):]
+	if len(rest) < gcm.NonceSize() {
+		return nil, fmt.Errorf("%s: truncated", path)
+	}
+	plain, err := gcm.Open(nil, rest[:gcm.NonceSize()], rest[gcm.NonceSize():], header)
+	if err != nil {
+		return nil, fmt.Errorf("%s: cannot decrypt, written on another machine or corrupted", path)
+	}
+	return plain, nil
+}
+
+// EncryptFile encrypts a plaintext file in place; missing and already
+// encrypted files are left alone
+func EncryptFile(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) || (err == nil && Encrypted(data)) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return WriteFile(path, data)
+}
+
+// Named secrets share one file
+var storeMu sync.Mutex
+
+func loadStore() (map[string]string, error) {
+	values := map[string]string{}
+	data, err := ReadFile(storePath())
+	if os.IsNotExist(err) {
+		return values, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("invalid secrets store: %w", err)
+	}
+	return values, nil
+}
+
+// Get returns a named secret, or "" when it isn't set
+func Get(name string) (string, error) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	values, err := loadStore()
+	if err != nil {
+		return "", err
+	}
+	return values[name], nil
+}
+
+// Set stores a named secret; an empty value removes it
+func Set(name, value string) error {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	values, err := loadStore()
+	if err != nil {
+		// Unreadable, e.g. after moving the disk to another machine:
+		// start over rather than lock the rig out for good
+		fmt.Printf("Warning: replacing unreadable secrets store: %v\n", err)
+		values = map[string]string{}
+	}
+	if value == "" {
+		delete(values, name)
+	} else {
+		values[name] = value
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	return WriteFile(storePath(), data)
+}
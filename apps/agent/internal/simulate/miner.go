@@ -0,0 +1,196 @@
+package simulate
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// fakeHashrate is the H/s of one fake GPU
+const fakeHashrate = 31.5e6
+
+// shareInterval is how often each fake GPU finds a share
+const shareInterval = 20 * time.Second
+
+// fakeMiner serves one miner's API for the options it was started with
+type fakeMiner struct {
+	kind      string
+	algorithm string
+	pool      string
+	started   time.Time
+	key       string // T-Rex --api-key; its API then wants a login
+}
+
+// fakeSession is the session ID the fake T-Rex hands out on login
+const fakeSession = "simulated-session"
+
+// runMiner runs a fake miner until it is stopped
+func runMiner(kind string, args []string) int {
+	m := &fakeMiner{kind: kind, started: time.Now()}
+	var addr string
+	for i := 0; i+1 < len(args); i++ {
+		switch args[i] {
+		case "-a", "--algo":
+			m.algorithm = args[i+1]
+		case "-o", "--pool", "--server":
+			m.pool = args[i+1]
+		case "--api-bind-http":
+			addr = args[i+1]
+		case "--api-key":
+			m.key = args[i+1]
+		case "--apiport", "--api":
+			addr = "127.0.0.1:" + args[i+1]
+		}
+	}
+	if addr == "" {
+		fmt.Fprintln(os.Stderr, "simulated miner: no API port given")
+		return 1
+	}
+	if m.algorithm == "" || m.pool == "" {
+		fmt.Fprintln(os.Stderr, "simulated miner: algorithm and pool are required")
+		return 1
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "simulated miner: %v\n", err)
+		return 1
+	}
+	fmt.Printf("%s (simulated) mining %s on %s with %d GPUs, API on %s\n", kind, m.algorithm, m.pool, gpuCount(), addr)
+
+	go http.Serve(listener, m)
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	<-sigChan
+	listener.Close()
+	return 0
+}
+
+// gpuAccepted returns the shares a fake GPU has found so far
+func (m *fakeMiner) gpuAccepted(index int) int {
+	// Stagger the GPUs so shares don't all land together
+	elapsed := time.Since(m.started) + time.Duration(index)*shareInterval/time.Duration(gpuCount())
+	return int(elapsed / shareInterval)
+}
+
+func (m *fakeMiner) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	uptime := int(time.Since(m.started).Seconds())
+	gpus := gpuCount()
+	accepted := 0
+	for i := 0; i < gpus; i++ {
+		accepted += m.gpuAccepted(i)
+	}
+
+	var body interface{}
+	switch m.kind {
+	case "t-rex":
+		if m.key != "" && r.URL.Path == "/login" {
+			body = map[string]interface{}{"success": 1, "sid": fakeSession}
+			if r.URL.Query().Get("password") != m.key {
+				body = map[string]interface{}{"success": 0, "error": "wrong password"}
+			}
+			break
+		}
+		if r.URL.Path != "/summary" {
+			http.NotFound(w, r)
+			return
+		}
+		if m.key != "" && r.URL.Query().Get("sid") != fakeSession {
+			body = map[string]interface{}{"success": 0, "error": "not authorized"}
+			break
+		}
+		var list []map[string]interface{}
+		for i := 0; i < gpus; i++ {
+			list = append(list, map[string]interface{}{
+				"device_id":   i,
+				"pci_domain":  0,
+				"pci_bus":     i + 1,
+				"pci_id":      0,
+				"hashrate":    fakeHashrate,
+				"temperature": 60,
+				"fan_speed":   60,
+				"power":       120,
+				"shares":      map[string]int{"accepted_count": m.gpuAccepted(i)},
+			})
+		}
+		body = map[string]interface{}{
+			"name":           "trex",
+			"version":        "0.26.8",
+			"algorithm":      m.algorithm,
+			"hashrate":       fakeHashrate * float64(gpus),
+			"uptime":         uptime,
+			"accepted_count": accepted,
+			"rejected_count": 0,
+			"active_pool":    map[string]string{"url": m.pool},
+			"gpus":           list,
+		}
+
+	case "lolminer":
+		var list []map[string]interface{}
+		var perf []float64
+		var workerAccepted []int
+		for i := 0; i < gpus; i++ {
+			list = append(list, map[string]interface{}{
+				"Index":         i,
+				"PCIE_Address":  fmt.Sprintf("%x:0", i+1),
+				"Performance":   fakeHashrate / 1e6,
+				"Temp (deg C)":  60,
+				"Fan Speed (%)": 60,
+				"Power (W)":     120,
+			})
+			perf = append(perf, fakeHashrate/1e6)
+			workerAccepted = append(workerAccepted, m.gpuAccepted(i))
+		}
+		body = map[string]interface{}{
+			"Software": "lolMiner 1.88",
+			"Mining":   map[string]string{"Algorithm": strings.ToUpper(m.algorithm)},
+			"Session":  map[string]int{"Uptime": uptime, "Accepted": accepted, "Submitted": accepted},
+			"Stratum":  map[string]string{"Current_Pool": m.pool},
+			"GPUs":     list,
+			"Algorithms": []map[string]interface{}{{
+				"Algorithm":          strings.ToUpper(m.algorithm),
+				"Pool":               m.pool,
+				"Performance_Factor": 1e6,
+				"Total_Performance":  fakeHashrate * float64(gpus) / 1e6,
+				"Total_Accepted":     accepted,
+				"Total_Rejected":     0,
+				"Worker_Performance": perf,
+				"Worker_Accepted":    workerAccepted,
+			}},
+		}
+
+	case "gminer":
+		var list []map[string]interface{}
+		for i := 0; i < gpus; i++ {
+			list = append(list, map[string]interface{}{
+				"gpu_id":          i,
+				"bus_id":          fmt.Sprintf("0000:%02x:00.0", i+1),
+				"speed":           fakeHashrate,
+				"temperature":     60,
+				"fan":             60,
+				"power_usage":     120,
+				"accepted_shares": m.gpuAccepted(i),
+			})
+		}
+		body = map[string]interface{}{
+			"miner":                 "GMiner 3.44",
+			"algorithm":             m.algorithm,
+			"uptime":                uptime,
+			"server":                m.pool,
+			"devices":               list,
+			"total_speed":           fakeHashrate * float64(gpus),
+			"total_accepted_shares": accepted,
+			"total_rejected_shares": 0,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
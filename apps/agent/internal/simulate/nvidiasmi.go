@@ -0,0 +1,163 @@
+package simulate
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	fakeDriver = "535.104.05"
+	fakeCUDA   = "12.2"
+	fakeGPU    = "NVIDIA GeForce RTX 3070"
+	fakeVRAM   = 8192
+)
+
+// runNvidiaSMI answers the nvidia-smi queries the agent makes. The XML
+// report fails so the agent takes the CSV path; settings always succeed.
+func runNvidiaSMI(args []string) int {
+	var query string
+	var selected []int
+	loop := 0
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case strings.HasPrefix(arg, "--query-gpu="):
+			query = strings.TrimPrefix(arg, "--query-gpu=")
+		case strings.HasPrefix(arg, "--query-compute-apps="):
+			return 0 // Nothing runs on the fake GPUs
+		case arg == "-q":
+			fmt.Fprintln(os.Stderr, "simulated nvidia-smi has no full report")
+			return 1
+		case (arg == "-i" || arg == "--id") && i+1 < len(args):
+			i++
+			selected = selectGPUs(args[i])
+		case arg == "-l" && i+1 < len(args):
+			i++
+			loop, _ = strconv.Atoi(args[i])
+		}
+	}
+
+	if query == "" {
+		if len(args) == 0 {
+			printHeader()
+		}
+		return 0
+	}
+
+	if selected == nil {
+		for i := 0; i < gpuCount(); i++ {
+			selected = append(selected, i)
+		}
+	}
+	fields := strings.Split(query, ",")
+	for {
+		for _, index := range selected {
+			values := make([]string, len(fields))
+			for i, field := range fields {
+				values[i] = gpuField(index, strings.TrimSpace(field))
+			}
+			fmt.Println(strings.Join(values, ", "))
+		}
+		if loop <= 0 {
+			return 0
+		}
+		time.Sleep(time.Duration(loop) * time.Second)
+	}
+}
+
+// selectGPUs resolves a -i argument: indexes or PCI addresses
+func selectGPUs(ids string) []int {
+	selected := []int{}
+	for _, id := range strings.Split(ids, ",") {
+		id = strings.ToLower(strings.TrimSpace(id))
+		for i := 0; i < gpuCount(); i++ {
+			busID := strings.Contains(id, ":") && strings.HasSuffix(strings.ToLower(fakeBusID(i)), strings.TrimLeft(id, "0"))
+			if id == strconv.Itoa(i) || busID {
+				selected = append(selected, i)
+			}
+		}
+	}
+	return selected
+}
+
+// fakeBusID returns the nvidia-smi style PCI address of a fake GPU
+func fakeBusID(index int) string {
+	return fmt.Sprintf("00000000:%02X:00.0", index+1)
+}
+
+// gpuField returns a query field of a fake GPU. Values drift a little so
+// stats look alive.
+func gpuField(index int, field string) string {
+	wobble := int(time.Now().Unix()/5+int64(index)) % 3
+	switch field {
+	case "index":
+		return strconv.Itoa(index)
+	case "name":
+		return fakeGPU
+	case "pci.bus_id":
+		return fakeBusID(index)
+	case "uuid":
+		return fmt.Sprintf("GPU-5eb1a7e0-0000-4000-8000-%012d", index)
+	case "driver_version":
+		return fakeDriver
+	case "vbios_version":
+		return "94.04.3A.00.9B"
+	case "temperature.gpu":
+		return strconv.Itoa(58 + index + wobble)
+	case "temperature.memory":
+		return "[N/A]" // Consumer cards don't report it
+	case "fan.speed":
+		return strconv.Itoa(60 + wobble)
+	case "power.draw":
+		return fmt.Sprintf("%d.%02d", 118+wobble, index*7%100)
+	case "power.limit", "enforced.power.limit":
+		return "130.00"
+	case "power.default_limit":
+		return "220.00"
+	case "power.min_limit":
+		return "100.00"
+	case "power.max_limit":
+		return "240.00"
+	case "clocks.gr", "clocks.sm":
+		return strconv.Itoa(1200 + wobble*15)
+	case "clocks.mem":
+		return "7600"
+	case "clocks.max.gr", "clocks.max.sm":
+		return "2100"
+	case "clocks.max.mem":
+		return "7001"
+	case "utilization.gpu":
+		return strconv.Itoa(98 + wobble%2)
+	case "utilization.memory":
+		return "85"
+	case "memory.total":
+		return strconv.Itoa(fakeVRAM)
+	case "memory.used":
+		return "4620"
+	case "memory.free":
+		return strconv.Itoa(fakeVRAM - 4620)
+	case "persistence_mode":
+		return "Enabled"
+	case "compute_mode":
+		return "Default"
+	case "pstate":
+		return "P2"
+	case "clocks_throttle_reasons.active", "clocks_event_reasons.active":
+		return "0x0000000000000004" // SW power cap, as at a lowered limit
+	}
+	return "[N/A]"
+}
+
+func printHeader() {
+	fmt.Printf("%s\n", time.Now().Format("Mon Jan  2 15:04:05 2006"))
+	fmt.Println("+---------------------------------------------------------------------------------------+")
+	fmt.Printf("| NVIDIA-SMI %s             Driver Version: %s   CUDA Version: %s     |\n", fakeDriver, fakeDriver, fakeCUDA)
+	fmt.Println("|-----------------------------------------+----------------------+----------------------+")
+	for i := 0; i < gpuCount(); i++ {
+		fmt.Printf("|   %d  %-35s|   %s |                  N/A |\n", i, fakeGPU, fakeBusID(i)[4:])
+	}
+	fmt.Println("+---------------------------------------------------------------------------------------+")
+}
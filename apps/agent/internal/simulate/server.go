@@ -0,0 +1,381 @@
+package simulate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bloxos/agent/internal/history"
+	"github.com/bloxos/agent/internal/ws"
+)
+
+// Step is one command the fake server sends
+type Step struct {
+	Command    string      `json:"command"`
+	Payload    interface{} `json:"payload,omitempty"`
+	Wait       int         `json:"wait,omitempty"`       // Seconds to wait after the previous step
+	ExpectFail bool        `json:"expectFail,omitempty"` // The command must be rejected
+}
+
+// StepResult is how the agent answered a step
+type StepResult struct {
+	Step     Step          `json:"step"`
+	Success  bool          `json:"success"`
+	Error    string        `json:"error,omitempty"`
+	Data     interface{}   `json:"data,omitempty"`
+	Duration time.Duration `json:"duration"`
+	Passed   bool          `json:"passed"`
+}
+
+// simulatedWallet is a well-formed ETC address
+const simulatedWallet = "0x5a0b54d5dc17e0aadc383d2db43b0a0d3e029c4c"
+
+// DefaultScript exercises stats, OC, miner validation and start/stop, and
+// an installer dry run
+func DefaultScript() []Step {
+	miner := map[string]interface{}{
+		"name":      "t-rex",
+		"algorithm": "etchash",
+		"coin":      "ETC",
+		"pool":      "stratum+tcp://etc.simulated.invalid:1010",
+		"wallet":    simulatedWallet,
+		"worker":    "sim",
+	}
+	invalid := map[string]interface{}{
+		"name":      "t-rex",
+		"algorithm": "etchash",
+		"coin":      "ETC",
+		"pool":      "stratum+tcp://etc.simulated.invalid:1010",
+		"wallet":    "not-a-wallet",
+	}
+	return []Step{
+		{Command: "get_inventory"},
+		{Command: "list_miners"},
+		{Command: "validate_miner_config", Payload: miner},
+		{Command: "validate_miner_config", Payload: invalid, ExpectFail: true},
+		{Command: "apply_oc", Payload: map[string]interface{}{"gpuIndex": -1, "powerLimit": 130}},
+		{Command: "install_miner", Payload: map[string]interface{}{"minerName": "lolminer"}},
+		{Command: "start_miner", Payload: miner},
+		{Command: "stop_miner", Wait: 30},
+	}
+}
+
+// LoadScript reads steps from a JSON file
+func LoadScript(path string) ([]Step, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var steps []Step
+	if err := json.Unmarshal(data, &steps); err != nil {
+		return nil, fmt.Errorf("invalid script: %w", err)
+	}
+	for i, step := range steps {
+		if step.Command == "" {
+			return nil, fmt.Errorf("step %d has no command", i+1)
+		}
+	}
+	return steps, nil
+}
+
+// Server stands in for the BloxOS server: it authenticates the agent, sends
+// the scripted commands one after another and records what comes back
+type Server struct {
+	steps []Step
+	debug bool
+	inbox chan *ws.Message
+	done  chan struct{}
+
+	mu          sync.Mutex
+	started     bool
+	next        int
+	pendingID   string
+	sentAt      time.Time
+	results     []StepResult
+	stats       int
+	minerStatus int
+	hashrate    float64 // Highest reported H/s
+	batches     int
+	events      []string
+	health      string // Digest of the latest heartbeat
+	history     int    // Samples uploaded after an outage
+}
+
+// NewServer creates a fake server running the given steps
+func NewServer(steps []Step, debug bool) *Server {
+	return &Server{
+		steps: steps,
+		debug: debug,
+		inbox: make(chan *ws.Message, 16),
+		done:  make(chan struct{}),
+	}
+}
+
+// Transport connects a ws.Client to the fake server
+func (s *Server) Transport() ws.Transport {
+	return func(ctx context.Context, token string, authInfo map[string]string, dial ws.DialFunc) (ws.Conn, error) {
+		s.inbox <- &ws.Message{Type: ws.TypeAuthenticated, RigID: "sim-rig", RigName: "simulated", Protocol: ws.ProtocolVersion}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if !s.started {
+			s.started = true
+			s.sendNext()
+		}
+		return &serverConn{server: s, closed: make(chan struct{})}, nil
+	}
+}
+
+// Done is closed once every step has been answered
+func (s *Server) Done() <-chan struct{} {
+	return s.done
+}
+
+// sendNext queues the next step after its wait, or finishes the script.
+// Called with s.mu held.
+func (s *Server) sendNext() {
+	if s.next >= len(s.steps) {
+		close(s.done)
+		return
+	}
+	step := s.steps[s.next]
+	id := fmt.Sprintf("sim-%d", s.next+1)
+	s.pendingID = id
+
+	go func() {
+		time.Sleep(time.Duration(step.Wait) * time.Second)
+		s.mu.Lock()
+		s.sentAt = time.Now()
+		s.mu.Unlock()
+		log.Printf("[simulate] -> %s", step.Command)
+		s.inbox <- &ws.Message{
+			Type:    ws.TypeCommand,
+			Command: &ws.Command{ID: id, Type: step.Command, Payload: step.Payload, CreatedAt: time.Now()},
+		}
+	}()
+}
+
+// receive handles a message from the agent
+func (s *Server) receive(msg *ws.Message) {
+	if msg.Type == ws.TypeBatch {
+		s.mu.Lock()
+		s.batches++
+		s.mu.Unlock()
+		for _, m := range msg.Messages {
+			s.receive(m)
+		}
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch msg.Type {
+	case ws.TypeHeartbeat:
+		s.health = summarize(msg.Data)
+		if s.debug {
+			log.Printf("[simulate] <- heartbeat %s", s.health)
+		}
+
+	case ws.TypeStats:
+		s.stats++
+		if s.debug {
+			log.Printf("[simulate] <- stats %s", summarize(msg.Data))
+		}
+
+	case ws.TypeMinerStatus:
+		s.minerStatus++
+		var status struct {
+			Name     string  `json:"name"`
+			Hashrate float64 `json:"hashrate"`
+		}
+		if decode(msg.Data, &status) == nil {
+			if status.Hashrate > s.hashrate {
+				s.hashrate = status.Hashrate
+			}
+			if status.Name != "" {
+				log.Printf("[simulate] <- miner_status %s %.2f MH/s", status.Name, status.Hashrate/1e6)
+			}
+		}
+
+	case ws.TypeHistory:
+		var batch history.Batch
+		if decode(msg.Data, &batch) != nil {
+			return
+		}
+		samples, err := history.Decode(&batch)
+		if err != nil {
+			log.Printf("[simulate] <- history: %v", err)
+			return
+		}
+		s.history += len(samples)
+		log.Printf("[simulate] <- history %d samples", len(samples))
+
+	case ws.TypeEvent:
+		var event struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		}
+		if decode(msg.Data, &event) == nil {
+			s.events = append(s.events, event.Type)
+			log.Printf("[simulate] <- event %s: %s", event.Type, event.Message)
+		}
+
+	case ws.TypeCommandResult:
+		if msg.CommandID != s.pendingID || s.next >= len(s.steps) {
+			return
+		}
+		step := s.steps[s.next]
+		result := StepResult{
+			Step:     step,
+			Success:  msg.Success,
+			Error:    msg.Error,
+			Data:     msg.Data,
+			Duration: time.Since(s.sentAt),
+			Passed:   msg.Success != step.ExpectFail,
+		}
+		s.results = append(s.results, result)
+
+		status := "ok"
+		if !result.Passed {
+			status = "FAILED"
+		}
+		detail := msg.Error
+		if detail == "" && s.debug {
+			detail = summarize(msg.Data)
+		}
+		log.Printf("[simulate] <- %s %s (success=%v) %s", step.Command, status, msg.Success, detail)
+
+		s.next++
+		s.sendNext()
+	}
+}
+
+// Results returns the answered steps
+func (s *Server) Results() []StepResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]StepResult(nil), s.results...)
+}
+
+// Failures lists what went wrong: failed or unanswered steps, no stats,
+// and a started miner that never reported a hashrate
+func (s *Server) Failures() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var failures []string
+	minerStarted := false
+	for _, result := range s.results {
+		if !result.Passed {
+			reason := result.Error
+			if result.Success {
+				reason = "succeeded but was expected to fail"
+			}
+			failures = append(failures, fmt.Sprintf("%s: %s", result.Step.Command, reason))
+		}
+		if result.Step.Command == "start_miner" && result.Success {
+			minerStarted = true
+		}
+	}
+	for _, step := range s.steps[len(s.results):] {
+		failures = append(failures, fmt.Sprintf("%s: no result", step.Command))
+	}
+	if s.stats == 0 {
+		failures = append(failures, "no stats received")
+	}
+	if minerStarted && s.hashrate == 0 {
+		failures = append(failures, "miner started but reported no hashrate")
+	}
+	return failures
+}
+
+// Summary describes the run in a few lines
+func (s *Server) Summary() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	passed := 0
+	for _, result := range s.results {
+		if result.Passed {
+			passed++
+		}
+	}
+	lines := []string{
+		fmt.Sprintf("Steps: %d/%d passed", passed, len(s.steps)),
+		fmt.Sprintf("Stats messages: %d, miner status messages: %d, batch frames: %d", s.stats, s.minerStatus, s.batches),
+		fmt.Sprintf("Peak hashrate: %.2f MH/s", s.hashrate/1e6),
+	}
+	if len(s.events) > 0 {
+		lines = append(lines, "Events: "+strings.Join(s.events, ", "))
+	}
+	if s.history > 0 {
+		lines = append(lines, fmt.Sprintf("History samples: %d", s.history))
+	}
+	if s.health != "" {
+		lines = append(lines, "Last heartbeat: "+s.health)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// serverConn is the agent's end of a connection to the fake server
+type serverConn struct {
+	server    *Server
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (c *serverConn) ReadMessage() (*ws.Message, error) {
+	select {
+	case msg := <-c.server.inbox:
+		return msg, nil
+	case <-c.closed:
+		return nil, io.EOF
+	}
+}
+
+func (c *serverConn) WriteMessage(msg *ws.Message) error {
+	select {
+	case <-c.closed:
+		return io.ErrClosedPipe
+	default:
+	}
+	c.server.receive(msg)
+	return nil
+}
+
+func (c *serverConn) SupportsBatch() bool {
+	return true
+}
+
+func (c *serverConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return nil
+}
+
+// decode converts a message payload into v
+func decode(data interface{}, v interface{}) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// summarize shortens a payload for logging
+func summarize(data interface{}) string {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return ""
+	}
+	if len(raw) > 200 {
+		return string(raw[:200]) + "..."
+	}
+	return string(raw)
+}
@@ -0,0 +1,113 @@
+// Package simulate runs the agent against a built-in fake server and fake
+// GPUs, so the command and stats flow can be exercised on machines without
+// GPUs, e.g. in CI.
+//
+// The agent binary doubles as the fake tools: the sandbox links
+// nvidia-smi and the miner executables to it, and Dispatch runs the fake
+// instead of the agent when started under one of those names. Miners
+// started by the executor are real processes serving their miner's API.
+package simulate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Environment passed to the fake tools
+const (
+	EnvSandbox = "BLOXOS_SIMULATE"      // Sandbox directory; set while simulating
+	EnvGPUs    = "BLOXOS_SIMULATE_GPUS" // Number of fake GPUs
+)
+
+// minerExecutables are the fake miners, named like the real executables so
+// the executor finds them and pgrep matches them
+var minerExecutables = map[string]string{
+	"t-rex":    "t-rex",
+	"lolMiner": "lolminer",
+	"miner":    "gminer",
+}
+
+// Sandbox is a throwaway HOME holding the agent state, fake tools and miners
+type Sandbox struct {
+	Dir  string
+	GPUs int
+}
+
+// Setup creates a sandbox and points HOME and PATH at it, so the agent's
+// state files and tool lookups stay inside
+func Setup(gpus int) (*Sandbox, error) {
+	if gpus < 1 {
+		return nil, fmt.Errorf("at least one GPU is required")
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "bloxos-simulate-")
+	if err != nil {
+		return nil, err
+	}
+	bin := filepath.Join(dir, "bin")
+	miners := filepath.Join(dir, "miners")
+	for _, d := range []string{bin, miners} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			os.RemoveAll(dir)
+			return nil, err
+		}
+	}
+
+	links := []string{filepath.Join(bin, "nvidia-smi")}
+	for exe := range minerExecutables {
+		links = append(links, filepath.Join(miners, exe))
+	}
+	for _, link := range links {
+		if err := os.Symlink(self, link); err != nil {
+			os.RemoveAll(dir)
+			return nil, err
+		}
+	}
+
+	if err := writeSysfs(dir, gpus); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	os.Setenv("HOME", dir)
+	os.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	os.Setenv(EnvSandbox, dir)
+	os.Setenv(EnvGPUs, strconv.Itoa(gpus))
+
+	return &Sandbox{Dir: dir, GPUs: gpus}, nil
+}
+
+// Cleanup removes the sandbox
+func (s *Sandbox) Cleanup() {
+	os.RemoveAll(s.Dir)
+}
+
+// Dispatch runs a fake tool or miner and exits when the binary was started
+// under its name inside a simulation. It returns for the agent itself.
+func Dispatch() {
+	if os.Getenv(EnvSandbox) == "" {
+		return
+	}
+	name := filepath.Base(os.Args[0])
+	switch {
+	case name == "nvidia-smi":
+		os.Exit(runNvidiaSMI(os.Args[1:]))
+	case minerExecutables[name] != "":
+		os.Exit(runMiner(minerExecutables[name], os.Args[1:]))
+	}
+}
+
+// gpuCount returns the number of fake GPUs
+func gpuCount() int {
+	n, err := strconv.Atoi(os.Getenv(EnvGPUs))
+	if err != nil || n < 1 {
+		return 1
+	}
+	return n
+}
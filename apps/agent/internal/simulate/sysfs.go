@@ -0,0 +1,94 @@
+package simulate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bloxos/agent/internal/platform"
+)
+
+// fakePCIFiles are the sysfs attributes of a fake RTX 3070
+var fakePCIFiles = map[string]string{
+	"class":            "0x030000",
+	"vendor":           "0x10de",
+	"device":           "0x2484",
+	"subsystem_vendor": "0x10de",
+	"subsystem_device": "0x146b",
+	"revision":         "0xa1",
+}
+
+// writeSysfs creates the PCI devices of the fake GPUs under dir/sys
+func writeSysfs(dir string, gpus int) error {
+	for i := 0; i < gpus; i++ {
+		dev := filepath.Join(dir, "sys", "bus", "pci", "devices", fmt.Sprintf("0000:%02x:00.0", i+1))
+		if err := os.MkdirAll(dev, 0755); err != nil {
+			return err
+		}
+		for name, value := range fakePCIFiles {
+			if err := os.WriteFile(filepath.Join(dev, name), []byte(value+"\n"), 0644); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// FS returns the host filesystem with the sandbox's fake sysfs laid over
+// it, so the collector finds the fake GPUs on the PCI bus
+func (s *Sandbox) FS() platform.FS {
+	return overlayFS{FS: platform.Host, root: s.Dir}
+}
+
+// overlayFS serves /sys paths from root when they exist there
+type overlayFS struct {
+	platform.FS
+	root string
+}
+
+func (o overlayFS) resolve(path string) string {
+	if !strings.HasPrefix(path, "/sys/") {
+		return path
+	}
+	if _, err := os.Stat(filepath.Join(o.root, path)); err == nil {
+		return filepath.Join(o.root, path)
+	}
+	return path
+}
+
+func (o overlayFS) ReadFile(path string) ([]byte, error) {
+	return o.FS.ReadFile(o.resolve(path))
+}
+
+func (o overlayFS) WriteFile(path string, data []byte, perm os.FileMode) error {
+	return o.FS.WriteFile(o.resolve(path), data, perm)
+}
+
+func (o overlayFS) Stat(path string) (os.FileInfo, error) {
+	return o.FS.Stat(o.resolve(path))
+}
+
+// ReadDir lists a directory with the fake entries added
+func (o overlayFS) ReadDir(path string) ([]os.DirEntry, error) {
+	entries, err := o.FS.ReadDir(path)
+	overlay := o.resolve(path)
+	if overlay == path {
+		return entries, err
+	}
+	fake, fakeErr := o.FS.ReadDir(overlay)
+	if fakeErr != nil {
+		return entries, err
+	}
+	// Fake devices shadow real ones at the same address
+	shadowed := map[string]bool{}
+	for _, entry := range fake {
+		shadowed[entry.Name()] = true
+	}
+	for _, entry := range entries {
+		if !shadowed[entry.Name()] {
+			fake = append(fake, entry)
+		}
+	}
+	return fake, nil
+}
@@ -0,0 +1,178 @@
+package stratum
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// dagAlgorithm describes how often an ethash-family algorithm changes its DAG
+type dagAlgorithm struct {
+	epochLength int64         // Blocks per epoch
+	blockTime   time.Duration // Target block time
+	seedEpochs  int           // Seed hash epochs per epoch (ETC doubled its epoch length)
+}
+
+var dagAlgorithms = map[string]dagAlgorithm{
+	"ethash":          {30000, 13 * time.Second, 1},
+	"daggerhashimoto": {30000, 13 * time.Second, 1},
+	"etchash":         {60000, 13 * time.Second, 2},
+	"kawpow":          {7500, 60 * time.Second, 1},
+}
+
+// Restarts are held back this long around an epoch change: the miner
+// rebuilds its DAG at the change and again after every restart
+const (
+	epochGuardBefore = 10 * time.Minute
+	epochGuardAfter  = 5 * time.Minute
+)
+
+// maxSeedEpochs bounds the seed hash search
+const maxSeedEpochs = 4096
+
+// EpochStatus is the DAG epoch of the pool's current jobs
+type EpochStatus struct {
+	Epoch        int   `json:"epoch"`
+	ChangedAt    int64 `json:"changedAt,omitempty"`    // Unix seconds the epoch was first seen changing
+	Height       int64 `json:"height,omitempty"`       // Latest block height, where the pool sends it
+	NextChangeAt int64 `json:"nextChangeAt,omitempty"` // Estimated from the block height
+}
+
+// epochTracker follows the seed hash of the jobs sent to the miner
+type epochTracker struct {
+	mu        sync.Mutex
+	seed      string
+	epoch     int // Seed hash epoch
+	changedAt time.Time
+	height    int64
+	heightAt  time.Time
+}
+
+// Epoch returns the DAG epoch of the current jobs, or nil when the algorithm
+// has no DAG or no job was seen yet
+func (p *Proxy) Epoch(algorithm string) *EpochStatus {
+	algo, ok := dagAlgorithms[strings.ToLower(algorithm)]
+	if !ok {
+		return nil
+	}
+	t := &p.epoch
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.seed == "" {
+		return nil
+	}
+	status := &EpochStatus{Epoch: t.epoch / algo.seedEpochs}
+	if !t.changedAt.IsZero() {
+		status.ChangedAt = t.changedAt.Unix()
+	}
+	if t.height > 0 {
+		status.Height = t.height
+		next := (t.height/algo.epochLength + 1) * algo.epochLength
+		status.NextChangeAt = t.heightAt.Add(time.Duration(next-t.height) * algo.blockTime).Unix()
+	}
+	return status
+}
+
+// RestartDelay returns how long an automatic miner restart should wait so
+// it doesn't land just before or after an epoch change
+func (p *Proxy) RestartDelay(algorithm string) time.Duration {
+	status := p.Epoch(algorithm)
+	if status == nil {
+		return 0
+	}
+	now := time.Now()
+
+	var delay time.Duration
+	if status.ChangedAt > 0 {
+		if until := time.Unix(status.ChangedAt, 0).Add(epochGuardAfter).Sub(now); until > delay {
+			delay = until
+		}
+	}
+	if status.NextChangeAt > 0 {
+		next := time.Unix(status.NextChangeAt, 0)
+		if now.After(next.Add(-epochGuardBefore)) {
+			if until := next.Add(epochGuardAfter).Sub(now); until > delay {
+				delay = until
+			}
+		}
+	}
+	return delay
+}
+
+// observeJob records the seed hash and block height of a job. It takes the
+// params of mining.notify or the result array of an EthProxy work push.
+func (t *epochTracker) observeJob(params []json.RawMessage, proxyWork bool) {
+	var strs []string
+	for _, param := range params {
+		var s string
+		if json.Unmarshal(param, &s) == nil {
+			s = strings.TrimPrefix(strings.ToLower(s), "0x")
+			if len(s) == 64 {
+				strs = append(strs, s)
+			}
+		}
+	}
+
+	// Block height: 4th element of EthProxy work, 6th KawPoW notify param
+	var height int64
+	if proxyWork && len(params) >= 4 {
+		var s string
+		if json.Unmarshal(params[3], &s) == nil {
+			height, _ = strconv.ParseInt(strings.TrimPrefix(s, "0x"), 16, 64)
+		}
+	} else if !proxyWork && len(params) >= 6 {
+		json.Unmarshal(params[5], &height)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if height > 0 {
+		t.height = height
+		t.heightAt = time.Now()
+	}
+	for _, s := range strs {
+		if s == t.seed {
+			return
+		}
+	}
+	// Header hashes are the same length; only a seed hash has an epoch
+	for _, s := range strs {
+		epoch, ok := epochFromSeed(s)
+		if !ok {
+			continue
+		}
+		if t.seed != "" {
+			t.changedAt = time.Now()
+		}
+		t.seed = s
+		t.epoch = epoch
+		return
+	}
+}
+
+// epochFromSeed finds the epoch whose seed hash (keccak256 applied epoch
+// times to 32 zero bytes) matches
+func epochFromSeed(seedHex string) (int, bool) {
+	target, err := hex.DecodeString(seedHex)
+	if err != nil || len(target) != 32 {
+		return 0, false
+	}
+	seed := make([]byte, 32)
+	for epoch := 0; epoch < maxSeedEpochs; epoch++ {
+		if bytes.Equal(seed, target) {
+			return epoch, true
+		}
+		h := sha3.NewLegacyKeccak256()
+		h.Write(seed)
+		seed = h.Sum(nil)
+	}
+	return 0, false
+}
@@ -0,0 +1,350 @@
+package stratum
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// primaryCheckInterval is how often the proxy probes the primary pool while
+// mining on a backup
+const primaryCheckInterval = 2 * time.Minute
+
+// PoolStats holds per-upstream connection and share counters
+type PoolStats struct {
+	URL       string `json:"url"`
+	Active    bool   `json:"active"`
+	Accepted  int    `json:"accepted"`
+	Rejected  int    `json:"rejected"`
+	Connects  int    `json:"connects"`
+	Failures  int    `json:"failures"`
+	LastError string `json:"lastError,omitempty"`
+}
+
+// Stats is a snapshot of the proxy state for the stats payload
+type Stats struct {
+	Listen     string      `json:"listen"`
+	ActivePool string      `json:"activePool"`
+	Miners     int         `json:"miners"`
+	Failovers  int         `json:"failovers"`
+	Pools      []PoolStats `json:"pools"`
+}
+
+// Proxy is a local stratum endpoint that miners connect to. It forwards to
+// an ordered list of upstream pools, fails over between them without
+// dropping the miner connection, and terminates TLS for the miner.
+type Proxy struct {
+	listenAddr string
+	debug      bool
+	dial       func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	mu        sync.Mutex
+	listener  net.Listener
+	pools     []*PoolStats
+	active    int
+	failovers int
+	sessions  map[*session]struct{}
+	stop      chan struct{}
+
+	epoch epochTracker // Kept across restarts of the miner
+}
+
+// New creates a proxy that will listen on the given address (e.g. 127.0.0.1:3333)
+func New(listenAddr string, debug bool) *Proxy {
+	return &Proxy{
+		listenAddr: listenAddr,
+		debug:      debug,
+		sessions:   make(map[*session]struct{}),
+	}
+}
+
+// SetDialer sets a custom dial function for upstream pools, e.g. one with
+// DNS fallback
+func (p *Proxy) SetDialer(dial func(ctx context.Context, network, addr string) (net.Conn, error)) {
+	p.dial = dial
+}
+
+// Start begins proxying to the given pools, in failover order. Calling Start
+// again replaces the pool list and disconnects existing miners.
+func (p *Proxy) Start(pools []string) error {
+	if len(pools) == 0 {
+		return fmt.Errorf("at least one pool is required")
+	}
+	for _, pool := range pools {
+		if _, _, err := parsePoolURL(pool); err != nil {
+			return err
+		}
+	}
+
+	p.Stop()
+
+	listener, err := net.Listen("tcp", p.listenAddr)
+	if err != nil {
+		return fmt.Errorf("stratum proxy listen failed: %w", err)
+	}
+
+	p.mu.Lock()
+	p.listener = listener
+	p.pools = make([]*PoolStats, len(pools))
+	for i, pool := range pools {
+		p.pools[i] = &PoolStats{URL: pool}
+	}
+	p.active = 0
+	p.failovers = 0
+	p.stop = make(chan struct{})
+	stop := p.stop
+	p.mu.Unlock()
+
+	go p.acceptLoop(listener)
+	go p.primaryCheckLoop(stop)
+
+	fmt.Printf("Stratum proxy listening on %s (%d pool(s))\n", p.listenAddr, len(pools))
+	return nil
+}
+
+// Stop closes the listener and all miner sessions
+func (p *Proxy) Stop() {
+	p.mu.Lock()
+	if p.listener == nil {
+		p.mu.Unlock()
+		return
+	}
+	p.listener.Close()
+	p.listener = nil
+	close(p.stop)
+	sessions := make([]*session, 0, len(p.sessions))
+	for s := range p.sessions {
+		sessions = append(sessions, s)
+	}
+	p.mu.Unlock()
+
+	for _, s := range sessions {
+		s.close()
+	}
+}
+
+// Running returns true while the proxy is listening
+func (p *Proxy) Running() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.listener != nil
+}
+
+// LocalURL is the pool URL miners should be pointed at
+func (p *Proxy) LocalURL() string {
+	return "stratum+tcp://" + p.listenAddr
+}
+
+// Stats returns a snapshot of the proxy state, or nil when not running
+func (p *Proxy) Stats() *Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.listener == nil {
+		return nil
+	}
+
+	stats := &Stats{
+		Listen:     p.listenAddr,
+		ActivePool: p.pools[p.active].URL,
+		Miners:     len(p.sessions),
+		Failovers:  p.failovers,
+	}
+	for i, pool := range p.pools {
+		ps := *pool
+		ps.Active = i == p.active
+		stats.Pools = append(stats.Pools, ps)
+	}
+	return stats
+}
+
+func (p *Proxy) acceptLoop(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return // Listener closed
+		}
+
+		s := newSession(p, conn)
+		p.mu.Lock()
+		p.sessions[s] = struct{}{}
+		p.mu.Unlock()
+
+		go s.run()
+	}
+}
+
+// primaryCheckLoop moves sessions back to the primary pool once it recovers
+func (p *Proxy) primaryCheckLoop(stop chan struct{}) {
+	ticker := time.NewTicker(primaryCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		p.mu.Lock()
+		onBackup := p.active != 0
+		primary := p.pools[0].URL
+		p.mu.Unlock()
+		if !onBackup {
+			continue
+		}
+
+		conn, err := p.dialPool(primary)
+		if err != nil {
+			continue
+		}
+		conn.Close()
+
+		if p.debug {
+			fmt.Printf("Stratum proxy: primary pool %s is back, switching\n", primary)
+		}
+		p.mu.Lock()
+		p.active = 0
+		sessions := make([]*session, 0, len(p.sessions))
+		for s := range p.sessions {
+			sessions = append(sessions, s)
+		}
+		p.mu.Unlock()
+
+		for _, s := range sessions {
+			s.switchUpstream(0)
+		}
+	}
+}
+
+// connectUpstream dials pools in failover order starting at index from and
+// returns the first that connects
+func (p *Proxy) connectUpstream(from int) (net.Conn, int, error) {
+	p.mu.Lock()
+	count := len(p.pools)
+	p.mu.Unlock()
+
+	var lastErr error
+	for i := 0; i < count; i++ {
+		idx := (from + i) % count
+
+		p.mu.Lock()
+		pool := p.pools[idx]
+		poolURL := pool.URL
+		p.mu.Unlock()
+
+		conn, err := p.dialPool(poolURL)
+
+		p.mu.Lock()
+		if err != nil {
+			pool.Failures++
+			pool.LastError = err.Error()
+			p.mu.Unlock()
+			lastErr = err
+			if p.debug {
+				fmt.Printf("Stratum proxy: %s unreachable: %v\n", poolURL, err)
+			}
+			continue
+		}
+		pool.Connects++
+		if idx != p.active {
+			p.active = idx
+			p.failovers++
+		}
+		p.mu.Unlock()
+
+		return conn, idx, nil
+	}
+	return nil, 0, fmt.Errorf("all pools unreachable: %w", lastErr)
+}
+
+// recordShare updates the accepted/rejected counters for a pool
+func (p *Proxy) recordShare(poolIdx int, accepted bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if poolIdx >= len(p.pools) {
+		return
+	}
+	if accepted {
+		p.pools[poolIdx].Accepted++
+	} else {
+		p.pools[poolIdx].Rejected++
+	}
+}
+
+func (p *Proxy) removeSession(s *session) {
+	p.mu.Lock()
+	delete(p.sessions, s)
+	p.mu.Unlock()
+}
+
+func (p *Proxy) poolURL(idx int) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.pools[idx].URL
+}
+
+func (p *Proxy) activePool() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.active
+}
+
+// parsePoolURL splits a pool URL into host:port and whether it uses TLS
+func parsePoolURL(pool string) (string, bool, error) {
+	if !strings.Contains(pool, "://") {
+		pool = "stratum+tcp://" + pool
+	}
+	u, err := url.Parse(pool)
+	if err != nil || u.Host == "" || u.Port() == "" {
+		return "", false, fmt.Errorf("invalid pool URL %q (expected scheme://host:port)", pool)
+	}
+
+	useTLS := false
+	switch u.Scheme {
+	case "stratum+tcp", "stratum", "tcp", "stratum1+tcp", "stratum2+tcp", "ethproxy+tcp", "nicehash+tcp", "ethnh+tcp":
+	case "stratum+ssl", "stratum+tls", "ssl", "tls", "stratum1+ssl", "stratum2+ssl", "ethproxy+ssl", "nicehash+ssl", "ethnh+ssl":
+		useTLS = true
+	default:
+		return "", false, fmt.Errorf("unsupported pool scheme %q", u.Scheme)
+	}
+	return u.Host, useTLS, nil
+}
+
+// dialPool connects to a pool, performing the TLS handshake if required
+func (p *Proxy) dialPool(pool string) (net.Conn, error) {
+	address, useTLS, err := parsePoolURL(pool)
+	if err != nil {
+		return nil, err
+	}
+
+	dial := p.dial
+	if dial == nil {
+		dialer := &net.Dialer{KeepAlive: 30 * time.Second}
+		dial = dialer.DialContext
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	conn, err := dial(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	if !useTLS {
+		return conn, nil
+	}
+
+	host, _, _ := net.SplitHostPort(address)
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: host})
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
@@ -0,0 +1,328 @@
+package stratum
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// Handshake methods are recorded and replayed to a new upstream on failover
+// so the miner never sees the switch
+var handshakeMethods = map[string]bool{
+	"mining.subscribe":            true,
+	"mining.authorize":            true,
+	"mining.configure":            true,
+	"mining.extranonce.subscribe": true,
+	"mining.suggest_difficulty":   true,
+	"eth_submitLogin":             true, // EthProxy
+	"login":                       true, // XMRig/cryptonote
+}
+
+// Share submission methods across stratum dialects
+var submitMethods = map[string]bool{
+	"mining.submit":  true,
+	"eth_submitWork": true,
+	"submit":         true,
+}
+
+// replayIDBase offsets the ids of replayed requests so their responses can
+// be recognised and kept from the miner
+const replayIDBase = 1 << 30
+
+type rpcMessage struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  json.RawMessage `json:"error"`
+}
+
+// session is a single miner connection and its current upstream
+type session struct {
+	proxy *Proxy
+	miner net.Conn
+
+	minerMu sync.Mutex // Serialises writes to the miner
+
+	mu            sync.Mutex
+	upstream      net.Conn
+	poolIdx       int
+	handshake     map[string][]byte // method -> raw request line
+	order         []string          // Handshake replay order
+	pending       map[string]bool   // Outstanding submit ids
+	replayed      map[string]string // Replayed request id -> method
+	extranonceSub bool
+	nextReplayID  int
+	closed        bool
+}
+
+func newSession(p *Proxy, miner net.Conn) *session {
+	return &session{
+		proxy:        p,
+		miner:        miner,
+		handshake:    make(map[string][]byte),
+		pending:      make(map[string]bool),
+		replayed:     make(map[string]string),
+		nextReplayID: replayIDBase,
+	}
+}
+
+func (s *session) run() {
+	defer s.close()
+
+	conn, idx, err := s.proxy.connectUpstream(s.proxy.activePool())
+	if err != nil {
+		fmt.Printf("Stratum proxy: %v\n", err)
+		return
+	}
+	s.mu.Lock()
+	s.upstream = conn
+	s.poolIdx = idx
+	s.mu.Unlock()
+	go s.readUpstream(conn, idx)
+
+	reader := bufio.NewReader(s.miner)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			return
+		}
+
+		var msg rpcMessage
+		if json.Unmarshal(line, &msg) == nil && msg.Method != "" {
+			s.mu.Lock()
+			if handshakeMethods[msg.Method] {
+				if _, seen := s.handshake[msg.Method]; !seen {
+					s.order = append(s.order, msg.Method)
+				}
+				s.handshake[msg.Method] = line
+				if msg.Method == "mining.extranonce.subscribe" {
+					s.extranonceSub = true
+				}
+			}
+			if submitMethods[msg.Method] && len(msg.ID) > 0 {
+				s.pending[string(msg.ID)] = true
+			}
+			s.mu.Unlock()
+		}
+
+		if conn, err := s.writeUpstream(line); err != nil {
+			s.failover(conn)
+		}
+	}
+}
+
+func (s *session) writeUpstream(line []byte) (net.Conn, error) {
+	s.mu.Lock()
+	conn := s.upstream
+	s.mu.Unlock()
+	if conn == nil {
+		return nil, fmt.Errorf("no upstream")
+	}
+	_, err := conn.Write(line)
+	return conn, err
+}
+
+func (s *session) writeMiner(line []byte) error {
+	s.minerMu.Lock()
+	defer s.minerMu.Unlock()
+	_, err := s.miner.Write(line)
+	return err
+}
+
+// readUpstream forwards pool messages to the miner until the connection drops
+func (s *session) readUpstream(conn net.Conn, poolIdx int) {
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			if s.proxy.debug {
+				fmt.Printf("Stratum proxy: upstream lost: %v\n", err)
+			}
+			s.failover(conn)
+			return
+		}
+
+		var msg rpcMessage
+		parsed := json.Unmarshal(line, &msg) == nil
+		if parsed {
+			s.observeJob(&msg)
+		}
+		if parsed && len(msg.ID) > 0 && msg.Method == "" {
+			id := string(msg.ID)
+
+			s.mu.Lock()
+			replayMethod, isReplay := s.replayed[id]
+			delete(s.replayed, id)
+			isSubmit := s.pending[id]
+			delete(s.pending, id)
+			s.mu.Unlock()
+
+			if isReplay {
+				s.handleReplayResponse(replayMethod, &msg)
+				continue
+			}
+			if isSubmit {
+				accepted := string(msg.Result) == "true" && (len(msg.Error) == 0 || string(msg.Error) == "null")
+				if !accepted && len(msg.Result) > 0 && msg.Result[0] == '{' {
+					// XMRig-style {"status":"OK"}
+					var result struct {
+						Status string `json:"status"`
+					}
+					json.Unmarshal(msg.Result, &result)
+					accepted = result.Status == "OK"
+				}
+				s.proxy.recordShare(poolIdx, accepted)
+			}
+		}
+
+		if err := s.writeMiner(line); err != nil {
+			s.close()
+			return
+		}
+	}
+}
+
+// observeJob follows the DAG epoch of ethash-family jobs: mining.notify
+// params, or EthProxy work arrays pushed or returned by eth_getWork
+func (s *session) observeJob(msg *rpcMessage) {
+	var params []json.RawMessage
+	switch {
+	case msg.Method == "mining.notify":
+		if json.Unmarshal(msg.Params, &params) == nil {
+			s.proxy.epoch.observeJob(params, false)
+		}
+	case msg.Method == "" && len(msg.Result) > 0 && msg.Result[0] == '[':
+		if json.Unmarshal(msg.Result, &params) == nil && len(params) >= 3 {
+			s.proxy.epoch.observeJob(params, true)
+		}
+	}
+}
+
+// handleReplayResponse passes the new upstream's session parameters to the
+// miner in place of the swallowed handshake response
+func (s *session) handleReplayResponse(method string, msg *rpcMessage) {
+	switch method {
+	case "mining.subscribe":
+		// result: [subscriptions, extranonce1, extranonce2_size]
+		var result []json.RawMessage
+		if json.Unmarshal(msg.Result, &result) != nil || len(result) < 3 {
+			return
+		}
+		s.mu.Lock()
+		canSet := s.extranonceSub
+		s.mu.Unlock()
+		if !canSet {
+			// The miner can't take a new extranonce; make it reconnect
+			s.close()
+			return
+		}
+		notify, _ := json.Marshal(map[string]interface{}{
+			"id":     nil,
+			"method": "mining.set_extranonce",
+			"params": []json.RawMessage{result[1], result[2]},
+		})
+		s.writeMiner(append(notify, '\n'))
+	case "login":
+		var result struct {
+			Job json.RawMessage `json:"job"`
+		}
+		if json.Unmarshal(msg.Result, &result) != nil || len(result.Job) == 0 {
+			return
+		}
+		notify, _ := json.Marshal(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"method":  "job",
+			"params":  result.Job,
+		})
+		s.writeMiner(append(notify, '\n'))
+	}
+}
+
+// failover moves the session to the next reachable pool, unless failed has
+// already been replaced
+func (s *session) failover(failed net.Conn) {
+	s.mu.Lock()
+	if s.closed || s.upstream != failed {
+		s.mu.Unlock()
+		return
+	}
+	from := s.poolIdx + 1
+	s.mu.Unlock()
+
+	s.switchUpstream(from)
+}
+
+// switchUpstream reconnects to pools starting at index from and replays the
+// miner's handshake so the miner keeps its connection and DAG
+func (s *session) switchUpstream(from int) {
+	conn, idx, err := s.proxy.connectUpstream(from)
+	if err != nil {
+		fmt.Printf("Stratum proxy: %v\n", err)
+		s.close()
+		return
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		conn.Close()
+		return
+	}
+	old := s.upstream
+	s.upstream = conn
+	s.poolIdx = idx
+	// Shares in flight to the old pool will never be answered
+	s.pending = make(map[string]bool)
+	s.replayed = make(map[string]string)
+
+	var replay [][]byte
+	for _, method := range s.order {
+		var req map[string]json.RawMessage
+		if json.Unmarshal(s.handshake[method], &req) != nil {
+			continue
+		}
+		s.nextReplayID++
+		id := fmt.Sprintf("%d", s.nextReplayID)
+		req["id"] = json.RawMessage(id)
+		s.replayed[id] = method
+		line, err := json.Marshal(req)
+		if err != nil {
+			continue
+		}
+		replay = append(replay, append(line, '\n'))
+	}
+	s.mu.Unlock()
+
+	if old != nil {
+		old.Close()
+	}
+
+	fmt.Printf("Stratum proxy: switched to %s\n", s.proxy.poolURL(idx))
+	go s.readUpstream(conn, idx)
+
+	for _, line := range replay {
+		if _, err := conn.Write(line); err != nil {
+			return // readUpstream will fail over again
+		}
+	}
+}
+
+func (s *session) close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	upstream := s.upstream
+	s.mu.Unlock()
+
+	if upstream != nil {
+		upstream.Close()
+	}
+	s.miner.Close()
+	s.proxy.removeSession(s)
+}
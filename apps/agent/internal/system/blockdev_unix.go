@@ -0,0 +1,36 @@
+//go:build !windows
+
+package system
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// blockDevice returns the partition and disk names ("sda1", "sda") a
+// mount point is on, via the device number in sysfs. Both are empty for
+// filesystems not on a block device, e.g. tmpfs or overlays.
+func blockDevice(path string) (string, string) {
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return "", ""
+	}
+	dev := uint64(st.Dev)
+	link, err := os.Readlink(filepath.Join("/sys/dev/block", fmt.Sprintf("%d:%d", unix.Major(dev), unix.Minor(dev))))
+	if err != nil {
+		return "", ""
+	}
+
+	// ../../devices/.../block/sda/sda1 for a partition, .../block/sda for
+	// a whole disk
+	partition := filepath.Base(link)
+	disk := filepath.Base(filepath.Dir(link))
+	if disk == "block" || !strings.HasPrefix(partition, disk) {
+		disk = partition
+	}
+	return partition, disk
+}
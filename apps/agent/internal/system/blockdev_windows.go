@@ -0,0 +1,7 @@
+package system
+
+// blockDevice is not needed on Windows, which doesn't remount disks
+// read-only
+func blockDevice(path string) (string, string) {
+	return "", ""
+}
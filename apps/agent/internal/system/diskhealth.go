@@ -0,0 +1,186 @@
+package system
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// DiskHealth is the state of the filesystems the rig boots and keeps its
+// state on. USB sticks and cheap SSDs wear out: the kernel then logs I/O
+// errors and remounts the filesystem read-only to protect it.
+type DiskHealth struct {
+	ReadOnly       bool     `json:"readOnly"`
+	ReadOnlyMounts []string `json:"readOnlyMounts,omitempty"` // Mount points that went read-only
+	Device         string   `json:"device,omitempty"`         // Boot device, e.g. sda
+	IOErrors       int      `json:"ioErrors"`                 // Failed commands on it since boot
+	FSErrors       int      `json:"fsErrors"`                 // Errors the filesystem recorded
+}
+
+// Degraded reports whether the disk shouldn't be written to
+func (h *DiskHealth) Degraded() bool {
+	return h.ReadOnly || h.IOErrors > 0 || h.FSErrors > 0
+}
+
+// Ignore drops mount points that are read-only by design, e.g. the root
+// of an image keeping its state on a separate partition
+func (h *DiskHealth) Ignore(mounts []string) {
+	var readOnly []string
+	for _, point := range h.ReadOnlyMounts {
+		ignored := false
+		for _, m := range mounts {
+			ignored = ignored || m == point
+		}
+		if !ignored {
+			readOnly = append(readOnly, point)
+		}
+	}
+	h.ReadOnlyMounts = readOnly
+	h.ReadOnly = len(readOnly) > 0
+}
+
+// CheckDiskHealth checks the root filesystem and the one holding dir,
+// usually the agent's state directory
+func CheckDiskHealth(dir string) *DiskHealth {
+	health := &DiskHealth{}
+	mounts := readMounts()
+
+	seen := map[string]bool{}
+	for _, path := range []string{"/", dir} {
+		m := mountOf(mounts, path)
+		if m == nil || seen[m.point] {
+			continue
+		}
+		seen[m.point] = true
+		if m.readOnly {
+			health.ReadOnly = true
+			health.ReadOnlyMounts = append(health.ReadOnlyMounts, m.point)
+		}
+
+		partition, disk := blockDevice(m.point)
+		if partition == "" {
+			continue
+		}
+		if health.Device == "" {
+			health.Device = disk
+		}
+		// SCSI disks, including USB sticks, count failed commands
+		health.IOErrors += readHexCounter(filepath.Join("/sys/class/block", disk, "device", "ioerr_cnt"))
+		if m.fsType == "ext4" {
+			health.FSErrors += readCounter(filepath.Join("/sys/fs/ext4", partition, "errors_count"))
+		}
+	}
+	return health
+}
+
+// mount is an entry of /proc/mounts
+type mount struct {
+	point    string
+	fsType   string
+	readOnly bool
+}
+
+func readMounts() []mount {
+	f, err := os.Open("/proc/mounts")
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var mounts []mount
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		m := mount{point: unescapeMount(fields[1]), fsType: fields[2]}
+		for _, option := range strings.Split(fields[3], ",") {
+			if option == "ro" {
+				m.readOnly = true
+			}
+		}
+		mounts = append(mounts, m)
+	}
+	return mounts
+}
+
+// unescapeMount decodes the octal escapes (\040 for a space) of
+// /proc/mounts
+func unescapeMount(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// mountOf finds the mount holding path: the last mounted of the longest
+// matching mount points, as later mounts hide earlier ones
+func mountOf(mounts []mount, path string) *mount {
+	var best *mount
+	for i := range mounts {
+		m := &mounts[i]
+		if path != m.point && m.point != "/" && !strings.HasPrefix(path, m.point+"/") {
+			continue
+		}
+		if best == nil || len(m.point) >= len(best.point) {
+			best = m
+		}
+	}
+	return best
+}
+
+func readCounter(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	return n
+}
+
+func readHexCounter(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	n, _ := strconv.ParseInt(strings.TrimPrefix(strings.TrimSpace(string(data)), "0x"), 16, 64)
+	return int(n)
+}
+
+var diskDegraded atomic.Bool
+
+// SetDiskDegraded switches the agent's degraded disk mode, in which
+// optional writes such as caches and history are skipped
+func SetDiskDegraded(degraded bool) {
+	diskDegraded.Store(degraded)
+}
+
+// DiskDegraded reports whether writes to the disk should be avoided
+func DiskDegraded() bool {
+	return diskDegraded.Load()
+}
+
+// VolatileDir is where output that can't be skipped, e.g. miner logs,
+// goes in degraded disk mode: RAM-backed where possible, so it is gone
+// after a reboot
+func VolatileDir() string {
+	if info, err := os.Stat("/dev/shm"); err == nil && info.IsDir() {
+		return "/dev/shm/bloxos"
+	}
+	return filepath.Join(os.TempDir(), "bloxos")
+}
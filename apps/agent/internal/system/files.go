@@ -0,0 +1,37 @@
+package system
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// WriteRootFile writes a root-owned file, using sudo tee when not running as root
+func WriteRootFile(path, content string) error {
+	if os.Geteuid() == 0 {
+		return os.WriteFile(path, []byte(content), 0644)
+	}
+
+	cmd := exec.Command("sudo", "tee", path)
+	cmd.Stdin = strings.NewReader(content)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// RemoveRootFile removes a root-owned file, ignoring files that don't exist
+func RemoveRootFile(path string) error {
+	if os.Geteuid() == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	if output, err := exec.Command("sudo", "rm", "-f", path).CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
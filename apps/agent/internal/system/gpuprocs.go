@@ -0,0 +1,265 @@
+package system
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// GPUProcess is a process holding a GPU device open
+type GPUProcess struct {
+	PID      int      `json:"pid"`
+	Name     string   `json:"name"` // As in /proc/<pid>/comm
+	Command  string   `json:"command"`
+	User     string   `json:"user,omitempty"`
+	BusIDs   []string `json:"busIds,omitempty"`   // GPUs in use, where known
+	MemoryMB *int     `json:"memoryMb,omitempty"` // NVIDIA compute processes only
+	Managed  bool     `json:"managed"`            // The agent's own miner
+}
+
+// killGracePeriod is how long a process gets to exit after SIGTERM
+const killGracePeriod = 5 * time.Second
+
+var (
+	renderNode   = regexp.MustCompile(`^/dev/dri/(renderD\d+|card\d+)$`)
+	nvidiaDevice = regexp.MustCompile(`^/dev/nvidia(\d+)$`)
+)
+
+// ListGPUProcesses finds the processes using a GPU: NVIDIA compute apps as
+// reported by nvidia-smi, plus anything holding a DRM, KFD or NVIDIA device
+// node open
+func ListGPUProcesses() ([]GPUProcess, error) {
+	procs := map[int]*GPUProcess{}
+	get := func(pid int) *GPUProcess {
+		if p, ok := procs[pid]; ok {
+			return p
+		}
+		p := &GPUProcess{PID: pid}
+		procs[pid] = p
+		return p
+	}
+
+	if output, err := exec.Command("nvidia-smi", "--query-compute-apps=pid,used_memory,gpu_bus_id",
+		"--format=csv,noheader,nounits").Output(); err == nil {
+		for _, line := range strings.Split(string(output), "\n") {
+			fields := strings.Split(line, ",")
+			if len(fields) != 3 {
+				continue
+			}
+			pid, err := strconv.Atoi(strings.TrimSpace(fields[0]))
+			if err != nil {
+				continue
+			}
+			p := get(pid)
+			if mem, err := strconv.Atoi(strings.TrimSpace(fields[1])); err == nil {
+				p.MemoryMB = &mem
+			}
+			p.addBusID(nvidiaSmiBusID(strings.TrimSpace(fields[2])))
+		}
+	}
+
+	nvidiaMinors := nvidiaMinorBusIDs()
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	self := os.Getpid()
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || pid == self {
+			continue
+		}
+		fdDir := filepath.Join("/proc", entry.Name(), "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue // Exited, or another user's process without root
+		}
+		for _, fd := range fds {
+			target, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil {
+				continue
+			}
+			switch {
+			case target == "/dev/kfd":
+				get(pid)
+			case renderNode.MatchString(target):
+				get(pid).addBusID(drmBusID(renderNode.FindStringSubmatch(target)[1]))
+			case nvidiaDevice.MatchString(target):
+				get(pid).addBusID(nvidiaMinors[nvidiaDevice.FindStringSubmatch(target)[1]])
+			}
+		}
+	}
+
+	var list []GPUProcess
+	for _, p := range procs {
+		if !fillProcessInfo(p) {
+			continue
+		}
+		sort.Strings(p.BusIDs)
+		list = append(list, *p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].PID < list[j].PID })
+	return list, nil
+}
+
+// KillGPUProcess stops a GPU process after checking it still runs under the
+// expected name, so a recycled PID is never hit. It sends SIGTERM, then
+// SIGKILL when the process outlives the grace period or force is set.
+func KillGPUProcess(pid int, name string, force bool) error {
+	if pid <= 1 || pid == os.Getpid() {
+		return fmt.Errorf("refusing to kill pid %d", pid)
+	}
+	if name == "" {
+		return fmt.Errorf("process name required")
+	}
+
+	procs, err := ListGPUProcesses()
+	if err != nil {
+		return err
+	}
+	var target *GPUProcess
+	for i := range procs {
+		if procs[i].PID == pid {
+			target = &procs[i]
+			break
+		}
+	}
+	if target == nil {
+		return fmt.Errorf("pid %d is not a GPU process", pid)
+	}
+	if target.Name != name {
+		return fmt.Errorf("pid %d is %q, not %q", pid, target.Name, name)
+	}
+
+	signal := syscall.SIGTERM
+	if force {
+		signal = syscall.SIGKILL
+	}
+	if err := signalProcess(pid, signal); err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(killGracePeriod)
+	for time.Now().Before(deadline) {
+		if !processAlive(pid) {
+			return nil
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	if err := signalProcess(pid, syscall.SIGKILL); err != nil {
+		return err
+	}
+	time.Sleep(500 * time.Millisecond)
+	if processAlive(pid) {
+		return fmt.Errorf("pid %d did not exit", pid)
+	}
+	return nil
+}
+
+func (p *GPUProcess) addBusID(busID string) {
+	if busID == "" {
+		return
+	}
+	for _, id := range p.BusIDs {
+		if id == busID {
+			return
+		}
+	}
+	p.BusIDs = append(p.BusIDs, busID)
+}
+
+// fillProcessInfo reads the name, command line and owner of a process,
+// returning false when it has exited
+func fillProcessInfo(p *GPUProcess) bool {
+	dir := filepath.Join("/proc", strconv.Itoa(p.PID))
+	comm, err := os.ReadFile(filepath.Join(dir, "comm"))
+	if err != nil {
+		return false
+	}
+	p.Name = strings.TrimSpace(string(comm))
+
+	if cmdline, err := os.ReadFile(filepath.Join(dir, "cmdline")); err == nil {
+		p.Command = strings.TrimSpace(strings.ReplaceAll(string(cmdline), "\x00", " "))
+	}
+
+	if info, err := os.Stat(dir); err == nil {
+		p.User = fileOwner(info)
+	}
+	return true
+}
+
+// userName looks up a uid in /etc/passwd, falling back to the number
+func userName(uid uint32) string {
+	id := strconv.FormatUint(uint64(uid), 10)
+	f, err := os.Open("/etc/passwd")
+	if err != nil {
+		return id
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) > 2 && fields[2] == id {
+			return fields[0]
+		}
+	}
+	return id
+}
+
+// drmBusID resolves a DRM node name like "renderD128" to its PCI address
+func drmBusID(node string) string {
+	target, err := filepath.EvalSymlinks(filepath.Join("/sys/class/drm", node, "device"))
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(target)
+}
+
+// nvidiaMinorBusIDs maps /dev/nvidiaN minor numbers to PCI addresses
+func nvidiaMinorBusIDs() map[string]string {
+	minors := map[string]string{}
+	dirs, _ := filepath.Glob("/proc/driver/nvidia/gpus/*")
+	for _, dir := range dirs {
+		data, err := os.ReadFile(filepath.Join(dir, "information"))
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if key, value, ok := strings.Cut(line, ":"); ok && strings.TrimSpace(key) == "Device Minor" {
+				minors[strings.TrimSpace(value)] = strings.ToLower(filepath.Base(dir))
+			}
+		}
+	}
+	return minors
+}
+
+// nvidiaSmiBusID shortens nvidia-smi's "00000000:01:00.0" to "0000:01:00.0"
+func nvidiaSmiBusID(busID string) string {
+	busID = strings.ToLower(busID)
+	if parts := strings.SplitN(busID, ":", 2); len(parts) == 2 && len(parts[0]) > 4 {
+		return parts[0][len(parts[0])-4:] + ":" + parts[1]
+	}
+	return busID
+}
+
+// processAlive reports whether a process exists and is not a zombie
+func processAlive(pid int) bool {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return false
+	}
+	// State follows the parenthesized command name
+	if i := strings.LastIndex(string(data), ")"); i >= 0 && i+2 < len(data) {
+		return data[i+2] != 'Z'
+	}
+	return true
+}
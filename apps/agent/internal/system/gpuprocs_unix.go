@@ -0,0 +1,37 @@
+//go:build !windows
+
+package system
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// fileOwner returns the user owning a file
+func fileOwner(info os.FileInfo) string {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return userName(stat.Uid)
+	}
+	return ""
+}
+
+// signalProcess signals a process, through sudo when it belongs to another
+// user and the agent is not root
+func signalProcess(pid int, signal syscall.Signal) error {
+	err := syscall.Kill(pid, signal)
+	if err == nil || err == syscall.ESRCH {
+		return nil
+	}
+	if err != syscall.EPERM || os.Geteuid() == 0 {
+		return err
+	}
+	output, err := exec.Command("sudo", "kill", "-"+strconv.Itoa(int(signal)), strconv.Itoa(pid)).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
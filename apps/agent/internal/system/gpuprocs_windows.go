@@ -0,0 +1,20 @@
+package system
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileOwner is unknown on Windows, where there's no /proc to read it from
+func fileOwner(info os.FileInfo) string {
+	return ""
+}
+
+// signalProcess ends a process; Windows has no signals to send
+func signalProcess(pid int, signal syscall.Signal) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return nil // Already gone
+	}
+	return process.Kill()
+}
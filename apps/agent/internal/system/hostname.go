@@ -0,0 +1,125 @@
+package system
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// hostnameRe matches a valid RFC 1123 hostname label
+var hostnameRe = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// ValidateHostname checks that name is a single valid hostname label
+func ValidateHostname(name string) error {
+	if !hostnameRe.MatchString(name) {
+		return fmt.Errorf("invalid hostname %q: use 1-63 lowercase letters, digits or hyphens", name)
+	}
+	return nil
+}
+
+// HostnameFromRigName converts a dashboard rig name ("Rig #3 Garage") into
+// a valid hostname ("rig-3-garage")
+func HostnameFromRigName(name string) string {
+	var b strings.Builder
+	lastHyphen := true
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9'):
+			b.WriteRune(r)
+			lastHyphen = false
+		case !lastHyphen:
+			b.WriteRune('-')
+			lastHyphen = true
+		}
+	}
+
+	hostname := strings.Trim(b.String(), "-")
+	if len(hostname) > 63 {
+		hostname = strings.TrimRight(hostname[:63], "-")
+	}
+	return hostname
+}
+
+// SetHostname changes the OS hostname persistently and keeps /etc/hosts in sync
+func SetHostname(name string) error {
+	if err := ValidateHostname(name); err != nil {
+		return err
+	}
+
+	previous, _ := os.Hostname()
+
+	// hostnamectl persists to /etc/hostname on systemd systems
+	if output, err := exec.Command("sudo", "hostnamectl", "set-hostname", name).CombinedOutput(); err != nil {
+		// Fallback for non-systemd images
+		if err := WriteRootFile("/etc/hostname", name+"\n"); err != nil {
+			return fmt.Errorf("hostnamectl failed (%s) and /etc/hostname write failed: %w",
+				strings.TrimSpace(string(output)), err)
+		}
+		if output, err := exec.Command("sudo", "hostname", name).CombinedOutput(); err != nil {
+			return fmt.Errorf("hostname failed: %v: %s", err, strings.TrimSpace(string(output)))
+		}
+	}
+
+	if previous != "" && previous != name {
+		if err := updateHostsFile(previous, name); err != nil {
+			return fmt.Errorf("hostname set but /etc/hosts update failed: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// updateHostsFile renames the old hostname wherever it appears as a whole
+// name in /etc/hosts and makes sure the 127.0.1.1 entry carries the new one,
+// so sudo keeps resolving the host. Other aliases and comments are kept.
+func updateHostsFile(previous, name string) error {
+	data, err := os.ReadFile("/etc/hosts")
+	if err != nil {
+		return err
+	}
+
+	lines := strings.Split(string(data), "\n")
+	found := false
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		// Names end where a trailing comment starts
+		names, comment := fields[1:], ""
+		if idx := strings.Index(line, "#"); idx >= 0 {
+			comment = " " + line[idx:]
+			names = strings.Fields(line[:idx])[1:]
+		}
+
+		changed := false
+		hasName := false
+		for j, field := range names {
+			if field == previous {
+				names[j] = name
+				changed = true
+			}
+			if names[j] == name {
+				hasName = true
+			}
+		}
+		if fields[0] == "127.0.1.1" {
+			found = true
+			if !hasName {
+				names = append([]string{name}, names...)
+				changed = true
+			}
+		}
+		if changed {
+			lines[i] = fields[0] + "\t" + strings.Join(names, " ") + comment
+		}
+	}
+	if !found {
+		lines = append(lines, "127.0.1.1\t"+name)
+	}
+
+	return WriteRootFile("/etc/hosts", strings.Join(lines, "\n"))
+}
@@ -0,0 +1,132 @@
+package system
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Update channels a rig can follow
+const (
+	ChannelStable = "stable"
+	ChannelBeta   = "beta"
+)
+
+// imageReleaseFile is written into BloxOs disk images at build time, in
+// os-release format (BLOXOS_VERSION, BLOXOS_CHANNEL, BLOXOS_BUILD_DATE)
+const imageReleaseFile = "/etc/bloxos-release"
+
+// ImageInfo describes the BloxOs image and the update channel of the rig
+type ImageInfo struct {
+	Version      string `json:"version,omitempty"`   // Image version; empty on stock installs
+	BuildDate    string `json:"buildDate,omitempty"` // Image build date
+	ImageChannel string `json:"imageChannel,omitempty"`
+	AgentVersion string `json:"agentVersion"`
+	AgentChannel string `json:"agentChannel"`         // Channel the agent binary was built for
+	Channel      string `json:"channel"`              // Channel updates are taken from
+	LastUpdate   int64  `json:"lastUpdate,omitempty"` // Unix seconds of the last OS, driver or agent update
+}
+
+// imageState is the rig-local part of ImageInfo
+type imageState struct {
+	Channel      string `json:"channel,omitempty"` // Set by the server, overrides the image channel
+	AgentVersion string `json:"agentVersion,omitempty"`
+	LastUpdate   int64  `json:"lastUpdate,omitempty"`
+}
+
+func imageStatePath() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".bloxos", "image.json")
+}
+
+// GetImageInfo reads the image release file and the rig's update state
+func GetImageInfo(agentVersion, agentChannel string) *ImageInfo {
+	info := &ImageInfo{AgentVersion: agentVersion, AgentChannel: agentChannel}
+
+	if f, err := os.Open(imageReleaseFile); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+			if !ok {
+				continue
+			}
+			value = strings.Trim(value, `"'`)
+			switch key {
+			case "BLOXOS_VERSION":
+				info.Version = value
+			case "BLOXOS_CHANNEL":
+				info.ImageChannel = value
+			case "BLOXOS_BUILD_DATE":
+				info.BuildDate = value
+			}
+		}
+		f.Close()
+	}
+
+	state := loadImageState()
+	info.LastUpdate = state.LastUpdate
+	switch {
+	case state.Channel != "":
+		info.Channel = state.Channel
+	case info.ImageChannel != "":
+		info.Channel = info.ImageChannel
+	default:
+		info.Channel = agentChannel
+	}
+	return info
+}
+
+// SetUpdateChannel switches the channel the rig takes updates from
+func SetUpdateChannel(channel string) error {
+	if channel != ChannelStable && channel != ChannelBeta {
+		return fmt.Errorf("channel must be %s or %s", ChannelStable, ChannelBeta)
+	}
+	state := loadImageState()
+	state.Channel = channel
+	return saveImageState(state)
+}
+
+// RecordUpdate stamps the time of an OS, driver or agent update
+func RecordUpdate() error {
+	state := loadImageState()
+	state.LastUpdate = time.Now().Unix()
+	return saveImageState(state)
+}
+
+// RecordAgentVersion notes the running agent version, counting a change
+// since the last start as an update
+func RecordAgentVersion(version string) error {
+	state := loadImageState()
+	if state.AgentVersion == version {
+		return nil
+	}
+	if state.AgentVersion != "" {
+		state.LastUpdate = time.Now().Unix()
+	}
+	state.AgentVersion = version
+	return saveImageState(state)
+}
+
+func loadImageState() *imageState {
+	state := &imageState{}
+	if data, err := os.ReadFile(imageStatePath()); err == nil {
+		json.Unmarshal(data, state)
+	}
+	return state
+}
+
+func saveImageState(state *imageState) error {
+	path := imageStatePath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
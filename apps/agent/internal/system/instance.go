@@ -0,0 +1,39 @@
+package system
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"os"
+	"sort"
+	"strings"
+)
+
+// InstanceID identifies the hardware the agent runs on, so the server can
+// tell two rigs sharing a token apart, e.g. after a disk image was cloned
+// with the token in it. It's derived from the board UUID where readable
+// and the burned-in MAC addresses, none of which are copied with a disk.
+// Empty when there is nothing to derive it from.
+func InstanceID() string {
+	var ids []string
+	if uuid, err := os.ReadFile("/sys/class/dmi/id/product_uuid"); err == nil {
+		ids = append(ids, strings.ToLower(strings.TrimSpace(string(uuid))))
+	}
+
+	interfaces, _ := net.Interfaces()
+	for _, iface := range interfaces {
+		mac := iface.HardwareAddr
+		// Virtual and randomized MACs are locally administered
+		if iface.Flags&net.FlagLoopback != 0 || len(mac) != 6 || mac[0]&0x02 != 0 {
+			continue
+		}
+		ids = append(ids, mac.String())
+	}
+	if len(ids) == 0 {
+		return ""
+	}
+
+	sort.Strings(ids)
+	sum := sha256.Sum256([]byte(strings.Join(ids, "\n")))
+	return hex.EncodeToString(sum[:8])
+}
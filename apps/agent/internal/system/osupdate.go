@@ -0,0 +1,193 @@
+package system
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// PackageUpdate is an upgradable package
+type PackageUpdate struct {
+	Name     string `json:"name"`
+	Version  string `json:"version"`
+	Current  string `json:"current,omitempty"`
+	Class    string `json:"class"`    // kernel, driver or other
+	Security bool   `json:"security"` // Published in a security pocket
+}
+
+// OSUpdateProgress reports the progress of ApplyOSUpdates
+type OSUpdateProgress struct {
+	Stage   string  `json:"stage"`   // download or install
+	Percent float64 `json:"percent"` // Overall, 0-100
+	Message string  `json:"message,omitempty"`
+}
+
+// Package name prefixes of GPU drivers and kernels, the packages rigs are
+// patched for besides security fixes
+var (
+	driverPackages = []string{"nvidia-", "libnvidia-", "xserver-xorg-video-nvidia", "cuda-", "amdgpu", "libdrm-amdgpu", "rocm", "hip-", "linux-firmware", "firmware-amd-graphics"}
+	kernelPackages = []string{"linux-image-", "linux-headers-", "linux-modules-", "linux-generic", "linux-hwe-"}
+)
+
+// Files apt-based systems create when an update needs a reboot
+const (
+	rebootRequiredFile = "/var/run/reboot-required"
+	rebootRequiredPkgs = "/var/run/reboot-required.pkgs"
+)
+
+// ListOSUpdates returns the upgradable packages, refreshing the package
+// lists first if asked to
+func ListOSUpdates(refresh bool) ([]PackageUpdate, error) {
+	if _, err := exec.LookPath("apt-get"); err != nil {
+		return nil, fmt.Errorf("OS updates require apt")
+	}
+
+	if refresh {
+		if output, err := aptCommand("apt-get", "update", "-q").CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("apt-get update failed: %v: %s", err, lastLines(string(output), 5))
+		}
+	}
+
+	output, err := exec.Command("apt", "list", "--upgradable").Output()
+	if err != nil {
+		return nil, fmt.Errorf("listing upgradable packages failed: %w", err)
+	}
+	return parseUpgradable(string(output)), nil
+}
+
+// parseUpgradable parses apt list --upgradable lines like
+// "openssl/jammy-updates,jammy-security 3.0.2-0ubuntu1.15 amd64 [upgradable from: 3.0.2-0ubuntu1.14]"
+func parseUpgradable(output string) []PackageUpdate {
+	var updates []PackageUpdate
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !strings.Contains(fields[0], "/") {
+			continue
+		}
+		name, origins, _ := strings.Cut(fields[0], "/")
+		update := PackageUpdate{
+			Name:     name,
+			Version:  fields[1],
+			Class:    packageClass(name),
+			Security: strings.Contains(origins, "-security"),
+		}
+		if i := strings.Index(line, "upgradable from: "); i >= 0 {
+			update.Current = strings.TrimSuffix(line[i+len("upgradable from: "):], "]")
+		}
+		updates = append(updates, update)
+	}
+	return updates
+}
+
+// packageClass tells kernel and GPU driver packages from the rest
+func packageClass(name string) string {
+	for _, prefix := range kernelPackages {
+		if strings.HasPrefix(name, prefix) {
+			return "kernel"
+		}
+	}
+	for _, prefix := range driverPackages {
+		if strings.HasPrefix(name, prefix) {
+			return "driver"
+		}
+	}
+	return "other"
+}
+
+// ApplyOSUpdates upgrades the given packages, reporting progress as apt
+// downloads and installs them
+func ApplyOSUpdates(packages []string, progress func(OSUpdateProgress)) error {
+	if len(packages) == 0 {
+		return nil
+	}
+
+	args := []string{"install", "--only-upgrade", "-y", "-q",
+		"-o", "APT::Status-Fd=1",
+		"-o", "Dpkg::Options::=--force-confdef",
+		"-o", "Dpkg::Options::=--force-confold"}
+	cmd := aptCommand("apt-get", append(args, packages...)...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	cmd.Stderr = cmd.Stdout
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	var tail []string
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if update, ok := parseAptStatus(line); ok {
+			if progress != nil {
+				progress(update)
+			}
+			continue
+		}
+		tail = append(tail, line)
+		if len(tail) > 10 {
+			tail = tail[1:]
+		}
+	}
+
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("apt-get install failed: %v: %s", err, strings.Join(tail, "\n"))
+	}
+	return nil
+}
+
+// parseAptStatus parses APT::Status-Fd lines like "dlstatus:1:9.09:Retrieving
+// file 1 of 11" or "pmstatus:openssl:20:Preparing openssl". Downloads are
+// the first half of the overall progress, dpkg the second.
+func parseAptStatus(line string) (OSUpdateProgress, bool) {
+	parts := strings.SplitN(line, ":", 4)
+	if len(parts) != 4 {
+		return OSUpdateProgress{}, false
+	}
+	percent, err := strconv.ParseFloat(parts[2], 64)
+	if err != nil {
+		return OSUpdateProgress{}, false
+	}
+
+	switch parts[0] {
+	case "dlstatus":
+		return OSUpdateProgress{Stage: "download", Percent: percent / 2, Message: parts[3]}, true
+	case "pmstatus":
+		return OSUpdateProgress{Stage: "install", Percent: 50 + percent/2, Message: parts[3]}, true
+	}
+	return OSUpdateProgress{}, false
+}
+
+// RebootRequired reports whether installed updates need a reboot and the
+// packages asking for it
+func RebootRequired() (bool, []string) {
+	if _, err := os.Stat(rebootRequiredFile); err != nil {
+		return false, nil
+	}
+	data, _ := os.ReadFile(rebootRequiredPkgs)
+	return true, strings.Fields(string(data))
+}
+
+// aptCommand runs an apt tool non-interactively, through sudo when not
+// running as root
+func aptCommand(name string, args ...string) *exec.Cmd {
+	if os.Geteuid() == 0 {
+		cmd := exec.Command(name, args...)
+		cmd.Env = append(os.Environ(), "DEBIAN_FRONTEND=noninteractive")
+		return cmd
+	}
+	return exec.Command("sudo", append([]string{"env", "DEBIAN_FRONTEND=noninteractive", name}, args...)...)
+}
+
+// lastLines returns the last n lines of command output for error messages
+func lastLines(output string, n int) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,42 @@
+package system
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// RebootRecord follows a reboot the server asked for, from the command's
+// acknowledgment until the agent has reported it after boot. It outlives
+// the report, so a redelivered command doesn't reboot the rig again.
+type RebootRecord struct {
+	CommandID   string `json:"commandId,omitempty"`
+	Method      string `json:"method"`
+	RequestedAt int64  `json:"requestedAt"`          // Unix seconds
+	BootedAt    int64  `json:"bootedAt,omitempty"`   // Unix seconds, once rebooted
+	ReportedAt  int64  `json:"reportedAt,omitempty"` // Unix seconds; 0 while pending
+	Failed      bool   `json:"failed,omitempty"`     // The agent came back without a reboot
+}
+
+func rebootRecordPath() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".bloxos", "reboot.json")
+}
+
+// RecordReboot stores the record of the last requested reboot
+func RecordReboot(reboot *RebootRecord) error {
+	return writeStateFile(rebootRecordPath(), reboot)
+}
+
+// LastReboot returns the record of the last requested reboot, or nil
+func LastReboot() *RebootRecord {
+	data, err := os.ReadFile(rebootRecordPath())
+	if err != nil {
+		return nil
+	}
+	var reboot RebootRecord
+	if json.Unmarshal(data, &reboot) != nil {
+		return nil
+	}
+	return &reboot
+}
@@ -0,0 +1,156 @@
+package system
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// RebootPolicy reboots a long-running rig every few days at a set time,
+// flushing driver leaks, but only while mining is healthy
+type RebootPolicy struct {
+	EveryDays   int     `json:"everyDays"`             // Reboot once the rig has been up this many days
+	At          string  `json:"at"`                    // "HH:MM" local time
+	Timezone    string  `json:"timezone,omitempty"`    // IANA name; empty = system time
+	Window      int     `json:"window,omitempty"`      // Minutes after At to wait for nominal hashrate (default 120)
+	MinHashrate float64 `json:"minHashrate,omitempty"` // H/s counted as nominal; 0 = every GPU hashing
+}
+
+// ScheduledReboot is recorded before a policy reboot and checked after it
+type ScheduledReboot struct {
+	RequestedAt int64   `json:"requestedAt"` // Unix seconds
+	Uptime      uint64  `json:"uptime"`      // Seconds up before the reboot
+	Miner       string  `json:"miner,omitempty"`
+	Hashrate    float64 `json:"hashrate"` // H/s before the reboot
+}
+
+const defaultRebootWindow = 120
+
+func rebootPolicyPath() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".bloxos", "reboot_policy.json")
+}
+
+func scheduledRebootPath() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".bloxos", "scheduled_reboot.json")
+}
+
+// SetRebootPolicy validates and stores a policy; nil or zero EveryDays
+// removes it
+func SetRebootPolicy(policy *RebootPolicy) error {
+	path := rebootPolicyPath()
+	if policy == nil || policy.EveryDays == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	if policy.EveryDays < 0 {
+		return fmt.Errorf("everyDays must be positive")
+	}
+	if _, err := time.Parse("15:04", policy.At); err != nil {
+		return fmt.Errorf("invalid time %q (use HH:MM)", policy.At)
+	}
+	if policy.Timezone != "" {
+		if _, err := time.LoadLocation(policy.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone %q: %w", policy.Timezone, err)
+		}
+	}
+	if policy.Window < 0 || policy.Window > 24*60 {
+		return fmt.Errorf("window must be 0-1440 minutes")
+	}
+	if policy.MinHashrate < 0 {
+		return fmt.Errorf("minHashrate must not be negative")
+	}
+
+	return writeStateFile(path, policy)
+}
+
+// GetRebootPolicy returns the stored policy, or nil if none is set
+func GetRebootPolicy() (*RebootPolicy, error) {
+	data, err := os.ReadFile(rebootPolicyPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var policy RebootPolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("invalid reboot policy: %w", err)
+	}
+	return &policy, nil
+}
+
+// NextReboot returns the start of the first reboot window after the rig
+// has been up EveryDays days
+func (p *RebootPolicy) NextReboot(bootTime time.Time) time.Time {
+	loc := time.Local
+	if p.Timezone != "" {
+		if l, err := time.LoadLocation(p.Timezone); err == nil {
+			loc = l
+		}
+	}
+	at, _ := time.Parse("15:04", p.At)
+
+	earliest := bootTime.In(loc).AddDate(0, 0, p.EveryDays)
+	next := time.Date(earliest.Year(), earliest.Month(), earliest.Day(), at.Hour(), at.Minute(), 0, 0, loc)
+	if next.Before(earliest) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// Due reports whether now falls in a reboot window
+func (p *RebootPolicy) Due(bootTime, now time.Time) bool {
+	window := time.Duration(p.Window) * time.Minute
+	if p.Window == 0 {
+		window = defaultRebootWindow * time.Minute
+	}
+	// Past the first window, later days' windows count too
+	for start := p.NextReboot(bootTime); !start.After(now); start = start.AddDate(0, 0, 1) {
+		if now.Before(start.Add(window)) {
+			return true
+		}
+	}
+	return false
+}
+
+// RecordScheduledReboot notes a policy reboot for verification after boot
+func RecordScheduledReboot(reboot *ScheduledReboot) error {
+	return writeStateFile(scheduledRebootPath(), reboot)
+}
+
+// TakeScheduledReboot returns and clears the record of a policy reboot,
+// or nil when the last boot wasn't one
+func TakeScheduledReboot() *ScheduledReboot {
+	path := scheduledRebootPath()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	os.Remove(path)
+
+	var reboot ScheduledReboot
+	if json.Unmarshal(data, &reboot) != nil {
+		return nil
+	}
+	return &reboot
+}
+
+// writeStateFile stores a value as JSON under ~/.bloxos
+func writeStateFile(path string, v interface{}) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,210 @@
+package system
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConsoleCapture is the text on the active virtual console, where kernel
+// panics and oopses end up on a rig without a desktop
+type ConsoleCapture struct {
+	TTY  string `json:"tty"`
+	Rows int    `json:"rows"`
+	Cols int    `json:"cols"`
+	Text string `json:"text"`
+}
+
+// FramebufferCapture is a PNG screenshot of the framebuffer
+type FramebufferCapture struct {
+	Device string `json:"device"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	PNG    []byte `json:"-"`
+}
+
+// activeConsole returns the virtual console on screen, e.g. "tty1"
+func activeConsole() string {
+	if data, err := os.ReadFile("/sys/class/tty/tty0/active"); err == nil {
+		if active := strings.TrimSpace(string(data)); active != "" {
+			return active
+		}
+	}
+	return "tty1"
+}
+
+// CaptureConsole reads the screen contents of the active virtual console
+func CaptureConsole() (*ConsoleCapture, error) {
+	tty := activeConsole()
+	n := strings.TrimPrefix(tty, "tty")
+
+	// vcsa starts with rows, columns and the cursor position
+	attrs, err := readRootFile("/dev/vcsa" + n)
+	if err != nil {
+		return nil, fmt.Errorf("read console size: %w", err)
+	}
+	if len(attrs) < 4 {
+		return nil, fmt.Errorf("short console header")
+	}
+	rows, cols := int(attrs[0]), int(attrs[1])
+
+	text, err := readRootFile("/dev/vcs" + n)
+	if err != nil {
+		return nil, fmt.Errorf("read console: %w", err)
+	}
+
+	var lines []string
+	for row := 0; row < rows && (row+1)*cols <= len(text); row++ {
+		lines = append(lines, strings.TrimRight(string(text[row*cols:(row+1)*cols]), " \x00"))
+	}
+	// Drop the empty bottom of the screen
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return &ConsoleCapture{TTY: tty, Rows: rows, Cols: cols, Text: strings.Join(lines, "\n")}, nil
+}
+
+// WriteConsole shows text on the active virtual console, i.e. the rig's
+// monitor, which a service's output doesn't reach
+func WriteConsole(text string) error {
+	return WriteRootFile("/dev/"+activeConsole(), text)
+}
+
+// CaptureFramebuffer takes a PNG screenshot of /dev/fb0, through fbgrab when
+// installed and by decoding the framebuffer directly otherwise
+func CaptureFramebuffer() (*FramebufferCapture, error) {
+	const device = "/dev/fb0"
+	if _, err := os.Stat(device); err != nil {
+		return nil, fmt.Errorf("no framebuffer: %w", err)
+	}
+
+	if path, err := exec.LookPath("fbgrab"); err == nil {
+		if capture, err := fbgrab(path, device); err == nil {
+			return capture, nil
+		}
+	}
+
+	sysfs := "/sys/class/graphics/fb0"
+	width, height, err := readSysfsPair(filepath.Join(sysfs, "virtual_size"))
+	if err != nil {
+		return nil, err
+	}
+	bpp, err := readSysfsInt(filepath.Join(sysfs, "bits_per_pixel"))
+	if err != nil {
+		return nil, err
+	}
+	stride, err := readSysfsInt(filepath.Join(sysfs, "stride"))
+	if err != nil {
+		stride = width * bpp / 8
+	}
+	if bpp != 16 && bpp != 24 && bpp != 32 {
+		return nil, fmt.Errorf("unsupported framebuffer depth %d", bpp)
+	}
+
+	raw, err := readRootFile(device)
+	if err != nil {
+		return nil, fmt.Errorf("read framebuffer: %w", err)
+	}
+	if len(raw) < stride*height {
+		height = len(raw) / stride
+	}
+
+	pixel := bpp / 8
+	if width*pixel > stride {
+		width = stride / pixel
+	}
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		row := raw[y*stride:]
+		for x := 0; x < width; x++ {
+			p := row[x*pixel:]
+			switch bpp {
+			case 16: // RGB565
+				v := binary.LittleEndian.Uint16(p)
+				img.SetRGBA(x, y, color.RGBA{uint8(v>>11) << 3, uint8(v>>5) << 2, uint8(v) << 3, 255})
+			default: // BGR(A), as fbdev emulation of the GPU drivers sets up
+				img.SetRGBA(x, y, color.RGBA{p[2], p[1], p[0], 255})
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return &FramebufferCapture{Device: device, Width: width, Height: height, PNG: buf.Bytes()}, nil
+}
+
+// fbgrab captures the framebuffer with the fbgrab tool
+func fbgrab(path, device string) (*FramebufferCapture, error) {
+	out := filepath.Join(os.TempDir(), fmt.Sprintf("bloxos-screen-%d.png", time.Now().UnixNano()))
+	defer os.Remove(out)
+
+	args := []string{"-d", device, out}
+	cmd := exec.Command(path, args...)
+	if os.Geteuid() != 0 {
+		cmd = exec.Command("sudo", append([]string{path}, args...)...)
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	data, err := readRootFile(out)
+	if err != nil {
+		return nil, err
+	}
+	config, err := png.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return &FramebufferCapture{Device: device, Width: config.Width, Height: config.Height, PNG: data}, nil
+}
+
+// readRootFile reads a file only root may read, using sudo cat when not
+// running as root
+func readRootFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err == nil || !os.IsPermission(err) || os.Geteuid() == 0 {
+		return data, err
+	}
+	return exec.Command("sudo", "cat", path).Output()
+}
+
+func readSysfsInt(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+// readSysfsPair reads a "width,height" sysfs value
+func readSysfsPair(path string) (int, int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	a, b, ok := strings.Cut(strings.TrimSpace(string(data)), ",")
+	if !ok {
+		return 0, 0, fmt.Errorf("unexpected %s: %q", path, data)
+	}
+	width, err := strconv.Atoi(a)
+	if err != nil {
+		return 0, 0, err
+	}
+	height, err := strconv.Atoi(b)
+	if err != nil {
+		return 0, 0, err
+	}
+	return width, height, nil
+}
@@ -0,0 +1,181 @@
+package system
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// TimeSyncStatus describes the state of the system clock
+type TimeSyncStatus struct {
+	Synchronized bool     `json:"synchronized"`
+	Service      string   `json:"service,omitempty"` // chrony, systemd-timesyncd, ntpd
+	Source       string   `json:"source,omitempty"`  // Current reference server
+	OffsetMs     *float64 `json:"offsetMs,omitempty"`
+	// ServerOffsetMs is the clock difference to the BloxOs server, measured
+	// from heartbeat round trips (positive = server ahead of this rig)
+	ServerOffsetMs *float64 `json:"serverOffsetMs,omitempty"`
+	// Timezone is the IANA name local schedules run in
+	Timezone string `json:"timezone,omitempty"`
+}
+
+// GetTimeSyncStatus reports whether the clock is NTP-synced and its offset
+func GetTimeSyncStatus() *TimeSyncStatus {
+	status := &TimeSyncStatus{Timezone: Timezone()}
+
+	if output, err := exec.Command("timedatectl", "show", "-p", "NTPSynchronized", "--value").Output(); err == nil {
+		status.Synchronized = strings.TrimSpace(string(output)) == "yes"
+	}
+
+	switch {
+	case readChronyTracking(status):
+		status.Service = "chrony"
+	case readTimesyncdStatus(status):
+		status.Service = "systemd-timesyncd"
+	case readNtpdStatus(status):
+		status.Service = "ntpd"
+	}
+
+	return status
+}
+
+// readChronyTracking parses `chronyc -c tracking`
+func readChronyTracking(status *TimeSyncStatus) bool {
+	output, err := exec.Command("chronyc", "-c", "tracking").Output()
+	if err != nil {
+		return false
+	}
+
+	// RefID,Name,Stratum,RefTime,SystemTime,LastOffset,RMSOffset,...
+	record, err := csv.NewReader(strings.NewReader(string(output))).Read()
+	if err != nil || len(record) < 5 {
+		return false
+	}
+
+	status.Source = record[1]
+	if offset, err := strconv.ParseFloat(record[4], 64); err == nil {
+		ms := offset * 1000
+		status.OffsetMs = &ms
+	}
+	// Stratum 0 means chrony has no usable source
+	if stratum, err := strconv.Atoi(record[2]); err == nil && stratum > 0 {
+		status.Synchronized = true
+	}
+	return true
+}
+
+// readTimesyncdStatus parses `timedatectl timesync-status`
+func readTimesyncdStatus(status *TimeSyncStatus) bool {
+	output, err := exec.Command("timedatectl", "timesync-status").Output()
+	if err != nil {
+		return false
+	}
+
+	for _, line := range strings.Split(string(output), "\n") {
+		parts := strings.SplitN(strings.TrimSpace(line), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		value := strings.TrimSpace(parts[1])
+		switch parts[0] {
+		case "Server":
+			status.Source = value
+		case "Offset":
+			if ms, ok := parseDurationMs(value); ok {
+				status.OffsetMs = &ms
+			}
+		}
+	}
+	return true
+}
+
+// readNtpdStatus parses `ntpq -c rv`
+func readNtpdStatus(status *TimeSyncStatus) bool {
+	output, err := exec.Command("ntpq", "-c", "rv").Output()
+	if err != nil {
+		return false
+	}
+
+	for _, field := range strings.FieldsFunc(string(output), func(r rune) bool {
+		return r == ',' || r == '\n'
+	}) {
+		kv := strings.SplitN(strings.TrimSpace(field), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "offset":
+			if ms, err := strconv.ParseFloat(kv[1], 64); err == nil {
+				status.OffsetMs = &ms
+			}
+		case "refid":
+			status.Source = kv[1]
+		case "stratum":
+			if stratum, err := strconv.Atoi(kv[1]); err == nil && stratum < 16 {
+				status.Synchronized = true
+			}
+		}
+	}
+	return true
+}
+
+// parseDurationMs parses timesyncd durations like "+1.234ms", "-52us" or "1.5s"
+func parseDurationMs(s string) (float64, bool) {
+	s = strings.TrimPrefix(s, "+")
+	units := []struct {
+		suffix string
+		scale  float64
+	}{
+		{"us", 0.001},
+		{"ms", 1},
+		{"min", 60000},
+		{"s", 1000},
+	}
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			val, err := strconv.ParseFloat(strings.TrimSuffix(s, u.suffix), 64)
+			if err != nil {
+				return 0, false
+			}
+			return val * u.scale, true
+		}
+	}
+	return 0, false
+}
+
+// ForceTimeSync steps the clock immediately using whichever NTP service is
+// present, returning the method used
+func ForceTimeSync() (string, error) {
+	if _, err := exec.LookPath("chronyc"); err == nil {
+		exec.Command("sudo", "chronyc", "burst", "4/4").Run()
+		output, err := exec.Command("sudo", "chronyc", "makestep").CombinedOutput()
+		if err == nil {
+			return "chronyc makestep", nil
+		}
+		// 506 = chronyd not running, fall through to other methods
+		if !strings.Contains(string(output), "506") {
+			return "", fmt.Errorf("chronyc makestep: %v: %s", err, strings.TrimSpace(string(output)))
+		}
+	}
+
+	if exec.Command("systemctl", "is-enabled", "--quiet", "systemd-timesyncd").Run() == nil {
+		if output, err := exec.Command("sudo", "systemctl", "restart", "systemd-timesyncd").CombinedOutput(); err != nil {
+			return "", fmt.Errorf("restart systemd-timesyncd: %v: %s", err, strings.TrimSpace(string(output)))
+		}
+		return "restart systemd-timesyncd", nil
+	}
+
+	if _, err := exec.LookPath("ntpdate"); err == nil {
+		if output, err := exec.Command("sudo", "ntpdate", "-u", "pool.ntp.org").CombinedOutput(); err != nil {
+			return "", fmt.Errorf("ntpdate: %v: %s", err, strings.TrimSpace(string(output)))
+		}
+		return "ntpdate", nil
+	}
+
+	if output, err := exec.Command("sudo", "timedatectl", "set-ntp", "true").CombinedOutput(); err != nil {
+		return "", fmt.Errorf("no NTP client available: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return "timedatectl set-ntp", nil
+}
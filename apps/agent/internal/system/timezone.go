@@ -0,0 +1,126 @@
+package system
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Timezone returns the system's IANA timezone, e.g. "Europe/Berlin".
+// Freshly flashed images default to UTC.
+func Timezone() string {
+	if output, err := exec.Command("timedatectl", "show", "-p", "Timezone", "--value").Output(); err == nil {
+		if name := strings.TrimSpace(string(output)); name != "" {
+			return name
+		}
+	}
+	if data, err := os.ReadFile("/etc/timezone"); err == nil {
+		if name := strings.TrimSpace(string(data)); name != "" {
+			return name
+		}
+	}
+	// /etc/localtime links to /usr/share/zoneinfo/<name>
+	if link, err := filepath.EvalSymlinks("/etc/localtime"); err == nil {
+		if _, name, ok := strings.Cut(link, "zoneinfo/"); ok {
+			return name
+		}
+	}
+	if name := time.Local.String(); name != "Local" {
+		return name
+	}
+	return ""
+}
+
+// SetTimezone changes the system timezone persistently and switches the
+// agent's local time over, so the schedulers using system time (OC
+// schedules, tariff windows, reboot windows) follow without a restart
+func SetTimezone(name string) error {
+	loc, err := time.LoadLocation(name)
+	if err != nil || name == "" || name == "Local" {
+		return fmt.Errorf("unknown timezone %q: use an IANA name like Europe/Berlin", name)
+	}
+
+	if output, err := exec.Command("sudo", "timedatectl", "set-timezone", name).CombinedOutput(); err != nil {
+		// Fallback for non-systemd images
+		zoneinfo := filepath.Join("/usr/share/zoneinfo", name)
+		if _, statErr := os.Stat(zoneinfo); statErr != nil {
+			return fmt.Errorf("timedatectl failed (%s) and %s is missing", strings.TrimSpace(string(output)), zoneinfo)
+		}
+		if output, err := exec.Command("sudo", "ln", "-sf", zoneinfo, "/etc/localtime").CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to link /etc/localtime: %v: %s", err, strings.TrimSpace(string(output)))
+		}
+		if err := WriteRootFile("/etc/timezone", name+"\n"); err != nil {
+			return fmt.Errorf("failed to write /etc/timezone: %w", err)
+		}
+	}
+
+	time.Local = loc
+	return nil
+}
+
+// localeRe matches locale names like en_US.UTF-8, de_DE@euro or C.UTF-8
+var localeRe = regexp.MustCompile(`^([a-z]{2,3}(_[A-Z]{2})?|C|POSIX)(\.[A-Za-z0-9-]+)?(@[a-z]+)?$`)
+
+// Locale returns the system locale (LANG), e.g. "en_US.UTF-8"
+func Locale() string {
+	if output, err := exec.Command("localectl", "status").Output(); err == nil {
+		// "System Locale: LANG=en_US.UTF-8"
+		for _, line := range strings.Split(string(output), "\n") {
+			if _, value, ok := strings.Cut(strings.TrimSpace(line), "System Locale: LANG="); ok {
+				return strings.TrimSpace(value)
+			}
+		}
+	}
+	if data, err := os.ReadFile("/etc/default/locale"); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			if value, ok := strings.CutPrefix(strings.TrimSpace(line), "LANG="); ok {
+				return strings.Trim(value, `"`)
+			}
+		}
+	}
+	return os.Getenv("LANG")
+}
+
+// SetLocale makes name the system locale, generating it first when the
+// image doesn't have it. It applies to processes started afterwards.
+func SetLocale(name string) error {
+	if !localeRe.MatchString(name) {
+		return fmt.Errorf("invalid locale %q: use a name like en_US.UTF-8", name)
+	}
+
+	if !localeAvailable(name) {
+		if output, err := exec.Command("sudo", "locale-gen", name).CombinedOutput(); err != nil {
+			return fmt.Errorf("locale %s is not available and locale-gen failed: %v: %s", name, err, strings.TrimSpace(string(output)))
+		}
+	}
+
+	if output, err := exec.Command("sudo", "localectl", "set-locale", "LANG="+name).CombinedOutput(); err != nil {
+		// Fallback for non-systemd images
+		if err := WriteRootFile("/etc/default/locale", "LANG="+name+"\n"); err != nil {
+			return fmt.Errorf("localectl failed (%s) and /etc/default/locale write failed: %w",
+				strings.TrimSpace(string(output)), err)
+		}
+	}
+	return nil
+}
+
+// localeAvailable checks `locale -a`, which writes UTF-8 as "utf8"
+func localeAvailable(name string) bool {
+	output, err := exec.Command("locale", "-a").Output()
+	if err != nil {
+		return true // Can't tell; let localectl decide
+	}
+	normalize := func(s string) string {
+		return strings.ReplaceAll(strings.ToLower(s), "-", "")
+	}
+	for _, available := range strings.Fields(string(output)) {
+		if normalize(available) == normalize(name) {
+			return true
+		}
+	}
+	return false
+}
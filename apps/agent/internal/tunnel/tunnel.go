@@ -0,0 +1,281 @@
+// Package tunnel opens a reverse SSH tunnel from the rig to a support
+// bastion, so a rig behind NAT or CGNAT can be reached for debugging
+// without exposing it permanently. The bastion forwards a port on its side
+// to a local service on the rig (by default sshd) until the tunnel expires
+// or is closed.
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Limits on how long a tunnel stays open
+const (
+	DefaultDuration = time.Hour
+	MaxDuration     = 8 * time.Hour
+)
+
+// Config describes the tunnel to open
+type Config struct {
+	Bastion    string        // host:port of the bastion's SSH server
+	User       string        // Bastion account
+	PrivateKey []byte        // PEM key the bastion accepts, ideally issued for this tunnel only
+	HostKey    []byte        // Bastion host key in authorized_keys format; required
+	RemotePort int           // Port to listen on at the bastion; 0 = bastion picks
+	Target     string        // Loopback address connections are forwarded to (default 127.0.0.1:22)
+	Duration   time.Duration // How long the tunnel stays open (default DefaultDuration)
+}
+
+// Entry is an audit record of something that happened on a tunnel
+type Entry struct {
+	Time   int64  `json:"time"`   // Unix seconds
+	Event  string `json:"event"`  // opened, connected, disconnected, closed
+	Remote string `json:"remote"` // Forwarded connection's origin as the bastion reports it
+	Detail string `json:"detail,omitempty"`
+}
+
+// Status is a snapshot of an open tunnel
+type Status struct {
+	Bastion     string `json:"bastion"`
+	RemotePort  int    `json:"remotePort"`
+	Target      string `json:"target"`
+	OpenedAt    int64  `json:"openedAt"`
+	ExpiresAt   int64  `json:"expiresAt"`
+	Connections int    `json:"connections"` // Forwarded so far
+	Active      int    `json:"active"`
+}
+
+// Tunnel is an open reverse tunnel
+type Tunnel struct {
+	config   Config
+	client   *ssh.Client
+	listener net.Listener
+	audit    func(Entry)
+	openedAt time.Time
+
+	mu          sync.Mutex
+	conns       map[net.Conn]struct{}
+	connections int
+	closed      bool
+	done        chan struct{}
+}
+
+// checkTarget accepts only services on the rig itself, so the tunnel
+// can't be used to reach the rest of the rig's network
+func checkTarget(target string) error {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return fmt.Errorf("invalid target %q: %w", target, err)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("invalid target port %q", port)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("target %q is not a loopback address", target)
+	}
+	return nil
+}
+
+// Open connects to the bastion and starts forwarding. dial connects to the
+// bastion (nil = net.Dialer); audit is called for every audit entry and
+// must not block.
+func Open(ctx context.Context, config Config, dial func(ctx context.Context, network, addr string) (net.Conn, error), audit func(Entry)) (*Tunnel, error) {
+	if config.Bastion == "" || config.User == "" {
+		return nil, fmt.Errorf("bastion and user are required")
+	}
+	if _, _, err := net.SplitHostPort(config.Bastion); err != nil {
+		config.Bastion = net.JoinHostPort(config.Bastion, "22")
+	}
+	if config.Target == "" {
+		config.Target = "127.0.0.1:22"
+	}
+	if err := checkTarget(config.Target); err != nil {
+		return nil, err
+	}
+	if config.Duration <= 0 {
+		config.Duration = DefaultDuration
+	}
+	if config.Duration > MaxDuration {
+		return nil, fmt.Errorf("duration is limited to %s", MaxDuration)
+	}
+
+	signer, err := ssh.ParsePrivateKey(config.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+	if len(config.HostKey) == 0 {
+		return nil, fmt.Errorf("bastion host key is required")
+	}
+	hostKey, _, _, _, err := ssh.ParseAuthorizedKey(config.HostKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid host key: %w", err)
+	}
+
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	conn, err := dial(ctx, "tcp", config.Bastion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach bastion: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, config.Bastion, &ssh.ClientConfig{
+		User:            config.User,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: ssh.FixedHostKey(hostKey),
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("bastion handshake failed: %w", err)
+	}
+	conn.SetDeadline(time.Time{})
+	client := ssh.NewClient(sshConn, chans, reqs)
+
+	listener, err := client.Listen("tcp", net.JoinHostPort("localhost", strconv.Itoa(config.RemotePort)))
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("bastion refused the port forward: %w", err)
+	}
+	if addr, ok := listener.Addr().(*net.TCPAddr); ok {
+		config.RemotePort = addr.Port
+	}
+
+	t := &Tunnel{
+		config:   config,
+		client:   client,
+		listener: listener,
+		audit:    audit,
+		openedAt: time.Now(),
+		conns:    make(map[net.Conn]struct{}),
+		done:     make(chan struct{}),
+	}
+	t.record(Entry{Event: "opened", Detail: fmt.Sprintf("%s port %d -> %s for %s", config.Bastion, config.RemotePort, config.Target, config.Duration)})
+
+	go t.accept()
+	go t.expire()
+	go func() {
+		// The bastion going away ends the tunnel
+		client.Wait()
+		t.Close("bastion connection lost")
+	}()
+	return t, nil
+}
+
+// Close shuts the tunnel and every forwarded connection
+func (t *Tunnel) Close(reason string) {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return
+	}
+	t.closed = true
+	for conn := range t.conns {
+		conn.Close()
+	}
+	t.mu.Unlock()
+
+	t.listener.Close()
+	t.client.Close()
+	close(t.done)
+	t.record(Entry{Event: "closed", Detail: reason})
+}
+
+// Done is closed once the tunnel has closed
+func (t *Tunnel) Done() <-chan struct{} {
+	return t.done
+}
+
+// Status returns a snapshot of the tunnel
+func (t *Tunnel) Status() Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return Status{
+		Bastion:     t.config.Bastion,
+		RemotePort:  t.config.RemotePort,
+		Target:      t.config.Target,
+		OpenedAt:    t.openedAt.Unix(),
+		ExpiresAt:   t.openedAt.Add(t.config.Duration).Unix(),
+		Connections: t.connections,
+		Active:      len(t.conns),
+	}
+}
+
+func (t *Tunnel) expire() {
+	select {
+	case <-time.After(t.config.Duration):
+		t.Close("expired")
+	case <-t.done:
+	}
+}
+
+func (t *Tunnel) accept() {
+	for {
+		remote, err := t.listener.Accept()
+		if err != nil {
+			return
+		}
+		go t.forward(remote)
+	}
+}
+
+// forward joins a connection from the bastion to the local target
+func (t *Tunnel) forward(remote net.Conn) {
+	defer remote.Close()
+	origin := remote.RemoteAddr().String()
+
+	local, err := net.DialTimeout("tcp", t.config.Target, 10*time.Second)
+	if err != nil {
+		t.record(Entry{Event: "connected", Remote: origin, Detail: fmt.Sprintf("target unreachable: %v", err)})
+		return
+	}
+	defer local.Close()
+
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return
+	}
+	t.conns[remote] = struct{}{}
+	t.connections++
+	t.mu.Unlock()
+	t.record(Entry{Event: "connected", Remote: origin})
+
+	started := time.Now()
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(local, remote)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(remote, local)
+		done <- struct{}{}
+	}()
+	<-done
+
+	t.mu.Lock()
+	delete(t.conns, remote)
+	t.mu.Unlock()
+	t.record(Entry{Event: "disconnected", Remote: origin, Detail: fmt.Sprintf("after %s", time.Since(started).Round(time.Second))})
+}
+
+func (t *Tunnel) record(entry Entry) {
+	entry.Time = time.Now().Unix()
+	if t.audit != nil {
+		t.audit(entry)
+	}
+}
@@ -0,0 +1,24 @@
+//go:build !windows
+
+package usbwatchdog
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// configurePort puts the tty into raw 9600 8N1 mode, keeping DTR up when
+// the port closes
+func configurePort(device string) error {
+	output, err := exec.Command("stty", "-F", device, "9600", "cs8", "-cstopb", "-parenb", "raw", "-echo", "-hupcl").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("stty failed: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func openPort(device string) (*os.File, error) {
+	return os.OpenFile(device, os.O_RDWR, 0)
+}
@@ -0,0 +1,23 @@
+package usbwatchdog
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// configurePort sets the COM port to 9600 8N1
+func configurePort(device string) error {
+	output, err := exec.Command("mode", device+":", "BAUD=9600", "PARITY=n", "DATA=8", "STOP=1", "DTR=on").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("mode failed: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// openPort opens the COM port by its device path, which also reaches ports
+// above COM9
+func openPort(device string) (*os.File, error) {
+	return os.OpenFile(`\\.\`+device, os.O_RDWR, 0)
+}
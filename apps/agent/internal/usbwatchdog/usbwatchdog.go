@@ -0,0 +1,128 @@
+// Package usbwatchdog pets the cheap USB watchdog dongles used in mining
+// farms. They sit on a USB-serial chip wired to the reset or power switch
+// header and pull it when the heartbeat stops, which power-cycles a rig
+// whose OS froze solid even without a BMC.
+package usbwatchdog
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Dongle is a watchdog dongle on a serial port
+type Dongle struct {
+	protocol  string
+	device    string
+	heartbeat []byte
+	reply     []byte // Expected answer to a heartbeat, nil when it's silent
+
+	mu   sync.Mutex
+	port *os.File
+}
+
+// New creates a dongle from a spec of the form "type:device[#hex]":
+//
+//	opendev:/dev/ttyACM0     (OpenDev, "~U" answered with "~A")
+//	qinheng:/dev/ttyUSB0     (CH340 "USB Watchdog" boards, byte 0x1E)
+//	hex:/dev/ttyUSB0#1E      (any other board: raw heartbeat bytes)
+//
+// On Windows the device is a COM port, e.g. opendev:COM3.
+func New(spec string) (*Dongle, error) {
+	parts := strings.SplitN(strings.TrimSpace(spec), ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, fmt.Errorf("invalid USB watchdog spec %q (expected type:device)", spec)
+	}
+
+	device := parts[1]
+	var payload []byte
+	if idx := strings.LastIndex(device, "#"); idx >= 0 {
+		b, err := hex.DecodeString(device[idx+1:])
+		if err != nil || len(b) == 0 {
+			return nil, fmt.Errorf("invalid heartbeat bytes in %q", spec)
+		}
+		payload = b
+		device = device[:idx]
+	}
+
+	d := &Dongle{protocol: strings.ToLower(parts[0]), device: device}
+	switch d.protocol {
+	case "opendev":
+		d.heartbeat = []byte("~U")
+		d.reply = []byte("~A")
+	case "qinheng", "ch340":
+		d.heartbeat = []byte{0x1E}
+	case "hex":
+		if payload == nil {
+			return nil, fmt.Errorf("USB watchdog spec %q needs the heartbeat bytes, e.g. hex:%s#1E", spec, device)
+		}
+		d.heartbeat = payload
+	default:
+		return nil, fmt.Errorf("unknown USB watchdog type: %s", parts[0])
+	}
+	if payload != nil && d.protocol != "hex" {
+		return nil, fmt.Errorf("USB watchdog type %s takes no heartbeat bytes", d.protocol)
+	}
+	return d, nil
+}
+
+func (d *Dongle) Name() string { return d.protocol + ":" + d.device }
+
+// Pet sends a heartbeat, restarting the dongle's countdown. The port stays
+// open between heartbeats: opening it toggles DTR, which some boards take
+// for a reset.
+func (d *Dongle) Pet() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.port == nil {
+		if err := configurePort(d.device); err != nil {
+			return err
+		}
+		port, err := openPort(d.device)
+		if err != nil {
+			return err
+		}
+		d.port = port
+	}
+
+	if _, err := d.port.Write(d.heartbeat); err != nil {
+		// Unplugged or re-enumerated: reopen next time
+		d.closeLocked()
+		return err
+	}
+	if d.reply == nil {
+		return nil
+	}
+
+	answer := make([]byte, len(d.reply))
+	d.port.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := io.ReadFull(d.port, answer); err != nil {
+		d.closeLocked()
+		return fmt.Errorf("no answer to the heartbeat: %w", err)
+	}
+	if string(answer) != string(d.reply) {
+		d.closeLocked()
+		return fmt.Errorf("unexpected answer % x", answer)
+	}
+	return nil
+}
+
+// Close releases the port. The dongle keeps counting down: closing doesn't
+// disarm it.
+func (d *Dongle) Close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.closeLocked()
+}
+
+func (d *Dongle) closeLocked() {
+	if d.port != nil {
+		d.port.Close()
+		d.port = nil
+	}
+}
@@ -1,10 +1,15 @@
 package ws
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/url"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -21,22 +26,34 @@ const (
 	TypeCommand       = "command"
 	TypeCommandResult = "command_result"
 	TypeMinerStatus   = "miner_status"
+	TypePoolStats     = "pool_stats"
+	TypeEvent         = "event"
+	TypeBootReport    = "boot_report"
+	TypeBatch         = "batch"   // Several messages in one frame (protocol 3)
+	TypeHistory       = "history" // Stats buffered while offline (protocol 5)
 	TypeError         = "error"
 )
 
 // Message represents a WebSocket message
 type Message struct {
-	Type      string      `json:"type"`
-	Token     string      `json:"token,omitempty"`
-	Data      interface{} `json:"data,omitempty"`
-	Command   *Command    `json:"command,omitempty"`
-	CommandID string      `json:"commandId,omitempty"`
-	Success   bool        `json:"success,omitempty"`
-	Error     string      `json:"error,omitempty"`
-	RigID     string      `json:"rigId,omitempty"`
-	RigName   string      `json:"rigName,omitempty"`
-	Message   string      `json:"message,omitempty"`
-	Timestamp int64       `json:"timestamp,omitempty"`
+	Type      string          `json:"type"`
+	Token     string          `json:"token,omitempty"`
+	Data      interface{}     `json:"data,omitempty"`
+	Command   *Command        `json:"command,omitempty"`
+	CommandID string          `json:"commandId,omitempty"`
+	Success   bool            `json:"success,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	RigID     string          `json:"rigId,omitempty"`
+	RigName   string          `json:"rigName,omitempty"`
+	Message   string          `json:"message,omitempty"`
+	Timestamp int64           `json:"timestamp,omitempty"`
+	Protocol  int             `json:"protocol,omitempty"`  // Server schema version (authenticated)
+	Messages  []*Message      `json:"messages,omitempty"`  // Batched messages (batch)
+	Features  map[string]bool `json:"features,omitempty"`  // Per-rig feature flags (authenticated)
+	Scopes    []string        `json:"scopes,omitempty"`    // Token scopes (authenticated)
+	Keepalive *Keepalive      `json:"keepalive,omitempty"` // Server-tuned keepalive (authenticated)
+	Code      string          `json:"code,omitempty"`      // Machine-readable reason (error)
+	Conflict  *TokenConflict  `json:"conflict,omitempty"`  // Another agent with this token (authenticated, error)
 }
 
 // Command represents a command from the server
@@ -47,32 +64,98 @@ type Command struct {
 	CreatedAt time.Time   `json:"createdAt"`
 }
 
-// CommandHandler is a function that handles commands from the server
-type CommandHandler func(cmd *Command) (success bool, err error)
+// Connection permission scopes
+const (
+	ScopeFull  = "full"  // Telemetry and commands
+	ScopeStats = "stats" // Telemetry only; commands are rejected
+)
+
+// Token scopes a server grants at authentication. A token limited to
+// ScopeStats is a read-only guest; servers that send no scopes grant all.
+const (
+	ScopeRead   = "read"   // Commands that only report, e.g. get_inventory; implied by the others
+	ScopeMiner  = "miner"  // Miner, overclock and fan control
+	ScopeSystem = "system" // Reboots, updates, network and anything unlisted
+)
+
+// telemetryTypes are the messages mirrored to other connections
+var telemetryTypes = map[string]bool{
+	TypeStats:       true,
+	TypeMinerStatus: true,
+	TypePoolStats:   true,
+	TypeEvent:       true,
+	TypeBootReport:  true,
+}
+
+// Conn is an open message stream to the server. The WebSocket connection
+// is the default; SetTransport plugs in others such as gRPC.
+type Conn interface {
+	ReadMessage() (*Message, error)
+	WriteMessage(msg *Message) error
+	Close() error
+}
+
+// BatchConn is a Conn that can carry batch frames. The WebSocket
+// connection is one; gRPC streams frame each message already.
+type BatchConn interface {
+	Conn
+	SupportsBatch() bool
+}
+
+// DialFunc dials a network connection
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// Transport opens a Conn authenticated with the rig token and identity.
+// The server's first message must be TypeAuthenticated or TypeError.
+type Transport func(ctx context.Context, token string, authInfo map[string]string, dial DialFunc) (Conn, error)
+
+// CommandHandler is a function that handles commands from the server.
+// Any non-nil data is returned to the server with the command result.
+type CommandHandler func(cmd *Command) (success bool, data interface{}, err error)
 
 // Client is a WebSocket client with auto-reconnect
 type Client struct {
 	serverURL      string
 	token          string
-	conn           *websocket.Conn
+	conn           Conn
 	connected      bool
 	authenticated  bool
 	rigID          string
 	rigName        string
+	serverProtocol int
+	features       map[string]bool
+	tokenScopes    []string          // Nil = unrestricted
+	commandScopes  map[string]string // Command type -> token scope it needs
+	authInfo       map[string]string
 	mu             sync.RWMutex
 	done           chan struct{}
 	reconnectDelay time.Duration
 	maxReconnect   time.Duration
 	debug          bool
+	dial           DialFunc
+	transport      Transport
+	scope          string
+	mirrors        []*Client
+	offlineSince   time.Time      // Zero while authenticated
+	shaper         *shaper        // Nil = write messages directly
+	conflict       *TokenConflict // Another agent with the same token
+	pendingResults []*Message     // Command results to send after reconnecting
 
 	// Handlers
 	onCommand CommandHandler
 	onConnect func()
 	onDisconnect func()
+	onConflict func(*TokenConflict)
+	heartbeatData func() interface{}
 
 	// Heartbeat
 	heartbeatInterval time.Duration
 	heartbeatTicker   *time.Ticker
+	tcpKeepAlive      time.Duration // 0 = system default
+	handshakeTimeout  time.Duration
+	heartbeatSent     time.Time
+	serverOffset      time.Duration
+	hasServerOffset   bool
 }
 
 // NewClient creates a new WebSocket client
@@ -82,9 +165,12 @@ func NewClient(serverURL, token string, debug bool) *Client {
 		token:             token,
 		debug:             debug,
 		done:              make(chan struct{}),
+		authInfo:          make(map[string]string),
+		scope:             ScopeFull,
 		reconnectDelay:    1 * time.Second,
 		maxReconnect:      60 * time.Second,
 		heartbeatInterval: 30 * time.Second,
+		handshakeTimeout:  defaultHandshakeTimeout,
 	}
 }
 
@@ -103,8 +189,79 @@ func (c *Client) SetDisconnectHandler(handler func()) {
 	c.onDisconnect = handler
 }
 
+// SetHeartbeatData sets a function supplying the payload of each
+// heartbeat, e.g. a small health summary
+func (c *Client) SetHeartbeatData(data func() interface{}) {
+	c.heartbeatData = data
+}
+
+// SetAuthInfo sets an identity value (hostname, version, ...) sent to the
+// server on the next authentication
+func (c *Client) SetAuthInfo(key, value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.authInfo[key] = value
+}
+
+// SetDialer sets a custom dial function, e.g. one with DNS fallback
+func (c *Client) SetDialer(dial DialFunc) {
+	c.dial = dial
+}
+
+// SetScope sets what the server may do over this connection
+func (c *Client) SetScope(scope string) {
+	c.scope = scope
+	c.SetAuthInfo("scope", scope)
+}
+
+// SetCommandScopes sets the token scope each command needs; commands
+// not listed need ScopeSystem
+func (c *Client) SetCommandScopes(scopes map[string]string) {
+	c.commandScopes = scopes
+}
+
+// permitted reports whether the token scopes allow a command, and the
+// scope it needs
+func (c *Client) permitted(command string) (bool, string) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	needed, ok := c.commandScopes[command]
+	if !ok {
+		needed = ScopeSystem
+	}
+	if c.tokenScopes == nil {
+		return true, needed
+	}
+	for _, scope := range c.tokenScopes {
+		switch {
+		case scope == ScopeFull, scope == needed:
+			return true, needed
+		case needed == ScopeRead && (scope == ScopeMiner || scope == ScopeSystem):
+			return true, needed
+		}
+	}
+	return false, needed
+}
+
+// AddMirror sends the telemetry sent through c to another server
+// connection as well, e.g. a customer's monitoring server
+func (c *Client) AddMirror(mirror *Client) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.mirrors = append(c.mirrors, mirror)
+}
+
+// SetTransport replaces the WebSocket connection with another transport
+func (c *Client) SetTransport(transport Transport) {
+	c.transport = transport
+}
+
 // Connect starts the WebSocket connection with auto-reconnect
 func (c *Client) Connect() error {
+	c.mu.Lock()
+	c.offlineSince = time.Now()
+	c.mu.Unlock()
 	go c.connectLoop()
 	return nil
 }
@@ -121,6 +278,10 @@ func (c *Client) connectLoop() {
 		}
 
 		err := c.connect()
+		if errors.Is(err, errTokenConflict) {
+			c.waitConflict()
+			continue
+		}
 		if err != nil {
 			log.Printf("WebSocket connection failed: %v", err)
 			
@@ -144,6 +305,7 @@ func (c *Client) connectLoop() {
 		c.mu.Lock()
 		c.connected = false
 		c.authenticated = false
+		c.offlineSince = time.Now()
 		if c.conn != nil {
 			c.conn.Close()
 			c.conn = nil
@@ -154,44 +316,38 @@ func (c *Client) connectLoop() {
 			c.onDisconnect()
 		}
 
+		// Disconnected in favour of another agent with the token
+		if conflict := c.TokenConflict(); conflict != nil && conflict.Refused {
+			c.waitConflict()
+			continue
+		}
+
 		log.Println("WebSocket disconnected, reconnecting...")
 	}
 }
 
-// connect establishes the WebSocket connection
+// connect establishes and authenticates the connection
 func (c *Client) connect() error {
-	// Parse server URL and convert to WebSocket URL
-	u, err := url.Parse(c.serverURL)
-	if err != nil {
-		return fmt.Errorf("invalid server URL: %w", err)
-	}
-
-	// Convert http(s) to ws(s)
-	switch u.Scheme {
-	case "http":
-		u.Scheme = "ws"
-	case "https":
-		u.Scheme = "wss"
-	case "ws", "wss":
-		// Already WebSocket
-	default:
-		u.Scheme = "ws"
+	c.mu.RLock()
+	authInfo := make(map[string]string, len(c.authInfo)+1)
+	for k, v := range c.authInfo {
+		authInfo[k] = v
 	}
+	c.mu.RUnlock()
+	authInfo["protocol"] = strconv.Itoa(ProtocolVersion)
 
-	// Set WebSocket path with token as query parameter
-	u.Path = "/api/agent/ws"
-	q := u.Query()
-	q.Set("token", c.token)
-	u.RawQuery = q.Encode()
-
-	if c.debug {
-		log.Printf("Connecting to %s", u.String())
+	transport := c.transport
+	if transport == nil {
+		transport = c.dialWebSocket
 	}
-
-	// Connect
-	conn, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	c.mu.RLock()
+	timeout := c.handshakeTimeout
+	c.mu.RUnlock()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	conn, err := transport(ctx, c.token, authInfo, c.keepaliveDial(c.dial))
 	if err != nil {
-		return fmt.Errorf("dial failed: %w", err)
+		return err
 	}
 
 	c.mu.Lock()
@@ -199,21 +355,24 @@ func (c *Client) connect() error {
 	c.connected = true
 	c.mu.Unlock()
 
-	// Wait for authentication response
-	_, msgBytes, err := conn.ReadMessage()
+	// Wait for authentication response, within the handshake timeout
+	deadline, _ := ctx.Deadline()
+	expired := time.AfterFunc(time.Until(deadline), func() { conn.Close() })
+	msg, err := conn.ReadMessage()
+	if !expired.Stop() {
+		return fmt.Errorf("no auth response within %s", timeout)
+	}
 	if err != nil {
 		conn.Close()
 		return fmt.Errorf("failed to read auth response: %w", err)
 	}
 
-	var msg Message
-	if err := json.Unmarshal(msgBytes, &msg); err != nil {
-		conn.Close()
-		return fmt.Errorf("failed to parse auth response: %w", err)
-	}
-
 	if msg.Type == TypeError {
 		conn.Close()
+		if msg.Code == ErrorTokenConflict {
+			c.setConflict(msg.Conflict, true)
+			return errTokenConflict
+		}
 		return fmt.Errorf("auth failed: %s", msg.Message)
 	}
 
@@ -224,14 +383,38 @@ func (c *Client) connect() error {
 
 	c.mu.Lock()
 	c.authenticated = true
+	c.offlineSince = time.Time{}
 	c.rigID = msg.RigID
 	c.rigName = msg.RigName
+	c.features = msg.Features
+	c.tokenScopes = msg.Scopes
+	if msg.Keepalive != nil {
+		c.applyKeepalive(*msg.Keepalive)
+	}
+	c.serverProtocol = msg.Protocol
+	if c.serverProtocol == 0 {
+		c.serverProtocol = 1 // Server predates schema negotiation
+	}
 	c.mu.Unlock()
 
+	if c.serverProtocol < ProtocolVersion {
+		log.Printf("Server speaks protocol %d (agent %d), downconverting messages", c.serverProtocol, ProtocolVersion)
+	}
+	if len(msg.Scopes) > 0 {
+		log.Printf("Token scopes: %s", strings.Join(msg.Scopes, ", "))
+	}
+	if msg.Keepalive != nil {
+		keepalive := c.Keepalive()
+		log.Printf("Server keepalive: heartbeat %ds, TCP keepalive %ds, handshake timeout %ds",
+			keepalive.Heartbeat, keepalive.TCPKeepAlive, keepalive.HandshakeTimeout)
+	}
+
 	log.Printf("Connected and authenticated as rig: %s (%s)", c.rigName, c.rigID)
+	c.setConflict(msg.Conflict, false)
 
 	// Start heartbeat
 	c.startHeartbeat()
+	c.resendResults()
 
 	if c.onConnect != nil {
 		c.onConnect()
@@ -240,6 +423,92 @@ func (c *Client) connect() error {
 	return nil
 }
 
+// dialWebSocket is the default transport
+func (c *Client) dialWebSocket(ctx context.Context, token string, authInfo map[string]string, dial DialFunc) (Conn, error) {
+	// Parse server URL and convert to WebSocket URL
+	u, err := url.Parse(c.serverURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server URL: %w", err)
+	}
+
+	// Convert http(s) to ws(s)
+	switch u.Scheme {
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	case "ws", "wss":
+		// Already WebSocket
+	default:
+		u.Scheme = "ws"
+	}
+
+	// Set WebSocket path with token as query parameter
+	u.Path = "/api/agent/ws"
+	q := u.Query()
+	q.Set("token", token)
+	for k, v := range authInfo {
+		q.Set(k, v)
+	}
+	u.RawQuery = q.Encode()
+
+	if c.debug {
+		log.Printf("Connecting to %s", u.String())
+	}
+
+	// Connect
+	dialer := *websocket.DefaultDialer
+	if dial != nil {
+		dialer.NetDialContext = dial
+	}
+	conn, _, err := dialer.DialContext(ctx, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("dial failed: %w", err)
+	}
+	return &wsConn{conn: conn}, nil
+}
+
+// wsConn carries JSON messages over a WebSocket
+type wsConn struct {
+	conn *websocket.Conn
+}
+
+func (w *wsConn) ReadMessage() (*Message, error) {
+	for {
+		_, msgBytes, err := w.conn.ReadMessage()
+		if err != nil {
+			return nil, err
+		}
+
+		var msg Message
+		if err := json.Unmarshal(msgBytes, &msg); err != nil {
+			log.Printf("Failed to parse message: %v", err)
+			continue
+		}
+		return &msg, nil
+	}
+}
+
+func (w *wsConn) WriteMessage(msg *Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+	if err := w.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	return nil
+}
+
+func (w *wsConn) SupportsBatch() bool {
+	return true
+}
+
+func (w *wsConn) Close() error {
+	w.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	return w.conn.Close()
+}
+
 // readLoop reads messages from the WebSocket
 func (c *Client) readLoop() {
 	for {
@@ -257,7 +526,7 @@ func (c *Client) readLoop() {
 			return
 		}
 
-		_, msgBytes, err := conn.ReadMessage()
+		msg, err := conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("WebSocket error: %v", err)
@@ -265,13 +534,7 @@ func (c *Client) readLoop() {
 			return
 		}
 
-		var msg Message
-		if err := json.Unmarshal(msgBytes, &msg); err != nil {
-			log.Printf("Failed to parse message: %v", err)
-			continue
-		}
-
-		c.handleMessage(&msg)
+		c.handleMessage(msg)
 	}
 }
 
@@ -279,6 +542,7 @@ func (c *Client) readLoop() {
 func (c *Client) handleMessage(msg *Message) {
 	switch msg.Type {
 	case TypeHeartbeatAck:
+		c.updateServerOffset(msg.Timestamp)
 		if c.debug {
 			log.Printf("Heartbeat acknowledged")
 		}
@@ -290,6 +554,11 @@ func (c *Client) handleMessage(msg *Message) {
 		}
 
 	case TypeError:
+		if msg.Code == ErrorTokenConflict {
+			// The server disconnects us next
+			c.setConflict(msg.Conflict, true)
+			return
+		}
 		log.Printf("Server error: %s", msg.Message)
 
 	default:
@@ -302,11 +571,19 @@ func (c *Client) handleMessage(msg *Message) {
 // handleCommand processes a command from the server
 func (c *Client) handleCommand(cmd *Command) {
 	var success bool
+	var data interface{}
 	var errMsg string
 
-	if c.onCommand != nil {
-		ok, err := c.onCommand(cmd)
+	if c.scope == ScopeStats {
+		log.Printf("Rejecting command %s: connection is stats-only", cmd.Type)
+		errMsg = "command not permitted: connection is stats-only"
+	} else if ok, needed := c.permitted(cmd.Type); !ok {
+		log.Printf("Rejecting command %s: token lacks the %s scope", cmd.Type, needed)
+		errMsg = fmt.Sprintf("command not permitted: token lacks the %s scope", needed)
+	} else if c.onCommand != nil {
+		ok, result, err := c.onCommand(cmd)
 		success = ok
+		data = result
 		if err != nil {
 			errMsg = err.Error()
 		}
@@ -320,10 +597,12 @@ func (c *Client) handleCommand(cmd *Command) {
 		CommandID: cmd.ID,
 		Success:   success,
 		Error:     errMsg,
+		Data:      data,
 	}
 
 	if err := c.Send(&result); err != nil {
-		log.Printf("Failed to send command result: %v", err)
+		log.Printf("Failed to send command result, keeping it for the next connection: %v", err)
+		c.holdResult(&result)
 	}
 }
 
@@ -349,7 +628,16 @@ func (c *Client) startHeartbeat() {
 					return
 				}
 
+				c.mu.Lock()
+				c.heartbeatSent = time.Now()
+				protocol := c.serverProtocol
+				c.mu.Unlock()
+
+				// Heartbeats carry the health digest from protocol 4
 				msg := &Message{Type: TypeHeartbeat}
+				if c.heartbeatData != nil && protocol >= 4 {
+					msg.Data = c.heartbeatData()
+				}
 				if err := c.Send(msg); err != nil {
 					log.Printf("Failed to send heartbeat: %v", err)
 					return
@@ -363,30 +651,83 @@ func (c *Client) startHeartbeat() {
 	}()
 }
 
-// Send sends a message to the server
+// updateServerOffset estimates the server clock offset from a heartbeat
+// round trip, assuming symmetric latency
+func (c *Client) updateServerOffset(serverMs int64) {
+	if serverMs == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.heartbeatSent.IsZero() {
+		return
+	}
+	now := time.Now()
+	midpoint := c.heartbeatSent.Add(now.Sub(c.heartbeatSent) / 2)
+	c.serverOffset = time.UnixMilli(serverMs).Sub(midpoint)
+	c.hasServerOffset = true
+	c.heartbeatSent = time.Time{}
+}
+
+// ServerClockOffset returns how far the server clock is ahead of the local
+// clock, if it has been measured yet
+func (c *Client) ServerClockOffset() (time.Duration, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.serverOffset, c.hasServerOffset
+}
+
+// Send sends a message to the server. Telemetry also goes to mirrors.
 func (c *Client) Send(msg *Message) error {
 	c.mu.RLock()
 	conn := c.conn
 	connected := c.connected
+	protocol := c.serverProtocol
+	mirrors := c.mirrors
 	c.mu.RUnlock()
 
+	if telemetryTypes[msg.Type] {
+		for _, mirror := range mirrors {
+			if mirror.IsConnected() {
+				if err := mirror.Send(msg); err != nil && c.debug {
+					log.Printf("Failed to mirror %s message: %v", msg.Type, err)
+				}
+			}
+		}
+	}
+
 	if !connected || conn == nil {
 		return fmt.Errorf("not connected")
 	}
 
-	data, err := json.Marshal(msg)
-	if err != nil {
-		return fmt.Errorf("failed to marshal message: %w", err)
+	converted, ok := downconvert(msg, protocol)
+	if !ok {
+		if c.debug {
+			log.Printf("Skipping %s message: not supported by server protocol %d", msg.Type, protocol)
+		}
+		return nil
 	}
 
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	// Stamp the send time; samples carry their own collection time
+	if converted.Timestamp == 0 {
+		stamped := *converted
+		stamped.Timestamp = time.Now().UnixMilli()
+		converted = &stamped
+	}
 
-	if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
-		return fmt.Errorf("failed to write message: %w", err)
+	if c.shaper != nil && !unshapedTypes[converted.Type] {
+		if !c.shaper.enqueue(converted) {
+			return fmt.Errorf("outbound queue full")
+		}
+		return nil
 	}
 
-	return nil
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return conn.WriteMessage(converted)
 }
 
 // SendStats sends stats to the server
@@ -407,6 +748,61 @@ func (c *Client) SendMinerStatus(data interface{}) error {
 	return c.Send(msg)
 }
 
+// SendPoolStats sends pool-side account stats to the server
+func (c *Client) SendPoolStats(data interface{}) error {
+	msg := &Message{
+		Type: TypePoolStats,
+		Data: data,
+	}
+	return c.Send(msg)
+}
+
+// SendBootReport sends the startup self-test results to the server
+func (c *Client) SendBootReport(data interface{}) error {
+	msg := &Message{
+		Type: TypeBootReport,
+		Data: data,
+	}
+	return c.Send(msg)
+}
+
+// ErrHistoryUnsupported is returned by SendHistory for servers before
+// protocol 5, which don't accept history uploads
+var ErrHistoryUnsupported = errors.New("server doesn't accept history uploads")
+
+// SendHistory uploads stats samples buffered while offline
+func (c *Client) SendHistory(data interface{}) error {
+	c.mu.RLock()
+	protocol := c.serverProtocol
+	c.mu.RUnlock()
+	if protocol < 5 {
+		return fmt.Errorf("%w (protocol %d)", ErrHistoryUnsupported, protocol)
+	}
+
+	msg := &Message{
+		Type: TypeHistory,
+		Data: data,
+	}
+	return c.Send(msg)
+}
+
+// Event is a notable condition detected on the rig
+type Event struct {
+	Type     string      `json:"type"`
+	Severity string      `json:"severity"` // "info", "warning" or "critical"
+	Message  string      `json:"message"`
+	Data     interface{} `json:"data,omitempty"`
+}
+
+// SendEvent sends an event to the server
+func (c *Client) SendEvent(event *Event) error {
+	msg := &Message{
+		Type: TypeEvent,
+		Data: event,
+	}
+	return c.Send(msg)
+}
+
 // IsConnected returns true if connected and authenticated
 func (c *Client) IsConnected() bool {
 	c.mu.RLock()
@@ -414,6 +810,34 @@ func (c *Client) IsConnected() bool {
 	return c.connected && c.authenticated
 }
 
+// OfflineFor returns how long the client has gone without an
+// authenticated connection, 0 while authenticated
+func (c *Client) OfflineFor() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.authenticated || c.offlineSince.IsZero() {
+		return 0
+	}
+	return time.Since(c.offlineSince)
+}
+
+// AnyConnected returns true if this connection or one of its mirrors is
+// connected, i.e. telemetry has somewhere to go
+func (c *Client) AnyConnected() bool {
+	if c.IsConnected() {
+		return true
+	}
+	c.mu.RLock()
+	mirrors := c.mirrors
+	c.mu.RUnlock()
+	for _, mirror := range mirrors {
+		if mirror.IsConnected() {
+			return true
+		}
+	}
+	return false
+}
+
 // Close closes the WebSocket connection
 func (c *Client) Close() {
 	close(c.done)
@@ -426,7 +850,6 @@ func (c *Client) Close() {
 	defer c.mu.Unlock()
 
 	if c.conn != nil {
-		c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
 		c.conn.Close()
 		c.conn = nil
 	}
@@ -435,6 +858,14 @@ func (c *Client) Close() {
 	c.authenticated = false
 }
 
+// Features returns the feature flags the server sent at authentication,
+// nil when it sent none
+func (c *Client) Features() map[string]bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.features
+}
+
 // GetRigID returns the rig ID assigned by the server
 func (c *Client) GetRigID() string {
 	c.mu.RLock()
@@ -0,0 +1,115 @@
+package ws
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+)
+
+// ErrorTokenConflict is the code of an error message refusing a
+// connection, or ending one, because another agent uses the same token
+const ErrorTokenConflict = "token_conflict"
+
+// conflictRetry is how long a refused agent waits before trying again.
+// Reconnecting right away would take the identity back from the other
+// agent, which would do the same: the flapping this is meant to stop.
+const conflictRetry = 10 * time.Minute
+
+// errTokenConflict is returned by connect when the server refused the
+// token in favour of another agent
+var errTokenConflict = errors.New("token in use by another agent")
+
+// TokenConflict describes another agent connected with this rig's token,
+// as the server reports it. The server tells agents apart by the
+// "instanceId" auth parameter.
+type TokenConflict struct {
+	InstanceID string `json:"instanceId,omitempty"` // The other agent's
+	Hostname   string `json:"hostname,omitempty"`
+	Address    string `json:"address,omitempty"` // Its IP address
+	Since      int64  `json:"since,omitempty"`   // Unix seconds it has been connected
+	Refused    bool   `json:"refused"`           // This agent was refused or disconnected
+	DetectedAt int64  `json:"detectedAt"`        // Unix seconds
+}
+
+// SetConflictHandler sets a handler called when a token conflict starts,
+// changes or ends (with nil)
+func (c *Client) SetConflictHandler(handler func(*TokenConflict)) {
+	c.onConflict = handler
+}
+
+// TokenConflict returns the current token conflict, nil if there is none
+func (c *Client) TokenConflict() *TokenConflict {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.conflict == nil {
+		return nil
+	}
+	conflict := *c.conflict
+	return &conflict
+}
+
+// setConflict records the conflict the server reported, nil once it is
+// resolved, and tells the handler about changes
+func (c *Client) setConflict(reported *TokenConflict, refused bool) {
+	var conflict *TokenConflict
+	if reported != nil || refused {
+		conflict = &TokenConflict{}
+		if reported != nil {
+			*conflict = *reported
+		}
+		conflict.Refused = refused
+		conflict.DetectedAt = time.Now().Unix()
+	}
+
+	c.mu.Lock()
+	previous := c.conflict
+	if previous != nil && conflict != nil && previous.InstanceID == conflict.InstanceID && previous.Refused == conflict.Refused {
+		conflict.DetectedAt = previous.DetectedAt
+	}
+	c.conflict = conflict
+	c.mu.Unlock()
+
+	switch {
+	case conflict == nil && previous == nil:
+		return
+	case conflict == nil:
+		log.Printf("Token conflict resolved")
+	case previous != nil && *previous == *conflict:
+		return
+	case refused:
+		log.Printf("TOKEN CONFLICT: the server refused this agent, another agent uses the same token (%s); retrying every %s. Give this rig its own token.", describeConflict(conflict), conflictRetry)
+	default:
+		log.Printf("TOKEN CONFLICT: another agent is connected with the same token (%s). Give this rig its own token.", describeConflict(conflict))
+	}
+	if c.onConflict != nil {
+		c.onConflict(conflict)
+	}
+}
+
+// describeConflict names the other agent as far as the server said
+func describeConflict(conflict *TokenConflict) string {
+	var parts []string
+	if conflict.Hostname != "" {
+		parts = append(parts, "host "+conflict.Hostname)
+	}
+	if conflict.Address != "" {
+		parts = append(parts, "address "+conflict.Address)
+	}
+	if conflict.InstanceID != "" {
+		parts = append(parts, "instance "+conflict.InstanceID)
+	}
+	if len(parts) == 0 {
+		return "no details from the server"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// waitConflict waits before retrying a connection refused for a token
+// conflict, or until the client is closed
+func (c *Client) waitConflict() {
+	select {
+	case <-c.done:
+	case <-time.After(conflictRetry):
+	}
+}
@@ -0,0 +1,95 @@
+package ws
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// Bounds for keepalive values from the server
+const (
+	minKeepalive        = 5 * time.Second
+	maxKeepalive        = 5 * time.Minute
+	maxHandshakeTimeout = 2 * time.Minute
+)
+
+// defaultHandshakeTimeout matches the WebSocket library's default
+const defaultHandshakeTimeout = 45 * time.Second
+
+// Keepalive tunes how the connection survives NAT routers that drop idle
+// connections, e.g. LTE routers timing out well under the default 30s
+// heartbeat. Zero fields leave the current value.
+type Keepalive struct {
+	Heartbeat        int `json:"heartbeat,omitempty"`        // Seconds between heartbeats
+	TCPKeepAlive     int `json:"tcpKeepalive,omitempty"`     // Seconds between TCP keepalive probes
+	HandshakeTimeout int `json:"handshakeTimeout,omitempty"` // Seconds to connect and authenticate
+}
+
+// SetKeepalive sets the heartbeat interval, TCP keepalive and handshake
+// timeout. Call before Connect; the server may override them at
+// authentication.
+func (c *Client) SetKeepalive(settings Keepalive) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.applyKeepalive(settings)
+}
+
+// applyKeepalive sets the values within bounds; c.mu must be held. The
+// heartbeat applies from the next heartbeat, the rest from the next
+// connection.
+func (c *Client) applyKeepalive(settings Keepalive) {
+	if settings.Heartbeat > 0 {
+		c.heartbeatInterval = clampDuration(settings.Heartbeat, minKeepalive, maxKeepalive)
+	}
+	if settings.TCPKeepAlive > 0 {
+		c.tcpKeepAlive = clampDuration(settings.TCPKeepAlive, minKeepalive, maxKeepalive)
+	}
+	if settings.HandshakeTimeout > 0 {
+		c.handshakeTimeout = clampDuration(settings.HandshakeTimeout, minKeepalive, maxHandshakeTimeout)
+	}
+}
+
+// Keepalive returns the current values
+func (c *Client) Keepalive() Keepalive {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return Keepalive{
+		Heartbeat:        int(c.heartbeatInterval / time.Second),
+		TCPKeepAlive:     int(c.tcpKeepAlive / time.Second),
+		HandshakeTimeout: int(c.handshakeTimeout / time.Second),
+	}
+}
+
+// keepaliveDial wraps dial (or the default dialer) to set the TCP
+// keepalive period on each connection
+func (c *Client) keepaliveDial(dial DialFunc) DialFunc {
+	c.mu.RLock()
+	period := c.tcpKeepAlive
+	c.mu.RUnlock()
+	if period == 0 {
+		return dial
+	}
+	if dial == nil {
+		dialer := &net.Dialer{KeepAlive: period}
+		return dialer.DialContext
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if tcp, ok := conn.(*net.TCPConn); ok && err == nil {
+			tcp.SetKeepAlive(true)
+			tcp.SetKeepAlivePeriod(period)
+		}
+		return conn, err
+	}
+}
+
+func clampDuration(seconds int, min, max time.Duration) time.Duration {
+	d := time.Duration(seconds) * time.Second
+	if d < min {
+		return min
+	}
+	if d > max {
+		return max
+	}
+	return d
+}
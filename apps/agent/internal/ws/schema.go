@@ -0,0 +1,109 @@
+package ws
+
+import (
+	"encoding/json"
+)
+
+// ProtocolVersion is the message schema version of this agent. It is sent
+// as the "protocol" auth parameter; servers reply with their own version in
+// the authenticated message and downconvert commands for older agents.
+// Servers that don't reply with a version speak version 1.
+//
+//	1: stats (gpus, cpu), miner_status, command results and heartbeats
+//	2: event and pool_stats messages, additional stats groups and fields
+//	3: batch frames carrying several messages
+//	4: health digest in heartbeats
+//	5: compressed history uploads of stats buffered while offline
+const ProtocolVersion = 5
+
+// schemaNode lists the fields a schema version allows below a JSON value.
+// A nil node keeps the value unchanged and an empty node drops it; arrays
+// apply the node to each element.
+type schemaNode map[string]schemaNode
+
+// schemas maps older protocol versions to the fields they accept per
+// message type. Message types missing from a schema are not sent.
+var schemas = map[int]map[string]schemaNode{
+	1: {
+		TypeStats: {
+			"gpus": {
+				"index": nil, "name": nil, "vendor": nil, "temperature": nil,
+				"memTemp": nil, "fanSpeed": nil, "powerDraw": nil, "coreClock": nil,
+				"memoryClock": nil, "utilization": nil, "vram": nil, "busId": nil,
+			},
+			"cpu": {
+				"model": nil, "vendor": nil, "cores": nil, "threads": nil,
+				"temperature": nil, "usage": nil, "frequency": nil, "powerDraw": nil,
+			},
+		},
+		TypeMinerStatus: {
+			"name": nil, "version": nil, "running": nil, "pid": nil,
+			"algorithm": nil, "pool": nil, "hashrate": nil, "uptime": nil, "shares": nil,
+			"gpuStats": {
+				"index": nil, "hashrate": nil, "temperature": nil, "fanSpeed": nil, "power": nil,
+			},
+		},
+		TypeHeartbeat:     {},
+		TypeCommandResult: nil,
+	},
+}
+
+// downconvert adapts an outgoing message to the server's schema version.
+// It returns false when the server doesn't know the message type.
+func downconvert(msg *Message, version int) (*Message, bool) {
+	schema, ok := schemas[version]
+	if !ok || version >= ProtocolVersion {
+		return msg, true
+	}
+
+	node, ok := schema[msg.Type]
+	if !ok {
+		return nil, false
+	}
+	if node == nil || msg.Data == nil {
+		return msg, true
+	}
+	if len(node) == 0 {
+		converted := *msg
+		converted.Data = nil
+		return &converted, true
+	}
+
+	// Prune a generic copy so typed payloads need no per-version structs
+	data, err := json.Marshal(msg.Data)
+	if err != nil {
+		return msg, true
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return msg, true
+	}
+
+	converted := *msg
+	converted.Data = prune(value, node)
+	return &converted, true
+}
+
+// prune drops fields not listed in node
+func prune(value interface{}, node schemaNode) interface{} {
+	if node == nil {
+		return value
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			child, ok := node[key]
+			if !ok {
+				delete(v, key)
+				continue
+			}
+			v[key] = prune(field, child)
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = prune(v[i], node)
+		}
+	}
+	return value
+}
@@ -0,0 +1,232 @@
+package ws
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// Outbound shaping keeps a fleet from flooding the server, e.g. when
+// thousands of agents reconnect at once after an outage: frames are rate
+// limited, and small messages queued together share one batch frame.
+const (
+	outboundQueueSize = 256
+	maxBatchMessages  = 32
+	maxBatchBytes     = 64 << 10 // Larger messages are sent on their own
+	maxPendingResults = 32       // Command results kept for the next connection
+)
+
+// unshapedTypes bypass the queue and are written right away, so the sender
+// learns whether they went out: a command result or history upload lost
+// in the queue on a disconnect can't be told from a delivered one
+var unshapedTypes = map[string]bool{
+	TypeCommandResult: true,
+	TypeHistory:       true,
+}
+
+// shaper queues outgoing messages for the write loop
+type shaper struct {
+	rate   float64       // Frames per second, 0 = unlimited
+	window time.Duration // How long to collect messages into a batch, 0 = no batching
+	queue  chan *Message
+	tokens float64
+	filled time.Time
+}
+
+// SetOutboundLimits limits the client to rate frames per second (0 =
+// unlimited) and batches messages queued within window into one frame
+// when the server supports it (0 = no batching). Call before Connect.
+func (c *Client) SetOutboundLimits(rate float64, window time.Duration) {
+	if rate <= 0 && window <= 0 {
+		return
+	}
+	c.shaper = &shaper{
+		rate:   rate,
+		window: window,
+		queue:  make(chan *Message, outboundQueueSize),
+	}
+	go c.writeLoop()
+}
+
+// enqueue hands a message to the write loop without blocking
+func (s *shaper) enqueue(msg *Message) bool {
+	select {
+	case s.queue <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+// writeLoop writes queued messages, batching and rate limiting them
+func (c *Client) writeLoop() {
+	s := c.shaper
+	for {
+		var msg *Message
+		select {
+		case <-c.done:
+			return
+		case msg = <-s.queue:
+		}
+
+		batch := []*Message{msg}
+		if c.canBatch() {
+			batch = c.collect(batch)
+		}
+
+		for _, frame := range framesOf(batch, c.canBatch()) {
+			if !s.wait(c.done) {
+				return
+			}
+			c.write(frame)
+		}
+	}
+}
+
+// canBatch reports whether the connection and server accept batch frames
+func (c *Client) canBatch() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	conn, ok := c.conn.(BatchConn)
+	return c.shaper.window > 0 && ok && conn.SupportsBatch() && c.serverProtocol >= 3
+}
+
+// collect adds the messages queued within the batch window. A heartbeat
+// goes out right away so the clock offset measurement stays accurate.
+func (c *Client) collect(batch []*Message) []*Message {
+	s := c.shaper
+	timer := time.NewTimer(s.window)
+	defer timer.Stop()
+
+	for len(batch) < maxBatchMessages && batch[len(batch)-1].Type != TypeHeartbeat {
+		select {
+		case msg := <-s.queue:
+			batch = append(batch, msg)
+		case <-timer.C:
+			return batch
+		case <-c.done:
+			return batch
+		}
+	}
+	return batch
+}
+
+// framesOf groups messages into frames of at most maxBatchBytes
+func framesOf(messages []*Message, batching bool) []*Message {
+	if !batching || len(messages) == 1 {
+		return messages
+	}
+
+	var frames []*Message
+	var group []*Message
+	size := 0
+	flush := func() {
+		switch len(group) {
+		case 0:
+		case 1:
+			frames = append(frames, group[0])
+		default:
+			frames = append(frames, &Message{Type: TypeBatch, Messages: group, Timestamp: time.Now().UnixMilli()})
+		}
+		group, size = nil, 0
+	}
+
+	for _, msg := range messages {
+		n := maxBatchBytes
+		if data, err := json.Marshal(msg); err == nil {
+			n = len(data)
+		}
+		if size+n > maxBatchBytes {
+			flush()
+		}
+		group = append(group, msg)
+		size += n
+	}
+	flush()
+	return frames
+}
+
+// wait takes a token from the rate limiter, sleeping until one is free.
+// It returns false when the client is closed.
+func (s *shaper) wait(done chan struct{}) bool {
+	if s.rate <= 0 {
+		return true
+	}
+	burst := s.rate
+	if burst < 1 {
+		burst = 1
+	}
+
+	now := time.Now()
+	if s.filled.IsZero() {
+		s.tokens = burst
+	} else {
+		s.tokens += now.Sub(s.filled).Seconds() * s.rate
+		if s.tokens > burst {
+			s.tokens = burst
+		}
+	}
+	s.filled = now
+
+	if s.tokens < 1 {
+		delay := time.Duration((1 - s.tokens) / s.rate * float64(time.Second))
+		select {
+		case <-time.After(delay):
+		case <-done:
+			return false
+		}
+		s.tokens = 1
+		s.filled = time.Now()
+	}
+	s.tokens--
+	return true
+}
+
+// holdResult keeps a command result that couldn't be sent for the next
+// connection, dropping the oldest beyond maxPendingResults
+func (c *Client) holdResult(result *Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pendingResults = append(c.pendingResults, result)
+	if len(c.pendingResults) > maxPendingResults {
+		c.pendingResults = c.pendingResults[len(c.pendingResults)-maxPendingResults:]
+	}
+}
+
+// resendResults sends the held command results once authenticated again
+func (c *Client) resendResults() {
+	c.mu.Lock()
+	results := c.pendingResults
+	c.pendingResults = nil
+	c.mu.Unlock()
+
+	for i, result := range results {
+		if err := c.Send(result); err != nil {
+			log.Printf("Failed to resend command result: %v", err)
+			for _, unsent := range results[i:] {
+				c.holdResult(unsent)
+			}
+			return
+		}
+	}
+	if len(results) > 0 {
+		log.Printf("Sent %d command result(s) held over a disconnect", len(results))
+	}
+}
+
+// write sends one frame on the current connection. Frames queued before a
+// disconnect are dropped rather than sent ahead of the next auth.
+func (c *Client) write(frame *Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil || !c.authenticated {
+		if c.debug {
+			log.Printf("Dropping %s message: not connected", frame.Type)
+		}
+		return
+	}
+	if err := c.conn.WriteMessage(frame); err != nil {
+		log.Printf("Failed to send %s message: %v", frame.Type, err)
+	}
+}